@@ -0,0 +1,385 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// FieldAlignment is the padding report of a struct type,
+// see (*StructType).FieldAlignment.
+type FieldAlignment struct {
+	Type        string   `json:"type"`
+	Filename    string   `json:"filename"`
+	Arch        string   `json:"arch"`
+	Size        int64    `json:"size"`
+	OptimalSize int64    `json:"optimal_size"`
+	Fields      []string `json:"fields"`  // the field names in the declared order
+	Optimal     []string `json:"optimal"` // the field names in the optimal order
+}
+
+// Wasted returns the bytes of padding saved by the optimal order.
+func (a *FieldAlignment) Wasted() int64 {
+	return a.Size - a.OptimalSize
+}
+
+// String returns the report line, e.g.
+//  a.go: T: 24 bytes, 8 wasted (arch amd64), optimal order: B, A, C
+func (a *FieldAlignment) String() string {
+	return fmt.Sprintf("%s: %s: %d bytes, %d wasted (arch %s), optimal order: %s",
+		a.Filename, a.Type, a.Size, a.Wasted(), a.Arch, strings.Join(a.Optimal, ", "))
+}
+
+// FieldAlignments returns the padding reports of the named struct types of
+// the package which waste bytes on the GOARCH, or the default one if empty,
+// sorted by file name and position, without changing them.
+// The types whose sizes can not be computed are skipped,
+// see (*StructType).FieldAlignment.
+func (p *Package) FieldAlignments(goarch string) ([]*FieldAlignment, error) {
+	if _, err := archSizes(goarch); err != nil {
+		return nil, err
+	}
+	var reports []*FieldAlignment
+	for _, f := range p.sortedFiles() {
+		for _, n := range f.sortedNodes() {
+			s, ok := n.(*StructType)
+			if !ok || s.Name() == "" || s.IsAlias() || s.typeParams != nil {
+				continue
+			}
+			a, err := s.FieldAlignment(goarch)
+			if err == nil && a.Wasted() > 0 {
+				reports = append(reports, a)
+			}
+		}
+	}
+	return reports, nil
+}
+
+// FieldAlignment returns the padding report of the struct type on the
+// GOARCH, or the default one if empty, with the optimal order of the fields:
+// the zero-sized ones, then by alignment and size, both descending.
+// The sizes of the types declared outside the module are resolved from the
+// export data, see Module.Importer.
+// Returns an error if a field type can not be sized, e.g. a type parameter.
+func (s *StructType) FieldAlignment(goarch string) (*FieldAlignment, error) {
+	sizes, err := archSizes(goarch)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := s.fieldVars()
+	if err != nil {
+		return nil, err
+	}
+	if goarch == "" {
+		goarch = build.Default.GOARCH
+	}
+	a := &FieldAlignment{Type: s.Name(), Filename: s.Filename(), Arch: goarch}
+	for _, v := range vars {
+		a.Fields = append(a.Fields, v.Name())
+	}
+	a.Size = sizes.Sizeof(types.NewStruct(vars, nil))
+	order := optimalOrder(vars, sizes)
+	optimal := make([]*types.Var, len(order))
+	for i, j := range order {
+		optimal[i] = vars[j]
+		a.Optimal = append(a.Optimal, a.Fields[j])
+	}
+	a.OptimalSize = sizes.Sizeof(types.NewStruct(optimal, nil))
+	if a.OptimalSize >= a.Size {
+		// keeps the declared order
+		a.OptimalSize = a.Size
+		a.Optimal = append(a.Optimal[:0], a.Fields...)
+	}
+	return a, nil
+}
+
+// OptimizeFieldOrder reorders the fields of the struct type to the optimal
+// order of the GOARCH, or the default one if empty, if it saves bytes, see
+// FieldAlignment. The doc and line comments and the tags of the fields are
+// moved along with them.
+// Returns an error if the type is used in unkeyed composite literals,
+// which depend on the field order.
+// NOTE: The file is reparsed after reordering, and the node is no longer valid.
+func (s *StructType) OptimizeFieldOrder(goarch string) (*FieldAlignment, error) {
+	a, err := s.FieldAlignment(goarch)
+	if err != nil || a.Wasted() == 0 {
+		return a, err
+	}
+	if s.Name() == "" {
+		return nil, fmt.Errorf("aster: anonymous struct can not be reordered")
+	}
+	if s.file.hasUnkeyedLit(s) {
+		return nil, fmt.Errorf("aster: struct is used in unkeyed composite literals: %s", s.Name())
+	}
+	f := s.file
+	index := make(map[string]int, len(a.Fields))
+	for i, name := range a.Fields {
+		index[name] = i
+	}
+	// the fields are declared one per line after refreshing
+	if err = f.refresh(); err != nil {
+		return nil, err
+	}
+	t, _ := f.LookupType(s.Name())
+	st, ok := t.(*StructType)
+	if !ok || len(st.StructType.Fields.List) != len(a.Fields) {
+		return nil, fmt.Errorf("aster: struct not found: %s", s.Name())
+	}
+	fields := st.StructType.Fields.List
+	// segments[i] is the text of the i'th field, with its comments
+	segments := make([]string, len(fields))
+	bounds := make([]int, len(fields)+1)
+	for i, field := range fields {
+		end := field.End()
+		if field.Comment != nil {
+			end = field.Comment.End()
+		}
+		_, bounds[i+1] = f.lineRange(f.offset(end), f.offset(end))
+	}
+	first := fields[0]
+	start := first.Pos()
+	if first.Doc != nil {
+		start = first.Doc.Pos()
+	}
+	bounds[0], _ = f.lineRange(f.offset(start), f.offset(start))
+	for i := range segments {
+		segments[i] = strings.TrimLeft(string(f.Src[bounds[i]:bounds[i+1]]), "\n")
+	}
+	var b strings.Builder
+	for _, name := range a.Optimal {
+		b.WriteString(segments[index[name]])
+	}
+	edit := textEdit{start: bounds[0], end: bounds[len(bounds)-1], text: b.String()}
+	if err = f.applyEdits([]textEdit{edit}); err != nil {
+		return nil, err
+	}
+	// realigns the tags and comments
+	return a, f.refresh()
+}
+
+// Layout is the memory layout of a struct type, see (*StructType).Layout.
+type Layout struct {
+	Type    string         `json:"type"`
+	Arch    string         `json:"arch"`
+	Size    int64          `json:"size"`
+	Align   int64          `json:"align"`
+	Padding int64          `json:"padding"` // the bytes of padding in total
+	Fields  []*FieldLayout `json:"fields"`
+}
+
+// FieldLayout is the memory layout of a struct field.
+type FieldLayout struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Offset  int64  `json:"offset"`
+	Size    int64  `json:"size"`
+	Align   int64  `json:"align"`
+	Padding int64  `json:"padding"` // the bytes of padding after the field
+}
+
+// String returns the layout as a table, e.g.
+//  T: size 24, align 8, padding 14 (arch amd64)
+//  	offset  size  align  padding  field
+//  	     0     1      1        7  A bool
+//  	     8     8      8        0  B int64
+//  	    16     1      1        7  C bool
+func (l *Layout) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: size %d, align %d, padding %d (arch %s)\n", l.Type, l.Size, l.Align, l.Padding, l.Arch)
+	b.WriteString("\toffset  size  align  padding  field\n")
+	for _, f := range l.Fields {
+		fmt.Fprintf(&b, "\t%6d  %4d  %5d  %7d  %s %s\n", f.Offset, f.Size, f.Align, f.Padding, f.Name, f.Type)
+	}
+	return b.String()
+}
+
+// Layout returns the memory layout of the struct type on the GOARCH, or the
+// default one if empty: the offset, size and alignment of each field, and
+// the padding after it, computed as by the gc compiler.
+// The sizes of the types declared outside the module are resolved from the
+// export data, see Module.Importer.
+// Returns an error if a field type can not be sized, e.g. a type parameter.
+func (s *StructType) Layout(goarch string) (*Layout, error) {
+	sizes, err := archSizes(goarch)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := s.fieldVars()
+	if err != nil {
+		return nil, err
+	}
+	if goarch == "" {
+		goarch = build.Default.GOARCH
+	}
+	st := types.NewStruct(vars, nil)
+	l := &Layout{Type: s.Name(), Arch: goarch, Size: sizes.Sizeof(st), Align: sizes.Alignof(st)}
+	offsets := sizes.Offsetsof(vars)
+	for i, v := range vars {
+		fl := &FieldLayout{
+			Name:   v.Name(),
+			Type:   s.fields[i].TypeName(),
+			Offset: offsets[i],
+			Size:   sizes.Sizeof(v.Type()),
+			Align:  sizes.Alignof(v.Type()),
+		}
+		next := l.Size
+		if i+1 < len(vars) {
+			next = offsets[i+1]
+		}
+		fl.Padding = next - fl.Offset - fl.Size
+		l.Padding += fl.Padding
+		l.Fields = append(l.Fields, fl)
+	}
+	return l, nil
+}
+
+// fieldVars returns the fields of the struct type as the variables of the
+// types of the same sizes, see (*File).sizedType.
+func (s *StructType) fieldVars() ([]*types.Var, error) {
+	vars := make([]*types.Var, len(s.fields))
+	for i, field := range s.fields {
+		typ, err := s.file.sizedType(field.Field.Type, 0)
+		if err != nil {
+			return nil, fmt.Errorf("aster: field %s of %s: %w", field.Name(), s.Name(), err)
+		}
+		vars[i] = types.NewField(token.NoPos, nil, field.Name(), typ, false)
+	}
+	return vars, nil
+}
+
+// optimalOrder returns the indexes of the fields in the optimal order.
+func optimalOrder(vars []*types.Var, sizes types.Sizes) []int {
+	order := make([]int, len(vars))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := vars[order[i]].Type(), vars[order[j]].Type()
+		za, zb := sizes.Sizeof(a) == 0, sizes.Sizeof(b) == 0
+		if za != zb {
+			return za
+		}
+		if x, y := sizes.Alignof(a), sizes.Alignof(b); x != y {
+			return x > y
+		}
+		return sizes.Sizeof(a) > sizes.Sizeof(b)
+	})
+	return order
+}
+
+// archSizes returns the sizes of the gc compiler on the GOARCH,
+// or the default one if empty.
+func archSizes(goarch string) (types.Sizes, error) {
+	if goarch == "" {
+		goarch = build.Default.GOARCH
+	}
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return nil, fmt.Errorf("aster: unknown GOARCH: %s", goarch)
+	}
+	return sizes, nil
+}
+
+// maxSizedDepth limits the named types resolved by sizedType,
+// against cyclic declarations.
+const maxSizedDepth = 32
+
+// sizedType returns a type of the same size and alignment as the type
+// expression, resolving the named types declared in the module, and those
+// declared outside from the export data.
+func (f *File) sizedType(e ast.Expr, depth int) (types.Type, error) {
+	if depth > maxSizedDepth {
+		return nil, fmt.Errorf("cyclic type: %s", f.TryFormatNode(e))
+	}
+	word := types.Typ[types.UnsafePointer]
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return f.sizedType(x.X, depth)
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType:
+		return word, nil
+	case *ast.InterfaceType:
+		return types.NewInterfaceType(nil, nil).Complete(), nil
+	case *ast.ArrayType:
+		if x.Len == nil {
+			return types.NewSlice(word), nil
+		}
+		elem, err := f.sizedType(x.Elt, depth)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := evalConst(x.Len, 0, f.packageConsts(), "")
+		n, exact := constant.Int64Val(v)
+		if !ok || !exact {
+			return nil, fmt.Errorf("array length: %s", f.TryFormatNode(x.Len))
+		}
+		return types.NewArray(elem, n), nil
+	case *ast.StructType:
+		var vars []*types.Var
+		for _, field := range x.Fields.List {
+			typ, err := f.sizedType(field.Type, depth)
+			if err != nil {
+				return nil, err
+			}
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				vars = append(vars, types.NewField(token.NoPos, nil, "_", typ, false))
+			}
+		}
+		return types.NewStruct(vars, nil), nil
+	case *ast.Ident:
+		if obj, ok := types.Universe.Lookup(x.Name).(*types.TypeName); ok {
+			return obj.Type(), nil
+		}
+		t, ok := f.LookupTypeInPkg(x.Name)
+		if !ok {
+			return nil, fmt.Errorf("type not found: %s", x.Name)
+		}
+		return nodeFile(t.(Node)).sizedNode(t, depth)
+	case *ast.SelectorExpr:
+		if p, ok := f.importedPackage(x.X); ok {
+			if t, ok := p.LookupType(x.Sel.Name); ok {
+				return nodeFile(t.(Node)).sizedNode(t, depth)
+			}
+		}
+		obj, err := f.LookupExternalType(f.TryFormatNode(x))
+		if err != nil {
+			return nil, err
+		}
+		return obj.Type(), nil
+	}
+	return nil, fmt.Errorf("unsupported type: %s", f.TryFormatNode(e))
+}
+
+// sizedNode returns a type of the same size and alignment as the named type.
+func (f *File) sizedNode(t TypeNode, depth int) (types.Type, error) {
+	if t.TypeParams() != nil {
+		return nil, fmt.Errorf("generic type: %s", t.Name())
+	}
+	expr, ok := t.Node().(ast.Expr)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %s", t.Name())
+	}
+	return f.sizedType(expr, depth+1)
+}
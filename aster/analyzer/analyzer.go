@@ -0,0 +1,330 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analyzer adapts the analyzers of golang.org/x/tools/go/analysis to
+// the modules of aster, and the other way around, so that the checks of both
+// run in one pipeline over the same syntax trees and type information.
+//
+// Run runs the analyzers on the packages of a module, e.g.
+//
+//	m, _ := aster.ParseDir("./pkg", nil)
+//	diags, err := analyzer.Run(m, nilness.Analyzer, printf.Analyzer)
+//
+// and New packages a check over the aster nodes as an analyzer, e.g. for
+// singlechecker.Main:
+//
+//	var Analyzer = analyzer.New("deprecated", "reports the uses of ...",
+//		func(pass *analysis.Pass, p *aster.Package) error {
+//			...
+//			pass.Reportf(pos, "...")
+//			return nil
+//		})
+//
+// The passes of Run are given the type errors of the package, and its
+// other and ignored files found in the package directory by go/build.
+// Pass.ReadFile of the later versions of golang.org/x/tools is not supported,
+// so the analyzers read the other files themselves.
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"unsafe"
+
+	"github.com/henrylee2cn/aster/aster"
+	"golang.org/x/tools/go/analysis"
+)
+
+// Diagnostic is a diagnostic reported by an analyzer on a package.
+type Diagnostic struct {
+	analysis.Diagnostic
+	Analyzer string         `json:"analyzer"`
+	Position token.Position `json:"position"`
+}
+
+// String returns the diagnostic message.
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Position, d.Message, d.Analyzer)
+}
+
+// Run runs the analyzers on the packages of the module, see RunPackage,
+// and returns the diagnostics sorted by position.
+func Run(m *aster.Module, analyzers ...*analysis.Analyzer) ([]*Diagnostic, error) {
+	if err := analysis.Validate(analyzers); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(m.Packages))
+	for name := range m.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diags []*Diagnostic
+	for _, name := range names {
+		d, err := RunPackage(m.Packages[name], analyzers...)
+		if err != nil {
+			return nil, err
+		}
+		diags = append(diags, d...)
+	}
+	sortDiagnostics(diags)
+	return diags, nil
+}
+
+// RunPackage runs the analyzers on the package, after the ones they require,
+// sharing the FileSet and the syntax trees of the package, and the type
+// information of it, see aster.Package.TypeCheck. It returns the diagnostics
+// of the analyzers, not the required ones, sorted by position.
+//
+// The analyzers not set to run despite errors are skipped if the package has
+// type errors, and so are the ones requiring them. The facts are shared
+// within the package only, so the facts of the imported objects are not found.
+func RunPackage(p *aster.Package, analyzers ...*analysis.Analyzer) ([]*Diagnostic, error) {
+	if err := analysis.Validate(analyzers); err != nil {
+		return nil, err
+	}
+	r := &runner{
+		fset:    p.FileSet,
+		roots:   make(map[*analysis.Analyzer]bool, len(analyzers)),
+		results: make(map[*analysis.Analyzer]*result),
+		facts:   make(map[factKey]analysis.Fact),
+	}
+	names := make([]string, 0, len(p.Files))
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.files = append(r.files, p.Files[name].File)
+	}
+	r.pkg, r.info, r.typeErrors = p.TypeCheck()
+	if r.pkg == nil {
+		return nil, fmt.Errorf("aster: failed to type-check package %s", p.Name)
+	}
+	r.otherFiles, r.ignoredFiles = otherFiles(p.Dir)
+	for _, a := range analyzers {
+		r.roots[a] = true
+	}
+	for _, a := range analyzers {
+		if res := r.run(a); res.err != nil {
+			return nil, res.err
+		}
+	}
+	sortDiagnostics(r.diags)
+	return r.diags, nil
+}
+
+// New returns the analyzer running the check over the aster package of the
+// files of the pass, sharing the FileSet and the syntax trees of them,
+// see aster.NewModuleFromFiles.
+func New(name, doc string, check func(pass *analysis.Pass, p *aster.Package) error) *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name: name,
+		Doc:  doc,
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			if len(pass.Files) == 0 {
+				return nil, nil
+			}
+			m := aster.NewModuleFromFiles(pass.Fset, pass.Files...)
+			p, ok := m.Packages[pass.Files[0].Name.Name]
+			if !ok {
+				return nil, nil
+			}
+			return nil, check(pass, p)
+		},
+	}
+}
+
+// runner runs the analyzers on a package.
+type runner struct {
+	fset       *token.FileSet
+	files      []*ast.File
+	pkg        *types.Package
+	info       *types.Info
+	typeErrors []types.Error
+	roots      map[*analysis.Analyzer]bool
+	results    map[*analysis.Analyzer]*result
+	facts      map[factKey]analysis.Fact
+	diags      []*Diagnostic
+
+	// the files of Pass.OtherFiles and Pass.IgnoredFiles
+	otherFiles, ignoredFiles []string
+}
+
+// otherFiles returns the absolute paths of the non-Go source files of the
+// package directory, and the ones of the files ignored by the build
+// constraints, as go/packages does. Returns nil if there is no directory.
+func otherFiles(dir string) (others, ignored []string) {
+	if dir == "" {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil
+	}
+	bp, err := build.ImportDir(dir, build.ImportComment)
+	if bp == nil || err != nil && len(bp.GoFiles)+len(bp.IgnoredGoFiles) == 0 {
+		return nil, nil
+	}
+	for _, names := range [][]string{bp.CFiles, bp.CXXFiles, bp.MFiles, bp.HFiles, bp.FFiles, bp.SFiles, bp.SwigFiles, bp.SwigCXXFiles, bp.SysoFiles} {
+		for _, name := range names {
+			others = append(others, filepath.Join(dir, name))
+		}
+	}
+	for _, names := range [][]string{bp.IgnoredGoFiles, bp.IgnoredOtherFiles} {
+		for _, name := range names {
+			ignored = append(ignored, filepath.Join(dir, name))
+		}
+	}
+	return others, ignored
+}
+
+// setTypeErrors gives the type errors to the pass. The field is not exported
+// by this version of golang.org/x/tools, but set by its drivers through an
+// internal package, and read by the analyzers through another one, so it is
+// set by reflection, as is the exported TypeErrors of the later versions.
+func setTypeErrors(pass *analysis.Pass, errs []types.Error) {
+	v := reflect.ValueOf(pass).Elem()
+	for _, name := range []string{"TypeErrors", "typeErrors"} {
+		if f := v.FieldByName(name); f.IsValid() && f.Type() == reflect.TypeOf(errs) {
+			reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(errs))
+			return
+		}
+	}
+}
+
+// result is the result of an analyzer, or the error of it.
+type result struct {
+	value   interface{}
+	err     error
+	skipped bool
+}
+
+// factKey is the key of a fact of an object, or of the package if nil.
+type factKey struct {
+	obj types.Object
+	typ reflect.Type
+}
+
+// run runs the analyzer once, after the ones it requires.
+func (r *runner) run(a *analysis.Analyzer) *result {
+	if res, ok := r.results[a]; ok {
+		return res
+	}
+	res := &result{}
+	r.results[a] = res
+	resultOf := make(map[*analysis.Analyzer]interface{}, len(a.Requires))
+	for _, req := range a.Requires {
+		reqRes := r.run(req)
+		if reqRes.err != nil || reqRes.skipped {
+			res.err, res.skipped = reqRes.err, reqRes.skipped
+			return res
+		}
+		resultOf[req] = reqRes.value
+	}
+	if len(r.typeErrors) > 0 && !a.RunDespiteErrors {
+		res.skipped = true
+		return res
+	}
+	pass := &analysis.Pass{
+		Analyzer:     a,
+		Fset:         r.fset,
+		Files:        r.files,
+		OtherFiles:   r.otherFiles,
+		IgnoredFiles: r.ignoredFiles,
+		Pkg:          r.pkg,
+		TypesInfo:    r.info,
+		TypesSizes:   types.SizesFor("gc", runtime.GOARCH),
+		ResultOf:     resultOf,
+		Report: func(d analysis.Diagnostic) {
+			if r.roots[a] {
+				r.diags = append(r.diags, &Diagnostic{Diagnostic: d, Analyzer: a.Name, Position: r.fset.Position(d.Pos)})
+			}
+		},
+		ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+			return r.importFact(factKey{obj, reflect.TypeOf(fact)}, fact)
+		},
+		ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+			if obj.Pkg() != r.pkg {
+				panic(fmt.Sprintf("aster: %s exported a fact of %s not in package %s", a.Name, obj, r.pkg.Path()))
+			}
+			r.facts[factKey{obj, reflect.TypeOf(fact)}] = fact
+		},
+		ImportPackageFact: func(pkg *types.Package, fact analysis.Fact) bool {
+			return pkg == r.pkg && r.importFact(factKey{nil, reflect.TypeOf(fact)}, fact)
+		},
+		ExportPackageFact: func(fact analysis.Fact) {
+			r.facts[factKey{nil, reflect.TypeOf(fact)}] = fact
+		},
+		AllObjectFacts: func() []analysis.ObjectFact {
+			var facts []analysis.ObjectFact
+			for k, fact := range r.facts {
+				if k.obj != nil && hasFactType(a, k.typ) {
+					facts = append(facts, analysis.ObjectFact{Object: k.obj, Fact: fact})
+				}
+			}
+			return facts
+		},
+		AllPackageFacts: func() []analysis.PackageFact {
+			var facts []analysis.PackageFact
+			for k, fact := range r.facts {
+				if k.obj == nil && hasFactType(a, k.typ) {
+					facts = append(facts, analysis.PackageFact{Package: r.pkg, Fact: fact})
+				}
+			}
+			return facts
+		},
+	}
+	setTypeErrors(pass, r.typeErrors)
+	res.value, res.err = a.Run(pass)
+	if res.err != nil {
+		res.err = fmt.Errorf("aster: analyzer %s failed on package %s: %v", a.Name, r.pkg.Path(), res.err)
+	}
+	return res
+}
+
+// importFact copies the fact of the key into fact, if any.
+func (r *runner) importFact(key factKey, fact analysis.Fact) bool {
+	v, ok := r.facts[key]
+	if ok {
+		reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(v).Elem())
+	}
+	return ok
+}
+
+// hasFactType reports whether the fact type is declared by the analyzer.
+func hasFactType(a *analysis.Analyzer, typ reflect.Type) bool {
+	for _, f := range a.FactTypes {
+		if reflect.TypeOf(f) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func sortDiagnostics(diags []*Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Position, diags[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Anchor is the stable identifier of a top-level node, a method or an
+// interface method, which survives reparsing and formatting, unlike token.Pos.
+// Its string form is "<package path>#<kind>#<name>", or
+// "<package path>#Func#<receiver type>.<name>" for a method, e.g.
+//  github.com/henrylee2cn/aster/aster#Struct#Module
+//  github.com/henrylee2cn/aster/aster#Func#Module.Reparse
+type Anchor struct {
+	PkgPath string // see Package.Path
+	Kind    Kind
+	Recv    string // the receiver base type, or the interface of a method
+	Name    string
+}
+
+// String returns the string form of the anchor.
+func (a Anchor) String() string {
+	name := a.Name
+	if a.Recv != "" {
+		name = a.Recv + "." + name
+	}
+	return a.PkgPath + "#" + a.Kind.String() + "#" + name
+}
+
+// ParseAnchor parses the string form of an anchor.
+func ParseAnchor(s string) (Anchor, error) {
+	parts := strings.Split(s, "#")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return Anchor{}, fmt.Errorf("aster: invalid anchor: %q", s)
+	}
+	a := Anchor{PkgPath: parts[0], Kind: Invalid, Name: parts[2]}
+	for k := Invalid; k <= Ptr; k++ {
+		if k.String() == parts[1] {
+			a.Kind = k
+		}
+	}
+	if a.Kind == Invalid {
+		return Anchor{}, fmt.Errorf("aster: invalid anchor kind: %q", s)
+	}
+	if i := strings.LastIndex(a.Name, "."); i >= 0 {
+		if a.Kind != Func {
+			return Anchor{}, fmt.Errorf("aster: invalid anchor receiver: %q", s)
+		}
+		a.Recv, a.Name = a.Name[:i], a.Name[i+1:]
+	}
+	return a, nil
+}
+
+// AnchorOf returns the anchor of the node.
+// The anonymous nodes, e.g. the types of struct fields, have no anchors.
+func AnchorOf(n Node) (Anchor, bool) {
+	if n.Name() == "" {
+		return Anchor{}, false
+	}
+	f := nodeFile(n)
+	if f == nil {
+		return Anchor{}, false
+	}
+	a := Anchor{Kind: n.Kind(), Name: n.Name(), Recv: recvTypeName(n)}
+	if p, ok := f.Package(); ok {
+		a.PkgPath = p.Path()
+	} else {
+		a.PkgPath = f.PkgName
+	}
+	if isInterfaceMethod(n) {
+		iface, ok := f.interfaceOf(n)
+		if !ok {
+			return Anchor{}, false
+		}
+		a.Recv = iface.Name()
+	}
+	return a, true
+}
+
+// interfaceOf returns the interface type declaring the method.
+func (f *File) interfaceOf(method Node) (TypeNode, bool) {
+	for _, n := range f.Nodes {
+		t, ok := n.(TypeNode)
+		if !ok || t.Kind() != Interface {
+			continue
+		}
+		for i := 0; i < t.NumMethod(); i++ {
+			if m, _ := t.Method(i); m.Node() == method.Node() {
+				return t, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// LookupAnchor returns the node of the anchor in the module.
+func (m *Module) LookupAnchor(a Anchor) (Node, bool) {
+	for _, p := range m.Packages {
+		if p.Path() == a.PkgPath {
+			return p.LookupAnchor(a)
+		}
+	}
+	return nil, false
+}
+
+// LookupAnchor returns the node of the anchor in the package,
+// ignoring the package path.
+func (p *Package) LookupAnchor(a Anchor) (Node, bool) {
+	if a.Recv != "" {
+		t, ok := p.LookupType(a.Recv)
+		if !ok || a.Kind != Func {
+			return nil, false
+		}
+		m, ok := t.MethodByName(a.Name)
+		if !ok {
+			return nil, false
+		}
+		return m.(Node), true
+	}
+	var found Node
+	p.Inspect(func(n Node) bool {
+		if n.Name() == a.Name && n.Kind() == a.Kind && recvTypeName(n) == "" {
+			found = n
+			return false
+		}
+		return true
+	})
+	return found, found != nil
+}
+
+// Path returns the import path of the package, resolved from the module
+// path in the nearest go.mod file, with the suffix "_test" for the external
+// test packages. Without a go.mod file, it is the package name.
+func (p *Package) Path() string {
+	pkgPath, ok := p.ImportPath()
+	if !ok {
+		return p.Name
+	}
+	if p.IsTest() {
+		pkgPath += "_test"
+	}
+	return pkgPath
+}
+
+// ImportPath returns the path importing the package, i.e. the module path
+// in the go.mod file of the module, see Module.ModFile, joined with the
+// directory of the package relative to the one of go.mod,
+// e.g. "example.com/mod/sub/pkg".
+// It is the same for the external test package as for the package tested.
+// Returns false if there is no go.mod file.
+func (p *Package) ImportPath() (string, bool) {
+	root, modPath, ok := p.moduleRoot()
+	if !ok {
+		return "", false
+	}
+	dir, _ := filepath.Abs(p.Dir)
+	rel, _ := filepath.Rel(root, dir)
+	return path.Join(modPath, filepath.ToSlash(rel)), true
+}
+
+// ImportPath returns the path importing the package of the file,
+// see Package.ImportPath.
+func (f *File) ImportPath() (string, bool) {
+	if f.pkg == nil {
+		return "", false
+	}
+	return f.pkg.ImportPath()
+}
+
+// moduleRoot returns the absolute directory and the path of the module
+// declared in the go.mod file of the module of the package, see
+// Module.ModFile.
+func (p *Package) moduleRoot() (dir, modPath string, ok bool) {
+	if p.module == nil || p.module.ModFile == nil || p.module.ModFile.Path == "" {
+		return "", "", false
+	}
+	mf := p.module.ModFile
+	return filepath.Dir(mf.Filename), mf.Path, true
+}
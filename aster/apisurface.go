@@ -0,0 +1,309 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// APISurface is the canonical description of the exported API of a package,
+// see Package.APISurface and CompareAPISurfaces.
+type APISurface struct {
+	Package string     `json:"package"`
+	Path    string     `json:"path"`
+	Decls   []*APIDecl `json:"decls"`
+}
+
+// APIDecl is an exported declaration of the API surface.
+type APIDecl struct {
+	// Name is the name of the declaration, qualified by the type for a method
+	// or a field, e.g. "Client.Do".
+	Name string `json:"name"`
+	// Kind is one of "type", "func", "method", "field", "embedded", "const"
+	// and "var"; the embedded ones are the embedded fields of a struct
+	// and the embedded types of an interface.
+	Kind string `json:"kind"`
+	// Type is the canonical type, e.g. "func(context.Context, int) error"
+	// without the parameter names, or "struct" and "interface" for a type
+	// whose fields and methods are listed on their own, or "= T" for an alias.
+	Type string `json:"type"`
+	// Recv is the receiver type of a method, e.g. "*Client",
+	// or empty for an interface method.
+	Recv string `json:"recv,omitempty"`
+}
+
+// APISurface returns the exported types, functions, methods, fields,
+// constants and variables declared in the package, sorted by name.
+// The types of the constants and variables declared without types are
+// inferred by type-checking the package, see Module.Importer.
+func (p *Package) APISurface() *APISurface {
+	s := &APISurface{Package: p.Name, Path: p.Path()}
+	var checked *types.Package
+	inferred := func(f *File, name string) string {
+		if checked == nil {
+			checked, _ = f.typesPackage()
+			if checked == nil {
+				return ""
+			}
+		}
+		obj := checked.Scope().Lookup(name)
+		if obj == nil || obj.Type() == types.Typ[types.Invalid] {
+			return ""
+		}
+		return types.TypeString(obj.Type(), func(pkg *types.Package) string {
+			if pkg == checked {
+				return ""
+			}
+			return pkg.Name()
+		})
+	}
+	for _, f := range p.sortedFiles() {
+		for _, decl := range f.File.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				sig := apiFuncType(d.Type)
+				if d.Recv == nil {
+					s.Decls = append(s.Decls, &APIDecl{Name: d.Name.Name, Kind: "func", Type: sig})
+					continue
+				}
+				typ, ptr := d.Recv.List[0].Type, ""
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ, ptr = star.X, "*"
+				}
+				if base := types.ExprString(genericBase(typ)); IsExported(base) {
+					s.Decls = append(s.Decls, &APIDecl{Name: base + "." + d.Name.Name, Kind: "method", Type: sig, Recv: ptr + base})
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if spec.Name.IsExported() {
+							s.Decls = append(s.Decls, apiTypeDecls(spec)...)
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if !name.IsExported() {
+								continue
+							}
+							typ := ""
+							if spec.Type != nil {
+								typ = types.ExprString(spec.Type)
+							} else {
+								typ = inferred(f, name.Name)
+							}
+							s.Decls = append(s.Decls, &APIDecl{Name: name.Name, Kind: strings.ToLower(d.Tok.String()), Type: typ})
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(s.Decls, func(i, j int) bool { return s.Decls[i].Name < s.Decls[j].Name })
+	return s
+}
+
+// apiTypeDecls returns the declarations of the exported type,
+// followed by its exported fields or interface methods.
+func apiTypeDecls(spec *ast.TypeSpec) []*APIDecl {
+	name := spec.Name.Name
+	var tparams string
+	if spec.TypeParams != nil {
+		tparams = apiFieldList(spec.TypeParams, true, "[", "]") + " "
+	}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		decls := []*APIDecl{{Name: name, Kind: "type", Type: tparams + "struct"}}
+		for _, field := range t.Fields.List {
+			typ := types.ExprString(field.Type)
+			if len(field.Names) == 0 {
+				base := genericBase(getElem(field.Type))
+				if sel, ok := base.(*ast.SelectorExpr); ok {
+					base = sel.Sel
+				}
+				if id, ok := base.(*ast.Ident); ok && id.IsExported() {
+					decls = append(decls, &APIDecl{Name: name + "." + id.Name, Kind: "embedded", Type: typ})
+				}
+			}
+			for _, id := range field.Names {
+				if id.IsExported() {
+					decls = append(decls, &APIDecl{Name: name + "." + id.Name, Kind: "field", Type: typ})
+				}
+			}
+		}
+		return decls
+	case *ast.InterfaceType:
+		decls := []*APIDecl{{Name: name, Kind: "type", Type: tparams + "interface"}}
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 {
+				typ := types.ExprString(field.Type)
+				decls = append(decls, &APIDecl{Name: name + "." + typ, Kind: "embedded", Type: typ})
+				continue
+			}
+			if ft, ok := field.Type.(*ast.FuncType); ok && field.Names[0].IsExported() {
+				decls = append(decls, &APIDecl{Name: name + "." + field.Names[0].Name, Kind: "method", Type: apiFuncType(ft)})
+			}
+		}
+		return decls
+	}
+	typ := types.ExprString(spec.Type)
+	if spec.Assign.IsValid() {
+		typ = "= " + typ
+	}
+	return []*APIDecl{{Name: name, Kind: "type", Type: tparams + typ}}
+}
+
+// apiFuncType returns the canonical function type, without the names of the
+// parameters and results.
+func apiFuncType(ft *ast.FuncType) string {
+	var b strings.Builder
+	b.WriteString("func")
+	if ft.TypeParams != nil {
+		b.WriteString(apiFieldList(ft.TypeParams, true, "[", "]"))
+	}
+	b.WriteString(apiFieldList(ft.Params, false, "(", ")"))
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		b.WriteString(" ")
+		if ft.Results.NumFields() == 1 {
+			b.WriteString(types.ExprString(ft.Results.List[0].Type))
+		} else {
+			b.WriteString(apiFieldList(ft.Results, false, "(", ")"))
+		}
+	}
+	return b.String()
+}
+
+// apiFieldList returns the types of the fields, one per name, between the
+// brackets, keeping the names if named is true, e.g. for type parameters.
+func apiFieldList(fl *ast.FieldList, named bool, open, close string) string {
+	var list []string
+	if fl != nil {
+		for _, field := range fl.List {
+			typ := types.ExprString(field.Type)
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				if named && len(field.Names) > 0 {
+					list = append(list, field.Names[i].Name+" "+typ)
+				} else {
+					list = append(list, typ)
+				}
+			}
+		}
+	}
+	return open + strings.Join(list, ", ") + close
+}
+
+// String returns the declarations, one per line, e.g.
+//
+//	func New func(string) *Client
+//	method (*Client).Do func(context.Context) error
+func (s *APISurface) String() string {
+	var buf bytes.Buffer
+	for _, d := range s.Decls {
+		buf.WriteString(d.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// String returns the declaration in one line.
+func (d *APIDecl) String() string {
+	name := d.Name
+	if d.Recv != "" {
+		name = "(" + d.Recv + ")" + name[strings.Index(name, "."):]
+	}
+	if d.Type == "" {
+		return d.Kind + " " + name
+	}
+	return d.Kind + " " + name + " " + d.Type
+}
+
+// APIChange is a change of a declaration between two API surfaces.
+type APIChange struct {
+	Name string   `json:"name"`
+	Old  *APIDecl `json:"old,omitempty"` // nil if added
+	New  *APIDecl `json:"new,omitempty"` // nil if removed
+	// Breaking reports whether the change may break the code using the old
+	// API, e.g. a removed declaration, a changed type or signature, or a
+	// method added to an interface.
+	Breaking bool `json:"breaking"`
+}
+
+// String returns the change in one line, e.g.
+// "breaking: removed func Foo func(int) error".
+func (c *APIChange) String() string {
+	prefix := "compatible: "
+	if c.Breaking {
+		prefix = "breaking: "
+	}
+	switch {
+	case c.Old == nil:
+		return prefix + "added " + c.New.String()
+	case c.New == nil:
+		return prefix + "removed " + c.Old.String()
+	}
+	return fmt.Sprintf("%schanged %s, was %s", prefix, c.New.String(), c.Old.String())
+}
+
+// CompareAPISurfaces returns the changes from the old API surface to the new
+// one, sorted by name, classifying them as compatible or breaking as apidiff
+// does: adding a declaration is compatible, except adding a method to an
+// interface, and removing one or changing its type is breaking, except
+// changing the receiver of a method from a pointer to a value.
+func CompareAPISurfaces(old, new *APISurface) []*APIChange {
+	olds := make(map[string]*APIDecl, len(old.Decls))
+	for _, d := range old.Decls {
+		olds[d.Name] = d
+	}
+	news := make(map[string]*APIDecl, len(new.Decls))
+	for _, d := range new.Decls {
+		news[d.Name] = d
+	}
+	var changes []*APIChange
+	for _, d := range old.Decls {
+		if _, ok := news[d.Name]; !ok {
+			changes = append(changes, &APIChange{Name: d.Name, Old: d, Breaking: true})
+		}
+	}
+	for _, d := range new.Decls {
+		o, ok := olds[d.Name]
+		switch {
+		case !ok:
+			// a new method of an old interface must be implemented
+			var breaking bool
+			if d.Kind == "method" && d.Recv == "" || d.Kind == "embedded" {
+				owner := olds[d.Name[:strings.Index(d.Name, ".")]]
+				breaking = owner != nil && strings.HasSuffix(owner.Type, "interface")
+			}
+			changes = append(changes, &APIChange{Name: d.Name, New: d, Breaking: breaking})
+		case o.Kind != d.Kind || o.Type != d.Type:
+			changes = append(changes, &APIChange{Name: d.Name, Old: o, New: d, Breaking: true})
+		case o.Recv != d.Recv:
+			changes = append(changes, &APIChange{Name: d.Name, Old: o, New: d, Breaking: "*"+d.Recv != o.Recv})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
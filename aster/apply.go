@@ -0,0 +1,302 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+)
+
+// Cursor describes a node encountered during File.Apply.
+type Cursor struct {
+	a *applier
+}
+
+// Node returns the current node.
+func (c Cursor) Node() ast.Node { return c.a.cur.node }
+
+// Parent returns the parent of the current node,
+// or nil for the *ast.File itself.
+func (c Cursor) Parent() ast.Node { return c.a.cur.parent }
+
+// Name returns the name of the parent field containing the current node,
+// e.g. "Decls" or "Body", or the empty string for the *ast.File itself.
+func (c Cursor) Name() string { return c.a.cur.name }
+
+// Index returns the index of the current node in the slice of the parent
+// field, e.g. of the declarations or the statements, or a value < 0 if the
+// current node is not part of a slice.
+func (c Cursor) Index() int { return c.a.cur.index }
+
+// Replace replaces the current node with n.
+// The replacement node is walked by Apply, unless replaced in post.
+// It panics if n can not be assigned to the parent field.
+func (c Cursor) Replace(n ast.Node) {
+	cur := &c.a.cur
+	if cur.parent == nil {
+		panic("aster: Replace of the root node")
+	}
+	v := reflect.ValueOf(n)
+	if cur.index >= 0 {
+		cur.field.Index(cur.index).Set(v)
+	} else {
+		cur.field.Set(v)
+	}
+	c.a.remove(cur.node)
+	cur.node = n
+}
+
+// Delete deletes the current node from its slice.
+// It panics if the current node is not part of a slice.
+func (c Cursor) Delete() {
+	cur := &c.a.cur
+	if cur.index < 0 {
+		panic("aster: Delete of a node not contained in a slice")
+	}
+	s, i := cur.field, cur.index
+	cur.field.Set(reflect.AppendSlice(s.Slice(0, i), s.Slice(i+1, s.Len())))
+	c.a.remove(cur.node)
+	c.a.iter.step--
+}
+
+// InsertAfter inserts n after the current node in its slice,
+// e.g. a declaration or a statement. The node is not walked by Apply.
+// It panics if the current node is not part of a slice.
+func (c Cursor) InsertAfter(n ast.Node) {
+	c.insert(c.a.cur.index+1, n)
+	c.a.iter.step++
+}
+
+// InsertBefore inserts n before the current node in its slice,
+// e.g. a declaration or a statement. The node is not walked by Apply.
+// It panics if the current node is not part of a slice.
+func (c Cursor) InsertBefore(n ast.Node) {
+	c.insert(c.a.cur.index, n)
+	c.a.cur.index++
+	c.a.iter.index++
+}
+
+func (c Cursor) insert(i int, n ast.Node) {
+	cur := &c.a.cur
+	if cur.index < 0 {
+		panic("aster: insertion next to a node not contained in a slice")
+	}
+	s := cur.field
+	v := reflect.New(s.Type()).Elem()
+	v = reflect.AppendSlice(v, s.Slice(0, i))
+	v = reflect.Append(v, reflect.ValueOf(n))
+	v = reflect.AppendSlice(v, s.Slice(i, s.Len()))
+	cur.field.Set(v)
+}
+
+// Apply traverses the syntax tree of the file recursively, like
+// golang.org/x/tools/go/ast/astutil.Apply, calling pre and post, if not nil,
+// for each non-nil node, in which the Cursor can replace or delete the node,
+// or insert siblings, e.g. declarations or statements.
+// If pre returns false, the children and post of the node are skipped.
+// If post returns false, the traversal is terminated.
+// Afterwards, the comments within the deleted and replaced nodes are dropped,
+// the missing and unused imports are fixed, see FixImports, and the file is
+// reparsed, so that Nodes, Imports and the positions are consistent, which
+// they are not after modifying the syntax tree directly.
+// NOTE: The nodes of the file are no longer valid after applying.
+func (f *File) Apply(pre, post func(Cursor) bool) (err error) {
+	a := &applier{pre: pre, post: post}
+	func() {
+		defer func() {
+			if r := recover(); r != nil && r != errAbortApply {
+				panic(r)
+			}
+		}()
+		a.apply(nil, "", reflect.Value{}, -1, f.File)
+	}()
+	a.dropComments(f.File)
+	// the declarations inserted, to be separated by blank lines
+	var inserted []int
+	for i, decl := range f.File.Decls {
+		if !decl.Pos().IsValid() {
+			inserted = append(inserted, i)
+		}
+	}
+	old := f.Src
+	code, err := f.Format()
+	if err == nil {
+		f.Src = []byte(code)
+		err = f.Reparse()
+	}
+	if err == nil {
+		err = f.separateDecls(inserted)
+	}
+	if err == nil {
+		err = f.FixImports()
+	}
+	if err != nil {
+		// roll back
+		f.Src = old
+		f.Reparse()
+		return fmt.Errorf("aster: apply: %w", err)
+	}
+	return nil
+}
+
+// separateDecls separates the top-level declarations of the indexes
+// from the previous and the next ones by blank lines.
+func (f *File) separateDecls(indexes []int) error {
+	decls := f.File.Decls
+	tf := f.FileSet.File(f.File.Pos())
+	sep := make(map[int]bool)
+	for _, i := range indexes {
+		sep[i], sep[i+1] = true, true
+	}
+	var edits []textEdit
+	for i := range sep {
+		if i <= 0 || i >= len(decls) {
+			continue
+		}
+		start := decls[i].Pos()
+		if d, ok := decls[i].(*ast.FuncDecl); ok && d.Doc != nil {
+			start = d.Doc.Pos()
+		} else if d, ok := decls[i].(*ast.GenDecl); ok && d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+		if tf.Line(start)-tf.Line(decls[i-1].End()) == 1 {
+			offset := f.offset(start)
+			edits = append(edits, textEdit{start: offset, end: offset, text: "\n"})
+		}
+	}
+	return f.applyEdits(edits)
+}
+
+var errAbortApply = new(int)
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// applier traverses the syntax tree for File.Apply.
+type applier struct {
+	pre, post func(Cursor) bool
+	cur       struct {
+		parent ast.Node
+		name   string
+		field  reflect.Value // the field of the parent, the slice if index >= 0
+		index  int
+		node   ast.Node
+	}
+	iter struct {
+		index, step int
+	}
+	removed []ast.Node
+}
+
+func (a *applier) apply(parent ast.Node, name string, field reflect.Value, index int, n ast.Node) {
+	if v := reflect.ValueOf(n); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	saved := a.cur
+	a.cur.parent, a.cur.name, a.cur.field, a.cur.index, a.cur.node = parent, name, field, index, n
+	if a.pre != nil && !a.pre(Cursor{a}) {
+		a.cur = saved
+		return
+	}
+	a.walk(a.cur.node)
+	if a.post != nil && !a.post(Cursor{a}) {
+		panic(errAbortApply)
+	}
+	a.cur = saved
+}
+
+// walk applies the children of n, in the order of the fields.
+func (a *applier) walk(n ast.Node) {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if _, ok := n.(*ast.File); ok && (name == "Imports" || name == "Comments" || name == "Unresolved") {
+			// duplicates of the nodes walked elsewhere
+			continue
+		}
+		field := v.Field(i)
+		switch t := field.Type(); {
+		case t.Implements(nodeType):
+			a.apply(n, name, field, -1, nodeOf(field))
+		case t.Kind() == reflect.Slice && t.Elem().Implements(nodeType):
+			saved := a.iter
+			a.iter.index = 0
+			for a.iter.index < field.Len() {
+				a.iter.step = 1
+				a.apply(n, name, field, a.iter.index, nodeOf(field.Index(a.iter.index)))
+				a.iter.index += a.iter.step
+			}
+			a.iter = saved
+		}
+	}
+}
+
+func nodeOf(v reflect.Value) ast.Node {
+	if n, ok := v.Interface().(ast.Node); ok {
+		return n
+	}
+	return nil
+}
+
+// remove records the node deleted or replaced.
+func (a *applier) remove(n ast.Node) {
+	if n != nil && n.Pos().IsValid() {
+		a.removed = append(a.removed, n)
+	}
+}
+
+// dropComments drops the comments within the removed nodes, including the doc
+// and line comments, unless they are still part of the syntax tree, e.g.
+// wrapped by a replacement.
+func (a *applier) dropComments(file *ast.File) {
+	if len(a.removed) == 0 {
+		return
+	}
+	live := make(map[ast.Node]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n != nil {
+			live[n] = true
+		}
+		return true
+	})
+	dropped := make(map[*ast.CommentGroup]bool)
+	for _, n := range a.removed {
+		if live[n] {
+			continue
+		}
+		ast.Inspect(n, func(n ast.Node) bool {
+			if g, ok := n.(*ast.CommentGroup); ok && !live[g] {
+				dropped[g] = true
+			}
+			return true
+		})
+		for _, g := range file.Comments {
+			if n.Pos() <= g.Pos() && g.End() <= n.End() && !live[g] {
+				dropped[g] = true
+			}
+		}
+	}
+	comments := file.Comments[:0]
+	for _, g := range file.Comments {
+		if !dropped[g] {
+			comments = append(comments, g)
+		}
+	}
+	file.Comments = comments
+}
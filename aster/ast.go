@@ -19,7 +19,9 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
+	"sync"
 )
 
 // Module packages AST
@@ -28,7 +30,25 @@ type Module struct {
 	Dir      string
 	filter   func(os.FileInfo) bool
 	Packages map[string]*Package // <package name, *Package>
-	mode     parser.Mode
+	// ModFile is the nearest go.mod file of Dir, nil if none, see AddRequire
+	ModFile *ModFile
+	mode    parser.Mode
+	// allErrors is the continue-on-error mode of reparsing, see ParseDirAll
+	allErrors bool
+	overlay   map[string][]byte // <absolute filename, content>, see ParseConfig
+	tests     TestMode
+	// skipGenerated skips the generated files, see ParseConfig.SkipGenerated
+	skipGenerated bool
+	// visibility selects the nodes to collect, see ParseConfig.Visibility
+	visibility Visibility
+	// mu guards the caches filled by the readers, i.e. importer and impls
+	mu       sync.Mutex
+	importer types.Importer // see Importer
+	impls    *implMatrix    // see Implementations, reset on reparse
+	// removed is the packages whose files to delete on Store, see RemovePackage
+	removed []*Package
+	// manifest is the generated files to record on Store, see RecordGenerated
+	manifest *Manifest
 }
 
 // A Package node represents a set of source files
@@ -43,6 +63,7 @@ type Package struct {
 	Imports map[string]*ast.Object // map of package id -> package object
 	Files   map[string]*File       // Go source files by filename
 	mode    parser.Mode
+	removed []string // the files to delete on Store, see RemoveFile
 }
 
 // A File node represents a Go source file.
@@ -125,24 +146,109 @@ type (
 		// Filename returns filename to which the node belongs
 		Filename() string
 
+		// File returns the file to which the node belongs,
+		// or nil for a cloned node not added to a file.
+		File() *File
+
+		// Parent returns the innermost node of the file enclosing the node,
+		// e.g. the function declaring a local type, or the interface type
+		// declaring a method, or nil for a top-level declaration.
+		// NOTE: A method declaration has no parent; see Recv for its receiver.
+		Parent() Node
+
 		// Kind returns the specific kind of this type.
 		Kind() Kind
 
 		// Doc returns lead comment.
 		Doc() string
 
+		// Directives returns the directives in the lead comment,
+		// such as `//go:generate ...`, `//nolint` and `//aster:...` pragmas.
+		Directives() Directives
+
+		// SetDoc replaces the lead comment with the text, wrapped at
+		// DocWidth, keeping the directives.
+		// NOTE: The file is reparsed, so the node is no longer valid.
+		SetDoc(text string) error
+
+		// AppendDoc appends the line, wrapped at DocWidth, to the lead comment.
+		// NOTE: The file is reparsed, so the node is no longer valid.
+		AppendDoc(line string) error
+
+		// TypeParams returns the type parameters of a generic type or function,
+		// or nil if it has none.
+		// NOTE: The methods of a generic type have no type parameters of their own.
+		TypeParams() []*TypeParam
+
 		// String returns the formated code block.
 		String() string
+
+		// References returns the identifiers referring to the node across
+		// all the packages of the module, sorted by position.
+		References() []Ref
+
+		// Clone returns an independent copy of the node, detached from its file.
+		// The copy is reparsed into a new range of the same FileSet,
+		// so it can be modified and added to other files by File.AddNode.
+		// The methods of a type are not copied.
+		Clone() Node
+
+		// MoveTo moves the top-level declaration to the file, along with its
+		// doc comment and the methods of a type, and updates the imports and
+		// the references across the module for a file of another package.
+		MoveTo(target *File) error
+
+		// MoveToPackage moves the top-level declaration to the file of the
+		// same name in the package, see MoveTo.
+		MoveToPackage(target *Package) error
+
+		// Deprecated returns the text of the "Deprecated: " paragraph of the
+		// doc comment, or false if the node is not deprecated.
+		Deprecated() (reason string, ok bool)
+
+		// SetDeprecated adds the "Deprecated: " paragraph of the reason to the
+		// doc comment of the top-level declaration, or replaces the existing one.
+		SetDeprecated(reason string) error
 	}
 
 	// TypeNodeMethods is the representation of a Go type node.
 	// NOTE: Kind != Func
 	TypeNodeMethods interface {
 		// IsAssign is there `=` for declared type?
+		// NOTE: It is true for an alias and for the anonymous struct type
+		// of a variable or a composite literal, see IsAlias.
 		IsAssign() bool
 
-		// NumMethod returns the number of exported methods in the type's method set.
-		NumMethod() int
+		// IsAlias reports whether the type is declared as an alias, `type A = B`.
+		IsAlias() bool
+
+		// AliasOf returns the aliased type of the alias, i.e. the type node
+		// declared in the module, or an anonymous type node of the type literal,
+		// e.g. []int, or false if the type is not an alias, or the aliased type
+		// is not declared in the module. Use Unalias to follow the alias chain.
+		AliasOf() (TypeNode, bool)
+
+		// Underlying returns the kind of the underlying type, following the
+		// chain of the named types declared in the module, and else the export
+		// data of the imported package, e.g. Int64 for `type D time.Duration`,
+		// or Suspense if it can not be resolved.
+		Underlying() Kind
+
+		// ResolveNamed returns the type at the end of the chain of the named
+		// types declared in the module, i.e. the type declared by a basic type
+		// or a type literal, or false if the chain leaves the module.
+		ResolveNamed() (TypeNode, bool)
+
+		// Interfaces returns the interfaces declared in the module which the
+		// type implements, sorted by package and type name, i.e. the inverse
+		// of Module.Implementations.
+		Interfaces() []TypeNode
+
+		// NumMethod returns the number of methods in the type's method set,
+		// including the unexported ones, see Methods.
+		// If promoted is true, the method set includes the methods promoted
+		// from the embedded types, otherwise only the declared methods.
+		NumMethod(promoted ...bool) int
 
 		// Method returns the i'th method in the type's method set.
 		// For a non-interface type T or *T, the returned Method's Type and Func
@@ -150,7 +256,10 @@ type (
 		//
 		// For an interface type, the returned Method's Type field gives the
 		// method signature, without a receiver, and the Func field is nil.
-		Method(int) (FuncNode, bool)
+		//
+		// If promoted is true, the method set includes the methods promoted
+		// from the embedded types, which are ordered after the declared methods.
+		Method(i int, promoted ...bool) (FuncNode, bool)
 
 		// MethodByName returns the method with that name in the type's
 		// method set and a boolean indicating if the method was found.
@@ -160,11 +269,34 @@ type (
 		//
 		// For an interface type, the returned Method's Type field gives the
 		// method signature, without a receiver, and the Func field is nil.
-		MethodByName(string) (FuncNode, bool)
+		//
+		// If promoted is true, the method set includes the methods promoted
+		// from the embedded types.
+		MethodByName(name string, promoted ...bool) (FuncNode, bool)
+
+		// Methods returns the methods in the type's method set, in the order
+		// of Method, leaving out the unexported ones unless includeUnexported
+		// is true. If promoted is true, the method set includes the methods
+		// promoted from the embedded types.
+		Methods(includeUnexported bool, promoted ...bool) []FuncNode
 
 		// Implements reports whether the type implements the interface type u.
 		Implements(u TypeNode) bool
 
+		// ExtractInterface synthesizes an interface declaration named name
+		// from the type's method set, and inserts it after the type declaration.
+		// Only the methods for which methodFilter returns true are included;
+		// if methodFilter is nil, the exported methods are included.
+		// Returns nil if the interface can not be inserted.
+		//
+		// Use File.ExtractInterface to insert it into another file.
+		ExtractInterface(name string, methodFilter func(FuncNode) bool) TypeNode
+
+		// ConvertReceivers converts the receivers of all the methods of the type
+		// to pointer or value receivers, and rewrites the method expressions
+		// referring to them in the package.
+		ConvertReceivers(pointer bool) error
+
 		// addMethod adds a FuncNode as method.
 		//
 		// Returns error if the FuncNode is already exist or receiver is not the TypeNode.
@@ -183,8 +315,97 @@ type (
 
 		// FieldByName returns the struct field with the given name
 		// and a boolean indicating if the field was found.
+		// If promoted is true, the fields promoted through the embedded
+		// structs are looked up too.
+		// It panics if the type's Kind is not Struct.
+		FieldByName(name string, promoted ...bool) (field *StructField, found bool)
+
+		// FlattenFields returns the effective field set of the struct type:
+		// its fields followed by the fields promoted through each embedded struct
+		// in turn, with the shadowed and ambiguous names left out.
+		// It panics if the type's Kind is not Struct.
+		FlattenFields() []*StructField
+
+		// InlineEmbedded replaces the embedded struct field of the name with
+		// the fields of the embedded struct, and rewrites the use sites in the module.
+		// It panics if the type's Kind is not Struct.
+		InlineEmbedded(name string) error
+
+		// ExtractEmbedded moves the fields of the names into the new struct type
+		// of the name, which replaces them as an embedded field, and rewrites
+		// the composite literals in the module.
+		// It panics if the type's Kind is not Struct.
+		ExtractEmbedded(name string, fields ...string) error
+
+		// GenerateDefaults generates the SetDefaults method of the struct type,
+		// which sets the zero fields to their declared default values.
+		// It panics if the type's Kind is not Struct.
+		GenerateDefaults() error
+
+		// GenerateValidate generates the Validate method of the struct type,
+		// which checks the fields against the rules of their validate tags.
+		// It panics if the type's Kind is not Struct.
+		GenerateValidate() error
+
+		// GenerateBuilder generates the builder of the struct type, with the
+		// chainable setters of the fields and the Build method checking the
+		// required ones.
 		// It panics if the type's Kind is not Struct.
-		FieldByName(name string) (field *StructField, found bool)
+		GenerateBuilder() error
+
+		// GenerateOptions generates the functional options of the struct type,
+		// and the constructor applying them to the default values.
+		// It panics if the type's Kind is not Struct.
+		GenerateOptions(cfg *OptionsConfig) error
+
+		// GenerateConstructor generates the constructor of the struct type,
+		// taking the exported fields as parameters and checking the required
+		// ones are not nil.
+		// It panics if the type's Kind is not Struct.
+		GenerateConstructor() error
+
+		// GenerateEqualHash generates the Equal and Hash methods of the
+		// struct type from its fields.
+		// It panics if the type's Kind is not Struct.
+		GenerateEqualHash() error
+
+		// GenerateString generates the String method of the struct type,
+		// printing the exported fields and redacting the sensitive ones.
+		// It panics if the type's Kind is not Struct.
+		GenerateString() error
+
+		// GenerateIsZero generates the IsZero method of the struct type and
+		// the function returning its zero value.
+		// It panics if the type's Kind is not Struct.
+		GenerateIsZero() error
+
+		// GenerateTimeCodec generates the (un)marshaling methods of the struct type,
+		// which encode its time.Time and time.Duration fields in their configured formats.
+		// It panics if the type's Kind is not Struct.
+		GenerateTimeCodec(cfg *TimeCodecConfig) error
+
+		// GenerateNullable maps the pointer fields of the struct type to the
+		// database/sql nullable types, and generates the JSON methods keeping
+		// their null behavior.
+		// It panics if the type's Kind is not Struct.
+		GenerateNullable() error
+
+		// FieldAlignment returns the padding report of the struct type on the
+		// GOARCH, or the default one if empty, with the optimal field order.
+		// It panics if the type's Kind is not Struct.
+		FieldAlignment(goarch string) (*FieldAlignment, error)
+
+		// Layout returns the memory layout of the struct type on the GOARCH,
+		// or the default one if empty: the offset, size and alignment of each
+		// field, and the padding.
+		// It panics if the type's Kind is not Struct.
+		Layout(goarch string) (*Layout, error)
+
+		// OptimizeFieldOrder reorders the fields of the struct type to minimize
+		// the padding on the GOARCH, or the default one if empty, keeping their
+		// comments and tags, and returns the padding report.
+		// It panics if the type's Kind is not Struct.
+		OptimizeFieldOrder(goarch string) (*FieldAlignment, error)
 	}
 
 	// FuncNodeMethods is the representation of a Go function or method.
@@ -217,6 +438,50 @@ type (
 
 		// Recv returns receiver (methods); or returns false (functions)
 		Recv() (*FuncField, bool)
+
+		// Metrics returns the cyclomatic complexity, statement count,
+		// nesting depth and line count of the function.
+		Metrics() *FuncMetrics
+
+		// Body returns the body of the function, or nil for an interface
+		// method or a function declared without body.
+		Body() *ast.BlockStmt
+
+		// SetBody replaces the statements of the function body with src.
+		// NOTE: The file is reparsed after editing, and the node is rebound to it.
+		SetBody(src string) error
+
+		// InsertStmtAt inserts the statements of src before the i'th statement
+		// of the function body, or at its end if i is the number of statements.
+		// NOTE: The file is reparsed after editing, and the node is rebound to it.
+		InsertStmtAt(i int, src string) error
+
+		// AppendStmt appends the statements of src to the function body.
+		// NOTE: The file is reparsed after editing, and the node is rebound to it.
+		AppendStmt(src string) error
+
+		// Stmts returns the statements of the function body, including the
+		// nested ones but not those of the function literals, in source order.
+		Stmts() []ast.Stmt
+
+		// WalkStmts dispatches the statements and expressions of the function
+		// body to the visitor, in source order, see StmtVisitor.
+		WalkStmts(v *StmtVisitor)
+
+		// ExtractFunction moves the statements [start,end) of the function
+		// body to a new function of the name, computing its parameters and
+		// results from the variables, and replaces them with a call of it.
+		ExtractFunction(start, end int, name string) error
+
+		// Inline replaces the calls of the function across the module with
+		// its body, and returns the number of the calls replaced.
+		// The declaration is removed if remove is true and no references remain.
+		Inline(remove ...bool) (int, error)
+
+		// ChangeSignature adds, removes and reorders the parameters and the
+		// results of the function, and rewrites the calls across the module
+		// and the return statements of the body to match.
+		ChangeSignature(params, results []SigParam) error
 	}
 )
 
@@ -226,6 +491,13 @@ type FuncField struct {
 	TypeName string // not contain `*`
 }
 
+// TypeParam is a type parameter of a generic type or function.
+type TypeParam struct {
+	Name           string
+	Constraint     string   // the formatted constraint, e.g. "~int | ~string"
+	ConstraintExpr ast.Expr // the constraint expression
+}
+
 //go:generate Stringer -type Kind
 
 // A Kind represents the specific kind of type that a Type represents.
@@ -323,6 +595,7 @@ type super struct {
 	pkgNamePtr  *string
 	filenamePtr *string
 	doc         *ast.CommentGroup
+	typeParams  *ast.FieldList
 }
 
 func (f *File) newSuper(namePtr *string, kind Kind, doc *ast.CommentGroup) *super {
@@ -430,6 +703,88 @@ func (s *super) Recv() (*FuncField, bool) {
 	panic("aster: (TODO) Coming soon!")
 }
 
+// Metrics returns the cyclomatic complexity, statement count,
+// nesting depth and line count of the function.
+func (s *super) Metrics() *FuncMetrics {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Body returns the body of the function.
+func (s *super) Body() *ast.BlockStmt {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// SetBody replaces the statements of the function body.
+func (s *super) SetBody(string) error {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// InsertStmtAt inserts the statements before the i'th statement of the function body.
+func (s *super) InsertStmtAt(int, string) error {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// AppendStmt appends the statements to the function body.
+func (s *super) AppendStmt(string) error {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Stmts returns the statements of the function body.
+func (s *super) Stmts() []ast.Stmt {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// WalkStmts dispatches the statements and expressions of the function body
+// to the visitor.
+func (s *super) WalkStmts(*StmtVisitor) {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// ExtractFunction moves the statements of the function body to a new function.
+func (s *super) ExtractFunction(int, int, string) error {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Inline replaces the calls of the function with its body.
+func (s *super) Inline(...bool) (int, error) {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// ChangeSignature changes the parameters and the results of the function.
+func (s *super) ChangeSignature([]SigParam, []SigParam) error {
+	if s.kind != Func {
+		panic("aster: Kind must be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
 // IsFuncNode returns true if b is implementd FuncNode.
 func IsFuncNode(b Node) bool {
 	_, ok := b.(FuncNode)
@@ -452,8 +807,49 @@ func (s *super) IsAssign() bool {
 	panic("aster: (TODO) Coming soon!")
 }
 
-// NumMethod returns the number of exported methods in the type's method set.
-func (s *super) NumMethod() int {
+// IsAlias reports whether the type is declared as an alias.
+func (s *super) IsAlias() bool {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// AliasOf returns the aliased type of the alias.
+func (s *super) AliasOf() (TypeNode, bool) {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Underlying returns the kind of the underlying type.
+func (s *super) Underlying() Kind {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// ResolveNamed returns the type at the end of the chain of the named types.
+func (s *super) ResolveNamed() (TypeNode, bool) {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Interfaces returns the interfaces declared in the module which the type implements.
+func (s *super) Interfaces() []TypeNode {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// NumMethod returns the number of methods in the type's method set,
+// including the unexported ones.
+func (s *super) NumMethod(...bool) int {
 	if s.kind == Func {
 		panic("aster: Kind cant not be aster.Func!")
 	}
@@ -466,7 +862,7 @@ func (s *super) NumMethod() int {
 //
 // For an interface type, the returned Method's Type field gives the
 // method signature, without a receiver, and the Func field is nil.
-func (s *super) Method(int) (FuncNode, bool) {
+func (s *super) Method(int, ...bool) (FuncNode, bool) {
 	if s.kind == Func {
 		panic("aster: Kind cant not be aster.Func!")
 	}
@@ -481,7 +877,16 @@ func (s *super) Method(int) (FuncNode, bool) {
 //
 // For an interface type, the returned Method's Type field gives the
 // method signature, without a receiver, and the Func field is nil.
-func (s *super) MethodByName(string) (FuncNode, bool) {
+func (s *super) MethodByName(string, ...bool) (FuncNode, bool) {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Methods returns the methods in the type's method set,
+// leaving out the unexported ones unless includeUnexported is true.
+func (s *super) Methods(bool, ...bool) []FuncNode {
 	if s.kind == Func {
 		panic("aster: Kind cant not be aster.Func!")
 	}
@@ -496,6 +901,24 @@ func (s *super) Implements(u TypeNode) bool {
 	panic("aster: (TODO) Coming soon!")
 }
 
+// ExtractInterface synthesizes an interface declaration named name
+// from the type's method set, and inserts it after the type declaration.
+func (s *super) ExtractInterface(string, func(FuncNode) bool) TypeNode {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// ConvertReceivers converts the receivers of all the methods of the type
+// to pointer or value receivers.
+func (s *super) ConvertReceivers(bool) error {
+	if s.kind == Func {
+		panic("aster: Kind cant not be aster.Func!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
 // addMethod adds a FuncNode as method.
 //
 // Returns error if the FuncNode is already exist or receiver is not the TypeNode.
@@ -526,7 +949,137 @@ func (s *super) Field(int) *StructField {
 
 // FieldByName returns the struct field with the given name
 // and a boolean indicating if the field was found.
-func (s *super) FieldByName(name string) (field *StructField, found bool) {
+func (s *super) FieldByName(name string, promoted ...bool) (field *StructField, found bool) {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// FlattenFields returns the effective field set of the struct type.
+func (s *super) FlattenFields() []*StructField {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// InlineEmbedded replaces the embedded struct field of the name with
+// the fields of the embedded struct.
+func (s *super) InlineEmbedded(string) error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// ExtractEmbedded moves the fields of the names into the new embedded struct.
+func (s *super) ExtractEmbedded(string, ...string) error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateDefaults generates the SetDefaults method of the struct type.
+func (s *super) GenerateDefaults() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateValidate generates the Validate method of the struct type.
+func (s *super) GenerateValidate() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateBuilder generates the builder of the struct type.
+func (s *super) GenerateBuilder() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateOptions generates the functional options of the struct type.
+func (s *super) GenerateOptions(*OptionsConfig) error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateConstructor generates the constructor of the struct type.
+func (s *super) GenerateConstructor() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateEqualHash generates the Equal and Hash methods of the struct type.
+func (s *super) GenerateEqualHash() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateString generates the String method of the struct type.
+func (s *super) GenerateString() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateIsZero generates the IsZero method of the struct type.
+func (s *super) GenerateIsZero() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateTimeCodec generates the (un)marshaling methods of the struct type.
+func (s *super) GenerateTimeCodec(*TimeCodecConfig) error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// GenerateNullable maps the pointer fields of the struct type to the
+// database/sql nullable types.
+func (s *super) GenerateNullable() error {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// FieldAlignment returns the padding report of the struct type.
+func (s *super) FieldAlignment(string) (*FieldAlignment, error) {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// Layout returns the memory layout of the struct type.
+func (s *super) Layout(string) (*Layout, error) {
+	if s.kind != Struct {
+		panic("aster: Kind must be aster.Struct!")
+	}
+	panic("aster: (TODO) Coming soon!")
+}
+
+// OptimizeFieldOrder reorders the fields of the struct type to minimize the padding.
+func (s *super) OptimizeFieldOrder(string) (*FieldAlignment, error) {
 	if s.kind != Struct {
 		panic("aster: Kind must be aster.Struct!")
 	}
@@ -1,10 +1,30 @@
 package aster_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
 	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/henrylee2cn/aster/aster"
+	"github.com/henrylee2cn/aster/aster/analyzer"
+	"github.com/henrylee2cn/aster/aster/ddl"
+	"github.com/henrylee2cn/aster/aster/gen"
+	"github.com/henrylee2cn/aster/aster/graphql"
+	"github.com/henrylee2cn/aster/aster/openapi"
+	"github.com/henrylee2cn/aster/aster/proto"
+	"golang.org/x/tools/go/analysis"
 )
 
 func TestStruct(t *testing.T) {
@@ -138,3 +158,6629 @@ func TestFunc(t *testing.T) {
 		return true
 	})
 }
+
+func parseModule(t *testing.T, dir string, files map[string]string) *aster.Module {
+	dir = filepath.Join("../_out", dir)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestConformanceReport(t *testing.T) {
+	m := parseModule(t, "conformance", map[string]string{
+		"a.go": `package test
+type Reader interface {
+	Read(p []byte) (n int, err error)
+}
+type ReadCloser interface {
+	Read(p []byte) (n int, err error)
+	Close() error
+}
+type File struct{}
+func (f *File) Read(b []byte) (int, error) { return 0, nil }
+`,
+		"b.go": `package test
+func (f *File) Close() {}
+type Buffer []byte
+func (b Buffer) Read(p []byte) (int, error) { return 0, nil }
+`,
+	})
+	r := m.Packages["test"].ConformanceReport()
+	if e := r.Lookup("File", "Reader"); e == nil || !e.Implements {
+		t.Fatalf("File should implement Reader: %+v", e)
+	}
+	if e := r.Lookup("Buffer", "Reader"); e == nil || !e.Implements {
+		t.Fatalf("Buffer should implement Reader: %+v", e)
+	}
+	e := r.Lookup("File", "ReadCloser")
+	if e == nil || e.Implements || len(e.Mismatched) != 1 || e.Mismatched[0] != "Close" {
+		t.Fatalf("File should be a near-miss of ReadCloser: %+v", e)
+	}
+	e = r.Lookup("Buffer", "ReadCloser")
+	if e == nil || e.Implements || len(e.Missing) != 1 || e.Missing[0] != "Close" {
+		t.Fatalf("Buffer should be a near-miss of ReadCloser: %+v", e)
+	}
+	t.Log(r.Markdown())
+}
+
+func TestExtractInterface(t *testing.T) {
+	var src = []byte(`package test
+import "io"
+// S comment
+type S struct{}
+// Read reads data.
+func (s *S) Read(p []byte) (int, error) { return 0, io.EOF }
+func (s *S) WriteTo(w io.Writer) (n int64, err error) { return }
+func (s *S) close() {}
+`)
+	f, err := aster.ParseFile("../_out/extract1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := f.LookupType("S")
+	i := s.ExtractInterface("Reader", nil)
+	if i == nil {
+		t.FailNow()
+	}
+	if i.Kind() != aster.Interface || i.NumMethod() != 2 {
+		t.Fatalf("kind: %s, methods: %d", i.Kind(), i.NumMethod())
+	}
+	s, _ = f.LookupType("S")
+	if !s.Implements(i) {
+		t.Fatal("S should implement Reader")
+	}
+	if s.ExtractInterface("Reader", nil) != nil {
+		t.Fatal("duplicate type name should fail")
+	}
+	t.Log(f)
+}
+
+func TestDefaults(t *testing.T) {
+	var src = []byte(`package test
+import "time"
+type Level int8
+type Config struct {
+	Name    string ` + "`default:\"svc\"`" + `
+	Port    int    ` + "`default:\"8080\"`" + `
+	// aster:default 5m
+	//aster:default 1m30s
+	Timeout time.Duration
+	Level   Level    ` + "`default:\"3\"`" + `
+	Debug   *bool    ` + "`default:\"true\"`" + `
+	Hosts   []string ` + "`default:\"a, b\"`" + `
+	Other   int
+}
+type Bad struct {
+	L Level ` + "`default:\"300\"`" + `
+}
+`)
+	f, err := aster.ParseFile("../_out/defaults1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := f.LookupType("Config")
+	timeout, _ := c.FieldByName("Timeout")
+	d, found, err := timeout.Default()
+	if !found || err != nil || d.Expr != "90 * time.Second" {
+		t.Fatalf("found: %v, err: %v, default: %+v", found, err, d)
+	}
+	if err = c.GenerateDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = f.LookupType("Config")
+	if _, ok := c.MethodByName("SetDefaults"); !ok {
+		t.Fatal("SetDefaults not found")
+	}
+	bad, _ := f.LookupType("Bad")
+	if err = bad.GenerateDefaults(); err == nil {
+		t.Fatal("expect overflow error")
+	}
+	t.Log(f)
+}
+
+func TestGenerateValidate(t *testing.T) {
+	m := parseModule(t, "validate", map[string]string{
+		"a.go": `package validate
+
+import "time"
+
+type User struct {
+	Name    string        ` + "`validate:\"required,max=32\"`" + `
+	Email   string        ` + "`validate:\"omitempty,email\"`" + `
+	Age     int           ` + "`validate:\"gte=18,lte=130\"`" + `
+	Role    string        ` + "`validate:\"oneof=admin user\"`" + `
+	Tags    []string      ` + "`validate:\"max=3\"`" + `
+	Home    *string       ` + "`validate:\"url\"`" + `
+	Timeout time.Duration ` + "`validate:\"min=1s\"`" + `
+	Note    string        ` + "`validate:\"-\"`" + `
+}
+
+type Bad struct {
+	N int ` + "`validate:\"len=3\"`" + `
+}
+`,
+	})
+	p := m.Packages["validate"]
+	user, _ := p.LookupType("User")
+	if err := user.GenerateValidate(); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = p.LookupType("User")
+	fn, ok := user.MethodByName("Validate")
+	if !ok {
+		t.Fatal("Validate not found")
+	}
+	want := `// Validate checks the fields against their validate rules.
+func (u *User) Validate() error {
+	if u.Name == "" {
+		return errors.New("Name is required")
+	}
+	if len(u.Name) > 32 {
+		return errors.New("Name length must be at most 32")
+	}
+	if u.Email != "" {
+		if _, err := mail.ParseAddress(u.Email); err != nil {
+			return errors.New("Email must be an email address")
+		}
+	}
+	if u.Age < 18 {
+		return errors.New("Age must be at least 18")
+	}
+	if u.Age > 130 {
+		return errors.New("Age must be at most 130")
+	}
+	if u.Role != "admin" && u.Role != "user" {
+		return errors.New("Role must be one of admin user")
+	}
+	if len(u.Tags) > 3 {
+		return errors.New("Tags length must be at most 3")
+	}
+	if u.Home != nil {
+		if parsed, err := url.Parse(*u.Home); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return errors.New("Home must be an absolute URL")
+		}
+	}
+	if u.Timeout < 1*time.Second {
+		return errors.New("Timeout must be at least 1s")
+	}
+	return nil
+}`
+	if got := fn.String(); got != want {
+		t.Fatalf("validate:\n%s", got)
+	}
+	f := p.Files[filepath.Join("../_out/validate", "a.go")]
+	var imports []string
+	for _, imp := range f.Imports {
+		imports = append(imports, imp.Path)
+	}
+	sort.Strings(imports)
+	if got := strings.Join(imports, " "); got != "errors net/mail net/url time" {
+		t.Fatalf("imports: %s", got)
+	}
+	bad, _ := p.LookupType("Bad")
+	if err := bad.GenerateValidate(); err == nil || !strings.Contains(err.Error(), "field N") {
+		t.Fatalf("want error of len on int: %v", err)
+	}
+}
+
+func TestGenerateBuilder(t *testing.T) {
+	m := parseModule(t, "builder", map[string]string{
+		"a.go": `package builder
+
+import "time"
+
+// Server is a server.
+type Server struct {
+	Addr    string ` + "`builder:\"required\"`" + `
+	// Port is the port.
+	//aster:required
+	Port    int
+	Timeout time.Duration ` + "`default:\"5s\"`" + `
+	Type    string        ` + "`validate:\"required\" builder:\"optional\"`" + `
+	URL     string        ` + "`builder:\"-\"`" + `
+	name    string
+}
+
+func (s *Server) SetDefaults() {}
+`,
+	})
+	p := m.Packages["builder"]
+	server, _ := p.LookupType("Server")
+	if err := server.GenerateBuilder(); err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[filepath.Join("../_out/builder", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// ServerBuilder builds Server by the chainable setters, see NewServerBuilder.
+type ServerBuilder struct {
+	v       Server
+	hasAddr bool
+	hasPort bool
+}
+
+// NewServerBuilder returns the builder of Server.
+func NewServerBuilder() *ServerBuilder {
+	return &ServerBuilder{}
+}
+
+// WithAddr sets Addr.
+func (b *ServerBuilder) WithAddr(addr string) *ServerBuilder {
+	b.v.Addr = addr
+	b.hasAddr = true
+	return b
+}
+
+// WithPort sets Port.
+func (b *ServerBuilder) WithPort(port int) *ServerBuilder {
+	b.v.Port = port
+	b.hasPort = true
+	return b
+}
+
+// WithTimeout sets Timeout.
+func (b *ServerBuilder) WithTimeout(timeout time.Duration) *ServerBuilder {
+	b.v.Timeout = timeout
+	return b
+}
+
+// WithType sets Type.
+func (b *ServerBuilder) WithType(v string) *ServerBuilder {
+	b.v.Type = v
+	return b
+}
+
+// Build returns the built Server, or an error if a required field is not set.
+func (b *ServerBuilder) Build() (*Server, error) {
+	var missing []string
+	if !b.hasAddr {
+		missing = append(missing, "Addr")
+	}
+	if !b.hasPort {
+		missing = append(missing, "Port")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("ServerBuilder: missing required fields: %s", strings.Join(missing, ", "))
+	}
+	v := b.v
+	v.SetDefaults()
+	return &v, nil
+}
+`
+	if !strings.Contains(code, want) {
+		t.Fatalf("builder:\n%s", code)
+	}
+	var imports []string
+	for _, imp := range f.Imports {
+		imports = append(imports, imp.Path)
+	}
+	sort.Strings(imports)
+	if got := strings.Join(imports, " "); got != "fmt strings time" {
+		t.Fatalf("imports: %s", got)
+	}
+	server, _ = p.LookupType("Server")
+	if err = server.GenerateBuilder(); err == nil {
+		t.Fatal("want error of the builder existing")
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	m := parseModule(t, "options", map[string]string{
+		"a.go": `package options
+
+import "time"
+
+type Client struct {
+	addr    string
+	// timeout of the requests
+	//aster:default 30s
+	timeout time.Duration
+	Retries int ` + "`default:\"3\"`" + `
+	debug   bool ` + "`option:\"-\"`" + `
+}
+
+type Other struct{ Addr string }
+`,
+	})
+	p := m.Packages["options"]
+	client, _ := p.LookupType("Client")
+	if err := client.GenerateOptions(nil); err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[filepath.Join("../_out/options", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Option is a functional option of Client, see NewClient.
+type Option func(*Client)
+
+// NewClient returns a Client with the default values, applying the options.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		timeout: 30 * time.Second,
+		Retries: 3,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithAddr returns the option setting addr.
+func WithAddr(addr string) Option {
+	return func(c *Client) {
+		c.addr = addr
+	}
+}
+
+// WithTimeout returns the option setting timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries returns the option setting Retries.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.Retries = retries
+	}
+}
+
+type Other struct{ Addr string }
+`
+	if !strings.HasSuffix(code, want) {
+		t.Fatalf("options:\n%s", code)
+	}
+	other, _ := p.LookupType("Other")
+	if err = other.GenerateOptions(nil); err == nil || !strings.Contains(err.Error(), "Option") {
+		t.Fatalf("want error of the option type taken: %v", err)
+	}
+	if err = other.GenerateOptions(&aster.OptionsConfig{Type: "OtherOption", Prefix: "OtherWith"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Files[f.Filename].LookupSymbol("OtherWithAddr"); !ok {
+		t.Fatal("OtherWithAddr not found")
+	}
+}
+
+func TestGenerateConstructor(t *testing.T) {
+	m := parseModule(t, "constructor", map[string]string{
+		"a.go": `package constructor
+
+import "io"
+
+type Server struct {
+	Addr   string
+	Output io.Writer
+	Hooks  map[string]func() ` + "`ctor:\"optional\"`" + `
+	Type   int
+	name   string ` + "`ctor:\"param\"`" + `
+	debug  bool
+	Cache  *int ` + "`ctor:\"-\"`" + `
+}
+
+type Point struct{ X, Y int }
+
+func (p *Point) Validate() error { return nil }
+
+type Empty struct{ n int }
+`,
+	})
+	p := m.Packages["constructor"]
+	for _, name := range []string{"Server", "Point", "Empty"} {
+		typ, _ := p.LookupType(name)
+		if err := typ.GenerateConstructor(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := p.Files[filepath.Join("../_out/constructor", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"errors"
+	"io"
+)
+
+type Server struct {
+	Addr   string
+	Output io.Writer
+	Hooks  map[string]func() ` + "`ctor:\"optional\"`" + `
+	Type   int
+	name   string ` + "`ctor:\"param\"`" + `
+	debug  bool
+	Cache  *int ` + "`ctor:\"-\"`" + `
+}
+
+// NewServer returns a Server of the fields, or an error if a required one is nil.
+func NewServer(addr string, output io.Writer, hooks map[string]func(), typeArg int, name string) (*Server, error) {
+	if output == nil {
+		return nil, errors.New("NewServer: Output is nil")
+	}
+	s := &Server{
+		Addr:   addr,
+		Output: output,
+		Hooks:  hooks,
+		Type:   typeArg,
+		name:   name,
+	}
+	return s, nil
+}
+
+type Point struct {
+	X int
+	Y int
+}
+
+// NewPoint returns a Point of the fields, or an error if it is invalid.
+func NewPoint(x int, y int) (*Point, error) {
+	p := &Point{
+		X: x,
+		Y: y,
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+`
+	if !strings.Contains(code, want) {
+		t.Fatalf("constructor:\n%s", code)
+	}
+	if !strings.Contains(code, "func NewEmpty() *Empty {\n\te := &Empty{}\n\treturn e\n}") {
+		t.Fatalf("constructor:\n%s", code)
+	}
+	server, _ := p.LookupType("Server")
+	if err = server.GenerateConstructor(); err == nil {
+		t.Fatal("want error of NewServer taken")
+	}
+}
+
+func TestGenerateEqualHash(t *testing.T) {
+	m := parseModule(t, "equal", map[string]string{
+		"a.go": `package equal
+
+import "time"
+
+type Point struct{ X, Y int }
+
+type Key struct {
+	ID       int
+	Name     string
+	Tags     []string
+	Parent   *Key
+	At       Point
+	Err      error
+	OnChange func()
+	Seen     time.Time ` + "`equal:\"-\"`" + `
+	Items    []*Point
+}
+`,
+	})
+	p := m.Packages["equal"]
+	for _, name := range []string{"Point", "Key"} {
+		typ, _ := p.LookupType(name)
+		if err := typ.GenerateEqualHash(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := p.Files[filepath.Join("../_out/equal", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Equal reports whether the fields of k and other are equal.
+func (k Key) Equal(other Key) bool {
+	return k.ID == other.ID &&
+		k.Name == other.Name &&
+		reflect.DeepEqual(k.Tags, other.Tags) &&
+		k.Parent == other.Parent &&
+		k.At.Equal(other.At) &&
+		reflect.DeepEqual(k.Err, other.Err) &&
+		reflect.DeepEqual(k.Items, other.Items)
+}
+
+// Hash returns the hash of the fields, which is the same for the equal values.
+func (k Key) Hash() uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v\x00", k.ID)
+	fmt.Fprintf(h, "%v\x00", k.Name)
+	fmt.Fprintf(h, "%v\x00", k.Tags)
+	fmt.Fprintf(h, "%p\x00", k.Parent)
+	fmt.Fprintf(h, "%d\x00", k.At.Hash())
+	fmt.Fprintf(h, "%v\x00", k.Err)
+	return h.Sum64()
+}
+`
+	if !strings.HasSuffix(code, want) {
+		t.Fatalf("equal:\n%s", code)
+	}
+	for _, s := range []string{"\t\"fmt\"\n\t\"hash/fnv\"\n\t\"reflect\"\n\t\"time\"\n", "return p.X == other.X &&\n\t\tp.Y == other.Y\n"} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("want %q:\n%s", s, code)
+		}
+	}
+	key, _ := p.LookupType("Key")
+	if err = key.GenerateEqualHash(); err == nil {
+		t.Fatal("want error of the existing methods")
+	}
+}
+
+func TestGenerateString(t *testing.T) {
+	m := parseModule(t, "stringer", map[string]string{
+		"a.go": `package stringer
+
+type Name string
+
+type User struct {
+	ID       int
+	Name     Name
+	Email    string ` + "`sensitive:\"false\"`" + `
+	Password string ` + "`sensitive:\"true\"`" + `
+	Roles    []string
+	OnLogin  func()
+	token    string
+}
+
+type Secret struct {
+	Key string ` + "`sensitive:\"\"`" + `
+}
+`,
+	})
+	p := m.Packages["stringer"]
+	for _, name := range []string{"User", "Secret"} {
+		typ, _ := p.LookupType(name)
+		if err := typ.GenerateString(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := p.Files[filepath.Join("../_out/stringer", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`import "fmt"`, `// String returns the exported fields of User, redacting the sensitive ones.
+func (u User) String() string {
+	return fmt.Sprintf("User{ID: %v, Name: %q, Email: %q, Password: [REDACTED], Roles: %v}", u.ID, u.Name, u.Email, u.Roles)
+}`, `// String returns the exported fields of Secret, redacting the sensitive ones.
+func (s Secret) String() string {
+	return "Secret{Key: [REDACTED]}"
+}`} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("want %s:\n%s", want, code)
+		}
+	}
+	user, _ := p.LookupType("User")
+	if err = user.GenerateString(); err == nil {
+		t.Fatal("want error of the existing method")
+	}
+}
+
+func TestGenerateIsZero(t *testing.T) {
+	m := parseModule(t, "iszero", map[string]string{
+		"a.go": `package iszero
+
+import (
+	"os"
+	"time"
+)
+
+type Name string
+
+type Inner struct {
+	N    int
+	Next *Order
+}
+
+type Money struct{ Cents int64 }
+
+func (m Money) IsZero() bool { return m.Cents == 0 }
+
+type Order struct {
+	ID      Name
+	Paid    bool
+	Inner   Inner
+	Price   Money
+	At      time.Time
+	Timeout time.Duration
+	Mode    os.FileMode
+	Items   []string
+	Sum     [2]int
+	_       int
+}
+`,
+	})
+	p := m.Packages["iszero"]
+	order, _ := p.LookupType("Order")
+	if err := order.GenerateIsZero(); err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[filepath.Join("../_out/iszero", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// IsZero reports whether all the fields of o are zero.
+func (o Order) IsZero() bool {
+	return o.ID == "" &&
+		!o.Paid &&
+		o.Inner.N == 0 &&
+		o.Inner.Next == nil &&
+		o.Price.IsZero() &&
+		o.At.IsZero() &&
+		o.Timeout == 0 &&
+		o.Mode == 0 &&
+		o.Items == nil &&
+		reflect.ValueOf(o.Sum).IsZero()
+}
+
+// ZeroOrder returns the zero value of Order.
+func ZeroOrder() Order {
+	return Order{}
+}
+`
+	if !strings.HasSuffix(code, want) || !strings.Contains(code, "\t\"reflect\"\n") {
+		t.Fatalf("iszero:\n%s", code)
+	}
+	if err = order.GenerateIsZero(); err == nil {
+		t.Fatal("want error of the existing method")
+	}
+}
+
+func TestGenericRewrites(t *testing.T) {
+	m := parseModule(t, "generify", map[string]string{
+		"go.mod": "module example.com/generify\n\ngo 1.18\n",
+		"a.go": `package generify
+
+import "fmt"
+
+type ID int
+
+func Describe(v interface{}) string {
+	if v == nil {
+		return "nil"
+	}
+	switch v := v.(type) {
+	case int:
+		return fmt.Sprint(v)
+	case ID, string:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func Ints(xs []interface{}) (n int) {
+	for _, x := range xs {
+		n += x.(int)
+	}
+	return n
+}
+
+func IsStringer(v any) bool {
+	_, ok := v.(fmt.Stringer)
+	return ok
+}
+
+func Sum(xs ...interface{}) (n int) {
+	for _, x := range xs {
+		n += x.(int)
+	}
+	return n
+}
+
+func Print(v interface{}) { fmt.Println(v) }
+
+func Both(a, b interface{}) bool { return a.(int) == b.(int) }
+
+var parse = Parse
+
+func Parse(v interface{}) int { return v.(int) }
+
+var x interface{} = 1
+
+func use() int {
+	return Sum(x) + len(Describe(ID(1)))
+}
+`,
+	})
+	p := m.Packages["generify"]
+	f := p.Files[filepath.Join("../_out/generify", "a.go")]
+	rewrites, err := m.GenericRewrites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range rewrites {
+		got = append(got, fmt.Sprintf("%s[%s %s](%s)", r.Func, r.TypeParam, r.Constraint, r.Param))
+	}
+	if want := []string{"Describe[T int | ID | string](v)", "Ints[T int](xs)", "IsStringer[T any](v)"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	d, err := rewrites[0].Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"-func Describe(v interface{}) string {\n-\tif v == nil {\n+func Describe[T int | ID | string](v T) string {\n+\tif any(v) == nil {\n",
+		"-\tswitch v := v.(type) {\n+\tswitch v := any(v).(type) {\n",
+	} {
+		if !strings.Contains(d, s) {
+			t.Fatalf("want %q in diff:\n%s", s, d)
+		}
+	}
+	if err = rewrites[0].Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err = rewrites[1].Apply(); err == nil {
+		t.Fatal("want error of the changed file")
+	}
+	n, err := f.ApplyGenericRewrites()
+	if err != nil || n != 2 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"func Ints[T int](xs []T) (n int) {", "n += any(x).(int)", "func IsStringer[T any](v T) bool {"} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("want %q:\n%s", s, code)
+		}
+	}
+	m.ModFile.Go = "1.17"
+	if _, err = m.GenericRewrites(); err == nil {
+		t.Fatal("want error of go 1.17")
+	}
+}
+
+type deprecatedFact struct{}
+
+func (*deprecatedFact) AFact()         {}
+func (*deprecatedFact) String() string { return "deprecated" }
+
+func TestAnalyzer(t *testing.T) {
+	m := parseModule(t, "analyzer", map[string]string{
+		"a.go": `package analyzer
+
+// Deprecated: use New.
+func Old() int { return 1 }
+
+func New() int { return Old() + 2 }
+
+func undocumented() {}
+`,
+	})
+	funcs := &analysis.Analyzer{
+		Name: "funcs",
+		Doc:  "counts the functions",
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			var n int
+			for _, f := range pass.Files {
+				for _, decl := range f.Decls {
+					if _, ok := decl.(*ast.FuncDecl); ok {
+						n++
+					}
+				}
+			}
+			pass.Reportf(pass.Files[0].Package, "not reported")
+			return n, nil
+		},
+	}
+	deprecated := &analysis.Analyzer{
+		Name:      "deprecated",
+		Doc:       "reports the calls of the deprecated functions",
+		Requires:  []*analysis.Analyzer{funcs},
+		FactTypes: []analysis.Fact{new(deprecatedFact)},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, f := range pass.Files {
+				for _, decl := range f.Decls {
+					if fd, ok := decl.(*ast.FuncDecl); ok && fd.Doc != nil && strings.HasPrefix(fd.Doc.Text(), "Deprecated:") {
+						pass.ExportObjectFact(pass.TypesInfo.Defs[fd.Name], new(deprecatedFact))
+					}
+				}
+			}
+			for _, f := range pass.Files {
+				ast.Inspect(f, func(n ast.Node) bool {
+					if call, ok := n.(*ast.CallExpr); ok {
+						id, ok := call.Fun.(*ast.Ident)
+						if ok && pass.ImportObjectFact(pass.TypesInfo.Uses[id], new(deprecatedFact)) {
+							pass.Reportf(call.Pos(), "call of deprecated %s of %d functions", id.Name, pass.ResultOf[funcs].(int))
+						}
+					}
+					return true
+				})
+			}
+			return nil, nil
+		},
+	}
+	undocumented := analyzer.New("undocumented", "reports the undocumented functions",
+		func(pass *analysis.Pass, p *aster.Package) error {
+			for _, fn := range p.Funcs() {
+				if fn.Doc() == "" {
+					pass.Reportf(fn.Node().Pos(), "%s is undocumented", fn.Name())
+				}
+			}
+			return nil
+		})
+	diags, err := analyzer.Run(m, deprecated, undocumented)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, fmt.Sprintf("%d: %s (%s)", d.Position.Line, d.Message, d.Analyzer))
+	}
+	want := []string{
+		"6: New is undocumented (undocumented)",
+		"6: call of deprecated Old of 3 functions (deprecated)",
+		"8: undocumented is undocumented (undocumented)",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if _, err = analyzer.Run(m, &analysis.Analyzer{Name: "invalid"}); err == nil {
+		t.Fatal("want error of the invalid analyzer")
+	}
+
+	// the passes are given the type errors and the other files
+	m = parseModule(t, "analyzer_errors", map[string]string{
+		"a.go":       "package errs\n\nvar x int = \"x\"\n",
+		"a_amd64.s":  "",
+		"ignored.go": "//go:build ignore\n\npackage errs\n",
+	})
+	var files []string
+	var typeErrors int
+	despite := &analysis.Analyzer{
+		Name:             "despite",
+		Doc:              "runs despite the type errors",
+		RunDespiteErrors: true,
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for _, name := range append(pass.OtherFiles, pass.IgnoredFiles...) {
+				files = append(files, filepath.Base(name))
+			}
+			typeErrors = reflect.ValueOf(pass).Elem().FieldByName("typeErrors").Len()
+			return nil, nil
+		},
+	}
+	if _, err = analyzer.Run(m, despite); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(files) != "[a_amd64.s ignored.go]" || typeErrors != 1 {
+		t.Fatalf("files: %v, type errors: %d", files, typeErrors)
+	}
+}
+
+func TestSetDoc(t *testing.T) {
+	m := parseModule(t, "setdoc", map[string]string{
+		"a.go": `package setdoc
+
+// Old is old.
+//go:generate echo
+func Old() {}
+
+func Bare() {}
+
+type (
+	// A is a.
+	A int
+	B string
+)
+
+type S struct{}
+
+// M is m.
+func (S) M() {}
+`,
+	})
+	p := m.Packages["setdoc"]
+	lookup := func(name string) aster.CommNodeMethods {
+		for _, fn := range p.Funcs() {
+			if fn.Name() == name {
+				if _, ok := fn.Recv(); !ok {
+					return fn
+				}
+			}
+		}
+		if typ, ok := p.LookupType(name); ok {
+			return typ
+		}
+		t.Fatalf("%s not found", name)
+		return nil
+	}
+	if err := lookup("Old").SetDoc("Old is deprecated, use New."); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookup("Bare").SetDoc("Bare is a function with a long doc comment, which is wrapped at the column of eighty.\n\n\tBare()"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookup("A").AppendDoc("Second line."); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookup("B").AppendDoc("B is b."); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := p.LookupType("S")
+	method, _ := s.MethodByName("M")
+	if err := method.AppendDoc("Generated by aster."); err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[filepath.Join("../_out/setdoc", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package setdoc
+
+// Old is deprecated, use New.
+//
+//go:generate echo
+func Old() {}
+
+// Bare is a function with a long doc comment, which is wrapped at the column of
+// eighty.
+//
+//	Bare()
+func Bare() {}
+
+type (
+	// A is a.
+	// Second line.
+	A int
+	// B is b.
+	B string
+)
+
+type S struct{}
+
+// M is m.
+// Generated by aster.
+func (S) M() {}
+`
+	if code != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", code, want)
+	}
+	if doc := lookup("Bare").Doc(); !strings.HasPrefix(doc, "Bare is a function") {
+		t.Fatalf("doc of Bare: %q", doc)
+	}
+	if err = lookup("Old").AppendDoc("See New."); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ = f.Format(); !strings.Contains(code, "// Old is deprecated, use New.\n// See New.\n//\n//go:generate echo\n") {
+		t.Fatalf("want the line before the directive:\n%s", code)
+	}
+	if err = lookup("Old").SetDoc(""); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ = f.Format(); !strings.Contains(code, "\n\n//go:generate echo\nfunc Old() {}\n") {
+		t.Fatalf("want the directive only:\n%s", code)
+	}
+}
+
+func TestStructFieldDoc(t *testing.T) {
+	m := parseModule(t, "fielddoc", map[string]string{
+		"a.go": `package fielddoc
+
+type User struct {
+	// ID is the id.
+	ID   int64
+	Name string // the full name
+	Age  int    // obsolete
+	Tags []string
+}
+`,
+	})
+	p := m.Packages["fielddoc"]
+	field := func(name string) *aster.StructField {
+		typ, _ := p.LookupType("User")
+		f, found := typ.(*aster.StructType).FieldByName(name)
+		if !found {
+			t.Fatalf("field %s not found", name)
+		}
+		return f
+	}
+	if doc, comment := field("ID").Doc(), field("Name").Comment(); doc != "ID is the id.\n" || comment != "the full name\n" {
+		t.Fatalf("got %q, %q", doc, comment)
+	}
+	if err := field("ID").SetDoc("ID is the unique id\nof the user."); err != nil {
+		t.Fatal(err)
+	}
+	if err := field("Tags").SetComment("the labels,\nsorted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := field("Age").SetComment(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := field("Name").SetComment("the display name"); err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[filepath.Join("../_out/fielddoc", "a.go")]
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `type User struct {
+	// ID is the unique id
+	// of the user.
+	ID   int64
+	Name string // the display name
+	Age  int
+	Tags []string // the labels, sorted
+}
+`
+	if !strings.HasSuffix(code, want) {
+		t.Fatalf("got:\n%s", code)
+	}
+	b, err := proto.Generate(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); !strings.Contains(s, "  // ID is the unique id\n  // of the user.\n  int64 id = 1;\n  string name = 2; // the display name\n") {
+		t.Fatalf("proto:\n%s", s)
+	}
+	b, err = graphql.Generate(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); !strings.Contains(s, "the labels, sorted") {
+		t.Fatalf("graphql:\n%s", s)
+	}
+}
+
+func TestRunGenerators(t *testing.T) {
+	aster.RegisterGenerator(aster.NewGenerator("names", "", func(n aster.Node, d *aster.Directive) ([]*aster.GeneratedSource, error) {
+		prefix := ""
+		if len(d.Args) > 1 {
+			prefix = d.Args[1]
+		}
+		src := fmt.Sprintf("import \"strings\"\n\n// %sName returns the upper name.\nfunc %sName() string { return strings.ToUpper(%q) }\n", n.Name(), n.Name(), prefix+n.Name())
+		return []*aster.GeneratedSource{{Src: []byte(src)}}, nil
+	}))
+	aster.RegisterGenerator(aster.NewGenerator("columns", "db", func(n aster.Node, d *aster.Directive) ([]*aster.GeneratedSource, error) {
+		var cols []string
+		for i := 0; i < n.NumField(); i++ {
+			if tag, err := n.Field(i).Tags.Get("db"); err == nil {
+				cols = append(cols, fmt.Sprintf("%q", tag.Name))
+			}
+		}
+		src := fmt.Sprintf("var %sColumns = []string{%s}\n", n.Name(), strings.Join(cols, ", "))
+		return []*aster.GeneratedSource{{Filename: "columns.go", Src: []byte(src)}}, nil
+	}))
+	defer aster.UnregisterGenerator("names")
+	defer aster.UnregisterGenerator("columns")
+	if names := aster.Generators(); fmt.Sprint(names) != "[columns names]" {
+		t.Fatalf("generators: %v", names)
+	}
+
+	m := parseModule(t, "rungen", map[string]string{
+		"a.go": `package rungen
+
+//aster:generate names my
+type User struct {
+	ID   int64  ` + "`db:\"id\"`" + `
+	Name string ` + "`db:\"name\"`" + `
+}
+
+// Order is tagged but not directed.
+type Order struct {
+	No string ` + "`db:\"no\"`" + `
+}
+
+//aster:generate names
+func Ping() {}
+`,
+	})
+	files, err := m.RunGenerators()
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	b, err := ioutil.ReadFile("../_out/rungen/rungen_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by aster. DO NOT EDIT.
+
+package rungen
+
+import "strings"
+
+// UserName returns the upper name.
+func UserName() string { return strings.ToUpper("myUser") }
+
+// PingName returns the upper name.
+func PingName() string { return strings.ToUpper("Ping") }
+`
+	if string(b) != want {
+		t.Fatalf("got:\n%s", b)
+	}
+	b, err = ioutil.ReadFile("../_out/rungen/columns.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"// Code generated by aster. DO NOT EDIT.\n",
+		`var UserColumns = []string{"id", "name"}`,
+		`var OrderColumns = []string{"no"}`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("missing %q in:\n%s", s, b)
+		}
+	}
+	// the generated files are recorded in the manifest
+	manifest, err := aster.LoadManifest("../_out/rungen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{
+		"columns.go":    "columns [github.com/henrylee2cn/aster/_out/rungen.Order github.com/henrylee2cn/aster/_out/rungen.User]",
+		"rungen_gen.go": "names [github.com/henrylee2cn/aster/_out/rungen.Ping github.com/henrylee2cn/aster/_out/rungen.User]",
+	} {
+		p, ok := manifest.Lookup(filepath.Join("../_out/rungen", file))
+		if !ok || fmt.Sprint(p.Generator, " ", p.Sources) != want {
+			t.Fatalf("%s: %v", file, p)
+		}
+	}
+
+	// regenerating replaces the declarations, ignoring the generated files
+	m, err = aster.ParseDir("../_out/rungen", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, err = m.RunGenerators(); err != nil || len(files) != 2 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	if b, _ = ioutil.ReadFile("../_out/rungen/rungen_gen.go"); string(b) != want {
+		t.Fatalf("regenerated:\n%s", b)
+	}
+
+	m = parseModule(t, "rungen", map[string]string{
+		"a.go": "package rungen\n\n//aster:generate nothing\ntype T struct{}\n",
+	})
+	if _, err = m.RunGenerators(); err == nil || !strings.Contains(err.Error(), "unknown generator: nothing") {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestParent(t *testing.T) {
+	m := parseModule(t, "parent", map[string]string{
+		"a.go": `package parent
+
+type Reader interface {
+	Read(p []byte) (int, error)
+}
+
+type User struct {
+	ID   int
+	Addr struct {
+		City string
+	}
+}
+
+func (u *User) Name() string { return "" }
+
+func Run() {
+	type local struct{ X int }
+	_ = struct{ City string }{}
+}
+`,
+	})
+	p := m.Packages["parent"]
+	f := p.Files[filepath.Join("../_out/parent", "a.go")]
+	user, _ := p.LookupType("User")
+	if user.File() != f || user.Parent() != nil {
+		t.Fatalf("user: %v, %v", user.File(), user.Parent())
+	}
+	addr, _ := user.(*aster.StructType).FieldByName("Addr")
+	if addr.Parent() != user || addr.File() != f {
+		t.Fatalf("addr parent: %v", addr.Parent())
+	}
+	var nested, local aster.Node
+	for _, n := range f.Nodes {
+		switch {
+		case n.Kind() == aster.Struct && n.Name() == "":
+			nested = n
+		case n.Name() == "local":
+			local = n
+		}
+	}
+	if local == nil || local.Parent().Name() != "Run" {
+		t.Fatalf("local: %v", local)
+	}
+	if nested == nil || nested.Parent().Name() != "Run" {
+		t.Fatalf("nested: %v", nested)
+	}
+	city := nested.Field(0)
+	if city.Parent().Node() != nested.Node() || city.Parent().Parent().Name() != "Run" {
+		t.Fatalf("city: %v", city.Parent())
+	}
+	reader, _ := p.LookupType("Reader")
+	read, _ := reader.Method(0)
+	if read.Parent().Node() != reader.Node() {
+		t.Fatalf("read parent: %v", read.Parent())
+	}
+	name, _ := user.Method(0)
+	if name.Parent() != nil {
+		t.Fatalf("method parent: %v", name.Parent())
+	}
+
+	path, exact := f.PathEnclosing(addr.Field.Names[0].Pos(), addr.Field.Type.End())
+	var kinds []string
+	for _, n := range path {
+		kinds = append(kinds, fmt.Sprintf("%T", n))
+	}
+	want := "*ast.Field *ast.FieldList *ast.StructType *ast.TypeSpec *ast.GenDecl *ast.File"
+	if !exact || strings.Join(kinds, " ") != want {
+		t.Fatalf("path: %s, %v", strings.Join(kinds, " "), exact)
+	}
+}
+
+func TestFindUsages(t *testing.T) {
+	m := parseModule(t, "usages", map[string]string{
+		"a.go": `package usages
+
+import (
+	"net/http"
+	web "net/http"
+)
+
+var client = http.DefaultClient
+
+func Fetch(url string) error {
+	_, err := http.Get(url)
+	return err
+}
+
+func Shadowed() {
+	http := struct{ Get func() }{}
+	http.Get()
+	_ = web.Get
+}
+`,
+		"b.go": `package usages
+
+import . "net/http"
+
+type Handler struct{}
+
+func (Handler) Run() {
+	Get("/")
+	var Head = 1
+	_ = Head
+}
+`,
+		"c.go": `package usages
+
+import "other/http"
+
+func Other() { http.Get() }
+`,
+	})
+	refs := m.FindUsages("net/http", "Get")
+	var got []string
+	for _, r := range refs {
+		fn := "-"
+		if r.Func != nil {
+			fn = r.Func.Name()
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%d %s", filepath.Base(r.Pos.Filename), r.Pos.Line, r.Pos.Column, fn))
+	}
+	want := "a.go:11:17 Fetch, a.go:18:10 Shadowed, b.go:8:2 Run"
+	if s := strings.Join(got, ", "); s != want {
+		t.Fatalf("got %s", s)
+	}
+	if refs := m.FindUsages("net/http", "DefaultClient"); len(refs) != 1 || refs[0].Func != nil || refs[0].Enclosing != nil {
+		t.Fatalf("DefaultClient: %v", refs)
+	}
+	if refs := m.FindUsages("net/http", "Head"); len(refs) != 0 {
+		t.Fatalf("Head: %v", refs)
+	}
+}
+
+func TestRewriteImportPath(t *testing.T) {
+	m := parseModule(t, "rewriteimport", map[string]string{
+		"a.go": `package rewriteimport
+
+import (
+	"fmt"
+
+	"github.com/old/kit"
+	"github.com/old/kit/log"
+	tools "github.com/old/kit/tools/v2"
+)
+
+func A() {
+	fmt.Println(kit.Version, log.New(), tools.X)
+}
+`,
+		"b.go": `package rewriteimport
+
+import (
+	"github.com/old/kit"
+	kite "github.com/old/kitextra"
+	kit2 "github.com/old/kit/v2"
+)
+
+var Kit = kit.New()
+var _ = kite.A
+var _ = kit2.B
+`,
+		"c.go": `package rewriteimport
+
+import "github.com/old/kit"
+
+func C(toolkit int) int { return kit.N + toolkit }
+`,
+	})
+	n, err := m.RewriteImportPath("github.com/old/kit", "github.com/new/toolkit")
+	if err != nil || n != 6 {
+		t.Fatalf("n: %d, err: %v", n, err)
+	}
+	p := m.Packages["rewriteimport"]
+	code := func(name string) string {
+		c, err := p.Files[filepath.Join("../_out/rewriteimport", name)].Format()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	want := map[string]string{
+		"a.go": `package rewriteimport
+
+import (
+	"fmt"
+
+	"github.com/new/toolkit"
+	"github.com/new/toolkit/log"
+	"github.com/new/toolkit/tools/v2"
+)
+
+func A() {
+	fmt.Println(toolkit.Version, log.New(), tools.X)
+}
+`,
+		"b.go": `package rewriteimport
+
+import (
+	"github.com/new/toolkit"
+	kit2 "github.com/new/toolkit/v2"
+	kite "github.com/old/kitextra"
+)
+
+var Kit = toolkit.New()
+var _ = kite.A
+var _ = kit2.B
+`,
+		// the parameter toolkit keeps the old name
+		"c.go": `package rewriteimport
+
+import kit "github.com/new/toolkit"
+
+func C(toolkit int) int { return kit.N + toolkit }
+`,
+	}
+	for name, w := range want {
+		if c := code(name); c != w {
+			t.Fatalf("%s:\n%s", name, c)
+		}
+	}
+
+	f := p.Files[filepath.Join("../_out/rewriteimport", "b.go")]
+	if _, err = f.RewriteImportPath("github.com/old/kitextra", "github.com/new/toolkit"); err == nil {
+		t.Fatal("rewriting to an imported path should fail")
+	}
+}
+
+func TestSkipGenerated(t *testing.T) {
+	m := parseModule(t, "skipgen", map[string]string{
+		"a.go":     "package skipgen\n\ntype A struct{}\n",
+		"a_gen.go": "// Code generated by stringer. DO NOT EDIT.\n\npackage skipgen\n\nfunc (A) String() string { return \"A\" }\n",
+		"b.go":     "package skipgen\n\n// Code generated by hand. DO NOT EDIT.\nfunc B() {}\n",
+		"c.go":     "/*\nCode generated by tool. DO NOT EDIT.\n*/\npackage skipgen\n",
+	})
+	p := m.Packages["skipgen"]
+	for name, want := range map[string]bool{"a.go": false, "a_gen.go": true, "b.go": false, "c.go": false} {
+		if _, ok := p.Files[filepath.Join("../_out/skipgen", name)].IsGenerated(); ok != want {
+			t.Fatalf("%s: generated %v", name, ok)
+		}
+	}
+	m, err := aster.ParseDirWith("../_out/skipgen", &aster.ParseConfig{SkipGenerated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = m.Packages["skipgen"]
+	if _, ok := p.Files[filepath.Join("../_out/skipgen", "a_gen.go")]; ok || len(p.Files) != 3 {
+		t.Fatalf("files: %d", len(p.Files))
+	}
+	a, _ := p.LookupType("A")
+	if _, ok := a.MethodByName("String"); ok {
+		t.Fatal("the generated method is loaded")
+	}
+	// reparsing keeps skipping
+	if err = m.Reparse(); err != nil || len(m.Packages["skipgen"].Files) != 3 {
+		t.Fatalf("reparse: %v", err)
+	}
+	// so do the snapshots and the decoded modules
+	snap, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = snap.Reparse(); err != nil || len(snap.Packages["skipgen"].Files) != 3 {
+		t.Fatalf("snapshot: %v", err)
+	}
+	var buf strings.Builder
+	if err = m.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := aster.DecodeModule(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.Reparse(); err != nil || len(decoded.Packages["skipgen"].Files) != 3 {
+		t.Fatalf("decoded: %v", err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	m := parseModule(t, "visibility", map[string]string{
+		"a.go": `package visibility
+
+type Base struct{}
+
+func (Base) Hello() {}
+func (Base) hello() {}
+
+type User struct {
+	Base
+	name string
+}
+
+func (u *User) Name() string { return u.name }
+func (u *User) setName(name string) { u.name = name }
+
+type Store interface {
+	Get() string
+	put()
+}
+
+type cache struct{}
+
+func (cache) Get() string { return "" }
+
+func New() *User { return &User{} }
+func helper()    {}
+`,
+	})
+	user, _ := m.Packages["visibility"].LookupType("User")
+	names := func(methods []aster.FuncNode) string {
+		var s []string
+		for _, m := range methods {
+			s = append(s, m.Name())
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	if got := names(user.Methods(false)); got != "Name" {
+		t.Fatalf("exported: %s", got)
+	}
+	if got := names(user.Methods(true)); got != "Name,setName" || user.NumMethod() != 2 {
+		t.Fatalf("all: %s", got)
+	}
+	if got := names(user.Methods(true, true)); got != "Hello,Name,hello,setName" {
+		t.Fatalf("promoted: %s", got)
+	}
+
+	m, err := aster.ParseDirWith("../_out/visibility", &aster.ParseConfig{Visibility: aster.VisibilityExported})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := m.Packages["visibility"]
+	var types, funcs []string
+	for _, typ := range p.Types() {
+		types = append(types, typ.Name())
+	}
+	for _, fn := range p.Funcs() {
+		funcs = append(funcs, fn.Name())
+	}
+	if got := strings.Join(types, ","); got != "Base,User,Store" {
+		t.Fatalf("types: %s", got)
+	}
+	if got := strings.Join(funcs, ","); got != "Hello,Name,New" {
+		t.Fatalf("funcs: %s", got)
+	}
+	user, _ = p.LookupType("User")
+	if got := names(user.Methods(true, true)); got != "Hello,Name" || user.NumField() != 2 {
+		t.Fatalf("exported only: %s", got)
+	}
+	// the methods of the interfaces are part of the types
+	store, _ := p.LookupType("Store")
+	if got := names(store.Methods(true)); got != "Get,put" {
+		t.Fatalf("store: %s", got)
+	}
+	// the file is complete
+	code, err := p.Files[filepath.Join("../_out/visibility", "a.go")].Format()
+	if err != nil || !strings.Contains(code, "func helper()") {
+		t.Fatalf("code: %s, %v", code, err)
+	}
+
+	// the snapshots and the decoded modules keep the visibility
+	exported := func(m *aster.Module) string {
+		var s []string
+		m.Inspect(func(n aster.Node) bool {
+			s = append(s, n.Name())
+			return true
+		})
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	want := exported(m)
+	s, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exported(s); got != want {
+		t.Fatalf("snapshot: %s, want %s", got, want)
+	}
+	var b strings.Builder
+	if err := m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	d, err := aster.DecodeModule(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exported(d); got != want {
+		t.Fatalf("decoded: %s, want %s", got, want)
+	}
+}
+
+func TestGenerateMock(t *testing.T) {
+	m := parseModule(t, "mock", map[string]string{
+		"a.go": `package test
+import "io"
+// Store stores things.
+type Store interface {
+	Get(key string) (io.Reader, error)
+	Put(key string, r io.Reader, tags ...string) error
+	Reset()
+}
+`,
+	})
+	p := m.Packages["test"]
+	store, _ := p.LookupType("Store")
+	f, err := aster.GenerateMock(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, ok := p.LookupType("MockStore")
+	if !ok || mock.NumMethod() != 3 {
+		t.Fatal("MockStore not found in package")
+	}
+	store, _ = p.LookupType("Store")
+	if !mock.Implements(store) {
+		t.Fatal("MockStore should implement Store")
+	}
+	t.Log(f)
+	if err = p.Store(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	var src = []byte(`package test
+import "time"
+// S comment
+// second line
+type S struct {
+	// A doc
+	A time.Duration ` + "`json:\"a\"`" + ` // A comment
+}
+`)
+	f, err := aster.ParseFile("../_out/clone1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := f.LookupType("S")
+	c := s.Clone()
+	if c == nil || c.Name() != "S" || c.Doc() != s.Doc() {
+		t.Fatalf("bad clone: %v", c)
+	}
+	if c.Node().Pos() == s.Node().Pos() {
+		t.Fatal("clone positions should be reassigned")
+	}
+	a, _ := c.FieldByName("A")
+	a.Tags.Delete("json")
+	a, _ = s.FieldByName("A")
+	if _, err := a.Tags.Get("json"); err != nil {
+		t.Fatal("the original node should not be changed")
+	}
+
+	g, err := aster.ParseFile("../_out/clone2.go", "package test\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := g.AddNode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Kind() != aster.Struct || len(g.Imports) != 1 {
+		t.Fatalf("kind: %s, imports: %d", added.Kind(), len(g.Imports))
+	}
+	t.Log(g)
+
+	fc, err := f.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc.File == f.File || fc.String() != f.String() {
+		t.Fatal("bad file clone")
+	}
+}
+
+func TestGenerateTimeCodec(t *testing.T) {
+	var src = []byte(`package test
+import "time"
+type Event struct {
+	Name      string        ` + "`json:\"name\" yaml:\"name\"`" + `
+	CreatedAt time.Time     ` + "`json:\"created_at\" yaml:\"created_at\" timefmt:\"unixmilli\"`" + `
+	Day       time.Time     ` + "`json:\"day\" timefmt:\"2006-01-02\"`" + `
+	Timeout   time.Duration ` + "`json:\"timeout,omitempty\"`" + `
+}
+`)
+	f, err := aster.ParseFile("../_out/timecodec1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _ := f.LookupType("Event")
+	err = e.GenerateTimeCodec(&aster.TimeCodecConfig{
+		Codecs: []string{aster.CodecJSON, aster.CodecYAML},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _ = f.LookupType("Event")
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON", "MarshalYAML", "UnmarshalYAML"} {
+		if _, ok := e.MethodByName(name); !ok {
+			t.Fatalf("%s not found", name)
+		}
+	}
+	if len(f.Imports) != 2 {
+		t.Fatalf("imports: %d", len(f.Imports))
+	}
+	t.Log(f)
+}
+
+func TestDirectives(t *testing.T) {
+	var src = []byte(`//go:build linux
+
+package test
+
+//go:generate stringer -type Kind -trimprefix "Kind "
+//aster:enum json text
+// Kind comment
+type Kind int
+
+//nolint:errcheck,unused // legacy
+func F() {}
+`)
+	f, err := aster.ParseFile("../_out/directive1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.Directives()); n != 4 {
+		t.Fatalf("file directives: %d", n)
+	}
+	k, _ := f.LookupType("Kind")
+	if k.Doc() != "Kind comment\n" {
+		t.Fatalf("doc: %q", k.Doc())
+	}
+	gen, ok := k.Directives().Lookup("go:generate")
+	if !ok || len(gen.Args) != 5 || gen.Args[4] != "Kind " {
+		t.Fatalf("go:generate: %+v", gen)
+	}
+	enum, ok := k.Directives().Lookup("aster:enum")
+	if !ok || len(enum.Args) != 2 {
+		t.Fatalf("aster:enum: %+v", enum)
+	}
+	fn := f.Fetch(func(n aster.Node) bool { return n.Name() == "F" })[0]
+	nolint, ok := fn.Directives().Lookup("nolint")
+	if !ok || len(nolint.Args) != 2 || nolint.Args[1] != "unused" {
+		t.Fatalf("nolint: %+v", nolint)
+	}
+}
+
+func TestGenerateNullable(t *testing.T) {
+	var src = []byte(`package test
+import "time"
+type User struct {
+	ID         int64
+	Name, Nick *string    ` + "`json:\"name\" db:\"name\"`" + `
+	Age        *int32     ` + "`json:\"age\"`" + `
+	DeletedAt  *time.Time ` + "`json:\"deleted_at\"`" + `
+	Tags       *[]string  ` + "`json:\"tags\"`" + `
+	Raw        *string    ` + "`null:\"-\"`" + `
+}
+`)
+	f, err := aster.ParseFile("../_out/nullable1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := f.LookupType("User")
+	if err = u.GenerateNullable(); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = f.LookupType("User")
+	for name, typ := range map[string]string{
+		"Name":      "sql.NullString",
+		"Nick":      "sql.NullString",
+		"Age":       "sql.NullInt32",
+		"DeletedAt": "sql.NullTime",
+		"Tags":      "*[]string",
+		"Raw":       "*string",
+	} {
+		field, _ := u.FieldByName(name)
+		if field.TypeName() != typ {
+			t.Fatalf("%s: got %s, want %s", name, field.TypeName(), typ)
+		}
+	}
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON"} {
+		if _, ok := u.MethodByName(name); !ok {
+			t.Fatalf("%s not found", name)
+		}
+	}
+	if err = u.GenerateNullable(); err == nil {
+		t.Fatal("want error of existing methods")
+	}
+	t.Log(f)
+}
+
+func TestTypeParams(t *testing.T) {
+	var src = []byte(`package test
+type Number interface {
+	~int | ~int64 | ~float64
+}
+// List is a generic list.
+type List[T any] struct {
+	items []T
+}
+func (l *List[T]) Push(v T) { l.items = append(l.items, v) }
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+type IntPair = Pair[int, int]
+type Entry struct {
+	List[string]
+	Pair *Pair[string, List[int]]
+}
+func Sum[T Number](a, b T) T { return a + b }
+`)
+	f, err := aster.ParseFile("../_out/typeparams1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _ := f.LookupType("List")
+	params := l.TypeParams()
+	if len(params) != 1 || params[0].Name != "T" || params[0].Constraint != "any" {
+		t.Fatalf("List type params: %v", params)
+	}
+	if !strings.HasPrefix(l.String(), "// List is a generic list.\ntype List[T any] struct") {
+		t.Fatalf("List: %s", l.String())
+	}
+	if _, ok := l.MethodByName("Push"); !ok {
+		t.Fatal("List.Push not bound")
+	}
+	p, _ := f.LookupType("Pair")
+	if !strings.HasPrefix(p.String(), "type Pair[K comparable, V any] struct") {
+		t.Fatalf("Pair: %s", p.String())
+	}
+	if ip, ok := f.LookupType("IntPair"); !ok || !ip.IsAssign() || ip.Kind() != aster.Suspense {
+		t.Fatal("IntPair not collected")
+	}
+	e, _ := f.LookupType("Entry")
+	if field := e.Field(0); field.Name() != "List" || field.TypeName() != "List[string]" || field.Kind() != aster.Struct {
+		t.Fatalf("embedded field: %s %s", field.Name(), field.TypeName())
+	}
+	if field := e.Field(1); field.TypeName() != "*Pair[string, List[int]]" {
+		t.Fatalf("field: %s", field.TypeName())
+	}
+	sum := f.Fetch(func(n aster.Node) bool { return n.Name() == "Sum" })[0]
+	params = sum.TypeParams()
+	if len(params) != 1 || params[0].Constraint != "Number" {
+		t.Fatalf("Sum type params: %v", params)
+	}
+	push, _ := l.MethodByName("Push")
+	if push.TypeParams() != nil {
+		t.Fatal("method has type params")
+	}
+	t.Log(f)
+}
+
+func TestFormatOptions(t *testing.T) {
+	src := []byte(`package test
+type T struct{ A int }
+func F(s []int) {
+	_ = []T{T{A: 1}, T{}}
+	_ = []*T{&T{}}
+	_ = map[T]T{T{}: T{}}
+	_ = s[1:len(s)]
+	for i, _ := range s {
+		_ = i
+	}
+	for _ = range s {
+	}
+}
+`)
+	f, err := aster.ParseFile("../_out/formatopts.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := f.Format(&aster.FormatOptions{Simplify: true, UseSpaces: true, TabWidth: 2, Newline: aster.NewlineNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"_ = []T{{A: 1}, {}}",
+		"_ = []*T{{}}",
+		"_ = map[T]T{{}: {}}",
+		"_ = s[1:]",
+		"  for i := range s {\n    _ = i\n  }",
+		"  for range s {",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %q in:\n%s", s, code)
+		}
+	}
+	if strings.HasSuffix(code, "\n") {
+		t.Fatal("want no trailing newline")
+	}
+
+	var formatted string
+	code, err = f.Format(&aster.FormatOptions{Formatters: []aster.Formatter{
+		func(filename string, src []byte) ([]byte, error) {
+			formatted = filename
+			return append([]byte("// Code generated. DO NOT EDIT.\n\n"), src...), nil
+		},
+	}})
+	if err != nil || formatted != f.Filename || !strings.HasPrefix(code, "// Code generated. DO NOT EDIT.\n\npackage test\n") {
+		t.Fatalf("formatted %s: %s, %v", formatted, code, err)
+	}
+	if strings.Contains(code, "s[1:]") {
+		t.Fatalf("simplified without the option:\n%s", code)
+	}
+	_, err = f.Format(&aster.FormatOptions{Formatters: []aster.Formatter{aster.CommandFormatter("go", "no-such-command")}})
+	if err == nil {
+		t.Fatal("want formatter error")
+	}
+}
+
+func TestFormatMinimal(t *testing.T) {
+	src := `package test
+
+// A   is not gofmt-ed.
+var A    =   1
+
+// S is changed.
+type S struct {
+	// Name is the name.
+	Name string ` + "`json:\"name\"`" + ` // line comment
+	Age  int
+}
+
+func  F( )  {  }
+`
+	f, err := aster.ParseFile("../_out/minimal.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	minimal := &aster.FormatOptions{Minimal: true}
+	if code, err := f.Format(minimal); err != nil || code != src {
+		t.Fatalf("unchanged:\n%s, %v", code, err)
+	}
+	s, _ := f.LookupType("S")
+	field, _ := s.FieldByName("Name")
+	field.Tags.Set(&aster.Tag{Key: "json", Name: "full_name"})
+	code, err := f.Format(minimal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(src, `json:"name"`, `json:"full_name"`, 1)
+	if code != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", code, want)
+	}
+	if code, _ = f.Format(); strings.Contains(code, "var A    =   1") {
+		t.Fatalf("not formatted by default:\n%s", code)
+	}
+}
+
+func TestHeaderAndBanner(t *testing.T) {
+	f, err := aster.ParseFile("../_out/banner.go", []byte("// Package test is a test.\npackage test\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.IsGenerated(); ok {
+		t.Fatal("not generated")
+	}
+	opts := &aster.FormatOptions{Header: "Copyright 2018 henrylee2cn.\n\nLicensed under the Apache License.", Generator: "aster"}
+	code, err := f.Format(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Copyright 2018 henrylee2cn.\n//\n// Licensed under the Apache License.\n\n" +
+		"// Code generated by aster. DO NOT EDIT.\n\n// Package test is a test.\npackage test\n"
+	if code != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", code, want)
+	}
+	f, err = aster.ParseFile("../_out/banner.go", []byte(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if by, ok := f.IsGenerated(); !ok || by != "by aster." {
+		t.Fatalf("generated: %q, %v", by, ok)
+	}
+	if !f.HasHeader(opts.Header) || f.HasHeader("Copyright 2019") {
+		t.Fatal("wrong header detection")
+	}
+	// no duplicates
+	opts.Generator = "other"
+	if code2, _ := f.Format(opts); code2 != code {
+		t.Fatalf("duplicated:\n%s", code2)
+	}
+}
+
+func TestNodeAtAndPathTo(t *testing.T) {
+	m := parseModule(t, "nodeat", map[string]string{
+		"a.go": `package nodeat
+
+type S struct {
+	x int
+}
+
+func (s S) Get() int {
+	return s.x
+}
+`,
+	})
+	var f *aster.File
+	for name, file := range m.Packages["nodeat"].Files {
+		if strings.HasSuffix(name, "a.go") {
+			f = file
+		}
+	}
+	for _, c := range []struct {
+		line, col int
+		want      string
+	}{{4, 2, "S"}, {8, 9, "Get"}, {7, 1, "Get"}} {
+		n, ok := f.NodeAt(c.line, c.col)
+		if !ok || n.Name() != c.want {
+			t.Fatalf("NodeAt(%d, %d): %v %v", c.line, c.col, n, ok)
+		}
+	}
+	for _, c := range [][2]int{{2, 1}, {0, 1}, {4, 20}, {99, 1}} {
+		if n, ok := f.NodeAt(c[0], c[1]); ok {
+			t.Fatalf("NodeAt(%d, %d): %s", c[0], c[1], n.Name())
+		}
+	}
+
+	pos := f.FileSet.File(f.File.Pos()).Pos(strings.Index(string(f.Src), "s.x") + 2)
+	var kinds []string
+	for _, n := range f.PathTo(pos) {
+		kinds = append(kinds, fmt.Sprintf("%T", n))
+	}
+	want := "*ast.Ident *ast.SelectorExpr *ast.ReturnStmt *ast.BlockStmt *ast.FuncDecl *ast.File"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("PathTo: %s", got)
+	}
+	if path := f.PathTo(token.NoPos); path != nil {
+		t.Fatalf("PathTo(NoPos): %v", path)
+	}
+}
+
+func TestParseTests(t *testing.T) {
+	parseModule(t, "tests", map[string]string{
+		"a.go":        "package tests\nfunc A() {}\n",
+		"a_test.go":   "package tests\nfunc TestA() {}\n",
+		"ext_test.go": "package tests_test\nfunc TestExt() {}\n",
+	})
+	dir := "../_out/tests"
+	for mode, want := range map[aster.TestMode]string{
+		aster.TestsAll:      "tests:2 tests_test:1",
+		aster.TestsNone:     "tests:1",
+		aster.TestsInternal: "tests:2",
+	} {
+		m, err := aster.ParseDirWith(dir, &aster.ParseConfig{Tests: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, name := range []string{"tests", "tests_test"} {
+			if p, ok := m.Packages[name]; ok {
+				got = append(got, fmt.Sprintf("%s:%d", name, len(p.Files)))
+				if p.IsTest() != (name == "tests_test") {
+					t.Fatalf("%s: IsTest %v", name, p.IsTest())
+				}
+				for filename, f := range p.Files {
+					if f.IsTest() != strings.HasSuffix(filename, "_test.go") {
+						t.Fatalf("%s: IsTest %v", filename, f.IsTest())
+					}
+				}
+			}
+		}
+		if strings.Join(got, " ") != want {
+			t.Fatalf("mode %d: %v, want %s", mode, got, want)
+		}
+	}
+}
+
+func TestDirs(t *testing.T) {
+	root := "../_out/dirs"
+	os.RemoveAll(root)
+	for _, name := range []string{
+		"a.go", "sub/b.go", "vendor/v/v.go", "testdata/t.go",
+		"nested/go.mod", "nested/n.go", ".hidden/h.go", "_tmp/u.go", "empty/x.txt",
+	} {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		src := "package " + strings.Trim(filepath.Base(filepath.Dir(filename)), "._") + "\n"
+		if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(cfg *aster.WalkConfig, want ...string) {
+		t.Helper()
+		dirs, err := aster.Dirs(root, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			want[i] = filepath.Join(root, want[i])
+		}
+		if strings.Join(dirs, " ") != strings.Join(want, " ") {
+			t.Fatalf("dirs: %v, want %v", dirs, want)
+		}
+	}
+	check(nil, "", "sub")
+	check(&aster.WalkConfig{Vendor: true, Testdata: true}, "", "sub", "testdata", "vendor/v")
+	check(&aster.WalkConfig{NestedModules: true, Hidden: true}, "", ".hidden", "_tmp", "nested", "sub")
+
+	mods, err := aster.ParseTree(root, &aster.WalkConfig{Vendor: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 3 || mods[2].Packages["v"] == nil {
+		t.Fatalf("modules: %d", len(mods))
+	}
+}
+
+func TestWalkPatterns(t *testing.T) {
+	root := "../_out/walk"
+	os.RemoveAll(root)
+	for _, name := range []string{
+		"a.go", "zz_generated.go", "sub/b.go", "sub/zz_generated_deep.go",
+		"gen/zz_generated.go", "node_modules/m/m.go", "sub/skip/s.go",
+	} {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		src := "package " + filepath.Base(filepath.Dir(filename)) + "\n"
+		if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &aster.WalkConfig{
+		Files:    []string{"**/*.go", "!**/zz_generated*.go"},
+		SkipDirs: []string{"node_modules", "sub/skip"},
+	}
+	dirs, err := aster.Dirs(root, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := root + " " + filepath.Join(root, "sub"); strings.Join(dirs, " ") != want {
+		t.Fatalf("dirs: %v, want %s", dirs, want)
+	}
+	mods, err := aster.ParseTree(root, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, mod := range mods {
+		for _, p := range mod.Packages {
+			for name := range p.Files {
+				files = append(files, filepath.ToSlash(name))
+			}
+		}
+	}
+	sort.Strings(files)
+	if got, want := strings.Join(files, " "), root+"/a.go "+root+"/sub/b.go"; got != want {
+		t.Fatalf("files: %s, want %s", got, want)
+	}
+
+	mods, err = aster.ParsePatterns([]string{root + "/...", root + "/gen"}, &aster.WalkConfig{
+		Files: []string{"!**/zz_generated*.go", "**/sub/zz_*.go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 5 {
+		t.Fatalf("modules: %d", len(mods))
+	}
+	if p := mods[3].Packages["sub"]; p == nil || len(p.Files) != 2 {
+		t.Fatalf("sub: %v", p)
+	}
+	if len(mods[1].Packages) != 0 {
+		t.Fatalf("gen: %v", mods[1].Packages)
+	}
+}
+
+func TestImplementsExternal(t *testing.T) {
+	m := parseModule(t, "external", map[string]string{
+		"go.mod": "module example.com/external\n\ngo 1.18\n",
+		"a.go": `package external
+
+import (
+	"fmt"
+	"io"
+)
+
+type R struct{}
+
+func (*R) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func (r R) String() string { return fmt.Sprint("R") }
+`,
+	})
+	var f *aster.File
+	for _, file := range m.Packages["external"].Files {
+		f = file
+	}
+	obj, err := f.LookupExternalType("io.Reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Pkg().Path() != "io" || obj.Name() != "Reader" {
+		t.Fatalf("LookupExternalType: %v", obj)
+	}
+	for _, name := range []string{"bytes.Buffer", "io.reader", "Reader"} {
+		if _, err := f.LookupExternalType(name); err == nil {
+			t.Fatalf("LookupExternalType(%s): want error", name)
+		}
+	}
+	r, _ := m.Packages["external"].LookupType("R")
+	for iface, want := range map[string]bool{"io.Reader": true, "fmt.Stringer": true, "io.Writer": false} {
+		ok, err := f.ImplementsExternal(r, iface)
+		if err != nil || ok != want {
+			t.Fatalf("ImplementsExternal(%s): %v %v", iface, ok, err)
+		}
+	}
+}
+
+func TestEncodeModule(t *testing.T) {
+	m := parseModule(t, "encode", map[string]string{
+		"a.go":      "package encode\n\n// A is a.\ntype A struct{ X int }\n",
+		"b.go":      "package encode\n\nfunc (a *A) B() int { return a.X }\n",
+		"c_test.go": "package encode_test\n\nfunc TestC() {}\n",
+	})
+	var buf strings.Builder
+	if err := m.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d, err := aster.DecodeModule(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Dir != m.Dir || len(d.Packages) != len(m.Packages) {
+		t.Fatalf("decoded: %s %v", d.Dir, d.Packages)
+	}
+	for name, p := range m.Packages {
+		dp := d.Packages[name]
+		if dp == nil || len(dp.Files) != len(p.Files) {
+			t.Fatalf("package %s: %v", name, dp)
+		}
+		for filename, f := range p.Files {
+			df := dp.Files[filename]
+			if df == nil || string(df.Src) != string(f.Src) || len(df.Nodes) != len(f.Nodes) {
+				t.Fatalf("file %s: %v", filename, df)
+			}
+			for pos, n := range f.Nodes {
+				dn := df.Nodes[pos]
+				if dn == nil || dn.Name() != n.Name() ||
+					d.FileSet.Position(pos) != m.FileSet.Position(pos) {
+					t.Fatalf("node %s at %s: %v", n.Name(), m.FileSet.Position(pos), dn)
+				}
+			}
+		}
+	}
+	a, ok := d.Packages["encode"].LookupType("A")
+	if !ok || a.NumMethod() != 1 {
+		t.Fatalf("type A: %v", a)
+	}
+	if _, err := aster.DecodeModule(strings.NewReader("garbage")); err == nil {
+		t.Fatal("want decode error")
+	}
+}
+
+func TestProto(t *testing.T) {
+	m := parseModule(t, "proto", map[string]string{
+		"a.go": `package proto
+
+import "time"
+
+type Status int
+
+// User is a user.
+type User struct {
+	ID    int64 ` + "`proto:\",3\"`" + `
+	Name  string
+	Tags  []string ` + "`proto:\"labels\"`" + `
+	Attrs map[string]*Address
+	Since time.Time
+	Age   *int
+	State Status
+	Meta  struct {
+		Key string
+	}
+	Raw    []byte
+	Secret string ` + "`proto:\"-\"`" + `
+	hidden bool
+}
+
+type Address struct {
+	City string
+}
+`,
+	})
+	p := m.Packages["proto"]
+	b, err := proto.Generate(p, &proto.Options{
+		GoPackage: "example.com/proto",
+		Filter:    func(t aster.TypeNode) bool { return t.Name() == "User" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by aster. DO NOT EDIT.
+
+syntax = "proto3";
+
+package proto;
+
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/proto";
+
+// User is a user.
+message User {
+  message Meta {
+    string key = 1;
+  }
+  int64 id = 3;
+  string name = 4;
+  repeated string labels = 5;
+  map<string, Address> attrs = 6;
+  google.protobuf.Timestamp since = 7;
+  optional int64 age = 8;
+  int64 state = 9;
+  Meta meta = 10;
+  bytes raw = 11;
+}
+
+message Address {
+  string city = 1;
+}
+`
+	if string(b) != want {
+		t.Fatalf("got:\n%s", b)
+	}
+
+	// the untagged fields are numbered after the largest number tagged
+	m = parseModule(t, "proto_order", map[string]string{
+		"a.go": "package proto_order\ntype A struct {\n\tB int32 `proto:\",5\"`\n\tC int32 `proto:\",2\"`\n\tD int32\n}\n",
+	})
+	b, err = proto.Generate(m.Packages["proto_order"], nil)
+	if err != nil || !strings.Contains(string(b), "int32 b = 5;\n  int32 c = 2;\n  int32 d = 6;\n") {
+		t.Fatalf("got: %s, %v", b, err)
+	}
+
+	m = parseModule(t, "proto_err", map[string]string{
+		"a.go": "package proto_err\ntype A struct {\n\tC chan int\n}\n",
+	})
+	if _, err = proto.Generate(m.Packages["proto_err"], nil); err == nil || !strings.Contains(err.Error(), "A.C") {
+		t.Fatalf("want error: %v", err)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	m := parseModule(t, "openapi", map[string]string{
+		"a.go": `package openapi
+
+import "time"
+
+type Base struct {
+	ID int64 ` + "`json:\"id\" validate:\"required,gt=0\"`" + `
+}
+
+// User is a user.
+type User struct {
+	Base
+	// Name is the full name.
+	Name    string   ` + "`json:\"name\" validate:\"required,max=64\"`" + `
+	Email   string   ` + "`json:\"email,omitempty\" validate:\"email\"`" + `
+	Tags    []string ` + "`json:\"tags\" validate:\"max=8,dive,min=1\"`" + `
+	Level   int      ` + "`validate:\"oneof=1 2 3\"`" + `
+	Home    *Address ` + "`json:\"home\"`" + `
+	Age     *int     ` + "`json:\"age\"`" + ` // in years
+	Created time.Time ` + "`json:\"created\"`" + `
+	Secret  string   ` + "`json:\"-\"`" + `
+	hidden  bool
+}
+
+type Address struct {
+	City string ` + "`json:\"city\"`" + `
+}
+`,
+	})
+	schemas, err := openapi.Schemas(m.Packages["openapi"], &openapi.Options{
+		Filter: func(t aster.TypeNode) bool { return t.Name() == "User" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(schemas)
+	want := `{"Address":{"type":"object","properties":{"city":{"type":"string"}}},` +
+		`"User":{"type":"object","description":"User is a user.","properties":{` +
+		`"Level":{"type":"integer","format":"int64","enum":[1,2,3]},` +
+		`"age":{"type":"integer","format":"int64","description":"in years","nullable":true},` +
+		`"created":{"type":"string","format":"date-time"},` +
+		`"email":{"type":"string","format":"email"},` +
+		`"home":{"$ref":"#/components/schemas/Address"},` +
+		`"id":{"type":"integer","format":"int64","minimum":0,"exclusiveMinimum":true},` +
+		`"name":{"type":"string","description":"Name is the full name.","maxLength":64},` +
+		`"tags":{"type":"array","items":{"type":"string","minLength":1},"maxItems":8}},` +
+		`"required":["id","name"]}}`
+	if string(b) != want {
+		t.Fatalf("got:\n%s", b)
+	}
+	doc, err := openapi.Components(m.Packages["openapi"], nil)
+	if err != nil || !strings.HasPrefix(string(doc), "{\n  \"components\": {\n    \"schemas\": {") {
+		t.Fatalf("components: %s %v", doc, err)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	m := parseModule(t, "graphql", map[string]string{
+		"a.go": `package graphql
+
+import "time"
+
+// Node is an object with an ID.
+type Node interface {
+	GetID() string
+}
+
+type Base struct {
+	ID string
+}
+
+func (b Base) GetID() string { return b.ID }
+
+// User is a user.
+type User struct {
+	Base
+	Name    *string
+	Posts   []*Post ` + "`graphql:\"articles,nonnull\"`" + `
+	Created time.Time
+	Secret  string ` + "`graphql:\"-\"`" + `
+}
+
+func (u User) GetID() string { return u.ID }
+
+type Post struct {
+	// Title is the title.
+	Title string ` + "`graphql:\",nullable\"`" + `
+}
+
+type UserInput struct {
+	Name string
+	Tags []string
+}
+`,
+	})
+	b, err := graphql.Generate(m.Packages["graphql"], &graphql.Options{
+		Filter: func(t aster.TypeNode) bool { return t.Name() != "Base" && t.Name() != "Post" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Code generated by aster. DO NOT EDIT.
+
+scalar Time
+
+"Node is an object with an ID."
+interface Node {
+  getID: String!
+}
+
+"User is a user."
+type User implements Node {
+  id: String!
+  name: String
+  articles: [Post]!
+  created: Time!
+}
+
+input UserInput {
+  name: String!
+  tags: [String!]
+}
+
+type Post {
+  "Title is the title."
+  title: String
+}
+`
+	if string(b) != want {
+		t.Fatalf("got:\n%s", b)
+	}
+
+	m = parseModule(t, "graphql_err", map[string]string{
+		"a.go": "package graphql_err\ntype AInput struct {\n\tB B\n}\ntype B struct{}\n",
+	})
+	if _, err = graphql.Generate(m.Packages["graphql_err"], nil); err == nil || !strings.Contains(err.Error(), "AInput.B") {
+		t.Fatalf("want error: %v", err)
+	}
+}
+
+func TestDDL(t *testing.T) {
+	m := parseModule(t, "ddl", map[string]string{
+		"a.go": `package ddl
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Status int8
+
+type Model struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+type User struct {
+	Model
+	Email    string ` + "`db:\"email\" gorm:\"size:128;unique\"`" + `
+	Name     *string ` + "`gorm:\"column:full_name\"`" + `
+	Nick     sql.NullString
+	Status   Status ` + "`gorm:\"default:1\"`" + `
+	Avatar   []byte
+	Password string ` + "`db:\"-\"`" + `
+}
+
+type Membership struct {
+	UserID  int64 ` + "`gorm:\"primaryKey\"`" + `
+	GroupID int64 ` + "`gorm:\"primaryKey\"`" + `
+	Score   float64
+}
+`,
+	})
+	p := m.Packages["ddl"]
+	b, err := ddl.Generate(p, ddl.Postgres, &ddl.Options{
+		Filter: func(t aster.TypeNode) bool { return t.Name() != "Model" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-- Code generated by aster. DO NOT EDIT.
+
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "created_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+  "email" VARCHAR(128) NOT NULL UNIQUE,
+  "full_name" TEXT,
+  "nick" TEXT,
+  "status" INTEGER NOT NULL DEFAULT 1,
+  "avatar" BYTEA NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS "memberships" (
+  "user_id" BIGINT NOT NULL,
+  "group_id" BIGINT NOT NULL,
+  "score" DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY ("user_id", "group_id")
+);
+`
+	if string(b) != want {
+		t.Fatalf("got:\n%s", b)
+	}
+	tables, err := ddl.Tables(p, nil)
+	if err != nil || len(tables) != 3 {
+		t.Fatalf("tables: %v %v", tables, err)
+	}
+	users := tables[1]
+	for d, want := range map[ddl.Dialect]string{
+		ddl.MySQL:  "`id` BIGINT PRIMARY KEY AUTO_INCREMENT,\n  `created_at` DATETIME(3) NOT NULL,\n  `email` VARCHAR(128) NOT NULL UNIQUE,",
+		ddl.SQLite: "\"id\" INTEGER PRIMARY KEY AUTOINCREMENT,\n  \"created_at\" DATETIME NOT NULL,\n  \"email\" TEXT NOT NULL UNIQUE,",
+	} {
+		if sql := users.CreateSQL(d); !strings.Contains(sql, want) {
+			t.Fatalf("got:\n%s", sql)
+		}
+	}
+
+	m = parseModule(t, "ddl_err", map[string]string{
+		"a.go": "package ddl_err\ntype A struct {\n\tTags []string\n}\n",
+	})
+	if _, err = ddl.Tables(m.Packages["ddl_err"], nil); err == nil || !strings.Contains(err.Error(), "A.Tags") {
+		t.Fatalf("want error: %v", err)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	m := parseModule(t, "tagnorm", map[string]string{
+		"a.go": `package tagnorm
+
+type User struct {
+	UserID   int64
+	HTMLBody string ` + "`json:\"body,omitempty\" db:\"body\"`" + `
+	Name     string ` + "`db:\"name\"`" + `
+	Secret   string ` + "`json:\"-\"`" + `
+	Meta     struct {
+		CreatedAt int64 ` + "`json:\",string\"`" + `
+	}
+	Base
+	hidden bool
+}
+
+type Base struct{ ID int }
+`,
+	})
+	p := m.Packages["tagnorm"]
+	n, err := p.NormalizeTags("json", aster.CamelCase)
+	if err != nil || n != 6 {
+		t.Fatalf("NormalizeTags: %d %v", n, err)
+	}
+	format := func() string {
+		for _, f := range p.Files {
+			code, err := f.Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return code
+		}
+		return ""
+	}
+	code := format()
+	for _, want := range []string{
+		"UserID   int64  `json:\"userId\"`",
+		"} `json:\"meta\"`",
+		"HTMLBody string `json:\"htmlBody,omitempty\" db:\"body\"`",
+		"Name     string `db:\"name\" json:\"name\"`",
+		"Secret   string `json:\"-\"`",
+		"CreatedAt int64 `json:\"createdAt,string\"`",
+		"ID int `json:\"id\"`",
+		"hidden bool\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("want %q in:\n%s", want, code)
+		}
+	}
+	if n, err = p.NormalizeTags("json", aster.CamelCase); err != nil || n != 0 {
+		t.Fatalf("NormalizeTags again: %d %v", n, err)
+	}
+	if n, err = p.NormalizeTags("json", aster.SnakeCase); err != nil || n != 3 {
+		t.Fatalf("NormalizeTags snake: %d %v", n, err)
+	}
+	if code = format(); !strings.Contains(code, "`json:\"html_body,omitempty\" db:\"body\"`") {
+		t.Fatalf("snake case:\n%s", code)
+	}
+}
+
+func TestGenerateEnum(t *testing.T) {
+	m := parseModule(t, "enum", map[string]string{
+		"a.go": `package enum
+
+type Color uint8
+
+const (
+	Red Color = iota + 1
+	_
+	Blue
+	Crimson = Red
+	Green Color = 1 << (iota + 2)
+)
+
+type Size int
+
+const (
+	Small Size = iota * 10
+	Large
+	Unit = 7
+)
+
+type Flag string
+
+const (
+	A Flag = "a"
+)
+`,
+	})
+	p := m.Packages["enum"]
+	enums := p.Enums()
+	if len(enums) != 2 {
+		t.Fatalf("enums: %d", len(enums))
+	}
+	var got []string
+	for _, e := range enums {
+		for _, v := range e.Values {
+			got = append(got, e.Type+"."+v.Name+"="+v.Value.String())
+		}
+	}
+	want := "Color.Red=1 Color.Blue=3 Color.Crimson=1 Color.Green=64 Size.Small=0 Size.Large=10"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("values: %v", got)
+	}
+	if !enums[0].Unsigned || enums[1].Unsigned {
+		t.Fatal("unsigned")
+	}
+	for i := 0; i < 2; i++ {
+		f, err := p.GenerateEnum("Color")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := f.Format()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"\tcase Red:\n\t\treturn \"Red\"\n\tcase Blue:",
+			"\tcase Red, Blue, Green:\n\t\treturn []byte(x.String()), nil",
+			"\tcase \"Crimson\":\n\t\treturn Crimson, nil",
+			"return \"Color(\" + strconv.FormatUint(uint64(x), 10) + \")\"",
+			"func ParseColor(name string) (Color, error) {",
+		} {
+			if !strings.Contains(code, want) {
+				t.Fatalf("want %q in:\n%s", want, code)
+			}
+		}
+	}
+	if _, err := p.GenerateEnum("Size"); err != nil {
+		t.Fatal(err)
+	}
+	if failures := p.Verify(true); len(failures) > 0 {
+		t.Fatal(failures[0])
+	}
+	if _, err := p.GenerateEnum("Flag"); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	file := func(dir, src string) *aster.File {
+		m := parseModule(t, dir, map[string]string{"a.go": src})
+		for _, f := range m.Packages["apidiff"].Files {
+			return f
+		}
+		t.Fatal("no file")
+		return nil
+	}
+	old := file("apidiff_old", `package apidiff
+
+type User struct {
+	Name  string `+"`json:\"name\"`"+`
+	Email string
+	Age   int
+}
+
+type Store interface {
+	Get(id int) (*User, error)
+}
+
+const Max = 10
+
+func Lookup(id int) *User { return nil }
+
+func (u *User) Rename(name string) {}
+
+func helper() {}
+`)
+	new := file("apidiff_new", `package apidiff
+
+type User struct {
+	Name string `+"`json:\"full_name\"`"+`
+	Age  int64
+}
+
+type Store interface {
+	Get(id int) (*User, error)
+	Put(u *User) error
+}
+
+type Group struct{}
+
+const Max = 20
+
+func Lookup(id int, strict bool) (*User, error) { return nil, nil }
+
+func (u *User) Rename(name string) {}
+`)
+	var got []string
+	for _, c := range aster.DiffFiles(old, new) {
+		got = append(got, fmt.Sprintf("%s %v", c, c.Breaking()))
+	}
+	want := []string{
+		"type Group: added false",
+		"func Lookup: signature changed: func Lookup(int) *User -> func Lookup(int, bool) (*User, error) true",
+		"const Max: value changed: 10 -> 20 false",
+		"interface method Store.Put: added true",
+		"field User.Age: type changed: int -> int64 true",
+		"field User.Email: removed true",
+		"field User.Name: tag changed: json:\"name\" -> json:\"full_name\" false",
+		"func helper: removed false",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("DiffFiles:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if changes := aster.DiffFiles(old, old); len(changes) != 0 {
+		t.Fatalf("DiffFiles(old, old): %v", changes)
+	}
+	if changes := aster.DiffFiles(nil, old); len(changes) != 10 {
+		t.Fatalf("DiffFiles(nil, old): %d changes", len(changes))
+	}
+}
+
+func TestApply(t *testing.T) {
+	m := parseModule(t, "apply", map[string]string{
+		"a.go": `package apply
+
+import "strings"
+
+// Old is removed.
+func Old() string { return strings.ToUpper("old") }
+
+// Keep is kept.
+func Keep() int {
+	// one is replaced
+	return 1
+}
+`,
+	})
+	var f *aster.File
+	for _, f = range m.Packages["apply"].Files {
+	}
+	err := f.Apply(func(c aster.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.FuncDecl:
+			switch n.Name.Name {
+			case "Old":
+				c.Delete()
+			case "Keep":
+				c.InsertAfter(&ast.FuncDecl{
+					Name: ast.NewIdent("Hello"),
+					Type: &ast.FuncType{Params: &ast.FieldList{}},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+						Fun:  &ast.SelectorExpr{X: ast.NewIdent("fmt"), Sel: ast.NewIdent("Println")},
+						Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"hello"`}},
+					}}}},
+				})
+			}
+		case *ast.ReturnStmt:
+			c.Replace(&ast.ReturnStmt{Return: n.Return, Results: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "2"}}})
+		}
+		return true
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package apply
+
+import (
+	"fmt"
+)
+
+// Keep is kept.
+func Keep() int {
+	// one is replaced
+	return 2
+}
+
+func Hello() {
+	fmt.Println("hello")
+}
+`
+	if got := string(f.Src); got != want {
+		t.Fatalf("Apply:\n%s\nwant:\n%s", got, want)
+	}
+	var names []string
+	for _, n := range f.Nodes {
+		names = append(names, n.Name())
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "Hello,Keep" {
+		t.Fatalf("Nodes: %s", got)
+	}
+	if len(f.Imports) != 1 || f.Imports[0].Path != "fmt" {
+		t.Fatalf("Imports: %v", f.Imports)
+	}
+}
+
+func TestCompositeElem(t *testing.T) {
+	m := parseModule(t, "composite", map[string]string{
+		"a.go": `package composite
+
+const size = 2 << 1
+
+type User struct{ Name string }
+
+type Users []*User
+
+type Grid [size][2]int
+
+type Index map[string][]User
+
+type Events <-chan struct{ ID int }
+
+type Ref *User
+`,
+	})
+	p := m.Packages["composite"]
+	lookup := func(name string) aster.TypeNode {
+		typ, ok := p.LookupType(name)
+		if !ok {
+			t.Fatalf("type not found: %s", name)
+		}
+		return typ
+	}
+	elem, ok := lookup("Users").(*aster.ListType).Elem()
+	if !ok || elem.Kind() != aster.Ptr {
+		t.Fatalf("Users.Elem: %v %v", elem, ok)
+	}
+	user, ok := elem.(*aster.BasicType).Elem()
+	if !ok || user != lookup("User") {
+		t.Fatalf("*User.Elem: %v %v", user, ok)
+	}
+	grid := lookup("Grid").(*aster.ListType)
+	if n, ok := grid.Len(); !ok || n != 4 {
+		t.Fatalf("Grid.Len: %d %v", n, ok)
+	}
+	row, _ := grid.Elem()
+	if n, ok := row.(*aster.ListType).Len(); !ok || n != 2 {
+		t.Fatalf("Grid row Len: %d %v", n, ok)
+	}
+	if cell, _ := row.(*aster.ListType).Elem(); cell.Kind() != aster.Int || cell.Name() != "" {
+		t.Fatalf("Grid cell: %v", cell)
+	}
+	index := lookup("Index").(*aster.MapType)
+	if key, ok := index.Key(); !ok || key.Kind() != aster.String {
+		t.Fatalf("Index.Key: %v %v", key, ok)
+	}
+	users, _ := index.Elem()
+	if u, ok := users.(*aster.ListType).Elem(); !ok || u != lookup("User") {
+		t.Fatalf("Index.Elem.Elem: %v %v", u, ok)
+	}
+	events := lookup("Events").(*aster.ChanType)
+	event, ok := events.Elem()
+	if !ok || events.Dir() != ast.RECV || event.(*aster.StructType).NumField() != 1 {
+		t.Fatalf("Events.Elem: %v %v", event, ok)
+	}
+	if u, ok := lookup("Ref").(*aster.BasicType).Elem(); !ok || u != lookup("User") {
+		t.Fatalf("Ref.Elem: %v %v", u, ok)
+	}
+}
+
+func TestAliasOf(t *testing.T) {
+	m := parseModule(t, "alias", map[string]string{
+		"a.go": `package alias
+
+type User struct{ Name string }
+
+type Member = User
+
+type Admin = Member
+
+type IDs = []int
+
+type Point = struct{ X, Y int }
+
+type Users []User
+`,
+	})
+	p := m.Packages["alias"]
+	lookup := func(name string) aster.TypeNode {
+		typ, ok := p.LookupType(name)
+		if !ok {
+			t.Fatalf("type not found: %s", name)
+		}
+		return typ
+	}
+	user, admin := lookup("User"), lookup("Admin")
+	if user.IsAlias() || lookup("Users").IsAlias() || !admin.IsAlias() {
+		t.Fatal("IsAlias")
+	}
+	if member, ok := admin.AliasOf(); !ok || member != lookup("Member") {
+		t.Fatalf("Admin.AliasOf: %v %v", member, ok)
+	}
+	if got := aster.Unalias(admin); got != user {
+		t.Fatalf("Unalias(Admin): %v", got)
+	}
+	if got := aster.Unalias(user); got != user {
+		t.Fatalf("Unalias(User): %v", got)
+	}
+	ids, ok := lookup("IDs").AliasOf()
+	if !ok || ids.Kind() != aster.Slice || ids.IsAlias() || ids.Name() != "" {
+		t.Fatalf("IDs.AliasOf: %v %v", ids, ok)
+	}
+	point := lookup("Point")
+	if target := aster.Unalias(point); target == point || target.Kind() != aster.Struct || target.NumField() != 2 {
+		t.Fatalf("Unalias(Point): %v", target)
+	}
+	for name, want := range map[string]string{
+		"Admin": "type Admin = Member",
+		"IDs":   "type IDs = []int",
+		"Point": "type Point = struct {\n\tX int\n\tY int\n}",
+		"Users": "type Users []User",
+	} {
+		if got := lookup(name).String(); got != want {
+			t.Fatalf("%s.String: %q, want %q", name, got, want)
+		}
+		if c := lookup(name).Clone().(aster.TypeNode); c.IsAlias() != lookup(name).IsAlias() {
+			t.Fatalf("%s.Clone: IsAlias %v", name, c.IsAlias())
+		}
+	}
+}
+
+func TestPackageDoc(t *testing.T) {
+	m := parseModule(t, "pkgdoc", map[string]string{
+		"a.go": `// Package pkgdoc greets. It is an example.
+//
+//	pkgdoc.Hello("world")
+package pkgdoc
+
+import "fmt"
+
+// Greeting is the format of the greetings.
+const Greeting = "hello, %s"
+
+// Greeter greets.
+type Greeter struct{ Name string }
+
+// NewGreeter returns a Greeter.
+func NewGreeter(name string) *Greeter { return &Greeter{Name: name} }
+
+// Greet returns the greeting.
+func (g *Greeter) Greet() string { return Hello(g.Name) }
+
+// Hello returns the greeting of the name.
+func Hello(name string) string { return fmt.Sprintf(Greeting, name) }
+
+func hidden() {}
+`,
+		"a_test.go": `package pkgdoc_test
+
+import (
+	"fmt"
+
+	"pkgdoc"
+)
+
+func ExampleHello() {
+	fmt.Println(pkgdoc.Hello("world"))
+	// Output: hello, world
+}
+`,
+	})
+	d, err := m.Packages["pkgdoc"].Doc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Synopsis != "Package pkgdoc greets." || len(d.Consts) != 1 || len(d.Funcs) != 1 || len(d.Types) != 1 {
+		t.Fatalf("Doc: %+v", d)
+	}
+	hello := d.Funcs[0]
+	if hello.Node == nil || hello.Node.Name() != "Hello" || hello.Decl != "func Hello(name string) string" {
+		t.Fatalf("Hello: %+v", hello)
+	}
+	if len(hello.Examples) != 1 || hello.Examples[0].Output != "hello, world\n" {
+		t.Fatalf("Hello examples: %+v", hello.Examples)
+	}
+	g := d.Types[0]
+	if g.Node == nil || g.Node.Kind() != aster.Struct || len(g.Funcs) != 1 || len(g.Methods) != 1 || g.Methods[0].Node == nil {
+		t.Fatalf("Greeter: %+v", g)
+	}
+	if !strings.HasSuffix(d.ImportPath, "/_out/pkgdoc") {
+		t.Fatalf("ImportPath: %s", d.ImportPath)
+	}
+	d.ImportPath = ""
+	want := "# pkgdoc\n\n" +
+		"Package pkgdoc greets. It is an example.\n\n" +
+		"```\npkgdoc.Hello(\"world\")\n```\n\n" +
+		"## Constants\n\n" +
+		"```go\nconst Greeting = \"hello, %s\"\n```\n\n" +
+		"Greeting is the format of the greetings.\n\n" +
+		"## Functions\n\n" +
+		"### func Hello\n\n" +
+		"```go\nfunc Hello(name string) string\n```\n\n" +
+		"Hello returns the greeting of the name.\n\n" +
+		"**Example**\n\n" +
+		"```go\nfmt.Println(pkgdoc.Hello(\"world\"))\n```\n\n" +
+		"Output:\n\n```\nhello, world\n```\n\n" +
+		"## Types\n\n" +
+		"### type Greeter\n\n" +
+		"```go\ntype Greeter struct{ Name string }\n```\n\n" +
+		"Greeter greets.\n\n" +
+		"### func NewGreeter\n\n" +
+		"```go\nfunc NewGreeter(name string) *Greeter\n```\n\n" +
+		"NewGreeter returns a Greeter.\n\n" +
+		"#### func (*Greeter) Greet\n\n" +
+		"```go\nfunc (g *Greeter) Greet() string\n```\n\n" +
+		"Greet returns the greeting.\n"
+	if got := d.Markdown(); got != want {
+		t.Fatalf("Markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFuncBody(t *testing.T) {
+	m := parseModule(t, "funcbody", map[string]string{
+		"a.go": `package funcbody
+
+func Sum(a, b int) int {
+	// add them
+	return a + b
+}
+
+func Empty() {}
+
+var Lit = func() {
+	println("lit")
+}
+`,
+	})
+	p := m.Packages["funcbody"]
+	lookup := func(name string) aster.FuncNode {
+		for _, f := range p.Files {
+			for _, n := range f.Nodes {
+				if fn, ok := n.(aster.FuncNode); ok && fn.Name() == name {
+					return fn
+				}
+			}
+		}
+		t.Fatalf("func not found: %s", name)
+		return nil
+	}
+	sum := lookup("Sum")
+	if len(sum.Body().List) != 1 {
+		t.Fatalf("Sum.Body: %d", len(sum.Body().List))
+	}
+	if err := sum.InsertStmtAt(0, `println("enter")`); err != nil {
+		t.Fatal(err)
+	}
+	// the node is rebound to the reparsed file
+	if err := sum.InsertStmtAt(1, "defer println(\"exit\")\nc := a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sum.InsertStmtAt(9, "return 0"); err == nil {
+		t.Fatal("InsertStmtAt out of range")
+	}
+	if err := sum.AppendStmt("if {"); err == nil {
+		t.Fatal("AppendStmt of invalid statements")
+	}
+	empty := lookup("Empty")
+	if err := empty.AppendStmt(`println("empty")`); err != nil {
+		t.Fatal(err)
+	}
+	if err := lookup("Lit").SetBody("return"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range p.Files {
+		code, err := f.Format()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `package funcbody
+
+func Sum(a, b int) int {
+	println("enter")
+	defer println("exit")
+	c := a
+	// add them
+	return a + b
+}
+
+func Empty() {
+	println("empty")
+}
+
+var Lit = func() {
+	return
+}
+`
+		if code != want {
+			t.Fatalf("got:\n%s\nwant:\n%s", code, want)
+		}
+	}
+	if n := len(lookup("Sum").Body().List); n != 4 || len(sum.Body().List) != 4 {
+		t.Fatalf("Sum.Body: %d", n)
+	}
+}
+
+func TestWalkStmts(t *testing.T) {
+	m := parseModule(t, "walkstmts", map[string]string{
+		"a.go": `package walkstmts
+
+import "errors"
+
+func Load(name string) (int, error) {
+	if name == "" {
+		return 0, errors.New("empty")
+	}
+	n := len(name)
+	check := func() error {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		n += i
+	}
+	return n, check()
+}
+`,
+	})
+	var fn aster.FuncNode
+	var f *aster.File
+	for _, f = range m.Packages["walkstmts"].Files {
+		for _, n := range f.Nodes {
+			if n.Name() == "Load" {
+				fn = n.(aster.FuncNode)
+			}
+		}
+	}
+	var kinds []string
+	for _, s := range fn.Stmts() {
+		kinds = append(kinds, fmt.Sprintf("%T", s)[5:])
+	}
+	if got := strings.Join(kinds, " "); got != "IfStmt ReturnStmt AssignStmt AssignStmt ForStmt AssignStmt IncDecStmt AssignStmt ReturnStmt" {
+		t.Fatalf("Stmts: %s", got)
+	}
+	// the errors returned by Load
+	last := fn.NumResult() - 1
+	if r, _ := fn.Result(last); r.TypeName != "error" {
+		t.Fatalf("Result: %s", r.TypeName)
+	}
+	var errs, calls []string
+	var assigns int
+	fn.WalkStmts(aster.NewStmtVisitor().
+		OnReturn(func(s *ast.ReturnStmt) {
+			errs = append(errs, f.TryFormatNode(s.Results[last]))
+		}).
+		OnAssign(func(*ast.AssignStmt) { assigns++ }).
+		OnCall(func(c *ast.CallExpr) {
+			calls = append(calls, f.TryFormatNode(c.Fun))
+		}))
+	if got := strings.Join(errs, ","); got != `errors.New("empty"),check()` {
+		t.Fatalf("returned errors: %s", got)
+	}
+	if got := strings.Join(calls, ","); got != "errors.New,len,check" || assigns != 4 {
+		t.Fatalf("calls: %s, assigns: %d", got, assigns)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	m := parseModule(t, "instrument", map[string]string{
+		"a.go": `package instrument
+
+type Store struct{}
+
+// Get gets.
+func (s *Store) Get(key string, _ int) string {
+	return key
+}
+
+func Put(key, value string) {}
+
+func helper() {}
+`,
+	})
+	p := m.Packages["instrument"]
+	cfg := &aster.InstrumentConfig{
+		Prologue: `log.Println("{{.Package}}.{{.Name}}", {{.ParamNames}})`,
+		Imports:  map[string]string{"log": ""},
+	}
+	n, err := p.Instrument(cfg)
+	if err != nil || n != 2 {
+		t.Fatalf("Instrument: %d %v", n, err)
+	}
+	// idempotent
+	if n, err = p.Instrument(cfg); err != nil || n != 0 {
+		t.Fatalf("Instrument again: %d %v", n, err)
+	}
+	want := `package instrument
+
+import "log"
+
+type Store struct{}
+
+// Get gets.
+func (s *Store) Get(key string, _ int) string {
+	log.Println("instrument.Store.Get", key)
+	return key
+}
+
+func Put(key, value string) {
+	log.Println("instrument.Put", key, value)
+}
+
+func helper() {}
+`
+	for _, f := range p.Files {
+		if got := string(f.Src); got != want {
+			t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+	if _, err = p.Instrument(&aster.InstrumentConfig{Prologue: "{{.Nope}}"}); err == nil {
+		t.Fatal("Instrument with an invalid template")
+	}
+}
+
+func TestOptimizeFieldOrder(t *testing.T) {
+	m := parseModule(t, "fieldalign", map[string]string{
+		"a.go": `package fieldalign
+
+import "time"
+
+// Padded wastes bytes.
+type Padded struct {
+	// A is a flag.
+	A bool ` + "`json:\"a\"`" + `
+	B int64 // the count
+	C bool
+	D [2]Inner
+}
+
+type Inner struct {
+	X int32
+	Y byte
+}
+
+type Packed struct {
+	At   time.Time
+	Flag bool
+}
+`,
+	})
+	p := m.Packages["fieldalign"]
+	reports, err := p.FieldAlignments("amd64")
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("FieldAlignments: %v %v", reports, err)
+	}
+	a := reports[0]
+	if a.Type != "Padded" || a.Size != 40 || a.OptimalSize != 32 || strings.Join(a.Optimal, ",") != "B,D,A,C" {
+		t.Fatalf("report: %s", a)
+	}
+	if r, err := p.FieldAlignments("386"); err != nil || len(r) != 1 || r[0].Size != 32 || r[0].Wasted() != 4 {
+		t.Fatalf("FieldAlignments(386): %v %v", r, err)
+	}
+	if _, err = p.FieldAlignments("nope"); err == nil {
+		t.Fatal("unknown GOARCH")
+	}
+	padded, _ := p.LookupType("Padded")
+	if _, err = padded.OptimizeFieldOrder("amd64"); err != nil {
+		t.Fatal(err)
+	}
+	want := `package fieldalign
+
+import "time"
+
+// Padded wastes bytes.
+type Padded struct {
+	B int64 // the count
+	D [2]Inner
+	// A is a flag.
+	A bool ` + "`json:\"a\"`" + `
+	C bool
+}
+`
+	for _, f := range p.Files {
+		if got := string(f.Src); !strings.HasPrefix(got, want) {
+			t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+	if reports, _ = p.FieldAlignments("amd64"); len(reports) != 0 {
+		t.Fatalf("after optimizing: %v", reports)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	m := parseModule(t, "layout", map[string]string{
+		"a.go": `package layout
+
+type T struct {
+	A    bool
+	B    int64
+	C    bool
+	Name string
+	Tags []string
+	_    struct{}
+}
+`,
+	})
+	typ, _ := m.Packages["layout"].LookupType("T")
+	l, err := typ.Layout("amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `T: size 72, align 8, padding 22 (arch amd64)
+	offset  size  align  padding  field
+	     0     1      1        7  A bool
+	     8     8      8        0  B int64
+	    16     1      1        7  C bool
+	    24    16      8        0  Name string
+	    40    24      8        0  Tags []string
+	    64     0      1        8  _ struct{}
+`
+	if got := l.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if l, err = typ.Layout("arm"); err != nil || l.Size != 40 || l.Fields[1].Offset != 4 {
+		t.Fatalf("Layout(arm): %v %v", l, err)
+	}
+}
+
+func TestRenamePackage(t *testing.T) {
+	m := parseModule(t, "renamepkg", map[string]string{
+		"go.mod": "module example.com/rp\n",
+		"a.go": `// Package rp says hello.
+package rp
+
+func Hello() string { return "hello" }
+`,
+		"a_test.go": `package rp_test
+
+import (
+	"testing"
+
+	"example.com/rp"
+)
+
+func TestHello(t *testing.T) { _ = rp.Hello() }
+`,
+	})
+	user := parseModule(t, "renamepkg_user", map[string]string{
+		"go.mod": "module example.com/user\n",
+		"u.go": `package user
+
+import (
+	"example.com/rp"
+	alias "example.com/rp"
+)
+
+var greet = rp.Hello()
+
+var hi = alias.Hello()
+`,
+	})
+	if err := m.RenamePackage("example.com/rp", "example.com/other", "greet"); err == nil {
+		t.Fatal("want error of the path out of the module")
+	}
+	for _, mod := range []*aster.Module{m, user} {
+		if err := mod.RenamePackage("example.com/rp", "example.com/rp/greet", "greet"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, ok := m.Packages["greet"]
+	if !ok || p.Path() != "example.com/rp/greet" || m.Packages["greet_test"] == nil || m.Packages["rp"] != nil {
+		t.Fatalf("packages: %v", m.Packages)
+	}
+	if err := m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.Store(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		t.Helper()
+		b, err := ioutil.ReadFile(filepath.Join("../_out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if _, err := os.Stat("../_out/renamepkg/a.go"); !os.IsNotExist(err) {
+		t.Fatalf("old file not deleted: %v", err)
+	}
+	if got := read("renamepkg/greet/a.go"); !strings.HasPrefix(got, "// Package greet says hello.\npackage greet\n") {
+		t.Fatalf("a.go:\n%s", got)
+	}
+	want := `package greet_test
+
+import (
+	"testing"
+
+	"example.com/rp/greet"
+)
+
+func TestHello(t *testing.T) { _ = greet.Hello() }
+`
+	if got := read("renamepkg/greet/a_test.go"); got != want {
+		t.Fatalf("a_test.go:\n%s", got)
+	}
+	want = `package user
+
+import (
+	alias "example.com/rp/greet"
+	rp "example.com/rp/greet"
+)
+
+var greet = rp.Hello()
+
+var hi = alias.Hello()
+`
+	if got := read("renamepkg_user/u.go"); got != want {
+		t.Fatalf("u.go:\n%s", got)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	root := "../_out/move"
+	os.RemoveAll(root)
+	for name, src := range map[string]string{
+		"go.mod": "module example.com/mv\n",
+		"src/a.go": `package src
+
+import "strings"
+
+// User is a user.
+type User struct {
+	Name string
+}
+
+// Upper returns the upper name.
+func (u *User) Upper() string { return strings.ToUpper(u.Name) }
+
+// NewUser returns a new user.
+func NewUser(name string) *User { return &User{Name: name} }
+`,
+		"src/b.go": `package src
+
+func Greet(u *User) string { return "hi " + u.Name + suffix() }
+
+func suffix() string { return "!" }
+`,
+		"src/a_test.go": `package src_test
+
+import (
+	"testing"
+
+	"example.com/mv/src"
+)
+
+func TestUpper(t *testing.T) {
+	var u src.User = *src.NewUser("x")
+	_ = u.Upper()
+}
+`,
+		"dst/d.go": `package dst
+
+func Hello() string { return "hello" }
+`,
+	} {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srcMod, err := aster.ParseDir(filepath.Join(root, "src"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstMod, err := aster.ParseDir(filepath.Join(root, "dst"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcPkg, dstPkg := srcMod.Packages["src"], dstMod.Packages["dst"]
+	b := srcPkg.Files[filepath.Join(root, "src/b.go")]
+	lookupFunc := func(name string) aster.Node {
+		t.Helper()
+		nodes := srcPkg.Fetch(func(n aster.Node) bool { return n.Kind() == aster.Func && n.Name() == name })
+		if len(nodes) != 1 {
+			t.Fatalf("func %s: %v", name, nodes)
+		}
+		return nodes[0]
+	}
+
+	// within the package
+	if err := lookupFunc("NewUser").MoveTo(b); err != nil {
+		t.Fatal(err)
+	}
+	if fn := lookupFunc("NewUser"); fn.Filename() != b.Filename {
+		t.Fatalf("NewUser not moved: %s", fn.Filename())
+	}
+
+	fn := lookupFunc("Greet")
+	if err := fn.MoveToPackage(dstPkg); err == nil || !strings.Contains(err.Error(), "suffix unexported") {
+		t.Fatalf("want error of the unexported reference, got %v", err)
+	}
+	user, _ := srcPkg.LookupType("User")
+	upper, _ := user.MethodByName("Upper")
+	if err := upper.MoveToPackage(dstPkg); err == nil {
+		t.Fatal("want error of moving a method")
+	}
+	if err := user.MoveToPackage(dstPkg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srcPkg.Files[filepath.Join(root, "src/a.go")]; ok {
+		t.Fatal("empty a.go not removed")
+	}
+	if err := srcMod.Store(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dstMod.Store(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"dst/a.go": `package dst
+
+import "strings"
+
+// User is a user.
+type User struct {
+	Name string
+}
+
+// Upper returns the upper name.
+func (u *User) Upper() string { return strings.ToUpper(u.Name) }
+`,
+		"src/b.go": `package src
+
+import "example.com/mv/dst"
+
+func Greet(u *dst.User) string { return "hi " + u.Name + suffix() }
+
+func suffix() string { return "!" }
+
+// NewUser returns a new user.
+func NewUser(name string) *dst.User { return &dst.User{Name: name} }
+`,
+		"src/a_test.go": `package src_test
+
+import (
+	"testing"
+
+	"example.com/mv/dst"
+	"example.com/mv/src"
+)
+
+func TestUpper(t *testing.T) {
+	var u dst.User = *src.NewUser("x")
+	_ = u.Upper()
+}
+`,
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s:\n%s", name, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "src/a.go")); !os.IsNotExist(err) {
+		t.Fatalf("a.go not deleted: %v", err)
+	}
+}
+
+func TestExtractFunction(t *testing.T) {
+	m := parseModule(t, "extractfunc", map[string]string{
+		"a.go": `package extractfunc
+
+import "strings"
+
+type Counter struct{ n int }
+
+func (c *Counter) Inc() { c.n++ }
+
+// Process joins the non-empty items.
+func Process(items []string, sep string) (string, int) {
+	total := 0
+	var parts []string
+	var c Counter
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		parts = append(parts, strings.ToUpper(item))
+		total += len(item)
+	}
+	c.Inc()
+	joined := strings.Join(parts, sep)
+	return joined, total + c.n
+}
+`,
+	})
+	var fn aster.FuncNode
+	for _, f := range m.Packages["extractfunc"].Files {
+		for _, n := range f.Nodes {
+			if n.Name() == "Process" {
+				fn = n.(aster.FuncNode)
+			}
+		}
+	}
+	if err := fn.ExtractFunction(6, 7, "finish"); err == nil || !strings.Contains(err.Error(), "return statement") {
+		t.Fatalf("want error of the return statement, got %v", err)
+	}
+	if err := fn.ExtractFunction(3, 5, "Process"); err == nil {
+		t.Fatal("want error of the name taken")
+	}
+	if err := fn.ExtractFunction(3, 5, "collect"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fn.ExtractFunction(4, 5, "join"); err != nil {
+		t.Fatal(err)
+	}
+	want := `// Process joins the non-empty items.
+func Process(items []string, sep string) (string, int) {
+	total := 0
+	var parts []string
+	var c Counter
+	total, parts, c = collect(items, total, parts, c)
+	joined := join(sep, parts)
+	return joined, total + c.n
+}`
+	if got := fn.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	code, err := m.Packages["extractfunc"].Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range code {
+		for _, want := range []string{`
+func join(sep string, parts []string) string {
+	joined := strings.Join(parts, sep)
+	return joined
+}
+`, `
+func collect(items []string, total int, parts []string, c Counter) (int, []string, Counter) {
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		parts = append(parts, strings.ToUpper(item))
+		total += len(item)
+	}
+	c.Inc()
+	return total, parts, c
+}
+`} {
+			if !strings.Contains(src, want) {
+				t.Fatalf("want:\n%s\ngot:\n%s", want, src)
+			}
+		}
+	}
+}
+
+func TestInlineFunction(t *testing.T) {
+	m := parseModule(t, "inlinefunc", map[string]string{
+		"a.go": `package inlinefunc
+
+import "strings"
+
+type Point struct{ X, Y int }
+
+func (p *Point) Sum() int { return p.X + p.Y }
+
+func double(x int) int { return x * 2 }
+
+func fact(n int) int { return n * fact(n-1) }
+
+func shout(s string) string {
+	n := len(s)
+	s = strings.ToUpper(s)
+	return s + strings.Repeat("!", n)
+}
+
+func Use(p Point, v int, name string) (int, string) {
+	n := double(v+1) + p.Sum()
+	msg := shout(name)
+	return n, msg
+}
+`,
+	})
+	lookup := func(name string) aster.FuncNode {
+		for _, f := range m.Packages["inlinefunc"].Files {
+			for _, n := range f.Nodes {
+				if n.Name() == name {
+					return n.(aster.FuncNode)
+				}
+			}
+		}
+		t.Fatalf("%s not found", name)
+		return nil
+	}
+	if _, err := lookup("fact").Inline(); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Fatalf("want error of the recursive function, got %v", err)
+	}
+	for _, c := range []struct {
+		name  string
+		count int
+	}{{"double", 1}, {"Sum", 1}, {"shout", 1}} {
+		count, err := lookup(c.name).Inline(c.name == "double")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != c.count {
+			t.Fatalf("%s: got %d calls inlined, want %d", c.name, count, c.count)
+		}
+	}
+	want := `func Use(p Point, v int, name string) (int, string) {
+	n := (v+1)*2 + (p.X + p.Y)
+	s := name
+	n1 := len(s)
+	s = strings.ToUpper(s)
+	msg := s + strings.Repeat("!", n1)
+	return n, msg
+}`
+	if got := lookup("Use").String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	code, err := m.Packages["inlinefunc"].Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range code {
+		if strings.Contains(s, "func double") {
+			t.Fatal("want double removed")
+		}
+		if !strings.Contains(s, "func shout") {
+			t.Fatal("want shout kept")
+		}
+	}
+}
+
+func TestChangeSignature(t *testing.T) {
+	m := parseModule(t, "changesig", map[string]string{
+		"a.go": `package changesig
+
+import "fmt"
+
+type Store struct{}
+
+func (s *Store) Get(key string, n int) (string, error) {
+	return fmt.Sprint(key, n), nil
+}
+
+func Sum(a, b int, rest ...int) int {
+	for _, r := range rest {
+		a += r
+	}
+	return a + b
+}
+`,
+		"b.go": `package changesig
+
+import "fmt"
+
+func Use(s *Store) {
+	v, err := s.Get("k", Sum(1, Sum(2, 3)))
+	fmt.Println(v, err, Sum(1, 2, 3, 4))
+}
+`,
+		"c.go": `package changesig
+
+import "fmt"
+
+func G() (int, error) { return 0, nil }
+
+func H() (int, error) { return 0, nil }
+
+func F(a, b int) {}
+
+func tick() int { return 1 }
+
+func UseG() {
+	y, err := G()
+	fmt.Println(y, err)
+	if v, err := H(); err == nil {
+		fmt.Println(v)
+	}
+	_, err = H()
+	F(1, tick())
+	F(2, 3)
+}
+`,
+	})
+	lookup := func(name string) aster.FuncNode {
+		for _, f := range m.Packages["changesig"].Files {
+			for _, n := range f.Nodes {
+				if n.Name() == name {
+					return n.(aster.FuncNode)
+				}
+			}
+		}
+		t.Fatalf("%s not found", name)
+		return nil
+	}
+	if err := lookup("Sum").ChangeSignature([]aster.SigParam{aster.KeepParam(1), aster.KeepParam(2)}, nil); err == nil || !strings.Contains(err.Error(), "used") {
+		t.Fatalf("want error of the removed parameter used, got %v", err)
+	}
+	for name, want := range map[string]string{"G": "used: y", "H": "used: v"} {
+		if err := lookup(name).ChangeSignature(nil, []aster.SigParam{aster.KeepParam(1)}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: want error of the dropped result used, got %v", name, err)
+		}
+	}
+	if err := lookup("F").ChangeSignature([]aster.SigParam{aster.KeepParam(0)}, nil); err == nil || !strings.Contains(err.Error(), "side effects") {
+		t.Fatalf("want error of the removed argument with side effects, got %v", err)
+	}
+	if err := lookup("Sum").ChangeSignature([]aster.SigParam{aster.KeepParam(1), aster.KeepParam(0), aster.KeepParam(2)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := lookup("Get").ChangeSignature(
+		[]aster.SigParam{aster.NewParam("ctx", "context.Context", "context.TODO()"), aster.KeepParam(0), aster.KeepParam(1)},
+		[]aster.SigParam{aster.KeepParam(1), aster.KeepParam(0)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := m.Packages["changesig"].Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code string
+	for _, name := range []string{"a.go", "b.go"} {
+		code += codes[filepath.Join("../_out/changesig", name)]
+	}
+	for _, want := range []string{`import (
+	"context"
+	"fmt"
+)`, `func (s *Store) Get(ctx context.Context, key string, n int) (error, string) {
+	return nil, fmt.Sprint(key, n)
+}`, `func Sum(b, a int, rest ...int) int {`, `	err, v := s.Get(context.TODO(), "k", Sum(Sum(3, 2), 1))
+	fmt.Println(v, err, Sum(2, 1, 3, 4))`} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("want:\n%s\ngot:\n%s", want, code)
+		}
+	}
+}
+
+func TestUnderlying(t *testing.T) {
+	m := parseModule(t, "underlying", map[string]string{
+		"a.go": `package underlying
+
+import "time"
+
+type UserID int64
+
+type OrderID UserID
+
+type Ref = OrderID
+
+type Timeout time.Duration
+
+type Deadline Timeout
+
+type Items []string
+
+type List Items
+
+type A B
+
+type B A
+`,
+	})
+	f := m.Packages["underlying"].Files[filepath.Join("../_out/underlying", "a.go")]
+	for name, want := range map[string]aster.Kind{
+		"UserID":   aster.Int64,
+		"OrderID":  aster.Int64,
+		"Ref":      aster.Int64,
+		"Timeout":  aster.Int64,
+		"Deadline": aster.Int64,
+		"List":     aster.Slice,
+		"A":        aster.Suspense,
+	} {
+		typ, ok := f.LookupTypeInMod(name)
+		if !ok {
+			t.Fatalf("%s not found", name)
+		}
+		if got := typ.Underlying(); got != want {
+			t.Fatalf("%s: got %s, want %s", name, got, want)
+		}
+	}
+	for name, want := range map[string]string{
+		"UserID":  "UserID",
+		"OrderID": "UserID",
+		"Ref":     "UserID",
+		"List":    "Items",
+		"Items":   "Items",
+	} {
+		typ, _ := f.LookupTypeInMod(name)
+		got, ok := typ.ResolveNamed()
+		if !ok || got.Name() != want {
+			t.Fatalf("%s: got %v %v, want %s", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"Timeout", "Deadline", "A"} {
+		typ, _ := f.LookupTypeInMod(name)
+		if _, ok := typ.ResolveNamed(); ok {
+			t.Fatalf("%s: want unresolved", name)
+		}
+	}
+}
+
+func TestImplementations(t *testing.T) {
+	m := parseModule(t, "impls", map[string]string{
+		"a.go": `package impls
+
+type Handler interface{ Serve() }
+
+type Named interface{ Name() string }
+
+type Any interface{}
+
+type B struct{}
+
+func (B) Serve() {}
+
+type A struct{}
+
+func (*A) Serve() {}
+
+func (*A) Name() string { return "a" }
+`,
+		"b.go": `package impls
+
+type C int
+
+func (C) Name() int { return 0 }
+
+type NamedHandler interface {
+	Handler
+	Named
+}
+`,
+	})
+	lookup := func(name string) aster.TypeNode {
+		for _, f := range m.Packages["impls"].Files {
+			if t, ok := f.LookupTypeInMod(name); ok {
+				return t
+			}
+		}
+		t.Fatalf("%s not found", name)
+		return nil
+	}
+	names := func(types []aster.TypeNode) string {
+		var s []string
+		for _, t := range types {
+			s = append(s, t.Name())
+		}
+		return strings.Join(s, ",")
+	}
+	for iface, want := range map[string]string{
+		"Handler":      "A,B",
+		"Named":        "A",
+		"NamedHandler": "A",
+		"Any":          "",
+	} {
+		if got := names(m.Implementations(lookup(iface))); got != want {
+			t.Fatalf("Implementations(%s): got %q, want %q", iface, got, want)
+		}
+	}
+	for typ, want := range map[string]string{
+		"A":       "Handler,Named,NamedHandler",
+		"B":       "Handler",
+		"C":       "",
+		"Handler": "",
+	} {
+		if got := names(lookup(typ).Interfaces()); got != want {
+			t.Fatalf("%s.Interfaces(): got %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestAPISurface(t *testing.T) {
+	src := `package apisurface
+
+import "context"
+
+// Version is the version.
+const Version = "1.0"
+
+var DefaultClient = New("")
+
+type Client struct {
+	Base
+	Addr    string
+	Timeout int
+	secret  string
+}
+
+type Base struct{}
+
+type Doer interface {
+	Do(ctx context.Context, n int) error
+}
+
+type ID int64
+
+func New(addr string) *Client { return &Client{Addr: addr} }
+
+func (c *Client) Do(ctx context.Context, n int) error { return nil }
+
+func (c Client) Name() string { return c.Addr }
+
+func helper() {}
+`
+	m := parseModule(t, "apisurface", map[string]string{"a.go": src})
+	old := m.Packages["apisurface"].APISurface()
+	want := `type Base struct
+type Client struct
+field Client.Addr string
+embedded Client.Base Base
+method (*Client).Do func(context.Context, int) error
+method (Client).Name func() string
+field Client.Timeout int
+var DefaultClient *Client
+type Doer interface
+method Doer.Do func(context.Context, int) error
+type ID int64
+func New func(string) *Client
+const Version untyped string
+`
+	if got := old.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	src = strings.NewReplacer(
+		"type ID int64", "type ID string",
+		"Timeout int\n", "Timeout int\n\tRetries int\n",
+		"Do(ctx context.Context, n int) error\n", "Do(ctx context.Context, n int) error\n\tClose() error\n",
+		"func (c Client) Name()", "func (c *Client) Name()",
+		"func New(addr string) *Client { return &Client{Addr: addr} }\n", "",
+		"var DefaultClient = New(\"\")", "var DefaultClient = &Client{}",
+	).Replace(src)
+	m = parseModule(t, "apisurface", map[string]string{"a.go": src})
+	var got []string
+	for _, c := range aster.CompareAPISurfaces(old, m.Packages["apisurface"].APISurface()) {
+		got = append(got, c.String())
+	}
+	wantChanges := []string{
+		"breaking: changed method (*Client).Name func() string, was method (Client).Name func() string",
+		"compatible: added field Client.Retries int",
+		"breaking: added method Doer.Close func() error",
+		"breaking: changed type ID string, was type ID int64",
+		"breaking: removed func New func(string) *Client",
+	}
+	if strings.Join(got, "\n") != strings.Join(wantChanges, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(wantChanges, "\n"))
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	m := parseModule(t, "deprecated", map[string]string{
+		"a.go": `package deprecated
+
+// Old returns one.
+//
+// Deprecated: Use New
+// instead.
+func Old() int { return 1 }
+
+// New returns one.
+func New() int { return 1 }
+
+type (
+	A int
+	B int
+)
+
+func Use() int { return Old() + int(A(0)) + New() }
+`,
+	})
+	file := m.Packages["deprecated"].Files[filepath.Join("../_out/deprecated", "a.go")]
+	lookup := func(name string) aster.Node {
+		for _, n := range file.Nodes {
+			if n.Name() == name {
+				return n
+			}
+		}
+		t.Fatalf("%s not found", name)
+		return nil
+	}
+	if reason, ok := lookup("Old").Deprecated(); !ok || reason != "Use New instead." {
+		t.Fatalf("got %q %v", reason, ok)
+	}
+	if _, ok := lookup("New").Deprecated(); ok {
+		t.Fatal("want New not deprecated")
+	}
+	var got []string
+	for _, u := range m.DeprecatedUsages() {
+		got = append(got, u.String())
+	}
+	if want := "a.go:17:25: Old is deprecated: Use New instead."; len(got) != 1 || !strings.HasSuffix(got[0], want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for _, c := range []struct{ name, reason string }{
+		{"A", "Use B."},
+		{"A", "Use B\ninstead."},
+		{"New", "Use Use instead."},
+	} {
+		if err := lookup(c.name).SetDeprecated(c.reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{`// New returns one.
+//
+// Deprecated: Use Use instead.
+func New() int { return 1 }`, `type (
+	// Deprecated: Use B
+	// instead.
+	A int
+	B int
+)`} {
+		if !strings.Contains(string(file.Src), want) {
+			t.Fatalf("want:\n%s\ngot:\n%s", want, file.Src)
+		}
+	}
+	if n := len(m.DeprecatedUsages()); n != 3 {
+		t.Fatalf("got %d usages, want 3", n)
+	}
+}
+
+func TestParseFragments(t *testing.T) {
+	m := parseModule(t, "fragment", map[string]string{
+		"a.go": "package fragment\n\nfunc F() {}\n",
+	})
+	f := m.Packages["fragment"].Files[filepath.Join("../_out/fragment", "a.go")]
+	expr, err := f.ParseExpr("a + b*2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := expr.(*ast.BinaryExpr); !ok {
+		t.Fatalf("got %T, want *ast.BinaryExpr", expr)
+	}
+	stmt, err := f.ParseStmt("if ok {\n\treturn\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := stmt.(*ast.IfStmt).Body.List[0]
+	decl, err := f.ParseDecl("// G is g.\nfunc G() int {\n\treturn 1\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		node      ast.Node
+		line, col int
+		code      string
+	}{
+		{expr, 1, 1, "a + b*2"},
+		{ret, 2, 2, "return"},
+		{decl, 2, 1, "// G is g.\nfunc G() int {\n\treturn 1\n}"},
+	} {
+		pos := f.FileSet.Position(c.node.Pos())
+		if pos.Line != c.line || pos.Column != c.col {
+			t.Fatalf("%s: got position %d:%d, want %d:%d", c.code, pos.Line, pos.Column, c.line, c.col)
+		}
+		if code, err := f.FormatNode(c.node); err != nil || code != c.code {
+			t.Fatalf("got %q %v, want %q", code, err, c.code)
+		}
+	}
+	if _, err = f.ParseStmt("a()\nb()"); err == nil {
+		t.Fatal("want error of 2 statements")
+	}
+	if _, err = f.ParseExpr("a +"); err == nil {
+		t.Fatal("want error of the invalid expression")
+	}
+}
+
+func TestNewFileAndPackage(t *testing.T) {
+	m := parseModule(t, "newfile", map[string]string{
+		"a.go": "package newfile\n\nfunc A() {}\n",
+	})
+	p := m.Packages["newfile"]
+	f, err := p.NewFile("b_gen.go", "// Code generated by test. DO NOT EDIT.\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Code generated by test. DO NOT EDIT.\n\npackage newfile\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n"
+	if code, err := f.Format(); err != nil || code != want {
+		t.Fatalf("got %q %v, want %q", code, err, want)
+	}
+	if _, err = p.NewFile("a.go", ""); err == nil {
+		t.Fatal("want error of the file existing")
+	}
+	if _, err = m.NewPackage("", "other"); err == nil {
+		t.Fatal("want error of the directory having another package")
+	}
+	sub, err := m.NewPackage("sub", "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sub.NewFile("sub.go", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewPackage("sub2", "sub"); err == nil {
+		t.Fatal("want error of the package name taken")
+	}
+	if err = m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"b_gen.go":   want,
+		"sub/sub.go": "package sub\n",
+	} {
+		b, err := os.ReadFile(filepath.Join("../_out/newfile", name))
+		if err != nil || string(b) != want {
+			t.Fatalf("%s: got %q %v, want %q", name, b, err, want)
+		}
+	}
+}
+
+func TestRemovePackage(t *testing.T) {
+	m := parseModule(t, "removepkg", map[string]string{
+		"a.go":      "package removepkg\n",
+		"a_test.go": "package removepkg_test\n",
+		"b_gen.go":  "package removepkg\n",
+	})
+	if !m.Packages["removepkg"].RemoveFile(filepath.Join("../_out/removepkg", "b_gen.go")) {
+		t.Fatal("want b_gen.go removed")
+	}
+	if m.RemovePackage("none") {
+		t.Fatal("want no package removed")
+	}
+	if !m.RemovePackage("removepkg_test") {
+		t.Fatal("want removepkg_test removed")
+	}
+	if _, ok := m.Packages["removepkg_test"]; ok {
+		t.Fatal("want removepkg_test unregistered")
+	}
+	diff, err := m.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-package removepkg_test", "-package removepkg\n"} {
+		if !strings.Contains(diff, want) {
+			t.Fatalf("want %q in the diff:\n%s", want, diff)
+		}
+	}
+
+	// the removed packages are kept by the encoding
+	var buf strings.Builder
+	if err = m.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err = aster.DecodeModule(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := m.NewPackage("sub", "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sub.NewFile("sub.go", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.RemovePackage("sub") {
+		t.Fatal("want sub removed")
+	}
+	if err = m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a_test.go", "b_gen.go", "sub"} {
+		if _, err := os.Stat(filepath.Join("../_out/removepkg", name)); !os.IsNotExist(err) {
+			t.Fatalf("want %s deleted, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join("../_out/removepkg", "a.go")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportPath(t *testing.T) {
+	m := parseModule(t, "importpath", map[string]string{
+		"go.mod":      "module example.com/importpath\n\ngo 1.18\n",
+		"a.go":        "package importpath\n",
+		"a_x_test.go": "package importpath_test\n",
+	})
+	p := m.Packages["importpath"]
+	if path, ok := p.ImportPath(); !ok || path != "example.com/importpath" {
+		t.Fatalf("import path: %s %v", path, ok)
+	}
+	if path, ok := m.Packages["importpath_test"].ImportPath(); !ok || path != "example.com/importpath" {
+		t.Fatalf("test import path: %s %v", path, ok)
+	}
+	sub, err := m.NewPackage("internal/sub", "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sub.NewFile("sub.go", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := f.ImportPath(); !ok || path != "example.com/importpath/internal/sub" {
+		t.Fatalf("file import path: %s %v", path, ok)
+	}
+}
+
+func TestModFile(t *testing.T) {
+	m := parseModule(t, "modfile", map[string]string{
+		"go.mod": "module example.com/modfile\n\ngo 1.18\n\nrequire (\n\tgithub.com/a/a v1.0.0\n\tgithub.com/b/b v1.2.0 // indirect\n)\n",
+		"a.go":   "package modfile\n",
+	})
+	mf := m.ModFile
+	if mf == nil || mf.Path != "example.com/modfile" || mf.Go != "1.18" || len(mf.Require) != 2 {
+		t.Fatalf("mod file: %+v", mf)
+	}
+	if r, ok := mf.LookupRequire("github.com/b/b"); !ok || r.Version != "v1.2.0" || !r.Indirect {
+		t.Fatalf("require: %+v", r)
+	}
+	if err := m.AddRequire("github.com/c/c", "v0.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRequire("github.com/b/b", "v1.3.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRequire("github.com/d/d", "latest"); err == nil {
+		t.Fatal("want error of the invalid version")
+	}
+	if d, err := m.Diff(); err != nil || !strings.Contains(d, "+\tgithub.com/c/c v0.1.0\n") {
+		t.Fatalf("diff: %s %v", d, err)
+	}
+	if err := m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	want := "module example.com/modfile\n\ngo 1.18\n\nrequire (\n\tgithub.com/a/a v1.0.0\n\tgithub.com/b/b v1.3.0\n\tgithub.com/c/c v0.1.0\n)\n"
+	if b, err := ioutil.ReadFile(mf.Filename); err != nil || string(b) != want {
+		t.Fatalf("go.mod: %q %v", b, err)
+	}
+	if err := m.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := m.ModFile.LookupRequire("github.com/c/c"); !ok || r.Version != "v0.1.0" || r.Indirect {
+		t.Fatalf("reparsed require: %+v", r)
+	}
+
+	m = parseModule(t, "modfile_single", map[string]string{
+		"go.mod": "module example.com/single\n\ngo 1.18\n\nrequire github.com/a/a v1.0.0 // indirect\n",
+		"a.go":   "package single\n",
+	})
+	if err := m.AddRequire("github.com/a/a", "v1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRequire("github.com/b/b", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	want = "module example.com/single\n\ngo 1.18\n\nrequire github.com/a/a v1.1.0\n\nrequire github.com/b/b v1.0.0\n"
+	if b := string(m.ModFile.Bytes()); b != want {
+		t.Fatalf("go.mod: %q", b)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := parseModule(t, "snapshot", map[string]string{
+		"a.go": "package snapshot\n\ntype Shape interface{ Area() float64 }\n\ntype Square struct{ Side float64 }\n\nfunc (s Square) Area() float64 { return s.Side * s.Side }\n",
+		"b.go": "package snapshot\n\ntype Circle struct{ R float64 }\n\nfunc (c Circle) Area() float64 { return 3 * c.R * c.R }\n",
+	})
+	p := m.Packages["snapshot"]
+	if err := p.Rename("Square", "Rect"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := s.Packages["snapshot"]
+	if sp == p || len(sp.Files) != 2 {
+		t.Fatalf("snapshot package: %v", sp.Files)
+	}
+	if _, ok := sp.LookupType("Rect"); !ok {
+		t.Fatal("snapshot lost the edit")
+	}
+	shape, _ := sp.LookupType("Shape")
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if impls := s.Implementations(shape); len(impls) != 2 {
+				errs <- fmt.Sprintf("implementations: %v", impls)
+			}
+			if codes, err := sp.Format(); err != nil || len(codes) != 2 {
+				errs <- fmt.Sprintf("codes: %d %v", len(codes), err)
+			}
+		}()
+	}
+	p.RemoveFile(filepath.Join("../_out/snapshot", "b.go"))
+	if _, err := p.NewFile("c.go", ""); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+	if _, ok := sp.Files[filepath.Join("../_out/snapshot", "b.go")]; !ok {
+		t.Fatal("snapshot changed by the module")
+	}
+}
+
+func TestReloadFile(t *testing.T) {
+	m := parseModule(t, "reload", map[string]string{
+		"a.go": "package reload\n\ntype T struct{}\n",
+		"b.go": "package reload\n\nfunc (T) A() {}\n",
+	})
+	p := m.Packages["reload"]
+	dir := "../_out/reload"
+	write := func(name, src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	numMethod := func() int {
+		typ, _ := p.LookupType("T")
+		return typ.NumMethod()
+	}
+	write("b.go", "package reload\n\nimport \"fmt\"\n\nfunc (T) A() {}\n\nfunc (T) B() { fmt.Println() }\n")
+	f, err := p.ReloadFile("b.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numMethod() != 2 || len(f.Imports) != 1 || f != p.Files[filepath.Join(dir, "b.go")] {
+		t.Fatalf("methods: %d, imports: %v", numMethod(), f.Imports)
+	}
+
+	write("b.go", "package reload\n\nfunc (T) A( {}\n")
+	if err = f.Reload(); err == nil {
+		t.Fatal("want syntax error")
+	}
+	write("b.go", "package other\n")
+	if err = f.Reload(); err == nil || !strings.Contains(err.Error(), "package other") {
+		t.Fatalf("want package error: %v", err)
+	}
+	if numMethod() != 2 || !strings.Contains(string(f.Src), "B()") {
+		t.Fatalf("changed on errors: %d methods\n%s", numMethod(), f.Src)
+	}
+
+	write("c.go", "package reload\n\nfunc (T) C() {}\n")
+	if f, err = p.ReloadFile("c.go"); err != nil || f == nil || numMethod() != 3 {
+		t.Fatalf("added: %v %v, methods: %d", f, err, numMethod())
+	}
+	if err = os.Remove(filepath.Join(dir, "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = p.ReloadFile(filepath.Join(dir, "c.go")); err != nil || f != nil || len(p.Files) != 2 || numMethod() != 2 {
+		t.Fatalf("dropped: %v %v, files: %d", f, err, len(p.Files))
+	}
+
+	m.SetOverlay(map[string][]byte{filepath.Join(dir, "a.go"): []byte("package reload\n\ntype T int\n")})
+	if err = p.Files[filepath.Join(dir, "a.go")].Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if typ, _ := p.LookupType("T"); typ.Kind() == aster.Struct {
+		t.Fatal("overlay not reloaded")
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	m := parseModule(t, "routes", map[string]string{
+		"http.go": `package routes
+
+import "net/http"
+
+const apiPrefix = "/api"
+
+type UserHandler struct{}
+
+func (h *UserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func health(w http.ResponseWriter, r *http.Request) {}
+
+func serveHTTP() {
+	http.HandleFunc("/health", health)
+	mux := http.NewServeMux()
+	mux.Handle("GET "+apiPrefix+"/users/{id}", &UserHandler{})
+}
+`,
+		"gin.go": `package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Server struct{}
+
+func (s *Server) listUsers(c *gin.Context) {}
+
+func createItem(c *gin.Context) {}
+
+func auth(c *gin.Context) {}
+
+func (s *Server) serveGin() {
+	r := gin.Default()
+	v1 := r.Group(apiPrefix).Group("/v1")
+	v1.GET("/users", auth, s.listUsers)
+	r.Handle(http.MethodPost, "/items", createItem)
+	r.Any("/any", func(c *gin.Context) {})
+}
+`,
+		"chi.go": `package routes
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func index(w http.ResponseWriter, r *http.Request) {}
+
+func serveChi() {
+	r := chi.NewRouter()
+	r.Route("/admin", func(r chi.Router) {
+		r.Get("/", index)
+		r.Method("DELETE", "/cache", http.HandlerFunc(index))
+	})
+}
+`,
+	})
+	var got []string
+	for _, r := range m.Routes() {
+		handler := "<nil>"
+		if r.Handler != nil {
+			handler = r.Handler.Name()
+		}
+		got = append(got, fmt.Sprintf("%s %s %s %s %s in %s", r.Router, r.Method, r.Path, handler, r.HandlerExpr, r.Func.Name()))
+	}
+	want := []string{
+		"chi GET /admin/ index index in serveChi",
+		"chi DELETE /admin/cache index http.HandlerFunc(index) in serveChi",
+		"gin  /any <nil> func(c *gin.Context) {} in serveGin",
+		"net/http GET /api/users/{id} ServeHTTP &UserHandler{} in serveHTTP",
+		"gin GET /api/v1/users listUsers s.listUsers in serveGin",
+		"net/http  /health health health in serveHTTP",
+		"gin POST /items createItem createItem in serveGin",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("routes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	m := parseModule(t, "client", map[string]string{
+		"a.go": `package client
+
+import (
+	"context"
+	"time"
+)
+
+type User struct{ Name string }
+
+type Users interface {
+	Get(ctx context.Context, id int64) (*User, error)
+	List(since time.Time, tags ...string) ([]*User, int, error)
+	Ping()
+	Count(c context.Context) (n int)
+}
+`,
+	})
+	users, _ := m.Packages["client"].LookupType("Users")
+	f, err := aster.GenerateClient(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := f.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by aster. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// UsersTransport sends the calls of the Users methods,
+// marshaling req and unmarshaling the response into resp.
+type UsersTransport interface {
+	Call(ctx context.Context, method string, req, resp interface{}) error
+}
+
+// UsersClient is the client of Users, calling the methods through the transport.
+type UsersClient struct {
+	Transport UsersTransport
+}
+
+// NewUsersClient returns the client calling the methods through the transport.
+func NewUsersClient(transport UsersTransport) *UsersClient {
+	return &UsersClient{Transport: transport}
+}
+
+var _ Users = (*UsersClient)(nil)
+
+// Get calls Users.Get through the transport.
+func (c *UsersClient) Get(ctx context.Context, id int64) (*User, error) {
+	req := struct {
+		Id int64 ` + "`json:\"id\"`" + `
+	}{id}
+	var resp struct {
+		R0 *User ` + "`json:\"r0\"`" + `
+	}
+	err := c.Transport.Call(ctx, "Users.Get", &req, &resp)
+	return resp.R0, err
+}
+
+// List calls Users.List through the transport.
+func (c *UsersClient) List(since time.Time, tags ...string) ([]*User, int, error) {
+	req := struct {
+		Since time.Time ` + "`json:\"since\"`" + `
+		Tags  []string  ` + "`json:\"tags\"`" + `
+	}{since, tags}
+	var resp struct {
+		R0 []*User ` + "`json:\"r0\"`" + `
+		R1 int     ` + "`json:\"r1\"`" + `
+	}
+	err := c.Transport.Call(context.Background(), "Users.List", &req, &resp)
+	return resp.R0, resp.R1, err
+}
+
+// Ping calls Users.Ping through the transport.
+func (c *UsersClient) Ping() {
+	req := struct{}{}
+	var resp struct{}
+	if err := c.Transport.Call(context.Background(), "Users.Ping", &req, &resp); err != nil {
+		panic(err)
+	}
+}
+
+// Count calls Users.Count through the transport.
+func (c *UsersClient) Count(a0 context.Context) int {
+	req := struct{}{}
+	var resp struct {
+		N int ` + "`json:\"n\"`" + `
+	}
+	if err := c.Transport.Call(a0, "Users.Count", &req, &resp); err != nil {
+		panic(err)
+	}
+	return resp.N
+}
+`
+	if code != want {
+		t.Fatalf("client:\n%s", code)
+	}
+	if m.Packages["client"].Files[f.Filename] != f {
+		t.Fatal("client file not added to the package")
+	}
+	if failure := f.Verify(); failure != nil {
+		t.Fatal(failure)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	parseModule(t, "overlay", map[string]string{
+		"a.go":   "package overlay\nfunc A() {}\n",
+		"go.mod": "module example.com/disk\n",
+	})
+	dir := "../_out/overlay"
+	overlay := map[string][]byte{
+		filepath.Join(dir, "a.go"):   []byte("package overlay\nfunc Unsaved() {}\n"),
+		filepath.Join(dir, "new.go"): []byte("package overlay\nfunc New() {}\n"),
+		filepath.Join(dir, "go.mod"): []byte("module example.com/overlay\n"),
+	}
+	m, err := aster.ParseDirWith(dir, &aster.ParseConfig{Overlay: overlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := m.Packages["overlay"]
+	if len(p.Files) != 2 {
+		t.Fatalf("files: %v", p.Files)
+	}
+	for _, name := range []string{"Unsaved", "New"} {
+		if fn := p.Fetch(func(n aster.Node) bool { return n.Name() == name }); len(fn) != 1 {
+			t.Fatalf("%s not found", name)
+		}
+	}
+	if p.Path() != "example.com/overlay" {
+		t.Fatalf("path: %s", p.Path())
+	}
+	// a broken buffer fails the loading, as a broken file
+	overlay[filepath.Join(dir, "a.go")] = []byte("package overlay\nfunc (\n")
+	m.SetOverlay(overlay)
+	if err = m.Reparse(); err == nil {
+		t.Fatal("want parse error")
+	}
+	m.SetOverlay(nil)
+	if err = m.Reparse(); err != nil || len(m.Packages["overlay"].Files) != 1 {
+		t.Fatalf("reparsed from disk: %v", err)
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	parseModule(t, "allerrors", nil)
+	for name, src := range map[string]string{
+		"a.go": "package allerrors\nfunc A() {}\n",
+		"b.go": "package allerrors\nfunc B( {}\n",
+		"c.go": "package allerrors\nvar C = \n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join("../_out/allerrors", name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := aster.ParseDir("../_out/allerrors", nil); err == nil {
+		t.Fatal("want parse error")
+	}
+	m, err := aster.ParseDirAll("../_out/allerrors", nil)
+	errs, ok := err.(aster.Errors)
+	if !ok || len(errs) < 2 || !strings.HasSuffix(errs[0].Filename, "b.go") ||
+		!strings.HasSuffix(errs[len(errs)-1].Filename, "c.go") || errs[0].Pos.Line != 2 {
+		t.Fatalf("errors: %#v", err)
+	}
+	p := m.Packages["allerrors"]
+	if len(p.Files) != 1 {
+		t.Fatalf("files: %v", p.Files)
+	}
+	if err = m.Reparse(); err == nil || len(m.Packages["allerrors"].Files) != 1 {
+		t.Fatalf("reparsed: %v", err)
+	}
+
+	p = m.Packages["allerrors"]
+	d, _ := aster.ParseFile("../_out/allerrors/d.go", "package allerrors\nfunc D() {}\n")
+	p.Files[d.Filename] = d
+	opts := &aster.FormatOptions{Formatters: []aster.Formatter{
+		func(filename string, src []byte) ([]byte, error) {
+			if filename == d.Filename {
+				return nil, fmt.Errorf("broken")
+			}
+			return src, nil
+		},
+	}}
+	if _, err = m.Format(opts); err == nil {
+		t.Fatal("want format error")
+	}
+	opts.ContinueOnError = true
+	codes, err := m.Format(opts)
+	if errs, ok := err.(aster.Errors); !ok || len(errs) != 1 || errs[0].Filename != d.Filename {
+		t.Fatalf("errors: %v", err)
+	}
+	if len(codes["allerrors"]) != 1 {
+		t.Fatalf("codes: %v", codes)
+	}
+}
+
+func TestErrorSnippet(t *testing.T) {
+	_, err := aster.ParseFile("snippet.go", "package snippet\n\nfunc B(\t{}\n")
+	errs, ok := err.(aster.Errors)
+	if !ok || len(errs) == 0 || errs[0].Line != "func B(\t{}" {
+		t.Fatalf("errors: %#v", err)
+	}
+	want := errs[0].Error() + "\n\tfunc B(\t{}\n\t       \t^"
+	if s := errs[0].Snippet(false); s != want {
+		t.Fatalf("snippet: %q, want %q", s, want)
+	}
+	if s := errs.Snippet(true); !strings.HasPrefix(s, "\x1b[1m"+errs[0].Error()) || !strings.Contains(s, "\x1b[1;31m^\x1b[0m") {
+		t.Fatalf("colored snippet: %q", s)
+	}
+
+	f, err := aster.ParseFile("snippet.go", "package snippet\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Format(&aster.FormatOptions{Formatters: []aster.Formatter{
+		func(filename string, src []byte) ([]byte, error) {
+			return nil, fmt.Errorf("broken")
+		},
+	}})
+	if errs, ok := err.(aster.Errors); !ok || len(errs) != 1 || errs[0].Filename != "snippet.go" || errs[0].Snippet(false) != "snippet.go: broken" {
+		t.Fatalf("format errors: %#v", err)
+	}
+}
+
+func TestStoreWith(t *testing.T) {
+	mod := parseModule(t, "storewith", map[string]string{
+		"a.go": "package storewith\nfunc A() {}\n",
+		"b.go": "package storewith\nfunc B() {}\n",
+	})
+	var hooked []string
+	r, err := mod.StoreWith(&aster.StoreConfig{
+		FileHooks: []*aster.StoreHook{{
+			Func: func(files []string) error {
+				hooked = append(hooked, files...)
+				return nil
+			},
+		}},
+		RunHooks: []*aster.StoreHook{
+			{Command: []string{"go", "vet", aster.HookFiles}},
+			{Name: "fail", Command: []string{"go", "tool", "nonexistent"}},
+			{Name: "skipped", Command: []string{"go", "version"}},
+		},
+	})
+	if err == nil {
+		t.Fatal("want the error of the failed hook")
+	}
+	if len(r.Files) != 2 || len(hooked) != 2 {
+		t.Fatalf("files: %v, hooked: %v", r.Files, hooked)
+	}
+	if len(r.Hooks) != 4 {
+		t.Fatalf("hooks: %d", len(r.Hooks))
+	}
+	if r.Hooks[2].Err != nil {
+		t.Fatalf("go vet: %s\n%s", r.Hooks[2].Err, r.Hooks[2].Output)
+	}
+	if failed := r.Failed(); len(failed) != 1 || failed[0].Hook != "fail" {
+		t.Fatalf("failed: %v", failed)
+	}
+}
+
+func TestStoreWithFS(t *testing.T) {
+	mod := parseModule(t, "storefs", map[string]string{
+		"a.go": "package storefs\nfunc A() {}\n",
+		"b.go": "package storefs\nfunc B() {}\n",
+	})
+	p := mod.Packages["storefs"]
+	a, _ := filepath.Abs("../_out/storefs/a.go")
+	b, _ := filepath.Abs("../_out/storefs/b.go")
+	if !p.RemoveFile(filepath.Join("../_out/storefs", "b.go")) {
+		t.Fatal("b.go not removed")
+	}
+	fsys := aster.MapFS{b: []byte("stale")}
+	r, err := mod.StoreWith(&aster.StoreConfig{FS: fsys})
+	if err != nil || len(r.Files) != 1 {
+		t.Fatalf("files: %v, %v", r, err)
+	}
+	if names := fsys.Names(); len(names) != 1 || names[0] != a || string(fsys[a]) != "package storefs\n\nfunc A() {}\n" {
+		t.Fatalf("fs: %q", fsys)
+	}
+	// the local files are untouched
+	if src, err := ioutil.ReadFile(b); err != nil || string(src) != "package storefs\nfunc B() {}\n" {
+		t.Fatalf("b.go: %q, %v", src, err)
+	}
+
+	var written []string
+	_, err = p.StoreWith(&aster.StoreConfig{FS: aster.WriteFileFunc(func(name string, data []byte) error {
+		written = append(written, name)
+		return nil
+	})})
+	if err != nil || len(written) != 1 || written[0] != a {
+		t.Fatalf("written: %v, %v", written, err)
+	}
+}
+
+func TestDocCoverage(t *testing.T) {
+	m := parseModule(t, "doccov", map[string]string{
+		"a.go": `package doccov
+// Limits.
+const (
+	A = 1
+	B = 2
+)
+var C = 3 // C is documented by the line comment.
+var D = 4
+// T is documented.
+type T struct{}
+// M is documented.
+func (T) M() {}
+func (T) N() {}
+type u struct{}
+func (u) M() {}
+func F() {}
+`,
+		"a_test.go":             "package doccov\nfunc Helper() {}\n",
+		aster.ProjectConfigFile: "doc_coverage:\n  min: 0.5\n  min_package: 0.9\n  packages:\n    doccov: 0.7\n",
+	})
+	r := m.DocCoverage()
+	if len(r.Packages) != 1 || r.Total != 8 || r.Documented != 5 {
+		t.Fatalf("coverage: %d/%d", r.Documented, r.Total)
+	}
+	if u := r.Packages[0].Undocumented; strings.Join(u, ",") != "D,F,T.N" {
+		t.Fatalf("undocumented: %v", u)
+	}
+	cfg, path, err := aster.LoadProjectConfig("../_out/doccov")
+	if err != nil || path == "" {
+		t.Fatalf("config: %q, %v", path, err)
+	}
+	err = r.Check(&cfg.DocCoverage)
+	if err == nil || !strings.Contains(err.Error(), "package doccov: 62.5% < 70.0%") {
+		t.Fatalf("check: %v", err)
+	}
+	cfg.DocCoverage.Packages["doccov"] = 0.5
+	if err = r.Check(&cfg.DocCoverage); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(r)
+}
+
+func TestFlattenFields(t *testing.T) {
+	var src = []byte(`package test
+type Model struct {
+	ID   int64
+	Name string
+}
+type Audit struct {
+	Name    string
+	Created int64
+	*Node
+}
+type Node struct {
+	Next *Node
+	*Audit
+}
+type User struct {
+	Model
+	*Audit
+	Email string
+}
+`)
+	f, err := aster.ParseFile("../_out/embedded1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := f.LookupType("User")
+	if _, ok := u.FieldByName("ID"); ok {
+		t.Fatal("promoted field found without traversal")
+	}
+	id, ok := u.FieldByName("ID", true)
+	if !ok || fmt.Sprint(id.Index) != "[0 0]" || strings.Join(id.Path, ".") != "Model" {
+		t.Fatalf("ID: %v %v", id.Index, id.Path)
+	}
+	if _, ok = u.FieldByName("Name", true); ok {
+		t.Fatal("ambiguous field Name found")
+	}
+	next, ok := u.FieldByName("Next", true)
+	if !ok || fmt.Sprint(next.Index) != "[1 2 0]" || strings.Join(next.Path, ".") != "Audit.Node" {
+		t.Fatalf("Next: %v %v", next.Index, next.Path)
+	}
+	var names []string
+	for _, field := range u.FlattenFields() {
+		names = append(names, field.Name())
+	}
+	if got := strings.Join(names, ","); got != "Model,Audit,Email,ID,Created,Node,Next" {
+		t.Fatalf("flatten: %s", got)
+	}
+}
+
+func TestPromotedMethods(t *testing.T) {
+	m := parseModule(t, "methodset", map[string]string{
+		"a.go": `package methodset
+type Reader interface {
+	Read(p []byte) (int, error)
+}
+type ReadCloser interface {
+	Reader
+	Close() error
+}
+type Base struct{}
+func (Base) ID() int { return 0 }
+func (Base) Name() string { return "" }
+type Other struct{}
+func (Other) Name() string { return "" }
+type User struct {
+	Base
+	Other
+	ReadCloser
+}
+`,
+		"b.go": `package methodset
+func (u *User) Save() error { return nil }
+`,
+	})
+	p := m.Packages["methodset"]
+	u, _ := p.LookupType("User")
+	if u.NumMethod() != 1 {
+		t.Fatalf("declared methods: %d", u.NumMethod())
+	}
+	var names []string
+	for i := 0; i < u.NumMethod(true); i++ {
+		m, _ := u.Method(i, true)
+		names = append(names, m.Name())
+	}
+	if got := strings.Join(names, ","); got != "Save,ID,Close,Read" {
+		t.Fatalf("method set: %s", got)
+	}
+	if _, ok := u.MethodByName("Name", true); ok {
+		t.Fatal("ambiguous method Name found")
+	}
+	rc, _ := p.LookupType("ReadCloser")
+	if rc.NumMethod() != 1 || rc.NumMethod(true) != 2 {
+		t.Fatalf("interface method set: %d, %d", rc.NumMethod(), rc.NumMethod(true))
+	}
+	if !u.Implements(rc) {
+		t.Fatal("User should implement ReadCloser")
+	}
+}
+
+func TestConvertReceivers(t *testing.T) {
+	m := parseModule(t, "receivers", map[string]string{
+		"a.go": `package receivers
+import "sync"
+type Point struct{ X, Y int }
+func (p Point) Len() int { return p.X + p.Y }
+type Counter struct {
+	mu sync.Mutex
+	n  int
+}
+func (c *Counter) Inc() { c.mu.Lock(); c.n++; c.mu.Unlock() }
+type Guarded struct{ Counter }
+func (g *Guarded) Get() int { return g.n }
+`,
+		"b.go": `package receivers
+func (p *Point) Scale(k int) { p.X *= k; p.Y *= k }
+var lenOf = Point.Len
+var scale = (*Point).Scale
+`,
+	})
+	p := m.Packages["receivers"]
+	pt, _ := p.LookupType("Point")
+	if err := pt.ConvertReceivers(true); err != nil {
+		t.Fatal(err)
+	}
+	pt, _ = p.LookupType("Point")
+	for i := 0; i < pt.NumMethod(); i++ {
+		m, _ := pt.Method(i)
+		if recv, _ := m.Recv(); recv.TypeName != "*Point" {
+			t.Fatalf("%s receiver: %s", m.Name(), recv.TypeName)
+		}
+	}
+	var b *aster.File
+	for name, f := range p.Files {
+		if strings.HasSuffix(name, "b.go") {
+			b = f
+		}
+	}
+	if code := b.String(); !strings.Contains(code, "var lenOf = (*Point).Len") ||
+		!strings.Contains(code, "var scale = (*Point).Scale") {
+		t.Fatalf("method expressions not rewritten:\n%s", code)
+	}
+	if err := pt.ConvertReceivers(false); err != nil {
+		t.Fatal(err)
+	}
+	if code := b.String(); !strings.Contains(code, "var scale = Point.Scale") {
+		t.Fatalf("method expressions not rewritten:\n%s", code)
+	}
+	g, _ := p.LookupType("Guarded")
+	err := g.ConvertReceivers(false)
+	if err == nil || !strings.Contains(err.Error(), "Counter.mu") {
+		t.Fatalf("want copylocks error, got: %v", err)
+	}
+}
+
+func TestFixImportAliases(t *testing.T) {
+	var src = []byte(`package test
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	str "strings"
+)
+func F(v1 int) metav1Obj {
+	_ = corev1.Pod{}
+	return v1.ObjectMeta{Name: str.ToUpper("x")}
+}
+var _ = v1.Now()
+type metav1Obj = interface{}
+`)
+	f, err := aster.ParseFile("../_out/importalias1.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := aster.ImportAliases{
+		"k8s.io/apimachinery/pkg/apis/meta/v1": "metav1",
+		"k8s.io/api/core/v1":                   "corev1",
+		"strings":                              "strings",
+	}
+	if vs := f.CheckImportAliases(policy); len(vs) != 2 {
+		t.Fatalf("violations: %v", vs)
+	}
+	n, err := f.FixImportAliases(policy)
+	if err != nil || n != 2 {
+		t.Fatalf("fixed: %d, %v", n, err)
+	}
+	code := f.String()
+	for _, s := range []string{
+		`metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"`,
+		`strings "strings"`,
+		"return v1.ObjectMeta{Name: strings.ToUpper", // the parameter v1 is not renamed
+		"var _ = metav1.Now()",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %q in:\n%s", s, code)
+		}
+	}
+	if vs := f.CheckImportAliases(policy); len(vs) != 0 {
+		t.Fatalf("violations after fixing: %v", vs)
+	}
+	_, err = f.FixImportAliases(aster.ImportAliases{"k8s.io/api/core/v1": "metav1"})
+	if err == nil {
+		t.Fatal("want alias conflict error")
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	src := []byte(`package tags
+type User struct {
+	ID    int    ` + "`json:\"id\" db:\"id\"`" + `
+	Key   string ` + "`json:\"id,omitempty\"`" + `
+	A, B  string ` + "`json:\"ab\"`" + `
+	Bad   string ` + "`json:name`" + `
+	Twice string ` + "`json:\"x\" json:\"y\"`" + `
+	Skip1 string ` + "`json:\"-\"`" + `
+	Skip2 string ` + "`json:\"-\"`" + `
+	Plain string
+}
+`)
+	f, err := aster.ParseFile("../_out/tags.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Key: json name \"id\" is also used by field ID (duplicate)",
+		"B: json name \"ab\" is also used by field A (duplicate)",
+		"Bad: bad syntax for struct tag value (syntax)",
+		"Twice: duplicate tag key \"json\" (syntax)",
+	}
+	diags := f.CheckTags()
+	if len(diags) != len(want) {
+		t.Fatalf("diagnostics: %v", diags)
+	}
+	for i, d := range diags {
+		if !strings.HasSuffix(d.String(), want[i]) {
+			t.Fatalf("diagnostic %d: got %q, want suffix %q", i, d, want[i])
+		}
+	}
+	if diags[0].Pos.Line != 4 || diags[0].Key != "json" {
+		t.Fatalf("diagnostic: %+v", diags[0])
+	}
+
+	diags = f.CheckTags(aster.TagKeyRule("json"))
+	if len(diags) != 1 || diags[0].Field != "ID" || diags[0].Key != "db" {
+		t.Fatalf("unknown keys: %v", diags)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	m := parseModule(t, "merge", map[string]string{
+		"a.go": `package merge
+
+import (
+	"fmt"
+	"strings"
+)
+
+type User struct{ Name string }
+
+// String is old.
+func (u *User) String() string { return fmt.Sprint(u.Name) }
+
+var A, B = 1, 2
+
+func Upper(s string) string { return strings.ToUpper(s) }
+`,
+		"b.go": `package merge
+
+import "strconv"
+
+var _ = strconv.Itoa
+`,
+	})
+	var f *aster.File
+	for name, file := range m.Packages["merge"].Files {
+		if strings.HasSuffix(name, "a.go") {
+			f = file
+		}
+	}
+	err := f.Merge([]byte(`
+// String is new.
+func (u User) String() string { return strconv.Quote(u.Name) }
+
+func Lower(s string) string { return strings.ToLower(s) }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.String()
+	for _, s := range []string{
+		"// String is new.\nfunc (u User) String() string { return strconv.Quote(u.Name) }",
+		"func Lower(s string) string",
+		"func Upper(s string) string",
+		`"strconv"`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %q in:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{"String is old", `"fmt"`} {
+		if strings.Contains(code, s) {
+			t.Fatalf("unexpected %q in:\n%s", s, code)
+		}
+	}
+	if err = f.Merge([]byte("var A = 3")); err == nil {
+		t.Fatal("want error merging A declared together with B")
+	}
+	if err = f.Merge([]byte("package other\nvar C = 3")); err == nil {
+		t.Fatal("want package mismatch error")
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	m := parseModule(t, "mergefiles", map[string]string{
+		"a.go": `// Package mergefiles is merged.
+package mergefiles
+
+import "strings"
+
+// A is a.
+func A() string { return strings.ToUpper("a") }
+`,
+		"b.go": `package mergefiles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// floating comment
+
+// B is b.
+type B struct{}
+
+func (B) String() string { return fmt.Sprint(strings.ToLower("B")) }
+`,
+		"a_test.go": `package mergefiles
+`,
+	})
+	p := m.Packages["mergefiles"]
+	f, err := p.MergeFiles("all.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := f.String()
+	for _, s := range []string{
+		"// Package mergefiles is merged.\npackage mergefiles",
+		"import (\n\t\"fmt\"\n\t\"strings\"\n)",
+		"// A is a.\nfunc A()",
+		"// floating comment",
+		"// B is b.\ntype B struct{}",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %q in:\n%s", s, code)
+		}
+	}
+	if len(p.Files) != 2 {
+		t.Fatalf("files: %v", p.Files)
+	}
+	if fn := p.Fetch(func(n aster.Node) bool { return n.Name() == "String" }); len(fn) != 1 {
+		t.Fatalf("methods: %v", fn)
+	}
+	diff, err := p.Diff()
+	if err != nil || !strings.Contains(diff, "--- a/../_out/mergefiles/a.go") {
+		t.Fatalf("diff: %s, %v", diff, err)
+	}
+	if err = m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	for name, exists := range map[string]bool{"a.go": false, "b.go": false, "a_test.go": true, "all.go": true} {
+		if _, err := os.Stat(filepath.Join("../_out/mergefiles", name)); (err == nil) != exists {
+			t.Fatalf("%s exists: %v", name, err == nil)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	m := parseModule(t, "split", map[string]string{
+		"mega.go": `//go:build linux
+
+package split
+
+import (
+	"fmt"
+	"strings"
+)
+
+const Version = "1"
+
+// UserInfo is a user.
+type UserInfo struct{ Name string }
+
+// String formats the user.
+func (u *UserInfo) String() string { return fmt.Sprint(u.Name) }
+
+type Order struct{}
+
+func (Order) ID() string { return strings.ToUpper("o") }
+`,
+		"order.go": `//go:build linux
+
+package split
+
+func NewOrder() Order { return Order{} }
+`,
+	})
+	p := m.Packages["split"]
+	var f *aster.File
+	for name, file := range p.Files {
+		if strings.HasSuffix(name, "mega.go") {
+			f = file
+		}
+	}
+	files, err := f.Split(aster.SplitByType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file.Filename))
+	}
+	if strings.Join(names, ",") != "mega.go,order.go,user_info.go" {
+		t.Fatalf("files: %v", names)
+	}
+	codes := make(map[string]string)
+	for _, file := range files {
+		codes[filepath.Base(file.Filename)] = file.String()
+	}
+	for name, want := range map[string][]string{
+		"mega.go":      {`const Version = "1"`},
+		"user_info.go": {"//go:build linux\n\npackage split\n\nimport \"fmt\"\n", "// UserInfo is a user.\ntype UserInfo", "// String formats the user.\nfunc (u *UserInfo) String()"},
+		"order.go":     {"import \"strings\"", "func NewOrder()", "type Order struct{}", "func (Order) ID()"},
+	} {
+		for _, s := range want {
+			if !strings.Contains(codes[name], s) {
+				t.Fatalf("missing %q in %s:\n%s", s, name, codes[name])
+			}
+		}
+	}
+	if strings.Contains(codes["mega.go"], "import") {
+		t.Fatalf("unused imports left:\n%s", codes["mega.go"])
+	}
+
+	files, err = f.Split(func(token.Token, string, string) string { return "all.go" })
+	if err != nil || len(files) != 1 || len(p.Files) != 3 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	if _, ok := p.Files[f.Filename]; ok {
+		t.Fatal("the emptied file is not removed")
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	m := parseModule(t, "gen", map[string]string{
+		"a.go": `package gen
+type User struct {
+	ID   int    ` + "`json:\"id\"`" + `
+	Name string
+}
+type Reader interface{ Read() }
+`,
+	})
+	g, err := gen.New("fields", `{{range .Structs}}
+// {{.Name}}Fields are the json names of {{.Name}}.
+var {{.Name}}Fields = []string{ {{range fields .}}"{{tag . "json"}}", {{end}} }
+
+func (x *{{.Name}}) String() string { return fmt.Sprint(*x) }
+{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := g.Run(m)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	b, err := ioutil.ReadFile("../_out/gen/gen_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(b)
+	manifest, err := aster.LoadManifest("../_out/gen")
+	if p, ok := manifest.Lookup("../_out/gen/gen_gen.go"); err != nil || !ok || p.Generator != "fields" {
+		t.Fatalf("manifest: %v, %v", p, err)
+	}
+	for _, s := range []string{
+		"package gen\n",
+		`import "fmt"`,
+		`var UserFields = []string{"id", "Name"}`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %q in:\n%s", s, code)
+		}
+	}
+	// regenerating replaces the declarations, ignoring the generated ones
+	if files, err = g.Run(m); err != nil || len(files) != 1 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	if b, _ = ioutil.ReadFile("../_out/gen/gen_gen.go"); string(b) != code {
+		t.Fatalf("regenerated:\n%s", b)
+	}
+
+	g.Each = func(n aster.Node) bool { return n.Kind() == aster.Interface }
+	g.Template = template.Must(template.New("each").Funcs(gen.Funcs).Parse(`type Mock{{.Node.Name}} struct{}`))
+	code2, err := g.Render(m.Packages["gen"])
+	if err != nil || !strings.Contains(string(code2), "type MockReader struct{}") {
+		t.Fatalf("rendered: %s, %v", code2, err)
+	}
+}
+
+func TestGenerateMapper(t *testing.T) {
+	m := parseModule(t, "mapper", map[string]string{
+		"a.go": `package mapper
+type ID int32
+type Address struct{ City string }
+type AddressDTO struct{ City string }
+func AddressToAddressDTO(in *Address) *AddressDTO { return &AddressDTO{City: in.City} }
+type User struct {
+	ID      ID
+	Name    *string
+	Email   string ` + "`json:\"mail\"`" + `
+	Age     int
+	Tags    []string
+	Home    Address
+	Offices []*Address
+	Items   *[]Address
+	Secret  string
+}
+type UserDTO struct {
+	ID      int64
+	Name    string
+	Address string ` + "`json:\"mail\"`" + `
+	Age     *int
+	Tags    []string
+	Home    *AddressDTO
+	Offices []AddressDTO
+	Items   []AddressDTO
+	Secret  string
+	Note    string
+	Full    string
+}
+`,
+	})
+	p := m.Packages["mapper"]
+	from, _ := p.LookupType("User")
+	to, _ := p.LookupType("UserDTO")
+	err := aster.GenerateMapper(from, to, &aster.MapperConfig{
+		TagKey:    "json",
+		Overrides: map[string]string{"Secret": "", "Full": `"full"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code string
+	for _, f := range p.Files {
+		code = f.String()
+	}
+	for _, want := range []string{
+		"// The fields not mapped: Note.",
+		"func UserToUserDTO(in *User) *UserDTO {",
+		"out.ID = int64(in.ID)",
+		"if in.Name != nil {\n\t\tout.Name = *in.Name",
+		"out.Address = in.Email",
+		"v1 = in.Age",
+		"out.Tags = in.Tags",
+		"out.Home = AddressToAddressDTO(&in.Home)",
+		"out.Offices = make([]AddressDTO, len(in.Offices))",
+		"if v := AddressToAddressDTO(in.Offices[i1]); v != nil {",
+		"out.Items = make([]AddressDTO, len(*in.Items))",
+		"if v := AddressToAddressDTO(&(*in.Items)[i2]); v != nil {",
+		`out.Full = "full"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("missing %q in:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "out.Secret") {
+		t.Fatalf("Secret should be skipped:\n%s", code)
+	}
+	from, _ = p.LookupType("User")
+	to, _ = p.LookupType("UserDTO")
+	if err = aster.GenerateMapper(from, to, nil); err == nil {
+		t.Fatal("want function exists error")
+	}
+	from, _ = p.LookupType("Address")
+	if err = aster.GenerateMapper(to, from, &aster.MapperConfig{FuncName: "Bad"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestClean(t *testing.T) {
+	m := parseModule(t, "manifest", map[string]string{
+		"a.go": `package manifest
+type Reader interface{ Read() error }
+type Writer interface{ Write() error }
+`,
+	})
+	p := m.Packages["manifest"]
+	// the generated files are recorded on Store
+	for _, name := range []string{"Reader", "Writer"} {
+		iface, _ := p.LookupType(name)
+		f, err := aster.GenerateMock(iface)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Store(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile("../_out/manifest/a.go", []byte("package manifest\ntype Writer interface{ Write() error }\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = aster.ParseDir("../_out/manifest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := aster.LoadManifest("../_out/manifest")
+	if err != nil || len(manifest.Files) != 2 {
+		t.Fatalf("manifest: %v, %v", manifest, err)
+	}
+	removed, err := manifest.Clean(m, true)
+	if err != nil || len(removed) != 1 || filepath.Base(removed[0]) != "reader_mock.go" {
+		t.Fatalf("dry run: %v, %v", removed, err)
+	}
+	if _, err = os.Stat("../_out/manifest/reader_mock.go"); err != nil {
+		t.Fatal("dry run deleted the file")
+	}
+	if _, err = manifest.Clean(m, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat("../_out/manifest/reader_mock.go"); !os.IsNotExist(err) {
+		t.Fatal("orphan file not deleted")
+	}
+	if _, ok := m.Packages["manifest"].LookupType("MockReader"); ok {
+		t.Fatal("orphan file not removed from the module")
+	}
+	if p, ok := manifest.Lookup("../_out/manifest/writer_mock.go"); !ok || p.Sources[0] != "github.com/henrylee2cn/aster/_out/manifest.Writer" {
+		t.Fatalf("writer record: %v", p)
+	}
+
+	removed, err = manifest.Clean(m, false, "nullable")
+	if err != nil || len(removed) != 1 || filepath.Base(removed[0]) != "writer_mock.go" {
+		t.Fatalf("generator rule removed: %v, %v", removed, err)
+	}
+	manifest, _ = aster.LoadManifest("../_out/manifest")
+	if len(manifest.Files) != 0 {
+		t.Fatalf("manifest not saved: %v", manifest.Files)
+	}
+
+	// the manifest is saved to and the orphans deleted from its file system
+	fsys := aster.MapFS{}
+	manifest.FS = fsys
+	writer := filepath.Join(manifest.Dir, "writer_mock.go")
+	fsys[writer] = []byte("package manifest\n")
+	iface, _ := m.Packages["manifest"].LookupType("Writer")
+	if err = manifest.Record(writer, "mock", iface.(aster.Node)); err != nil {
+		t.Fatal(err)
+	}
+	removed, err = manifest.Clean(m, false, "nullable")
+	if err != nil || len(removed) != 1 || removed[0] != writer {
+		t.Fatalf("removed: %v, %v", removed, err)
+	}
+	if names := fsys.Names(); len(names) != 1 || filepath.Base(names[0]) != aster.ManifestFile {
+		t.Fatalf("file system: %v", names)
+	}
+
+	// the source IDs are qualified by the package paths
+	a := parseModule(t, "manifest_ids/a", map[string]string{"x.go": "package x\ntype T struct{}\n"})
+	b := parseModule(t, "manifest_ids/b", map[string]string{"x.go": "package x\ntype T struct{}\n"})
+	manifest, err = aster.LoadManifest("../_out/manifest_ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, _ := b.Packages["x"].LookupType("T")
+	if err = manifest.Record("../_out/manifest_ids/b/t_gen.go", "gen", typ.(aster.Node)); err != nil {
+		t.Fatal(err)
+	}
+	if orphans := manifest.Orphans(a); len(orphans) != 1 {
+		t.Fatalf("the source of the other package is found: %v", manifest.Files[0])
+	}
+	if orphans := manifest.Orphans(b); len(orphans) != 0 {
+		t.Fatalf("the source is not found: %v", manifest.Files[0])
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	m := parseModule(t, "accessors", map[string]string{
+		"b.go": `package accessors
+type B struct{}
+func (B) M() {}
+type I interface{ M() }
+`,
+		"a.go": `package accessors
+type A struct{}
+type N int
+func F() {}
+`,
+	})
+	p := m.Packages["accessors"]
+	var names []string
+	for _, t := range p.Types() {
+		names = append(names, t.Name())
+	}
+	if got := strings.Join(names, ","); got != "A,N,B,I" {
+		t.Fatalf("types: %s", got)
+	}
+	names = names[:0]
+	for _, f := range p.Funcs() {
+		names = append(names, f.Name())
+	}
+	if got := strings.Join(names, ","); got != "F,M" {
+		t.Fatalf("funcs: %s", got)
+	}
+	if s := p.Structs(); len(s) != 2 || s[0].Name() != "A" || s[1].Name() != "B" {
+		t.Fatalf("structs: %v", s)
+	}
+	if i := p.Interfaces(); len(i) != 1 || i[0].Name() != "I" {
+		t.Fatalf("interfaces: %v", i)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	m := parseModule(t, "remove", map[string]string{
+		"a.go": `package remove
+
+// A is removed.
+type A struct{} // trailing
+
+// keep is a floating comment.
+
+type (
+	// B is removed.
+	B int // B line
+	// C is kept.
+	C int
+)
+
+// F is removed.
+func F() {
+	// inside
+}
+
+// V is removed.
+var V = func() {}
+
+var X, Y = func() {}, 1
+`,
+		"b.go": `package remove
+
+// M is removed with A.
+func (a *A) M() {}
+
+func (c C) N() {}
+`,
+	})
+	p := m.Packages["remove"]
+	if err := p.RemoveType("A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveType("B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveFunc("F"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveFunc("V"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveFunc("X"); err == nil {
+		t.Fatal("want names declared together error")
+	}
+	if err := p.RemoveMethod("C", "N"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveFunc("F"); err == nil {
+		t.Fatal("want function not found error")
+	}
+	var a, b *aster.File
+	for name, f := range p.Files {
+		if strings.HasSuffix(name, "a.go") {
+			a = f
+		} else {
+			b = f
+		}
+	}
+	want := `package remove
+
+// keep is a floating comment.
+
+type (
+	// C is kept.
+	C int
+)
+
+var X, Y = func() {}, 1
+`
+	if code := a.String(); code != want {
+		t.Fatalf("a.go:\n%s", code)
+	}
+	if code := b.String(); code != "package remove\n" {
+		t.Fatalf("b.go:\n%s", code)
+	}
+	if len(a.File.Comments) != 2 {
+		t.Fatalf("comments: %d", len(a.File.Comments))
+	}
+	if _, ok := p.LookupType("A"); ok {
+		t.Fatal("A not unregistered")
+	}
+}
+
+func TestInlineExtractEmbedded(t *testing.T) {
+	m := parseModule(t, "embedding", map[string]string{
+		"a.go": `package embedding
+
+// Base is the common part.
+type Base struct {
+	// ID is the identity.
+	ID   int
+	Name string // the name
+}
+
+type User struct {
+	Base
+	Email string
+}
+
+var u = User{Base: Base{ID: 1, Name: "a"}, Email: "e"}
+var v = &User{Base: Base{}, Email: "e"}
+
+func name(u *User) string { return u.Base.Name + u.Email }
+`,
+	})
+	p := m.Packages["embedding"]
+	user, _ := p.LookupType("User")
+	if err := user.InlineEmbedded("Base"); err != nil {
+		t.Fatal(err)
+	}
+	var f *aster.File
+	for _, pf := range p.Files {
+		f = pf
+	}
+	code := f.String()
+	for _, want := range []string{
+		"type User struct {\n\t// ID is the identity.\n\tID    int\n\tName  string // the name\n\tEmail string\n}",
+		`var u = User{ID: 1, Name: "a", Email: "e"}`,
+		`var v = &User{Email: "e"}`,
+		"return u.Name + u.Email",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("missing %q in:\n%s", want, code)
+		}
+	}
+
+	user, _ = p.LookupType("User")
+	if err := user.ExtractEmbedded("Identity", "ID", "Name"); err != nil {
+		t.Fatal(err)
+	}
+	code = f.String()
+	for _, want := range []string{
+		"type User struct {\n\tIdentity\n\tEmail string\n}",
+		"// Identity is extracted from User.\ntype Identity struct {\n\t// ID is the identity.\n\tID   int\n\tName string // the name\n}",
+		`var u = User{Identity: Identity{ID: 1, Name: "a"}, Email: "e"}`,
+		"return u.Name + u.Email",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("missing %q in:\n%s", want, code)
+		}
+	}
+
+	user, _ = p.LookupType("User")
+	if err := user.ExtractEmbedded("Base", "Email"); err == nil {
+		t.Fatal("want type exists error")
+	}
+	if err := user.InlineEmbedded("Email"); err == nil {
+		t.Fatal("want not embedded error")
+	}
+}
+
+func TestReferences(t *testing.T) {
+	m := parseModule(t, "refs", map[string]string{
+		"a.go": `package refs
+
+type User struct {
+	Name string
+}
+
+func (u *User) Hello() string { return "hello " + u.Name }
+
+func NewUser(name string) *User { return &User{Name: name} }
+`,
+		"b.go": `package refs
+
+type Admin struct {
+	User
+	Name string
+}
+
+func greet(a *Admin, x interface{ Hello() string }) string {
+	u := NewUser("u")
+	var v = User{}
+	return u.Hello() + a.Hello() + a.User.Name + v.Name + a.Name + x.Hello()
+}
+
+var hello = (*User).Hello
+
+func shadow() {
+	NewUser := func() {}
+	NewUser()
+}
+`,
+		"b_test.go": `package refs_test
+
+import "refs"
+
+var _ = refs.NewUser("t")
+`,
+	})
+	p := m.Packages["refs"]
+	pos := func(refs []aster.Ref) string {
+		var s []string
+		for _, r := range refs {
+			name := "-"
+			if r.Enclosing != nil {
+				name = r.Enclosing.Name()
+			}
+			s = append(s, fmt.Sprintf("%s:%d:%s:%v", filepath.Base(r.Pos.Filename), r.Pos.Line, name, r.Guess))
+		}
+		return strings.Join(s, ",")
+	}
+
+	user, _ := p.LookupType("User")
+	if got := pos(user.References()); got != "a.go:7:Hello:false,a.go:9:NewUser:false,a.go:9:NewUser:false,b.go:4:Admin:false,b.go:10:greet:false,b.go:14:-:false" {
+		t.Fatalf("User: %s", got)
+	}
+	newUser := p.Funcs()[1]
+	if got := pos(newUser.References()); got != "b.go:9:greet:false,b_test.go:5:-:false" {
+		t.Fatalf("NewUser: %s", got)
+	}
+	hello, _ := user.MethodByName("Hello")
+	if got := pos(hello.References()); got != "b.go:11:greet:false,b.go:11:greet:false,b.go:14:-:false" {
+		t.Fatalf("Hello: %s", got)
+	}
+	name, _ := user.FieldByName("Name")
+	if got := pos(name.References()); got != "a.go:7:Hello:false,a.go:9:NewUser:false,b.go:11:greet:false,b.go:11:greet:false" {
+		t.Fatalf("User.Name: %s", got)
+	}
+}
+
+func TestGenerateCompatShims(t *testing.T) {
+	old := parseModule(t, "compat_old", map[string]string{
+		"a.go": `package compat
+import "io"
+// Open opens the file.
+func Open(name string, w io.Writer) error { return nil }
+func Count(xs ...int) int { return len(xs) }
+func Same(a int) int { return a }
+func Split(s string) (string, string) { return s, s }
+`,
+	})
+	m := parseModule(t, "compat_new", map[string]string{
+		"a.go": `package compat
+// Open opens the file.
+func Open(name string, flag int) (int, error) { return flag, nil }
+func Count(base int, xs ...int) int { return base + len(xs) }
+func Same(a int) int { return a }
+func Split(s, sep string) []string { return nil }
+`,
+		"b.go": `package compat
+var _, _ = Open("a", 1)
+`,
+	})
+	changes := aster.ChangedSignatures(old, m)
+	var names []string
+	for _, c := range changes {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, ","); got != "Count,Open,Split" {
+		t.Fatalf("changes: %s", got)
+	}
+	if err := aster.GenerateCompatShims(changes, nil); err != nil {
+		t.Fatal(err)
+	}
+	p := m.Packages["compat"]
+	var a, b *aster.File
+	for name, f := range p.Files {
+		if strings.HasSuffix(name, "a.go") {
+			a = f
+		} else {
+			b = f
+		}
+	}
+	code := a.String()
+	for _, want := range []string{
+		"import \"io\"",
+		"// OpenV2 opens the file.\nfunc OpenV2(name string, flag int) (int, error)",
+		"// Deprecated: Use OpenV2 instead.\nfunc Open(name string, w io.Writer) error {\n\t_, r1 := OpenV2(name, *new(int))\n\treturn r1\n}",
+		"func Count(xs ...int) int {\n\treturn CountV2(*new(int), xs...)\n}",
+		"func Split(s string) (string, string) {\n\t_ = SplitV2(s, *new(string))\n\treturn *new(string), *new(string)\n}",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("missing %q in:\n%s", want, code)
+		}
+	}
+	if code := b.String(); !strings.Contains(code, `OpenV2("a", 1)`) {
+		t.Fatalf("reference not renamed:\n%s", code)
+	}
+	if changes = aster.ChangedSignatures(old, m); len(changes) != 0 {
+		t.Fatalf("shims not matching the old signatures: %v", changes)
+	}
+	m = parseModule(t, "compat_taken", map[string]string{
+		"a.go": `package compat
+func Count(base int, xs ...int) int { return base + len(xs) }
+func CountV2() {}
+`,
+	})
+	if err := aster.GenerateCompatShims(aster.ChangedSignatures(old, m), nil); err == nil {
+		t.Fatal("want name taken error")
+	}
+}
+
+func TestCallGraph(t *testing.T) {
+	m := parseModule(t, "callgraph", map[string]string{
+		"a.go": `package callgraph
+
+type S struct{}
+
+func (s *S) Run() { helper() }
+
+func helper() int { return len("x") }
+
+var hook = func() { helper() }
+
+func Main() {
+	s := &S{}
+	s.Run()
+	hook()
+	helper()
+	helper()
+}
+`,
+	})
+	p := m.Packages["callgraph"]
+	g := m.CallGraph()
+	if len(g.Edges) != 5 {
+		t.Fatalf("static edges: %d", len(g.Edges))
+	}
+	helper := p.Funcs()[1]
+	if n := len(g.Callers(helper)); n != 4 {
+		t.Fatalf("callers of helper: %d", n)
+	}
+	g = m.CallGraph(true)
+	want := `digraph callgraph {
+	"callgraph.Main" -> "callgraph.S.Run";
+	"callgraph.Main" -> "callgraph.helper";
+	"callgraph.Main" -> "callgraph.hook";
+	"callgraph.S.Run" -> "callgraph.helper";
+	"callgraph.hook" -> "callgraph.helper";
+}
+`
+	if dot := g.DOT(); dot != want {
+		t.Fatalf("DOT:\n%s", dot)
+	}
+	main := p.Funcs()[3]
+	if n := len(g.Callees(main)); n != 4 {
+		t.Fatalf("callees of Main: %d", n)
+	}
+}
+
+func TestVisitor(t *testing.T) {
+	m := parseModule(t, "visitor", map[string]string{
+		"a.go": `package visitor
+
+type Color int
+
+// Colors.
+const (
+	Red Color = iota
+	Green
+)
+
+const answer = 42
+
+type S struct{}
+
+type I interface{ M() }
+
+func (S) M() {}
+`,
+	})
+	var got []string
+	v := aster.NewVisitor().
+		OnType(func(t aster.TypeNode) { got = append(got, "type:"+t.Name()) }).
+		OnStruct(func(t aster.TypeNode) { got = append(got, "struct:"+t.Name()) }).
+		OnInterface(func(t aster.TypeNode) { got = append(got, "interface:"+t.Name()) }).
+		OnFunc(func(f aster.FuncNode) { got = append(got, "func:"+f.Name()) }).
+		OnConstGroup(func(g *aster.ConstGroup) {
+			got = append(got, fmt.Sprintf("const:%s:%s:%s", strings.Join(g.Names, "+"), g.Type, strings.TrimSpace(g.Doc())))
+		})
+	m.Walk(v)
+	want := "type:Color,const:Red+Green:Color:Colors.,const:answer::,type:S,struct:S,type:I,interface:I,func:M"
+	if s := strings.Join(got, ","); s != want {
+		t.Fatalf("got %s", s)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	m := parseModule(t, "symbols", map[string]string{
+		"a.go": `package symbols
+
+import (
+	"fmt"
+	str "strings"
+)
+
+const Max = 10
+
+var (
+	count int
+	hook  = func(s string) string { return s }
+)
+
+type User struct{ Name string }
+
+func (u *User) String() string {
+	name := fmt.Sprint(u.Name)
+	if count := len(name); count > Max {
+		name := str.ToUpper(name)
+		return name
+	}
+	return name
+}
+
+func format(fmt string) string {
+	for _, count := range []int{1} {
+		_ = count
+	}
+	return fmt
+}
+
+func init() {}
+`,
+		"b.go": `package symbols
+
+import "os"
+
+func Exit() { os.Exit(0) }
+`,
+	})
+	var f *aster.File
+	for name, pf := range m.Packages["symbols"].Files {
+		if strings.HasSuffix(name, "a.go") {
+			f = pf
+		}
+	}
+	var got []string
+	for _, sym := range f.Symbols() {
+		got = append(got, fmt.Sprintf("%s:%s:%v", sym.Name, sym.Kind, sym.Node != nil))
+	}
+	want := "fmt:package:false,str:package:false,Max:const:false,count:var:false,hook:var:true,User:type:true,format:func:true"
+	if s := strings.Join(got, ","); s != want {
+		t.Fatalf("symbols: got %s", s)
+	}
+	if sym, ok := f.LookupSymbol("Exit"); !ok || !strings.HasSuffix(sym.File.Filename, "b.go") {
+		t.Fatalf("lookup Exit: %v", ok)
+	}
+	if _, ok := f.LookupSymbol("os"); ok {
+		t.Fatal("lookup os: the import of another file is not visible")
+	}
+
+	got = got[:0]
+	for _, sh := range f.Shadows() {
+		outer := "top"
+		if sh.Symbol == nil {
+			outer = fmt.Sprintf("line %d", f.FileSet.Position(sh.Outer.Pos()).Line)
+		}
+		got = append(got, fmt.Sprintf("%s@%d:%s:%s", sh.Ident.Name, sh.Pos.Line, outer, sh.Enclosing.Name()))
+	}
+	want = "count@19:top:String,name@20:line 18:String,fmt@26:top:format,count@27:top:format"
+	if s := strings.Join(got, ","); s != want {
+		t.Fatalf("shadows: got %s", s)
+	}
+
+	for name, want := range map[string]string{
+		"User":   "aster: type already exists: User",
+		"Max":    "aster: constant already exists: Max",
+		"format": "aster: function already exists: format",
+		"os":     "aster: name conflicts with the imported package: os",
+		"String": "",
+		"init":   "",
+	} {
+		err := f.CheckCollision(name)
+		if err == nil && want != "" || err != nil && err.Error() != want {
+			t.Fatalf("collision %s: got %v", name, err)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := parseModule(t, "metrics", map[string]string{
+		"a.go": `package metrics
+
+func Simple() int {
+	return 1
+}
+
+func Complex(xs []int, ok bool) (n int) {
+	for _, x := range xs {
+		if x > 0 && ok {
+			n++
+		} else if x < 0 {
+			n--
+		}
+	}
+	switch {
+	case n > 10:
+		n = 10
+	default:
+	}
+	f := func() { n++ }
+	f()
+	return
+}
+
+var hook = func() {}
+`,
+	})
+	p := m.Packages["metrics"]
+	var got []string
+	for _, fn := range p.Funcs() {
+		got = append(got, fmt.Sprintf("%s:%+v", fn.Name(), *fn.Metrics()))
+	}
+	want := "Simple:{Complexity:1 Statements:1 Nesting:0 Lines:3}," +
+		"Complex:{Complexity:6 Statements:11 Nesting:2 Lines:17}," +
+		"hook:{Complexity:1 Statements:0 Nesting:0 Lines:1}"
+	if s := strings.Join(got, ","); s != want {
+		t.Fatalf("got %s", s)
+	}
+	pm := p.Metrics()
+	if pm.NumFunc != 3 || pm.Total.Complexity != 8 || pm.Max.Complexity != 6 || pm.Max.Lines != 17 {
+		t.Fatalf("package metrics: %+v", *pm)
+	}
+	if avg := pm.AvgComplexity(); avg < 2.66 || avg > 2.67 {
+		t.Fatalf("average complexity: %v", avg)
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	m := parseModule(t, "anchor", map[string]string{
+		"go.mod": "module example.com/anchor // the test module\n",
+		"a.go": `package anchor
+
+type User struct{ Name string }
+
+func (u *User) String() string { return u.Name }
+
+type Namer interface {
+	Name() string
+}
+
+func New() *User { return new(User) }
+`,
+	})
+	p := m.Packages["anchor"]
+	if path := p.Path(); path != "example.com/anchor" {
+		t.Fatalf("package path: %s", path)
+	}
+	var ids []string
+	user, _ := p.LookupType("User")
+	namer, _ := p.LookupType("Namer")
+	str, _ := user.MethodByName("String")
+	name, _ := namer.MethodByName("Name")
+	for _, n := range []aster.Node{user.(aster.Node), str.(aster.Node), name.(aster.Node)} {
+		a, ok := aster.AnchorOf(n)
+		if !ok {
+			t.Fatalf("no anchor of %s", n.Name())
+		}
+		ids = append(ids, a.String())
+	}
+	want := "example.com/anchor#Struct#User,example.com/anchor#Func#User.String,example.com/anchor#Func#Namer.Name"
+	if s := strings.Join(ids, ","); s != want {
+		t.Fatalf("got %s", s)
+	}
+
+	// the anchors survive the edits moving the nodes
+	var f *aster.File
+	for _, pf := range p.Files {
+		f = pf
+	}
+	f.Src = []byte(strings.Replace(string(f.Src), "package anchor\n", "package anchor\n\nconst Version = 1\n\n", 1))
+	if err := f.Reparse(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range append(strings.Split(want, ","), "example.com/anchor#Func#New") {
+		a, err := aster.ParseAnchor(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, ok := m.LookupAnchor(a)
+		if !ok || n.Name() != a.Name {
+			t.Fatalf("lookup %s: %v", id, ok)
+		}
+	}
+	for _, id := range []string{"example.com/anchor#Map#User", "example.com/anchor#Func#User.Missing", "example.com/other#Struct#User"} {
+		a, _ := aster.ParseAnchor(id)
+		if _, ok := m.LookupAnchor(a); ok {
+			t.Fatalf("lookup %s: want not found", id)
+		}
+	}
+	for _, id := range []string{"User", "example.com/anchor#Bogus#User", "example.com/anchor#Struct#User.Name"} {
+		if _, err := aster.ParseAnchor(id); err == nil {
+			t.Fatalf("parse %s: want error", id)
+		}
+	}
+}
+
+func TestUnusedDecls(t *testing.T) {
+	m := parseModule(t, "unused", map[string]string{
+		"a.go": `package unused
+
+const (
+	used    = 1
+	notUsed = 2 // not used
+)
+
+const (
+	a = iota
+	b
+)
+
+type config struct {
+	name  string
+	debug bool
+	Level int
+}
+
+// handler is never used,
+// not even by its methods.
+type handler struct{}
+
+func (h *handler) serve() { _ = h }
+
+type point struct{ x, y int }
+
+var origin = point{0, 0}
+
+func helper() int { return used + a }
+
+func dead() {}
+
+func New() string {
+	c := config{name: "x"}
+	return c.name + string(rune(helper()))
+}
+
+func init() {}
+`,
+	})
+	var got []string
+	for _, u := range m.UnusedDecls() {
+		got = append(got, fmt.Sprintf("%s:%s:%d", u.Name, u.Kind, u.Pos.Line))
+	}
+	want := "notUsed:const:5,b:const:10,debug:var:15,handler:type:21,dead:func:31"
+	if s := strings.Join(got, ","); s != want {
+		t.Fatalf("got %s", s)
+	}
+	for _, u := range m.UnusedDecls() {
+		err := u.Remove()
+		if u.Name == "b" {
+			if err == nil {
+				t.Fatal("want error of removing an iota constant")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("remove %s: %v", u.Name, err)
+		}
+	}
+	var f *aster.File
+	for _, pf := range m.Packages["unused"].Files {
+		f = pf
+	}
+	src := string(f.Src)
+	for _, s := range []string{"notUsed", "debug", "handler", "serve", "dead"} {
+		if strings.Contains(src, s) {
+			t.Fatalf("%s not removed:\n%s", s, src)
+		}
+	}
+	if _, err := format.Source(f.Src); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.UnusedDecls(); len(got) != 1 || got[0].Name != "b" {
+		t.Fatalf("unused after removing: %d", len(got))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := parseModule(t, "verify", map[string]string{
+		"a.go": `package verify
+
+import "strings"
+
+func Upper(s string) string { return strings.ToUpper(s) }
+`,
+		"b.go": `package verify
+
+func Count() int {
+	var n int = "one"
+	return n
+}
+`,
+	})
+	if failures := m.Verify(); len(failures) != 0 {
+		t.Fatalf("want no failures, got %v", failures[0])
+	}
+	failures := m.Verify(true)
+	if len(failures) != 1 || failures[0].Stage != aster.VerifyTypeCheck ||
+		!strings.HasSuffix(failures[0].Filename, "b.go") || failures[0].Pos.Line != 4 {
+		t.Fatalf("type-check: %v", failures)
+	}
+
+	// break the AST of a.go
+	p := m.Packages["verify"]
+	fn, _ := p.Funcs()[0].Node().(*ast.FuncDecl)
+	fn.Name = ast.NewIdent("not valid")
+	failures = m.Verify(true)
+	if len(failures) != 1 || failures[0].Stage != aster.VerifyParse || !strings.HasSuffix(failures[0].Filename, "a.go") {
+		t.Fatalf("parse: %v", failures)
+	}
+	if f := failures[0]; f.Pos.Line != 5 || !strings.Contains(f.Error(), "a.go:5:") {
+		t.Fatalf("parse error: %v", f)
+	}
+}
+
+func TestDepGraph(t *testing.T) {
+	m := parseModule(t, "deps", map[string]string{
+		"a.go": `package alpha
+
+import (
+	"fmt"
+
+	"example.com/deps/beta"
+)
+
+var _ = fmt.Sprint(beta.B)
+`,
+		"b.go": `package beta
+
+import "example.com/deps/gamma"
+
+var B = gamma.G
+`,
+		"c.go": `package gamma
+
+import "strings"
+
+var G = strings.ToUpper("g")
+`,
+	})
+	g := m.DepGraph()
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+"->"+e.To)
+	}
+	if s := strings.Join(edges, ","); s != "alpha->beta,beta->gamma" {
+		t.Fatalf("edges: %s", s)
+	}
+	if order, err := g.Order(); err != nil || strings.Join(order, ",") != "gamma,beta,alpha" {
+		t.Fatalf("order: %v, %v", order, err)
+	}
+	if cycles := g.Cycles(); len(cycles) != 0 {
+		t.Fatalf("cycles: %v", cycles)
+	}
+
+	g = m.DepGraph(true)
+	if imports := g.Imports("alpha"); strings.Join(imports, ",") != "beta,fmt" {
+		t.Fatalf("imports: %v", imports)
+	}
+	wantDOT := "digraph deps {\n" +
+		"\t\"fmt\" [style=dashed];\n" +
+		"\t\"strings\" [style=dashed];\n" +
+		"\t\"alpha\" -> \"beta\";\n" +
+		"\t\"alpha\" -> \"fmt\";\n" +
+		"\t\"beta\" -> \"gamma\";\n" +
+		"\t\"gamma\" -> \"strings\";\n" +
+		"}\n"
+	if dot := g.DOT(); dot != wantDOT {
+		t.Fatalf("DOT:\n%s", dot)
+	}
+	b, err := g.JSON()
+	if err != nil || !strings.Contains(string(b), `{"id":"fmt","path":"fmt","external":true}`) {
+		t.Fatalf("JSON: %s, %v", b, err)
+	}
+
+	// gamma imports alpha
+	m = parseModule(t, "deps_cycle", map[string]string{
+		"a.go": "package alpha\n\nimport _ \"example.com/beta\"\n",
+		"b.go": "package beta\n\nimport _ \"example.com/gamma\"\n",
+		"c.go": "package gamma\n\nimport _ \"example.com/alpha\"\n",
+		"d.go": "package delta\n\nimport _ \"example.com/alpha\"\n",
+	})
+	g = m.DepGraph()
+	if cycles := g.Cycles(); len(cycles) != 1 || strings.Join(cycles[0], ",") != "alpha,beta,gamma" {
+		t.Fatalf("cycles: %v", cycles)
+	}
+	if _, err := g.Order(); err == nil {
+		t.Fatal("want import cycle error")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	var dirs []string
+	for _, name := range []string{"pipeline_a", "pipeline_b", "pipeline_c"} {
+		parseModule(t, name, map[string]string{
+			"a.go": "package p\n\nfunc Hello() {}\n",
+		})
+		dirs = append(dirs, filepath.Join("../_out", name))
+	}
+	dirs = append(dirs[:1], append([]string{"../_out/pipeline_missing"}, dirs[1:]...)...)
+
+	var mu sync.Mutex
+	var running, maxRunning, analyzed int
+	p := &aster.Pipeline{
+		Analyze: func(m *aster.Module) error {
+			mu.Lock()
+			running++
+			analyzed++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		},
+		Generate: func(m *aster.Module) error {
+			for _, fn := range m.Packages["p"].Funcs() {
+				fn.Node().(*ast.FuncDecl).Name.Name += "World"
+			}
+			return nil
+		},
+		LoadWorkers:    2,
+		AnalyzeWorkers: 2,
+	}
+	results, err := p.Run(dirs...)
+	if err == nil || !strings.Contains(err.Error(), "load ../_out/pipeline_missing") {
+		t.Fatalf("want load error, got %v", err)
+	}
+	if len(results) != 4 || results[1].Stage != aster.StageLoad || results[0].Err != nil || results[3].Err != nil {
+		t.Fatalf("results: %v", results)
+	}
+	if analyzed != 3 || maxRunning > 2 {
+		t.Fatalf("analyzed %d, max running %d", analyzed, maxRunning)
+	}
+	if _, ok := results[0].Durations[aster.StageStore]; !ok {
+		t.Fatal("no store duration")
+	}
+	for _, dir := range []string{dirs[0], dirs[2], dirs[3]} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "a.go"))
+		if err != nil || !strings.Contains(string(b), "func HelloWorld()") {
+			t.Fatalf("%s not stored: %s, %v", dir, b, err)
+		}
+	}
+}
+
+func TestRenameAndDiff(t *testing.T) {
+	m := parseModule(t, "rename", map[string]string{
+		"a.go": `package rename
+
+// User is a user.
+type User struct {
+	// Name is the name.
+	Name string
+}
+
+// Greet greets the user.
+func (u *User) Greet() string { return "hi " + u.Name }
+
+const limit = 3
+`,
+		"b.go": `package rename
+
+func NewUser(name string) *User {
+	u := &User{Name: name}
+	_ = u.Greet()
+	return u
+}
+
+var _ = limit
+`,
+	})
+	p := m.Packages["rename"]
+	if err := p.Rename("User", "Account"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rename("Account.Name", "FullName"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rename("Account.Greet", "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rename("limit", "maxUsers"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ from, to string }{
+		{"Account", "NewUser"},
+		{"Account.FullName", "Hello"},
+		{"Missing", "Other"},
+		{"Account", "1x"},
+	} {
+		if err := p.Rename(c.from, c.to); err == nil {
+			t.Fatalf("rename %s to %s: want error", c.from, c.to)
+		}
+	}
+	codes, err := p.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all string
+	for _, code := range codes {
+		all += code
+	}
+	for _, s := range []string{
+		"// Account is a user.\ntype Account struct",
+		"// FullName is the name.\n\tFullName string",
+		"// Hello greets the user.\nfunc (u *Account) Hello() string { return \"hi \" + u.FullName }",
+		"const maxUsers = 3",
+		"func NewUser(name string) *Account {",
+		"u := &Account{FullName: name}",
+		"_ = u.Hello()",
+		"var _ = maxUsers",
+	} {
+		if !strings.Contains(all, s) {
+			t.Fatalf("missing %q in:\n%s", s, all)
+		}
+	}
+
+	var b *aster.File
+	for name, f := range p.Files {
+		if strings.HasSuffix(name, "b.go") {
+			b = f
+		}
+	}
+	diff, err := b.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a/" + b.Filename + "\n+++ b/" + b.Filename + "\n" +
+		"@@ -1,9 +1,9 @@\n" +
+		" package rename\n" +
+		" \n" +
+		"-func NewUser(name string) *User {\n" +
+		"-\tu := &User{Name: name}\n" +
+		"-\t_ = u.Greet()\n" +
+		"+func NewUser(name string) *Account {\n" +
+		"+\tu := &Account{FullName: name}\n" +
+		"+\t_ = u.Hello()\n" +
+		" \treturn u\n" +
+		" }\n" +
+		" \n" +
+		"-var _ = limit\n" +
+		"+var _ = maxUsers\n"
+	if diff != want {
+		t.Fatalf("diff:\n%s", diff)
+	}
+	if err := m.Store(); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := m.Diff(); err != nil || diff != "" {
+		t.Fatalf("diff after storing: %q, %v", diff, err)
+	}
+}
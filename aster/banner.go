@@ -0,0 +1,142 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+// generatedRegexp matches the banner of the generated files,
+// see https://golang.org/s/generatedcode.
+var generatedRegexp = regexp.MustCompile(`^// Code generated (.*)DO NOT EDIT\.$`)
+
+// GeneratedBanner returns the standard banner of the files generated by
+// the generator, e.g. "// Code generated by aster. DO NOT EDIT."
+func GeneratedBanner(generator string) string {
+	return "// Code generated by " + generator + ". DO NOT EDIT."
+}
+
+// IsGenerated reports whether the file carries the banner of the generated
+// files before the package clause, and returns the text between "Code
+// generated" and "DO NOT EDIT", e.g. "by aster." for GeneratedBanner("aster").
+func (f *File) IsGenerated() (string, bool) {
+	return generatedBy(f.File)
+}
+
+// generatedBy returns the text of the banner of the generated files in the
+// comments before the package clause of the file, see File.IsGenerated.
+func generatedBy(file *ast.File) (string, bool) {
+	for _, g := range file.Comments {
+		if g.Pos() >= file.Package {
+			break
+		}
+		for _, c := range g.List {
+			if m := generatedRegexp.FindStringSubmatch(c.Text); m != nil {
+				return strings.TrimSpace(m[1]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// HasHeader reports whether the comments before the package clause
+// of the file contain the header, see FormatOptions.Header.
+func (f *File) HasHeader(header string) bool {
+	return bytes.Contains(leadingComments(f.Src), []byte(headerComment(header)))
+}
+
+// addHeader prepends the header and the banner of the options to the code,
+// unless it has them already.
+func (o *FormatOptions) addHeader(code []byte) []byte {
+	var prefix bytes.Buffer
+	leading := leadingComments(code)
+	if o.Header != "" {
+		if header := headerComment(o.Header); !bytes.Contains(leading, []byte(header)) {
+			prefix.WriteString(header + "\n\n")
+		}
+	}
+	if o.Generator != "" && !hasGeneratedBanner(leading) {
+		prefix.WriteString(GeneratedBanner(o.Generator) + "\n\n")
+	}
+	if prefix.Len() == 0 {
+		return code
+	}
+	return append(prefix.Bytes(), code...)
+}
+
+// headerComment returns the header as line comments,
+// unless it is a comment already.
+func headerComment(header string) string {
+	header = strings.TrimRight(header, "\n")
+	lines := strings.Split(header, "\n")
+	isComment := strings.HasPrefix(header, "/*")
+	if !isComment {
+		isComment = true
+		for _, line := range lines {
+			if line != "" && !strings.HasPrefix(line, "//") {
+				isComment = false
+				break
+			}
+		}
+	}
+	if isComment {
+		return header
+	}
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "//"
+		} else {
+			lines[i] = "// " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// leadingComments returns the comments and blank lines at the start of the source.
+func leadingComments(src []byte) []byte {
+	rest := src
+	for len(rest) > 0 {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		trimmed := bytes.TrimSpace(line)
+		switch {
+		case len(trimmed) == 0, bytes.HasPrefix(trimmed, []byte("//")):
+			rest = rest[len(line):]
+		case bytes.HasPrefix(trimmed, []byte("/*")):
+			end := bytes.Index(rest, []byte("*/"))
+			if end < 0 {
+				return src
+			}
+			rest = rest[end+2:]
+		default:
+			return src[:len(src)-len(rest)]
+		}
+	}
+	return src
+}
+
+func hasGeneratedBanner(leading []byte) bool {
+	for _, line := range bytes.Split(leading, []byte("\n")) {
+		if generatedRegexp.Match(bytes.TrimRight(line, "\r")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// Body returns the body of the function, or nil for an interface method
+// or a function declared without body.
+func (f *FuncDecl) Body() *ast.BlockStmt {
+	switch n := f.node.(type) {
+	case *ast.FuncDecl:
+		return n.Body
+	case *ast.FuncLit:
+		return n.Body
+	}
+	return nil
+}
+
+// SetBody replaces the statements of the function body with src.
+// NOTE: The file is reparsed after editing, and the node is rebound to it.
+func (f *FuncDecl) SetBody(src string) error {
+	return f.editBody(src, func(body *ast.BlockStmt) (textEdit, error) {
+		return textEdit{
+			start: f.file.offset(body.Lbrace) + 1,
+			end:   f.file.offset(body.Rbrace),
+			text:  "\n" + src + "\n",
+		}, nil
+	})
+}
+
+// InsertStmtAt inserts the statements of src before the i'th statement
+// of the function body, or at its end if i is the number of statements.
+// NOTE: The file is reparsed after editing, and the node is rebound to it.
+func (f *FuncDecl) InsertStmtAt(i int, src string) error {
+	return f.editBody(src, func(body *ast.BlockStmt) (textEdit, error) {
+		if i < 0 || i > len(body.List) {
+			return textEdit{}, fmt.Errorf("aster: statement index out of range: %d", i)
+		}
+		pos := body.Rbrace
+		if i < len(body.List) {
+			pos = body.List[i].Pos()
+		}
+		// before the comments leading the statement
+		prev := body.Lbrace
+		if i > 0 {
+			prev = body.List[i-1].End()
+		}
+		tf := f.file.FileSet.File(pos)
+		for _, g := range f.file.File.Comments {
+			if prev < g.Pos() && g.End() <= pos && tf.Line(g.Pos()) > tf.Line(prev) {
+				pos = g.Pos()
+				break
+			}
+		}
+		offset := f.file.offset(pos)
+		if start, _ := f.file.lineRange(offset, offset); start < offset {
+			// at the start of the line
+			return textEdit{start: start, end: start, text: src + "\n"}, nil
+		}
+		return textEdit{start: offset, end: offset, text: "\n" + src + "\n"}, nil
+	})
+}
+
+// AppendStmt appends the statements of src to the function body.
+// NOTE: The file is reparsed after editing, and the node is rebound to it.
+func (f *FuncDecl) AppendStmt(src string) error {
+	body := f.Body()
+	if body == nil {
+		return fmt.Errorf("aster: function has no body: %s", f.Name())
+	}
+	return f.InsertStmtAt(len(body.List), src)
+}
+
+// editBody applies the edit of the function body, computed after refreshing
+// the file, and rebinds the node to the reparsed file.
+func (f *FuncDecl) editBody(src string, edit func(body *ast.BlockStmt) (textEdit, error)) error {
+	body := f.Body()
+	if body == nil {
+		return fmt.Errorf("aster: function has no body: %s", f.Name())
+	}
+	if err := checkStmts(src); err != nil {
+		return err
+	}
+	file := f.file
+	index := blockIndex(file.File, body)
+	if index < 0 {
+		return fmt.Errorf("aster: function not in the file: %s", f.Name())
+	}
+	if err := file.refresh(); err != nil {
+		return err
+	}
+	defer f.rebind(file, index)
+	e, err := edit(blockAt(file.File, index))
+	if err != nil {
+		return err
+	}
+	return file.applyEdits([]textEdit{e})
+}
+
+// rebind rebinds the node to the function of the index'th block statement
+// of the reparsed file, see blockIndex.
+func (f *FuncDecl) rebind(file *File, index int) {
+	body := blockAt(file.File, index)
+	for _, n := range file.Nodes {
+		if fn, ok := n.(*FuncDecl); ok && body != nil && fn.Body() == body {
+			*f = *fn
+			return
+		}
+	}
+}
+
+// checkStmts reports an error if src is not a list of statements.
+func checkStmts(src string) error {
+	_, _, err := parseStmts(src)
+	return err
+}
+
+// parseStmts parses the list of statements into a new FileSet.
+func parseStmts(src string) ([]ast.Stmt, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", "package p\nfunc _() {\n"+src+"\n}\n", parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("aster: invalid statements: %w", err)
+	}
+	return file.Decls[0].(*ast.FuncDecl).Body.List, fset, nil
+}
+
+// blockIndex returns the index of the block in the preorder of the blocks
+// of the file, which is kept by formatting.
+func blockIndex(file *ast.File, block *ast.BlockStmt) int {
+	index, i := -1, 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if index >= 0 {
+			return false
+		}
+		if b, ok := n.(*ast.BlockStmt); ok {
+			if b == block {
+				index = i
+			}
+			i++
+		}
+		return true
+	})
+	return index
+}
+
+// blockAt returns the block of the index in the preorder of the blocks of
+// the file, see blockIndex.
+func blockAt(file *ast.File, index int) (block *ast.BlockStmt) {
+	i := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if block != nil {
+			return false
+		}
+		if b, ok := n.(*ast.BlockStmt); ok {
+			if i == index {
+				block = b
+			}
+			i++
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BuilderTagKey is the struct tag key designating a field of the builder
+// as required or optional, e.g. `builder:"required"`, or skipped by "-".
+const BuilderTagKey = "builder"
+
+// Directives designating a field of the builder as required or optional,
+// e.g. `//aster:required`.
+const (
+	requiredDirective = "aster:required"
+	optionalDirective = "aster:optional"
+)
+
+// GenerateBuilder generates the builder of the struct type Foo, i.e. the
+// FooBuilder type created by NewFooBuilder, with the chainable WithBar
+// setter of each exported field Bar, and the Build method returning the
+// struct, or an error naming the required fields not set.
+//
+// A field is required if designated by the `builder:"required"` tag, the
+// `//aster:required` directive or the `validate:"required"` rule, unless
+// designated as optional by the tag or the `//aster:optional` directive,
+// and skipped by the `builder:"-"` tag. The embedded fields are skipped.
+// Build calls the SetDefaults and Validate methods of the struct, if any,
+// see GenerateDefaults and GenerateValidate.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateBuilder() error {
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no builder")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", s.Name())
+	}
+	name := s.Name()
+	builder := name + "Builder"
+	if err := s.file.CheckCollision(builder, "New"+builder); err != nil {
+		return err
+	}
+
+	var fields, setters bytes.Buffer
+	var required []string
+	for _, field := range s.fields {
+		fname := field.Name()
+		if field.Anonymous() || !ast.IsExported(fname) {
+			continue
+		}
+		req, skip := field.builderRequired()
+		if skip {
+			continue
+		}
+		typ := s.file.TryFormatNode(field.Field.Type)
+		param := lowerInitial(fname)
+		if token.IsKeyword(param) || param == "b" {
+			param = "v"
+		}
+		fmt.Fprintf(&setters, "\n// With%s sets %s.\nfunc (b *%s) With%s(%s %s) *%s {\n\tb.v.%s = %s\n",
+			fname, fname, builder, fname, param, typ, builder, fname, param)
+		if req {
+			required = append(required, fname)
+			fmt.Fprintf(&fields, "\thas%s bool\n", fname)
+			fmt.Fprintf(&setters, "\tb.has%s = true\n", fname)
+		}
+		setters.WriteString("\treturn b\n}\n")
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// %s builds %s by the chainable setters, see New%s.\ntype %s struct {\n\tv %s\n%s}\n\n",
+		builder, name, builder, builder, name, fields.String())
+	fmt.Fprintf(&src, "// New%s returns the builder of %s.\nfunc New%s() *%s {\n\treturn &%s{}\n}\n",
+		builder, name, builder, builder, builder)
+	src.Write(setters.Bytes())
+	fmt.Fprintf(&src, "\n// Build returns the built %s, or an error if a required field is not set", name)
+	_, defaults := s.MethodByName("SetDefaults")
+	validate, hasValidate := s.MethodByName("Validate")
+	hasValidate = hasValidate && validate.NumParam() == 0 && validate.NumResult() == 1
+	if hasValidate {
+		src.WriteString(" or it is invalid")
+	}
+	fmt.Fprintf(&src, ".\nfunc (b *%s) Build() (*%s, error) {\n", builder, name)
+	if len(required) > 0 {
+		src.WriteString("\tvar missing []string\n")
+		for _, fname := range required {
+			fmt.Fprintf(&src, "\tif !b.has%s {\n\t\tmissing = append(missing, %q)\n\t}\n", fname, fname)
+		}
+		fmt.Fprintf(&src, "\tif len(missing) > 0 {\n\t\treturn nil, fmt.Errorf(\"%s: missing required fields: %%s\", strings.Join(missing, \", \"))\n\t}\n", builder)
+	}
+	src.WriteString("\tv := b.v\n")
+	if defaults {
+		src.WriteString("\tv.SetDefaults()\n")
+	}
+	if hasValidate {
+		src.WriteString("\tif err := v.Validate(); err != nil {\n\t\treturn nil, err\n\t}\n")
+	}
+	src.WriteString("\treturn &v, nil\n}")
+
+	if err := s.file.appendDecl(name, src.String()); err != nil {
+		return err
+	}
+	if len(required) > 0 {
+		for _, path := range []string{"fmt", "strings"} {
+			if err := s.file.AddImport("", path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// builderRequired reports whether the field is required by the builder,
+// or skipped, see GenerateBuilder.
+func (s *StructField) builderRequired() (required, skip bool) {
+	if tag, err := s.Tags.Get(BuilderTagKey); err == nil {
+		switch tag.Value() {
+		case "-":
+			return false, true
+		case "required":
+			return true, false
+		case "optional":
+			return false, false
+		}
+	}
+	ds := s.Directives()
+	if _, ok := ds.Lookup(optionalDirective); ok {
+		return false, false
+	}
+	if _, ok := ds.Lookup(requiredDirective); ok {
+		return true, false
+	}
+	if tag, err := s.Tags.Get(ValidateTagKey); err == nil {
+		for _, rule := range strings.Split(tag.Value(), ",") {
+			if strings.TrimSpace(rule) == "required" {
+				return true, false
+			}
+		}
+	}
+	return false, false
+}
+
+// lowerInitial returns the name with the initial lower-cased,
+// e.g. "addr" of "Addr", and "url" of "URL".
+func lowerInitial(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	return string(unicode.ToLower(r)) + name[size:]
+}
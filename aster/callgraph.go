@@ -0,0 +1,183 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// CallEdge is a call from the caller to the callee.
+type CallEdge struct {
+	Caller FuncNode
+	Callee FuncNode
+	Pos    token.Position // the position of the call
+}
+
+// CallGraph is the graph of the calls between the functions of a module.
+type CallGraph struct {
+	Edges []*CallEdge // sorted by position
+}
+
+// CallGraph returns the calls between the functions of the module,
+// including the function literals assigned to variables.
+// The static calls of the functions are resolved, and if methods is true,
+// the calls of the methods are resolved by the types of their operands,
+// inferred as Node.References does.
+// The calls outside of any function, e.g. in package-level variables,
+// and the calls of the functions outside the module are left out.
+// NOTE: The module is not type-checked.
+func (m *Module) CallGraph(methods ...bool) *CallGraph {
+	withMethods := len(methods) > 0 && methods[0]
+	g := new(CallGraph)
+	for _, p := range m.Packages {
+		for _, f := range p.Files {
+			ast.Inspect(f.File, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				caller := f.enclosingFunc(call.Pos())
+				if caller == nil {
+					return true
+				}
+				if callee, ok := f.callee(call.Fun, withMethods); ok {
+					g.Edges = append(g.Edges, &CallEdge{
+						Caller: caller,
+						Callee: callee,
+						Pos:    f.FileSet.Position(call.Lparen),
+					})
+				}
+				return true
+			})
+		}
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i].Pos, g.Edges[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return g
+}
+
+// Callers returns the calls of the function.
+func (g *CallGraph) Callers(fn FuncNode) []*CallEdge {
+	var edges []*CallEdge
+	for _, e := range g.Edges {
+		if e.Callee.Node() == fn.Node() {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Callees returns the calls in the function.
+func (g *CallGraph) Callees(fn FuncNode) []*CallEdge {
+	var edges []*CallEdge
+	for _, e := range g.Edges {
+		if e.Caller.Node() == fn.Node() {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// DOT returns the graph in the Graphviz DOT language,
+// with the functions named by SourceID and the repeated calls merged.
+func (g *CallGraph) DOT() string {
+	var lines []string
+	seen := make(map[string]bool)
+	for _, e := range g.Edges {
+		line := fmt.Sprintf("\t%q -> %q;\n", SourceID(e.Caller.(Node)), SourceID(e.Callee.(Node)))
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	var buf bytes.Buffer
+	buf.WriteString("digraph callgraph {\n")
+	for _, line := range lines {
+		buf.WriteString(line)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// enclosingFunc returns the innermost function node of the file
+// enclosing the position.
+func (f *File) enclosingFunc(pos token.Pos) FuncNode {
+	var inner FuncNode
+	for _, n := range f.Nodes {
+		fn, ok := n.(FuncNode)
+		if !ok || pos < n.Node().Pos() || pos >= n.Node().End() {
+			continue
+		}
+		if inner == nil || n.Node().End()-n.Node().Pos() < inner.Node().End()-inner.Node().Pos() {
+			inner = fn
+		}
+	}
+	return inner
+}
+
+// callee returns the function called by the expression.
+func (f *File) callee(fun ast.Expr, methods bool) (FuncNode, bool) {
+	switch x := genericBase(fun).(type) {
+	case *ast.ParenExpr:
+		return f.callee(x.X, methods)
+	case *ast.Ident:
+		if x.Obj != nil && x.Obj.Kind != ast.Fun && x.Obj.Kind != ast.Var {
+			return nil, false
+		}
+		if x.Obj != nil && x.Obj.Kind == ast.Var {
+			// a variable of a function literal
+			if vs, ok := x.Obj.Decl.(*ast.ValueSpec); ok {
+				for i, id := range vs.Names {
+					if id.Name == x.Name && i < len(vs.Values) {
+						if fn, ok := f.Nodes[vs.Values[i].Pos()].(FuncNode); ok {
+							return fn, true
+						}
+					}
+				}
+			}
+			return nil, false
+		}
+		return f.lookupFunc(x.Name)
+	case *ast.SelectorExpr:
+		if p, ok := f.importedPackage(x.X); ok {
+			for _, pf := range p.Files {
+				return pf.lookupFunc(x.Sel.Name)
+			}
+			return nil, false
+		}
+		if !methods {
+			return nil, false
+		}
+		t, ok := f.typeOperand(x.X)
+		if !ok {
+			t, _ = f.inferType(x.X, 0)
+		}
+		if t == nil {
+			return nil, false
+		}
+		return t.MethodByName(x.Sel.Name, true)
+	}
+	return nil, false
+}
@@ -0,0 +1,308 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of the changes, see DiffFiles.
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeType      = "type changed"      // of a type, field, var or const
+	ChangeSignature = "signature changed" // of a function or method
+	ChangeTag       = "tag changed"       // of a struct field
+	ChangeValue     = "value changed"     // of a const
+)
+
+// The objects of the changes.
+const (
+	ObjectType   = "type"
+	ObjectField  = "field"  // of a struct type, named <type>.<field>
+	ObjectMethod = "method" // of a type, named <type>.<method>
+	ObjectFunc   = "func"
+	ObjectVar    = "var"
+	ObjectConst  = "const"
+	// ObjectInterfaceMethod is a method or an embedded type of an interface
+	// type, named <type>.<method> or <type>.<embedded type>.
+	ObjectInterfaceMethod = "interface method"
+)
+
+// Change is a semantic change of a declaration between two versions.
+type Change struct {
+	Kind   string `json:"kind"`   // ChangeAdded, ChangeRemoved, ...
+	Object string `json:"object"` // ObjectType, ObjectField, ...
+	Name   string `json:"name"`   // e.g. "User", "User.Name"
+	// Old and New are the types, signatures, tags or values before and after
+	// the change, or the empty string for an addition or a removal.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// String returns the description of the change, e.g.
+//  field User.Name: type changed: string -> *string
+func (c *Change) String() string {
+	s := fmt.Sprintf("%s %s: %s", c.Object, c.Name, c.Kind)
+	if c.Old != "" || c.New != "" {
+		s += ": " + c.Old + " -> " + c.New
+	}
+	return s
+}
+
+// Breaking reports whether the change may break the users of the package,
+// i.e. it removes or changes an exported declaration, or adds a method to an
+// exported interface.
+func (c *Change) Breaking() bool {
+	for _, name := range strings.Split(c.Name, ".") {
+		if !IsExported(name) {
+			return false
+		}
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return c.Object == ObjectInterfaceMethod
+	case ChangeTag, ChangeValue:
+		return false
+	}
+	return true
+}
+
+// DiffFiles returns the semantic changes of the declarations from the old
+// version of a file to the new one, sorted by name and kind, e.g. the types
+// added, the fields removed, the signatures and the tags changed, rather
+// than a text diff. Either file may be nil, as an empty file.
+func DiffFiles(old, new *File) []*Change {
+	return diffDecls(fileDecls(old), fileDecls(new))
+}
+
+// DiffPackages returns the semantic changes of the declarations from the old
+// version of a package to the new one, wherever they are declared, see
+// DiffFiles. Either package may be nil, as an empty package.
+func DiffPackages(old, new *Package) []*Change {
+	return diffDecls(packageDecls(old), packageDecls(new))
+}
+
+// declEntry is a declaration, or a field or method of a type, to diff.
+type declEntry struct {
+	object string
+	name   string
+	typ    string // the type or the signature
+	tag    string
+	value  string
+}
+
+func packageDecls(p *Package) map[string]*declEntry {
+	decls := make(map[string]*declEntry)
+	if p != nil {
+		for _, f := range p.sortedFiles() {
+			for k, v := range fileDecls(f) {
+				decls[k] = v
+			}
+		}
+	}
+	return decls
+}
+
+// fileDecls returns the declarations of the file by object and name.
+func fileDecls(f *File) map[string]*declEntry {
+	decls := make(map[string]*declEntry)
+	if f == nil {
+		return decls
+	}
+	add := func(e *declEntry) {
+		decls[e.object+" "+e.name] = e
+	}
+	for _, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Name.Name == "_" || d.Name.Name == "init" && d.Recv == nil {
+				continue
+			}
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(&declEntry{object: ObjectFunc, name: d.Name.Name, typ: "func " + d.Name.Name + f.signature(d.Type)})
+				continue
+			}
+			recv, ok := recvBaseIdent(d.Recv.List[0].Type)
+			if !ok {
+				continue
+			}
+			add(&declEntry{
+				object: ObjectMethod,
+				name:   recv.Name + "." + d.Name.Name,
+				typ:    "func (" + f.TryFormatNode(d.Recv.List[0].Type) + ") " + d.Name.Name + f.signature(d.Type),
+			})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					f.typeDecls(s, add)
+				case *ast.ValueSpec:
+					object := ObjectVar
+					if d.Tok == token.CONST {
+						object = ObjectConst
+					}
+					for i, id := range s.Names {
+						if id.Name == "_" {
+							continue
+						}
+						e := &declEntry{object: object, name: id.Name}
+						if s.Type != nil {
+							e.typ = f.TryFormatNode(s.Type)
+						}
+						if object == ObjectConst && i < len(s.Values) {
+							e.value = f.TryFormatNode(s.Values[i])
+						}
+						add(e)
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// typeDecls adds the type, and the fields of a struct type or the methods
+// of an interface type.
+func (f *File) typeDecls(s *ast.TypeSpec, add func(*declEntry)) {
+	name := s.Name.Name
+	var typ string
+	if s.TypeParams != nil {
+		typ = "[" + f.fieldTypes(s.TypeParams, true) + "] "
+	}
+	if s.Assign.IsValid() {
+		typ += "= "
+	}
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		add(&declEntry{object: ObjectType, name: name, typ: typ + "struct"})
+		for _, field := range t.Fields.List {
+			e := &declEntry{object: ObjectField, typ: f.TryFormatNode(field.Type)}
+			if field.Tag != nil {
+				e.tag, _ = strconv.Unquote(field.Tag.Value)
+			}
+			names := field.Names
+			if len(names) == 0 {
+				if id, ok := recvBaseIdent(field.Type); ok {
+					names = []*ast.Ident{id}
+				} else if sel, ok := getElem(field.Type).(*ast.SelectorExpr); ok {
+					names = []*ast.Ident{sel.Sel}
+				}
+			}
+			for _, id := range names {
+				fe := *e
+				fe.name = name + "." + id.Name
+				add(&fe)
+			}
+		}
+	case *ast.InterfaceType:
+		add(&declEntry{object: ObjectType, name: name, typ: typ + "interface"})
+		for _, m := range t.Methods.List {
+			ft, ok := m.Type.(*ast.FuncType)
+			if !ok || len(m.Names) == 0 {
+				// an embedded interface or a type constraint
+				add(&declEntry{object: ObjectInterfaceMethod, name: name + "." + f.TryFormatNode(m.Type)})
+				continue
+			}
+			add(&declEntry{object: ObjectInterfaceMethod, name: name + "." + m.Names[0].Name, typ: "func " + m.Names[0].Name + f.signature(ft)})
+		}
+	default:
+		add(&declEntry{object: ObjectType, name: name, typ: typ + f.TryFormatNode(s.Type)})
+	}
+}
+
+// signature returns the signature of the function type without the names,
+// e.g. "(int, ...string) (bool, error)".
+func (f *File) signature(ft *ast.FuncType) string {
+	var s string
+	if ft.TypeParams != nil {
+		s = "[" + f.fieldTypes(ft.TypeParams, true) + "]"
+	}
+	s += "(" + f.fieldTypes(ft.Params, false) + ")"
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		results := f.fieldTypes(ft.Results, false)
+		if ft.Results.NumFields() > 1 {
+			results = "(" + results + ")"
+		}
+		s += " " + results
+	}
+	return s
+}
+
+// fieldTypes returns the types of the fields, one per name,
+// or with the names if withNames is true, e.g. for the type parameters.
+func (f *File) fieldTypes(list *ast.FieldList, withNames bool) string {
+	var a []string
+	for _, field := range list.List {
+		typ := f.TryFormatNode(field.Type)
+		if len(field.Names) == 0 {
+			a = append(a, typ)
+		}
+		for _, id := range field.Names {
+			if withNames {
+				a = append(a, id.Name+" "+typ)
+			} else {
+				a = append(a, typ)
+			}
+		}
+	}
+	return strings.Join(a, ", ")
+}
+
+// diffDecls returns the changes between the declarations.
+func diffDecls(old, new map[string]*declEntry) []*Change {
+	var changes []*Change
+	for k, o := range old {
+		n, ok := new[k]
+		if !ok {
+			changes = append(changes, &Change{Kind: ChangeRemoved, Object: o.object, Name: o.name})
+			continue
+		}
+		if o.typ != n.typ {
+			kind := ChangeType
+			if o.object == ObjectFunc || o.object == ObjectMethod || o.object == ObjectInterfaceMethod {
+				kind = ChangeSignature
+			}
+			changes = append(changes, &Change{Kind: kind, Object: o.object, Name: o.name, Old: o.typ, New: n.typ})
+		}
+		if o.tag != n.tag {
+			changes = append(changes, &Change{Kind: ChangeTag, Object: o.object, Name: o.name, Old: o.tag, New: n.tag})
+		}
+		if o.value != n.value {
+			changes = append(changes, &Change{Kind: ChangeValue, Object: o.object, Name: o.name, Old: o.value, New: n.value})
+		}
+	}
+	for k, n := range new {
+		if _, ok := old[k]; !ok {
+			changes = append(changes, &Change{Kind: ChangeAdded, Object: n.object, Name: n.name})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.Kind < b.Kind
+	})
+	return changes
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"github.com/henrylee2cn/goutil"
+)
+
+// GenerateClient generates the RPC client stub of the service, a named
+// interface or a type with methods, into the `<snake_name>_client.go` file
+// beside the service declaration. If the service belongs to a package, the
+// file is added to (or replaced in) the package, so that it is written by
+// Package.Store, and recorded in the provenance manifest of the module, see
+// Module.RecordGenerated.
+//
+// For the service Users, the client UsersClient has the exported methods of
+// the service, each marshaling its parameters into a request struct and
+// delegating to the transport, which sends the request and unmarshals the
+// response into the struct of the results:
+//
+//	type UsersTransport interface {
+//		Call(ctx context.Context, method string, req, resp interface{}) error
+//	}
+//
+// The method is named "Users.Get" for Get, the context is the first
+// parameter of type context.Context, if any, or context.Background(), and
+// the fields of the structs are tagged by the names of the parameters and
+// results in JSON. The error of the transport is returned as the last
+// result of type error, or panics if there is none.
+func GenerateClient(service TypeNode) (*File, error) {
+	name := service.Name()
+	if name == "" || service.Kind() != Interface && service.NumMethod(true) == 0 {
+		return nil, fmt.Errorf("aster: not a named interface or a type with methods: %s", name)
+	}
+	file := nodeFile(service.(Node))
+	if file == nil {
+		return nil, fmt.Errorf("aster: no file of the service: %s", name)
+	}
+	client, transport := name+"Client", name+"Transport"
+
+	var methods bytes.Buffer
+	var imports = map[string]bool{"context": true}
+	var importSpecs []string
+	exportedAll := true
+	for i := 0; i < service.NumMethod(true); i++ {
+		// the promoted methods may be declared in other files
+		m, _ := service.Method(i, true)
+		if !ast.IsExported(m.Name()) {
+			exportedAll = false
+			continue
+		}
+		ft, mf := funcTypeOf(m)
+		if ft == nil {
+			continue
+		}
+		for _, imp := range mf.importsOf(ft) {
+			if !imports[imp.Path] {
+				imports[imp.Path] = true
+				importSpecs = append(importSpecs, importSpec(imp))
+			}
+		}
+		writeClientMethod(&methods, mf, name, client, m)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "%s\n\npackage %s\n\nimport (\n\t\"context\"\n", GeneratedBanner("aster"), service.PkgName())
+	for _, spec := range importSpecs {
+		fmt.Fprintf(&src, "\t%s\n", spec)
+	}
+	fmt.Fprintf(&src, ")\n\n// %s sends the calls of the %s methods,\n// marshaling req and unmarshaling the response into resp.\n", transport, name)
+	fmt.Fprintf(&src, "type %s interface {\n\tCall(ctx context.Context, method string, req, resp interface{}) error\n}\n\n", transport)
+	fmt.Fprintf(&src, "// %s is the client of %s, calling the methods through the transport.\n", client, name)
+	fmt.Fprintf(&src, "type %s struct {\n\tTransport %s\n}\n\n", client, transport)
+	fmt.Fprintf(&src, "// New%s returns the client calling the methods through the transport.\n", client)
+	fmt.Fprintf(&src, "func New%s(transport %s) *%s {\n\treturn &%s{Transport: transport}\n}\n", client, transport, client, client)
+	if service.Kind() == Interface && exportedAll {
+		fmt.Fprintf(&src, "\nvar _ %s = (*%s)(nil)\n", name, client)
+	}
+	src.Write(methods.Bytes())
+
+	f, err := file.newSibling(goutil.SnakeString(name)+"_client.go", src.Bytes())
+	if err != nil {
+		return f, err
+	}
+	return f, f.recordGenerated("client", service.(Node))
+}
+
+func writeClientMethod(methods *bytes.Buffer, file *File, service, client string, m FuncNode) {
+	name := m.Name()
+	// reserved identifiers of the method body
+	reserved := map[string]bool{"c": true, "req": true, "resp": true, "err": true, "context": true}
+	ctx := "context.Background()"
+	var params, reqFields, reqValues []string
+	for i := 0; i < m.NumParam(); i++ {
+		p, _ := m.Param(i)
+		pname := p.Name
+		if pname == "" || pname == "_" || reserved[pname] {
+			pname = fmt.Sprintf("a%d", i)
+		}
+		params = append(params, pname+" "+p.TypeName)
+		if i == 0 && file.isContextType(p.TypeName) {
+			ctx = pname
+			continue
+		}
+		typ := p.TypeName
+		if m.IsVariadic() && i == m.NumParam()-1 {
+			typ = "[]" + strings.TrimPrefix(typ, "...")
+		}
+		reqFields = append(reqFields, fmt.Sprintf("%s %s `json:\"%s\"`", clientField(pname), typ, pname))
+		reqValues = append(reqValues, pname)
+	}
+	var results, respFields, respValues []string
+	withErr := false
+	for i := 0; i < m.NumResult(); i++ {
+		r, _ := m.Result(i)
+		results = append(results, r.TypeName)
+		if i == m.NumResult()-1 && r.TypeName == "error" {
+			withErr = true
+			continue
+		}
+		rname := r.Name
+		if rname == "" || rname == "_" {
+			rname = fmt.Sprintf("r%d", i)
+		}
+		respFields = append(respFields, fmt.Sprintf("%s %s `json:\"%s\"`", clientField(rname), r.TypeName, rname))
+		respValues = append(respValues, "resp."+clientField(rname))
+	}
+
+	var resultList string
+	switch len(results) {
+	case 0:
+	case 1:
+		resultList = " " + results[0]
+	default:
+		resultList = " (" + strings.Join(results, ", ") + ")"
+	}
+	fmt.Fprintf(methods, "\n// %s calls %s.%s through the transport.\nfunc (c *%s) %s(%s)%s {\n",
+		name, service, name, client, name, strings.Join(params, ", "), resultList)
+	if len(reqFields) > 0 {
+		fmt.Fprintf(methods, "\treq := struct {\n\t\t%s\n\t}{%s}\n", strings.Join(reqFields, "\n\t\t"), strings.Join(reqValues, ", "))
+	} else {
+		methods.WriteString("\treq := struct{}{}\n")
+	}
+	if len(respFields) > 0 {
+		fmt.Fprintf(methods, "\tvar resp struct {\n\t\t%s\n\t}\n", strings.Join(respFields, "\n\t\t"))
+	} else {
+		methods.WriteString("\tvar resp struct{}\n")
+	}
+	call := fmt.Sprintf("c.Transport.Call(%s, %q, &req, &resp)", ctx, service+"."+name)
+	if withErr {
+		fmt.Fprintf(methods, "\terr := %s\n\treturn %s\n}\n", call, strings.Join(append(respValues, "err"), ", "))
+		return
+	}
+	fmt.Fprintf(methods, "\tif err := %s; err != nil {\n\t\tpanic(err)\n\t}\n", call)
+	if len(respValues) > 0 {
+		fmt.Fprintf(methods, "\treturn %s\n", strings.Join(respValues, ", "))
+	}
+	methods.WriteString("}\n")
+}
+
+// clientField returns the exported field name of the parameter or result.
+func clientField(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// isContextType reports whether the type name of the file is context.Context.
+func (f *File) isContextType(typeName string) bool {
+	i := strings.Index(typeName, ".")
+	if i < 0 || typeName[i+1:] != "Context" {
+		return false
+	}
+	imps, _ := f.LookupImports(typeName[:i])
+	return len(imps) > 0 && imps[0].Path == "context"
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+)
+
+// Clone returns an independent copy of the file, detached from its package.
+// The copy is reparsed from the formatted code, so its positions are
+// reassigned in a new range of the same FileSet.
+func (f *File) Clone() (*File, error) {
+	code, err := f.Format()
+	if err != nil {
+		return nil, err
+	}
+	nf := &File{
+		FileSet:  f.FileSet,
+		Filename: f.Filename,
+		Src:      []byte(code),
+		mode:     f.mode,
+	}
+	return nf, nf.Reparse()
+}
+
+// AddNode appends a copy of the node declaration to the file,
+// adds the imports it references, and returns the new node.
+// The node may come from another file, or be a clone.
+// NOTE: The file is reparsed after adding.
+func (f *File) AddNode(n Node) (Node, error) {
+	name := n.Name()
+	if name == "" || isInterfaceMethod(n) {
+		return nil, fmt.Errorf("aster: node is not a declaration")
+	}
+	if recvTypeName(n) == "" {
+		if err := f.CheckCollision(name); err != nil {
+			return nil, err
+		}
+	}
+	from := nodeFile(n)
+	if from != nil {
+		if err := f.addImportsOf(from, n.Node()); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.appendDecl("", n.String()); err != nil {
+		return nil, err
+	}
+	added, found := f.lookupTopNode(name, n.Kind(), recvTypeName(n))
+	if !found {
+		return nil, fmt.Errorf("aster: failed to add node: %s", name)
+	}
+	return added, nil
+}
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (f *FuncDecl) Clone() Node { return cloneNode(f) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (a *AliasType) Clone() Node { return cloneNode(a) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (b *BasicType) Clone() Node { return cloneNode(b) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (l *ListType) Clone() Node { return cloneNode(l) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (m *MapType) Clone() Node { return cloneNode(m) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (c *ChanType) Clone() Node { return cloneNode(c) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (i *InterfaceType) Clone() Node { return cloneNode(i) }
+
+// Clone returns an independent copy of the node, see cloneNode.
+func (s *StructType) Clone() Node { return cloneNode(s) }
+
+// cloneNode returns an independent copy of the node.
+// The copy is reparsed from the formatted code into a detached file,
+// which has the same FileSet and imports as the original file,
+// so its positions never overlap the positions of other files.
+// The methods of a type are not copied.
+// Returns nil if the node can not be formatted.
+func cloneNode(n Node) Node {
+	from := nodeFile(n)
+	if from == nil {
+		return nil
+	}
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n\n", n.PkgName())
+	for _, imp := range from.Imports {
+		fmt.Fprintf(&src, "import %s\n", importSpec(imp))
+	}
+	src.WriteString("\n")
+	name := n.Name()
+	anonymous := name == ""
+	switch {
+	case isInterfaceMethod(n):
+		fmt.Fprintf(&src, "type _ interface {\n%s\n}\n", n.String())
+	case anonymous:
+		name = "_"
+		code, err := from.FormatNode(n.Node())
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&src, "type _ %s\n", code)
+	default:
+		src.WriteString(n.String())
+	}
+	nf := &File{
+		FileSet:  from.FileSet,
+		Filename: from.Filename,
+		Src:      src.Bytes(),
+		mode:     from.mode,
+	}
+	if nf.Reparse() != nil {
+		return nil
+	}
+	if isInterfaceMethod(n) {
+		t, _ := nf.LookupType("_")
+		m, _ := t.Method(0)
+		return m.(Node)
+	}
+	c, found := nf.lookupTopNode(name, n.Kind(), recvTypeName(n))
+	if !found {
+		return nil
+	}
+	if anonymous {
+		superOf(c).namePtr = nil
+	}
+	return c
+}
+
+func (s *super) getSuper() *super { return s }
+
+// superOf returns the common extension info of the node.
+func superOf(n Node) *super {
+	if s, ok := n.(interface{ getSuper() *super }); ok {
+		return s.getSuper()
+	}
+	return nil
+}
+
+// nodeFile returns the file to which the node belongs.
+func nodeFile(n Node) *File {
+	if s := superOf(n); s != nil {
+		return s.file
+	}
+	return nil
+}
+
+// isInterfaceMethod reports whether n is a method declared in an interface.
+func isInterfaceMethod(n Node) bool {
+	_, ok := n.Node().(*ast.Field)
+	return ok
+}
+
+// recvTypeName returns the receiver type name without `*` and type arguments,
+// or the empty string if n is not a method.
+func recvTypeName(n Node) string {
+	if n.Kind() != Func {
+		return ""
+	}
+	if recv, ok := n.Recv(); ok {
+		return baseTypeName(recv.TypeName)
+	}
+	return ""
+}
+
+// lookupTopNode returns the top-level node of the name and kind,
+// whose receiver type name is recv for methods.
+func (f *File) lookupTopNode(name string, kind Kind, recv string) (Node, bool) {
+	for _, decl := range f.File.Decls {
+		var pos = decl.Pos()
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if kind != Func || d.Name.Name != name {
+				continue
+			}
+		case *ast.GenDecl:
+			pos = -1
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.Name == name {
+						pos = s.Type.Pos()
+					}
+				case *ast.ValueSpec:
+					for i, id := range s.Names {
+						if id.Name == name && i < len(s.Values) {
+							pos = s.Values[i].Pos()
+						} else if id.Name == name && s.Type != nil {
+							pos = s.Type.Pos()
+						}
+					}
+				}
+			}
+		}
+		n, ok := f.Nodes[pos]
+		if ok && n.Kind() == kind && recvTypeName(n) == recv {
+			return n, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,287 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// SignatureChange is an exported function whose signature changed
+// between the old and new versions of a module.
+type SignatureChange struct {
+	Package string
+	Name    string
+	Old     FuncNode
+	New     FuncNode
+}
+
+// ChangedSignatures diffs the exported functions, not methods, declared in
+// the packages of both modules, and returns those whose signatures changed,
+// sorted by package and name. The test packages are skipped.
+func ChangedSignatures(old, new *Module) []*SignatureChange {
+	var changes []*SignatureChange
+	for name, np := range new.Packages {
+		op, ok := old.Packages[name]
+		if !ok || strings.HasSuffix(name, "_test") {
+			continue
+		}
+		for _, nf := range np.Funcs() {
+			if !IsExported(nf.Name()) || !isPlainFunc(nf) {
+				continue
+			}
+			for _, of := range op.Funcs() {
+				if of.Name() == nf.Name() && isPlainFunc(of) && !sameSignature(of, nf) {
+					changes = append(changes, &SignatureChange{Package: name, Name: nf.Name(), Old: of, New: nf})
+				}
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Package != changes[j].Package {
+			return changes[i].Package < changes[j].Package
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// isPlainFunc reports whether the node is a function declaration, not a method.
+func isPlainFunc(n FuncNode) bool {
+	d, ok := n.Node().(*ast.FuncDecl)
+	return ok && d.Recv == nil
+}
+
+// CompatConfig configures GenerateCompatShims.
+type CompatConfig struct {
+	// Suffix is appended to the names of the new functions, defaults to "V2".
+	Suffix string
+}
+
+// GenerateCompatShims keeps the old signatures of the changed functions
+// working: each new function is renamed with the suffix, along with its
+// references in the new module, and a deprecated wrapper with the old name
+// and signature is inserted after it, which delegates to it, e.g.
+//  // Deprecated: Use FooV2 instead.
+//  func Foo(a int) string {
+//  	return FooV2(a, *new(bool))
+//  }
+// The arguments are passed by the parameter names, or by the positions if
+// the types match, and the zero values otherwise; the old results are
+// returned from the new results of the same types in order, or zero values.
+// Returns an error if a function is generic, or the new name is taken.
+// NOTE: The files of the new module are reparsed after rewriting,
+// so the nodes must be looked up again.
+func GenerateCompatShims(changes []*SignatureChange, cfg *CompatConfig) error {
+	suffix := "V2"
+	if cfg != nil && cfg.Suffix != "" {
+		suffix = cfg.Suffix
+	}
+	for _, c := range changes {
+		if err := generateCompatShim(c, c.Name+suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func generateCompatShim(c *SignatureChange, newName string) error {
+	if len(c.Old.TypeParams()) > 0 || len(c.New.TypeParams()) > 0 {
+		return fmt.Errorf("aster: can not generate the shim of the generic function %s", c.Name)
+	}
+	oldType, of := funcTypeOf(c.Old)
+	file := nodeFile(c.New.(Node))
+	files, err := file.refreshModule()
+	if err != nil {
+		return err
+	}
+	if err = file.CheckCollision(newName); err != nil {
+		return err
+	}
+	fn, found := file.lookupFunc(c.Name)
+	if !found {
+		return fmt.Errorf("aster: function not found: %s", c.Name)
+	}
+	decl := fn.Node().(*ast.FuncDecl)
+	shim := shimSource(c.Name, newName, of, oldType, file, decl.Type)
+
+	// rename the new function
+	var edits = make(map[*File][]textEdit)
+	edits[file] = append(edits[file], file.textEdit(decl.Name, newName))
+	if decl.Doc != nil {
+		if first := decl.Doc.List[0]; strings.HasPrefix(first.Text, "// "+c.Name+" ") {
+			edits[file] = append(edits[file], file.textEdit(first, "// "+newName+first.Text[len("// "+c.Name):]))
+		}
+	}
+	for _, ref := range fn.References() {
+		edits[ref.File] = append(edits[ref.File], ref.File.textEdit(ref.Ident, newName))
+	}
+	if err = applyFileEdits(files, edits); err != nil {
+		return err
+	}
+
+	if err = file.addImportsOf(of, oldType); err != nil {
+		return err
+	}
+	if err = file.refresh(); err != nil {
+		return err
+	}
+	fn, _ = file.lookupFunc(newName)
+	return file.spliceSource(file.offset(fn.Node().End()), "\n\n"+shim+"\n")
+}
+
+// shimField is a parameter or result of a shim.
+type shimField struct {
+	name     string
+	typ      string
+	variadic bool
+}
+
+// shimFields expands the field list, naming the unnamed fields by the prefix.
+func shimFields(f *File, list *ast.FieldList, prefix string) []*shimField {
+	var fields []*shimField
+	if list == nil {
+		return nil
+	}
+	for _, field := range list.List {
+		typ := field.Type
+		ellipsis, variadic := typ.(*ast.Ellipsis)
+		if variadic {
+			typ = ellipsis.Elt
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: ""}}
+		}
+		for _, id := range names {
+			name := id.Name
+			if name == "" || name == "_" {
+				name = fmt.Sprintf("%s%d", prefix, len(fields))
+			}
+			fields = append(fields, &shimField{name: name, typ: f.TryFormatNode(typ), variadic: variadic})
+		}
+	}
+	return fields
+}
+
+// shimSource returns the source of the deprecated function of the old
+// signature delegating to the new function.
+func shimSource(name, newName string, of *File, oldType *ast.FuncType, nf *File, newType *ast.FuncType) string {
+	oldParams, newParams := shimFields(of, oldType.Params, "p"), shimFields(nf, newType.Params, "p")
+	oldResults, newResults := shimFields(of, oldType.Results, "r"), shimFields(nf, newType.Results, "r")
+
+	// the arguments by the names, then by the positions
+	var args []string
+	used := make(map[*shimField]bool)
+	match := func(p *shimField, olds []*shimField, i int) (*shimField, bool) {
+		for _, o := range olds {
+			if !used[o] && o.name == p.name && o.typ == p.typ && o.variadic == p.variadic {
+				used[o] = true
+				return o, true
+			}
+		}
+		if i < len(olds) && !used[olds[i]] && olds[i].typ == p.typ && olds[i].variadic == p.variadic {
+			used[olds[i]] = true
+			return olds[i], true
+		}
+		return nil, false
+	}
+	for i, p := range newParams {
+		o, ok := match(p, oldParams, i)
+		switch {
+		case ok && p.variadic:
+			args = append(args, o.name+"...")
+		case ok:
+			args = append(args, o.name)
+		case !p.variadic:
+			args = append(args, "*new("+p.typ+")")
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", newName, strings.Join(args, ", "))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s is the compatibility shim of the old signature.\n//\n// Deprecated: Use %s instead.\nfunc %s(", name, newName, name)
+	for i, p := range oldParams {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if p.variadic {
+			fmt.Fprintf(&buf, "%s ...%s", p.name, p.typ)
+		} else {
+			fmt.Fprintf(&buf, "%s %s", p.name, p.typ)
+		}
+	}
+	buf.WriteString(")")
+	if len(oldResults) > 0 {
+		var types []string
+		for _, r := range oldResults {
+			types = append(types, r.typ)
+		}
+		fmt.Fprintf(&buf, " (%s)", strings.Join(types, ", "))
+	}
+	buf.WriteString(" {\n")
+
+	sameResults := len(oldResults) == len(newResults)
+	for i := 0; sameResults && i < len(oldResults); i++ {
+		sameResults = oldResults[i].typ == newResults[i].typ
+	}
+	switch {
+	case len(oldResults) == 0:
+		fmt.Fprintf(&buf, "\t%s\n", call)
+	case sameResults:
+		fmt.Fprintf(&buf, "\treturn %s\n", call)
+	default:
+		// the temporaries are named after the results, avoiding the parameters
+		taken := make(map[string]bool)
+		for _, p := range oldParams {
+			taken[p.name] = true
+		}
+		var vars, rets []string
+		for i, r := range newResults {
+			r.name = fmt.Sprintf("r%d", i)
+			for taken[r.name] {
+				r.name = "_" + r.name
+			}
+			vars = append(vars, "_")
+		}
+		for _, o := range oldResults {
+			ret := "*new(" + o.typ + ")"
+			for j, r := range newResults {
+				if vars[j] == "_" && r.typ == o.typ {
+					vars[j], ret = r.name, r.name
+					break
+				}
+			}
+			rets = append(rets, ret)
+		}
+		if len(newResults) > 0 {
+			assign := "="
+			for _, v := range vars {
+				if v != "_" {
+					assign = ":="
+				}
+			}
+			fmt.Fprintf(&buf, "\t%s %s %s\n", strings.Join(vars, ", "), assign, call)
+		} else {
+			fmt.Fprintf(&buf, "\t%s\n", call)
+		}
+		fmt.Fprintf(&buf, "\treturn %s\n", strings.Join(rets, ", "))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
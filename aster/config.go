@@ -0,0 +1,75 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is the name of the project configuration file.
+const ProjectConfigFile = ".aster.yaml"
+
+// ProjectConfig is the project configuration read from .aster.yaml, e.g.
+//  doc_coverage:
+//    min: 0.8
+//    min_package: 0.5
+//    packages:
+//      internal: 0
+//  import_aliases:
+//    k8s.io/apimachinery/pkg/apis/meta/v1: metav1
+type ProjectConfig struct {
+	DocCoverage   DocCoverageConfig `yaml:"doc_coverage"`
+	ImportAliases ImportAliases     `yaml:"import_aliases"`
+}
+
+// LoadProjectConfig reads the .aster.yaml file in dir or the nearest parent
+// directory, and returns the configuration and the file path.
+// Returns an empty configuration and path if there is no such file.
+func LoadProjectConfig(dir string) (cfg *ProjectConfig, path string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		p := filepath.Join(dir, ProjectConfigFile)
+		if _, err = os.Stat(p); err == nil {
+			cfg, err = ReadProjectConfig(p)
+			return cfg, p, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return new(ProjectConfig), "", nil
+		}
+		dir = parent
+	}
+}
+
+// ReadProjectConfig reads the project configuration file.
+func ReadProjectConfig(filename string) (*ProjectConfig, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var cfg ProjectConfig
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("aster: invalid config file %s: %s", filename, err.Error())
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConformanceReport is the matrix of which local types implement
+// which local and imported interfaces of a package.
+type ConformanceReport struct {
+	Package    string              `json:"package"`
+	Types      []string            `json:"types"`
+	Interfaces []string            `json:"interfaces"`
+	Entries    []*ConformanceEntry `json:"entries"`
+}
+
+// ConformanceEntry is a cell of the conformance matrix.
+// Only the implemented pairs and the near-misses are recorded.
+type ConformanceEntry struct {
+	Type       string `json:"type"`
+	Interface  string `json:"interface"`
+	Implements bool   `json:"implements"`
+	// Missing lists the interface methods not declared on the type.
+	Missing []string `json:"missing,omitempty"`
+	// Mismatched lists the methods declared with a different signature.
+	Mismatched []string `json:"mismatched,omitempty"`
+}
+
+// ConformanceReports returns the conformance report of every package,
+// sorted by package name.
+func (m *Module) ConformanceReports() []*ConformanceReport {
+	reports := make([]*ConformanceReport, 0, len(m.Packages))
+	for _, p := range m.Packages {
+		reports = append(reports, p.ConformanceReport())
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Package < reports[j].Package
+	})
+	return reports
+}
+
+// ConformanceReport computes which local types implement which interfaces.
+// The interfaces are those declared in the package and the exported ones
+// declared in the imported packages of the module (qualified by import name).
+//
+// A type is a near-miss of an interface if it declares some but not all of
+// the interface methods, or declares them with a different signature.
+func (p *Package) ConformanceReport() *ConformanceReport {
+	r := &ConformanceReport{Package: p.Name}
+	var types []TypeNode
+	ifaces := make(map[string]TypeNode)
+	for _, f := range p.Files {
+		f.Inspect(func(n Node) bool {
+			t, ok := n.(TypeNode)
+			if !ok || t.Name() == "" {
+				return true
+			}
+			if t.Kind() == Interface {
+				if t.NumMethod(true) > 0 {
+					ifaces[t.Name()] = t
+				}
+			} else if t.NumMethod(true) > 0 {
+				types = append(types, t)
+			}
+			return true
+		})
+		for _, imp := range f.Imports {
+			pkgs, _ := f.LookupPackages(imp.Name)
+			for _, pkg := range pkgs {
+				for _, t := range pkg.exportedInterfaces() {
+					ifaces[imp.Name+"."+t.Name()] = t
+				}
+			}
+		}
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i].Name() < types[j].Name() })
+	for _, t := range types {
+		r.Types = append(r.Types, t.Name())
+	}
+	for name := range ifaces {
+		r.Interfaces = append(r.Interfaces, name)
+	}
+	sort.Strings(r.Interfaces)
+
+	for _, t := range types {
+		for _, name := range r.Interfaces {
+			iface := ifaces[name]
+			missing, mismatched := diffMethodSet(t, iface)
+			implemented := len(missing) == 0 && len(mismatched) == 0
+			if !implemented && len(missing) == iface.NumMethod(true) {
+				continue // unrelated
+			}
+			r.Entries = append(r.Entries, &ConformanceEntry{
+				Type:       t.Name(),
+				Interface:  name,
+				Implements: implemented,
+				Missing:    missing,
+				Mismatched: mismatched,
+			})
+		}
+	}
+	return r
+}
+
+func (p *Package) exportedInterfaces() (ifaces []TypeNode) {
+	for _, t := range p.Interfaces() {
+		if IsExported(t.Name()) && t.NumMethod(true) > 0 {
+			ifaces = append(ifaces, t)
+		}
+	}
+	return
+}
+
+// diffMethodSet returns the methods of iface which t does not have,
+// and those declared with a different signature.
+func diffMethodSet(t, iface TypeNode) (missing, mismatched []string) {
+	for i := 0; i < iface.NumMethod(true); i++ {
+		um, _ := iface.Method(i, true)
+		cm, ok := t.MethodByName(um.Name(), true)
+		if !ok {
+			missing = append(missing, um.Name())
+		} else if !sameSignature(um, cm) {
+			mismatched = append(mismatched, um.Name())
+		}
+	}
+	return
+}
+
+// Lookup returns the entry of the type and interface pair,
+// or nil if they are unrelated.
+func (r *ConformanceReport) Lookup(typeName, ifaceName string) *ConformanceEntry {
+	for _, e := range r.Entries {
+		if e.Type == typeName && e.Interface == ifaceName {
+			return e
+		}
+	}
+	return nil
+}
+
+// JSON returns the indented JSON encoding of the report.
+func (r *ConformanceReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Markdown returns the report as a Markdown matrix,
+// followed by the details of the near-misses.
+//
+// In the matrix, "✓" means implemented and "~" means near-miss.
+func (r *ConformanceReport) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## Package %s\n\n", r.Package)
+	if len(r.Types) == 0 || len(r.Interfaces) == 0 {
+		buf.WriteString("No types or interfaces to match.\n")
+		return buf.String()
+	}
+	buf.WriteString("| Type |")
+	for _, name := range r.Interfaces {
+		fmt.Fprintf(&buf, " %s |", name)
+	}
+	buf.WriteString("\n|---|")
+	buf.WriteString(strings.Repeat("---|", len(r.Interfaces)))
+	buf.WriteString("\n")
+	for _, typeName := range r.Types {
+		fmt.Fprintf(&buf, "| %s |", typeName)
+		for _, name := range r.Interfaces {
+			cell := " "
+			if e := r.Lookup(typeName, name); e != nil {
+				cell = "~"
+				if e.Implements {
+					cell = "✓"
+				}
+			}
+			fmt.Fprintf(&buf, " %s |", cell)
+		}
+		buf.WriteString("\n")
+	}
+
+	var nearMisses bool
+	for _, e := range r.Entries {
+		if e.Implements {
+			continue
+		}
+		if !nearMisses {
+			buf.WriteString("\n### Near-misses\n\n")
+			nearMisses = true
+		}
+		fmt.Fprintf(&buf, "- `%s` → `%s`", e.Type, e.Interface)
+		if len(e.Missing) > 0 {
+			fmt.Fprintf(&buf, ", missing: %s", strings.Join(e.Missing, ", "))
+		}
+		if len(e.Mismatched) > 0 {
+			fmt.Fprintf(&buf, ", mismatched: %s", strings.Join(e.Mismatched, ", "))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// ConstructorTagKey is the struct tag key of the constructor options of
+// a field, separated by commas: "-" leaves an exported field out of the
+// parameters, "param" takes an unexported one, and "optional" skips the
+// nil-check of the field, e.g. `ctor:"optional"`.
+const ConstructorTagKey = "ctor"
+
+// GenerateConstructor generates the NewFoo constructor of the struct type
+// Foo next to its declaration, taking the exported fields as parameters,
+// in order, see ConstructorTagKey.
+// The pointer, interface, map, channel and function parameters are checked
+// not to be nil, and the SetDefaults and Validate methods of the struct, if
+// any, are called, see GenerateDefaults and GenerateValidate. If any of the
+// checks may fail, the constructor returns an error too.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateConstructor() error {
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no constructor")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", s.Name())
+	}
+	name := s.Name()
+	ctor := "New" + name
+	if err := s.file.CheckCollision(ctor); err != nil {
+		return err
+	}
+	reserved := map[string]bool{"errors": true, "err": true}
+	for _, imp := range s.file.Imports {
+		reserved[imp.Name] = true
+	}
+	recv := receiverName(s)
+	reserved[recv] = true
+
+	var params, values []string
+	var checks bytes.Buffer
+	for _, field := range s.fields {
+		fname := field.Name()
+		if field.Anonymous() || fname == "" || fname == "_" {
+			continue
+		}
+		var exclude, include, optional bool
+		if tag, err := field.Tags.Get(ConstructorTagKey); err == nil {
+			for _, opt := range strings.Split(tag.Value(), ",") {
+				switch strings.TrimSpace(opt) {
+				case "-":
+					exclude = true
+				case "param":
+					include = true
+				case "optional":
+					optional = true
+				}
+			}
+		}
+		if exclude || !include && !token.IsExported(fname) {
+			continue
+		}
+		param := lowerInitial(fname)
+		if token.IsKeyword(param) || reserved[param] {
+			param += "Arg"
+		}
+		params = append(params, param+" "+s.file.TryFormatNode(field.Field.Type))
+		values = append(values, fmt.Sprintf("%s: %s,", fname, param))
+		switch field.underlyingKind() {
+		case Ptr, Interface, Map, Chan, Func:
+			if !optional {
+				fmt.Fprintf(&checks, "\tif %s == nil {\n\t\treturn nil, errors.New(%q)\n\t}\n", param, ctor+": "+fname+" is nil")
+			}
+		}
+	}
+	_, defaults := s.MethodByName("SetDefaults")
+	validate, hasValidate := s.MethodByName("Validate")
+	hasValidate = hasValidate && validate.NumParam() == 0 && validate.NumResult() == 1
+	withErr := checks.Len() > 0 || hasValidate
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// %s returns %s of the fields", ctor, articled(name))
+	switch {
+	case checks.Len() > 0 && hasValidate:
+		src.WriteString(",\n// or an error if a required one is nil or the result is invalid")
+	case checks.Len() > 0:
+		src.WriteString(", or an error if a required one is nil")
+	case hasValidate:
+		src.WriteString(", or an error if it is invalid")
+	}
+	result := "*" + name
+	if withErr {
+		result = "(*" + name + ", error)"
+	}
+	fmt.Fprintf(&src, ".\nfunc %s(%s) %s {\n%s", ctor, strings.Join(params, ", "), result, checks.String())
+	if len(values) > 0 {
+		fmt.Fprintf(&src, "\t%s := &%s{\n\t\t%s\n\t}\n", recv, name, strings.Join(values, "\n\t\t"))
+	} else {
+		fmt.Fprintf(&src, "\t%s := &%s{}\n", recv, name)
+	}
+	if defaults {
+		fmt.Fprintf(&src, "\t%s.SetDefaults()\n", recv)
+	}
+	if hasValidate {
+		fmt.Fprintf(&src, "\tif err := %s.Validate(); err != nil {\n\t\treturn nil, err\n\t}\n", recv)
+	}
+	if withErr {
+		fmt.Fprintf(&src, "\treturn %s, nil\n}", recv)
+	} else {
+		fmt.Fprintf(&src, "\treturn %s\n}", recv)
+	}
+	if err := s.file.appendDecl(name, src.String()); err != nil {
+		return err
+	}
+	if checks.Len() > 0 {
+		return s.file.AddImport("", "errors")
+	}
+	return nil
+}
+
+// underlyingKind returns the kind of the underlying field type, resolving
+// the named types of the package and the imported ones, e.g. Interface for
+// io.Writer, or Suspense if it can not be resolved.
+func (s *StructField) underlyingKind() Kind {
+	if k := s.Kind(); k != Suspense {
+		return k
+	}
+	switch x := genericBase(s.Field.Type).(type) {
+	case *ast.Ident:
+		if t, found := s.file.LookupTypeInPkg(x.Name); found {
+			return t.Underlying()
+		}
+	case *ast.SelectorExpr:
+		if obj, err := s.file.LookupExternalType(s.file.TryFormatNode(x)); err == nil {
+			return typesKind(obj.Type().Underlying())
+		}
+	}
+	return Suspense
+}
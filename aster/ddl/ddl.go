@@ -0,0 +1,377 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ddl generates the CREATE TABLE statements of the struct types of
+// a package, in the SQL dialects of PostgreSQL, MySQL and SQLite, e.g.
+//
+//	type User struct {
+//		ID    int64
+//		Email string  `db:"email" gorm:"size:128;unique"`
+//		Name  *string `gorm:"column:full_name"`
+//	}
+//
+// to, in PostgreSQL,
+//
+//	CREATE TABLE IF NOT EXISTS "users" (
+//	  "id" BIGSERIAL PRIMARY KEY,
+//	  "email" VARCHAR(128) NOT NULL UNIQUE,
+//	  "full_name" TEXT
+//	);
+//
+// The columns are named by the `db` tags, or by the column of the `gorm`
+// tags, or else in snake case, and skipped by "-". Their types follow the
+// kinds of the fields, pointers and sql.Null* types are nullable.
+// The `gorm` tags also set the constraints: primaryKey, autoIncrement,
+// not null, unique, default, size and type. Without a primary key, the ID
+// field is the primary key, auto-incremented if it is an integer.
+package ddl
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+	"github.com/henrylee2cn/goutil"
+)
+
+// Type is the portable type of a column, mapped to SQL by a Dialect.
+type Type int
+
+// The types of the columns.
+const (
+	Bool Type = iota
+	Int32
+	Int64
+	Float32
+	Float64
+	String
+	Bytes
+	Time
+)
+
+// Column is a column of a table.
+type Column struct {
+	Name          string
+	Field         string // the name of the struct field
+	Type          Type
+	SQLType       string // the SQL type set by the tag, overriding Type
+	Size          int    // the size of a string, 0 if unlimited
+	Nullable      bool
+	PrimaryKey    bool
+	AutoIncrement bool
+	Unique        bool
+	Default       string // the default SQL expression, if any
+}
+
+// Table is a table of a struct type.
+type Table struct {
+	Name    string
+	Type    string // the name of the struct type
+	Columns []*Column
+}
+
+// Dialect is a SQL dialect.
+type Dialect interface {
+	// Quote quotes the identifier.
+	Quote(name string) string
+	// Column returns the definition of the column after its name,
+	// i.e. its type and constraints. The primary key is defined by the
+	// table if there are more than one primary key columns, and by the
+	// column otherwise, as inlinePrimaryKey is.
+	Column(c *Column, inlinePrimaryKey bool) string
+}
+
+// Options are the options of Tables and Generate.
+type Options struct {
+	// Filter selects the struct types to generate,
+	// defaults to the exported ones.
+	Filter func(t aster.TypeNode) bool
+	// TableName returns the table name of the struct type, defaults to the
+	// plural of the snake case of the type name, e.g. "users" for User.
+	TableName func(t aster.TypeNode) string
+}
+
+// Generate returns the CREATE TABLE statements in the dialect of the struct
+// types of the package selected by the options, which may be nil.
+func Generate(p *aster.Package, d Dialect, opts *Options) ([]byte, error) {
+	tables, err := Tables(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("-- " + strings.TrimPrefix(aster.GeneratedBanner("aster"), "// ") + "\n")
+	for _, t := range tables {
+		buf.WriteString("\n")
+		buf.WriteString(t.CreateSQL(d))
+	}
+	return buf.Bytes(), nil
+}
+
+// Tables returns the tables of the struct types of the package selected by
+// the options, which may be nil, sorted by file name and position.
+// Returns an error if a field type has no column type, e.g. a slice
+// other than []byte, or a struct type other than time.Time.
+func Tables(p *aster.Package, opts *Options) ([]*Table, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Filter == nil {
+		o.Filter = func(t aster.TypeNode) bool { return aster.IsExported(t.Name()) }
+	}
+	if o.TableName == nil {
+		o.TableName = func(t aster.TypeNode) string { return plural(goutil.SnakeString(t.Name())) }
+	}
+	var tables []*Table
+	for _, t := range p.Structs() {
+		if !o.Filter(t) {
+			continue
+		}
+		if len(t.TypeParams()) > 0 {
+			return nil, fmt.Errorf("ddl: generic type: %s", t.Name())
+		}
+		table := &Table{Name: o.TableName(t), Type: t.Name()}
+		if err := columns(p, table, t, t.Node().(*ast.StructType)); err != nil {
+			return nil, err
+		}
+		setPrimaryKey(table)
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// CreateSQL returns the CREATE TABLE statement of the table in the dialect.
+func (t *Table) CreateSQL(d Dialect) string {
+	var keys []string
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			keys = append(keys, d.Quote(c.Name))
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE IF NOT EXISTS %s (\n", d.Quote(t.Name))
+	for i, c := range t.Columns {
+		fmt.Fprintf(&buf, "  %s %s", d.Quote(c.Name), d.Column(c, len(keys) == 1))
+		if i < len(t.Columns)-1 || len(keys) > 1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	if len(keys) > 1 {
+		fmt.Fprintf(&buf, "  PRIMARY KEY (%s)\n", strings.Join(keys, ", "))
+	}
+	buf.WriteString(");\n")
+	return buf.String()
+}
+
+// columns appends the columns of the fields of the struct type of t,
+// with those of the embedded struct types of the package promoted.
+func columns(p *aster.Package, table *Table, t aster.TypeNode, st *ast.StructType) error {
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			v, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(v)
+		}
+		if tag.Get("db") == "-" || tag.Get("gorm") == "-" {
+			continue
+		}
+		if len(field.Names) == 0 {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			id, ok := typ.(*ast.Ident)
+			var et aster.TypeNode
+			if ok {
+				et, ok = p.LookupType(id.Name)
+			}
+			if !ok || et.Kind() != aster.Struct {
+				return fmt.Errorf("ddl: %s: unsupported embedded type: %s", t.Name(), types.ExprString(field.Type))
+			}
+			if err := columns(p, table, et, et.Node().(*ast.StructType)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, id := range field.Names {
+			if !id.IsExported() {
+				continue
+			}
+			c := &Column{Field: id.Name}
+			if err := c.setType(p, t, field.Type); err != nil {
+				return fmt.Errorf("ddl: %s.%s: %s", t.Name(), id.Name, err)
+			}
+			if err := c.parseTags(tag); err != nil {
+				return fmt.Errorf("ddl: %s.%s: %s", t.Name(), id.Name, err)
+			}
+			if c.Name == "" {
+				c.Name = goutil.SnakeString(id.Name)
+			}
+			table.Columns = append(table.Columns, c)
+		}
+	}
+	return nil
+}
+
+// setPrimaryKey makes the ID column the primary key of the table without one.
+func setPrimaryKey(table *Table) {
+	for _, c := range table.Columns {
+		if c.PrimaryKey {
+			return
+		}
+	}
+	for _, c := range table.Columns {
+		if c.Field == "ID" {
+			c.PrimaryKey, c.Nullable = true, false
+			c.AutoIncrement = c.Type == Int32 || c.Type == Int64
+			return
+		}
+	}
+}
+
+// nullTypes are the types of the database/sql nullable types.
+var nullTypes = map[string]Type{
+	"NullBool":    Bool,
+	"NullByte":    Int32,
+	"NullInt16":   Int32,
+	"NullInt32":   Int32,
+	"NullInt64":   Int64,
+	"NullFloat64": Float64,
+	"NullString":  String,
+	"NullTime":    Time,
+}
+
+// basicKinds are the kinds of the Go basic types.
+var basicKinds = map[string]aster.Kind{
+	"bool": aster.Bool, "string": aster.String,
+	"int": aster.Int, "int8": aster.Int8, "int16": aster.Int16, "int32": aster.Int32, "int64": aster.Int64,
+	"uint": aster.Uint, "uint8": aster.Uint8, "uint16": aster.Uint16, "uint32": aster.Uint32, "uint64": aster.Uint64,
+	"byte": aster.Uint8, "rune": aster.Int32, "float32": aster.Float32, "float64": aster.Float64,
+}
+
+// setType sets the type and the nullability of the column by the field type.
+func (c *Column) setType(p *aster.Package, t aster.TypeNode, typ ast.Expr) error {
+	switch x := typ.(type) {
+	case *ast.StarExpr:
+		c.Nullable = true
+		return c.setType(p, t, x.X)
+	case *ast.ArrayType:
+		if id, ok := x.Elt.(*ast.Ident); ok && x.Len == nil && (id.Name == "byte" || id.Name == "uint8") {
+			c.Type = Bytes
+			return nil
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok {
+			switch path := t.File().LookupImportPath(pkg.Name); {
+			case path == "time" && x.Sel.Name == "Time":
+				c.Type = Time
+				return nil
+			case path == "database/sql":
+				if nt, ok := nullTypes[x.Sel.Name]; ok {
+					c.Type, c.Nullable = nt, true
+					return nil
+				}
+			}
+		}
+	case *ast.Ident:
+		kind, ok := basicKinds[x.Name]
+		if !ok {
+			n, found := p.LookupType(x.Name)
+			if !found {
+				break
+			}
+			if u, ok := n.Node().(ast.Expr); ok && n.Kind() != aster.Struct && u != typ {
+				return c.setType(p, n, u)
+			}
+			kind = n.Kind()
+		}
+		switch kind {
+		case aster.Bool:
+			c.Type = Bool
+		case aster.Int8, aster.Int16, aster.Int32, aster.Uint8, aster.Uint16:
+			c.Type = Int32
+		case aster.Int, aster.Int64, aster.Uint, aster.Uint32, aster.Uint64:
+			c.Type = Int64
+		case aster.Float32:
+			c.Type = Float32
+		case aster.Float64:
+			c.Type = Float64
+		case aster.String:
+			c.Type = String
+		default:
+			return fmt.Errorf("unsupported kind: %s", kind)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported type: %s", types.ExprString(typ))
+}
+
+// parseTags sets the name and the constraints of the column by the `db`
+// and `gorm` tags.
+func (c *Column) parseTags(tag reflect.StructTag) error {
+	if db := tag.Get("db"); db != "" {
+		c.Name = strings.Split(db, ",")[0]
+	}
+	for _, setting := range strings.Split(tag.Get("gorm"), ";") {
+		key, value := setting, ""
+		if i := strings.Index(setting, ":"); i >= 0 {
+			key, value = setting[:i], setting[i+1:]
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "":
+		case "column":
+			c.Name = value
+		case "primarykey", "primary_key":
+			c.PrimaryKey, c.Nullable = true, false
+		case "autoincrement", "auto_increment":
+			c.AutoIncrement = value != "false"
+		case "not null":
+			c.Nullable = false
+		case "unique":
+			c.Unique = true
+		case "default":
+			c.Default = value
+		case "type":
+			c.SQLType = value
+		case "size":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid size: %q", value)
+			}
+			c.Size = n
+		}
+	}
+	return nil
+}
+
+// plural returns the English plural of the snake case name.
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s") || strings.HasSuffix(name, "x") ||
+		strings.HasSuffix(name, "ch") || strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The dialects of the databases.
+var (
+	Postgres Dialect = postgres{}
+	MySQL    Dialect = mysql{}
+	SQLite   Dialect = sqlite{}
+)
+
+type postgres struct{}
+
+// Quote quotes the identifier.
+func (postgres) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Column returns the definition of the column after its name.
+func (postgres) Column(c *Column, inlinePrimaryKey bool) string {
+	typ := c.SQLType
+	if typ == "" {
+		switch c.Type {
+		case Bool:
+			typ = "BOOLEAN"
+		case Int32:
+			typ = "INTEGER"
+			if c.AutoIncrement {
+				typ = "SERIAL"
+			}
+		case Int64:
+			typ = "BIGINT"
+			if c.AutoIncrement {
+				typ = "BIGSERIAL"
+			}
+		case Float32:
+			typ = "REAL"
+		case Float64:
+			typ = "DOUBLE PRECISION"
+		case String:
+			typ = varchar(c.Size, "TEXT")
+		case Bytes:
+			typ = "BYTEA"
+		case Time:
+			typ = "TIMESTAMP WITH TIME ZONE"
+		}
+	}
+	return typ + constraints(c, inlinePrimaryKey, "")
+}
+
+type mysql struct{}
+
+// Quote quotes the identifier.
+func (mysql) Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Column returns the definition of the column after its name.
+func (mysql) Column(c *Column, inlinePrimaryKey bool) string {
+	typ := c.SQLType
+	if typ == "" {
+		switch c.Type {
+		case Bool:
+			typ = "BOOLEAN"
+		case Int32:
+			typ = "INT"
+		case Int64:
+			typ = "BIGINT"
+		case Float32:
+			typ = "FLOAT"
+		case Float64:
+			typ = "DOUBLE"
+		case String:
+			// TEXT columns can not be keys without a prefix length
+			if c.PrimaryKey || c.Unique {
+				typ = varchar(c.Size, "VARCHAR(255)")
+			} else {
+				typ = varchar(c.Size, "TEXT")
+			}
+		case Bytes:
+			typ = "LONGBLOB"
+		case Time:
+			typ = "DATETIME(3)"
+		}
+	}
+	var autoIncrement string
+	if c.AutoIncrement {
+		autoIncrement = " AUTO_INCREMENT"
+	}
+	return typ + constraints(c, inlinePrimaryKey, autoIncrement)
+}
+
+type sqlite struct{}
+
+// Quote quotes the identifier.
+func (sqlite) Quote(name string) string {
+	return postgres{}.Quote(name)
+}
+
+// Column returns the definition of the column after its name.
+// An auto-increment column must be the only primary key of type INTEGER.
+func (sqlite) Column(c *Column, inlinePrimaryKey bool) string {
+	typ := c.SQLType
+	if typ == "" {
+		switch c.Type {
+		case Bool, Int32, Int64:
+			typ = "INTEGER"
+		case Float32, Float64:
+			typ = "REAL"
+		case String:
+			typ = "TEXT"
+		case Bytes:
+			typ = "BLOB"
+		case Time:
+			typ = "DATETIME"
+		}
+	}
+	var autoIncrement string
+	if c.AutoIncrement && inlinePrimaryKey {
+		autoIncrement = " AUTOINCREMENT"
+	}
+	return typ + constraints(c, inlinePrimaryKey, autoIncrement)
+}
+
+// varchar returns VARCHAR of the size, or def if the size is 0.
+func varchar(size int, def string) string {
+	if size > 0 {
+		return fmt.Sprintf("VARCHAR(%d)", size)
+	}
+	return def
+}
+
+// constraints returns the constraints of the column after its type,
+// with the auto-increment keyword after PRIMARY KEY.
+func constraints(c *Column, inlinePrimaryKey bool, autoIncrement string) string {
+	var b strings.Builder
+	if !c.Nullable && !(c.PrimaryKey && inlinePrimaryKey) {
+		b.WriteString(" NOT NULL")
+	}
+	if c.PrimaryKey && inlinePrimaryKey {
+		b.WriteString(" PRIMARY KEY")
+	}
+	b.WriteString(autoIncrement)
+	if c.Unique && !c.PrimaryKey {
+		b.WriteString(" UNIQUE")
+	}
+	if c.Default != "" {
+		b.WriteString(" DEFAULT " + c.Default)
+	}
+	return b.String()
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultTagKey is the struct tag key declaring the default value of a field.
+const DefaultTagKey = "default"
+
+// defaultDirective is the directive declaring the default value of a field,
+// e.g. `//aster:default 5m`.
+const defaultDirective = "aster:default"
+
+// FieldDefault is the default value declared for a struct field,
+// by the `default:"..."` tag or the `//aster:default <value>` doc annotation.
+type FieldDefault struct {
+	Field *StructField
+	Raw   string // the declared text
+	Expr  string // the Go expression of the value, checked against the field type
+}
+
+// Default returns the default value declared for the field.
+// The tag takes precedence over the doc annotation.
+//
+// The value is parsed according to the field kind: booleans, numbers and strings,
+// time.Duration (e.g. "5m"), pointers to them, and slices of them
+// (comma-separated) are supported. Returns an error if the value is invalid
+// for the field type, e.g. "300" for an int8 field.
+func (s *StructField) Default() (d *FieldDefault, found bool, err error) {
+	raw, found := s.defaultRaw()
+	if !found {
+		return
+	}
+	expr, err := s.file.defaultExpr(s.Field.Type, raw)
+	if err != nil {
+		return nil, true, fmt.Errorf("aster: invalid default value of field %s: %s", s.Name(), err.Error())
+	}
+	return &FieldDefault{Field: s, Raw: raw, Expr: expr}, true, nil
+}
+
+func (s *StructField) defaultRaw() (string, bool) {
+	if tag, err := s.Tags.Get(DefaultTagKey); err == nil {
+		return tag.Value(), true
+	}
+	if d, ok := s.Directives().Lookup(defaultDirective); ok {
+		return strings.Join(d.Args, " "), true
+	}
+	return "", false
+}
+
+// defaultExpr returns the Go expression of raw as a value of the typ type.
+func (f *File) defaultExpr(typ ast.Expr, raw string) (string, error) {
+	if f.isDurationType(typ) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return "", err
+		}
+		return durationExpr(typ.(*ast.SelectorExpr).X.(*ast.Ident).Name, d), nil
+	}
+	kind := f.exprKind(typ)
+	switch kind {
+	case Ptr:
+		elem := typ.(*ast.StarExpr).X
+		expr, err := f.defaultExpr(elem, raw)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("func() *%s { v := %s(%s); return &v }()",
+			f.TryFormatNode(elem), f.TryFormatNode(elem), expr), nil
+	case Slice:
+		elem := typ.(*ast.ArrayType).Elt
+		var elems []string
+		if raw != "" {
+			for _, s := range strings.Split(raw, ",") {
+				expr, err := f.defaultExpr(elem, strings.TrimSpace(s))
+				if err != nil {
+					return "", err
+				}
+				elems = append(elems, expr)
+			}
+		}
+		return fmt.Sprintf("%s{%s}", f.TryFormatNode(typ), strings.Join(elems, ", ")), nil
+	case Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(v), nil
+	case Int, Int8, Int16, Int32, Int64:
+		v, err := strconv.ParseInt(raw, 0, kindBits(kind))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(v, 10), nil
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		v, err := strconv.ParseUint(raw, 0, kindBits(kind))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(v, 10), nil
+	case Float32, Float64:
+		v, err := strconv.ParseFloat(raw, kindBits(kind))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(v, 'g', -1, kindBits(kind)), nil
+	case String:
+		return strconv.Quote(raw), nil
+	}
+	return "", fmt.Errorf("unsupported field type: %s", f.TryFormatNode(typ))
+}
+
+// isDurationType reports whether typ is time.Duration.
+func (f *File) isDurationType(typ ast.Expr) bool {
+	return f.isQualifiedType(typ, "time", "Duration")
+}
+
+// isQualifiedType reports whether typ is the type name declared in
+// the imported package path.
+func (f *File) isQualifiedType(typ ast.Expr, path, name string) bool {
+	sel, ok := typ.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	imps, _ := f.LookupImports(x.Name)
+	for _, imp := range imps {
+		if imp.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// durationExpr returns the readable expression of d,
+// where pkg is the import name of package time.
+func durationExpr(pkg string, d time.Duration) string {
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"Hour", time.Hour},
+		{"Minute", time.Minute},
+		{"Second", time.Second},
+		{"Millisecond", time.Millisecond},
+		{"Microsecond", time.Microsecond},
+	}
+	if d == 0 {
+		return "0"
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d * %s.%s", d/u.d, pkg, u.name)
+		}
+	}
+	return fmt.Sprintf("%d * %s.Nanosecond", d, pkg)
+}
+
+func kindBits(k Kind) int {
+	switch k {
+	case Int8, Uint8:
+		return 8
+	case Int16, Uint16:
+		return 16
+	case Int32, Uint32, Float32:
+		return 32
+	case Int64, Uint64, Uintptr, Float64:
+		return 64
+	}
+	return strconv.IntSize
+}
+
+// zeroCheck returns the expression reporting whether x, of the field type, is zero.
+// Returns false if the field type has no comparable zero value.
+func (s *StructField) zeroCheck(x string) (string, bool) {
+	if s.file.isDurationType(s.Field.Type) {
+		return x + " == 0", true
+	}
+	switch k := s.Kind(); k {
+	case Bool:
+		return "!" + x, true
+	case String:
+		return x + ` == ""`, true
+	case Ptr, Slice, Map, Chan, Func, Interface:
+		return x + " == nil", true
+	default:
+		if k >= Int && k <= Complex128 {
+			return x + " == 0", true
+		}
+	}
+	return "", false
+}
+
+// GenerateDefaults generates the SetDefaults method of the struct type,
+// which sets the zero fields to their declared default values.
+// Config-loading code may call it after decoding,
+// and constructors before returning.
+// Returns an error if any default value is invalid for its field type.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateDefaults() error {
+	const method = "SetDefaults"
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	if _, found := s.MethodByName(method); found {
+		return fmt.Errorf("aster: method already exists: %s.%s", s.Name(), method)
+	}
+	recv := receiverName(s)
+	var body bytes.Buffer
+	for _, field := range s.fields {
+		d, found, err := field.Default()
+		if err != nil {
+			return err
+		}
+		if !found || field.Name() == "" {
+			continue
+		}
+		x := recv + "." + field.Name()
+		cond, ok := field.zeroCheck(x)
+		if !ok {
+			return fmt.Errorf("aster: field %s has no comparable zero value", field.Name())
+		}
+		fmt.Fprintf(&body, "\tif %s {\n\t\t%s = %s\n\t}\n", cond, x, d.Expr)
+	}
+	src := fmt.Sprintf("// %s sets the zero fields to their default values.\nfunc (%s *%s) %s() {\n%s}",
+		method, recv, s.Name(), method, body.String())
+	return s.file.appendDecl(s.Name(), src)
+}
+
+// receiverName returns the receiver name used by the methods of t,
+// or the lower-cased initial of the type name if there is none.
+func receiverName(t TypeNode) string {
+	for i := 0; i < t.NumMethod(); i++ {
+		m, _ := t.Method(i)
+		if recv, ok := m.Recv(); ok && recv.Name != "" && recv.Name != "_" {
+			return recv.Name
+		}
+	}
+	for _, r := range t.Name() {
+		return string(unicode.ToLower(r))
+	}
+	return "x"
+}
@@ -0,0 +1,230 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DepNode is a package of the dependency graph.
+type DepNode struct {
+	// ID is the name of a module package, as the key of Module.Packages,
+	// or the import path of an external package.
+	ID       string `json:"id"`
+	Path     string `json:"path"` // the import path, see Package.Path
+	External bool   `json:"external,omitempty"`
+}
+
+// DepEdge is an import from a package to another, by their IDs.
+type DepEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DepGraph is the import graph of the packages of a module.
+type DepGraph struct {
+	Nodes []*DepNode `json:"nodes"` // sorted by ID
+	Edges []*DepEdge `json:"edges"` // sorted by from and to
+}
+
+// DepGraph returns the import graph between the packages of the module,
+// including the imports of the external packages if external is true.
+// The module packages are matched by the last element of the import path,
+// as Node.References resolves them.
+func (m *Module) DepGraph(external ...bool) *DepGraph {
+	withExternal := len(external) > 0 && external[0]
+	g := new(DepGraph)
+	nodes := make(map[string]*DepNode)
+	edges := make(map[DepEdge]bool)
+	for from, p := range m.Packages {
+		nodes[from] = &DepNode{ID: from, Path: p.Path()}
+		for _, f := range p.Files {
+			for _, imp := range f.Imports {
+				to := imp.Path[strings.LastIndex(imp.Path, "/")+1:]
+				if _, ok := m.Packages[to]; !ok {
+					if !withExternal {
+						continue
+					}
+					to = imp.Path
+					if nodes[to] == nil {
+						nodes[to] = &DepNode{ID: to, Path: to, External: true}
+					}
+				}
+				edges[DepEdge{From: from, To: to}] = true
+			}
+		}
+	}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	for e := range edges {
+		e := e
+		g.Edges = append(g.Edges, &e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return g
+}
+
+// Imports returns the IDs of the packages imported by the package, sorted.
+func (g *DepGraph) Imports(id string) []string {
+	var deps []string
+	for _, e := range g.Edges {
+		if e.From == id {
+			deps = append(deps, e.To)
+		}
+	}
+	return deps
+}
+
+// ImportedBy returns the IDs of the packages importing the package, sorted.
+func (g *DepGraph) ImportedBy(id string) []string {
+	var deps []string
+	for _, e := range g.Edges {
+		if e.To == id {
+			deps = append(deps, e.From)
+		}
+	}
+	return deps
+}
+
+// Cycles returns the IDs of the packages in import cycles, i.e. the strongly
+// connected components of more than one package or of a package importing itself.
+// Each cycle is sorted, and the cycles are sorted by their first packages.
+func (g *DepGraph) Cycles() [][]string {
+	// Tarjan's algorithm
+	var (
+		index   = make(map[string]int)
+		low     = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		cycles  [][]string
+		visit   func(string)
+	)
+	visit = func(v string) {
+		index[v] = len(index)
+		low[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range g.Imports(v) {
+			if _, ok := index[w]; !ok {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var scc []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) > 1 || g.imports(v, v) {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+	for _, n := range g.Nodes {
+		if _, ok := index[n.ID]; !ok {
+			visit(n.ID)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func (g *DepGraph) imports(from, to string) bool {
+	for _, e := range g.Edges {
+		if e.From == from && e.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Order returns the IDs of the packages in the dependency order, each after
+// the packages it imports, which is a safe order to move or rewrite them in.
+// The packages of the same depth are sorted by ID.
+// Returns an error if there are import cycles.
+func (g *DepGraph) Order() ([]string, error) {
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		return nil, fmt.Errorf("aster: import cycle: %s", strings.Join(cycles[0], ", "))
+	}
+	pending := make(map[string]int, len(g.Nodes))
+	for _, n := range g.Nodes {
+		pending[n.ID] = len(g.Imports(n.ID))
+	}
+	var order []string
+	for len(order) < len(g.Nodes) {
+		var ready []string
+		for _, n := range g.Nodes {
+			if d, ok := pending[n.ID]; ok && d == 0 {
+				ready = append(ready, n.ID)
+			}
+		}
+		for _, id := range ready {
+			delete(pending, id)
+			for _, from := range g.ImportedBy(id) {
+				pending[from]--
+			}
+		}
+		order = append(order, ready...)
+	}
+	return order, nil
+}
+
+// DOT returns the graph in the Graphviz DOT language,
+// with the external packages drawn dashed.
+func (g *DepGraph) DOT() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph deps {\n")
+	for _, n := range g.Nodes {
+		if n.External {
+			fmt.Fprintf(&buf, "\t%q [style=dashed];\n", n.ID)
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "\t%q -> %q;\n", e.From, e.To)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// JSON returns the graph in JSON, e.g.
+//  {"nodes":[{"id":"a","path":"example.com/a"},{"id":"fmt","path":"fmt","external":true}],
+//  "edges":[{"from":"a","to":"fmt"}]}
+func (g *DepGraph) JSON() ([]byte, error) {
+	return json.Marshal(g)
+}
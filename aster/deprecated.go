@@ -0,0 +1,171 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Deprecated returns the text of the "Deprecated: " paragraph of the doc
+// comment, without the prefix and joined into one line,
+// or false if the node is not deprecated.
+func (s *super) Deprecated() (reason string, ok bool) {
+	return deprecatedReason(s.Doc())
+}
+
+// Deprecated returns the text of the "Deprecated: " paragraph of the doc
+// comment of the field, or false if it is not deprecated.
+func (s *StructField) Deprecated() (reason string, ok bool) {
+	return deprecatedReason(s.Doc())
+}
+
+func deprecatedReason(doc string) (string, bool) {
+	for _, para := range strings.Split(doc, "\n\n") {
+		if strings.HasPrefix(para, "Deprecated: ") {
+			return strings.Join(strings.Fields(para[len("Deprecated: "):]), " "), true
+		}
+	}
+	return "", false
+}
+
+// SetDeprecated adds the "Deprecated: " paragraph of the reason to the end of
+// the doc comment of the top-level declaration, or replaces the existing one.
+// NOTE: The file is reparsed after adding, so the nodes must be looked up again.
+func (s *super) SetDeprecated(reason string) error {
+	n, ok := s.self()
+	if !ok || s.Name() == "" || isInterfaceMethod(n) {
+		return fmt.Errorf("aster: node is not a declaration")
+	}
+	f, name, kind, recv := s.file, s.Name(), s.kind, recvTypeName(n)
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	if n, ok = f.lookupTopNode(name, kind, recv); !ok {
+		return fmt.Errorf("aster: declaration not found: %s", name)
+	}
+	var lines []string
+	for i, line := range strings.Split(strings.TrimSpace(reason), "\n") {
+		if i == 0 {
+			line = "Deprecated: " + line
+		}
+		lines = append(lines, strings.TrimRight("// "+strings.TrimSpace(line), " "))
+	}
+
+	doc := superOf(n).doc
+	if doc == nil {
+		at := f.declSpecStart(n.Node().Pos())
+		indent := f.indentAt(at)
+		return f.spliceSource(f.lineStart(at), strings.Join(lines, "\n"+indent)+"\n"+indent)
+	}
+	indent := f.indentAt(f.offset(doc.Pos()))
+	// replaces the existing paragraph
+	for i, c := range doc.List {
+		if !strings.HasPrefix(c.Text, "// Deprecated: ") {
+			continue
+		}
+		end := i
+		for end+1 < len(doc.List) && strings.TrimSpace(doc.List[end+1].Text) != "//" {
+			end++
+		}
+		return f.replaceSource(f.offset(c.Pos()), f.offset(doc.List[end].End()), strings.Join(lines, "\n"+indent))
+	}
+	return f.spliceSource(f.offset(doc.End()), "\n"+indent+"//\n"+indent+strings.Join(lines, "\n"+indent))
+}
+
+// declSpecStart returns the offset of the declaration enclosing pos,
+// or of the spec enclosing pos in a grouped declaration.
+func (f *File) declSpecStart(pos token.Pos) int {
+	for _, decl := range f.File.Decls {
+		if pos < decl.Pos() || decl.End() <= pos {
+			continue
+		}
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Lparen.IsValid() {
+			for _, spec := range gd.Specs {
+				if spec.Pos() <= pos && pos < spec.End() {
+					return f.offset(spec.Pos())
+				}
+			}
+		}
+		return f.offset(decl.Pos())
+	}
+	return f.offset(pos)
+}
+
+// lineStart returns the offset of the start of the line of the offset.
+func (f *File) lineStart(offset int) int {
+	return strings.LastIndexByte(string(f.Src[:offset]), '\n') + 1
+}
+
+// indentAt returns the indentation of the line of the offset.
+func (f *File) indentAt(offset int) string {
+	start := f.lineStart(offset)
+	line := string(f.Src[start:offset])
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// DeprecatedUsage is a reference to a deprecated declaration.
+type DeprecatedUsage struct {
+	Node   Node // the deprecated declaration
+	Reason string
+	Ref    Ref
+}
+
+// String returns the usage in one line, e.g.
+// "a.go:12:3: OldFunc is deprecated: Use NewFunc instead."
+func (u *DeprecatedUsage) String() string {
+	name := u.Node.Name()
+	if recv := recvTypeName(u.Node); recv != "" {
+		name = recv + "." + name
+	}
+	return fmt.Sprintf("%s: %s is deprecated: %s", u.Ref.Pos, name, u.Reason)
+}
+
+// DeprecatedUsages returns the references across the module to the
+// deprecated declarations of the module, sorted by position.
+// The references within the deprecated declarations themselves are skipped.
+func (m *Module) DeprecatedUsages() []*DeprecatedUsage {
+	var usages []*DeprecatedUsage
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			for _, n := range f.Nodes {
+				if n.Name() == "" {
+					continue
+				}
+				reason, ok := n.Deprecated()
+				if !ok {
+					continue
+				}
+				for _, ref := range n.References() {
+					if ref.Enclosing == n {
+						continue
+					}
+					usages = append(usages, &DeprecatedUsage{Node: n, Reason: reason, Ref: ref})
+				}
+			}
+		}
+	}
+	sort.SliceStable(usages, func(i, j int) bool {
+		a, b := usages[i].Ref.Pos, usages[j].Ref.Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return usages
+}
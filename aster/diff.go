@@ -0,0 +1,223 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around the changes of a hunk.
+const diffContext = 3
+
+// Diff returns the unified diff from the files on disk to the formatted
+// codes of the module, i.e. what Store would change, sorted by file name,
+// followed by the deletions of the files of the removed packages,
+// see RemovePackage, and the changes of go.mod, see AddRequire.
+func (m *Module) Diff() (string, error) {
+	var buf bytes.Buffer
+	for _, p := range append(m.sortedPackages(), m.removed...) {
+		d, err := p.Diff()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(d)
+	}
+	if m.ModFile != nil && m.ModFile.changed {
+		old, err := ioutil.ReadFile(m.ModFile.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		buf.WriteString(unifiedDiff(m.ModFile.Filename, string(old), string(m.ModFile.Bytes())))
+	}
+	return buf.String(), nil
+}
+
+// Diff returns the unified diff from the files on disk to the formatted
+// codes of the package, sorted by file name, followed by the deletions of
+// the removed files, see RemoveFile.
+func (p *Package) Diff() (string, error) {
+	var buf bytes.Buffer
+	for _, f := range p.sortedFiles() {
+		d, err := f.Diff()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(d)
+	}
+	for _, filename := range p.removed {
+		old, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		buf.WriteString(unifiedDiff(filename, string(old), ""))
+	}
+	return buf.String(), nil
+}
+
+// Diff returns the unified diff from the file on disk, which may not exist,
+// to the formatted code of the file, or the empty string if they are equal.
+func (f *File) Diff() (string, error) {
+	code, err := f.Format()
+	if err != nil {
+		return "", err
+	}
+	old, err := ioutil.ReadFile(f.Filename)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return unifiedDiff(f.Filename, string(old), code), nil
+}
+
+// lineOp is a line of the edit script: ' ' kept, '-' deleted or '+' inserted.
+type lineOp struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the unified diff of the texts, or "" if they are equal.
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+	// the line numbers of a and b before each op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if o.op != '+' {
+			aLine[i+1]++
+		}
+		if o.op != '-' {
+			bLine[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+		// extend the hunk while the changes are close
+		start, end := i-diffContext, i
+		for j := i; j < len(ops) && j <= end+2*diffContext; j++ {
+			if ops[j].op != ' ' {
+				end = j
+			}
+		}
+		if start < 0 {
+			start = 0
+		}
+		stop := end + diffContext + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[stop]-aLine[start]),
+			hunkRange(bLine[start], bLine[stop]-bLine[start]))
+		for _, o := range ops[start:stop] {
+			buf.WriteByte(o.op)
+			buf.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// splitLines splits the text after the newlines.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b by Myers' algorithm.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// backtrack from the end
+	var ops []lineOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+			prevK = k + 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, lineOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			ops = append(ops, lineOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, lineOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, lineOp{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Directive is a machine-readable line comment, such as
+// `//go:generate stringer -type Kind`, `//nolint:errcheck` or `//aster:default 5m`.
+//
+// A directive has no space after `//`, and is either `//nolint` or
+// of the form `//namespace:name args...`.
+// NOTE: Directives are not part of the text returned by Doc.
+type Directive struct {
+	Namespace string    // e.g. "go" for `//go:generate`; empty for `//nolint`
+	Name      string    // e.g. "generate" for `//go:generate`
+	Args      []string  // the space-separated arguments, quoted ones unquoted
+	Text      string    // the raw comment text
+	Pos       token.Pos // the position of the comment
+}
+
+// FullName returns the directive name qualified by the namespace,
+// e.g. "go:generate".
+func (d *Directive) FullName() string {
+	if d.Namespace == "" {
+		return d.Name
+	}
+	return d.Namespace + ":" + d.Name
+}
+
+// Directives is a list of directives.
+type Directives []*Directive
+
+// Filter returns the directives of the full name, e.g. "go:generate".
+func (ds Directives) Filter(fullName string) Directives {
+	var r Directives
+	for _, d := range ds {
+		if d.FullName() == fullName {
+			r = append(r, d)
+		}
+	}
+	return r
+}
+
+// Lookup returns the first directive of the full name, e.g. "aster:default".
+func (ds Directives) Lookup(fullName string) (*Directive, bool) {
+	for _, d := range ds {
+		if d.FullName() == fullName {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// Directives returns the directives in the lead comment of the node.
+func (s *super) Directives() Directives {
+	return parseDirectives(s.doc)
+}
+
+// Directives returns the directives in the lead and line comments of the field.
+func (s *StructField) Directives() Directives {
+	return append(parseDirectives(s.Field.Doc), parseDirectives(s.Field.Comment)...)
+}
+
+// Directives returns all the directives in the file, sorted by position.
+func (f *File) Directives() Directives {
+	var ds Directives
+	for _, g := range f.File.Comments {
+		ds = append(ds, parseDirectives(g)...)
+	}
+	sort.SliceStable(ds, func(i, j int) bool { return ds[i].Pos < ds[j].Pos })
+	return ds
+}
+
+func parseDirectives(g *ast.CommentGroup) Directives {
+	if g == nil {
+		return nil
+	}
+	var ds Directives
+	for _, c := range g.List {
+		if d, ok := parseDirective(c); ok {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+func parseDirective(c *ast.Comment) (*Directive, bool) {
+	text := c.Text
+	if !strings.HasPrefix(text, "//") {
+		return nil, false
+	}
+	line := text[2:]
+	if line == "" || line[0] == ' ' || line[0] == '\t' {
+		return nil, false
+	}
+	head, rest := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		head, rest = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	d := &Directive{Text: text, Pos: c.Pos()}
+	if head == "nolint" || strings.HasPrefix(head, "nolint:") {
+		// the rest is the explanation, e.g. `//nolint:errcheck // reason`
+		d.Name = "nolint"
+		if len(head) > len("nolint:") {
+			d.Args = strings.Split(head[len("nolint:"):], ",")
+		}
+		return d, true
+	}
+	i := strings.Index(head, ":")
+	if i <= 0 || i == len(head)-1 || !isDirectiveWord(head[:i]) || !isDirectiveWord(head[i+1:]) {
+		return nil, false
+	}
+	d.Namespace, d.Name = head[:i], head[i+1:]
+	d.Args = splitArgs(rest)
+	return d, true
+}
+
+func isDirectiveWord(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// splitArgs splits the space-separated arguments,
+// where a double-quoted argument may contain spaces.
+func splitArgs(s string) []string {
+	var args []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return args
+		}
+		if s[0] == '"' {
+			if q := quotedPrefix(s); q != "" {
+				arg, err := strconv.Unquote(q)
+				if err == nil {
+					args = append(args, arg)
+					s = s[len(q):]
+					continue
+				}
+			}
+		}
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			return append(args, s)
+		}
+		args = append(args, s[:i])
+		s = s[i:]
+	}
+}
+
+// quotedPrefix returns the double-quoted string at the beginning of s,
+// or the empty string if s has none.
+func quotedPrefix(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode/utf8"
+)
+
+// DocWidth is the column at which SetDoc and AppendDoc wrap the lines of the
+// lead comments, counting the indentation, with tabs of width 8, and `// `.
+const DocWidth = 80
+
+// SetDoc replaces the lead comment of the node with the text, whose lines
+// are wrapped at DocWidth, except the indented ones, e.g. code blocks.
+// The directives of the comment, e.g. `//go:generate`, are kept after
+// the text, and the comment is removed if there is neither.
+// NOTE: The file is reparsed, so the node is no longer valid.
+func (s *super) SetDoc(text string) error {
+	return s.editDoc(text, false)
+}
+
+// AppendDoc appends the line, wrapped as SetDoc does, to the text of the
+// lead comment of the node, before the directives of it.
+// NOTE: The file is reparsed, so the node is no longer valid.
+func (s *super) AppendDoc(line string) error {
+	return s.editDoc(line, true)
+}
+
+// editDoc replaces or appends to the text of the lead comment.
+func (s *super) editDoc(text string, appending bool) error {
+	self, ok := s.self()
+	if !ok {
+		return fmt.Errorf("aster: node not found in file %s", s.file.Filename)
+	}
+	a, ok := AnchorOf(self)
+	if !ok {
+		return fmt.Errorf("aster: anonymous node has no doc")
+	}
+	f := s.file
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	n, ok := f.lookupAnchor(a)
+	if !ok {
+		return fmt.Errorf("aster: node not found after formatting: %s", a)
+	}
+	owner, doc := f.docOwner(n.Node())
+	if owner == nil {
+		return fmt.Errorf("aster: no declaration of node: %s", a)
+	}
+	return f.editDoc(owner, doc, text, appending)
+}
+
+// editDoc replaces or appends to the text of the lead comment doc, which
+// may be nil, of the syntax node owner, e.g. a declaration or a field.
+// NOTE: Only valid right after refresh or Reparse.
+func (f *File) editDoc(owner ast.Node, doc *ast.CommentGroup, text string, appending bool) error {
+	start := f.offset(owner.Pos())
+	indent := f.lineIndent(start)
+	var lines, directives []string
+	if doc != nil {
+		for _, c := range doc.List {
+			if _, ok := parseDirective(c); ok {
+				directives = append(directives, c.Text)
+			} else if appending {
+				lines = append(lines, c.Text)
+			}
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "//" {
+		lines = lines[:len(lines)-1]
+	}
+	lines = append(lines, wrapDoc(text, DocWidth-indentWidth(indent))...)
+	if len(lines) > 0 && len(directives) > 0 && lines[len(lines)-1] != "//" {
+		// separated as gofmt does
+		lines = append(lines, "//")
+	}
+	lines = append(lines, directives...)
+	comment := strings.Join(lines, "\n"+indent)
+
+	var edit textEdit
+	switch {
+	case doc == nil && len(lines) == 0:
+		return nil
+	case doc == nil:
+		edit = textEdit{start: start, end: start, text: comment + "\n" + indent}
+	case len(lines) == 0:
+		edit = textEdit{start: f.offset(doc.Pos()), end: start}
+	default:
+		edit = f.textEdit(doc, comment)
+	}
+	return f.applyEdits([]textEdit{edit})
+}
+
+// lineIndent returns the indentation of the line of the offset in f.Src,
+// if only blanks precede the offset.
+func (f *File) lineIndent(offset int) string {
+	lineStart := strings.LastIndexByte(string(f.Src[:offset]), '\n') + 1
+	indent := string(f.Src[lineStart:offset])
+	if strings.TrimSpace(indent) != "" {
+		return ""
+	}
+	return indent
+}
+
+// SetDoc replaces the lead comment of the field with the text, as
+// Node.SetDoc does, e.g. to describe the field in the generated schemas.
+// NOTE: The file is reparsed, so the field is no longer valid.
+func (s *StructField) SetDoc(text string) error {
+	field, err := s.refreshed()
+	if err != nil {
+		return err
+	}
+	return s.file.editDoc(field, field.Doc, text, false)
+}
+
+// SetComment replaces the line comment of the field with the text, whose
+// lines are joined by spaces; the empty text removes it.
+// NOTE: The file is reparsed, so the field is no longer valid.
+func (s *StructField) SetComment(text string) error {
+	field, err := s.refreshed()
+	if err != nil {
+		return err
+	}
+	f := s.file
+	text = strings.Join(strings.Fields(text), " ")
+	var edit textEdit
+	switch {
+	case field.Comment == nil && text == "":
+		return nil
+	case field.Comment == nil:
+		end := f.offset(field.End())
+		edit = textEdit{start: end, end: end, text: " // " + text}
+	case text == "":
+		edit = textEdit{start: f.offset(field.End()), end: f.offset(field.Comment.End())}
+	default:
+		edit = f.textEdit(field.Comment, "// "+text)
+	}
+	return f.applyEdits([]textEdit{edit})
+}
+
+// refreshed formats and reparses the file, and returns the syntax node of
+// the field in the struct type declaring it.
+func (s *StructField) refreshed() (*ast.Field, error) {
+	var owner string
+	var index int
+	for _, n := range s.file.Nodes {
+		st, ok := n.(*StructType)
+		if !ok || st.Name() == "" {
+			continue
+		}
+		for i, field := range st.fields {
+			if field == s || field.Field == s.Field {
+				owner, index = st.Name(), i
+			}
+		}
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("aster: field %s not declared by a named struct type", s.Name())
+	}
+	if err := s.file.refresh(); err != nil {
+		return nil, err
+	}
+	t, ok := s.file.LookupTypeInPkg(owner)
+	st, _ := t.(*StructType)
+	if !ok || st == nil || index >= len(st.fields) {
+		return nil, fmt.Errorf("aster: field %s.%s not found after formatting", owner, s.Name())
+	}
+	return st.fields[index].Field, nil
+}
+
+// lookupAnchor returns the node of the anchor in the file.
+func (f *File) lookupAnchor(a Anchor) (Node, bool) {
+	if a.Recv == "" {
+		return f.lookupTopNode(a.Name, a.Kind, "")
+	}
+	t, ok := f.LookupTypeInPkg(a.Recv)
+	if !ok {
+		return nil, false
+	}
+	m, ok := t.MethodByName(a.Name)
+	if !ok || nodeFile(m.(Node)) != f {
+		return nil, false
+	}
+	return m.(Node), true
+}
+
+// docOwner returns the syntax node whose lead comment is the doc of the
+// node, i.e. the declaration, the spec of a grouped declaration, or the
+// method of an interface, and the lead comment of it.
+func (f *File) docOwner(node ast.Node) (ast.Node, *ast.CommentGroup) {
+	pos := node.Pos()
+	for _, decl := range f.File.Decls {
+		if pos < decl.Pos() || pos >= decl.End() {
+			continue
+		}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			return d, d.Doc
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if pos < spec.Pos() || pos >= spec.End() {
+					continue
+				}
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if it, ok := ts.Type.(*ast.InterfaceType); ok && node != ast.Node(it) {
+						for _, m := range it.Methods.List {
+							if m == node {
+								return m, m.Doc
+							}
+						}
+					}
+				}
+				if !d.Lparen.IsValid() {
+					return d, d.Doc
+				}
+				switch x := spec.(type) {
+				case *ast.TypeSpec:
+					return x, x.Doc
+				case *ast.ValueSpec:
+					return x, x.Doc
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// wrapDoc returns the comment lines of the text wrapped at width,
+// except the indented lines.
+func wrapDoc(text string, width int) []string {
+	if text == "" {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case line == "":
+			lines = append(lines, "//")
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			lines = append(lines, "//"+line)
+			continue
+		}
+		cur := "//"
+		for _, word := range strings.Fields(line) {
+			if cur != "//" && utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) > width {
+				lines = append(lines, cur)
+				cur = "//"
+			}
+			cur += " " + word
+		}
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// indentWidth returns the width of the indentation with tabs of width 8.
+func indentWidth(indent string) int {
+	var n int
+	for _, r := range indent {
+		if r == '\t' {
+			n += 8
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// DocCoverageConfig is the thresholds of the documentation coverage,
+// each in the range [0, 1]. A zero threshold is not checked.
+type DocCoverageConfig struct {
+	// Min is the minimum module-wide coverage.
+	Min float64 `yaml:"min"`
+	// MinPackage is the minimum coverage of every package.
+	MinPackage float64 `yaml:"min_package"`
+	// Packages overrides MinPackage by package name.
+	Packages map[string]float64 `yaml:"packages"`
+}
+
+// DocCoverage is the documentation coverage of the exported symbols of a package:
+// constants, variables, types, functions, and methods of exported types.
+// A symbol declared in a documented group, e.g. a const block, is documented.
+// Test files are not counted.
+type DocCoverage struct {
+	Package      string   `json:"package"`
+	Total        int      `json:"total"`
+	Documented   int      `json:"documented"`
+	Undocumented []string `json:"undocumented,omitempty"` // e.g. "Type.Method", sorted
+}
+
+// Ratio returns the fraction of the documented symbols,
+// or 1 if there are no exported symbols.
+func (c *DocCoverage) Ratio() float64 {
+	return ratio(c.Documented, c.Total)
+}
+
+// DocCoverageReport is the documentation coverage of a module.
+type DocCoverageReport struct {
+	Packages   []*DocCoverage `json:"packages"` // sorted by package name
+	Total      int            `json:"total"`
+	Documented int            `json:"documented"`
+}
+
+// Ratio returns the module-wide fraction of the documented symbols,
+// or 1 if there are no exported symbols.
+func (r *DocCoverageReport) Ratio() float64 {
+	return ratio(r.Documented, r.Total)
+}
+
+// Check returns an error describing the coverages below the thresholds,
+// or nil if all pass. CI may exit with a non-zero code on the error.
+func (r *DocCoverageReport) Check(cfg *DocCoverageConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	var fails []string
+	if cfg.Min > 0 && r.Ratio() < cfg.Min {
+		fails = append(fails, fmt.Sprintf("module: %.1f%% < %.1f%%", r.Ratio()*100, cfg.Min*100))
+	}
+	for _, c := range r.Packages {
+		min := cfg.MinPackage
+		if v, ok := cfg.Packages[c.Package]; ok {
+			min = v
+		}
+		if min > 0 && c.Ratio() < min {
+			fails = append(fails, fmt.Sprintf("package %s: %.1f%% < %.1f%%", c.Package, c.Ratio()*100, min*100))
+		}
+	}
+	if len(fails) == 0 {
+		return nil
+	}
+	return fmt.Errorf("aster: documentation coverage below threshold:\n\t%s", strings.Join(fails, "\n\t"))
+}
+
+// String returns the coverage table, one package per line.
+func (r *DocCoverageReport) String() string {
+	var b strings.Builder
+	for _, c := range r.Packages {
+		fmt.Fprintf(&b, "%s\t%d/%d\t%.1f%%\n", c.Package, c.Documented, c.Total, c.Ratio()*100)
+	}
+	fmt.Fprintf(&b, "total\t%d/%d\t%.1f%%\n", r.Documented, r.Total, r.Ratio()*100)
+	return b.String()
+}
+
+// DocCoverage computes the documentation coverage of every package,
+// except the external test packages.
+func (m *Module) DocCoverage() *DocCoverageReport {
+	r := new(DocCoverageReport)
+	for _, p := range m.Packages {
+		if p.IsTest() {
+			continue
+		}
+		c := p.DocCoverage()
+		r.Packages = append(r.Packages, c)
+		r.Total += c.Total
+		r.Documented += c.Documented
+	}
+	sort.Slice(r.Packages, func(i, j int) bool {
+		return r.Packages[i].Package < r.Packages[j].Package
+	})
+	return r
+}
+
+// DocCoverage computes the documentation coverage of the package.
+func (p *Package) DocCoverage() *DocCoverage {
+	c := &DocCoverage{Package: p.Name}
+	for _, f := range p.Files {
+		if f.IsTest() {
+			continue
+		}
+		f.docCoverage(c)
+	}
+	sort.Strings(c.Undocumented)
+	return c
+}
+
+func (f *File) docCoverage(c *DocCoverage) {
+	count := func(name string, docs ...*ast.CommentGroup) {
+		c.Total++
+		for _, doc := range docs {
+			if doc != nil && strings.TrimSpace(doc.Text()) != "" {
+				c.Documented++
+				return
+			}
+		}
+		c.Undocumented = append(c.Undocumented, name)
+	}
+	for _, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if !IsExported(name) {
+				continue
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv := baseTypeName(f.TryFormatNode(d.Recv.List[0].Type))
+				if !IsExported(recv) {
+					continue
+				}
+				name = recv + "." + name
+			}
+			count(name, d.Doc)
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if IsExported(s.Name.Name) {
+						count(s.Name.Name, s.Doc, d.Doc)
+					}
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						if IsExported(id.Name) {
+							count(id.Name, s.Doc, d.Doc, s.Comment)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddImport adds the import path to the file, in the last group of imports.
+// If name is empty, the import is not renamed.
+// It is a no-op if the path is already imported with the same name.
+// NOTE: The file is reparsed after adding.
+func (f *File) AddImport(name, path string) error {
+	for _, imp := range f.Imports {
+		if imp.Path != path {
+			continue
+		}
+		if name == "" || imp.Name == name {
+			return nil
+		}
+	}
+	spec := strconv.Quote(path)
+	if name != "" {
+		spec = name + " " + spec
+	}
+	err := f.refresh()
+	if err != nil {
+		return err
+	}
+	for _, decl := range f.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		if d.Lparen.IsValid() {
+			// appends to the last group of the imports
+			offset := f.offset(d.Rparen)
+			if offset > 0 && f.Src[offset-1] == '\n' {
+				return f.spliceSource(offset, spec+"\n")
+			}
+			return f.spliceSource(offset, "\n"+spec+"\n")
+		}
+		// converts to the parenthesized form
+		start, end := f.offset(d.Specs[0].Pos()), f.offset(d.Specs[0].End())
+		old := string(f.Src[start:end])
+		return f.replaceSource(start, end, "(\n"+old+"\n"+spec+"\n)")
+	}
+	return f.spliceSource(f.offset(f.File.Name.End()), "\n\nimport "+spec+"\n")
+}
+
+// addImportsOf adds the imports referenced by the selector expressions
+// of node to f, where from is the file in which node is declared.
+func (f *File) addImportsOf(from *File, node ast.Node) error {
+	if from == f {
+		return nil
+	}
+	for _, imp := range from.importsOf(node) {
+		name := ""
+		if imp.ImportSpec.Name != nil {
+			name = imp.ImportSpec.Name.Name
+		}
+		if err := f.AddImport(name, imp.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importsOf returns the imports of f referenced by the selector expressions
+// of the nodes.
+func (f *File) importsOf(nodes ...ast.Node) (imports []*Import) {
+	seen := make(map[*Import]bool)
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			x, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			imps, _ := f.LookupImports(x.Name)
+			for _, imp := range imps {
+				if !seen[imp] {
+					seen[imp] = true
+					imports = append(imports, imp)
+				}
+			}
+			return true
+		})
+	}
+	return
+}
+
+// importSpec returns the import spec source text of imp.
+func importSpec(imp *Import) string {
+	if imp.ImportSpec.Name != nil {
+		return imp.ImportSpec.Name.Name + " " + strconv.Quote(imp.Path)
+	}
+	return strconv.Quote(imp.Path)
+}
+
+// newSibling creates a file in the same package and directory as f,
+// replacing the file of the same name, if any.
+func (f *File) newSibling(basename string, src []byte) (*File, error) {
+	nf := &File{
+		FileSet:  f.FileSet,
+		Filename: filepath.Join(filepath.Dir(f.Filename), basename),
+		Src:      src,
+		mode:     f.mode,
+		pkg:      f.pkg,
+	}
+	if f.pkg != nil {
+		f.pkg.Files[nf.Filename] = nf
+	}
+	err := nf.Reparse()
+	if err != nil && f.pkg != nil {
+		delete(f.pkg.Files, nf.Filename)
+	}
+	return nf, err
+}
+
+// refresh formats the file and reparses it,
+// so that f.Src is consistent with the positions of the syntax tree.
+func (f *File) refresh() error {
+	code, err := f.Format()
+	if err != nil {
+		return err
+	}
+	f.Src = []byte(code)
+	return f.Reparse()
+}
+
+// offset returns the offset of pos in f.Src.
+// NOTE: Only valid right after refresh or Reparse.
+func (f *File) offset(pos token.Pos) int {
+	return f.FileSet.File(pos).Offset(pos)
+}
+
+// spliceSource inserts text at the offset of f.Src and reparses the file.
+func (f *File) spliceSource(offset int, text string) error {
+	return f.replaceSource(offset, offset, text)
+}
+
+// replaceSource replaces f.Src[start:end] with text and reparses the file.
+func (f *File) replaceSource(start, end int, text string) error {
+	if start < 0 || end > len(f.Src) || start > end {
+		return fmt.Errorf("aster: invalid source range [%d,%d)", start, end)
+	}
+	src := make([]byte, 0, len(f.Src)-(end-start)+len(text))
+	src = append(src, f.Src[:start]...)
+	src = append(src, text...)
+	src = append(src, f.Src[end:]...)
+	old := f.Src
+	f.Src = src
+	err := f.Reparse()
+	if err != nil {
+		// roll back
+		f.Src = old
+		f.Reparse()
+	}
+	return err
+}
+
+// appendDecl appends the declaration source text to the file, or inserts it
+// after the declaration of the type named after, if the file has one.
+// NOTE: The file is reparsed after inserting.
+func (f *File) appendDecl(after string, src string) error {
+	err := f.refresh()
+	if err != nil {
+		return err
+	}
+	offset := len(f.Src)
+	if d := f.lookupTypeDecl(after); d != nil {
+		offset = f.offset(d.End())
+	}
+	return f.spliceSource(offset, "\n\n"+src+"\n")
+}
+
+// lookupTypeDecl returns the top-level declaration of the named type.
+func (f *File) lookupTypeDecl(name string) *ast.GenDecl {
+	if name == "" {
+		return nil
+	}
+	for _, decl := range f.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			if spec.(*ast.TypeSpec).Name.Name == name {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// textEdit replaces the source text of a node.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// textEdit returns the edit replacing the source text of node with text.
+// NOTE: Only valid right after refresh or Reparse.
+func (f *File) textEdit(node ast.Node, text string) textEdit {
+	return textEdit{start: f.offset(node.Pos()), end: f.offset(node.End()), text: text}
+}
+
+// applyEdits applies the non-overlapping edits to f.Src and reparses the file.
+func (f *File) applyEdits(edits []textEdit) error {
+	if len(edits) == 0 {
+		return nil
+	}
+	src, err := editSource(f.Src, edits)
+	if err != nil {
+		return err
+	}
+	return f.replaceSource(0, len(f.Src), src)
+}
+
+// editSource returns the source with the non-overlapping edits applied.
+func editSource(src []byte, edits []textEdit) (string, error) {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b strings.Builder
+	var last int
+	for _, e := range edits {
+		if e.start < last {
+			return "", fmt.Errorf("aster: overlapping edits at offset %d", e.start)
+		}
+		b.Write(src[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(src[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import "go/ast"
+
+// FlattenFields returns the effective field set of the struct type:
+// its fields followed by the fields promoted through each embedded struct
+// in turn. The embedded fields themselves are included, as reflect.VisibleFields does.
+// A name is resolved as the Go selector rules do: the shallowest field wins,
+// and the name is left out if more than one field has it at that depth.
+// The promoted fields are copies whose Index and Path record the promotion.
+// The embedded structs are resolved in the module.
+func (s *StructType) FlattenFields() []*StructField {
+	var all []*StructField
+	s.walkFields(nil, nil, map[*StructType]bool{s: true}, &all)
+
+	type entry struct {
+		depth int
+		count int
+	}
+	var names = make(map[string]*entry)
+	for _, field := range all {
+		name := field.Name()
+		if name == "" {
+			continue
+		}
+		depth := len(field.Index)
+		e, ok := names[name]
+		switch {
+		case !ok || depth < e.depth:
+			names[name] = &entry{depth: depth, count: 1}
+		case depth == e.depth:
+			e.count++
+		}
+	}
+	var fields []*StructField
+	for _, field := range all {
+		e, ok := names[field.Name()]
+		if ok && e.count == 1 && e.depth == len(field.Index) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// walkFields appends the fields of s and the fields promoted through its
+// embedded structs to all, where index and path lead to s, and visiting
+// holds the structs on the path to avoid cycles.
+func (s *StructType) walkFields(index []int, path []string, visiting map[*StructType]bool, all *[]*StructField) {
+	var embedded []*StructField
+	for i, field := range s.fields {
+		f := *field
+		f.Index = append(append([]int{}, index...), i)
+		f.Path = path
+		*all = append(*all, &f)
+		if field.Anonymous() {
+			embedded = append(embedded, &f)
+		}
+	}
+	for _, field := range embedded {
+		st, ok := field.embeddedStruct()
+		if !ok || visiting[st] {
+			continue
+		}
+		visiting[st] = true
+		p := append(append([]string{}, path...), field.Name())
+		st.walkFields(field.Index, p, visiting, all)
+		delete(visiting, st)
+	}
+}
+
+// embeddedStruct returns the struct type of the embedded field.
+func (s *StructField) embeddedStruct() (*StructType, bool) {
+	t, ok := s.embeddedType()
+	if !ok {
+		return nil, false
+	}
+	st, ok := t.(*StructType)
+	return st, ok
+}
+
+// embeddedType returns the type of the embedded field, resolved in the module.
+func (s *StructField) embeddedType() (TypeNode, bool) {
+	if !s.Anonymous() {
+		return nil, false
+	}
+	return s.file.lookupEmbedded(s.Field.Type)
+}
+
+// lookupEmbedded returns the type of the embedded type expression,
+// resolved in the module.
+func (f *File) lookupEmbedded(typ ast.Expr) (TypeNode, bool) {
+	name := f.TryFormatNode(genericBase(getElem(typ)))
+	return f.LookupTypeInMod(name)
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"encoding/gob"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+)
+
+// encodingVersion is the version of the encoding of the modules,
+// increased on incompatible changes.
+const encodingVersion = 1
+
+// encodedModule is the encoding of a module.
+type encodedModule struct {
+	Version   int
+	Dir       string
+	Mode      parser.Mode
+	AllErrors bool
+	Tests     TestMode
+	Overlay   map[string][]byte
+	Files     []encodedFile // sorted by base
+	Removed   map[string][]string
+	// RemovedPackages is the packages removed, see Module.RemovePackage
+	RemovedPackages []encodedPackage
+	// ModFile is the go.mod file, see Module.ModFile
+	ModFile *encodedModFile
+	// SkipGenerated skips the generated files, see ParseConfig.SkipGenerated
+	SkipGenerated bool
+	// Visibility is the visibility of the loaded nodes, see ParseConfig.Visibility
+	Visibility Visibility
+}
+
+// encodedModFile is the encoding of the go.mod file of a module.
+type encodedModFile struct {
+	Filename string
+	Src      []byte
+	Changed  bool
+}
+
+// encodedPackage is the encoding of a package removed from a module.
+type encodedPackage struct {
+	Name    string
+	Dir     string
+	Removed []string
+}
+
+// encodedFile is the encoding of a file of a module.
+type encodedFile struct {
+	Package  string
+	Filename string
+	Base     int // the base position in the file set
+	Src      []byte
+}
+
+// Encode writes the module in the gob format, to be read by DecodeModule,
+// e.g. by another process, instead of parsing the directory again.
+// The sources of the files are encoded along with their positions in the
+// file set, so the decoded nodes are at the same positions as the nodes of
+// the module.
+// NOTE: The edits of the syntax trees not reflected in the sources are lost,
+// and the filter of the files is not encoded.
+func (m *Module) Encode(w io.Writer) error {
+	e := encodedModule{
+		Version:       encodingVersion,
+		Dir:           m.Dir,
+		Mode:          m.mode,
+		AllErrors:     m.allErrors,
+		Tests:         m.tests,
+		SkipGenerated: m.skipGenerated,
+		Visibility:    m.visibility,
+		Overlay:       m.overlay,
+		Removed:       make(map[string][]string),
+	}
+	for _, p := range m.Packages {
+		for _, f := range p.Files {
+			e.Files = append(e.Files, encodedFile{
+				Package:  p.Name,
+				Filename: f.Filename,
+				Base:     m.FileSet.File(f.File.Pos()).Base(),
+				Src:      f.Src,
+			})
+		}
+		if len(p.removed) > 0 {
+			e.Removed[p.Name] = p.removed
+		}
+	}
+	for _, p := range m.removed {
+		e.RemovedPackages = append(e.RemovedPackages, encodedPackage{Name: p.Name, Dir: p.Dir, Removed: p.removed})
+	}
+	if mf := m.ModFile; mf != nil {
+		e.ModFile = &encodedModFile{Filename: mf.Filename, Src: mf.Bytes(), Changed: mf.changed}
+	}
+	sort.Slice(e.Files, func(i, j int) bool { return e.Files[i].Base < e.Files[j].Base })
+	return gob.NewEncoder(w).Encode(&e)
+}
+
+// DecodeModule reads a module written by Module.Encode.
+func DecodeModule(r io.Reader) (*Module, error) {
+	var e encodedModule
+	if err := gob.NewDecoder(r).Decode(&e); err != nil {
+		return nil, err
+	}
+	if e.Version != encodingVersion {
+		return nil, fmt.Errorf("aster: unsupported encoding version: %d", e.Version)
+	}
+	m := &Module{
+		FileSet:       token.NewFileSet(),
+		Dir:           e.Dir,
+		mode:          e.Mode,
+		allErrors:     e.AllErrors,
+		tests:         e.Tests,
+		skipGenerated: e.SkipGenerated,
+		visibility:    e.Visibility,
+	}
+	// the sources are read by convertFile through the overlay
+	m.overlay = make(map[string][]byte, len(e.Overlay)+len(e.Files))
+	pkgs := make(map[string]*ast.Package)
+	for _, ef := range e.Files {
+		if ef.Base < m.FileSet.Base() {
+			return nil, fmt.Errorf("aster: invalid base of %s: %d", ef.Filename, ef.Base)
+		}
+		if gap := ef.Base - m.FileSet.Base(); gap > 0 {
+			// fill the positions of the files missing, e.g. failed or filtered
+			m.FileSet.AddFile("", -1, gap-1)
+		}
+		file, err := parser.ParseFile(m.FileSet, ef.Filename, ef.Src, m.mode)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok := pkgs[ef.Package]
+		if !ok {
+			pkg = &ast.Package{Name: ef.Package, Files: make(map[string]*ast.File)}
+			pkgs[ef.Package] = pkg
+		}
+		pkg.Files[ef.Filename] = file
+		m.overlay[absPath(ef.Filename)] = ef.Src
+	}
+	m.Packages = make(map[string]*Package, len(pkgs))
+	for k, v := range pkgs {
+		m.Packages[k] = convertPackage(m, m.Dir, v)
+		m.Packages[k].removed = e.Removed[k]
+	}
+	for _, ep := range e.RemovedPackages {
+		p := convertPackage(m, ep.Dir, &ast.Package{Name: ep.Name, Files: make(map[string]*ast.File)})
+		p.removed = ep.Removed
+		m.removed = append(m.removed, p)
+	}
+	if emf := e.ModFile; emf != nil {
+		mf, err := parseModFile(emf.Filename, emf.Src)
+		if err != nil {
+			return nil, err
+		}
+		mf.changed = emf.Changed
+		m.ModFile = mf
+	}
+	m.overlay = e.Overlay
+	return m, nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strings"
+)
+
+// Enum is a named integer type with the constants of an iota block, e.g.
+//  type Kind int
+//  const (
+//  	Invalid Kind = iota
+//  	Bool
+//  )
+type Enum struct {
+	Type   string
+	Values []*EnumValue // in the order of declaration, without "_"
+	// Unsigned reports whether the type is an unsigned integer type.
+	Unsigned bool
+	file     *File
+}
+
+// EnumValue is a constant of an enum.
+type EnumValue struct {
+	Name  string
+	Value constant.Value
+}
+
+// Enums returns the enums of the package, sorted by file name and position.
+func (p *Package) Enums() []*Enum {
+	var enums []*Enum
+	for _, f := range p.sortedFiles() {
+		enums = append(enums, f.Enums()...)
+	}
+	return enums
+}
+
+// Enums returns the enums of the file, i.e. the const blocks whose first
+// constant is of an integer type declared in the package and valued by
+// iota, sorted by position. The block stops at the first constant of
+// another type.
+func (f *File) Enums() []*Enum {
+	var enums []*Enum
+	for _, decl := range f.File.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST || !gd.Lparen.IsValid() {
+			continue
+		}
+		if e, ok := f.enum(gd); ok {
+			enums = append(enums, e)
+		}
+	}
+	return enums
+}
+
+// enum returns the enum of the const block.
+func (f *File) enum(gd *ast.GenDecl) (*Enum, bool) {
+	first := gd.Specs[0].(*ast.ValueSpec)
+	typ, ok := first.Type.(*ast.Ident)
+	if !ok || len(first.Values) == 0 || !usesIota(first.Values[0]) {
+		return nil, false
+	}
+	t, ok := f.LookupTypeInPkg(typ.Name)
+	if !ok {
+		return nil, false
+	}
+	e := &Enum{Type: typ.Name, file: f}
+	switch t.Kind() {
+	case Int, Int8, Int16, Int32, Int64:
+	case Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		e.Unsigned = true
+	default:
+		return nil, false
+	}
+	consts := make(map[string]constant.Value)
+	var values []ast.Expr
+	for i, spec := range gd.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if i > 0 && vs.Type != nil && !isIdent(vs.Type, typ.Name) {
+			break
+		}
+		if len(vs.Values) > 0 {
+			if i > 0 && vs.Type == nil && !typedBy(vs.Values, consts, typ.Name) {
+				break // an untyped constant
+			}
+			values = vs.Values
+		}
+		if len(vs.Names) != len(values) {
+			return nil, false
+		}
+		for j, id := range vs.Names {
+			v, ok := evalConst(values[j], int64(i), consts, typ.Name)
+			if !ok {
+				return nil, false
+			}
+			consts[id.Name] = v
+			if id.Name != "_" {
+				e.Values = append(e.Values, &EnumValue{Name: id.Name, Value: v})
+			}
+		}
+	}
+	return e, true
+}
+
+// GenerateEnum generates the String, MarshalText and UnmarshalText methods
+// and the Parse<Type> function of the enum type into the file
+// <type>_enum.go of the package, replacing the file generated before,
+// and records it in the provenance manifest of the module, see
+// Module.RecordGenerated.
+// The names of the constants of the same value but the first are accepted
+// by Parse<Type> only.
+// Returns an error if the type is not an enum, or if the methods are
+// declared in another file.
+func (p *Package) GenerateEnum(typeName string) (*File, error) {
+	var e *Enum
+	for _, x := range p.Enums() {
+		if x.Type == typeName {
+			e = x
+			break
+		}
+	}
+	if e == nil {
+		return nil, fmt.Errorf("aster: enum not found: %s", typeName)
+	}
+	basename := strings.ToLower(typeName) + "_enum.go"
+	parse := "Parse" + upperFirst(typeName)
+	if !IsExported(typeName) {
+		parse = "parse" + upperFirst(typeName)
+	}
+	var sources []Node
+	if t, ok := p.LookupType(typeName); ok {
+		sources = append(sources, t.(Node))
+		for _, name := range []string{"String", "MarshalText", "UnmarshalText"} {
+			if m, ok := t.MethodByName(name); ok && !strings.HasSuffix(m.Filename(), basename) {
+				return nil, fmt.Errorf("aster: method already exists: %s.%s", typeName, name)
+			}
+		}
+	}
+	f, err := p.AddFile(basename, e.source(p.Name, parse))
+	if err != nil {
+		return f, err
+	}
+	return f, f.recordGenerated("enum", sources...)
+}
+
+// source returns the source of the generated file of the enum.
+func (e *Enum) source(pkgName, parse string) []byte {
+	var names []string // the first names of the distinct values
+	seen := make(map[string]bool)
+	for _, v := range e.Values {
+		if !seen[v.Value.ExactString()] {
+			seen[v.Value.ExactString()] = true
+			names = append(names, v.Name)
+		}
+	}
+	format := "strconv.FormatInt(int64(x), 10)"
+	if e.Unsigned {
+		format = "strconv.FormatUint(uint64(x), 10)"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\npackage %s\n\nimport (\n\t\"fmt\"\n\t\"strconv\"\n)\n", GeneratedBanner("aster"), pkgName)
+	fmt.Fprintf(&buf, "\n// String returns the name of the %s.\nfunc (x %s) String() string {\n\tswitch x {\n", e.Type, e.Type)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\tcase %s:\n\t\treturn %q\n", name, name)
+	}
+	fmt.Fprintf(&buf, "\t}\n\treturn \"%s(\" + %s + \")\"\n}\n", e.Type, format)
+	fmt.Fprintf(&buf, "\n// MarshalText implements encoding.TextMarshaler.\nfunc (x %s) MarshalText() ([]byte, error) {\n\tswitch x {\n\tcase %s:\n\t\treturn []byte(x.String()), nil\n\t}\n\treturn nil, fmt.Errorf(\"invalid %s: %%s\", %s)\n}\n",
+		e.Type, strings.Join(names, ", "), e.Type, format)
+	fmt.Fprintf(&buf, "\n// UnmarshalText implements encoding.TextUnmarshaler.\nfunc (x *%s) UnmarshalText(text []byte) error {\n\tv, err := %s(string(text))\n\tif err != nil {\n\t\treturn err\n\t}\n\t*x = v\n\treturn nil\n}\n",
+		e.Type, parse)
+	fmt.Fprintf(&buf, "\n// %s returns the %s of the name.\nfunc %s(name string) (%s, error) {\n\tswitch name {\n", parse, e.Type, parse, e.Type)
+	for _, v := range e.Values {
+		fmt.Fprintf(&buf, "\tcase %q:\n\t\treturn %s, nil\n", v.Name, v.Name)
+	}
+	fmt.Fprintf(&buf, "\t}\n\treturn 0, fmt.Errorf(\"invalid %s: %%q\", name)\n}\n", e.Type)
+	return buf.Bytes()
+}
+
+// usesIota reports whether the expression refers to iota.
+func usesIota(x ast.Expr) bool {
+	var found bool
+	ast.Inspect(x, func(n ast.Node) bool {
+		if isIdent(n, "iota") {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// typedBy reports whether the untyped values are of the type, i.e. refer to
+// the constants of the type or convert to it.
+func typedBy(values []ast.Expr, consts map[string]constant.Value, typeName string) bool {
+	for _, x := range values {
+		var typed bool
+		ast.Inspect(x, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Ident:
+				_, typed = consts[n.Name]
+			case *ast.CallExpr:
+				typed = isIdent(n.Fun, typeName)
+			}
+			return !typed
+		})
+		if !typed {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdent(n ast.Node, name string) bool {
+	id, ok := n.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// evalConst evaluates the integer constant expression of the const block,
+// with the constants declared before it, and the conversions to the type.
+func evalConst(x ast.Expr, iota int64, consts map[string]constant.Value, typeName string) (constant.Value, bool) {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return evalConst(x.X, iota, consts, typeName)
+	case *ast.BasicLit:
+		if x.Kind == token.INT || x.Kind == token.CHAR {
+			v := constant.MakeFromLiteral(x.Value, x.Kind, 0)
+			return v, v.Kind() != constant.Unknown
+		}
+	case *ast.Ident:
+		if x.Name == "iota" {
+			return constant.MakeInt64(iota), true
+		}
+		v, ok := consts[x.Name]
+		return v, ok
+	case *ast.UnaryExpr:
+		if v, ok := evalConst(x.X, iota, consts, typeName); ok {
+			return constant.UnaryOp(x.Op, v, 0), true
+		}
+	case *ast.BinaryExpr:
+		a, ok := evalConst(x.X, iota, consts, typeName)
+		if !ok {
+			return nil, false
+		}
+		b, ok := evalConst(x.Y, iota, consts, typeName)
+		if !ok {
+			return nil, false
+		}
+		switch x.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(b)
+			if !ok {
+				return nil, false
+			}
+			return constant.Shift(a, x.Op, uint(s)), true
+		case token.QUO:
+			if constant.Sign(b) == 0 {
+				return nil, false
+			}
+			return constant.BinaryOp(a, token.QUO_ASSIGN, b), true
+		case token.ADD, token.SUB, token.MUL, token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+			if x.Op == token.REM && constant.Sign(b) == 0 {
+				return nil, false
+			}
+			return constant.BinaryOp(a, x.Op, b), true
+		}
+	case *ast.CallExpr:
+		if len(x.Args) == 1 && isIdent(x.Fun, typeName) {
+			return evalConst(x.Args[0], iota, consts, typeName)
+		}
+	}
+	return nil, false
+}
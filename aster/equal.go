@@ -0,0 +1,192 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// EqualTagKey is the struct tag key excluding a volatile field from the
+// generated Equal and Hash methods, e.g. `equal:"-"`.
+const EqualTagKey = "equal"
+
+// GenerateEqualHash generates the Equal and Hash methods of the struct type
+// Foo, for using the values as cache keys or in sets:
+//
+//	func (f Foo) Equal(other Foo) bool
+//	func (f Foo) Hash() uint64
+//
+// The fields are compared by ==, or by their own Equal methods if declared
+// in the package, and the others, e.g. slices and maps, by reflect.DeepEqual.
+// Hash is the FNV-1a hash of the formatted fields, or of their own Hash
+// results, so the equal values have the same hash. The pointers are compared
+// and hashed by address. The fields compared by reflect.DeepEqual whose values
+// may hold pointers, e.g. []*T, or interfaces other than error and
+// fmt.Stringer, are left out of the hash, as they are formatted by address.
+// The function fields and the ones tagged "-" are skipped, see EqualTagKey.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateEqualHash() error {
+	name := s.Name()
+	if name == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", name)
+	}
+	for _, method := range []string{"Equal", "Hash"} {
+		if _, found := s.MethodByName(method); found {
+			return fmt.Errorf("aster: method already exists: %s.%s", name, method)
+		}
+	}
+	recv, other, h := receiverName(s), "other", "h"
+	if recv == other {
+		other = "that"
+	}
+	if recv == h {
+		h = "hash"
+	}
+	info := newTypesInfo()
+	if _, err := s.file.checkTypes(info); err != nil {
+		return err
+	}
+	imports := map[string]bool{"hash/fnv": true}
+	var equals []string
+	var hashes bytes.Buffer
+	for _, field := range s.fields {
+		fname := field.Name()
+		if fname == "" || fname == "_" {
+			continue
+		}
+		if tag, err := field.Tags.Get(EqualTagKey); err == nil && tag.Value() == "-" {
+			continue
+		}
+		x, y := recv+"."+fname, other+"."+fname
+		equal, hashed := field.equalMethods()
+		kind := field.underlyingKind()
+		deepEqual := false
+		switch {
+		case kind == Func:
+			continue
+		case equal:
+			equals = append(equals, fmt.Sprintf("%s.Equal(%s)", x, y))
+		case kind >= Bool && kind <= String, kind == Ptr, kind == Chan:
+			equals = append(equals, fmt.Sprintf("%s == %s", x, y))
+		default:
+			// the interfaces may hold the uncomparable values
+			imports["reflect"] = true
+			equals = append(equals, fmt.Sprintf("reflect.DeepEqual(%s, %s)", x, y))
+			deepEqual = true
+		}
+		switch {
+		case hashed:
+			fmt.Fprintf(&hashes, "\tfmt.Fprintf(%s, \"%%d\\x00\", %s.Hash())\n", h, x)
+		case kind == Ptr || kind == Chan:
+			fmt.Fprintf(&hashes, "\tfmt.Fprintf(%s, \"%%p\\x00\", %s)\n", h, x)
+		case deepEqual && formatsPointers(info.TypeOf(field.Field.Type)):
+			continue
+		default:
+			fmt.Fprintf(&hashes, "\tfmt.Fprintf(%s, \"%%v\\x00\", %s)\n", h, x)
+		}
+		imports["fmt"] = true
+	}
+	if len(equals) == 0 {
+		equals = append(equals, "true")
+	}
+	src := fmt.Sprintf("// Equal reports whether the fields of %s and %s are equal.\nfunc (%s %s) Equal(%s %s) bool {\n\treturn %s\n}\n\n"+
+		"// Hash returns the hash of the fields, which is the same for the equal values.\nfunc (%s %s) Hash() uint64 {\n\t%s := fnv.New64a()\n%s\treturn %s.Sum64()\n}",
+		recv, other, recv, name, other, name, strings.Join(equals, " &&\n\t\t"),
+		recv, name, h, hashes.String(), h)
+	if err := s.file.appendDecl(name, src); err != nil {
+		return err
+	}
+	for _, path := range []string{"fmt", "hash/fnv", "reflect"} {
+		if imports[path] {
+			if err := s.file.AddImport("", path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatsPointers reports whether the formatted values of the type may
+// contain the addresses of the pointers they hold, unlike the errors and
+// the fmt.Stringer values, which are formatted by their methods.
+// The unknown types are regarded as holding pointers.
+func formatsPointers(t types.Type) bool {
+	if t == nil {
+		return true
+	}
+	ms := types.NewMethodSet(t)
+	for _, name := range []string{"Error", "String"} {
+		if sel := ms.Lookup(nil, name); sel != nil {
+			if sig, ok := sel.Type().(*types.Signature); ok && sig.Params().Len() == 0 && sig.Results().Len() == 1 {
+				return false
+			}
+		}
+	}
+	return holdsPointers(t, make(map[types.Type]bool))
+}
+
+// holdsPointers reports whether the values of the type may hold pointers.
+func holdsPointers(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Kind() == types.UnsafePointer
+	case *types.Pointer, *types.Interface:
+		return true
+	case *types.Slice:
+		return holdsPointers(u.Elem(), seen)
+	case *types.Array:
+		return holdsPointers(u.Elem(), seen)
+	case *types.Map:
+		return holdsPointers(u.Key(), seen) || holdsPointers(u.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if holdsPointers(u.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalMethods reports whether the field type is a named type of the
+// package with the Equal and Hash methods.
+func (s *StructField) equalMethods() (equal, hash bool) {
+	id, ok := s.Field.Type.(*ast.Ident)
+	if !ok {
+		return false, false
+	}
+	t, found := s.file.LookupTypeInPkg(id.Name)
+	if !found {
+		return false, false
+	}
+	if m, found := t.MethodByName("Equal"); found && m.NumParam() == 1 && m.NumResult() == 1 {
+		equal = true
+	}
+	if m, found := t.MethodByName("Hash"); found && m.NumParam() == 0 && m.NumResult() == 1 {
+		hash = true
+	}
+	return equal, hash
+}
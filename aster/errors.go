@@ -0,0 +1,193 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FileError is an error of reading, parsing or formatting a file.
+type FileError struct {
+	Filename string
+	Pos      token.Position // the position of a syntax error, if known
+	Line     string         // the source line of Pos, if known
+	Err      error
+}
+
+// Error implements error.
+func (e *FileError) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Filename, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// ANSI escape codes coloring Snippet.
+const (
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiReset = "\x1b[0m"
+)
+
+// Snippet returns the error followed by the source line of the position,
+// if known, and a caret marking the column, e.g.
+//
+//	b.go:2:9: expected type, found '{'
+//		func B( {}
+//		        ^
+//
+// The error and the caret are colored by ANSI escape codes if color is true.
+func (e *FileError) Snippet(color bool) string {
+	var b strings.Builder
+	if color {
+		b.WriteString(ansiBold + e.Error() + ansiReset)
+	} else {
+		b.WriteString(e.Error())
+	}
+	if e.Line == "" || e.Pos.Column < 1 {
+		return b.String()
+	}
+	b.WriteString("\n\t" + e.Line + "\n\t")
+	col := e.Pos.Column - 1
+	if col > len(e.Line) {
+		col = len(e.Line)
+	}
+	for _, r := range e.Line[:col] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	if color {
+		b.WriteString(ansiRed + "^" + ansiReset)
+	} else {
+		b.WriteByte('^')
+	}
+	return b.String()
+}
+
+// Errors is a list of the errors of files, sorted by file name and position,
+// collected in the continue-on-error mode, see ParseDirAll and
+// FormatOptions.ContinueOnError.
+type Errors []*FileError
+
+// Error implements error, reporting the first error and the number of
+// the others.
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// Err returns the list as an error, or nil if it is empty.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	e.sort()
+	return e
+}
+
+// Snippet returns the snippets of the errors, separated by blank lines,
+// see FileError.Snippet.
+func (e Errors) Snippet(color bool) string {
+	snippets := make([]string, len(e))
+	for i, x := range e {
+		snippets[i] = x.Snippet(color)
+	}
+	return strings.Join(snippets, "\n\n")
+}
+
+// add adds the error of the file, splitting a scanner.ErrorList
+// or an Errors into its errors.
+func (e *Errors) add(filename string, err error) {
+	e.addSource(filename, nil, err)
+}
+
+// addSource adds the error of the file as add does, with the source lines
+// of the positions in src, if any.
+func (e *Errors) addSource(filename string, src []byte, err error) {
+	switch list := err.(type) {
+	case nil:
+	case Errors:
+		*e = append(*e, list...)
+	case *FileError:
+		*e = append(*e, list)
+	case scanner.ErrorList:
+		for _, x := range list {
+			*e = append(*e, &FileError{Filename: filename, Pos: x.Pos, Line: sourceLine(src, x.Pos), Err: fmt.Errorf("%s", x.Msg)})
+		}
+	default:
+		*e = append(*e, &FileError{Filename: filename, Err: err})
+	}
+}
+
+// wrapError returns the error of the file as Errors, carrying the source
+// lines of the positions in src, if any, or nil if err is nil.
+func wrapError(filename string, src []byte, err error) error {
+	var errs Errors
+	errs.addSource(filename, src, err)
+	return errs.Err()
+}
+
+// sourceLine returns the line of the position in src, without the newline.
+func sourceLine(src []byte, pos token.Position) string {
+	if pos.Line < 1 {
+		return ""
+	}
+	lines := strings.SplitN(string(src), "\n", pos.Line+1)
+	if len(lines) < pos.Line {
+		return ""
+	}
+	return strings.TrimSuffix(lines[pos.Line-1], "\r")
+}
+
+func (e Errors) sort() {
+	sort.SliceStable(e, func(i, j int) bool {
+		a, b := e[i], e[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Pos.Offset < b.Pos.Offset
+	})
+}
+
+// ParseDirAll is like ParseDir, but continues on errors: the files that
+// can not be read or parsed are left out of the module, and the errors of
+// all of them are returned as Errors, along with the module of the others.
+// The module keeps the mode in Reparse.
+func ParseDirAll(dir string, filter func(os.FileInfo) bool, mode ...parser.Mode) (*Module, error) {
+	cfg := &ParseConfig{Filter: filter, AllErrors: true}
+	for _, m := range mode {
+		cfg.Mode |= m
+	}
+	return ParseDirWith(dir, cfg)
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ExportImporter returns an importer loading the packages from their
+// compiled export data, located by `go list -export` in the directory,
+// so that the sources of the dependencies are not parsed.
+// The packages are compiled into the build cache first if needed.
+// The importer is safe for concurrent use.
+func ExportImporter(fset *token.FileSet, dir string) types.Importer {
+	var (
+		mu      sync.Mutex
+		exports = make(map[string]string) // <import path, export data file>
+	)
+	lookup := func(path string) (io.ReadCloser, error) {
+		mu.Lock()
+		export, ok := exports[path]
+		mu.Unlock()
+		if !ok {
+			cmd := exec.Command("go", "list", "-export", "-f", "{{.Export}}", path)
+			cmd.Dir = dir
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("aster: go list -export %s: %s", path, strings.TrimSpace(stderr.String()))
+			}
+			export = strings.TrimSpace(string(out))
+			if export == "" {
+				return nil, fmt.Errorf("aster: no export data: %s", path)
+			}
+			mu.Lock()
+			exports[path] = export
+			mu.Unlock()
+		}
+		return os.Open(export)
+	}
+	return &syncImporter{imp: importer.ForCompiler(fset, "gc", lookup).(types.ImporterFrom)}
+}
+
+// syncImporter serializes the imports of the importer,
+// making it safe for concurrent use.
+type syncImporter struct {
+	mu  sync.Mutex
+	imp types.ImporterFrom
+}
+
+// Import implements types.Importer.
+func (s *syncImporter) Import(path string) (*types.Package, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.imp.Import(path)
+}
+
+// ImportFrom implements types.ImporterFrom.
+func (s *syncImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.imp.ImportFrom(path, dir, mode)
+}
+
+// Importer returns the importer of the dependencies of the module, created
+// by ExportImporter in the module directory on the first call.
+// It is safe for concurrent use.
+func (m *Module) Importer() types.Importer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.importer == nil {
+		m.importer = ExportImporter(m.FileSet, m.Dir)
+	}
+	return m.importer
+}
+
+// LookupExternalType resolves the type name qualified by an import of the
+// file, e.g. "io.Reader", from the export data of the imported package,
+// see Module.Importer.
+func (f *File) LookupExternalType(name string) (*types.TypeName, error) {
+	name = strings.TrimLeft(name, "*")
+	i := strings.Index(name, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("aster: unqualified type name: %s", name)
+	}
+	var path string
+	for _, imp := range f.Imports {
+		if imp.Name == name[:i] {
+			path = imp.Path
+			break
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("aster: package not imported: %s", name[:i])
+	}
+	pkg, err := f.importer().Import(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(name[i+1:]).(*types.TypeName)
+	if !ok || !obj.Exported() {
+		return nil, fmt.Errorf("aster: type not found: %s", name)
+	}
+	return obj, nil
+}
+
+// ImplementsExternal reports whether the type of the file, or its pointer,
+// implements the interface of an imported package, e.g. "io.Reader".
+// The package of the type is type-checked against the export data of its
+// dependencies, see Module.Importer.
+func (f *File) ImplementsExternal(t TypeNode, iface string) (bool, error) {
+	obj, err := f.LookupExternalType(iface)
+	if err != nil {
+		return false, err
+	}
+	u, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return false, fmt.Errorf("aster: not an interface: %s", iface)
+	}
+	pkg, err := f.typesPackage()
+	if err != nil {
+		return false, err
+	}
+	named, ok := pkg.Scope().Lookup(t.Name()).(*types.TypeName)
+	if !ok {
+		return false, fmt.Errorf("aster: type not found: %s", t.Name())
+	}
+	typ := named.Type()
+	if types.Implements(typ, u) {
+		return true, nil
+	}
+	_, isIface := typ.Underlying().(*types.Interface)
+	return !isIface && types.Implements(types.NewPointer(typ), u), nil
+}
+
+// importer returns the importer of the module of the file, or of the
+// working directory if the file is not in a module.
+func (f *File) importer() types.Importer {
+	if f.pkg != nil && f.pkg.module != nil {
+		return f.pkg.module.Importer()
+	}
+	return ExportImporter(f.FileSet, ".")
+}
+
+// typesPackage type-checks the package of the file, or the file alone if it
+// is not in a package, ignoring the type errors.
+func (f *File) typesPackage() (*types.Package, error) {
+	return f.checkTypes(nil)
+}
+
+// checkTypes type-checks the package of the file as typesPackage does,
+// recording the type information in info if not nil.
+func (f *File) checkTypes(info *types.Info) (*types.Package, error) {
+	files := []*File{f}
+	if f.pkg != nil {
+		files = f.pkg.sortedFiles()
+	}
+	var astFiles []*ast.File
+	for _, file := range files {
+		astFiles = append(astFiles, file.File)
+	}
+	conf := types.Config{
+		Importer: f.importer(),
+		Error:    func(error) {},
+	}
+	pkg, err := conf.Check(f.PkgName, f.FileSet, astFiles, info)
+	if pkg == nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// TypeCheck type-checks the package against the export data of its
+// dependencies, see Module.Importer, and returns the type information of
+// all kinds, e.g. for the go/analysis passes, along with the type errors.
+// The positions are of the FileSet of the package, and the path of the
+// types package is the import path of the package, if known.
+func (p *Package) TypeCheck() (*types.Package, *types.Info, []types.Error) {
+	var astFiles []*ast.File
+	for _, file := range p.sortedFiles() {
+		astFiles = append(astFiles, file.File)
+	}
+	info := newTypesInfo()
+	info.Implicits = make(map[ast.Node]types.Object)
+	info.Scopes = make(map[ast.Node]*types.Scope)
+	info.Instances = make(map[*ast.Ident]types.Instance)
+	var errs []types.Error
+	conf := types.Config{
+		Importer: ExportImporter(p.FileSet, p.Dir),
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok {
+				errs = append(errs, e)
+			}
+		},
+	}
+	if p.module != nil {
+		conf.Importer = p.module.Importer()
+	}
+	path, ok := p.ImportPath()
+	if !ok {
+		path = p.Name
+	}
+	pkg, _ := conf.Check(path, p.FileSet, astFiles, info)
+	return pkg, info, errs
+}
+
+// newTypesInfo returns the type information recording the definitions,
+// uses, types and selections.
+func newTypesInfo() *types.Info {
+	return &types.Info{
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// ExtractInterface synthesizes an interface declaration named name
+// from the type's method set, and inserts it after the type declaration.
+// Only the methods for which methodFilter returns true are included;
+// if methodFilter is nil, the exported methods are included.
+// Returns nil if the interface can not be inserted.
+//
+// Use File.ExtractInterface to insert it into another file.
+func (s *superType) ExtractInterface(name string, methodFilter func(FuncNode) bool) TypeNode {
+	t, err := s.file.extractInterface(s.Name(), s.methods, name, methodFilter)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// ExtractInterface synthesizes an interface declaration named name
+// from the method set of t, and inserts it into the file.
+// Only the methods for which methodFilter returns true are included;
+// if methodFilter is nil, the exported methods are included.
+// The imports referenced by the method signatures are added to the file.
+// NOTE: The file is reparsed after inserting.
+func (f *File) ExtractInterface(t TypeNode, name string, methodFilter func(FuncNode) bool) (TypeNode, error) {
+	var methods []FuncNode
+	for i := 0; i < t.NumMethod(); i++ {
+		m, _ := t.Method(i)
+		methods = append(methods, m)
+	}
+	return f.extractInterface(t.Name(), methods, name, methodFilter)
+}
+
+func (f *File) extractInterface(from string, methods []FuncNode, name string,
+	methodFilter func(FuncNode) bool) (TypeNode, error) {
+	if err := f.CheckCollision(name); err != nil {
+		return nil, err
+	}
+	if methodFilter == nil {
+		methodFilter = func(m FuncNode) bool { return IsExported(m.Name()) }
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s is the interface extracted from %s.\ntype %s interface {\n", name, from, name)
+	var sigs []*ast.FuncType
+	var files []*File
+	for _, m := range methods {
+		if !methodFilter(m) {
+			continue
+		}
+		ft, file := funcTypeOf(m)
+		if ft == nil {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(m.Doc()), "\n") {
+			if line != "" {
+				fmt.Fprintf(&buf, "\t// %s\n", line)
+			}
+		}
+		sig, err := file.FormatNode(ft)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "\t%s%s\n", m.Name(), strings.TrimPrefix(sig, "func"))
+		sigs = append(sigs, ft)
+		files = append(files, file)
+	}
+	buf.WriteString("}")
+
+	for i, ft := range sigs {
+		if err := f.addImportsOf(files[i], ft); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.appendDecl(from, buf.String()); err != nil {
+		return nil, err
+	}
+	t, found := f.LookupType(name)
+	if !found {
+		return nil, fmt.Errorf("aster: failed to insert interface: %s", name)
+	}
+	return t, nil
+}
+
+// funcTypeOf returns the function type of the FuncNode and its file.
+func funcTypeOf(m FuncNode) (*ast.FuncType, *File) {
+	fd, ok := m.(*FuncDecl)
+	if !ok {
+		return nil, nil
+	}
+	switch x := fd.node.(type) {
+	case *ast.FuncDecl:
+		return x.Type, fd.file
+	case *ast.FuncLit:
+		return x.Type, fd.file
+	case *ast.Field:
+		return x.Type.(*ast.FuncType), fd.file
+	}
+	return nil, nil
+}
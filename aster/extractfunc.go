@@ -0,0 +1,403 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ExtractFunction moves the statements [start,end) of the function body to a
+// new function of the name, declared after the function, and replaces them
+// with a call of it. The variables of the function used by the statements
+// are passed as the parameters, and those defined or changed by them and
+// used after them are returned as the results, in the order of declaration.
+// The package is type-checked against the export data of its dependencies
+// to tell the variables and their types, see Module.Importer.
+// Returns an error if the name is taken, or if the statements return, jump
+// out of the range, defer calls, or use the type parameters.
+// NOTE: The file is reparsed after extracting, and the node is rebound to it.
+func (f *FuncDecl) ExtractFunction(start, end int, name string) error {
+	body := f.Body()
+	if body == nil {
+		return fmt.Errorf("aster: function has no body: %s", f.Name())
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("aster: invalid name: %q", name)
+	}
+	file := f.file
+	index := blockIndex(file.File, body)
+	if index < 0 {
+		return fmt.Errorf("aster: function not in the file: %s", f.Name())
+	}
+	if err := file.refresh(); err != nil {
+		return err
+	}
+	defer f.rebind(file, index)
+	body = blockAt(file.File, index)
+	if start < 0 || end > len(body.List) || start >= end {
+		return fmt.Errorf("aster: invalid statement range [%d,%d)", start, end)
+	}
+	if err := file.CheckCollision(name); err != nil {
+		return err
+	}
+	stmts := body.List[start:end]
+	if err := checkExtractable(file.FileSet, stmts); err != nil {
+		return err
+	}
+	var decl ast.Decl
+	for _, d := range file.File.Decls {
+		if d.Pos() <= body.Pos() && body.End() <= d.End() {
+			decl = d
+		}
+	}
+	fn := funcNodeOf(decl, body)
+	info := newTypesInfo()
+	pkg, err := file.checkTypes(info)
+	if err != nil {
+		return err
+	}
+
+	rangeStart, rangeEnd := stmts[0].Pos(), stmts[len(stmts)-1].End()
+	isLocal := func(v *types.Var) bool {
+		return !v.IsField() && fn.Pos() <= v.Pos() && v.Pos() < rangeStart
+	}
+	var params, results []*types.Var
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if x, ok := n.(*ast.Ident); ok {
+				if v, ok := info.Uses[x].(*types.Var); ok && isLocal(v) && !containsVar(params, v) {
+					params = append(params, v)
+				}
+			}
+			return true
+		})
+	}
+	changed := changedVars(info, stmts...)
+	var defined []*types.Var
+	for id, obj := range info.Defs {
+		if v, ok := obj.(*types.Var); ok && rangeStart <= id.Pos() && id.Pos() < rangeEnd && !v.IsField() {
+			defined = append(defined, v)
+		}
+	}
+	usedAfter := make(map[*types.Var]bool)
+	for id, obj := range info.Uses {
+		if v, ok := obj.(*types.Var); ok && rangeEnd <= id.Pos() && id.Pos() < body.End() {
+			usedAfter[v] = true
+		}
+	}
+	for _, v := range append(defined, params...) {
+		if usedAfter[v] && (!isLocal(v) || changed[v]) && !containsVar(results, v) {
+			results = append(results, v)
+		}
+	}
+	sortVars(params)
+	sortVars(results)
+
+	var imports = make(map[string]string) // <path, name>
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		for _, imp := range file.Imports {
+			if imp.Path == p.Path() && imp.Name != "_" {
+				if imp.Name == "." {
+					return ""
+				}
+				return imp.Name
+			}
+		}
+		imports[p.Path()] = p.Name()
+		return p.Name()
+	}
+	typeString := func(v *types.Var) (string, error) {
+		if hasTypeParam(v.Type()) {
+			return "", fmt.Errorf("aster: can not extract the statements using the type parameters: %s", v.Name())
+		}
+		return types.TypeString(v.Type(), qualifier), nil
+	}
+	var paramList, args, resultTypes, resultNames []string
+	for _, v := range params {
+		t, err := typeString(v)
+		if err != nil {
+			return err
+		}
+		paramList = append(paramList, v.Name()+" "+t)
+		args = append(args, v.Name())
+	}
+	define := false
+	for _, v := range results {
+		t, err := typeString(v)
+		if err != nil {
+			return err
+		}
+		resultTypes = append(resultTypes, t)
+		resultNames = append(resultNames, v.Name())
+		define = define || !isLocal(v)
+	}
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "\nfunc %s(%s) ", name, strings.Join(paramList, ", "))
+	switch len(resultTypes) {
+	case 0:
+	case 1:
+		src.WriteString(resultTypes[0] + " ")
+	default:
+		src.WriteString("(" + strings.Join(resultTypes, ", ") + ") ")
+	}
+	src.WriteString("{\n" + string(file.Src[file.offset(rangeStart):file.offset(rangeEnd)]) + "\n")
+	if len(resultNames) > 0 {
+		src.WriteString("return " + strings.Join(resultNames, ", ") + "\n")
+	}
+	src.WriteString("}\n")
+	call := name + "(" + strings.Join(args, ", ") + ")"
+	switch {
+	case len(resultNames) == 0:
+	case define:
+		call = strings.Join(resultNames, ", ") + " := " + call
+	default:
+		call = strings.Join(resultNames, ", ") + " = " + call
+	}
+	_, after := file.lineRange(file.offset(decl.End()), file.offset(decl.End()))
+	err = file.applyEdits([]textEdit{
+		{start: file.offset(rangeStart), end: file.offset(rangeEnd), text: call},
+		{start: after, end: after, text: src.String()},
+	})
+	if err != nil {
+		return err
+	}
+	for path, name := range imports {
+		if err = file.AddImport(importName(name, path), path); err != nil {
+			return err
+		}
+	}
+	return file.refresh()
+}
+
+// checkExtractable returns an error if the statements can not be extracted
+// into a function, as they return, jump out of them, or defer calls.
+func checkExtractable(fset *token.FileSet, stmts []ast.Stmt) error {
+	labels := make(map[string]bool)
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if l, ok := n.(*ast.LabeledStmt); ok {
+				labels[l.Label.Name] = true
+			}
+			return true
+		})
+	}
+	var err error
+	var walk func(n ast.Node, breakable, loop bool)
+	walk = func(n ast.Node, breakable, loop bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			if err != nil || n == nil {
+				return false
+			}
+			switch x := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				err = fmt.Errorf("aster: can not extract the return statement at %s", fset.Position(x.Pos()))
+			case *ast.DeferStmt:
+				err = fmt.Errorf("aster: can not extract the defer statement at %s", fset.Position(x.Pos()))
+			case *ast.BranchStmt:
+				switch {
+				case x.Label != nil:
+					if !labels[x.Label.Name] {
+						err = fmt.Errorf("aster: can not extract the jump to the label %s at %s", x.Label.Name, fset.Position(x.Pos()))
+					}
+				case x.Tok == token.BREAK && !breakable, x.Tok == token.CONTINUE && !loop:
+					err = fmt.Errorf("aster: can not extract the %s statement at %s", x.Tok, fset.Position(x.Pos()))
+				}
+			case *ast.ForStmt:
+				walk(x.Body, true, true)
+				return false
+			case *ast.RangeStmt:
+				walk(x.Body, true, true)
+				return false
+			case *ast.SwitchStmt:
+				walk(x.Body, true, loop)
+				return false
+			case *ast.TypeSwitchStmt:
+				walk(x.Body, true, loop)
+				return false
+			case *ast.SelectStmt:
+				walk(x.Body, true, loop)
+				return false
+			}
+			return true
+		})
+	}
+	for _, stmt := range stmts {
+		walk(stmt, false, false)
+	}
+	return err
+}
+
+// funcNodeOf returns the function declaration or literal of the body
+// in the top-level declaration.
+func funcNodeOf(decl ast.Decl, body *ast.BlockStmt) ast.Node {
+	var fn ast.Node = decl
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok && lit.Body == body {
+			fn = lit
+		}
+		return fn == decl
+	})
+	return fn
+}
+
+// changedVars returns the variables changed by the statements, i.e.
+// assigned, incremented, referenced by address, or calling the methods of
+// pointer receivers, along with the variables of the changed fields and
+// elements of the structs and arrays.
+func changedVars(info *types.Info, stmts ...ast.Stmt) map[*types.Var]bool {
+	changed := make(map[*types.Var]bool)
+	mark := func(x ast.Expr) {
+		if v := changedVar(info, x); v != nil {
+			changed[v] = true
+		}
+	}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range x.Lhs {
+					mark(lhs)
+				}
+			case *ast.IncDecStmt:
+				mark(x.X)
+			case *ast.RangeStmt:
+				if x.Tok == token.ASSIGN {
+					mark(x.Key)
+					mark(x.Value)
+				}
+			case *ast.UnaryExpr:
+				if x.Op == token.AND {
+					mark(x.X)
+				}
+			case *ast.SelectorExpr:
+				// a method of pointer receiver called on a variable
+				if sel, ok := info.Selections[x]; ok && sel.Kind() == types.MethodVal {
+					if _, ok := sel.Recv().(*types.Pointer); !ok {
+						if _, ok := sel.Obj().Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+							mark(x.X)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	return changed
+}
+
+// changedVar returns the variable changed by assigning to the expression,
+// i.e. the variable itself, or the struct or array of the field or element.
+func changedVar(info *types.Info, x ast.Expr) *types.Var {
+	for x != nil {
+		switch e := x.(type) {
+		case *ast.Ident:
+			v, _ := info.Uses[e].(*types.Var)
+			return v
+		case *ast.ParenExpr:
+			x = e.X
+		case *ast.SelectorExpr:
+			if !isValueAggregate(info.TypeOf(e.X)) {
+				return nil
+			}
+			x = e.X
+		case *ast.IndexExpr:
+			if !isValueAggregate(info.TypeOf(e.X)) {
+				return nil
+			}
+			x = e.X
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// isValueAggregate reports whether the type is a struct or an array,
+// which is copied as a value.
+func isValueAggregate(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Underlying().(type) {
+	case *types.Struct, *types.Array:
+		return true
+	}
+	return false
+}
+
+// hasTypeParam reports whether the type refers to a type parameter.
+func hasTypeParam(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Pointer:
+		return hasTypeParam(t.Elem())
+	case *types.Slice:
+		return hasTypeParam(t.Elem())
+	case *types.Array:
+		return hasTypeParam(t.Elem())
+	case *types.Chan:
+		return hasTypeParam(t.Elem())
+	case *types.Map:
+		return hasTypeParam(t.Key()) || hasTypeParam(t.Elem())
+	case *types.Named:
+		if args := t.TypeArgs(); args != nil {
+			for i := 0; i < args.Len(); i++ {
+				if hasTypeParam(args.At(i)) {
+					return true
+				}
+			}
+		}
+	case *types.Signature:
+		return hasTypeParam(t.Params()) || hasTypeParam(t.Results())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if hasTypeParam(t.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParam(t.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsVar(vars []*types.Var, v *types.Var) bool {
+	for _, x := range vars {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortVars(vars []*types.Var) {
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Pos() < vars[j].Pos() })
+}
@@ -25,11 +25,13 @@ import (
 	"github.com/henrylee2cn/goutil"
 )
 
-// Store formats the module codes and writes to the local files.
-func (m *Module) Store() (first error) {
-	codes, first := m.Format()
-	if first != nil {
-		return first
+// Store formats the module codes and writes to the local files,
+// formatting by the options if given. In the continue-on-error mode,
+// the files formatted are written, and the Errors of the others returned.
+func (m *Module) Store(opts ...*FormatOptions) (first error) {
+	codes, formatErr := m.Format(opts...)
+	if formatErr != nil && !continueOnError(opts) {
+		return formatErr
 	}
 	for _, v := range codes {
 		for kk, vv := range v {
@@ -39,14 +41,29 @@ func (m *Module) Store() (first error) {
 			}
 		}
 	}
-	return
+	for _, p := range m.Packages {
+		if first = p.deleteRemoved(OSFS); first != nil {
+			return
+		}
+	}
+	if first = m.deleteRemoved(OSFS); first != nil {
+		return
+	}
+	if first = m.storeModFile(OSFS); first != nil {
+		return
+	}
+	if first = m.storeManifest(OSFS); first != nil {
+		return
+	}
+	return formatErr
 }
 
-// Store formats the package codes and writes to the local files.
-func (p *Package) Store() (first error) {
-	codes, first := p.Format()
-	if first != nil {
-		return
+// Store formats the package codes and writes to the local files,
+// formatting by the options if given, see Module.Store.
+func (p *Package) Store(opts ...*FormatOptions) (first error) {
+	codes, formatErr := p.Format(opts...)
+	if formatErr != nil && !continueOnError(opts) {
+		return formatErr
 	}
 	for k, v := range codes {
 		first = writeFile(k, v)
@@ -54,51 +71,100 @@ func (p *Package) Store() (first error) {
 			return first
 		}
 	}
-	return
+	if first = p.deleteRemoved(OSFS); first != nil {
+		return
+	}
+	if first = p.module.storeManifest(OSFS); first != nil {
+		return
+	}
+	return formatErr
 }
 
-// Store formats the file codes and writes to the local file.
-func (f *File) Store() (err error) {
-	code, err := f.Format()
+// Store formats the file codes and writes to the local file,
+// formatting by the options if given.
+func (f *File) Store(opts ...*FormatOptions) (err error) {
+	code, err := f.Format(opts...)
 	if err != nil {
 		return
 	}
-	return writeFile(f.Filename, code)
+	if err = writeFile(f.Filename, code); err != nil || f.pkg == nil {
+		return
+	}
+	return f.pkg.module.storeManifest(OSFS)
 }
 
-// Format format the package and returns the string.
+// Format format the package and returns the string,
+// formatting by the options if given.
+// In the continue-on-error mode, returns the codes of the files formatted,
+// along with the Errors of the others, see FormatOptions.ContinueOnError.
 // @codes <packageName,<fileName,code>>
-func (m *Module) Format() (codes map[string]map[string]string, first error) {
+func (m *Module) Format(opts ...*FormatOptions) (codes map[string]map[string]string, first error) {
 	codes = make(map[string]map[string]string, len(m.Packages))
+	var errs Errors
 	for k, v := range m.Packages {
-		subcodes, err := v.Format()
+		subcodes, err := v.Format(opts...)
 		if err != nil {
-			first = err
-			return
+			if !continueOnError(opts) {
+				first = err
+				return
+			}
+			errs.add("", err)
 		}
 		codes[k] = subcodes
 	}
-	return
+	return codes, errs.Err()
 }
 
-// Format format the package and returns the string.
+// Format format the package and returns the string,
+// formatting by the options if given, see Module.Format.
 // @codes <fileName,code>
-func (p *Package) Format() (codes map[string]string, first error) {
+func (p *Package) Format(opts ...*FormatOptions) (codes map[string]string, first error) {
 	codes = make(map[string]string, len(p.Files))
 	var code string
+	var errs Errors
 	for k, v := range p.Files {
-		code, first = v.Format()
+		code, first = v.Format(opts...)
 		if first != nil {
-			return
+			if !continueOnError(opts) {
+				return
+			}
+			errs.add(k, first)
+			continue
 		}
 		codes[k] = code
 	}
-	return
+	return codes, errs.Err()
 }
 
-// Format formats the file and returns the string.
-func (f *File) Format() (string, error) {
-	return f.FormatNode(f.File)
+// Format formats the file and returns the string,
+// formatting by the options if given, see FormatOptions.
+// The errors are returned via Errors, see FileError.Snippet.
+func (f *File) Format(opts ...*FormatOptions) (string, error) {
+	o := formatOptions(opts)
+	var code string
+	var ok bool
+	var err error
+	if o != nil && o.Minimal {
+		code, ok, err = f.formatMinimal()
+		if err != nil {
+			return "", wrapError(f.Filename, f.Src, err)
+		}
+	}
+	if !ok {
+		code, err = f.FormatNode(f.File)
+	}
+	if err != nil {
+		return "", wrapError(f.Filename, f.Src, err)
+	}
+	if o == nil {
+		return code, nil
+	}
+	b, err := o.apply(f.Filename, []byte(code), f.Src)
+	if err != nil {
+		// the positions of the formatters are in the code formatted
+		return "", wrapError(f.Filename, []byte(code), err)
+	}
+	return string(b), nil
 }
 
 // String returns the formated file text.
@@ -150,6 +216,17 @@ func (f *File) TryFormatNode(node ast.Node, defaultValue ...string) string {
 	return code
 }
 
+// deleteRemoved deletes the files removed from the package.
+func (p *Package) deleteRemoved(fsys WriteFileFS) error {
+	for len(p.removed) > 0 {
+		if err := fsRemove(fsys, p.removed[0]); err != nil {
+			return err
+		}
+		p.removed = p.removed[1:]
+	}
+	return nil
+}
+
 func writeFile(filename, text string) error {
 	filename, err := filepath.Abs(filename)
 	if err != nil {
@@ -165,5 +242,8 @@ func writeFile(filename, text string) error {
 		return err
 	}
 	_, err = f.Write(goutil.StringToBytes(text))
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
 	return err
 }
@@ -0,0 +1,247 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os/exec"
+	"strings"
+)
+
+// NewlinePolicy is the policy of the newlines at the end of a formatted file.
+type NewlinePolicy int
+
+// The newline policies.
+const (
+	// NewlineSingle ends the file with a single newline, as gofmt does.
+	NewlineSingle NewlinePolicy = iota
+	// NewlineNone ends the file without a newline.
+	NewlineNone
+	// NewlineKeep ends the file with the newlines of the source,
+	// or a single newline if there is no source.
+	NewlineKeep
+)
+
+// FormatOptions configures the formatting, which is go/format by default.
+type FormatOptions struct {
+	// Simplify simplifies the code as `gofmt -s` does.
+	Simplify bool
+	// UseSpaces indents with spaces instead of tabs.
+	UseSpaces bool
+	// TabWidth is the width of the indentation, defaults to 8.
+	TabWidth int
+	// Newline is the trailing newline policy.
+	Newline NewlinePolicy
+	// Formatters are run in order on the formatted code of each file,
+	// e.g. CommandFormatter("gofumpt").
+	Formatters []Formatter
+	// Minimal re-renders only the top-level declarations changed since the
+	// file was parsed or reparsed, and splices them into File.Src, leaving
+	// the rest of it byte-identical, so that storing a small change makes a
+	// small diff. The whole file is formatted as usual if declarations were
+	// added or removed. Simplify, UseSpaces and TabWidth do not apply to the
+	// minimal rewrite.
+	Minimal bool
+	// Header is prepended to the files without it, e.g. the license,
+	// as line comments unless it is a comment already.
+	Header string
+	// Generator is the name of the generator in the banner prepended to the
+	// files without one, see GeneratedBanner.
+	Generator string
+	// ContinueOnError formats all the files of a module or package despite
+	// the failed ones, whose errors are returned as Errors, along with the
+	// codes of the others, which Store writes.
+	ContinueOnError bool
+}
+
+// Formatter reformats the code of the file.
+type Formatter func(filename string, src []byte) ([]byte, error)
+
+// CommandFormatter returns the formatter running the command, which reads
+// the code from the standard input and writes it to the standard output.
+func CommandFormatter(name string, args ...string) Formatter {
+	return func(filename string, src []byte) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = bytes.NewReader(src)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("aster: formatter %s: %s: %s", name, filename, strings.TrimSpace(stderr.String()+" "+err.Error()))
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+func continueOnError(opts []*FormatOptions) bool {
+	o := formatOptions(opts)
+	return o != nil && o.ContinueOnError
+}
+
+func formatOptions(opts []*FormatOptions) *FormatOptions {
+	if len(opts) > 0 && opts[0] != nil {
+		return opts[0]
+	}
+	return nil
+}
+
+// apply applies the options to the code formatted by go/format,
+// where src is the source of the file, if any.
+func (o *FormatOptions) apply(filename string, code, src []byte) ([]byte, error) {
+	if o == nil {
+		return code, nil
+	}
+	if !o.Minimal && (o.Simplify || o.UseSpaces || o.TabWidth > 0 && o.TabWidth != 8) {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, code, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if o.Simplify {
+			simplify(file)
+		}
+		cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+		if o.UseSpaces {
+			cfg.Mode = printer.UseSpaces
+		}
+		if o.TabWidth > 0 {
+			cfg.Tabwidth = o.TabWidth
+		}
+		var buf bytes.Buffer
+		if err = cfg.Fprint(&buf, fset, file); err != nil {
+			return nil, err
+		}
+		code = buf.Bytes()
+	}
+	code = o.addHeader(code)
+	switch o.Newline {
+	case NewlineNone:
+		code = bytes.TrimRight(code, "\n")
+	case NewlineKeep:
+		if len(src) > 0 {
+			trimmed := bytes.TrimRight(src, "\n")
+			code = append(bytes.TrimRight(code, "\n"), src[len(trimmed):]...)
+		}
+	}
+	for _, formatter := range o.Formatters {
+		var err error
+		if code, err = formatter(filename, code); err != nil {
+			return nil, err
+		}
+	}
+	return code, nil
+}
+
+// simplify simplifies the file as `gofmt -s` does:
+//
+//	[]T{T{}, T{}}           -> []T{{}, {}}
+//	s[a:len(s)]             -> s[a:]
+//	for x, _ = range v {}   -> for x = range v {}
+//	for _ = range v {}      -> for range v {}
+func simplify(file *ast.File) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.CompositeLit:
+			simplifyCompositeLit(x)
+		case *ast.SliceExpr:
+			if s, ok := x.X.(*ast.Ident); ok && s.Obj != nil && !x.Slice3 {
+				if call, ok := x.High.(*ast.CallExpr); ok && len(call.Args) == 1 && !call.Ellipsis.IsValid() {
+					if fn, ok := call.Fun.(*ast.Ident); ok && fn.Name == "len" && fn.Obj == nil {
+						if arg, ok := call.Args[0].(*ast.Ident); ok && arg.Obj == s.Obj {
+							x.High = nil
+						}
+					}
+				}
+			}
+		case *ast.RangeStmt:
+			if isBlank(x.Value) {
+				x.Value = nil
+			}
+			if isBlank(x.Key) && x.Value == nil {
+				x.Key = nil
+			}
+		}
+		return true
+	})
+}
+
+// simplifyCompositeLit elides the types of the elements, keys and values
+// of the composite literal equal to its element or key type.
+func simplifyCompositeLit(lit *ast.CompositeLit) {
+	var keyType, eltType ast.Expr
+	switch t := lit.Type.(type) {
+	case *ast.ArrayType:
+		eltType = t.Elt
+	case *ast.MapType:
+		keyType, eltType = t.Key, t.Value
+	default:
+		return
+	}
+	for _, x := range lit.Elts {
+		if kv, ok := x.(*ast.KeyValueExpr); ok {
+			if keyType != nil {
+				kv.Key = elideType(kv.Key, keyType)
+			}
+			kv.Value = elideType(kv.Value, eltType)
+			continue
+		}
+		if keyType == nil {
+			lit.Elts = replaceExpr(lit.Elts, x, elideType(x, eltType))
+		}
+	}
+}
+
+func replaceExpr(list []ast.Expr, old, new ast.Expr) []ast.Expr {
+	for i, x := range list {
+		if x == old {
+			list[i] = new
+		}
+	}
+	return list
+}
+
+// elideType returns x without its type if it is typ, e.g. T{} or &T{} for *T.
+func elideType(x, typ ast.Expr) ast.Expr {
+	if lit, ok := x.(*ast.CompositeLit); ok && lit.Type != nil && sameExpr(lit.Type, typ) {
+		lit.Type = nil
+		return lit
+	}
+	if ptr, ok := typ.(*ast.StarExpr); ok {
+		if u, ok := x.(*ast.UnaryExpr); ok && u.Op == token.AND {
+			if lit, ok := u.X.(*ast.CompositeLit); ok && lit.Type != nil && sameExpr(lit.Type, ptr.X) {
+				lit.Type = nil
+				return lit
+			}
+		}
+	}
+	return x
+}
+
+// sameExpr reports whether the expressions are the same, ignoring positions.
+func sameExpr(a, b ast.Expr) bool {
+	var x, y bytes.Buffer
+	fset := token.NewFileSet()
+	return printer.Fprint(&x, fset, a) == nil && printer.Fprint(&y, fset, b) == nil && x.String() == y.String()
+}
+
+func isBlank(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	return ok && id.Name == "_"
+}
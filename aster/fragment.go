@@ -0,0 +1,94 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+)
+
+// ParseExpr parses the expression into the FileSet of the file, so that it
+// can be formatted by FormatNode and passed to the APIs taking ast nodes.
+// The positions are those of src as a file of the same name, starting at
+// line 1, column 1, and never overlap the positions of other files.
+func (f *File) ParseExpr(src string) (ast.Expr, error) {
+	x, err := parser.ParseExprFrom(f.FileSet, f.Filename, src, f.mode)
+	if err != nil {
+		return nil, fmt.Errorf("aster: invalid expression: %w", err)
+	}
+	return x, nil
+}
+
+// ParseStmt parses the single statement into the FileSet of the file,
+// see ParseExpr.
+func (f *File) ParseStmt(src string) (ast.Stmt, error) {
+	file, err := f.parseFragment("func _() {\n", src, "\n}\n")
+	if err != nil {
+		return nil, fmt.Errorf("aster: invalid statement: %w", err)
+	}
+	list := file.Decls[0].(*ast.FuncDecl).Body.List
+	if len(list) != 1 {
+		return nil, fmt.Errorf("aster: want 1 statement, got %d", len(list))
+	}
+	return list[0], nil
+}
+
+// ParseDecl parses the single declaration into the FileSet of the file,
+// e.g. a function or a grouped type declaration, see ParseExpr.
+func (f *File) ParseDecl(src string) (ast.Decl, error) {
+	file, err := f.parseFragment("", src, "\n")
+	if err != nil {
+		return nil, fmt.Errorf("aster: invalid declaration: %w", err)
+	}
+	if len(file.Decls) != 1 {
+		return nil, fmt.Errorf("aster: want 1 declaration, got %d", len(file.Decls))
+	}
+	return file.Decls[0], nil
+}
+
+// parseFragment parses src between prefix and suffix in a file of the package
+// of f, whose line directive maps the positions of src to its own lines.
+func (f *File) parseFragment(prefix, src, suffix string) (*ast.File, error) {
+	pkg := f.PkgName
+	if pkg == "" {
+		pkg = "p"
+	}
+	directive := "//line " + f.Filename + ":1:1"
+	code := "package " + pkg + "\n" + prefix + directive + "\n" + src + suffix
+	file, err := parser.ParseFile(f.FileSet, f.Filename, code, f.mode)
+	if err != nil {
+		return nil, err
+	}
+	// drops the directive from the doc comment of the first declaration
+	for _, g := range file.Comments {
+		if g.List[0].Text == directive {
+			g.List = g.List[1:]
+		}
+	}
+	if len(file.Decls) > 0 {
+		switch d := file.Decls[0].(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil && len(d.Doc.List) == 0 {
+				d.Doc = nil
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil && len(d.Doc.List) == 0 {
+				d.Doc = nil
+			}
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gen generates code by text/template templates executed on the
+// nodes of aster, and merges the rendered code into the target packages,
+// fixing the imports and formatting it.
+//
+// The templates are executed with Data, e.g.
+//
+//	{{range .Structs}}
+//	// Fields returns the field names of {{.Name}}.
+//	func (x *{{.Name}}) Fields() []string {
+//		return []string{ {{range fields .}}"{{.Name}}", {{end}} }
+//	}
+//	{{end}}
+//
+// and may omit the package clause and the imports known to the package.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/henrylee2cn/aster/aster"
+	"github.com/henrylee2cn/goutil"
+)
+
+// Data is the context of the templates.
+type Data struct {
+	Package    *aster.Package
+	Types      []aster.TypeNode
+	Structs    []aster.TypeNode
+	Interfaces []aster.TypeNode
+	Funcs      []aster.FuncNode
+	// Node is the node the template is executed on, see Generator.Each.
+	Node aster.Node
+}
+
+// Funcs are the functions of the templates:
+//
+//	lower, upper, title, snake, camel  convert the case of a string
+//	exported                           reports whether a name is exported
+//	fields                             returns the fields of a struct type
+//	methods                            returns the methods of a type
+//	params, results                    return the parameters of a function
+//	tag                                returns the name of a field tag by key
+var Funcs = template.FuncMap{
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"title":    strings.Title,
+	"snake":    goutil.SnakeString,
+	"camel":    goutil.CamelString,
+	"exported": aster.IsExported,
+	"fields":   fields,
+	"methods":  methods,
+	"params":   params,
+	"results":  results,
+	"tag":      tag,
+}
+
+// Generator generates a file per package by a template.
+type Generator struct {
+	Template *template.Template
+	// Filename is the name of the generated file in the package directory,
+	// defaulting to "<package>_gen.go".
+	Filename string
+	// Each selects the nodes to execute the template on one by one, with
+	// Data.Node set, the types before the functions. If nil, the template
+	// is executed once for the package.
+	Each func(aster.Node) bool
+}
+
+// New returns the generator of the template text parsed with Funcs.
+func New(name, text string) (*Generator, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{Template: tmpl}, nil
+}
+
+// Filepath returns the path of the file generated for the package.
+func (g *Generator) Filepath(p *aster.Package) string {
+	name := g.Filename
+	if name == "" {
+		name = p.Name + "_gen.go"
+	}
+	return filepath.Join(p.Dir, name)
+}
+
+// Render executes the template for the package, and returns the formatted
+// code, or nil if it renders nothing. The nodes of the generated file
+// itself are excluded from Data.
+func (g *Generator) Render(p *aster.Package) ([]byte, error) {
+	code, _, err := g.render(p)
+	return code, err
+}
+
+// render renders the template for the package, see Render, and returns
+// the nodes selected by Each along with the code.
+func (g *Generator) render(p *aster.Package) ([]byte, []aster.Node, error) {
+	target := g.Filepath(p)
+	var data Data
+	data.Package = p
+	for _, t := range p.Types() {
+		if g.excludes(p, target, t.Node().Pos()) {
+			continue
+		}
+		data.Types = append(data.Types, t)
+		switch t.Kind() {
+		case aster.Struct:
+			data.Structs = append(data.Structs, t)
+		case aster.Interface:
+			data.Interfaces = append(data.Interfaces, t)
+		}
+	}
+	for _, fn := range p.Funcs() {
+		if !g.excludes(p, target, fn.Node().Pos()) {
+			data.Funcs = append(data.Funcs, fn)
+		}
+	}
+
+	var buf bytes.Buffer
+	var selected []aster.Node
+	if g.Each == nil {
+		if err := g.Template.Execute(&buf, &data); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var nodes []aster.Node
+		for _, t := range data.Types {
+			nodes = append(nodes, t.(aster.Node))
+		}
+		for _, fn := range data.Funcs {
+			nodes = append(nodes, fn.(aster.Node))
+		}
+		for _, n := range nodes {
+			if !g.Each(n) {
+				continue
+			}
+			selected = append(selected, n)
+			node := data
+			node.Node = n
+			if err := g.Template.Execute(&buf, &node); err != nil {
+				return nil, nil, err
+			}
+			buf.WriteString("\n")
+		}
+	}
+	if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+		return nil, nil, nil
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("gen: invalid code rendered for %s: %s", p.Name, err.Error())
+	}
+	return code, selected, nil
+}
+
+func (g *Generator) excludes(p *aster.Package, target string, pos token.Pos) bool {
+	return p.FileSet.Position(pos).Filename == target
+}
+
+// Generate renders the template for the package, and merges the code into
+// the generated file, which is added to the package if it does not exist,
+// see aster.File.Merge. Returns nil if the template renders nothing.
+// The file is recorded in the provenance manifest of the module, named by
+// the template, along with the nodes selected by Each, see
+// aster.Module.RecordGenerated.
+// NOTE: The file is not stored.
+func (g *Generator) Generate(p *aster.Package) (*aster.File, error) {
+	code, nodes, err := g.render(p)
+	if code == nil || err != nil {
+		return nil, err
+	}
+	filename := g.Filepath(p)
+	f, ok := p.Files[filename]
+	if ok {
+		err = f.Merge(code)
+	} else {
+		f, err = p.AddFile(filepath.Base(filename), code)
+		if err != nil {
+			return nil, err
+		}
+		err = f.FixImports()
+	}
+	if err != nil {
+		return f, err
+	}
+	if m, ok := p.Module(); ok {
+		err = m.RecordGenerated(filename, g.Template.Name(), nodes...)
+	}
+	return f, err
+}
+
+// Run generates and stores the files of the non-test packages of the module.
+// Returns the stored files.
+func (g *Generator) Run(m *aster.Module) ([]*aster.File, error) {
+	var files []*aster.File
+	for _, p := range m.Packages {
+		if p.IsTest() {
+			continue
+		}
+		f, err := g.Generate(p)
+		if err != nil {
+			return files, err
+		}
+		if f == nil {
+			continue
+		}
+		if err = f.Store(); err != nil {
+			return files, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func fields(n aster.Node) []*aster.StructField {
+	if n.Kind() != aster.Struct {
+		return nil
+	}
+	r := make([]*aster.StructField, n.NumField())
+	for i := range r {
+		r[i] = n.Field(i)
+	}
+	return r
+}
+
+func methods(n aster.Node) []aster.FuncNode {
+	if n.Kind() == aster.Func {
+		return nil
+	}
+	var r []aster.FuncNode
+	for i := 0; i < n.NumMethod(); i++ {
+		if m, ok := n.Method(i); ok {
+			r = append(r, m)
+		}
+	}
+	return r
+}
+
+func params(n aster.Node) []*aster.FuncField {
+	if n.Kind() != aster.Func {
+		return nil
+	}
+	r := make([]*aster.FuncField, 0, n.NumParam())
+	for i := 0; i < n.NumParam(); i++ {
+		p, _ := n.Param(i)
+		r = append(r, p)
+	}
+	return r
+}
+
+func results(n aster.Node) []*aster.FuncField {
+	if n.Kind() != aster.Func {
+		return nil
+	}
+	r := make([]*aster.FuncField, 0, n.NumResult())
+	for i := 0; i < n.NumResult(); i++ {
+		p, _ := n.Result(i)
+		r = append(r, p)
+	}
+	return r
+}
+
+// tag returns the name of the field tag of the key, or the field name if
+// the field has no such tag.
+func tag(field *aster.StructField, key string) string {
+	if t, err := field.Tags.Get(key); err == nil && t.Name != "" {
+		return t.Name
+	}
+	return field.Name()
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GenerateDirective is the full name of the directives triggering the
+// registered generators, e.g. `//aster:generate foo arg1 arg2` runs the
+// generator named foo with the arguments arg1 and arg2 on the node.
+const GenerateDirective = "aster:generate"
+
+// Generator generates the code of the nodes triggered by GenerateDirective
+// directives or struct tags, see RegisterGenerator and Module.RunGenerators.
+type Generator interface {
+	// Name returns the name of the generator in the directives.
+	Name() string
+	// TagKey returns the key of the struct tags triggering the generator
+	// on the structs having a field tagged by it, or empty if none.
+	TagKey() string
+	// Generate returns the sources generated for the node, triggered by the
+	// directive, or by the struct tags if the directive is nil.
+	Generate(n Node, d *Directive) ([]*GeneratedSource, error)
+}
+
+// GeneratedSource is the source of the declarations generated for a node,
+// merged into the file of the package of the node, see File.Merge.
+type GeneratedSource struct {
+	// Filename is the base name of the file in the package directory,
+	// defaulting to "<package>_gen.go".
+	Filename string
+	// Src is the source of the declarations and their imports,
+	// whose package clause is optional.
+	Src []byte
+}
+
+// NewGenerator returns the generator of the name and tag key,
+// generating by fn.
+func NewGenerator(name, tagKey string, fn func(n Node, d *Directive) ([]*GeneratedSource, error)) Generator {
+	return &funcGenerator{name: name, tagKey: tagKey, fn: fn}
+}
+
+type funcGenerator struct {
+	name, tagKey string
+	fn           func(Node, *Directive) ([]*GeneratedSource, error)
+}
+
+func (g *funcGenerator) Name() string   { return g.name }
+func (g *funcGenerator) TagKey() string { return g.tagKey }
+func (g *funcGenerator) Generate(n Node, d *Directive) ([]*GeneratedSource, error) {
+	return g.fn(n, d)
+}
+
+var generators = struct {
+	sync.RWMutex
+	m map[string]Generator
+}{m: make(map[string]Generator)}
+
+// RegisterGenerator makes the generator available by its name.
+// It panics if the generator is nil, its name is invalid,
+// or it is registered twice.
+func RegisterGenerator(g Generator) {
+	if g == nil {
+		panic("aster: RegisterGenerator generator is nil")
+	}
+	name := g.Name()
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		panic("aster: RegisterGenerator invalid name: " + name)
+	}
+	generators.Lock()
+	defer generators.Unlock()
+	if _, dup := generators.m[name]; dup {
+		panic("aster: RegisterGenerator called twice for generator " + name)
+	}
+	generators.m[name] = g
+}
+
+// UnregisterGenerator removes the registered generator of the name, if any,
+// e.g. for registering it again in tests.
+func UnregisterGenerator(name string) {
+	generators.Lock()
+	defer generators.Unlock()
+	delete(generators.m, name)
+}
+
+// LookupGenerator returns the registered generator of the name.
+func LookupGenerator(name string) (Generator, bool) {
+	generators.RLock()
+	defer generators.RUnlock()
+	g, ok := generators.m[name]
+	return g, ok
+}
+
+// Generators returns the names of the registered generators, sorted.
+func Generators() []string {
+	generators.RLock()
+	defer generators.RUnlock()
+	names := make([]string, 0, len(generators.m))
+	for name := range generators.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generatedOutput is a source generated for a package.
+type generatedOutput struct {
+	pkg       *Package
+	filename  string
+	src       []byte
+	generator string
+	node      Node
+}
+
+// RunGenerators runs the registered generators on the nodes of the module,
+// except those of the generated files, merges the generated sources into
+// their files, and stores the module.
+// A node runs the generator of each of its GenerateDirective directives,
+// then, if it is a struct type, each generator whose tag key tags a field,
+// unless a directive has run it already.
+// The generated files new to the package carry the banner of aster,
+// see GeneratedBanner, and are merged in the order of the nodes, sorted by
+// package name, file name and position.
+// The generated files are recorded in the provenance manifest of the module,
+// along with the generators and the nodes producing them, see
+// Module.RecordGenerated.
+// Returns the generated files, or the first error, before storing anything.
+func (m *Module) RunGenerators() ([]*File, error) {
+	var tagged []Generator
+	for _, name := range Generators() {
+		g, _ := LookupGenerator(name)
+		if g.TagKey() != "" {
+			tagged = append(tagged, g)
+		}
+	}
+	var outputs []*generatedOutput
+	run := func(p *Package, g Generator, n Node, d *Directive) error {
+		srcs, err := g.Generate(n, d)
+		if err != nil {
+			return fmt.Errorf("aster: generator %s on %s: %s", g.Name(), SourceID(n), err.Error())
+		}
+		for _, s := range srcs {
+			filename := s.Filename
+			if filename == "" {
+				filename = p.Name + "_gen.go"
+			}
+			if !strings.HasSuffix(filename, ".go") || filepath.Base(filename) != filename {
+				return fmt.Errorf("aster: generator %s on %s: invalid file name: %s", g.Name(), SourceID(n), filename)
+			}
+			outputs = append(outputs, &generatedOutput{pkg: p, filename: filename, src: s.Src, generator: g.Name(), node: n})
+		}
+		return nil
+	}
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			if _, ok := f.IsGenerated(); ok {
+				continue
+			}
+			for _, n := range f.sortedNodes() {
+				ran := make(map[string]bool)
+				for _, d := range n.Directives().Filter(GenerateDirective) {
+					if len(d.Args) == 0 {
+						return nil, fmt.Errorf("aster: %s: missing generator name", m.FileSet.Position(d.Pos))
+					}
+					g, ok := LookupGenerator(d.Args[0])
+					if !ok {
+						return nil, fmt.Errorf("aster: %s: unknown generator: %s", m.FileSet.Position(d.Pos), d.Args[0])
+					}
+					ran[g.Name()] = true
+					if err := run(p, g, n, d); err != nil {
+						return nil, err
+					}
+				}
+				if n.Kind() != Struct {
+					continue
+				}
+				for _, g := range tagged {
+					if !ran[g.Name()] && hasTaggedField(n, g.TagKey()) {
+						if err := run(p, g, n, nil); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var files []*File
+	merged := make(map[*File]bool)
+	generators := make(map[*File][]string)
+	sources := make(map[*File][]Node)
+	for _, o := range outputs {
+		filename := filepath.Join(o.pkg.Dir, o.filename)
+		f, ok := o.pkg.Files[filename]
+		if !ok {
+			var err error
+			f, err = o.pkg.AddFile(o.filename, []byte(GeneratedBanner("aster")+"\n\npackage "+o.pkg.Name+"\n"))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := f.Merge(o.src); err != nil {
+			return nil, fmt.Errorf("aster: merging into %s: %s", filename, err.Error())
+		}
+		if !merged[f] {
+			merged[f] = true
+			files = append(files, f)
+		}
+		if !containsString(generators[f], o.generator) {
+			generators[f] = append(generators[f], o.generator)
+		}
+		sources[f] = append(sources[f], o.node)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	for _, f := range files {
+		sort.Strings(generators[f])
+		if err := m.RecordGenerated(f.Filename, strings.Join(generators[f], ","), sources[f]...); err != nil {
+			return nil, err
+		}
+	}
+	return files, m.Store()
+}
+
+// hasTaggedField reports whether a field of the struct type is tagged by the key.
+func hasTaggedField(n Node, key string) bool {
+	for i := 0; i < n.NumField(); i++ {
+		if _, err := n.Field(i).Tags.Get(key); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,468 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenericRewrite is the proposed rewrite of a function taking the empty
+// interface, and inspecting its values by type switches or assertions,
+// into a generic function, see File.GenericRewrites. For example,
+//
+//	func Describe(v interface{}) string {
+//		switch v := v.(type) {
+//		case int:
+//		...
+//		case string:
+//		...
+//
+// is rewritten into:
+//
+//	func Describe[T int | string](v T) string {
+//		switch v := any(v).(type) {
+//		...
+type GenericRewrite struct {
+	Pos        token.Position `json:"pos"`
+	Func       string         `json:"func"`
+	Param      string         `json:"param"`
+	TypeParam  string         `json:"type_param"`
+	Constraint string         `json:"constraint"`
+	file       *File
+	src        []byte // the source of the file the edits apply to
+	edits      []textEdit
+}
+
+// String returns the proposal message.
+func (r *GenericRewrite) String() string {
+	return fmt.Sprintf("%s: %s can be generic: %s[%s %s] of parameter %s", r.Pos, r.Func, r.Func, r.TypeParam, r.Constraint, r.Param)
+}
+
+// Diff returns the unified diff of the rewrite for review.
+func (r *GenericRewrite) Diff() (string, error) {
+	src, err := editSource(r.src, append([]textEdit(nil), r.edits...))
+	if err != nil {
+		return "", err
+	}
+	if b, err := format.Source([]byte(src)); err == nil {
+		src = string(b)
+	}
+	return unifiedDiff(r.file.Filename, string(r.src), src), nil
+}
+
+// Apply rewrites the function of the file, which is reparsed then.
+// Returns an error if the file has changed since the rewrite was found,
+// e.g. by applying another rewrite of it, see File.ApplyGenericRewrites.
+func (r *GenericRewrite) Apply() error {
+	if !bytes.Equal(r.file.Src, r.src) {
+		return fmt.Errorf("aster: file changed since the rewrite of %s was found: %s", r.Func, r.file.Filename)
+	}
+	return r.file.applyEdits(append([]textEdit(nil), r.edits...))
+}
+
+// GenericRewrites returns the rewrites of the functions of the file into
+// the generic ones, see GenericRewrite.
+//
+// A function is rewritten if exactly one of its parameters is of the empty
+// interface, or a slice, variadic or map of it, and the values of it are
+// inspected by type switches or type assertions, which are rewritten to
+// convert them to any first. The constraint is the union of the types of the
+// cases and the assertions, or any if there is a default case, an interface
+// type or an assertion with the ok result. The functions used as values
+// are not rewritten, and a rewrite is proposed only if the package has no
+// new type errors with it.
+//
+// Returns an error if go.mod of the module declares a Go version before 1.18.
+// NOTE: The call sites in the other packages are not checked, and the file
+// is formatted and reparsed first.
+func (f *File) GenericRewrites() ([]*GenericRewrite, error) {
+	if f.pkg != nil && f.pkg.module != nil && f.pkg.module.ModFile != nil && goVersionBefore(f.pkg.module.ModFile.Go, 18) {
+		return nil, fmt.Errorf("aster: generics need go 1.18, but go.mod declares go %s", f.pkg.module.ModFile.Go)
+	}
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	info := newTypesInfo()
+	pkg, errs := f.checkReplaced(f.File, info)
+	if pkg == nil {
+		return nil, fmt.Errorf("aster: failed to type-check package %s", f.PkgName)
+	}
+	values := f.funcValues(info)
+	var rewrites []*GenericRewrite
+	for _, decl := range f.File.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Recv != nil || fd.Type.TypeParams != nil || fd.Body == nil || values[info.Defs[fd.Name]] {
+			continue
+		}
+		r, ok := f.genericRewrite(fd, pkg, info)
+		if !ok {
+			continue
+		}
+		src, err := editSource(r.src, append([]textEdit(nil), r.edits...))
+		if err != nil {
+			continue
+		}
+		file, err := parser.ParseFile(f.FileSet, f.Filename, src, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		if _, n := f.checkReplaced(file, nil); n > errs {
+			continue
+		}
+		rewrites = append(rewrites, r)
+	}
+	return rewrites, nil
+}
+
+// GenericRewrites returns the rewrites of the functions of the package into
+// the generic ones, sorted by file name, see File.GenericRewrites.
+func (p *Package) GenericRewrites() ([]*GenericRewrite, error) {
+	var rewrites []*GenericRewrite
+	for _, f := range p.sortedFiles() {
+		r, err := f.GenericRewrites()
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, r...)
+	}
+	return rewrites, nil
+}
+
+// GenericRewrites returns the rewrites of the functions of the module into
+// the generic ones, sorted by file name, see File.GenericRewrites.
+func (m *Module) GenericRewrites() ([]*GenericRewrite, error) {
+	var rewrites []*GenericRewrite
+	for _, p := range m.sortedPackages() {
+		r, err := p.GenericRewrites()
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, r...)
+	}
+	sort.SliceStable(rewrites, func(i, j int) bool { return rewrites[i].Pos.Filename < rewrites[j].Pos.Filename })
+	return rewrites, nil
+}
+
+// ApplyGenericRewrites rewrites the functions of the file into the generic
+// ones one by one, and returns the number of them, see File.GenericRewrites.
+// NOTE: The file is reparsed after rewriting.
+func (f *File) ApplyGenericRewrites() (int, error) {
+	var n int
+	for {
+		rewrites, err := f.GenericRewrites()
+		if err != nil || len(rewrites) == 0 {
+			return n, err
+		}
+		if err = rewrites[0].Apply(); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// genericRewrite returns the rewrite of the function, if it is a candidate.
+func (f *File) genericRewrite(fd *ast.FuncDecl, pkg *types.Package, info *types.Info) (*GenericRewrite, bool) {
+	// the only parameter of the empty interface, and the node of it in the type
+	var param *ast.Ident
+	var elem ast.Expr
+	var container bool
+	for _, field := range fd.Type.Params.List {
+		e, c, ok := emptyInterfaceElem(field.Type, info)
+		if !ok {
+			continue
+		}
+		if param != nil || len(field.Names) != 1 || field.Names[0].Name == "_" {
+			return nil, false
+		}
+		param, elem, container = field.Names[0], e, c
+	}
+	if param == nil {
+		return nil, false
+	}
+	obj := info.Defs[param]
+
+	// the variables of the values of the parameter
+	tracked := map[types.Object]bool{}
+	okAsserts := map[*ast.TypeAssertExpr]bool{}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.RangeStmt:
+			if id, ok := x.Value.(*ast.Ident); ok && container && isObject(x.X, obj, info) {
+				tracked[info.Defs[id]] = true
+			}
+		case *ast.AssignStmt:
+			if len(x.Lhs) == 2 && len(x.Rhs) == 1 {
+				if ta, ok := unparen(x.Rhs[0]).(*ast.TypeAssertExpr); ok {
+					okAsserts[ta] = true
+				}
+			}
+		case *ast.ValueSpec:
+			if len(x.Names) == 2 && len(x.Values) == 1 {
+				if ta, ok := unparen(x.Values[0]).(*ast.TypeAssertExpr); ok {
+					okAsserts[ta] = true
+				}
+			}
+		}
+		return true
+	})
+	if !container {
+		tracked[obj] = true
+	}
+	isTracked := func(e ast.Expr) bool {
+		e = unparen(e)
+		if id, ok := e.(*ast.Ident); ok {
+			return tracked[info.Uses[id]]
+		}
+		if ix, ok := e.(*ast.IndexExpr); ok {
+			return container && isObject(ix.X, obj, info)
+		}
+		return false
+	}
+
+	var edits []textEdit
+	wrap := func(e ast.Expr) {
+		edits = append(edits, f.textEdit(e, "any("+string(f.Src[f.offset(e.Pos()):f.offset(e.End())])+")"))
+	}
+	var caseTypes []types.Type
+	var inspected, anyType bool
+	addType := func(e ast.Expr) {
+		tv, ok := info.Types[e]
+		switch {
+		case ok && tv.IsNil():
+		case !ok || tv.Type == nil || types.IsInterface(tv.Type):
+			anyType = true
+		default:
+			for _, t := range caseTypes {
+				if types.Identical(t, tv.Type) {
+					return
+				}
+			}
+			caseTypes = append(caseTypes, tv.Type)
+		}
+	}
+	switches := map[*ast.TypeAssertExpr]bool{}
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.TypeSwitchStmt:
+			var ta *ast.TypeAssertExpr
+			switch s := x.Assign.(type) {
+			case *ast.AssignStmt:
+				ta, _ = s.Rhs[0].(*ast.TypeAssertExpr)
+			case *ast.ExprStmt:
+				ta, _ = s.X.(*ast.TypeAssertExpr)
+			}
+			if ta == nil || !isTracked(ta.X) {
+				return true
+			}
+			switches[ta] = true
+			inspected = true
+			wrap(ta.X)
+			for _, stmt := range x.Body.List {
+				cc := stmt.(*ast.CaseClause)
+				if cc.List == nil {
+					anyType = true
+				}
+				for _, e := range cc.List {
+					addType(e)
+				}
+			}
+		case *ast.TypeAssertExpr:
+			if x.Type == nil || switches[x] || !isTracked(x.X) {
+				return true
+			}
+			inspected = true
+			wrap(x.X)
+			if okAsserts[x] {
+				anyType = true
+			} else {
+				addType(x.Type)
+			}
+		case *ast.BinaryExpr:
+			if x.Op != token.EQL && x.Op != token.NEQ {
+				return true
+			}
+			for _, pair := range [][2]ast.Expr{{x.X, x.Y}, {x.Y, x.X}} {
+				if tv, ok := info.Types[pair[1]]; ok && tv.IsNil() && isTracked(pair[0]) {
+					wrap(pair[0])
+				}
+			}
+		}
+		return true
+	})
+	if !inspected {
+		return nil, false
+	}
+
+	// the name of the type parameter not used by the function or the package
+	used := map[string]bool{}
+	ast.Inspect(fd, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	typeParam := "T"
+	for i := 1; used[typeParam] || pkg.Scope().Lookup(typeParam) != nil; i++ {
+		typeParam = "T" + strconv.Itoa(i)
+	}
+	constraint := "any"
+	if !anyType && len(caseTypes) > 0 {
+		qualifier := func(p *types.Package) string {
+			if p == pkg {
+				return ""
+			}
+			for _, imp := range f.Imports {
+				if imp.Path == p.Path() {
+					return imp.Name
+				}
+			}
+			return p.Name()
+		}
+		terms := make([]string, len(caseTypes))
+		for i, t := range caseTypes {
+			terms[i] = types.TypeString(t, qualifier)
+		}
+		constraint = strings.Join(terms, " | ")
+	}
+	offset := f.offset(fd.Name.End())
+	edits = append(edits,
+		textEdit{start: offset, end: offset, text: "[" + typeParam + " " + constraint + "]"},
+		f.textEdit(elem, typeParam),
+	)
+	return &GenericRewrite{
+		Pos:        f.FileSet.Position(fd.Pos()),
+		Func:       fd.Name.Name,
+		Param:      param.Name,
+		TypeParam:  typeParam,
+		Constraint: constraint,
+		file:       f,
+		src:        append([]byte(nil), f.Src...),
+		edits:      edits,
+	}, true
+}
+
+// emptyInterfaceElem returns the empty interface of the parameter type,
+// itself or the element of a slice, variadic or map, and whether it is
+// an element.
+func emptyInterfaceElem(typ ast.Expr, info *types.Info) (ast.Expr, bool, bool) {
+	elem, container := typ, true
+	switch t := typ.(type) {
+	case *ast.Ellipsis:
+		elem = t.Elt
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return nil, false, false
+		}
+		elem = t.Elt
+	case *ast.MapType:
+		elem = t.Value
+	default:
+		container = false
+	}
+	tv, ok := info.Types[elem]
+	if !ok || tv.Type == nil || !types.Identical(tv.Type, types.NewInterfaceType(nil, nil)) {
+		return nil, false, false
+	}
+	return elem, container, true
+}
+
+// isObject reports whether e is the identifier of obj.
+func isObject(e ast.Expr, obj types.Object, info *types.Info) bool {
+	id, ok := unparen(e).(*ast.Ident)
+	return ok && obj != nil && info.Uses[id] == obj
+}
+
+// unparen returns e with the enclosing parentheses removed.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// funcValues returns the functions of the package referenced other than
+// by calls, which can not be generic.
+func (f *File) funcValues(info *types.Info) map[types.Object]bool {
+	files := []*File{f}
+	if f.pkg != nil {
+		files = f.pkg.sortedFiles()
+	}
+	callees := map[*ast.Ident]bool{}
+	values := map[types.Object]bool{}
+	for _, file := range files {
+		ast.Inspect(file.File, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.CallExpr:
+				if id, ok := unparen(x.Fun).(*ast.Ident); ok {
+					callees[id] = true
+				}
+			case *ast.Ident:
+				if fn, ok := info.Uses[x].(*types.Func); ok && !callees[x] {
+					values[fn] = true
+				}
+			}
+			return true
+		})
+	}
+	return values
+}
+
+// checkReplaced type-checks the package of the file as checkTypes does,
+// with the syntax tree of the file replaced by file, and returns the
+// number of the type errors.
+func (f *File) checkReplaced(file *ast.File, info *types.Info) (*types.Package, int) {
+	files := []*File{f}
+	if f.pkg != nil {
+		files = f.pkg.sortedFiles()
+	}
+	var astFiles []*ast.File
+	for _, x := range files {
+		if x == f {
+			astFiles = append(astFiles, file)
+		} else {
+			astFiles = append(astFiles, x.File)
+		}
+	}
+	var errs int
+	conf := types.Config{
+		Importer: f.importer(),
+		Error:    func(error) { errs++ },
+	}
+	pkg, _ := conf.Check(f.PkgName, f.FileSet, astFiles, info)
+	return pkg, errs
+}
+
+// goVersionBefore reports whether the Go version, e.g. "1.17" or "1.21.0",
+// is before 1.minor.
+func goVersionBefore(version string, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return false
+	}
+	n, err := strconv.Atoi(parts[1])
+	return err == nil && n < minor
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A ModFile is the go.mod file of a module, see Module.ModFile.
+type ModFile struct {
+	Filename string
+	Path     string // the module path
+	Go       string // the Go version, e.g. "1.18"
+	Require  []*ModRequire
+	lines    []string
+	block    int  // the line of ")" closing the first require block, or -1
+	changed  bool // written by Store, see AddRequire
+}
+
+// A ModRequire is a requirement of the go.mod file.
+type ModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+	line     int
+}
+
+// loadModFile parses the nearest go.mod file of the module directory,
+// which may be in the overlay, or returns nil if there is none.
+func (m *Module) loadModFile() (*ModFile, error) {
+	dir, err := filepath.Abs(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		filename := filepath.Join(dir, "go.mod")
+		if src, err := m.readFile(filename); err == nil {
+			return parseModFile(filename, src)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// parseModFile parses the module, go and require directives of go.mod.
+func parseModFile(filename string, src []byte) (*ModFile, error) {
+	mf := &ModFile{
+		Filename: filename,
+		lines:    strings.Split(string(src), "\n"),
+		block:    -1,
+	}
+	inRequire, inBlock := false, false
+	for i, line := range mf.lines {
+		fields, comment := modFields(line)
+		switch {
+		case len(fields) == 0:
+		case inBlock:
+			if fields[0] == ")" {
+				if inRequire && mf.block < 0 {
+					mf.block = i
+				}
+				inRequire, inBlock = false, false
+			} else if inRequire {
+				if len(fields) != 2 {
+					return nil, fmt.Errorf("aster: %s:%d: invalid require", filename, i+1)
+				}
+				mf.addRequire(fields[0], fields[1], comment, i)
+			}
+		case len(fields) == 2 && fields[1] == "(":
+			inRequire, inBlock = fields[0] == "require", true
+		case fields[0] == "module" && len(fields) == 2:
+			mf.Path = fields[1]
+		case fields[0] == "go" && len(fields) == 2:
+			mf.Go = fields[1]
+		case fields[0] == "require":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("aster: %s:%d: invalid require", filename, i+1)
+			}
+			mf.addRequire(fields[1], fields[2], comment, i)
+		}
+	}
+	if mf.Path == "" {
+		return nil, fmt.Errorf("aster: %s: no module path", filename)
+	}
+	return mf, nil
+}
+
+func (mf *ModFile) addRequire(path, version, comment string, line int) {
+	mf.Require = append(mf.Require, &ModRequire{
+		Path:     path,
+		Version:  version,
+		Indirect: strings.TrimSpace(comment) == "indirect",
+		line:     line,
+	})
+}
+
+// modFields returns the unquoted fields of the go.mod line,
+// and the text of its trailing comment.
+func modFields(line string) ([]string, string) {
+	var comment string
+	if i := strings.Index(line, "//"); i >= 0 {
+		line, comment = line[:i], line[i+2:]
+	}
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, "\"`")
+	}
+	return fields, comment
+}
+
+// LookupRequire returns the requirement of the module path.
+func (mf *ModFile) LookupRequire(path string) (*ModRequire, bool) {
+	for _, r := range mf.Require {
+		if r.Path == path {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Bytes returns the content of the go.mod file.
+func (mf *ModFile) Bytes() []byte {
+	return []byte(strings.Join(mf.lines, "\n"))
+}
+
+// AddRequire requires the version of the module path in go.mod, which is
+// written by Store, e.g. for a new dependency of the generated code.
+// The version of an existing requirement is replaced, no longer indirect,
+// and a new one is added to the first require block, if any.
+func (m *Module) AddRequire(path, version string) error {
+	if m.ModFile == nil {
+		return fmt.Errorf("aster: no go.mod of the module: %s", m.Dir)
+	}
+	if path == "" || strings.ContainsAny(path, " \t\"`") {
+		return fmt.Errorf("aster: invalid module path: %q", path)
+	}
+	if !strings.HasPrefix(version, "v") || strings.ContainsAny(version, " \t\"`") {
+		return fmt.Errorf("aster: invalid module version: %q", version)
+	}
+	if path == m.ModFile.Path {
+		return fmt.Errorf("aster: the module requires itself: %s", path)
+	}
+	mf := *m.ModFile
+	mf.lines = append([]string(nil), mf.lines...)
+	if r, ok := mf.LookupRequire(path); ok {
+		if r.Version == version {
+			return nil
+		}
+		line := mf.lines[r.line]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if fields, _ := modFields(line); fields[0] == "require" {
+			indent += "require "
+		}
+		mf.lines[r.line] = indent + path + " " + version
+	} else if mf.block >= 0 {
+		mf.lines = append(mf.lines[:mf.block+1], mf.lines[mf.block:]...)
+		mf.lines[mf.block] = "\t" + path + " " + version
+	} else {
+		text := strings.TrimRight(strings.Join(mf.lines, "\n"), "\n")
+		mf.lines = strings.Split(text+"\n\nrequire "+path+" "+version+"\n", "\n")
+	}
+	updated, err := parseModFile(mf.Filename, mf.Bytes())
+	if err != nil {
+		return err
+	}
+	updated.changed = true
+	m.ModFile = updated
+	return nil
+}
+
+// storeModFile writes the go.mod file changed by AddRequire.
+func (m *Module) storeModFile(fsys WriteFileFS) error {
+	if m.ModFile == nil || !m.ModFile.changed {
+		return nil
+	}
+	if err := fsWriteFile(fsys, m.ModFile.Filename, string(m.ModFile.Bytes())); err != nil {
+		return err
+	}
+	m.ModFile.changed = false
+	return nil
+}
@@ -0,0 +1,418 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphql generates the GraphQL schema definitions (SDL) of the
+// struct and interface types of a package, e.g.
+//
+//	// User is a user.
+//	type User struct {
+//		ID    string
+//		Name  *string
+//		Posts []*Post `graphql:"articles,nonnull"`
+//	}
+//
+// to
+//
+//	"User is a user."
+//	type User {
+//	  id: String!
+//	  name: String
+//	  articles: [Post]!
+//	}
+//
+// The field tag `graphql:"[name][,nonnull|,nullable]"` sets the name and
+// the nullability of the field, `graphql:"-"` skips it. The other fields
+// are named in lower camel case, and are nullable if they are pointers,
+// slices or interfaces.
+// The struct types are generated as object types, or as input types if
+// selected by Options.Input, and the interface types as interfaces of
+// their methods with results, which the object types implement.
+// The fields are described by their doc comments, or else by their line
+// comments.
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// TagKey is the key of the field tags, see the package doc.
+const TagKey = "graphql"
+
+// Options are the options of Generate.
+type Options struct {
+	// Filter selects the struct and interface types to generate, defaults to
+	// the exported ones. The types of the package they refer to are
+	// generated too.
+	Filter func(t aster.TypeNode) bool
+	// Input selects the struct types to generate as input types, defaults to
+	// those named with the suffix "Input".
+	Input func(t aster.TypeNode) bool
+}
+
+// Generate returns the schema definitions of the types of the package
+// selected by the options, which may be nil, sorted by file name and
+// position, followed by the types they refer to.
+// Returns an error if a field type has no GraphQL type, e.g. a map, or if an
+// input type refers to an object type.
+func Generate(p *aster.Package, opts *Options) ([]byte, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Filter == nil {
+		o.Filter = func(t aster.TypeNode) bool { return aster.IsExported(t.Name()) }
+	}
+	if o.Input == nil {
+		o.Input = func(t aster.TypeNode) bool { return strings.HasSuffix(t.Name(), "Input") }
+	}
+	g := &generator{pkg: p, input: o.Input, scalars: make(map[string]bool)}
+	for _, t := range p.Types() {
+		if (t.Kind() == aster.Struct || t.Kind() == aster.Interface) && o.Filter(t) {
+			g.enqueue(t)
+		}
+	}
+	// the first pass collects the types referred to, which the object types
+	// may implement, and the second one writes them all
+	var body bytes.Buffer
+	for pass := 0; pass < 2; pass++ {
+		body.Reset()
+		for i := 0; i < len(g.queue); i++ {
+			t := g.queue[i]
+			if len(t.TypeParams()) > 0 {
+				return nil, fmt.Errorf("graphql: generic type: %s", t.Name())
+			}
+			var err error
+			if t.Kind() == aster.Interface {
+				err = g.iface(&body, t)
+			} else {
+				err = g.object(&body, t)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# " + strings.TrimPrefix(aster.GeneratedBanner("aster"), "// ") + "\n")
+	var scalars []string
+	for s := range g.scalars {
+		scalars = append(scalars, s)
+	}
+	sort.Strings(scalars)
+	for _, s := range scalars {
+		fmt.Fprintf(&buf, "\nscalar %s\n", s)
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+type generator struct {
+	pkg     *aster.Package
+	input   func(aster.TypeNode) bool
+	scalars map[string]bool  // the custom scalars used
+	queue   []aster.TypeNode // the types to generate in order
+}
+
+func (g *generator) enqueue(t aster.TypeNode) {
+	for _, q := range g.queue {
+		if q.Name() == t.Name() {
+			return
+		}
+	}
+	g.queue = append(g.queue, t)
+}
+
+// object writes the object or input type of the struct type.
+func (g *generator) object(w *bytes.Buffer, t aster.TypeNode) error {
+	input := g.input(t)
+	w.WriteString("\n")
+	writeDescription(w, t.Doc(), "")
+	if input {
+		fmt.Fprintf(w, "input %s", t.Name())
+	} else {
+		fmt.Fprintf(w, "type %s", t.Name())
+		var ifaces []string
+		for _, u := range g.pkg.Interfaces() {
+			if u.NumMethod(true) > 0 && t.Implements(u) && g.selected(u) {
+				ifaces = append(ifaces, u.Name())
+			}
+		}
+		if len(ifaces) > 0 {
+			fmt.Fprintf(w, " implements %s", strings.Join(ifaces, " & "))
+		}
+	}
+	w.WriteString(" {\n")
+	if err := g.fields(w, t, t.Node().(*ast.StructType), input); err != nil {
+		return err
+	}
+	w.WriteString("}\n")
+	return nil
+}
+
+// selected returns true if the type is generated.
+func (g *generator) selected(t aster.TypeNode) bool {
+	for _, q := range g.queue {
+		if q.Name() == t.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// fields writes the fields of the struct type, with those of the embedded
+// struct types promoted.
+func (g *generator) fields(w *bytes.Buffer, t aster.TypeNode, st *ast.StructType, input bool) error {
+	for _, field := range st.Fields.List {
+		name, nullable, skip, err := parseTag(field)
+		if err != nil {
+			return fmt.Errorf("graphql: %s: %s", t.Name(), err)
+		}
+		if skip {
+			continue
+		}
+		if len(field.Names) == 0 && name == "" {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			id, ok := typ.(*ast.Ident)
+			et, found := aster.TypeNode(nil), false
+			if ok {
+				et, found = g.pkg.LookupType(id.Name)
+			}
+			if !found || et.Kind() != aster.Struct {
+				return fmt.Errorf("graphql: %s: unsupported embedded type: %s", t.Name(), types.ExprString(field.Type))
+			}
+			if err := g.fields(w, et, et.Node().(*ast.StructType), input); err != nil {
+				return err
+			}
+			continue
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// the embedded field named by the tag
+			base := strings.TrimLeft(types.ExprString(field.Type), "*")
+			names = []*ast.Ident{ast.NewIdent(base[strings.LastIndex(base, ".")+1:])}
+		}
+		for _, id := range names {
+			if !aster.IsExported(id.Name) {
+				continue
+			}
+			typ, err := g.typeRef(t, field.Type, input)
+			if err != nil {
+				return fmt.Errorf("graphql: %s.%s: %s", t.Name(), id.Name, err)
+			}
+			typ = withNullability(typ, nullable)
+			fieldName := name
+			if fieldName == "" {
+				fieldName = lowerCamel(id.Name)
+			}
+			if field.Doc != nil {
+				writeDescription(w, field.Doc.Text(), "  ")
+			} else if field.Comment != nil {
+				writeDescription(w, field.Comment.Text(), "  ")
+			}
+			fmt.Fprintf(w, "  %s: %s\n", fieldName, typ)
+		}
+	}
+	return nil
+}
+
+// iface writes the interface type of the methods with results,
+// as fields of the first results, with the parameters as arguments.
+func (g *generator) iface(w *bytes.Buffer, t aster.TypeNode) error {
+	w.WriteString("\n")
+	writeDescription(w, t.Doc(), "")
+	fmt.Fprintf(w, "interface %s {\n", t.Name())
+	for _, m := range t.Node().(*ast.InterfaceType).Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) == 0 || !m.Names[0].IsExported() || ft.Results == nil {
+			continue
+		}
+		var args []string
+		for _, param := range ft.Params.List {
+			typ, err := g.typeRef(t, param.Type, true)
+			if err != nil {
+				return fmt.Errorf("graphql: %s.%s: %s", t.Name(), m.Names[0].Name, err)
+			}
+			for _, id := range param.Names {
+				args = append(args, id.Name+": "+typ)
+			}
+			if len(param.Names) == 0 {
+				return fmt.Errorf("graphql: %s.%s: unnamed parameter", t.Name(), m.Names[0].Name)
+			}
+		}
+		typ, err := g.typeRef(t, ft.Results.List[0].Type, false)
+		if err != nil {
+			return fmt.Errorf("graphql: %s.%s: %s", t.Name(), m.Names[0].Name, err)
+		}
+		if m.Doc != nil {
+			writeDescription(w, m.Doc.Text(), "  ")
+		}
+		name := lowerCamel(m.Names[0].Name)
+		if len(args) > 0 {
+			name += "(" + strings.Join(args, ", ") + ")"
+		}
+		fmt.Fprintf(w, "  %s: %s\n", name, typ)
+	}
+	w.WriteString("}\n")
+	return nil
+}
+
+// typeRef returns the GraphQL type of the Go type of a field of t,
+// non-null unless it is a pointer, a slice or an interface.
+func (g *generator) typeRef(t aster.TypeNode, typ ast.Expr, input bool) (string, error) {
+	switch x := typ.(type) {
+	case *ast.ParenExpr:
+		return g.typeRef(t, x.X, input)
+	case *ast.StarExpr:
+		s, err := g.typeRef(t, x.X, input)
+		return strings.TrimSuffix(s, "!"), err
+	case *ast.ArrayType:
+		if id, ok := x.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+			return "String!", nil
+		}
+		s, err := g.typeRef(t, x.Elt, input)
+		if err != nil {
+			return "", err
+		}
+		return "[" + s + "]", nil
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && t.File().LookupImportPath(pkg.Name) == "time" && x.Sel.Name == "Time" {
+			g.scalars["Time"] = true
+			return "Time!", nil
+		}
+	case *ast.Ident:
+		if s, ok := basicType(x.Name); ok {
+			return s + "!", nil
+		}
+		if n, ok := g.pkg.LookupType(x.Name); ok {
+			switch n.Kind() {
+			case aster.Struct:
+				if input && !g.input(n) {
+					return "", fmt.Errorf("input type refers to object type: %s", n.Name())
+				}
+				g.enqueue(n)
+				return n.Name() + "!", nil
+			case aster.Interface:
+				if input {
+					return "", fmt.Errorf("input type refers to interface type: %s", n.Name())
+				}
+				g.enqueue(n)
+				return n.Name(), nil
+			}
+			if u, ok := n.Node().(ast.Expr); ok && u != typ {
+				return g.typeRef(n, u, input)
+			}
+		}
+	}
+	return "", fmt.Errorf("unsupported type: %s", types.ExprString(typ))
+}
+
+// basicType returns the GraphQL scalar of the Go basic type.
+func basicType(name string) (string, bool) {
+	switch name {
+	case "bool":
+		return "Boolean", true
+	case "string":
+		return "String", true
+	case "int", "int8", "int16", "int32", "int64", "rune",
+		"uint", "uint8", "byte", "uint16", "uint32", "uint64":
+		return "Int", true
+	case "float32", "float64":
+		return "Float", true
+	}
+	return "", false
+}
+
+// parseTag parses the `graphql:"[name][,nonnull|,nullable]"` tag of the
+// field, where nullable is 1 for nullable, -1 for nonnull, 0 by default.
+func parseTag(field *ast.Field) (name string, nullable int, skip bool, err error) {
+	if field.Tag == nil {
+		return "", 0, false, nil
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", 0, false, err
+	}
+	value, ok := reflect.StructTag(tag).Lookup(TagKey)
+	if !ok {
+		return "", 0, false, nil
+	}
+	if value == "-" {
+		return "", 0, true, nil
+	}
+	a := strings.Split(value, ",")
+	for _, opt := range a[1:] {
+		switch opt {
+		case "nonnull":
+			nullable = -1
+		case "nullable":
+			nullable = 1
+		default:
+			return "", 0, false, fmt.Errorf("unknown tag option: %s", opt)
+		}
+	}
+	return a[0], nullable, false, nil
+}
+
+func withNullability(typ string, nullable int) string {
+	switch {
+	case nullable > 0:
+		return strings.TrimSuffix(typ, "!")
+	case nullable < 0 && !strings.HasSuffix(typ, "!"):
+		return typ + "!"
+	}
+	return typ
+}
+
+// lowerCamel lowers the leading upper case letters of the name,
+// e.g. "ID" to "id", "HTMLBody" to "htmlBody".
+func lowerCamel(name string) string {
+	r := []rune(name)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+func writeDescription(w *bytes.Buffer, doc, indent string) {
+	doc = strings.TrimSpace(doc)
+	if doc == "" {
+		return
+	}
+	if !strings.Contains(doc, "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, strconv.Quote(doc))
+		return
+	}
+	fmt.Fprintf(w, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(strings.ReplaceAll(doc, `"""`, `\"""`), "\n") {
+		fmt.Fprintf(w, "%s%s\n", indent, line)
+	}
+	fmt.Fprintf(w, "%s\"\"\"\n", indent)
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import "sort"
+
+// implMatrix is the relation between the named types and the interfaces
+// declared in the module, see Module.Implementations.
+type implMatrix struct {
+	impls  map[TypeNode][]TypeNode // <interface, implementations>
+	ifaces map[TypeNode][]TypeNode // <type, interfaces>
+}
+
+// Implementations returns the named non-interface types declared in the
+// module which implement the interface, sorted by package and type name.
+// The relation of all the types and interfaces of the module is computed
+// on the first call, and cached until the files are reparsed.
+// Returns nil if iface is not an interface, or has no methods.
+func (m *Module) Implementations(iface TypeNode) []TypeNode {
+	if iface.Kind() != Interface || iface.NumMethod(true) == 0 {
+		return nil
+	}
+	matrix := m.implMatrix()
+	if impls, ok := matrix.impls[iface]; ok {
+		return append([]TypeNode(nil), impls...)
+	}
+	// declared outside the module, or anonymous
+	var impls []TypeNode
+	for _, t := range m.namedTypes() {
+		if t.Kind() != Interface && t.Implements(iface) {
+			impls = append(impls, t)
+		}
+	}
+	return impls
+}
+
+// Interfaces returns the interfaces declared in the module which the type
+// implements, sorted by package and type name, see Module.Implementations.
+// Returns nil for an interface type, or a type not in a module.
+func (s *superType) Interfaces() []TypeNode {
+	if s.kind == Interface || s.file.pkg == nil || s.file.pkg.module == nil {
+		return nil
+	}
+	n, ok := s.self()
+	if !ok {
+		return nil
+	}
+	ifaces := s.file.pkg.module.implMatrix().ifaces[n.(TypeNode)]
+	return append([]TypeNode(nil), ifaces...)
+}
+
+// implMatrix returns the cached relation, computing it if needed.
+func (m *Module) implMatrix() *implMatrix {
+	m.mu.Lock()
+	matrix := m.impls
+	m.mu.Unlock()
+	if matrix != nil {
+		return matrix
+	}
+	matrix = &implMatrix{
+		impls:  make(map[TypeNode][]TypeNode),
+		ifaces: make(map[TypeNode][]TypeNode),
+	}
+	types := m.namedTypes()
+	for _, iface := range types {
+		if iface.Kind() != Interface || iface.NumMethod(true) == 0 {
+			continue
+		}
+		matrix.impls[iface] = nil
+		for _, t := range types {
+			if t.Kind() == Interface || t.NumMethod(true) == 0 || !t.Implements(iface) {
+				continue
+			}
+			matrix.impls[iface] = append(matrix.impls[iface], t)
+			matrix.ifaces[t] = append(matrix.ifaces[t], iface)
+		}
+	}
+	// computed without the lock, which the importer of type checking takes
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.impls == nil {
+		m.impls = matrix
+	}
+	return m.impls
+}
+
+// namedTypes returns the named types declared in the module,
+// sorted by package and type name.
+func (m *Module) namedTypes() []TypeNode {
+	var types []TypeNode
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			for _, n := range f.Nodes {
+				if t, ok := n.(TypeNode); ok && t.Name() != "" {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		if pi, pj := types[i].PkgName(), types[j].PkgName(); pi != pj {
+			return pi < pj
+		}
+		return types[i].Name() < types[j].Name()
+	})
+	return types
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// ImportAliases is the policy of the required import aliases,
+// e.g. {"k8s.io/apimachinery/pkg/apis/meta/v1": "metav1"}.
+// <import path, alias>
+type ImportAliases map[string]string
+
+// ImportAliasViolation is an import not named as the policy requires.
+type ImportAliasViolation struct {
+	Pos   token.Position `json:"pos"`
+	Path  string         `json:"path"`
+	Name  string         `json:"name"` // the current name
+	Alias string         `json:"alias"`
+}
+
+// String returns the violation message.
+func (v *ImportAliasViolation) String() string {
+	return fmt.Sprintf("%s: import %q should be named %s, not %s", v.Pos, v.Path, v.Alias, v.Name)
+}
+
+// CheckImportAliases returns the imports of the file violating the policy.
+// The blank and dot imports are not checked.
+func (f *File) CheckImportAliases(policy ImportAliases) []*ImportAliasViolation {
+	var violations []*ImportAliasViolation
+	for _, imp := range f.Imports {
+		alias, ok := policy[imp.Path]
+		if !ok || alias == imp.Name || imp.Name == "_" || imp.Name == "." {
+			continue
+		}
+		violations = append(violations, &ImportAliasViolation{
+			Pos:   f.FileSet.Position(imp.ImportSpec.Pos()),
+			Path:  imp.Path,
+			Name:  imp.Name,
+			Alias: alias,
+		})
+	}
+	return violations
+}
+
+// CheckImportAliases returns the imports of the package violating the policy,
+// sorted by position.
+func (p *Package) CheckImportAliases(policy ImportAliases) []*ImportAliasViolation {
+	var violations []*ImportAliasViolation
+	for _, f := range p.Files {
+		violations = append(violations, f.CheckImportAliases(policy)...)
+	}
+	sortViolations(violations)
+	return violations
+}
+
+// CheckImportAliases returns the imports of the module violating the policy,
+// sorted by position.
+func (m *Module) CheckImportAliases(policy ImportAliases) []*ImportAliasViolation {
+	var violations []*ImportAliasViolation
+	for _, p := range m.Packages {
+		violations = append(violations, p.CheckImportAliases(policy)...)
+	}
+	sortViolations(violations)
+	return violations
+}
+
+func sortViolations(violations []*ImportAliasViolation) {
+	sort.Slice(violations, func(i, j int) bool {
+		a, b := violations[i].Pos, violations[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// FixImportAliases renames the imports of the file violating the policy,
+// and rewrites the references qualified by their old names.
+// Returns the number of renamed imports.
+// Returns an error if an alias conflicts with another import
+// or a top-level declaration of the file.
+// NOTE: The file is reparsed after rewriting.
+func (f *File) FixImportAliases(policy ImportAliases) (int, error) {
+	violations := f.CheckImportAliases(policy)
+	if len(violations) == 0 {
+		return 0, nil
+	}
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	var renames = make(map[string]string, len(violations)) // <old name, alias>
+	for _, v := range violations {
+		for _, imp := range f.Imports {
+			if imp.Name == v.Alias && imp.Path != v.Path {
+				return 0, fmt.Errorf("aster: alias %s of %q conflicts with the import of %q", v.Alias, v.Path, imp.Path)
+			}
+		}
+		if f.File.Scope != nil && f.File.Scope.Lookup(v.Alias) != nil {
+			return 0, fmt.Errorf("aster: alias %s of %q conflicts with a declaration", v.Alias, v.Path)
+		}
+		renames[v.Name] = v.Alias
+	}
+
+	var edits []textEdit
+	for _, imp := range f.Imports {
+		alias, ok := renames[imp.Name]
+		if !ok || policy[imp.Path] != alias {
+			continue
+		}
+		if imp.ImportSpec.Name != nil {
+			edits = append(edits, f.textEdit(imp.ImportSpec.Name, alias))
+		} else {
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, alias+" "+strconv.Quote(imp.Path)))
+		}
+	}
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// a package name is not resolved to a local object
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if alias, ok := renames[x.Name]; ok {
+				edits = append(edits, f.textEdit(x, alias))
+			}
+		}
+		return true
+	})
+	return len(violations), f.applyEdits(edits)
+}
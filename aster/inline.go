@@ -0,0 +1,383 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// InlineEmbedded replaces the embedded struct field of the name with the
+// fields of the embedded struct, and rewrites the use sites in the module:
+//  x.Base.ID            -> x.ID
+//  T{Base: Base{ID: 1}} -> T{ID: 1}
+//
+// Returns an error if the field is not a non-pointer embedded struct declared
+// in the same package, if the embedded struct has methods that would no longer
+// be promoted, if its fields conflict with the others, or if a use site can
+// not be rewritten, e.g. x.Base used as a value.
+// NOTE: The use sites are matched by names, as the module is not type-checked.
+// The files of the module are reparsed after rewriting,
+// so the nodes must be looked up again.
+func (s *StructType) InlineEmbedded(name string) error {
+	field, ok := s.FieldByName(name)
+	if !ok || !field.Anonymous() {
+		return fmt.Errorf("aster: no embedded field %s in %s", name, s.Name())
+	}
+	if _, ok := field.Field.Type.(*ast.StarExpr); ok {
+		return fmt.Errorf("aster: can not inline the embedded pointer %s", field.TypeName())
+	}
+	st, ok := field.embeddedStruct()
+	if !ok || st.PkgName() != s.PkgName() {
+		return fmt.Errorf("aster: not an embedded struct of the package: %s", field.TypeName())
+	}
+	if st.NumMethod(true) > 0 {
+		return fmt.Errorf("aster: can not inline %s, whose methods are promoted", name)
+	}
+	var inlined = make(map[string]bool, st.NumField())
+	for i := 0; i < st.NumField(); i++ {
+		fname := st.Field(i).Name()
+		if f, ok := s.FieldByName(fname); ok && f.Name() != name {
+			return fmt.Errorf("aster: field %s of %s conflicts with %s.%s", fname, name, s.Name(), fname)
+		}
+		inlined[fname] = true
+	}
+
+	files, err := s.file.refreshModule()
+	if err != nil {
+		return err
+	}
+	typeName := s.Name()
+	outer, _ := s.file.lookupTypeExpr(typeName).(*ast.StructType)
+	inner, _ := st.file.lookupTypeExpr(name).(*ast.StructType)
+	if outer == nil || inner == nil {
+		return fmt.Errorf("aster: type not found: %s", typeName)
+	}
+	var fieldsSrc []string
+	for _, fd := range inner.Fields.List {
+		fieldsSrc = append(fieldsSrc, st.file.fieldSource(fd))
+	}
+	var edits = make(map[*File][]textEdit)
+	for _, fd := range outer.Fields.List {
+		if len(fd.Names) == 0 && s.file.TryFormatNode(genericBase(fd.Type)) == name {
+			start, end := s.file.fieldRange(fd)
+			edits[s.file] = append(edits[s.file], textEdit{start, end, strings.Join(fieldsSrc, "\n")})
+		}
+	}
+
+	for _, f := range files {
+		var inner = make(map[*ast.SelectorExpr]bool) // the x.Base of x.Base.ID
+		var err error
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.SelectorExpr:
+				sel, ok := x.X.(*ast.SelectorExpr)
+				if ok && inlined[x.Sel.Name] && sel.Sel.Name == name && !f.isPkgName(sel.X) {
+					inner[sel] = true
+					// remove `.Base`, keeping the edits nested in x.Base.X
+					edits[f] = append(edits[f], textEdit{f.offset(sel.X.End()), f.offset(sel.End()), ""})
+				}
+			case *ast.CompositeLit:
+				if err == nil && f.isTypeRef(x.Type, s.PkgName(), typeName) {
+					var es []textEdit
+					es, err = f.inlineLiteral(x, name)
+					edits[f] = append(edits[f], es...)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			x, ok := n.(*ast.SelectorExpr)
+			if ok && err == nil && x.Sel.Name == name && !inner[x] && !f.isPkgName(x.X) {
+				err = fmt.Errorf("aster: %s: can not inline %s used as a value", f.FileSet.Position(x.Pos()), name)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return applyFileEdits(files, edits)
+}
+
+// inlineLiteral returns the edits replacing the element `name: name{...}`
+// of the composite literal with the inner elements.
+func (f *File) inlineLiteral(lit *ast.CompositeLit, name string) ([]textEdit, error) {
+	for i, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("aster: %s: can not inline %s into the unkeyed literal", f.FileSet.Position(lit.Pos()), name)
+		}
+		if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != name {
+			continue
+		}
+		value, ok := kv.Value.(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf("aster: %s: can not inline %s of the value %s",
+				f.FileSet.Position(kv.Pos()), name, f.TryFormatNode(kv.Value))
+		}
+		if len(value.Elts) == 0 {
+			// remove the element along with a comma
+			switch {
+			case i+1 < len(lit.Elts):
+				return []textEdit{{f.offset(elt.Pos()), f.offset(lit.Elts[i+1].Pos()), ""}}, nil
+			case i > 0:
+				return []textEdit{{f.offset(lit.Elts[i-1].End()), f.offset(elt.End()), ""}}, nil
+			}
+			return []textEdit{f.textEdit(elt, "")}, nil
+		}
+		if _, ok := value.Elts[0].(*ast.KeyValueExpr); !ok {
+			return nil, fmt.Errorf("aster: %s: can not inline the unkeyed literal of %s", f.FileSet.Position(value.Pos()), name)
+		}
+		// keep the inner elements, so that the nested use sites can be rewritten
+		first, last := value.Elts[0], value.Elts[len(value.Elts)-1]
+		return []textEdit{
+			{f.offset(elt.Pos()), f.offset(first.Pos()), ""},
+			{f.offset(last.End()), f.offset(elt.End()), ""},
+		}, nil
+	}
+	return nil, nil
+}
+
+// ExtractEmbedded moves the fields of the names into the new struct type of
+// the name, declared after the struct, which replaces them as an embedded field.
+// The fields remain promoted, so only the keyed composite literals of the struct
+// in the module are rewritten:
+//  T{ID: 1, X: 2} -> T{Base: Base{ID: 1}, X: 2}
+//
+// Returns an error if the name is taken in the package, if a field is not
+// declared in the struct, or is declared together with an unselected field,
+// e.g. `A, B int`, or if a literal of the struct is unkeyed.
+// NOTE: The literals are matched by names, as the module is not type-checked.
+// The files of the module are reparsed after rewriting,
+// so the nodes must be looked up again.
+func (s *StructType) ExtractEmbedded(name string, fields ...string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("aster: no fields to extract into %s", name)
+	}
+	if err := s.file.CheckCollision(name); err != nil {
+		return err
+	}
+	if _, ok := s.FieldByName(name); ok {
+		return fmt.Errorf("aster: field already exists: %s.%s", s.Name(), name)
+	}
+	var moved = make(map[string]bool, len(fields))
+	for _, fname := range fields {
+		if _, ok := s.FieldByName(fname); !ok {
+			return fmt.Errorf("aster: no field %s in %s", fname, s.Name())
+		}
+		moved[fname] = true
+	}
+
+	files, err := s.file.refreshModule()
+	if err != nil {
+		return err
+	}
+	typeName := s.Name()
+	outer, _ := s.file.lookupTypeExpr(typeName).(*ast.StructType)
+	if outer == nil {
+		return fmt.Errorf("aster: type not found: %s", typeName)
+	}
+	var edits = make(map[*File][]textEdit)
+	var fieldsSrc []string
+	for _, fd := range outer.Fields.List {
+		var n int
+		for _, fname := range fieldNames(s.file, fd) {
+			if moved[fname] {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if n < len(fieldNames(s.file, fd)) {
+			return fmt.Errorf("aster: can not extract %s declared together with other fields", s.file.TryFormatNode(fd))
+		}
+		fieldsSrc = append(fieldsSrc, s.file.fieldSource(fd))
+		start, end := s.file.fieldRange(fd)
+		if len(fieldsSrc) == 1 {
+			edits[s.file] = append(edits[s.file], textEdit{start, end, name})
+		} else {
+			start, end = s.file.lineRange(start, end)
+			edits[s.file] = append(edits[s.file], textEdit{start, end, ""})
+		}
+	}
+	decl := s.file.lookupTypeDecl(typeName)
+	end := s.file.offset(decl.End())
+	edits[s.file] = append(edits[s.file], textEdit{end, end, fmt.Sprintf(
+		"\n\n// %s is extracted from %s.\ntype %s struct {\n%s\n}",
+		name, typeName, name, strings.Join(fieldsSrc, "\n"))})
+
+	for _, f := range files {
+		var err error
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if err != nil || !ok || !f.isTypeRef(lit.Type, s.PkgName(), typeName) || len(lit.Elts) == 0 {
+				return err == nil
+			}
+			var e textEdit
+			e, ok, err = f.extractLiteral(lit, name, moved)
+			if ok {
+				edits[f] = append(edits[f], e)
+				return false
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return applyFileEdits(files, edits)
+}
+
+// extractLiteral returns the edit rewriting the elements of the composite
+// literal, which moves the moved ones into the `name: name{...}` element.
+func (f *File) extractLiteral(lit *ast.CompositeLit, name string, moved map[string]bool) (textEdit, bool, error) {
+	var elts, inner []string
+	var at = -1
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return textEdit{}, false, fmt.Errorf("aster: %s: can not extract %s from the unkeyed literal",
+				f.FileSet.Position(lit.Pos()), name)
+		}
+		src := string(f.Src[f.offset(elt.Pos()):f.offset(elt.End())])
+		if key, ok := kv.Key.(*ast.Ident); ok && moved[key.Name] {
+			if at < 0 {
+				at = len(elts)
+				elts = append(elts, "")
+			}
+			inner = append(inner, src)
+			continue
+		}
+		elts = append(elts, src)
+	}
+	if at < 0 {
+		return textEdit{}, false, nil
+	}
+	typ := name
+	if sel, ok := genericBase(lit.Type).(*ast.SelectorExpr); ok {
+		typ = f.TryFormatNode(sel.X) + "." + name
+	}
+	elts[at] = fmt.Sprintf("%s: %s{%s}", name, typ, strings.Join(inner, ", "))
+	text := strings.Join(elts, ", ")
+	if f.FileSet.Position(lit.Lbrace).Line != f.FileSet.Position(lit.Rbrace).Line {
+		text = "\n" + strings.Join(elts, ",\n") + ",\n"
+	}
+	return textEdit{f.offset(lit.Lbrace) + 1, f.offset(lit.Rbrace), text}, true, nil
+}
+
+// moduleFiles returns the files of the module the file belongs to,
+// or of its package if it has no module, sorted by name.
+func (f *File) moduleFiles() []*File {
+	files := []*File{f}
+	if p, ok := f.Package(); ok {
+		files = p.sortedFiles()
+		if m, ok := p.Module(); ok {
+			files = files[:0]
+			for _, p := range m.Packages {
+				files = append(files, p.sortedFiles()...)
+			}
+			sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+		}
+	}
+	return files
+}
+
+// refreshModule refreshes the files of the module the file belongs to,
+// or of its package if it has no module, and returns them sorted by name.
+func (f *File) refreshModule() ([]*File, error) {
+	files := f.moduleFiles()
+	for _, f := range files {
+		if err := f.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// applyFileEdits applies the edits of each file.
+func applyFileEdits(files []*File, edits map[*File][]textEdit) error {
+	for _, f := range files {
+		if err := f.applyEdits(edits[f]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldRange returns the source range of the struct field,
+// including its doc and line comments.
+func (f *File) fieldRange(fd *ast.Field) (int, int) {
+	start, end := fd.Pos(), fd.End()
+	if fd.Doc != nil {
+		start = fd.Doc.Pos()
+	}
+	if fd.Comment != nil {
+		end = fd.Comment.End()
+	}
+	return f.offset(start), f.offset(end)
+}
+
+// fieldSource returns the source text of the struct field,
+// including its doc and line comments.
+func (f *File) fieldSource(fd *ast.Field) string {
+	start, end := f.fieldRange(fd)
+	return string(f.Src[start:end])
+}
+
+// fieldNames returns the names of the struct field,
+// or the type name for an embedded field.
+func fieldNames(f *File, fd *ast.Field) []string {
+	if len(fd.Names) == 0 {
+		return []string{f.TryFormatNode(genericBase(getElem(fd.Type)))}
+	}
+	var names []string
+	for _, id := range fd.Names {
+		names = append(names, id.Name)
+	}
+	return names
+}
+
+// isPkgName reports whether the expression is an imported package name.
+func (f *File) isPkgName(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	if !ok || id.Obj != nil {
+		return false
+	}
+	for _, imp := range f.Imports {
+		if imp.Name == id.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// isTypeRef reports whether the type expression of the file refers to
+// the named type of the package, e.g. T in the package, or pkg.T outside it.
+func (f *File) isTypeRef(typ ast.Expr, pkgName, name string) bool {
+	switch x := genericBase(typ).(type) {
+	case *ast.Ident:
+		return f.PkgName == pkgName && x.Name == name
+	case *ast.SelectorExpr:
+		return x.Sel.Name == name && f.PkgName != pkgName && f.isPkgName(x.X)
+	}
+	return false
+}
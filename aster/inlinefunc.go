@@ -0,0 +1,717 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inline replaces the calls of the function or method across the module with
+// its body, and returns the number of the calls replaced. The body of a single
+// return statement of one result replaces the call expression, and the others
+// replace the statement of the call, i.e. the call itself, or the assignment
+// of the results returned by the final return statement.
+// The arguments are substituted for the parameters if they have no side
+// effects, or are used once and in order by an expression body, and are
+// assigned to the variables otherwise. The local names of the body are
+// renamed if they are taken at the call.
+// The calls which can not be inlined so are kept, e.g. the calls of a
+// statement body in a condition, or the calls where a name of the body
+// refers to another declaration.
+// The declaration is removed if remove is true and no references remain.
+// Returns an error if the function is generic, variadic or recursive, or has
+// named results, or a body returning early, deferring or recovering calls,
+// or jumping to the labels.
+// The packages are type-checked against the export data of their
+// dependencies, see Module.Importer.
+// NOTE: The files of the module are reparsed after inlining,
+// so the nodes must be looked up again.
+func (f *FuncDecl) Inline(remove ...bool) (int, error) {
+	if decl, ok := f.node.(*ast.FuncDecl); !ok || decl.Body == nil {
+		return 0, fmt.Errorf("aster: not a function declaration with body: %s", f.Name())
+	}
+	file, name, recv := f.file, f.Name(), recvTypeName(f)
+	var total int
+	for {
+		if _, err := file.refreshModule(); err != nil {
+			return total, err
+		}
+		n, ok := file.lookupTopNode(name, Func, recv)
+		if !ok {
+			return total, fmt.Errorf("aster: function not found: %s", name)
+		}
+		callee, err := newInlinee(n.(*FuncDecl))
+		if err != nil {
+			return total, err
+		}
+		// the calls nested in the arguments of another are inlined next round
+		count, err := callee.inlineCalls(n.References())
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count == 0 {
+			if len(remove) > 0 && remove[0] && len(n.References()) == 0 {
+				err = file.RemoveNode(n)
+			}
+			return total, err
+		}
+	}
+}
+
+// inlinee is the function to inline.
+type inlinee struct {
+	fn      *FuncDecl
+	decl    *ast.FuncDecl
+	info    *types.Info
+	pkg     *types.Package
+	sig     *types.Signature
+	params  []*types.Var // the receiver first, if any
+	uses    map[*types.Var][]*ast.Ident
+	changed map[*types.Var]bool
+	locals  []*ast.Ident                // the local declarations and their uses
+	free    map[*ast.Ident]types.Object // the package-level, imported and predeclared names
+	ret     *ast.ReturnStmt             // the final return statement
+	expr    bool                        // the body is a single return statement of one result
+	parents map[ast.Node]ast.Node
+	callers map[*Package]*callerTypes
+}
+
+// callerTypes is the type information of a package calling the function.
+type callerTypes struct {
+	info    *types.Info
+	pkg     *types.Package
+	parents map[*File]map[ast.Node]ast.Node
+}
+
+func newInlinee(fn *FuncDecl) (*inlinee, error) {
+	decl := fn.node.(*ast.FuncDecl)
+	info := newTypesInfo()
+	pkg, err := fn.file.checkTypes(info)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := info.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("aster: function not type-checked: %s", fn.Name())
+	}
+	sig := obj.Type().(*types.Signature)
+	switch {
+	case sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0:
+		return nil, fmt.Errorf("aster: can not inline the generic function: %s", fn.Name())
+	case sig.Variadic():
+		return nil, fmt.Errorf("aster: can not inline the variadic function: %s", fn.Name())
+	case sig.Results().Len() > 0 && sig.Results().At(0).Name() != "":
+		return nil, fmt.Errorf("aster: can not inline the function of named results: %s", fn.Name())
+	}
+	c := &inlinee{
+		fn:      fn,
+		decl:    decl,
+		info:    info,
+		pkg:     pkg,
+		sig:     sig,
+		uses:    make(map[*types.Var][]*ast.Ident),
+		changed: changedVars(info, decl.Body.List...),
+		free:    make(map[*ast.Ident]types.Object),
+		parents: parentMap(decl),
+		callers: map[*Package]*callerTypes{fn.file.pkg: {info: info, pkg: pkg, parents: make(map[*File]map[ast.Node]ast.Node)}},
+	}
+	if recv := sig.Recv(); recv != nil {
+		c.params = append(c.params, recv)
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		c.params = append(c.params, sig.Params().At(i))
+	}
+	stmts := decl.Body.List
+	if len(stmts) > 0 {
+		c.ret, _ = stmts[len(stmts)-1].(*ast.ReturnStmt)
+	}
+	switch {
+	case sig.Results().Len() > 0 && c.ret == nil:
+		return nil, fmt.Errorf("aster: the body does not end with a return statement: %s", fn.Name())
+	case c.ret != nil && len(c.ret.Results) != sig.Results().Len():
+		return nil, fmt.Errorf("aster: can not inline the return of multiple values: %s", fn.Name())
+	}
+	c.expr = len(stmts) == 1 && c.ret != nil && len(c.ret.Results) == 1
+
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if x != c.ret {
+				err = fmt.Errorf("aster: can not inline the function returning early: %s", fn.Name())
+			}
+		case *ast.DeferStmt:
+			err = fmt.Errorf("aster: can not inline the function deferring calls: %s", fn.Name())
+		case *ast.LabeledStmt:
+			err = fmt.Errorf("aster: can not inline the function of labels: %s", fn.Name())
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		x, ok := n.(*ast.Ident)
+		if !ok || err != nil {
+			return err == nil
+		}
+		if obj := info.Defs[x]; obj != nil && obj.Parent() != nil {
+			c.locals = append(c.locals, x)
+			return true
+		}
+		switch obj := info.Uses[x].(type) {
+		case nil:
+		case *types.Func:
+			if obj == info.Defs[decl.Name] {
+				err = fmt.Errorf("aster: can not inline the recursive function: %s", fn.Name())
+			} else if obj.Parent() == pkg.Scope() {
+				c.free[x] = obj
+			}
+		case *types.Builtin:
+			if obj.Name() == "recover" {
+				err = fmt.Errorf("aster: can not inline the function recovering: %s", fn.Name())
+			}
+			c.free[x] = obj
+		case *types.PkgName:
+			c.free[x] = obj
+		case *types.Var:
+			switch {
+			case containsVar(c.params, obj):
+				c.uses[obj] = append(c.uses[obj], x)
+			case obj.Parent() == pkg.Scope():
+				c.free[x] = obj
+			case obj.Parent() != nil && decl.Body.Pos() <= obj.Pos() && obj.Pos() < decl.Body.End():
+				c.locals = append(c.locals, x)
+			}
+		default:
+			switch {
+			case obj.Parent() == pkg.Scope() || obj.Parent() == types.Universe:
+				c.free[x] = obj
+			case obj.Parent() != nil && decl.Body.Pos() <= obj.Pos() && obj.Pos() < decl.Body.End():
+				c.locals = append(c.locals, x)
+			}
+		}
+		return true
+	})
+	return c, err
+}
+
+// inlineCalls inlines the calls of the references, except those nested in
+// the arguments of another, and returns the number of them.
+func (c *inlinee) inlineCalls(refs []Ref) (int, error) {
+	var (
+		count   int
+		files   []*File
+		edits   = make(map[*File][]textEdit)
+		imports = make(map[*File]map[string]string) // <path, name>
+	)
+	for _, ref := range refs {
+		if ref.Guess || (ref.File == c.fn.file && c.decl.Pos() <= ref.Ident.Pos() && ref.Ident.Pos() < c.decl.End()) {
+			continue
+		}
+		ct, err := c.callerOf(ref.File)
+		if err != nil {
+			return 0, err
+		}
+		imps := make(map[string]string)
+		e, ok := c.inlineCall(ref, ct, imps)
+		if !ok {
+			continue
+		}
+		nested := false
+		for _, x := range edits[ref.File] {
+			if e.start < x.end && x.start < e.end {
+				nested = true
+			}
+		}
+		if nested {
+			continue
+		}
+		if _, ok := edits[ref.File]; !ok {
+			files = append(files, ref.File)
+			imports[ref.File] = make(map[string]string)
+		}
+		edits[ref.File] = append(edits[ref.File], e)
+		for path, name := range imps {
+			imports[ref.File][path] = name
+		}
+		count++
+	}
+	for _, f := range files {
+		if err := f.applyEdits(edits[f]); err != nil {
+			return count, err
+		}
+		for path, name := range imports[f] {
+			if err := f.AddImport(name, path); err != nil {
+				return count, err
+			}
+		}
+		if err := f.FixImports(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// callerOf returns the type information of the package of the file.
+func (c *inlinee) callerOf(f *File) (*callerTypes, error) {
+	if ct, ok := c.callers[f.pkg]; ok {
+		return ct, nil
+	}
+	info := newTypesInfo()
+	pkg, err := f.checkTypes(info)
+	if err != nil {
+		return nil, err
+	}
+	ct := &callerTypes{info: info, pkg: pkg, parents: make(map[*File]map[ast.Node]ast.Node)}
+	c.callers[f.pkg] = ct
+	return ct, nil
+}
+
+// inlineArg is an argument of the call, or the receiver.
+type inlineArg struct {
+	expr    ast.Expr
+	text    string
+	pure    bool // no side effects
+	primary bool // no parentheses needed
+}
+
+// inlineCall returns the edit of the call of the reference,
+// and adds the imports it needs, or false if it can not be inlined.
+func (c *inlinee) inlineCall(ref Ref, ct *callerTypes, imports map[string]string) (textEdit, bool) {
+	file := ref.File
+	parents, ok := ct.parents[file]
+	if !ok {
+		parents = parentMap(file.File)
+		ct.parents[file] = parents
+	}
+	samePkg := file.pkg == c.fn.file.pkg
+	calleePath, callerPath := c.fn.file.pkg.Path(), file.pkg.Path()
+
+	// the call, and the receiver or the qualifier of the function
+	var (
+		call      *ast.CallExpr
+		recvX     ast.Expr
+		qualifier string
+	)
+	switch p := parents[ref.Ident].(type) {
+	case *ast.CallExpr:
+		if p.Fun == ref.Ident {
+			call = p
+		}
+	case *ast.SelectorExpr:
+		if p.Sel != ref.Ident {
+			break
+		}
+		if c.sig.Recv() != nil {
+			sel, ok := ct.info.Selections[p]
+			if !ok || sel.Kind() != types.MethodVal || len(sel.Index()) != 1 {
+				break
+			}
+			recvX = p.X
+		} else if x, ok := p.X.(*ast.Ident); ok {
+			qualifier = x.Name
+		}
+		if pc, ok := parents[p].(*ast.CallExpr); ok && pc.Fun == p {
+			call = pc
+		}
+	}
+	if call == nil || call.Ellipsis.IsValid() || len(call.Args) != c.sig.Params().Len() {
+		return textEdit{}, false
+	}
+	pos := call.Pos()
+	scope := ct.pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return textEdit{}, false
+	}
+	lookup := func(name string) types.Object {
+		_, obj := scope.LookupParent(name, pos)
+		return obj
+	}
+	if !samePkg && qualifier == "" {
+		qualifier = c.pkg.Name()
+		for _, imp := range file.Imports {
+			if imp.Path == calleePath {
+				qualifier = imp.Name
+			}
+		}
+		if obj, ok := lookup(qualifier).(*types.PkgName); !ok && obj != nil {
+			return textEdit{}, false
+		} else if !ok {
+			imports[calleePath] = importName(qualifier, calleePath)
+		}
+	}
+	typeString := func(t types.Type) string {
+		return types.TypeString(t, func(p *types.Package) string {
+			switch {
+			case p == ct.pkg:
+				return ""
+			case p == c.pkg:
+				return qualifier
+			}
+			for _, imp := range file.Imports {
+				if imp.Path == p.Path() && imp.Name != "_" {
+					if imp.Name == "." {
+						return ""
+					}
+					return imp.Name
+				}
+			}
+			imports[p.Path()] = importName(p.Name(), p.Path())
+			return p.Name()
+		})
+	}
+	typeKey := func(t types.Type) string {
+		return types.TypeString(t, func(p *types.Package) string {
+			switch p {
+			case c.pkg:
+				return calleePath
+			case ct.pkg:
+				return callerPath
+			}
+			return p.Path()
+		})
+	}
+
+	// the names declared by the declaration enclosing the call
+	declared := make(map[string]bool)
+	for _, decl := range file.File.Decls {
+		if decl.Pos() <= pos && pos < decl.End() {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && ct.info.Defs[id] != nil {
+					declared[id.Name] = true
+				}
+				return true
+			})
+		}
+	}
+	replace := make(map[*ast.Ident]string)
+
+	// the free names of the body must refer to the same declarations
+	for id, obj := range c.free {
+		got := lookup(id.Name)
+		switch obj := obj.(type) {
+		case *types.PkgName:
+			if pn, ok := got.(*types.PkgName); ok && pn.Imported().Path() == obj.Imported().Path() {
+				continue
+			}
+			if got != nil {
+				return textEdit{}, false
+			}
+			imports[obj.Imported().Path()] = importName(id.Name, obj.Imported().Path())
+		default:
+			switch {
+			case obj.Parent() == types.Universe || samePkg:
+				if got != obj {
+					return textEdit{}, false
+				}
+			case !obj.Exported():
+				return textEdit{}, false
+			default:
+				replace[id] = qualifier + "." + id.Name
+			}
+		}
+	}
+
+	// the fresh names of the locals and the variables of the arguments
+	bodyNames := make(map[string]bool)
+	for _, id := range c.locals {
+		bodyNames[id.Name] = true
+	}
+	for id := range c.free {
+		bodyNames[id.Name] = true
+	}
+	taken := func(name string) bool {
+		return lookup(name) != nil || declared[name]
+	}
+	fresh := func(name string) string {
+		if !taken(name) && !bodyNames[name] {
+			bodyNames[name] = true
+			return name
+		}
+		for i := 1; ; i++ {
+			if s := name + strconv.Itoa(i); !taken(s) && !bodyNames[s] {
+				bodyNames[s] = true
+				return s
+			}
+		}
+	}
+	renamed := make(map[types.Object]string)
+	locals := append([]*ast.Ident(nil), c.locals...)
+	sort.Slice(locals, func(i, j int) bool { return locals[i].Pos() < locals[j].Pos() })
+	for _, id := range locals {
+		obj := c.info.Defs[id]
+		if obj == nil {
+			obj = c.info.Uses[id]
+		}
+		name, ok := renamed[obj]
+		if !ok {
+			name = id.Name
+			if taken(name) {
+				delete(bodyNames, name)
+				name = fresh(name)
+			}
+			renamed[obj] = name
+		}
+		if name != id.Name {
+			replace[id] = name
+		}
+	}
+
+	// the arguments
+	args := make([]inlineArg, 0, len(c.params))
+	if recvX != nil {
+		text := file.source(recvX)
+		_, recvPtr := c.sig.Recv().Type().Underlying().(*types.Pointer)
+		_, xPtr := ct.info.TypeOf(recvX).Underlying().(*types.Pointer)
+		if !isPrimary(recvX) && recvPtr != xPtr {
+			text = "(" + text + ")"
+		}
+		switch {
+		case recvPtr && !xPtr:
+			args = append(args, inlineArg{expr: &ast.UnaryExpr{Op: token.AND, X: recvX}, text: "&" + text, pure: isPure(ct.info, recvX)})
+		case !recvPtr && xPtr:
+			args = append(args, inlineArg{expr: &ast.StarExpr{X: recvX}, text: "*" + text, pure: isPure(ct.info, recvX)})
+		default:
+			args = append(args, inlineArg{expr: recvX, text: text, pure: isPure(ct.info, recvX), primary: isPrimary(recvX)})
+		}
+	}
+	for i, x := range call.Args {
+		arg := inlineArg{expr: x, text: file.source(x), pure: isPure(ct.info, x), primary: isPrimary(x)}
+		if t := c.sig.Params().At(i).Type(); typeKey(ct.info.TypeOf(x)) != typeKey(t) {
+			arg.text, arg.primary = conversion(typeString(t), arg.text), true
+		}
+		args = append(args, arg)
+	}
+	// the selectors of the addressed receiver need no address
+	if recvX != nil && strings.HasPrefix(args[0].text, "&") && args[0].pure {
+		for _, use := range c.uses[c.params[0]] {
+			if sel, ok := c.parents[use].(*ast.SelectorExpr); ok && sel.X == use {
+				replace[use] = strings.TrimPrefix(args[0].text, "&")
+			}
+		}
+	}
+	var bindings []string
+	var last token.Pos // the last use of the argument with side effects
+	for i, v := range c.params {
+		arg, uses := args[i], c.uses[v]
+		switch {
+		case len(uses) == 0:
+			if !arg.pure {
+				if c.expr {
+					return textEdit{}, false
+				}
+				bindings = append(bindings, "_ = "+arg.text)
+			}
+		case c.expr && c.changed[v]:
+			return textEdit{}, false
+		case c.expr && !arg.pure:
+			if len(uses) > 1 || uses[0].Pos() < last {
+				return textEdit{}, false
+			}
+			last = uses[0].Pos()
+			fallthrough
+		case arg.pure && !c.changed[v]:
+			for _, use := range uses {
+				if _, ok := replace[use]; ok {
+					continue
+				}
+				replace[use] = arg.text
+				if !arg.primary && needParens(c.parents[use], use, arg.expr) {
+					replace[use] = "(" + arg.text + ")"
+				}
+			}
+		default:
+			name := fresh(v.Name())
+			bindings = append(bindings, name+" := "+arg.text)
+			for _, use := range uses {
+				replace[use] = name
+			}
+		}
+	}
+	// the source text of the body with the replacements
+	text := func(start, end token.Pos) string {
+		var within []textEdit
+		base := c.fn.file.offset(start)
+		for id, s := range replace {
+			if start <= id.Pos() && id.End() <= end {
+				within = append(within, textEdit{start: c.fn.file.offset(id.Pos()) - base, end: c.fn.file.offset(id.End()) - base, text: s})
+			}
+		}
+		return spliceEdits(string(c.fn.file.Src[base:c.fn.file.offset(end)]), within)
+	}
+	var results []string
+	if c.ret != nil {
+		for i, r := range c.ret.Results {
+			s := text(r.Pos(), r.End())
+			if t := c.sig.Results().At(i).Type(); typeKey(c.info.TypeOf(r)) != typeKey(t) {
+				s = conversion(typeString(t), s)
+			} else if c.expr && !isPrimary(r) && needParens(parents[call], call, r) {
+				s = "(" + s + ")"
+			}
+			results = append(results, s)
+		}
+	}
+
+	if c.expr {
+		if stmt, ok := parents[call].(*ast.ExprStmt); ok {
+			switch r := c.ret.Results[0].(type) {
+			case *ast.CallExpr:
+			case *ast.UnaryExpr:
+				if r.Op != token.ARROW {
+					results[0] = "_ = " + results[0]
+				}
+			default:
+				results[0] = "_ = " + results[0]
+			}
+			return file.textEdit(stmt, results[0]), true
+		}
+		return file.textEdit(call, results[0]), true
+	}
+	var stmt ast.Stmt
+	switch s := parents[call].(type) {
+	case *ast.ExprStmt:
+		stmt = s
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 {
+			stmt = s
+		}
+	}
+	switch parents[stmt].(type) {
+	case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+	default:
+		return textEdit{}, false
+	}
+	lines := bindings
+	end := c.decl.Body.Rbrace
+	if c.ret != nil {
+		end = c.ret.Pos()
+	}
+	if body := strings.TrimSpace(text(c.decl.Body.Lbrace+1, end)); body != "" {
+		lines = append(lines, body)
+	}
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		for i, r := range results {
+			if !isPure(c.info, c.ret.Results[i]) {
+				lines = append(lines, "_ = "+r)
+			}
+		}
+	case *ast.AssignStmt:
+		lhs := string(file.Src[file.offset(s.Lhs[0].Pos()):file.offset(s.Lhs[len(s.Lhs)-1].End())])
+		lines = append(lines, lhs+" "+s.Tok.String()+" "+strings.Join(results, ", "))
+	}
+	return file.textEdit(stmt, strings.Join(lines, "\n")), true
+}
+
+// source returns the source text of the node.
+func (f *File) source(n ast.Node) string {
+	return string(f.Src[f.offset(n.Pos()):f.offset(n.End())])
+}
+
+// conversion returns the conversion of the expression to the type.
+func conversion(typ, x string) string {
+	if strings.HasPrefix(typ, "*") || strings.HasPrefix(typ, "<-") || strings.HasPrefix(typ, "func") {
+		typ = "(" + typ + ")"
+	}
+	return typ + "(" + x + ")"
+}
+
+// isPure reports whether the expression has no side effects, and evaluates
+// to the same value each time, e.g. a variable, a constant or a field.
+func isPure(info *types.Info, x ast.Expr) bool {
+	if tv, ok := info.Types[x]; ok && tv.Value != nil {
+		return true
+	}
+	switch x := x.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isPure(info, x.X)
+	case *ast.SelectorExpr:
+		return isPure(info, x.X)
+	case *ast.UnaryExpr:
+		if _, ok := x.X.(*ast.CompositeLit); ok {
+			return false
+		}
+		return x.Op != token.ARROW && isPure(info, x.X)
+	}
+	return false
+}
+
+// isPrimary reports whether the expression is a primary expression,
+// which needs no parentheses as an operand.
+func isPrimary(x ast.Expr) bool {
+	switch x.(type) {
+	case *ast.Ident, *ast.BasicLit, *ast.CompositeLit, *ast.SelectorExpr, *ast.IndexExpr,
+		*ast.SliceExpr, *ast.TypeAssertExpr, *ast.CallExpr, *ast.ParenExpr:
+		return true
+	}
+	return false
+}
+
+// needParens reports whether the expression x replacing the child of the
+// parent needs the parentheses, if it is not primary.
+func needParens(parent ast.Node, child, x ast.Expr) bool {
+	switch p := parent.(type) {
+	case *ast.ExprStmt, *ast.AssignStmt, *ast.ReturnStmt, *ast.ValueSpec, *ast.CompositeLit,
+		*ast.KeyValueExpr, *ast.SendStmt, *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt, *ast.CaseClause:
+		return false
+	case *ast.CallExpr:
+		return p.Fun == child
+	case *ast.IndexExpr:
+		return p.X == child
+	case *ast.SliceExpr:
+		return p.X == child
+	case *ast.BinaryExpr:
+		switch x := x.(type) {
+		case *ast.UnaryExpr, *ast.StarExpr:
+			return false
+		case *ast.BinaryExpr:
+			prec := x.Op.Precedence() - p.Op.Precedence()
+			return prec < 0 || prec == 0 && p.Y == child
+		}
+	}
+	return true
+}
+
+// parentMap returns the parents of the nodes in the tree of the root.
+func parentMap(root ast.Node) map[ast.Node]ast.Node {
+	parents := make(map[ast.Node]ast.Node)
+	var stack []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if len(stack) > 0 {
+			parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return parents
+}
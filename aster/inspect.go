@@ -17,6 +17,7 @@ package aster
 import (
 	"go/ast"
 	"go/token"
+	"sort"
 	"strings"
 )
 
@@ -31,11 +32,10 @@ func (m *Module) Inspect(fn func(Node) bool) {
 func (m *Module) Fetch(fn func(Node) bool) (nodes []Node) {
 	for _, p := range m.Packages {
 		p.Inspect(func(n Node) bool {
-			next := fn(n)
-			if next {
+			if fn(n) {
 				nodes = append(nodes, n)
 			}
-			return next
+			return true
 		})
 	}
 	return nodes
@@ -56,11 +56,10 @@ func (p *Package) Inspect(fn func(Node) bool) {
 // Fetch traversing through the current package, fetches node if fn returns true.
 func (p *Package) Fetch(fn func(Node) bool) (nodes []Node) {
 	p.Inspect(func(n Node) bool {
-		next := fn(n)
-		if next {
+		if fn(n) {
 			nodes = append(nodes, n)
 		}
-		return next
+		return true
 	})
 	return nodes
 }
@@ -86,6 +85,16 @@ func (f *File) Package() (*Package, bool) {
 	return f.pkg, f.pkg != nil
 }
 
+// IsTest returns true if the file is a _test.go file.
+func (f *File) IsTest() bool {
+	return strings.HasSuffix(f.Filename, "_test.go")
+}
+
+// IsTest returns true if the package is an external test package, e.g. foo_test.
+func (p *Package) IsTest() bool {
+	return strings.HasSuffix(p.Name, "_test")
+}
+
 // Inspect traverses nodes in the file.
 func (f *File) Inspect(fn func(Node) bool) {
 	for _, n := range f.Nodes {
@@ -98,15 +107,116 @@ func (f *File) Inspect(fn func(Node) bool) {
 // Fetch traversing through the current file, fetches node if fn returns true.
 func (f *File) Fetch(fn func(Node) bool) (nodes []Node) {
 	f.Inspect(func(n Node) bool {
-		next := fn(n)
-		if next {
+		if fn(n) {
 			nodes = append(nodes, n)
 		}
-		return next
+		return true
 	})
 	return nodes
 }
 
+// Types returns the type nodes of the package,
+// sorted by file name and position.
+func (p *Package) Types() []TypeNode {
+	var types []TypeNode
+	for _, f := range p.sortedFiles() {
+		types = append(types, f.Types()...)
+	}
+	return types
+}
+
+// Funcs returns the function nodes of the package, including methods,
+// sorted by file name and position.
+func (p *Package) Funcs() []FuncNode {
+	var funcs []FuncNode
+	for _, f := range p.sortedFiles() {
+		funcs = append(funcs, f.Funcs()...)
+	}
+	return funcs
+}
+
+// Structs returns the struct type nodes of the package,
+// sorted by file name and position.
+func (p *Package) Structs() []TypeNode {
+	return filterKind(p.Types(), Struct)
+}
+
+// Interfaces returns the interface type nodes of the package,
+// sorted by file name and position.
+func (p *Package) Interfaces() []TypeNode {
+	return filterKind(p.Types(), Interface)
+}
+
+func (m *Module) sortedPackages() []*Package {
+	pkgs := make([]*Package, 0, len(m.Packages))
+	for _, p := range m.Packages {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs
+}
+
+func (p *Package) sortedFiles() []*File {
+	files := make([]*File, 0, len(p.Files))
+	for _, f := range p.Files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	return files
+}
+
+// Types returns the type nodes of the file, sorted by position.
+func (f *File) Types() []TypeNode {
+	var types []TypeNode
+	for _, n := range f.sortedNodes() {
+		if t, ok := n.(TypeNode); ok {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Funcs returns the function nodes of the file, including methods,
+// sorted by position.
+func (f *File) Funcs() []FuncNode {
+	var funcs []FuncNode
+	for _, n := range f.sortedNodes() {
+		if fn, ok := n.(FuncNode); ok {
+			funcs = append(funcs, fn)
+		}
+	}
+	return funcs
+}
+
+// Structs returns the struct type nodes of the file, sorted by position.
+func (f *File) Structs() []TypeNode {
+	return filterKind(f.Types(), Struct)
+}
+
+// Interfaces returns the interface type nodes of the file, sorted by position.
+func (f *File) Interfaces() []TypeNode {
+	return filterKind(f.Types(), Interface)
+}
+
+func (f *File) sortedNodes() []Node {
+	nodes := make([]Node, 0, len(f.Nodes))
+	for _, n := range f.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node().Pos() < nodes[j].Node().Pos() })
+	return nodes
+}
+
+func filterKind(types []TypeNode, kind Kind) []TypeNode {
+	var r []TypeNode
+	for _, t := range types {
+		if t.Kind() == kind {
+			r = append(r, t)
+		}
+	}
+	return r
+}
+
 // LookupImports lookups the import info by package name.
 func (f *File) LookupImports(currPkgName string) (imports []*Import, found bool) {
 	for _, imp := range f.Imports {
@@ -118,6 +228,15 @@ func (f *File) LookupImports(currPkgName string) (imports []*Import, found bool)
 	return
 }
 
+// LookupImportPath returns the path of the import by package name,
+// or the name itself if the file does not import it.
+func (f *File) LookupImportPath(currPkgName string) string {
+	if imps, found := f.LookupImports(currPkgName); found {
+		return imps[0].Path
+	}
+	return currPkgName
+}
+
 // LookupPackages lookups the package object by package name.
 // NOTE: Only lookup the parsed module.
 func (f *File) LookupPackages(currPkgName string) (pkgs []*Package, found bool) {
@@ -194,13 +313,16 @@ func createTypeNodeByNameInPkg(name string) (func(Node) bool, bool) {
 	if strings.Contains(name, ".") {
 		return nil, false
 	}
-	name = strings.TrimLeft(name, "*")
+	name = baseTypeName(name)
 	return func(b Node) bool {
 		return IsTypeNode(b) && b.Name() == name
 	}, true
 }
 
 func (p *Package) collectNodes() {
+	if p.module != nil {
+		p.module.impls = nil
+	}
 	for _, f := range p.Files {
 		f.collectNodes(false)
 	}
@@ -217,12 +339,32 @@ func (f *File) collectNodes(singleParsing bool) {
 	f.collectTypesOtherThanStruct()
 	f.collectFuncs()
 	f.collectStructs()
+	if f.pkg != nil && f.pkg.module != nil && f.pkg.module.visibility == VisibilityExported {
+		f.dropUnexported()
+	}
 	f.setStructFields()
 	if singleParsing {
 		f.bindMethods()
 	}
 }
 
+// dropUnexported drops the named nodes not exported,
+// and the methods of the types not exported.
+func (f *File) dropUnexported() {
+	for pos, n := range f.Nodes {
+		name := n.Name()
+		if recv, ok := n.(FuncNode); ok {
+			if r, ok := recv.Recv(); ok && !IsExported(baseTypeName(r.TypeName)) {
+				name = ""
+				delete(f.Nodes, pos)
+			}
+		}
+		if name != "" && !IsExported(name) {
+			delete(f.Nodes, pos)
+		}
+	}
+}
+
 func (f *File) collectFuncs() {
 	collectFuncs := func(n ast.Node) bool {
 		var t *FuncDecl
@@ -240,6 +382,7 @@ func (f *File) collectFuncs() {
 				f.expandFuncFields(x.Type.Params),
 				f.expandFuncFields(x.Type.Results),
 			)
+			t.typeParams = x.Type.TypeParams
 		default:
 			return true
 		}
@@ -314,7 +457,8 @@ func (f *File) collectTypesOtherThanStruct() {
 			t = f.newAliasType(namePtr, doc, node.Assign, node.Type)
 		} else {
 			switch x := elem.(type) {
-			case *ast.SelectorExpr:
+			case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+				// qualified or instantiated generic type
 				t = f.newAliasType(namePtr, doc, node.Assign, x)
 
 			case *ast.Ident:
@@ -336,6 +480,10 @@ func (f *File) collectTypesOtherThanStruct() {
 				return
 			}
 		}
+		superOf(t).typeParams = node.TypeParams
+		if node.Assign.IsValid() {
+			t.(interface{ setAlias(ast.Expr) }).setAlias(node.Type)
+		}
 		f.Nodes[t.Node().Pos()] = t
 	})
 }
@@ -357,6 +505,7 @@ func (f *File) collectStructs() {
 				var t ast.Expr
 				var structName *string
 				var doc = x.Doc
+				var typeParams *ast.FieldList
 				switch y := spec.(type) {
 				case *ast.TypeSpec:
 					if y.Type == nil {
@@ -365,6 +514,7 @@ func (f *File) collectStructs() {
 					assign = y.Assign
 					structName = &y.Name.Name
 					t = y.Type
+					typeParams = y.TypeParams
 					if y.Doc != nil {
 						doc = y.Doc
 					}
@@ -381,6 +531,10 @@ func (f *File) collectStructs() {
 					continue
 				}
 				st := f.newStructType(structName, doc, assign, z)
+				st.typeParams = typeParams
+				if _, ok := spec.(*ast.TypeSpec); ok && assign.IsValid() {
+					st.alias = z
+				}
 				f.Nodes[st.Node().Pos()] = st
 			}
 		}
@@ -414,7 +568,6 @@ func (f *File) bindMethods() {
 			continue
 		}
 		t.addMethod(fb)
-		break
 	}
 }
 
@@ -461,6 +614,45 @@ func (f *File) expandFuncFields(fieldList *ast.FieldList) (fields []*FuncField)
 	return
 }
 
+// exprKind returns the kind of the type expression.
+func (f *File) exprKind(e ast.Expr) Kind {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return f.exprKind(x.X)
+	case *ast.Ident:
+		if k, found := getBasicKind(x.Name); found {
+			return k
+		}
+		if x.Name == "error" {
+			return Interface
+		}
+		if t, found := f.LookupTypeInPkg(x.Name); found {
+			return t.Kind()
+		}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		// instantiated generic type
+		return f.exprKind(genericBase(x))
+	case *ast.StarExpr:
+		return Ptr
+	case *ast.ArrayType:
+		if x.Len == nil {
+			return Slice
+		}
+		return Array
+	case *ast.MapType:
+		return Map
+	case *ast.ChanType:
+		return Chan
+	case *ast.FuncType:
+		return Func
+	case *ast.StructType:
+		return Struct
+	case *ast.InterfaceType:
+		return Interface
+	}
+	return Suspense
+}
+
 func getElem(e ast.Expr) ast.Expr {
 	for {
 		s, ok := e.(*ast.StarExpr)
@@ -0,0 +1,182 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// InstrumentConfig configures the prologue injected by Instrument, e.g.
+// a tracing span:
+//  &aster.InstrumentConfig{
+//  	Prologue: `_, span := otel.Tracer("{{.Package}}").Start(context.Background(), "{{.Name}}")
+//  defer span.End()`,
+//  	Imports: map[string]string{"context": "", "go.opentelemetry.io/otel": ""},
+//  }
+type InstrumentConfig struct {
+	// Prologue is the text/template of the statements inserted at the start
+	// of the function bodies, executed with the *InstrumentData of each.
+	Prologue string
+	// Imports are the import paths the prologue refers to,
+	// with the names to import them as, or "" if not renamed.
+	Imports map[string]string
+	// Filter selects the functions and methods to instrument,
+	// by default the exported ones.
+	Filter func(FuncNode) bool
+}
+
+// InstrumentData is the data of the prologue template of a function.
+type InstrumentData struct {
+	Package string       // the package name
+	Func    string       // the function or method name
+	Recv    string       // the receiver base type name, or "" for a function
+	Name    string       // e.g. "Func", or "Type.Method" for a method
+	Params  []*FuncField // the parameters, excluding the unnamed and blank ones
+}
+
+// ParamNames returns the names of the parameters separated by commas,
+// e.g. for a log call: log.Println("{{.Name}}", {{.ParamNames}}).
+func (d *InstrumentData) ParamNames() string {
+	names := make([]string, len(d.Params))
+	for i, p := range d.Params {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Instrument injects the prologue into the selected functions and methods
+// of the package files, see (*File).Instrument.
+// Returns the number of the functions instrumented.
+func (p *Package) Instrument(cfg *InstrumentConfig) (int, error) {
+	var total int
+	for _, f := range p.sortedFiles() {
+		n, err := f.Instrument(cfg)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Instrument injects the prologue into the selected functions and methods
+// of the file, declared with bodies, and adds the imports it refers to.
+// The functions already starting with their prologue are skipped, so that
+// instrumenting is idempotent.
+// Returns the number of the functions instrumented.
+// NOTE: The file is reparsed after instrumenting.
+func (f *File) Instrument(cfg *InstrumentConfig) (int, error) {
+	if cfg == nil || strings.TrimSpace(cfg.Prologue) == "" {
+		return 0, fmt.Errorf("aster: no prologue to instrument")
+	}
+	tmpl, err := template.New("prologue").Parse(cfg.Prologue)
+	if err != nil {
+		return 0, fmt.Errorf("aster: invalid prologue template: %w", err)
+	}
+	filter := cfg.Filter
+	if filter == nil {
+		filter = func(fn FuncNode) bool { return IsExported(fn.Name()) }
+	}
+	if err = f.refresh(); err != nil {
+		return 0, err
+	}
+	var edits []textEdit
+	for _, n := range f.sortedNodes() {
+		fn, ok := n.(*FuncDecl)
+		if !ok {
+			continue
+		}
+		decl, ok := fn.node.(*ast.FuncDecl)
+		if !ok || decl.Body == nil || !filter(fn) {
+			continue
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, f.instrumentData(fn)); err != nil {
+			return 0, fmt.Errorf("aster: prologue of %s: %w", fn.Name(), err)
+		}
+		prologue := buf.String()
+		stmts, fset, err := parseStmts(prologue)
+		if err != nil {
+			return 0, fmt.Errorf("aster: prologue of %s: %w", fn.Name(), err)
+		}
+		if f.startsWith(decl.Body, stmts, fset) {
+			continue
+		}
+		offset := f.offset(decl.Body.Lbrace) + 1
+		text := "\n" + strings.TrimSpace(prologue)
+		if offset < len(f.Src) && f.Src[offset] != '\n' {
+			text += "\n"
+		}
+		edits = append(edits, textEdit{start: offset, end: offset, text: text})
+	}
+	if len(edits) == 0 {
+		return 0, nil
+	}
+	if err = f.applyEdits(edits); err != nil {
+		return 0, err
+	}
+	paths := make([]string, 0, len(cfg.Imports))
+	for path := range cfg.Imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err = f.AddImport(cfg.Imports[path], path); err != nil {
+			return len(edits), err
+		}
+	}
+	return len(edits), f.refresh()
+}
+
+// instrumentData returns the prologue template data of the function.
+func (f *File) instrumentData(fn FuncNode) *InstrumentData {
+	d := &InstrumentData{Package: f.PkgName, Func: fn.Name(), Name: fn.Name()}
+	if recv, ok := fn.Recv(); ok {
+		d.Recv = baseTypeName(recv.TypeName)
+		d.Name = d.Recv + "." + fn.Name()
+	}
+	for i := 0; i < fn.NumParam(); i++ {
+		p, _ := fn.Param(i)
+		if p.Name != "" && p.Name != "_" {
+			d.Params = append(d.Params, p)
+		}
+	}
+	return d
+}
+
+// startsWith reports whether the block starts with the statements,
+// parsed into fset.
+func (f *File) startsWith(block *ast.BlockStmt, stmts []ast.Stmt, fset *token.FileSet) bool {
+	if len(stmts) == 0 || len(block.List) < len(stmts) {
+		return false
+	}
+	for i, s := range stmts {
+		var a, b bytes.Buffer
+		if format.Node(&a, fset, s) != nil || format.Node(&b, f.FileSet, block.List[i]) != nil {
+			return false
+		}
+		if a.String() != b.String() {
+			return false
+		}
+	}
+	return true
+}
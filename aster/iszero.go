@@ -0,0 +1,126 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// GenerateIsZero generates the IsZero method of the struct type Foo, which
+// reports whether all the fields are zero, and the ZeroFoo function
+// returning the zero value of it.
+//
+// The fields are checked by the resolved kinds of their types: the pointers
+// are zero if nil, however the values they point to, the fields of a struct
+// type of the package are checked one by one, unless the type has its own
+// IsZero method, e.g. time.Time, and the others, e.g. arrays, are checked by
+// reflect.Value.IsZero.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateIsZero() error {
+	const method = "IsZero"
+	name := s.Name()
+	if name == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", name)
+	}
+	if _, found := s.MethodByName(method); found {
+		return fmt.Errorf("aster: method already exists: %s.%s", name, method)
+	}
+	zero := "Zero" + name
+	if err := s.file.CheckCollision(zero); err != nil {
+		return err
+	}
+	recv := receiverName(s)
+	imports := map[string]bool{}
+	checks := s.zeroChecks(recv, map[*StructType]bool{s: true}, imports)
+	if len(checks) == 0 {
+		checks = []string{"true"}
+	}
+	src := fmt.Sprintf("// %s reports whether all the fields of %s are zero.\nfunc (%s %s) %s() bool {\n\treturn %s\n}\n\n"+
+		"// %s returns the zero value of %s.\nfunc %s() %s {\n\treturn %s{}\n}",
+		method, recv, recv, name, method, strings.Join(checks, " &&\n\t\t"),
+		zero, name, zero, name, name)
+	if err := s.file.appendDecl(name, src); err != nil {
+		return err
+	}
+	if imports["reflect"] {
+		return s.file.AddImport("", "reflect")
+	}
+	return nil
+}
+
+// zeroChecks returns the expressions reporting whether the fields of x, of
+// the struct type, are zero, inlining the checks of the nested struct types
+// not in seen.
+func (s *StructType) zeroChecks(x string, seen map[*StructType]bool, imports map[string]bool) []string {
+	var checks []string
+	for _, field := range s.fields {
+		fname := field.Name()
+		if fname == "" || fname == "_" {
+			continue
+		}
+		checks = append(checks, field.zeroChecks(x+"."+fname, seen, imports)...)
+	}
+	return checks
+}
+
+// zeroChecks returns the expressions reporting whether x, of the field type,
+// is zero, see StructType.GenerateIsZero.
+func (s *StructField) zeroChecks(x string, seen map[*StructType]bool, imports map[string]bool) []string {
+	if s.file.isDurationType(s.Field.Type) {
+		return []string{x + " == 0"}
+	}
+	switch t := genericBase(s.Field.Type).(type) {
+	case *ast.Ident:
+		if n, found := s.file.LookupTypeInPkg(t.Name); found {
+			if m, found := n.MethodByName("IsZero"); found && m.NumParam() == 0 && m.NumResult() == 1 {
+				return []string{x + ".IsZero()"}
+			}
+			if r, ok := n.ResolveNamed(); ok {
+				if st, ok := r.(*StructType); ok && !seen[st] && st.TypeParams() == nil {
+					seen[st] = true
+					defer delete(seen, st)
+					return st.zeroChecks(x, seen, imports)
+				}
+			}
+		}
+	case *ast.SelectorExpr:
+		if obj, err := s.file.LookupExternalType(s.file.TryFormatNode(t)); err == nil {
+			if m, _, _ := types.LookupFieldOrMethod(obj.Type(), false, obj.Pkg(), "IsZero"); m != nil {
+				if sig, ok := m.Type().(*types.Signature); ok && sig.Params().Len() == 0 && sig.Results().Len() == 1 {
+					return []string{x + ".IsZero()"}
+				}
+			}
+		}
+	}
+	kind := s.underlyingKind()
+	switch {
+	case kind == Bool:
+		return []string{"!" + x}
+	case kind == String:
+		return []string{x + ` == ""`}
+	case kind >= Int && kind <= Complex128:
+		return []string{x + " == 0"}
+	case kind == Ptr, kind == Slice, kind == Map, kind == Chan, kind == Func, kind == Interface:
+		return []string{x + " == nil"}
+	}
+	imports["reflect"] = true
+	return []string{"reflect.ValueOf(" + x + ").IsZero()"}
+}
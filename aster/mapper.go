@@ -0,0 +1,247 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// MapperConfig configures GenerateMapper.
+type MapperConfig struct {
+	// FuncName is the name of the conversion function,
+	// defaults to "<From>To<To>", e.g. UserToUserDTO.
+	FuncName string
+	// TagKey matches the fields by the name of the tag, e.g. "json",
+	// before matching them by the field name.
+	TagKey string
+	// Overrides maps the target field names to the Go expressions of their
+	// values, in which `in` is the source pointer, e.g.
+	//  {"FullName": `in.First + " " + in.Last`}
+	// An empty expression leaves the target field unset.
+	Overrides map[string]string
+}
+
+// GenerateMapper generates the function converting the from struct to the to
+// struct, after the declaration of the to struct:
+//  func UserToUserDTO(in *User) *UserDTO
+// The fields of to are mapped from the fields of from with the same tag name
+// or field name, unless overridden, with the pointers and slices wrapped or
+// unwrapped as the types require. The fields of other struct types are
+// converted by the existing conversion functions named as above,
+// and the numeric and string types by type conversions.
+// The target fields having no source field are listed in the function doc.
+//
+// Both structs must be named and declared in the same package.
+// Returns an error if a matched field can not be converted.
+// NOTE: The file is reparsed after inserting.
+func GenerateMapper(from, to TypeNode, cfg *MapperConfig) error {
+	if from.Kind() != Struct || to.Kind() != Struct || from.Name() == "" || to.Name() == "" {
+		return fmt.Errorf("aster: not named structs: %s, %s", from.Name(), to.Name())
+	}
+	if from.PkgName() != to.PkgName() {
+		return fmt.Errorf("aster: structs not declared in the same package: %s.%s, %s.%s",
+			from.PkgName(), from.Name(), to.PkgName(), to.Name())
+	}
+	var c MapperConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.FuncName == "" {
+		c.FuncName = mapperName(from.Name(), to.Name())
+	}
+	file := to.(*StructType).file
+	if err := file.CheckCollision(c.FuncName); err != nil {
+		return err
+	}
+
+	g := &mapperGen{file: file}
+	var body bytes.Buffer
+	var unmapped []string
+	for i := 0; i < to.NumField(); i++ {
+		tf := to.Field(i)
+		name := tf.Name()
+		if expr, ok := c.Overrides[name]; ok {
+			if expr != "" {
+				fmt.Fprintf(&body, "\tout.%s = %s\n", name, expr)
+			}
+			continue
+		}
+		sf, ok := matchField(from, tf, c.TagKey)
+		if !ok {
+			unmapped = append(unmapped, name)
+			continue
+		}
+		code, ok := g.assign("out."+name, "in."+sf.Name(), sf.Field.Type, tf.Field.Type, 1)
+		if !ok {
+			return fmt.Errorf("aster: can not map %s.%s (%s) to %s.%s (%s)",
+				from.Name(), sf.Name(), sf.TypeName(), to.Name(), name, tf.TypeName())
+		}
+		body.WriteString(code)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// %s converts %s to %s.\n", c.FuncName, from.Name(), to.Name())
+	if len(unmapped) > 0 {
+		fmt.Fprintf(&src, "// The fields not mapped: %s.\n", strings.Join(unmapped, ", "))
+	}
+	fmt.Fprintf(&src, "func %s(in *%s) *%s {\n\tif in == nil {\n\t\treturn nil\n\t}\n\tout := new(%s)\n%s\treturn out\n}",
+		c.FuncName, from.Name(), to.Name(), to.Name(), body.String())
+	return file.appendDecl(to.Name(), src.String())
+}
+
+// mapperName returns the default name of the function converting from to to.
+func mapperName(from, to string) string {
+	return upperFirst(from) + "To" + upperFirst(to)
+}
+
+// matchField returns the field of the struct matching the target field,
+// by the tag name if tagKey is not empty, then by the field name.
+func matchField(s TypeNode, target *StructField, tagKey string) (*StructField, bool) {
+	if tagKey != "" {
+		if tag, err := target.Tags.Get(tagKey); err == nil && tag.Name != "" && tag.Name != "-" {
+			for i := 0; i < s.NumField(); i++ {
+				f := s.Field(i)
+				if t, err := f.Tags.Get(tagKey); err == nil && t.Name == tag.Name {
+					return f, true
+				}
+			}
+		}
+	}
+	return s.FieldByName(target.Name())
+}
+
+type mapperGen struct {
+	file *File
+}
+
+// assign returns the statements assigning src of the type ft to dst of the type tt,
+// indented by depth tabs.
+func (g *mapperGen) assign(dst, src string, ft, tt ast.Expr, depth int) (string, bool) {
+	indent := strings.Repeat("\t", depth)
+	ftName, ttName := g.file.TryFormatNode(ft), g.file.TryFormatNode(tt)
+	if ftName == ttName {
+		return fmt.Sprintf("%s%s = %s\n", indent, dst, src), true
+	}
+	fp, fIsPtr := ft.(*ast.StarExpr)
+	tp, tIsPtr := tt.(*ast.StarExpr)
+	switch {
+	case fIsPtr && tIsPtr:
+		if fn, ok := g.structMapper(fp.X, tp.X); ok {
+			return fmt.Sprintf("%s%s = %s(%s)\n", indent, dst, fn, src), true
+		}
+		v := fmt.Sprintf("v%d", depth)
+		code, ok := g.assign(v, "*"+src, fp.X, tp.X, depth+1)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%sif %s != nil {\n%s\tvar %s %s\n%s%s\t%s = &%s\n%s}\n",
+			indent, src, indent, v, g.file.TryFormatNode(tp.X), code, indent, dst, v, indent), true
+	case tIsPtr:
+		if fn, ok := g.structMapper(ft, tp.X); ok {
+			return fmt.Sprintf("%s%s = %s(%s)\n", indent, dst, fn, addr(src)), true
+		}
+		v := fmt.Sprintf("v%d", depth)
+		code, ok := g.assign(v, src, ft, tp.X, depth+1)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%s{\n%s\tvar %s %s\n%s%s\t%s = &%s\n%s}\n",
+			indent, indent, v, g.file.TryFormatNode(tp.X), code, indent, dst, v, indent), true
+	case fIsPtr:
+		code, ok := g.assign(dst, "*"+src, fp.X, tt, depth+1)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%sif %s != nil {\n%s%s}\n", indent, src, code, indent), true
+	}
+
+	fa, fIsSlice := ft.(*ast.ArrayType)
+	ta, tIsSlice := tt.(*ast.ArrayType)
+	if fIsSlice && tIsSlice && fa.Len == nil && ta.Len == nil {
+		i := fmt.Sprintf("i%d", depth)
+		elem := src + "[" + i + "]"
+		if strings.HasPrefix(src, "*") {
+			// indexes the dereferenced slice, e.g. (*x)[i]
+			elem = "(" + src + ")[" + i + "]"
+		}
+		code, ok := g.assign(dst+"["+i+"]", elem, fa.Elt, ta.Elt, depth+2)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%sif %s != nil {\n%s\t%s = make(%s, len(%s))\n%s\tfor %s := range %s {\n%s%s\t}\n%s}\n",
+			indent, src, indent, dst, ttName, src, indent, i, src, code, indent, indent), true
+	}
+
+	if fn, ok := g.structMapper(ft, tt); ok {
+		return fmt.Sprintf("%sif v := %s(%s); v != nil {\n%s\t%s = *v\n%s}\n",
+			indent, fn, addr(src), indent, dst, indent), true
+	}
+	if g.convertible(ft, tt) {
+		return fmt.Sprintf("%s%s = %s(%s)\n", indent, dst, ttName, src), true
+	}
+	return "", false
+}
+
+// addr returns the address expression of src,
+// e.g. x for *x, and &(*x)[i] for (*x)[i].
+func addr(src string) string {
+	if strings.HasPrefix(src, "*") {
+		return src[1:]
+	}
+	return "&" + src
+}
+
+// structMapper returns the name of the existing function converting
+// the struct type ft to tt.
+func (g *mapperGen) structMapper(ft, tt ast.Expr) (string, bool) {
+	f, ok1 := ft.(*ast.Ident)
+	t, ok2 := tt.(*ast.Ident)
+	if !ok1 || !ok2 {
+		return "", false
+	}
+	name := mapperName(f.Name, t.Name)
+	if _, found := g.file.lookupFunc(name); found {
+		return name, true
+	}
+	return "", false
+}
+
+// convertible reports whether a value of the type ft can be converted to tt,
+// i.e. both are numeric or both are string types.
+func (g *mapperGen) convertible(ft, tt ast.Expr) bool {
+	fk, tk := g.file.exprKind(ft), g.file.exprKind(tt)
+	numeric := func(k Kind) bool { return k >= Int && k <= Float64 }
+	return numeric(fk) && numeric(tk) || fk == String && tk == String
+}
+
+// lookupFunc returns the top-level function of the name in the package.
+func (f *File) lookupFunc(name string) (FuncNode, bool) {
+	files := []*File{f}
+	if p, ok := f.Package(); ok {
+		files = files[:0]
+		for _, pf := range p.Files {
+			files = append(files, pf)
+		}
+	}
+	for _, pf := range files {
+		if n, found := pf.lookupTopNode(name, Func, ""); found {
+			return n.(FuncNode), true
+		}
+	}
+	return nil, false
+}
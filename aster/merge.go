@@ -0,0 +1,475 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AddFile adds the file of the source to the package directory, or replaces
+// the file of the same name, so that it is written by Package.Store.
+// The package clause of the source is optional, see File.Merge.
+func (p *Package) AddFile(basename string, src []byte) (*File, error) {
+	file, _, src, err := parseFragment(p.Name, src)
+	if err != nil {
+		return nil, err
+	}
+	if file.Name.Name != p.Name {
+		return nil, fmt.Errorf("aster: package %s, not %s", file.Name.Name, p.Name)
+	}
+	filename := filepath.Join(p.Dir, basename)
+	old := p.Files[filename]
+	nf := &File{
+		FileSet:  p.FileSet,
+		Filename: filename,
+		Src:      src,
+		mode:     p.mode,
+		pkg:      p,
+	}
+	p.Files[filename] = nf
+	if err = nf.Reparse(); err != nil {
+		if old != nil {
+			p.Files[filename] = old
+		} else {
+			delete(p.Files, filename)
+		}
+		p.collectNodes()
+		return nil, err
+	}
+	for i, name := range p.removed {
+		if name == filename {
+			p.removed = append(p.removed[:i], p.removed[i+1:]...)
+			break
+		}
+	}
+	return nf, nil
+}
+
+// RemoveFile removes the file of the name from the package, which is deleted
+// from the disk by Package.Store or Module.Store.
+// Returns false if the package has no such file.
+func (p *Package) RemoveFile(filename string) bool {
+	if _, ok := p.Files[filename]; !ok {
+		return false
+	}
+	delete(p.Files, filename)
+	p.removed = append(p.removed, filename)
+	p.collectNodes()
+	return true
+}
+
+// MergeFiles merges the files of the package into the file of the name in the
+// package directory, which replaces them: the package docs and the
+// declarations are concatenated in the order of the file names, along with
+// the comments between them, and the imports are deduplicated.
+// The originals are removed from the package, and deleted by Store.
+// Only the test files are merged into a _test.go file, and only the others
+// otherwise.
+// Returns an error if a file has build constraints or imports "C",
+// or if two files import different paths under the same name.
+func (p *Package) MergeFiles(targetFilename string) (*File, error) {
+	target := filepath.Base(targetFilename)
+	isTest := strings.HasSuffix(target, "_test.go")
+	var (
+		files   []*File
+		docs    []string
+		imports []string
+		byName  = make(map[string]string)
+		decls   bytes.Buffer
+	)
+	for _, f := range p.sortedFiles() {
+		if strings.HasSuffix(f.Filename, "_test.go") != isTest {
+			continue
+		}
+		if err := f.refresh(); err != nil {
+			return nil, err
+		}
+		if len(buildConstraints(f)) > 0 {
+			return nil, fmt.Errorf("aster: can not merge the file with build constraints: %s", f.Filename)
+		}
+		if f.File.Doc != nil {
+			docs = append(docs, string(f.Src[f.offset(f.File.Doc.Pos()):f.offset(f.File.Doc.End())]))
+		}
+		start := f.offset(f.File.Name.End())
+		for _, decl := range f.File.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+				start = f.offset(d.End())
+			}
+		}
+		for _, imp := range f.Imports {
+			if imp.Path == "C" {
+				return nil, fmt.Errorf("aster: can not merge the cgo file: %s", f.Filename)
+			}
+			spec := importSpec(imp)
+			if imp.Name == "_" || imp.Name == "." {
+				if !containsString(imports, spec) {
+					imports = append(imports, spec)
+				}
+				continue
+			}
+			if path, ok := byName[imp.Name]; ok {
+				if path != imp.Path {
+					return nil, fmt.Errorf("aster: import name conflict: %s for %q and %q", imp.Name, path, imp.Path)
+				}
+				continue
+			}
+			byName[imp.Name] = imp.Path
+			imports = append(imports, spec)
+		}
+		decls.WriteString("\n")
+		decls.Write(bytes.TrimSpace(f.Src[start:]))
+		decls.WriteString("\n")
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("aster: no files to merge in package %s", p.Name)
+	}
+	var src bytes.Buffer
+	if len(docs) > 0 {
+		src.WriteString(strings.Join(docs, "\n//\n") + "\n")
+	}
+	fmt.Fprintf(&src, "package %s\n", files[0].PkgName)
+	if len(imports) > 0 {
+		fmt.Fprintf(&src, "\nimport (\n\t%s\n)\n", strings.Join(imports, "\n\t"))
+	}
+	src.Write(decls.Bytes())
+
+	nf, err := p.AddFile(target, src.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Filename != nf.Filename {
+			p.RemoveFile(f.Filename)
+		}
+	}
+	return nf, nil
+}
+
+// Merge merges the declarations of the source into the file:
+// the declarations replace the top-level declarations of the file with the
+// same names, methods matched by receiver type, and the others are appended.
+// The imports of the source are added, then the imports are fixed,
+// see FixImports. The package clause of the source is optional.
+// Returns an error if a name of the source is declared in another file
+// of the package, or together with a name not in the source, e.g. `A, B = 1, 2`.
+// NOTE: The file is reparsed after merging.
+func (f *File) Merge(src []byte) error {
+	file, fset, src, err := parseFragment(f.PkgName, src)
+	if err != nil {
+		return err
+	}
+	if file.Name.Name != f.PkgName {
+		return fmt.Errorf("aster: package %s, not %s", file.Name.Name, f.PkgName)
+	}
+	for _, imp := range file.Imports {
+		var name string
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if err = f.AddImport(name, path); err != nil {
+			return err
+		}
+	}
+	if err = f.refresh(); err != nil {
+		return err
+	}
+	var (
+		edits    []textEdit
+		appended []string
+		merged   = make(map[ast.Decl]bool)
+	)
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			continue
+		}
+		text := string(src[fset.Position(declStart(decl)).Offset:fset.Position(decl.End()).Offset])
+		olds, err := f.declsToMerge(decl)
+		if err != nil {
+			return err
+		}
+		if len(olds) == 0 {
+			appended = append(appended, text)
+			continue
+		}
+		for i, old := range olds {
+			if merged[old] {
+				return fmt.Errorf("aster: duplicate declaration: %s", strings.Join(declKeys(decl), ", "))
+			}
+			merged[old] = true
+			if i == 0 {
+				edits = append(edits, textEdit{start: f.offset(declStart(old)), end: f.offset(old.End()), text: text})
+				continue
+			}
+			start, end := f.lineRange(f.offset(declStart(old)), f.offset(old.End()))
+			edits = append(edits, textEdit{start: start, end: end})
+		}
+	}
+	if len(appended) > 0 {
+		edits = append(edits, textEdit{start: len(f.Src), end: len(f.Src), text: "\n" + strings.Join(appended, "\n\n") + "\n"})
+	}
+	if err = f.applyEdits(edits); err != nil {
+		return err
+	}
+	return f.FixImports()
+}
+
+// parseFragment parses the source of a file, whose package clause is optional,
+// and returns the source with the package clause.
+func parseFragment(pkgName string, src []byte) (*ast.File, *token.FileSet, []byte, error) {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly); err != nil {
+		src = append([]byte("package "+pkgName+"\n\n"), src...)
+	}
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	return file, fset, src, err
+}
+
+// declStart returns the start position of the declaration, including its doc.
+func declStart(decl ast.Decl) token.Pos {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
+
+// declKeys returns the names declared by the top-level declaration,
+// as "<receiver type>.<name>" for methods, except the blank and init ones.
+func declKeys(decl ast.Decl) []string {
+	var keys []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			if recv, ok := recvBaseIdent(d.Recv.List[0].Type); ok {
+				keys = append(keys, recv.Name+"."+d.Name.Name)
+			}
+		} else if d.Name.Name != "init" && d.Name.Name != "_" {
+			keys = append(keys, d.Name.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				keys = append(keys, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, id := range s.Names {
+					if id.Name != "_" {
+						keys = append(keys, id.Name)
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// recvBaseIdent returns the type name of the receiver type expression,
+// e.g. T for *T or T[K].
+func recvBaseIdent(x ast.Expr) (*ast.Ident, bool) {
+	id, ok := genericBase(getElem(x)).(*ast.Ident)
+	return id, ok
+}
+
+// declsToMerge returns the top-level declarations of the file replaced by
+// the declaration, whose names must all be declared by it.
+func (f *File) declsToMerge(decl ast.Decl) ([]ast.Decl, error) {
+	keys := declKeys(decl)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	var olds []ast.Decl
+	for _, pf := range f.packageFiles() {
+		for _, old := range pf.File.Decls {
+			if d, ok := old.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+				continue
+			}
+			oldKeys := declKeys(old)
+			if !intersects(keys, oldKeys) {
+				continue
+			}
+			if pf != f {
+				return nil, fmt.Errorf("aster: %s is declared in %s", strings.Join(oldKeys, ", "), pf.Filename)
+			}
+			for _, key := range oldKeys {
+				if !containsString(keys, key) {
+					return nil, fmt.Errorf("aster: can not merge %s: declared together with %s", strings.Join(keys, ", "), key)
+				}
+			}
+			olds = append(olds, old)
+		}
+	}
+	return olds, nil
+}
+
+func intersects(a, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// FixImports adds the imports missing from the file, imported by the other
+// files of the package under the same names, or else the standard library
+// packages of the names if unique, e.g. fmt but not rand, and removes the unused
+// imports, except the blank and dot imports, and those whose names can not
+// be told from the paths, e.g. gopkg.in/yaml.v2.
+// NOTE: The file is reparsed after fixing.
+func (f *File) FixImports() error {
+	used := make(map[string]bool)
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	// adds the missing ones
+	for name := range used {
+		if _, found := f.LookupImports(name); found {
+			continue
+		}
+		var spec, path string
+		for _, pf := range f.packageFiles() {
+			if imps, found := pf.LookupImports(name); found {
+				spec, path = importSpecName(imps[0]), imps[0].Path
+				break
+			}
+		}
+		if path == "" {
+			path = stdPackages()[name]
+		}
+		if path == "" {
+			continue
+		}
+		if err := f.AddImport(spec, path); err != nil {
+			return err
+		}
+	}
+	// removes the unused ones
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	var edits []textEdit
+	for _, decl := range f.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		var unused []ast.Node
+		for _, spec := range d.Specs {
+			s := spec.(*ast.ImportSpec)
+			path, _ := strconv.Unquote(s.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if s.Name != nil {
+				name = s.Name.Name
+			} else if !token.IsIdentifier(name) || isVersionElem(name) {
+				continue
+			}
+			if name != "_" && name != "." && !used[name] {
+				unused = append(unused, s)
+			}
+		}
+		if len(unused) == len(d.Specs) && len(unused) > 0 {
+			unused = []ast.Node{d}
+		}
+		for _, s := range unused {
+			start, end := f.lineRange(f.offset(s.Pos()), f.offset(s.End()))
+			edits = append(edits, textEdit{start: start, end: end})
+		}
+	}
+	return f.applyEdits(edits)
+}
+
+var (
+	stdOnce sync.Once
+	stdPkgs map[string]string
+)
+
+// stdPackages returns the import paths of the standard library packages
+// by their names, except the ambiguous ones, e.g. rand, and the internal ones.
+func stdPackages() map[string]string {
+	stdOnce.Do(func() {
+		paths := make(map[string][]string)
+		root := filepath.Join(build.Default.GOROOT, "src")
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if path != root && (name == "internal" || name == "vendor" || name == "testdata" ||
+					name == "cmd" && filepath.Dir(path) == root) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				dir, _ := filepath.Rel(root, filepath.Dir(path))
+				dir = filepath.ToSlash(dir)
+				pkg := dir[strings.LastIndex(dir, "/")+1:]
+				if dir != "." && !isVersionElem(pkg) && !containsString(paths[pkg], dir) {
+					paths[pkg] = append(paths[pkg], dir)
+				}
+			}
+			return nil
+		})
+		stdPkgs = make(map[string]string, len(paths))
+		for name, dirs := range paths {
+			if len(dirs) == 1 {
+				stdPkgs[name] = dirs[0]
+			}
+		}
+	})
+	return stdPkgs
+}
+
+// importSpecName returns the explicit name of the import, or "".
+func importSpecName(imp *Import) string {
+	if imp.ImportSpec.Name != nil {
+		return imp.ImportSpec.Name.Name
+	}
+	return ""
+}
+
+// isVersionElem reports whether the last element of an import path
+// is a major version, e.g. v2, which is not the package name.
+func isVersionElem(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+// Methods returns the methods in the type's method set, in the order of
+// Method, leaving out the unexported ones unless includeUnexported is true.
+// If promoted is true, the method set includes the methods promoted
+// from the embedded types.
+func (s *superType) Methods(includeUnexported bool, promoted ...bool) []FuncNode {
+	var methods []FuncNode
+	for _, m := range s.methodSet(promoted) {
+		if includeUnexported || IsExported(m.Name()) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// methodSet returns the declared methods, followed by the promoted methods
+// if promoted is true.
+func (s *superType) methodSet(promoted []bool) []FuncNode {
+	if len(promoted) == 0 || !promoted[0] || s.promoted == nil {
+		return s.methods
+	}
+	return append(s.methods[:len(s.methods):len(s.methods)], s.promoted()...)
+}
+
+// promotedMethods returns the methods promoted from the embedded types,
+// level by level: a name declared at a shallower depth hides the deeper ones,
+// and a name declared more than once at the same depth is ambiguous and left out.
+func (s *StructType) promotedMethods() []FuncNode {
+	var promoted []FuncNode
+	var hidden = make(map[string]bool)
+	for _, m := range s.methods {
+		hidden[m.Name()] = true
+	}
+	var visited = map[TypeNode]bool{s: true}
+	level := s.embeddedTypes()
+	for len(level) > 0 {
+		var names []string
+		var candidates = make(map[string][]FuncNode)
+		var next []TypeNode
+		for _, t := range level {
+			if visited[t] {
+				continue
+			}
+			// methods of interfaces include their embedded ones
+			full := t.Kind() == Interface
+			for i := 0; i < t.NumMethod(full); i++ {
+				m, _ := t.Method(i, full)
+				if hidden[m.Name()] {
+					continue
+				}
+				if _, ok := candidates[m.Name()]; !ok {
+					names = append(names, m.Name())
+				}
+				candidates[m.Name()] = append(candidates[m.Name()], m)
+			}
+			if st, ok := t.(*StructType); ok {
+				next = append(next, st.embeddedTypes()...)
+			}
+		}
+		for _, t := range level {
+			visited[t] = true
+		}
+		for _, name := range names {
+			hidden[name] = true
+			if ms := candidates[name]; len(ms) == 1 {
+				promoted = append(promoted, ms[0])
+			}
+		}
+		level = next
+	}
+	return promoted
+}
+
+func (s *StructType) embeddedTypes() []TypeNode {
+	var types []TypeNode
+	for _, field := range s.fields {
+		if t, ok := field.embeddedType(); ok {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// promotedMethods returns the methods of the embedded interfaces,
+// in declaration order, which are not declared by the interface.
+func (i *InterfaceType) promotedMethods() []FuncNode {
+	return i.embeddedMethods(map[*InterfaceType]bool{i: true})
+}
+
+func (i *InterfaceType) embeddedMethods(visiting map[*InterfaceType]bool) []FuncNode {
+	if i.InterfaceType.Methods == nil {
+		return nil
+	}
+	var methods []FuncNode
+	var names = make(map[string]bool)
+	for _, m := range i.methods {
+		names[m.Name()] = true
+	}
+	for _, field := range i.InterfaceType.Methods.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		t, ok := i.file.lookupEmbedded(field.Type)
+		if !ok {
+			continue
+		}
+		e, ok := t.(*InterfaceType)
+		if !ok || visiting[e] {
+			continue
+		}
+		visiting[e] = true
+		for _, m := range append(e.methods[:len(e.methods):len(e.methods)], e.embeddedMethods(visiting)...) {
+			if !names[m.Name()] {
+				names[m.Name()] = true
+				methods = append(methods, m)
+			}
+		}
+		delete(visiting, e)
+	}
+	return methods
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// FuncMetrics is the complexity and size of a function.
+type FuncMetrics struct {
+	// Complexity is the cyclomatic complexity: one plus the number of
+	// if, for and range statements, non-default case and select clauses,
+	// and && and || operators.
+	Complexity int
+	// Statements is the number of statements, not counting the blocks,
+	// the case and select clauses, the labels and the empty statements.
+	Statements int
+	// Nesting is the maximum depth of the nested if, for, range, switch,
+	// select statements and function literals in the body.
+	Nesting int
+	// Lines is the number of lines from the func keyword to the closing brace.
+	Lines int
+}
+
+// Metrics returns the complexity and size metrics of the function,
+// including the function literals in its body.
+func (f *FuncDecl) Metrics() *FuncMetrics {
+	m := &FuncMetrics{Complexity: 1}
+	fset := f.file.FileSet
+	m.Lines = fset.Position(f.node.End()).Line - fset.Position(f.node.Pos()).Line + 1
+	var body *ast.BlockStmt
+	switch x := f.node.(type) {
+	case *ast.FuncDecl:
+		body = x.Body
+	case *ast.FuncLit:
+		body = x.Body
+	}
+	if body == nil {
+		return m
+	}
+	// the depths of the nodes on the path being walked
+	var path []ast.Node
+	var depths []int
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			path, depths = path[:len(path)-1], depths[:len(depths)-1]
+			return true
+		}
+		var parent ast.Node
+		var depth int
+		if len(path) > 0 {
+			parent, depth = path[len(path)-1], depths[len(depths)-1]
+		}
+		switch x := n.(type) {
+		case *ast.IfStmt:
+			m.Complexity++
+			if p, ok := parent.(*ast.IfStmt); !ok || p.Else != x {
+				depth++ // not an else-if
+			}
+		case *ast.ForStmt, *ast.RangeStmt:
+			m.Complexity++
+			depth++
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+			depth++
+		case *ast.CaseClause:
+			if x.List != nil {
+				m.Complexity++
+			}
+		case *ast.CommClause:
+			if x.Comm != nil {
+				m.Complexity++
+			}
+		case *ast.BinaryExpr:
+			if x.Op == token.LAND || x.Op == token.LOR {
+				m.Complexity++
+			}
+		}
+		switch n.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause, *ast.LabeledStmt, *ast.EmptyStmt:
+		case ast.Stmt:
+			if n != body {
+				m.Statements++
+			}
+		}
+		if depth > m.Nesting {
+			m.Nesting = depth
+		}
+		path, depths = append(path, n), append(depths, depth)
+		return true
+	})
+	return m
+}
+
+// PackageMetrics is the aggregation of the metrics of the functions
+// in a package.
+type PackageMetrics struct {
+	NumFunc int
+	// Total is the sum of each metric of the functions.
+	Total FuncMetrics
+	// Max is the maximum of each metric of the functions.
+	Max FuncMetrics
+}
+
+// AvgComplexity returns the average cyclomatic complexity of the functions.
+func (p *PackageMetrics) AvgComplexity() float64 {
+	if p.NumFunc == 0 {
+		return 0
+	}
+	return float64(p.Total.Complexity) / float64(p.NumFunc)
+}
+
+// Metrics aggregates the metrics of the functions and methods of the package,
+// including the function literals assigned to the package-level variables.
+// The function literals nested in other functions are counted in those.
+func (p *Package) Metrics() *PackageMetrics {
+	pm := new(PackageMetrics)
+	for _, f := range p.sortedFiles() {
+		for _, fn := range f.Funcs() {
+			if outer := f.enclosingFunc(fn.Node().Pos() - 1); outer != nil && outer.Node().End() >= fn.Node().End() {
+				continue
+			}
+			m := fn.Metrics()
+			pm.NumFunc++
+			pm.Total.Complexity += m.Complexity
+			pm.Total.Statements += m.Statements
+			pm.Total.Nesting += m.Nesting
+			pm.Total.Lines += m.Lines
+			pm.Max.Complexity = maxInt(pm.Max.Complexity, m.Complexity)
+			pm.Max.Statements = maxInt(pm.Max.Statements, m.Statements)
+			pm.Max.Nesting = maxInt(pm.Max.Nesting, m.Nesting)
+			pm.Max.Lines = maxInt(pm.Max.Lines, m.Lines)
+		}
+	}
+	return pm
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+)
+
+// formatMinimal returns the source of the file with only the top-level
+// declarations changed since it was parsed re-rendered, and the rest of
+// the source byte-identical, or false if the declarations were added,
+// removed or moved, which requires formatting the whole file.
+func (f *File) formatMinimal() (string, bool, error) {
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, f.Filename, f.Src, f.mode|parser.ParseComments)
+	if err != nil || orig.Name.Name != f.File.Name.Name || len(orig.Decls) != len(f.File.Decls) {
+		return "", false, nil
+	}
+	tf := f.FileSet.File(f.File.Package)
+	var edits []textEdit
+	for i, decl := range f.File.Decls {
+		old := orig.Decls[i]
+		start := declStart(decl)
+		if !start.IsValid() || f.FileSet.File(start) != tf ||
+			tf.Offset(start) != fset.Position(declStart(old)).Offset {
+			return "", false, nil
+		}
+		text, err := renderDecl(f.FileSet, f.File, decl)
+		if err != nil {
+			return "", false, err
+		}
+		oldText, err := renderDecl(fset, orig, old)
+		if err != nil {
+			return "", false, err
+		}
+		if text != oldText {
+			edits = append(edits, textEdit{
+				start: fset.Position(declStart(old)).Offset,
+				end:   fset.Position(old.End()).Offset,
+				text:  text,
+			})
+		}
+	}
+	var b bytes.Buffer
+	var last int
+	for _, e := range edits {
+		b.Write(f.Src[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(f.Src[last:])
+	return b.String(), true, nil
+}
+
+// renderDecl formats the top-level declaration of the file,
+// along with its doc and the comments inside it.
+func renderDecl(fset *token.FileSet, file *ast.File, decl ast.Decl) (string, error) {
+	start, end := declStart(decl), decl.End()
+	var comments []*ast.CommentGroup
+	for _, c := range file.Comments {
+		if c.Pos() >= start && c.End() <= end {
+			comments = append(comments, c)
+		}
+	}
+	var buf bytes.Buffer
+	err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments})
+	return buf.String(), err
+}
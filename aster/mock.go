@@ -0,0 +1,137 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"github.com/henrylee2cn/goutil"
+)
+
+// GenerateMock generates the mock implementation of the interface,
+// into the `<snake_name>_mock.go` file beside the interface declaration.
+// If the interface belongs to a package, the file is added to (or replaced
+// in) the package, so that it is written by Package.Store, and recorded
+// in the provenance manifest of the module, see Module.RecordGenerated.
+//
+// For the interface Reader, the mock type MockReader has, for each method Read:
+//  ReadFunc    func(...) (...)  // if not nil, is called by Read
+//  ReadReturns struct{...}      // returned by Read if ReadFunc is nil
+//  ReadCalls   []struct{...}    // the recorded arguments of the calls
+func GenerateMock(iface TypeNode) (*File, error) {
+	if iface.Kind() != Interface || iface.Name() == "" {
+		return nil, fmt.Errorf("aster: not a named interface: %s", iface.Name())
+	}
+	file := iface.(*InterfaceType).file
+	mock := "Mock" + iface.Name()
+
+	var fields, methods bytes.Buffer
+	var imports = map[string]bool{"sync": true}
+	var importSpecs []string
+	for i := 0; i < iface.NumMethod(true); i++ {
+		// the embedded interface methods may be declared in other files
+		m, _ := iface.Method(i, true)
+		ft, mf := funcTypeOf(m)
+		for _, imp := range mf.importsOf(ft) {
+			if !imports[imp.Path] {
+				imports[imp.Path] = true
+				importSpecs = append(importSpecs, importSpec(imp))
+			}
+		}
+		writeMockMethod(&fields, &methods, mf, mock, iface.Name(), m, ft)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "%s\n\npackage %s\n\nimport (\n\t\"sync\"\n", GeneratedBanner("aster"), iface.PkgName())
+	for _, spec := range importSpecs {
+		fmt.Fprintf(&src, "\t%s\n", spec)
+	}
+	fmt.Fprintf(&src, ")\n\n// %s is a mock implementation of %s.\ntype %s struct {\n\tmu sync.Mutex\n%s}\n\nvar _ %s = (*%s)(nil)\n%s",
+		mock, iface.Name(), mock, fields.String(), iface.Name(), mock, methods.String())
+
+	f, err := file.newSibling(goutil.SnakeString(iface.Name())+"_mock.go", src.Bytes())
+	if err != nil {
+		return f, err
+	}
+	return f, f.recordGenerated("mock", iface.(Node))
+}
+
+func writeMockMethod(fields, methods *bytes.Buffer, file *File, mock, iface string, m FuncNode, ft *ast.FuncType) {
+	name := m.Name()
+	variadic := m.IsVariadic()
+	// reserved identifiers of the method body
+	reserved := map[string]bool{"mock": true, "fn": true, "ret": true}
+
+	var params, args, callFields, callValues []string
+	for i := 0; i < m.NumParam(); i++ {
+		p, _ := m.Param(i)
+		pname := p.Name
+		if pname == "" || pname == "_" || reserved[pname] {
+			pname = fmt.Sprintf("a%d", i)
+		}
+		typ := p.TypeName
+		arg := pname
+		fieldType := typ
+		if variadic && i == m.NumParam()-1 {
+			arg += "..."
+			fieldType = "[]" + strings.TrimPrefix(typ, "...")
+		}
+		params = append(params, pname+" "+typ)
+		args = append(args, arg)
+		callFields = append(callFields, fmt.Sprintf("%s %s", goutil.CamelString(pname), fieldType))
+		callValues = append(callValues, pname)
+	}
+	var results, retFields, retValues []string
+	for i := 0; i < m.NumResult(); i++ {
+		r, _ := m.Result(i)
+		results = append(results, r.TypeName)
+		retFields = append(retFields, fmt.Sprintf("R%d %s", i, r.TypeName))
+		retValues = append(retValues, fmt.Sprintf("ret.R%d", i))
+	}
+	sig, _ := file.FormatNode(ft)
+	sig = strings.TrimPrefix(sig, "func")
+	callType := "struct{" + strings.Join(callFields, "; ") + "}"
+
+	fmt.Fprintf(fields, "\t// %sFunc, if not nil, is called by %s.\n\t%sFunc func%s\n", name, name, name, sig)
+	if len(results) > 0 {
+		fmt.Fprintf(fields, "\t// %sReturns are the results of %s if %sFunc is nil.\n\t%sReturns struct{\n\t\t%s\n\t}\n",
+			name, name, name, name, strings.Join(retFields, "\n\t\t"))
+	}
+	fmt.Fprintf(fields, "\t// %sCalls records the arguments of the %s calls.\n\t%sCalls []%s\n", name, name, name, callType)
+
+	var resultList string
+	switch len(results) {
+	case 0:
+	case 1:
+		resultList = " " + results[0]
+	default:
+		resultList = " (" + strings.Join(results, ", ") + ")"
+	}
+	fmt.Fprintf(methods, "\n// %s implements %s.\nfunc (mock *%s) %s(%s)%s {\n", name, iface, mock, name, strings.Join(params, ", "), resultList)
+	fmt.Fprintf(methods, "\tmock.mu.Lock()\n\tmock.%sCalls = append(mock.%sCalls, %s{%s})\n\tfn := mock.%sFunc\n",
+		name, name, callType, strings.Join(callValues, ", "), name)
+	if len(results) > 0 {
+		fmt.Fprintf(methods, "\tret := mock.%sReturns\n", name)
+	}
+	fmt.Fprintf(methods, "\tmock.mu.Unlock()\n\tif fn != nil {\n")
+	if len(results) > 0 {
+		fmt.Fprintf(methods, "\t\treturn fn(%s)\n\t}\n\treturn %s\n}\n", strings.Join(args, ", "), strings.Join(retValues, ", "))
+	} else {
+		fmt.Fprintf(methods, "\t\tfn(%s)\n\t}\n}\n", strings.Join(args, ", "))
+	}
+}
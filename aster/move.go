@@ -0,0 +1,460 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MoveTo moves the top-level declaration of the node to the file, along with
+// its doc comment, and the methods of a type declared in the package.
+// The imports the declarations use are added to the file, and the unused
+// ones are removed from the files they are moved from, see FixImports.
+// For a file of another package, the references across the module of the
+// source and the one of the file are qualified by the new package, or
+// unqualified in it, and the package names it refers to are qualified by
+// the source package; the file of the source is removed if nothing is left.
+// Returns an error if the node is not a top-level type or function, or is a
+// method to move to another package, if the name is taken, or if an
+// unexported name would be referred to across the packages, or if the
+// packages would import each other.
+// NOTE: The files of the modules are reparsed after moving,
+// so the nodes must be looked up again.
+func (s *super) MoveTo(target *File) error {
+	n, ok := s.self()
+	if !ok {
+		return fmt.Errorf("aster: node is not a declaration")
+	}
+	return moveNode(n, target)
+}
+
+// MoveToPackage moves the top-level declaration of the node to the file of
+// the same name in the package, which is added if not exist, see MoveTo.
+func (s *super) MoveToPackage(target *Package) error {
+	n, ok := s.self()
+	if !ok {
+		return fmt.Errorf("aster: node is not a declaration")
+	}
+	base := filepath.Base(s.file.Filename)
+	filename := filepath.Join(target.Dir, base)
+	if f, ok := target.Files[filename]; ok {
+		return moveNode(n, f)
+	}
+	f, err := target.AddFile(base, []byte("package "+target.Name+"\n"))
+	if err != nil {
+		return err
+	}
+	if err = moveNode(n, f); err != nil {
+		delete(target.Files, filename)
+		target.collectNodes()
+	}
+	return err
+}
+
+// self returns the node of which s is the common extension info.
+func (s *super) self() (Node, bool) {
+	for _, n := range s.file.Nodes {
+		if superOf(n) == s {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// movedDecl is a declaration to move, or the type spec of a grouped one.
+type movedDecl struct {
+	file       *File
+	node       ast.Node
+	prefix     string // e.g. "type " for a spec
+	start, end int    // the source range, in whole lines
+}
+
+func moveNode(n Node, target *File) error {
+	from := nodeFile(n)
+	name, kind, recv := n.Name(), n.Kind(), recvTypeName(n)
+	if from == nil || name == "" || isInterfaceMethod(n) {
+		return fmt.Errorf("aster: node is not a declaration")
+	}
+	if from.pkg == nil {
+		return fmt.Errorf("aster: the file is not in a package: %s", from.Filename)
+	}
+	if target.pkg == nil {
+		return fmt.Errorf("aster: the file is not in a package: %s", target.Filename)
+	}
+	if from == target {
+		return nil
+	}
+	cross := from.pkg != target.pkg
+	if cross {
+		if recv != "" {
+			return fmt.Errorf("aster: can not move the method %s.%s to another package", recv, name)
+		}
+		if err := target.CheckCollision(name); err != nil {
+			return err
+		}
+	}
+	files := from.moduleFiles()
+	for _, f := range target.moduleFiles() {
+		if !containsFile(files, f) {
+			files = append(files, f)
+		}
+	}
+	for _, f := range files {
+		if err := f.refresh(); err != nil {
+			return err
+		}
+	}
+	n, ok := from.lookupTopNode(name, kind, recv)
+	if !ok {
+		return fmt.Errorf("aster: not a top-level declaration: %s", name)
+	}
+	moved, err := from.pkg.declsToMove(n)
+	if err != nil {
+		return err
+	}
+
+	var (
+		edits     = make(map[*File][]textEdit)
+		imports   []string
+		dstImport map[*File]string
+	)
+	if cross {
+		var srcImport string
+		if srcImport, dstImport, err = moveRefEdits(files, moved, name, from.pkg, target, edits); err != nil {
+			return err
+		}
+		if srcImport != "" {
+			imports = append(imports, srcImport)
+		}
+	}
+	for _, d := range moved {
+		for _, imp := range d.file.importsOf(d.node) {
+			if (!cross || imp.Path != target.pkg.Path()) && !containsString(imports, importSpec(imp)) {
+				imports = append(imports, importSpec(imp))
+			}
+		}
+	}
+
+	// the source texts of the declarations, with the edits within them
+	var src strings.Builder
+	if len(imports) > 0 {
+		src.WriteString("import (\n\t" + strings.Join(imports, "\n\t") + "\n)\n")
+	}
+	changed := make(map[*File]bool)
+	for _, d := range moved {
+		var rest, within []textEdit
+		for _, e := range edits[d.file] {
+			if d.start <= e.start && e.end <= d.end {
+				within = append(within, textEdit{start: e.start - d.start, end: e.end - d.start, text: e.text})
+			} else {
+				rest = append(rest, e)
+			}
+		}
+		text := string(d.file.Src[d.start:d.end])
+		if len(within) > 0 {
+			text = spliceEdits(text, within)
+		}
+		src.WriteString("\n" + d.prefix + strings.TrimSpace(text) + "\n")
+		edits[d.file] = append(rest, textEdit{start: d.start, end: d.end})
+		changed[d.file] = true
+	}
+	for f := range edits {
+		changed[f] = true
+	}
+	for _, f := range files {
+		if err = f.applyEdits(edits[f]); err != nil {
+			return err
+		}
+	}
+	for f, qualifier := range dstImport {
+		if err = f.AddImport(importName(qualifier, target.pkg.Path()), target.pkg.Path()); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if !changed[f] {
+			continue
+		}
+		if err = f.FixImports(); err != nil {
+			return err
+		}
+		if f.pkg != nil && f.File.Doc == nil && f.isEmpty() && f != target {
+			for _, d := range moved {
+				if d.file == f {
+					f.pkg.RemoveFile(f.Filename)
+					break
+				}
+			}
+		}
+	}
+	return target.Merge([]byte(src.String()))
+}
+
+// declsToMove returns the declaration of the top-level node, and the methods
+// of a type declared in the package, in the order of the files.
+func (p *Package) declsToMove(n Node) ([]*movedDecl, error) {
+	from := nodeFile(n)
+	var moved []*movedDecl
+	if d, ok := n.Node().(*ast.FuncDecl); ok {
+		return append(moved, from.movedDecl(d, d, nil)), nil
+	}
+	for _, decl := range from.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			if s := spec.(*ast.TypeSpec); s.Name.Name == n.Name() {
+				moved = append(moved, from.movedDecl(d, s, s))
+			}
+		}
+	}
+	if len(moved) == 0 {
+		return nil, fmt.Errorf("aster: not a top-level type or function: %s", n.Name())
+	}
+	for _, f := range p.sortedFiles() {
+		for _, decl := range f.File.Decls {
+			if d, ok := decl.(*ast.FuncDecl); ok && f.declRecv(d) == n.Name() {
+				moved = append(moved, f.movedDecl(d, d, nil))
+			}
+		}
+	}
+	return moved, nil
+}
+
+// movedDecl returns the declaration to move, or the type spec of it if it is
+// grouped with other specs, along with the doc and line comments.
+func (f *File) movedDecl(decl ast.Decl, node ast.Node, spec *ast.TypeSpec) *movedDecl {
+	start, end := declStart(decl), decl.End()
+	d := &movedDecl{file: f, node: node}
+	if g, ok := decl.(*ast.GenDecl); ok && len(g.Specs) > 1 {
+		d.prefix = g.Tok.String() + " "
+		start, end = spec.Pos(), spec.End()
+		if spec.Doc != nil {
+			start = spec.Doc.Pos()
+		}
+		if spec.Comment != nil {
+			end = spec.Comment.End()
+		}
+	}
+	d.start, d.end = f.lineRange(f.offset(start), f.offset(end))
+	return d
+}
+
+// moveRefEdits adds the edits of the references to the name moved to
+// another package, and of the references of the moved declarations to the
+// source package. Returns the import spec of the source package to add to
+// the target file, if needed, and the names of the target package to import
+// as in the files referring to it.
+func moveRefEdits(files []*File, moved []*movedDecl, name string, from *Package, target *File, edits map[*File][]textEdit) (string, map[*File]string, error) {
+	srcPath, dstPath := from.Path(), target.pkg.Path()
+	within := func(f *File, pos token.Pos) bool {
+		for _, d := range moved {
+			if d.file == f && d.start <= f.offset(pos) && f.offset(pos) < d.end {
+				return true
+			}
+		}
+		return false
+	}
+	declared := make(map[string]bool)
+	for _, f := range from.sortedFiles() {
+		if f.File.Scope != nil {
+			for name := range f.File.Scope.Objects {
+				declared[name] = true
+			}
+		}
+	}
+	var (
+		err       error
+		srcUsed   bool
+		dstImport = make(map[*File]string) // the files to import the target package
+	)
+	dstName := func(f *File) (string, error) {
+		for _, imp := range f.Imports {
+			if imp.Path == dstPath {
+				return imp.Name, nil
+			}
+		}
+		if f.nameTaken(target.pkg.Name) {
+			return "", fmt.Errorf("aster: package name %s is taken in %s", target.pkg.Name, f.Filename)
+		}
+		dstImport[f] = target.pkg.Name
+		return target.pkg.Name, nil
+	}
+	fail := func(format string, args ...interface{}) bool {
+		if err == nil {
+			err = fmt.Errorf(format, args...)
+		}
+		return false
+	}
+	for _, f := range files {
+		if f.pkg != from {
+			// pkg.Name in the other packages
+			ast.Inspect(f.File, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != name {
+					return err == nil
+				}
+				x, ok := sel.X.(*ast.Ident)
+				if !ok || x.Obj != nil || !f.importsPath(x.Name, srcPath) {
+					return true
+				}
+				if f.pkg == target.pkg {
+					edits[f] = append(edits[f], textEdit{start: f.offset(sel.Pos()), end: f.offset(sel.Sel.Pos())})
+					return true
+				}
+				qualifier, e := dstName(f)
+				if e != nil {
+					return fail("%v", e)
+				}
+				edits[f] = append(edits[f], f.textEdit(x, qualifier))
+				return true
+			})
+			continue
+		}
+		skip := f.nonRefIdents()
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			switch x := n.(type) {
+			case *ast.SelectorExpr:
+				// target.Name in the moved declarations
+				if id, ok := x.X.(*ast.Ident); ok && id.Obj == nil && f.importsPath(id.Name, dstPath) && within(f, x.Pos()) {
+					edits[f] = append(edits[f], textEdit{start: f.offset(x.Pos()), end: f.offset(x.Sel.Pos())})
+					return false
+				}
+			case *ast.Ident:
+				if skip[x] || !isTopLevelRef(f, x, declared) {
+					return true
+				}
+				switch in := within(f, x.Pos()); {
+				case in && x.Name != name:
+					if !IsExported(x.Name) {
+						return fail("aster: %s refers to %s unexported by package %s", name, x.Name, from.Name)
+					}
+					srcUsed = true
+					edits[f] = append(edits[f], f.textEdit(x, from.Name+"."+x.Name))
+				case !in && x.Name == name:
+					if !IsExported(name) {
+						return fail("aster: %s unexported is referred to by package %s at %s", name, from.Name, f.FileSet.Position(x.Pos()))
+					}
+					qualifier, e := dstName(f)
+					if e != nil {
+						return fail("%v", e)
+					}
+					edits[f] = append(edits[f], f.textEdit(x, qualifier+"."+name))
+				}
+			}
+			return true
+		})
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if !srcUsed {
+		return "", dstImport, nil
+	}
+	for _, f := range from.sortedFiles() {
+		if _, ok := dstImport[f]; ok || f.importsPath("", dstPath) {
+			return "", nil, fmt.Errorf("aster: import cycle: %s and %s would import each other", srcPath, dstPath)
+		}
+	}
+	return strings.TrimSpace(importName(from.Name, srcPath) + " " + strconv.Quote(srcPath)), dstImport, nil
+}
+
+// isEmpty reports whether the file declares nothing but imports.
+func (f *File) isEmpty() bool {
+	for _, decl := range f.File.Decls {
+		if d, ok := decl.(*ast.GenDecl); !ok || d.Tok != token.IMPORT {
+			return false
+		}
+	}
+	return true
+}
+
+// importName returns the name to import the package path as,
+// or "" if it is the last element of the path.
+func importName(pkgName, pkgPath string) string {
+	if path.Base(pkgPath) == pkgName {
+		return ""
+	}
+	return pkgName
+}
+
+// importsPath reports whether the file imports the path by the name,
+// or by any name if empty.
+func (f *File) importsPath(name, pkgPath string) bool {
+	for _, imp := range f.Imports {
+		if imp.Path == pkgPath && (name == "" || imp.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTopLevelRef reports whether the identifier refers to a package-level
+// name of the package of the file, declared in the file or another one.
+func isTopLevelRef(f *File, x *ast.Ident, declared map[string]bool) bool {
+	if x.Obj == nil {
+		return declared[x.Name]
+	}
+	if f.File.Scope == nil || f.File.Scope.Lookup(x.Name) != x.Obj {
+		return false
+	}
+	switch d := x.Obj.Decl.(type) {
+	case *ast.TypeSpec:
+		return d.Name != x
+	case *ast.FuncDecl:
+		return d.Name != x
+	case *ast.ValueSpec:
+		for _, id := range d.Names {
+			if id == x {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// spliceEdits applies the non-overlapping edits to the text.
+func spliceEdits(text string, edits []textEdit) string {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b strings.Builder
+	var last int
+	for _, e := range edits {
+		b.WriteString(text[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func containsFile(files []*File, f *File) bool {
+	for _, g := range files {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewFile creates the file of the name in the package directory, which is
+// written by Store, with the package clause and the header source, e.g. the
+// comments and imports of a generated file:
+//
+//	// Code generated by gen. DO NOT EDIT.
+//
+//	import "fmt"
+//
+// The leading comments of the header are placed before the package clause,
+// and the rest after it; the package clause of the header is optional.
+// Returns an error if the file already exists in the package or on disk.
+func (p *Package) NewFile(name string, headerSrc string) (*File, error) {
+	if !strings.HasSuffix(name, ".go") || filepath.Base(name) != name {
+		return nil, fmt.Errorf("aster: invalid file name: %s", name)
+	}
+	filename := filepath.Join(p.Dir, name)
+	if _, ok := p.Files[filename]; ok {
+		return nil, fmt.Errorf("aster: file already exists: %s", filename)
+	}
+	if !containsString(p.removed, filename) {
+		if _, err := os.Stat(filename); err == nil {
+			return nil, fmt.Errorf("aster: file already exists: %s", filename)
+		}
+	}
+	return p.AddFile(name, []byte(fileHeader(p.Name, headerSrc)))
+}
+
+// fileHeader returns the source of a file of the header, with the package
+// clause after the leading comments, if the header has no package clause.
+func fileHeader(pkgName, header string) string {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", header, parser.PackageClauseOnly); err == nil {
+		return header
+	}
+	lines := strings.SplitAfter(header, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+	comments, rest := strings.Join(lines[:i], ""), strings.Join(lines[i:], "")
+	if comments != "" && !strings.HasSuffix(comments, "\n") {
+		comments += "\n"
+	}
+	src := comments + "package " + pkgName + "\n"
+	if rest != "" {
+		src += "\n" + rest
+	}
+	return src
+}
+
+// NewPackage creates the package of the name in the directory, which is
+// relative to the module directory if not absolute, so that the files added
+// by Package.NewFile are written by Store.
+// A package in another directory is kept until Module.Reparse, which parses
+// the module directory only.
+// Returns an error if the name is taken in the module, or the directory has
+// another package, except the test packages of each other, e.g. foo_test.
+func (m *Module) NewPackage(dir, name string) (*Package, error) {
+	if !token.IsIdentifier(name) {
+		return nil, fmt.Errorf("aster: invalid package name: %s", name)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(m.Dir, dir)
+	}
+	if _, ok := m.Packages[name]; ok {
+		return nil, fmt.Errorf("aster: package already exists: %s", name)
+	}
+	for _, p := range m.Packages {
+		if filepath.Clean(p.Dir) == filepath.Clean(dir) && p.Name+"_test" != name && name+"_test" != p.Name {
+			return nil, fmt.Errorf("aster: package %s already in the directory: %s", p.Name, dir)
+		}
+	}
+	p := convertPackage(m, dir, &ast.Package{
+		Name:    name,
+		Scope:   ast.NewScope(nil),
+		Imports: make(map[string]*ast.Object),
+		Files:   make(map[string]*ast.File),
+	})
+	if m.Packages == nil {
+		m.Packages = make(map[string]*Package)
+	}
+	m.Packages[name] = p
+	return p, nil
+}
+
+// RemovePackage removes the package of the name from the module, whose files
+// are deleted from the disk by Module.Store, along with the directory if it
+// is left empty and is not the module directory, unless keepFiles is true.
+// Returns false if the module has no such package.
+func (m *Module) RemovePackage(name string, keepFiles ...bool) bool {
+	p, ok := m.Packages[name]
+	if !ok {
+		return false
+	}
+	delete(m.Packages, name)
+	m.impls = nil
+	if len(keepFiles) > 0 && keepFiles[0] {
+		return true
+	}
+	for _, f := range p.sortedFiles() {
+		p.removed = append(p.removed, f.Filename)
+	}
+	p.Files = make(map[string]*File)
+	m.removed = append(m.removed, p)
+	return true
+}
+
+// deleteRemoved deletes the files of the packages removed from the module,
+// and their directories left empty on the local file system.
+func (m *Module) deleteRemoved(fsys WriteFileFS) error {
+	for len(m.removed) > 0 {
+		p := m.removed[0]
+		if err := p.deleteRemoved(fsys); err != nil {
+			return err
+		}
+		if _, local := fsys.(osFS); local && filepath.Clean(p.Dir) != filepath.Clean(m.Dir) {
+			if infos, err := ioutil.ReadDir(p.Dir); err == nil && len(infos) == 0 {
+				if err = os.Remove(p.Dir); err != nil {
+					return err
+				}
+			}
+		}
+		m.removed = m.removed[1:]
+	}
+	return nil
+}
@@ -17,12 +17,13 @@ package aster
 import (
 	"fmt"
 	"go/ast"
+	"strings"
 )
 
 // FuncDecl function Declaration
 type FuncDecl struct {
 	*super
-	node    ast.Node // *ast.FuncLit or *ast.FuncDecl
+	node    ast.Node // *ast.FuncLit, *ast.FuncDecl or *ast.Field(interface method)
 	recv    *FuncField
 	params  []*FuncField
 	results []*FuncField
@@ -36,8 +37,9 @@ func (f *File) newFuncNode(namePtr *string, doc *ast.CommentGroup,
 	switch node.(type) {
 	case *ast.FuncLit:
 	case *ast.FuncDecl:
+	case *ast.Field:
 	default:
-		panic(fmt.Sprintf("want: *ast.FuncLit or *ast.FuncDecl, but got: %T", node))
+		panic(fmt.Sprintf("want: *ast.FuncLit, *ast.FuncDecl or *ast.Field, but got: %T", node))
 	}
 	ft := &FuncDecl{
 		super:   f.newSuper(namePtr, Func, doc),
@@ -58,19 +60,23 @@ func (f *FuncDecl) Node() ast.Node {
 
 // String returns the formated code block.
 func (f *FuncDecl) String() string {
-	s, err := f.file.FormatNode(f.Node())
+	node := f.Node()
+	if field, ok := node.(*ast.Field); ok {
+		node = field.Type
+	}
+	s, err := f.file.FormatNode(node)
 	if err != nil {
 		return fmt.Sprintf("// Formatting error: %s", err.Error())
 	}
-	if _, ok := f.node.(*ast.FuncDecl); ok {
+	switch f.node.(type) {
+	case *ast.FuncDecl:
 		return s
+	case *ast.Field:
+		// interface method
+		return f.Name() + strings.TrimPrefix(s, "func")
 	}
 	s = "var " + f.Name() + " = " + s
-	doc := f.Doc()
-	if doc != "" {
-		s = "// " + doc + s
-	}
-	return s
+	return lineComments(f.Doc()) + s
 }
 
 // NumParam returns a function type's input parameter count.
@@ -116,6 +122,8 @@ func (f *FuncDecl) IsVariadic() bool {
 		return isVariadic(t.Type)
 	case *ast.FuncDecl:
 		return isVariadic(t.Type)
+	case *ast.Field:
+		return isVariadic(t.Type.(*ast.FuncType))
 	default:
 		return false
 	}
@@ -17,6 +17,7 @@ package aster
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"sort"
 	"strconv"
@@ -27,8 +28,12 @@ import (
 
 type superType struct {
 	*super
-	isAssign bool // is there `=` for declared type?
+	isAssign bool     // is there `=` for declared type?
+	alias    ast.Expr // the aliased type of `type A = B`, nil if not an alias
 	methods  []FuncNode
+	// promoted returns the methods promoted from the embedded types,
+	// nil if the kind of type has no embedded types.
+	promoted func() []FuncNode
 }
 
 func (f *File) newSuperType(namePtr *string, kind Kind, doc *ast.CommentGroup,
@@ -46,19 +51,58 @@ func (s *superType) IsAssign() bool {
 	return s.isAssign
 }
 
+// IsAlias reports whether the type is declared as an alias, `type A = B`.
+func (s *superType) IsAlias() bool {
+	return s.alias != nil
+}
+
+func (s *superType) setAlias(typ ast.Expr) {
+	s.alias = typ
+}
+
+// AliasOf returns the aliased type of the alias, see (*File).exprTypeNode,
+// or false if the type is not an alias, or the aliased type is not declared
+// in the module.
+func (s *superType) AliasOf() (TypeNode, bool) {
+	if s.alias == nil {
+		return nil, false
+	}
+	return s.file.exprTypeNode(s.alias)
+}
+
+// Unalias returns the type at the end of the alias chain of t, e.g. the
+// defined type or the type literal, or t itself if it is not an alias.
+// If the chain leaves the module or is cyclic, the last alias resolved in
+// the module is returned, whose IsAlias reports true.
+func Unalias(t TypeNode) TypeNode {
+	seen := make(map[TypeNode]bool)
+	for t.IsAlias() && !seen[t] {
+		seen[t] = true
+		next, ok := t.AliasOf()
+		if !ok {
+			break
+		}
+		t = next
+	}
+	return t
+}
+
 // Method returns the i'th method in the type's method set.
-// It panics if i is not in the range [0, NumMethod()).
 //
 // For a non-interface type T or *T, the returned Method's Type and Func
 // fields describe a function whose first argument is the receiver.
 //
 // For an interface type, the returned Method's Type field gives the
 // method signature, without a receiver, and the Func field is nil.
-func (s *superType) Method(i int) (FuncNode, bool) {
-	if i < 0 || i >= len(s.methods) {
+//
+// If promoted is true, the method set includes the methods promoted
+// from the embedded types, which are ordered after the declared methods.
+func (s *superType) Method(i int, promoted ...bool) (FuncNode, bool) {
+	methods := s.methodSet(promoted)
+	if i < 0 || i >= len(methods) {
 		return nil, false
 	}
-	return s.methods[i], true
+	return methods[i], true
 }
 
 // MethodByName returns the method with that name in the type's
@@ -69,8 +113,11 @@ func (s *superType) Method(i int) (FuncNode, bool) {
 //
 // For an interface type, the returned Method's Type field gives the
 // method signature, without a receiver, and the Func field is nil.
-func (s *superType) MethodByName(name string) (FuncNode, bool) {
-	for _, m := range s.methods {
+//
+// If promoted is true, the method set includes the methods promoted
+// from the embedded types.
+func (s *superType) MethodByName(name string, promoted ...bool) (FuncNode, bool) {
+	for _, m := range s.methodSet(promoted) {
 		if m.Name() == name {
 			return m, true
 		}
@@ -78,36 +125,22 @@ func (s *superType) MethodByName(name string) (FuncNode, bool) {
 	return nil, false
 }
 
-// NumMethod returns the number of exported methods in the type's method set.
-func (s *superType) NumMethod() int {
-	return len(s.methods)
+// NumMethod returns the number of methods in the type's method set,
+// including the unexported ones, see Methods.
+// If promoted is true, the method set includes the methods promoted
+// from the embedded types, otherwise only the declared methods.
+func (s *superType) NumMethod(promoted ...bool) int {
+	return len(s.methodSet(promoted))
 }
 
 // Implements reports whether the type implements the interface type u.
 func (s *superType) Implements(u TypeNode) bool {
-	for i := u.NumMethod() - 1; i >= 0; i-- {
-		um, _ := u.Method(i)
-		cm, ok := s.MethodByName(um.Name())
-		if !ok ||
-			um.IsVariadic() != cm.IsVariadic() ||
-			um.NumParam() != cm.NumParam() ||
-			um.NumResult() != cm.NumResult() {
+	for i := u.NumMethod(true) - 1; i >= 0; i-- {
+		um, _ := u.Method(i, true)
+		cm, ok := s.MethodByName(um.Name(), true)
+		if !ok || !sameSignature(um, cm) {
 			return false
 		}
-		for j := um.NumParam(); j >= 0; j-- {
-			uf, _ := um.Param(j)
-			cf, _ := cm.Param(j)
-			if uf.TypeName != cf.TypeName {
-				return false
-			}
-		}
-		for j := um.NumResult(); j >= 0; j-- {
-			uf, _ := um.Result(j)
-			cf, _ := cm.Result(j)
-			if uf.TypeName != cf.TypeName {
-				return false
-			}
-		}
 	}
 	return true
 }
@@ -117,14 +150,42 @@ func (s *superType) addMethod(method FuncNode) error {
 	if !ok {
 		return fmt.Errorf("not method: %s", method.Name())
 	}
-	if field.TypeName != s.Name() {
+	if baseTypeName(field.TypeName) != s.Name() {
 		return fmt.Errorf("reveiver do not match method: %s, want: %s, got: %s",
 			method.Name(), s.Name(), field.TypeName)
 	}
+	if _, ok := s.MethodByName(method.Name()); ok {
+		return fmt.Errorf("method already exists: %s.%s", s.Name(), method.Name())
+	}
 	s.methods = append(s.methods, method)
 	return nil
 }
 
+// sameSignature reports whether the two functions have the same
+// parameter and result types, ignoring the receivers and names.
+func sameSignature(a, b FuncNode) bool {
+	if a.IsVariadic() != b.IsVariadic() ||
+		a.NumParam() != b.NumParam() ||
+		a.NumResult() != b.NumResult() {
+		return false
+	}
+	for j := a.NumParam() - 1; j >= 0; j-- {
+		af, _ := a.Param(j)
+		bf, _ := b.Param(j)
+		if af.TypeName != bf.TypeName {
+			return false
+		}
+	}
+	for j := a.NumResult() - 1; j >= 0; j-- {
+		af, _ := a.Result(j)
+		bf, _ := b.Result(j)
+		if af.TypeName != bf.TypeName {
+			return false
+		}
+	}
+	return true
+}
+
 // AliasType represents a alias type
 type AliasType struct {
 	*superType
@@ -197,6 +258,91 @@ func (b *BasicType) String() string {
 	return joinType(b, b.file)
 }
 
+// Elem returns the element type of the pointer type,
+// see (*File).exprTypeNode, or false if it is not a pointer type.
+func (b *BasicType) Elem() (TypeNode, bool) {
+	star, ok := b.Expr.(*ast.StarExpr)
+	if !ok {
+		return nil, false
+	}
+	return b.file.exprTypeNode(star.X)
+}
+
+// exprTypeNode returns the TypeNode of the type expression, i.e. the node
+// of the named type declared in the module, or else an anonymous TypeNode
+// of the type literal or the basic type, e.g. []*User, so that the composite
+// types can be walked recursively by Elem and Key.
+// Returns false for the types declared outside the module, e.g. time.Time,
+// and for the function types.
+func (f *File) exprTypeNode(e ast.Expr) (TypeNode, bool) {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return f.exprTypeNode(x.X)
+	case *ast.Ident:
+		if t, ok := f.newBasicType(nil, nil, token.NoPos, x); ok {
+			return t, true
+		}
+		if x.Name == "error" {
+			return nil, false
+		}
+		return f.LookupTypeInMod(x.Name)
+	case *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+		return f.LookupTypeInMod(f.TryFormatNode(genericBase(x)))
+	case *ast.StarExpr:
+		return f.newAliasType(nil, nil, token.NoPos, x), true
+	case *ast.ArrayType:
+		return f.newListType(nil, nil, token.NoPos, x), true
+	case *ast.MapType:
+		return f.newMapType(nil, nil, token.NoPos, x), true
+	case *ast.ChanType:
+		return f.newChanType(nil, nil, token.NoPos, x), true
+	case *ast.InterfaceType:
+		return f.newInterfaceType(nil, nil, token.NoPos, x), true
+	case *ast.StructType:
+		if t, ok := f.Nodes[x.Pos()].(*StructType); ok && t.StructType == x && t.namePtr == nil {
+			return t, true
+		}
+		t := f.newStructType(nil, nil, token.NoPos, x)
+		t.setFields()
+		return t, true
+	}
+	return nil, false
+}
+
+// packageConsts returns the values of the integer constants declared
+// in the package of the file, or in the file if it has no package.
+func (f *File) packageConsts() map[string]constant.Value {
+	files := []*File{f}
+	if f.pkg != nil {
+		files = f.pkg.sortedFiles()
+	}
+	consts := make(map[string]constant.Value)
+	for _, file := range files {
+		for _, decl := range file.File.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			var values []ast.Expr
+			for i, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) > 0 {
+					values = vs.Values
+				}
+				for j, id := range vs.Names {
+					if j >= len(values) {
+						break
+					}
+					if v, ok := evalConst(values[j], int64(i), consts, ""); ok {
+						consts[id.Name] = v
+					}
+				}
+			}
+		}
+	}
+	return consts
+}
+
 // ListType represents an array or slice type.
 type ListType struct {
 	*superType
@@ -230,12 +376,28 @@ func (l *ListType) String() string {
 
 // Len returns list's length if it is array type,
 // otherwise returns false.
+// NOTE: A length of constants is evaluated only if they are integer
+// constants declared in the package.
 func (l *ListType) Len() (int, bool) {
 	if l.Kind() == Slice {
 		return -1, false
 	}
-	cnt, _ := strconv.Atoi(l.ArrayType.Len.(*ast.BasicLit).Value)
-	return cnt, true
+	if lit, ok := l.ArrayType.Len.(*ast.BasicLit); ok {
+		cnt, _ := strconv.Atoi(lit.Value)
+		return cnt, true
+	}
+	v, ok := evalConst(l.ArrayType.Len, 0, l.file.packageConsts(), "")
+	if !ok {
+		return -1, false
+	}
+	cnt, ok := constant.Int64Val(v)
+	return int(cnt), ok
+}
+
+// Elem returns the element type of the list,
+// see (*File).exprTypeNode.
+func (l *ListType) Elem() (TypeNode, bool) {
+	return l.file.exprTypeNode(l.ArrayType.Elt)
 }
 
 // MapType represents a map type.
@@ -265,6 +427,18 @@ func (m *MapType) String() string {
 	return joinType(m, m.file)
 }
 
+// Key returns the key type of the map,
+// see (*File).exprTypeNode.
+func (m *MapType) Key() (TypeNode, bool) {
+	return m.file.exprTypeNode(m.MapType.Key)
+}
+
+// Elem returns the element type of the map,
+// see (*File).exprTypeNode.
+func (m *MapType) Elem() (TypeNode, bool) {
+	return m.file.exprTypeNode(m.MapType.Value)
+}
+
 // ChanType represents a channel type.
 type ChanType struct {
 	*superType
@@ -297,6 +471,12 @@ func (c *ChanType) Dir() ast.ChanDir {
 	return c.ChanType.Dir
 }
 
+// Elem returns the element type of the channel,
+// see (*File).exprTypeNode.
+func (c *ChanType) Elem() (TypeNode, bool) {
+	return c.file.exprTypeNode(c.ChanType.Value)
+}
+
 // InterfaceType represents a interface type.
 type InterfaceType struct {
 	*superType
@@ -308,10 +488,34 @@ var _ TypeNode = (*InterfaceType)(nil)
 
 func (f *File) newInterfaceType(namePtr *string, doc *ast.CommentGroup, assign token.Pos,
 	typ *ast.InterfaceType) *InterfaceType {
-	return &InterfaceType{
+	i := &InterfaceType{
 		superType:     f.newSuperType(namePtr, Interface, doc, assign != token.NoPos),
 		InterfaceType: typ,
 	}
+	i.setMethods()
+	i.promoted = i.promotedMethods
+	return i
+}
+
+// setMethods collects the methods explicitly declared in the interface.
+func (i *InterfaceType) setMethods() {
+	if i.InterfaceType.Methods == nil {
+		return
+	}
+	for _, field := range i.InterfaceType.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			continue // embedded interface or type constraint
+		}
+		i.methods = append(i.methods, i.file.newFuncNode(
+			&field.Names[0].Name,
+			field.Doc,
+			field,
+			nil,
+			i.file.expandFuncFields(ft.Params),
+			i.file.expandFuncFields(ft.Results),
+		))
+	}
 }
 
 // Node returns origin AST node.
@@ -324,6 +528,15 @@ func (i *InterfaceType) String() string {
 	return joinType(i, i.file)
 }
 
+// Methods returns the methods in the interface's method set, see
+// TypeNode.Methods.
+// NOTE: It can't be promoted from superType, since the selector is
+// ambiguous with the field of the embedded ast.InterfaceType, the method
+// list of the syntax tree is InterfaceType.InterfaceType.Methods.
+func (i *InterfaceType) Methods(includeUnexported bool, promoted ...bool) []FuncNode {
+	return i.superType.Methods(includeUnexported, promoted...)
+}
+
 // StructType represents a struct type.
 type StructType struct {
 	*superType
@@ -336,10 +549,12 @@ var _ TypeNode = (*StructType)(nil)
 
 func (f *File) newStructType(namePtr *string, doc *ast.CommentGroup, assign token.Pos,
 	typ *ast.StructType) *StructType {
-	return &StructType{
+	s := &StructType{
 		superType:  f.newSuperType(namePtr, Struct, doc, assign != token.NoPos),
 		StructType: typ,
 	}
+	s.promoted = s.promotedMethods
+	return s
 }
 
 // Node returns origin AST node.
@@ -369,7 +584,17 @@ func (s *StructType) Field(i int) (field *StructField) {
 
 // FieldByName returns the struct field with the given name
 // and a boolean indicating if the field was found.
-func (s *StructType) FieldByName(name string) (field *StructField, found bool) {
+// If promoted is true, the fields promoted through the embedded structs
+// are looked up too, see FlattenFields.
+func (s *StructType) FieldByName(name string, promoted ...bool) (field *StructField, found bool) {
+	if len(promoted) > 0 && promoted[0] {
+		for _, field := range s.FlattenFields() {
+			if field.Name() == name {
+				return field, true
+			}
+		}
+		return nil, false
+	}
 	for _, field := range s.fields {
 		if field.Name() == name {
 			return field, true
@@ -382,28 +607,53 @@ func (s *StructType) FieldByName(name string) (field *StructField, found bool) {
 type StructField struct {
 	*ast.Field
 	Tags *StructTag // field tags handler
+	// Index is the index sequence for the promoted field, like reflect.StructField.Index,
+	// e.g. [1 0] for the first field of the struct embedded as the second field.
+	Index []int
+	// Path is the names of the embedded fields through which the field is promoted,
+	// e.g. [Base] for Base.ID; empty for a field declared in the struct.
+	Path   []string
+	file   *File
+	parent *StructType // the struct declaring the field
 }
 
 func (s *StructType) setFields() {
 	expandFields(s.StructType.Fields)
-	for _, field := range s.StructType.Fields.List {
+	for i, field := range s.StructType.Fields.List {
 		s.fields = append(s.fields, &StructField{
-			Field: field,
-			Tags:  newStructTag(field),
+			Field:  field,
+			Tags:   newStructTag(field),
+			Index:  []int{i},
+			file:   s.file,
+			parent: s,
 		})
 	}
 }
 
+// Kind returns the kind of the field type.
+// A named type declared in the package is reported by its own kind,
+// other named types are reported as Suspense.
+func (s *StructField) Kind() Kind {
+	return s.file.exprKind(s.Field.Type)
+}
+
+// TypeName returns the formatted field type.
+func (s *StructField) TypeName() string {
+	return s.file.TryFormatNode(s.Field.Type)
+}
+
 // Name returns field name
 func (s *StructField) Name() string {
 	if !s.Anonymous() {
 		return s.Field.Names[0].Name
 	}
-	ident, _ := getElem(s.Field.Type).(*ast.Ident)
-	if ident == nil {
-		return ""
+	switch x := genericBase(getElem(s.Field.Type)).(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return x.Sel.Name
 	}
-	return ident.Name
+	return ""
 }
 
 // Doc returns lead comment.
@@ -488,7 +738,6 @@ func (s *StructTag) resetValue() {
 // `json:"foo,omitempty". Here options is: ["omitempty"]
 // Options []string
 // }
-//
 type Tag = structtag.Tag
 
 // Tags returns a slice of tags. The order is the original tag order unless it
@@ -550,13 +799,25 @@ func joinType(n Node, file *File) string {
 		return fmt.Sprintf("// Formatting error: %s", err.Error())
 	}
 	var assign string
-	if n.IsAssign() {
+	if n.IsAlias() {
 		assign = "= "
 	}
-	s = "type " + n.Name() + " " + assign + s
-	doc := n.Doc()
-	if doc != "" {
-		s = "// " + doc + s
+	s = "type " + n.Name() + typeParamsString(n.TypeParams()) + " " + assign + s
+	return lineComments(n.Doc()) + s
+}
+
+// lineComments returns the text as line comments, one per line.
+func lineComments(text string) string {
+	if text == "" {
+		return ""
+	}
+	var buf strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if line == "" {
+			buf.WriteString("//\n")
+		} else {
+			buf.WriteString("// " + line + "\n")
+		}
 	}
-	return s
+	return buf.String()
 }
@@ -0,0 +1,220 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"sort"
+)
+
+// NullTagKey is the struct tag key controlling the nullable mapping of a field.
+// `null:"-"` keeps the pointer field as is.
+const NullTagKey = "null"
+
+// nullType is the database/sql type mapped from a pointer type.
+type nullType struct {
+	name  string // e.g. "NullString"
+	value string // the value field, e.g. "String"
+}
+
+var nullTypes = map[Kind]nullType{
+	String:  {"NullString", "String"},
+	Bool:    {"NullBool", "Bool"},
+	Int32:   {"NullInt32", "Int32"},
+	Int64:   {"NullInt64", "Int64"},
+	Float64: {"NullFloat64", "Float64"},
+}
+
+// GenerateNullable maps the pointer fields of the struct type to the
+// database/sql nullable types, e.g. `Name *string` to `Name sql.NullString`,
+// so that database/sql scans NULL columns into them.
+// Pointers to string, bool, int32, int64, float64 and time.Time are supported.
+//
+// The MarshalJSON and UnmarshalJSON methods are generated too, which keep
+// the JSON behavior of the pointer fields: an invalid value is encoded as null,
+// and a valid one as its value. An unexported shadow type holding the
+// pointer fields is generated for them, e.g. userNullJSON for User.
+//
+// A pointer field of any other type is kept as is, unless it has the
+// `null` tag, in which case an error is returned.
+// NOTE: The file is reparsed after rewriting.
+func (s *StructType) GenerateNullable() error {
+	name := s.Name()
+	if name == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	for _, method := range []string{"MarshalJSON", "UnmarshalJSON"} {
+		if _, found := s.MethodByName(method); found {
+			return fmt.Errorf("aster: method already exists: %s.%s", name, method)
+		}
+	}
+	nullables, err := s.nullableFields()
+	if err != nil {
+		return err
+	}
+	if len(nullables) == 0 {
+		return fmt.Errorf("aster: struct has no nullable pointer fields: %s", name)
+	}
+
+	file := s.file
+	var elems = make(map[int]string, len(nullables))
+	for i, field := range s.fields {
+		if _, ok := nullables[field]; ok {
+			elems[i] = file.TryFormatNode(field.Field.Type.(*ast.StarExpr).X)
+		}
+	}
+	for _, path := range []string{"database/sql", "encoding/json"} {
+		if err = file.AddImport("", path); err != nil {
+			return err
+		}
+	}
+	if err = file.refresh(); err != nil {
+		return err
+	}
+	t, found := file.LookupType(name)
+	if !found || t.Kind() != Struct {
+		return fmt.Errorf("aster: struct not found: %s", name)
+	}
+	s = t.(*StructType)
+	src := s.nullableJSON(elems)
+
+	// rewrites the field types from the end, the fields of
+	// a multi-name declaration share the same type expression
+	sqlPkg := file.importName("database/sql")
+	if sqlPkg == "" {
+		sqlPkg = "sql"
+	}
+	var starts []int
+	var types = make(map[int][2]int)
+	for i := range elems {
+		typ := s.fields[i].Field.Type
+		start := file.offset(typ.Pos())
+		if _, ok := types[start]; !ok {
+			starts = append(starts, start)
+		}
+		types[start] = [2]int{file.offset(typ.End()), i}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(starts)))
+	code := file.Src
+	for _, start := range starts {
+		end, i := types[start][0], types[start][1]
+		nt, _ := s.fields[i].nullType()
+		var buf bytes.Buffer
+		buf.Write(code[:start])
+		buf.WriteString(sqlPkg + "." + nt.name)
+		buf.Write(code[end:])
+		code = buf.Bytes()
+	}
+	if err = file.replaceSource(0, len(file.Src), string(code)); err != nil {
+		return err
+	}
+	return file.appendDecl(name, src)
+}
+
+// nullableFields returns the pointer fields to map to the nullable types.
+func (s *StructType) nullableFields() (map[*StructField]nullType, error) {
+	var fields = make(map[*StructField]nullType)
+	for _, field := range s.fields {
+		if field.Kind() != Ptr || field.Name() == "" {
+			continue
+		}
+		tag, err := field.Tags.Get(NullTagKey)
+		tagged := err == nil
+		if tagged && tag.Name == "-" {
+			continue
+		}
+		nt, ok := field.nullType()
+		if !ok {
+			if tagged {
+				return nil, fmt.Errorf("aster: field %s has no nullable type: %s", field.Name(), field.TypeName())
+			}
+			continue
+		}
+		fields[field] = nt
+	}
+	return fields, nil
+}
+
+// nullType returns the database/sql nullable type of the pointer field.
+func (s *StructField) nullType() (nullType, bool) {
+	star, ok := s.Field.Type.(*ast.StarExpr)
+	if !ok {
+		return nullType{}, false
+	}
+	if s.file.isQualifiedType(star.X, "time", "Time") {
+		return nullType{"NullTime", "Time"}, true
+	}
+	id, ok := star.X.(*ast.Ident)
+	if !ok {
+		return nullType{}, false
+	}
+	kind, ok := getBasicKind(id.Name)
+	if !ok {
+		return nullType{}, false
+	}
+	nt, ok := nullTypes[kind]
+	return nt, ok
+}
+
+// nullableJSON returns the source text of the JSON methods and their
+// shadow type, where elems are the element types of the mapped fields.
+func (s *StructType) nullableJSON(elems map[int]string) string {
+	name := s.Name()
+	recv := receiverName(s)
+	shadow := lowerFirst(name) + "NullJSON"
+	var fields, to, from bytes.Buffer
+	for i, field := range s.fields {
+		fname := field.Name()
+		var tag string
+		if field.Field.Tag != nil {
+			tag = " " + field.Field.Tag.Value
+		}
+		elem, ok := elems[i]
+		if !ok {
+			if field.Anonymous() {
+				fmt.Fprintf(&fields, "\t%s%s\n", field.TypeName(), tag)
+			} else {
+				fmt.Fprintf(&fields, "\t%s %s%s\n", fname, field.TypeName(), tag)
+			}
+			fmt.Fprintf(&to, "\ta.%s = %s.%s\n", fname, recv, fname)
+			fmt.Fprintf(&from, "\t%s.%s = a.%s\n", recv, fname, fname)
+			continue
+		}
+		nt, _ := field.nullType()
+		x, a := recv+"."+fname, "a."+fname
+		fmt.Fprintf(&fields, "\t%s *%s%s\n", fname, elem, tag)
+		fmt.Fprintf(&to, "\tif %s.Valid {\n\t\tv := %s.%s\n\t\t%s = &v\n\t}\n", x, x, nt.value, a)
+		fmt.Fprintf(&from, "\t%s.Valid = %s != nil\n\tif %s.Valid {\n\t\t%s.%s = *%s\n\t}\n", x, a, x, x, nt.value, a)
+	}
+
+	jsonPkg := s.file.importName("encoding/json")
+	if jsonPkg == "" {
+		jsonPkg = "json"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s is the JSON representation of %s,\n// with the nullable fields as pointers.\ntype %s struct {\n%s}\n",
+		shadow, name, shadow, fields.String())
+	fmt.Fprintf(&buf, "\nfunc (%s %s) to%s() %s {\n\tvar a %s\n%s\treturn a\n}\n",
+		recv, name, upperFirst(shadow), shadow, shadow, to.String())
+	fmt.Fprintf(&buf, "\nfunc (%s *%s) from%s(a %s) {\n%s}\n",
+		recv, name, upperFirst(shadow), shadow, from.String())
+	fmt.Fprintf(&buf, "\n// MarshalJSON implements json.Marshaler.\nfunc (%s %s) MarshalJSON() ([]byte, error) {\n\treturn %s.Marshal(%s.to%s())\n}\n",
+		recv, name, jsonPkg, recv, upperFirst(shadow))
+	fmt.Fprintf(&buf, "\n// UnmarshalJSON implements json.Unmarshaler.\nfunc (%s *%s) UnmarshalJSON(data []byte) error {\n\ta := %s.to%s()\n\tif err := %s.Unmarshal(data, &a); err != nil {\n\t\treturn err\n\t}\n\t%s.from%s(a)\n\treturn nil\n}\n",
+		recv, name, recv, upperFirst(shadow), jsonPkg, recv, upperFirst(shadow))
+	return buf.String()
+}
@@ -0,0 +1,442 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openapi generates the OpenAPI 3 component schemas of the struct
+// types of a package, e.g.
+//
+//	// User is a user.
+//	type User struct {
+//		// Name is the full name.
+//		Name  string   `json:"name" validate:"required,max=64"`
+//		Email string   `json:"email,omitempty" validate:"email"`
+//		Tags  []string `json:"tags" validate:"max=8,dive,min=1"`
+//	}
+//
+// to
+//
+//	"User": {
+//	  "type": "object",
+//	  "description": "User is a user.",
+//	  "properties": {
+//	    "email": {"type": "string", "format": "email"},
+//	    "name": {"type": "string", "description": "Name is the full name.", "maxLength": 64},
+//	    "tags": {"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 8}
+//	  },
+//	  "required": ["name"]
+//	}
+//
+// The properties are named and skipped by the json tags as encoding/json
+// does, and described by the doc or line comments of the fields.
+// The validation tags, in the format of github.com/go-playground/validator,
+// set the constraints: required, min, max, len, gt, gte, lt, lte, oneof,
+// email, url, uri, uuid and dive. The other rules are ignored.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// Schema is an OpenAPI 3 schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Options are the options of Schemas.
+type Options struct {
+	// Filter selects the struct types to generate, defaults to the exported
+	// ones. The struct types of the package they refer to are generated too.
+	Filter func(t aster.TypeNode) bool
+	// ValidateKey is the key of the validation tags, defaults to "validate".
+	ValidateKey string
+}
+
+// RefPrefix is the prefix of the references to the component schemas.
+const RefPrefix = "#/components/schemas/"
+
+// Schemas returns the component schemas of the struct types of the package
+// selected by the options, which may be nil, by type name.
+// Returns an error if a field type has no JSON schema, e.g. a channel or a
+// type of another package.
+func Schemas(p *aster.Package, opts *Options) (map[string]*Schema, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Filter == nil {
+		o.Filter = func(t aster.TypeNode) bool { return aster.IsExported(t.Name()) }
+	}
+	if o.ValidateKey == "" {
+		o.ValidateKey = "validate"
+	}
+	g := &generator{pkg: p, validateKey: o.ValidateKey, schemas: make(map[string]*Schema)}
+	for _, t := range p.Structs() {
+		if o.Filter(t) {
+			g.enqueue(t)
+		}
+	}
+	for i := 0; i < len(g.queue); i++ {
+		t := g.queue[i]
+		if len(t.TypeParams()) > 0 {
+			return nil, fmt.Errorf("openapi: generic type: %s", t.Name())
+		}
+		s, err := g.object(t, t.Node().(*ast.StructType))
+		if err != nil {
+			return nil, err
+		}
+		s.Description = strings.TrimSpace(t.Doc())
+		g.schemas[t.Name()] = s
+	}
+	return g.schemas, nil
+}
+
+// Components returns the JSON document of the components of the schemas,
+// i.e. {"components": {"schemas": {...}}}, see Schemas.
+func Components(p *aster.Package, opts *Options) ([]byte, error) {
+	schemas, err := Schemas(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{"components": map[string]interface{}{"schemas": schemas}}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type generator struct {
+	pkg         *aster.Package
+	validateKey string
+	schemas     map[string]*Schema
+	queue       []aster.TypeNode // the struct types to generate in order
+}
+
+func (g *generator) enqueue(t aster.TypeNode) {
+	for _, q := range g.queue {
+		if q.Name() == t.Name() {
+			return
+		}
+	}
+	g.queue = append(g.queue, t)
+}
+
+// object returns the object schema of the struct type of t.
+func (g *generator) object(t aster.TypeNode, st *ast.StructType) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			v, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(v)
+		}
+		jsonTag, hasJSON := tag.Lookup("json")
+		if jsonTag == "-" {
+			continue
+		}
+		jsonOpts := strings.Split(jsonTag, ",")
+		name := jsonOpts[0]
+		if len(field.Names) == 0 {
+			if err := g.embed(s, t, field, name); err != nil {
+				return nil, err
+			}
+			if !hasJSON || name == "" {
+				continue
+			}
+		}
+		for _, id := range field.Names {
+			if !aster.IsExported(id.Name) {
+				continue
+			}
+			propName := name
+			if propName == "" {
+				propName = id.Name
+			}
+			prop, err := g.schema(t, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: %s.%s: %s", t.Name(), id.Name, err)
+			}
+			if containsString(jsonOpts[1:], "string") && prop.Ref == "" {
+				prop.Type, prop.Format = "string", ""
+			}
+			if prop.Ref == "" {
+				prop.Description = fieldDoc(field)
+			}
+			required, err := constrain(prop, tag.Get(g.validateKey))
+			if err != nil {
+				return nil, fmt.Errorf("openapi: %s.%s: %s", t.Name(), id.Name, err)
+			}
+			if required {
+				s.Required = append(s.Required, propName)
+			}
+			s.Properties[propName] = prop
+		}
+	}
+	return s, nil
+}
+
+// embed merges the properties of the embedded struct into s, as encoding/json
+// promotes them, unless the field is named by the json tag.
+func (g *generator) embed(s *Schema, t aster.TypeNode, field *ast.Field, name string) error {
+	if name != "" {
+		return nil
+	}
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	id, ok := typ.(*ast.Ident)
+	if !ok {
+		return fmt.Errorf("openapi: %s: unsupported embedded type: %s", t.Name(), types.ExprString(field.Type))
+	}
+	et, ok := g.pkg.LookupType(id.Name)
+	if !ok || et.Kind() != aster.Struct {
+		return fmt.Errorf("openapi: %s: unsupported embedded type: %s", t.Name(), id.Name)
+	}
+	es, err := g.object(et, et.Node().(*ast.StructType))
+	if err != nil {
+		return err
+	}
+	for k, v := range es.Properties {
+		if _, ok := s.Properties[k]; !ok {
+			s.Properties[k] = v
+		}
+	}
+	s.Required = append(s.Required, es.Required...)
+	return nil
+}
+
+// schema returns the schema of the type expression of a field of t.
+func (g *generator) schema(t aster.TypeNode, typ ast.Expr) (*Schema, error) {
+	switch x := typ.(type) {
+	case *ast.ParenExpr:
+		return g.schema(t, x.X)
+	case *ast.StarExpr:
+		s, err := g.schema(t, x.X)
+		if err == nil && s.Ref == "" {
+			s.Nullable = true
+		}
+		return s, err
+	case *ast.ArrayType:
+		if id, ok := x.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.schema(t, x.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case *ast.MapType:
+		key, err := g.schema(t, x.Key)
+		if err != nil {
+			return nil, err
+		}
+		if key.Type != "string" && key.Type != "integer" {
+			return nil, fmt.Errorf("unsupported map key: %s", types.ExprString(x.Key))
+		}
+		value, err := g.schema(t, x.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: value}, nil
+	case *ast.StructType:
+		return g.object(t, x)
+	case *ast.InterfaceType:
+		return &Schema{}, nil
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && t.File().LookupImportPath(pkg.Name) == "time" {
+			switch x.Sel.Name {
+			case "Time":
+				return &Schema{Type: "string", Format: "date-time"}, nil
+			case "Duration":
+				return &Schema{Type: "integer", Format: "int64"}, nil
+			}
+		}
+	case *ast.Ident:
+		if s, ok := basicSchema(x.Name); ok {
+			return s, nil
+		}
+		if n, ok := g.pkg.LookupType(x.Name); ok {
+			if n.Kind() == aster.Struct {
+				g.enqueue(n)
+				return &Schema{Ref: RefPrefix + n.Name()}, nil
+			}
+			if u, ok := n.Node().(ast.Expr); ok && u != typ {
+				return g.schema(n, u)
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported type: %s", types.ExprString(typ))
+}
+
+// basicSchema returns the schema of the Go basic type.
+func basicSchema(name string) (*Schema, bool) {
+	switch name {
+	case "bool":
+		return &Schema{Type: "boolean"}, true
+	case "string":
+		return &Schema{Type: "string"}, true
+	case "int", "int64", "uint", "uint64", "uintptr":
+		return &Schema{Type: "integer", Format: "int64"}, true
+	case "int8", "int16", "int32", "rune", "uint8", "byte", "uint16", "uint32":
+		return &Schema{Type: "integer", Format: "int32"}, true
+	case "float32":
+		return &Schema{Type: "number", Format: "float"}, true
+	case "float64":
+		return &Schema{Type: "number", Format: "double"}, true
+	case "any":
+		return &Schema{}, true
+	}
+	return nil, false
+}
+
+// constrain sets the constraints of the validation tag to the schema,
+// and returns whether the field is required.
+func constrain(s *Schema, tag string) (required bool, err error) {
+	if tag == "" || tag == "-" {
+		return false, nil
+	}
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+		case "dive":
+			if s.Items == nil && s.AdditionalProperties == nil {
+				return false, fmt.Errorf("dive on a scalar")
+			}
+			elem := s.Items
+			if elem == nil {
+				elem = s.AdditionalProperties
+			}
+			_, err = constrain(elem, strings.Join(rules[i+1:], ","))
+			return required, err
+		case "min", "gte", "gt", "max", "lte", "lt", "len":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid %s: %q", name, param)
+			}
+			s.bound(name, n)
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				s.Enum = append(s.Enum, s.enumValue(v))
+			}
+		case "email":
+			s.Format = "email"
+		case "url", "uri":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		}
+	}
+	return required, nil
+}
+
+// bound sets the bound of the rule, on the value, the length or the items
+// by the type of the schema.
+func (s *Schema) bound(rule string, n float64) {
+	i := int(n)
+	switch s.Type {
+	case "string", "array":
+		min, max := &s.MinLength, &s.MaxLength
+		if s.Type == "array" {
+			min, max = &s.MinItems, &s.MaxItems
+		}
+		switch rule {
+		case "min", "gte":
+			*min = &i
+		case "gt":
+			i++
+			*min = &i
+		case "max", "lte":
+			*max = &i
+		case "lt":
+			i--
+			*max = &i
+		case "len":
+			*min, *max = &i, &i
+		}
+	default:
+		switch rule {
+		case "min", "gte", "gt":
+			s.Minimum, s.ExclusiveMinimum = &n, rule == "gt"
+		case "max", "lte", "lt":
+			s.Maximum, s.ExclusiveMaximum = &n, rule == "lt"
+		case "len":
+			s.Minimum, s.Maximum = &n, &n
+		}
+	}
+}
+
+// enumValue returns the value of the oneof rule typed by the schema.
+func (s *Schema) enumValue(v string) interface{} {
+	switch s.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// fieldDoc returns the doc comment of the field, or else its line comment.
+func fieldDoc(field *ast.Field) string {
+	if field.Doc != nil {
+		return strings.TrimSpace(field.Doc.Text())
+	}
+	if field.Comment != nil {
+		return strings.TrimSpace(field.Comment.Text())
+	}
+	return ""
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OptionTagKey is the struct tag key skipping a field by the functional
+// options, i.e. `option:"-"`.
+const OptionTagKey = "option"
+
+// OptionsConfig configures GenerateOptions.
+type OptionsConfig struct {
+	// Type is the name of the option type, defaults to "Option".
+	Type string
+	// Prefix is the prefix of the option functions, defaults to "With".
+	Prefix string
+	// Constructor is the name of the constructor,
+	// defaults to "New" followed by the struct name.
+	Constructor string
+}
+
+// GenerateOptions generates the functional options of the struct type Foo:
+//
+//	type Option func(*Foo)
+//	func WithBar(bar T) Option // for each field Bar or bar
+//	func NewFoo(opts ...Option) *Foo
+//
+// The constructor sets the fields to their default values declared by the
+// `default:"..."` tag or the `//aster:default <value>` directive, see
+// StructField.Default, and then applies the options in order.
+// The embedded fields and the fields tagged `option:"-"` have no options.
+// Returns an error if a default value is invalid, or a name is taken.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateOptions(cfg *OptionsConfig) error {
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no options")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", s.Name())
+	}
+	name := s.Name()
+	var c OptionsConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Type == "" {
+		c.Type = "Option"
+	}
+	if c.Prefix == "" {
+		c.Prefix = "With"
+	}
+	if c.Constructor == "" {
+		c.Constructor = "New" + name
+	}
+	recv := receiverName(s)
+
+	names := []string{c.Type, c.Constructor}
+	var defaults, funcs bytes.Buffer
+	for _, field := range s.fields {
+		fname := field.Name()
+		if field.Anonymous() || fname == "" || fname == "_" {
+			continue
+		}
+		d, found, err := field.Default()
+		if err != nil {
+			return err
+		}
+		if found {
+			fmt.Fprintf(&defaults, "\t\t%s: %s,\n", fname, d.Expr)
+		}
+		if tag, err := field.Tags.Get(OptionTagKey); err == nil && tag.Value() == "-" {
+			continue
+		}
+		fn := c.Prefix + upperInitial(fname)
+		for _, n := range names {
+			if n == fn {
+				return fmt.Errorf("aster: option name taken twice: %s", fn)
+			}
+		}
+		names = append(names, fn)
+		param := lowerInitial(fname)
+		if token.IsKeyword(param) || param == recv {
+			param = "v"
+		}
+		fmt.Fprintf(&funcs, "\n// %s returns the option setting %s.\nfunc %s(%s %s) %s {\n\treturn func(%s *%s) {\n\t\t%s.%s = %s\n\t}\n}\n",
+			fn, fname, fn, param, s.file.TryFormatNode(field.Field.Type), c.Type, recv, name, recv, fname, param)
+	}
+	if err := s.file.CheckCollision(names...); err != nil {
+		return err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// %s is a functional option of %s, see %s.\ntype %s func(*%s)\n\n", c.Type, name, c.Constructor, c.Type, name)
+	fmt.Fprintf(&src, "// %s returns %s with the default values, applying the options.\nfunc %s(opts ...%s) *%s {\n",
+		c.Constructor, articled(name), c.Constructor, c.Type, name)
+	if defaults.Len() > 0 {
+		fmt.Fprintf(&src, "\t%s := &%s{\n%s\t}\n", recv, name, defaults.String())
+	} else {
+		fmt.Fprintf(&src, "\t%s := &%s{}\n", recv, name)
+	}
+	fmt.Fprintf(&src, "\tfor _, opt := range opts {\n\t\topt(%s)\n\t}\n\treturn %s\n}\n", recv, recv)
+	src.Write(funcs.Bytes())
+	return s.file.appendDecl(name, strings.TrimSuffix(src.String(), "\n"))
+}
+
+// upperInitial returns the name with the initial upper-cased,
+// e.g. "Addr" of "addr".
+func upperInitial(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// articled returns the name preceded by the indefinite article "a" or "an".
+func articled(name string) string {
+	if strings.ContainsRune("AEIOUaeiou", rune(name[0])) {
+		return "an " + name
+	}
+	return "a " + name
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// File returns the file to which the node belongs,
+// or nil for a cloned node not added to a file.
+func (s *super) File() *File {
+	return s.file
+}
+
+// Parent returns the innermost node of the file enclosing the node,
+// or nil for a top-level declaration.
+func (s *super) Parent() Node {
+	if s.file == nil {
+		return nil
+	}
+	self, ok := s.self()
+	if !ok {
+		return nil
+	}
+	return s.file.parentOf(self)
+}
+
+// Parent returns the innermost node of the file enclosing the function,
+// e.g. the interface type declaring a method, or nil for a top-level one.
+func (fd *FuncDecl) Parent() Node {
+	if fd.file == nil {
+		return nil
+	}
+	return fd.file.parentOf(fd)
+}
+
+// Parent returns the struct type declaring the field,
+// e.g. the embedded struct for a promoted field, see FlattenFields.
+func (s *StructField) Parent() *StructType {
+	return s.parent
+}
+
+// File returns the file to which the field belongs.
+func (s *StructField) File() *File {
+	return s.file
+}
+
+// parentOf returns the innermost node of the file enclosing n, other than n.
+func (f *File) parentOf(n Node) Node {
+	pos, end := n.Node().Pos(), n.Node().End()
+	var parent Node
+	for _, x := range f.Nodes {
+		node := x.Node()
+		if x == n || node == nil || pos < node.Pos() || end > node.End() {
+			continue
+		}
+		if parent == nil || node.End()-node.Pos() < parent.Node().End()-parent.Node().Pos() {
+			parent = x
+		}
+	}
+	return parent
+}
+
+// PathEnclosing returns the path of the syntax nodes of the file enclosing
+// the interval [start, end), from the innermost node up to the *ast.File,
+// and whether the innermost node spans the interval exactly,
+// see golang.org/x/tools/go/ast/astutil.PathEnclosingInterval.
+func (f *File) PathEnclosing(start, end token.Pos) (path []ast.Node, exact bool) {
+	return astutil.PathEnclosingInterval(f.File, start, end)
+}
@@ -23,7 +23,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 // ParseDir calls ParseFile for all files with names ending in ".go" in the
@@ -40,32 +43,240 @@ import (
 // first error encountered are returned.
 //
 func ParseDir(dir string, filter func(os.FileInfo) bool, mode ...parser.Mode) (module *Module, first error) {
-	module = &Module{
-		FileSet: token.NewFileSet(),
-		Dir:     dir,
-		filter:  filter,
-		mode:    parser.ParseComments,
-	}
+	cfg := &ParseConfig{Filter: filter}
 	for _, m := range mode {
-		module.mode |= m
+		cfg.Mode |= m
+	}
+	return ParseDirWith(dir, cfg)
+}
+
+// ParseConfig configures ParseDirWith.
+type ParseConfig struct {
+	// Filter filters the files, see ParseDir.
+	Filter func(os.FileInfo) bool
+	// Mode is the parser mode, along with parser.ParseComments.
+	Mode parser.Mode
+	// AllErrors continues on errors, see ParseDirAll.
+	AllErrors bool
+	// Overlay maps the file paths to the contents read in place of the files
+	// on disk, e.g. the unsaved buffers of an editor, which may also add
+	// files to the directory. The paths are absolute or relative to the
+	// working directory, as dir is.
+	Overlay map[string][]byte
+	// Tests selects the test files to load, defaults to TestsAll.
+	Tests TestMode
+	// SkipGenerated skips the generated files, see File.IsGenerated,
+	// so that the analyses and refactorings never touch them.
+	SkipGenerated bool
+	// Visibility selects the named nodes to collect, defaults to VisibilityAll.
+	Visibility Visibility
+}
+
+// TestMode selects the _test.go files to load.
+type TestMode int
+
+const (
+	// TestsAll loads all the test files, those of the external test package,
+	// e.g. foo_test, as a separate package of the module.
+	TestsAll TestMode = iota
+	// TestsNone loads no test files.
+	TestsNone
+	// TestsInternal loads the test files of the packages only,
+	// without the external test packages.
+	TestsInternal
+)
+
+// Visibility selects the named nodes collected into File.Nodes.
+// The syntax trees, and so the formatted and stored codes, are complete.
+type Visibility int
+
+const (
+	// VisibilityAll collects all the nodes, e.g. for the internal refactorings.
+	VisibilityAll Visibility = iota
+	// VisibilityExported collects the exported types and functions only,
+	// and their exported methods, e.g. for the API generators.
+	// The anonymous nodes, the struct fields and the methods of the
+	// interfaces are kept.
+	VisibilityExported
+)
+
+// ParseDirWith parses the directory as ParseDir does, configured by cfg,
+// which is kept by the module for Reparse.
+func ParseDirWith(dir string, cfg *ParseConfig) (module *Module, first error) {
+	var c ParseConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	module = &Module{
+		FileSet:       token.NewFileSet(),
+		Dir:           dir,
+		filter:        c.Filter,
+		mode:          parser.ParseComments | c.Mode,
+		allErrors:     c.AllErrors,
+		tests:         c.Tests,
+		skipGenerated: c.SkipGenerated,
+		visibility:    c.Visibility,
 	}
+	module.SetOverlay(c.Overlay)
 	first = module.Reparse()
 	return
 }
 
+// NewModuleFromFiles returns the module of the syntax trees parsed into
+// fset, e.g. the files of a go/analysis pass, sharing them without reparsing.
+// The files are grouped into the packages by name, in the directory of the
+// first file, and their sources are read by the file names.
+// NOTE: Reparse reparses the whole directory.
+func NewModuleFromFiles(fset *token.FileSet, files ...*ast.File) *Module {
+	module := &Module{
+		FileSet:  fset,
+		Packages: make(map[string]*Package),
+		mode:     parser.ParseComments,
+	}
+	pkgs := make(map[string]*ast.Package)
+	for _, file := range files {
+		filename := fset.Position(file.Package).Filename
+		if module.Dir == "" {
+			module.Dir = filepath.Dir(filename)
+		}
+		name := file.Name.Name
+		pkg, ok := pkgs[name]
+		if !ok {
+			pkg = &ast.Package{Name: name, Files: make(map[string]*ast.File)}
+			pkgs[name] = pkg
+		}
+		pkg.Files[filename] = file
+	}
+	if module.Dir != "" {
+		module.ModFile, _ = module.loadModFile()
+	}
+	for k, v := range pkgs {
+		module.Packages[k] = convertPackage(module, module.Dir, v)
+	}
+	return module
+}
+
+// SetOverlay replaces the overlay of the module, see ParseConfig.Overlay,
+// which takes effect on Reparse.
+func (m *Module) SetOverlay(overlay map[string][]byte) {
+	m.overlay = nil
+	if len(overlay) == 0 {
+		return
+	}
+	m.overlay = make(map[string][]byte, len(overlay))
+	for filename, src := range overlay {
+		m.overlay[absPath(filename)] = src
+	}
+}
+
+// readFile reads the file from the overlay of the module, or from disk.
+func (m *Module) readFile(filename string) ([]byte, error) {
+	if m != nil && m.overlay != nil {
+		if src, ok := m.overlay[absPath(filename)]; ok {
+			return src, nil
+		}
+	}
+	return ioutil.ReadFile(filename)
+}
+
 // Reparse reparses AST.
+// In the continue-on-error mode, the files failed are left out, and their
+// errors returned as Errors, see ParseDirAll.
 func (m *Module) Reparse() (first error) {
-	pkgs, first := parser.ParseDir(m.FileSet, m.Dir, m.filter, m.mode)
-	if first != nil {
-		return
+	infos, err := ioutil.ReadDir(m.Dir)
+	if err != nil {
+		return err
+	}
+	infos = m.overlayInfos(infos)
+	var errs Errors
+	if m.ModFile, err = m.loadModFile(); err != nil {
+		if !m.allErrors {
+			return err
+		}
+		errs.add(m.Dir, err)
+	}
+	pkgs := make(map[string]*ast.Package)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") || m.filter != nil && !m.filter(info) {
+			continue
+		}
+		isTest := strings.HasSuffix(info.Name(), "_test.go")
+		if isTest && m.tests == TestsNone {
+			continue
+		}
+		filename := filepath.Join(m.Dir, info.Name())
+		src, err := m.readFile(filename)
+		var file *ast.File
+		if err == nil {
+			file, err = parser.ParseFile(m.FileSet, filename, src, m.mode)
+		}
+		if err != nil {
+			if !m.allErrors {
+				return wrapError(filename, src, err)
+			}
+			errs.addSource(filename, src, err)
+			continue
+		}
+		name := file.Name.Name
+		if isTest && m.tests == TestsInternal && strings.HasSuffix(name, "_test") {
+			continue
+		}
+		if _, ok := generatedBy(file); ok && m.skipGenerated {
+			continue
+		}
+		pkg, ok := pkgs[name]
+		if !ok {
+			pkg = &ast.Package{Name: name, Files: make(map[string]*ast.File)}
+			pkgs[name] = pkg
+		}
+		pkg.Files[filename] = file
 	}
 	m.Packages = make(map[string]*Package, len(pkgs))
+	m.removed = nil
 	for k, v := range pkgs {
-		m.Packages[k] = convertPackage(m, k, v)
+		m.Packages[k] = convertPackage(m, m.Dir, v)
 	}
-	return
+	return errs.Err()
 }
 
+// overlayInfos adds the infos of the overlay files in the module directory
+// missing from the infos, sorted by name.
+func (m *Module) overlayInfos(infos []os.FileInfo) []os.FileInfo {
+	if len(m.overlay) == 0 {
+		return infos
+	}
+	dir := absPath(m.Dir)
+	seen := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		seen[info.Name()] = true
+	}
+	added := false
+	for filename, src := range m.overlay {
+		name := filepath.Base(filename)
+		if filepath.Dir(filename) == dir && !seen[name] {
+			infos = append(infos, &overlayInfo{name: name, size: int64(len(src))})
+			added = true
+		}
+	}
+	if added {
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	}
+	return infos
+}
+
+// overlayInfo is the os.FileInfo of an overlay file missing on disk.
+type overlayInfo struct {
+	name string
+	size int64
+}
+
+func (o *overlayInfo) Name() string       { return o.name }
+func (o *overlayInfo) Size() int64        { return o.size }
+func (o *overlayInfo) Mode() os.FileMode  { return 0666 }
+func (o *overlayInfo) ModTime() time.Time { return time.Time{} }
+func (o *overlayInfo) IsDir() bool        { return false }
+func (o *overlayInfo) Sys() interface{}   { return nil }
+
 // ParseFile parses the source code of a single Go source file and returns
 // the corresponding ast.File node. The source code may be provided via
 // the filename of the source file, or via the src parameter.
@@ -82,8 +293,8 @@ func (m *Module) Reparse() (first error) {
 // If the source couldn't be read, the returned AST is nil and the error
 // indicates the specific failure. If the source was read but syntax
 // errors were found, the result is a partial AST (with ast.Bad* nodes
-// representing the fragments of erroneous source code). Multiple errors
-// are returned via a scanner.ErrorList which is sorted by file position.
+// representing the fragments of erroneous source code). The errors are
+// returned via Errors, sorted by position, carrying the source lines.
 //
 func ParseFile(filename string, src interface{}, mode ...parser.Mode) (f *File, err error) {
 	b, err := readSource(filename, src)
@@ -104,6 +315,8 @@ func ParseFile(filename string, src interface{}, mode ...parser.Mode) (f *File,
 }
 
 // Reparse reparses AST.
+// NOTE: If the file belongs to a package, the nodes of the whole package
+// are recollected.
 func (f *File) Reparse() (err error) {
 	b, err := readSource(f.Filename, f.Src)
 	if err != nil {
@@ -112,18 +325,24 @@ func (f *File) Reparse() (err error) {
 	f.Src = b
 	file, err := parser.ParseFile(f.FileSet, f.Filename, b, f.mode)
 	if err != nil {
-		return
+		return wrapError(f.Filename, b, err)
 	}
 	f.File = file
 	if file.Name != nil {
 		f.PkgName = file.Name.Name
 	}
 	f.setImports()
-	f.collectNodes(true)
+	if f.pkg != nil {
+		// rebinds the methods across the package files
+		f.pkg.collectNodes()
+	} else {
+		f.collectNodes(true)
+	}
 	return
 }
 
 func (f *File) setImports() {
+	f.Imports = f.Imports[:0]
 	for _, v := range f.File.Imports {
 		imp := &Import{
 			ImportSpec: v,
@@ -158,7 +377,7 @@ func convertPackage(mod *Module, dir string, pkg *ast.Package) *Package {
 }
 
 func convertFile(pkg *Package, filename string, file *ast.File) *File {
-	b, _ := readSource(filename, nil)
+	b, _ := pkg.module.readFile(filename)
 	f := &File{
 		FileSet:  pkg.FileSet,
 		Filename: filename,
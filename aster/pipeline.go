@@ -0,0 +1,162 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The stages of the pipeline.
+const (
+	StageLoad     = "load"
+	StageAnalyze  = "analyze"
+	StageGenerate = "generate"
+	StageStore    = "store"
+)
+
+// PipelineStage processes a module in a stage of the pipeline.
+type PipelineStage func(m *Module) error
+
+// Pipeline loads, analyzes, generates and stores the modules of many
+// directories in a single streaming pass: the stages run concurrently,
+// each on its own workers, and pass the modules on through bounded queues,
+// so a slow stage holds the earlier ones back instead of piling up modules.
+// The stages are called concurrently for different modules.
+type Pipeline struct {
+	// Filter filters the files to load, see ParseDir.
+	Filter func(os.FileInfo) bool
+	// Analyze and Generate are run in turn on each loaded module,
+	// and skipped if nil.
+	Analyze  PipelineStage
+	Generate PipelineStage
+	// Store writes the module, defaults to Module.Store.
+	Store PipelineStage
+	// LoadWorkers, AnalyzeWorkers, GenerateWorkers and StoreWorkers weigh
+	// the stages by their numbers of concurrent workers, defaulting to 1.
+	LoadWorkers     int
+	AnalyzeWorkers  int
+	GenerateWorkers int
+	StoreWorkers    int
+	// Buffer is the capacity of the queue before each stage after loading,
+	// defaults to 1.
+	Buffer int
+}
+
+// PipelineResult is the result of a directory of the pipeline.
+type PipelineResult struct {
+	Dir string
+	// Stage is the stage failed, and Err its error,
+	// or empty if all the stages succeeded.
+	Stage string
+	Err   error
+	// Durations are the running times of the stages run.
+	Durations map[string]time.Duration
+}
+
+// pipelineItem is a module passing through the pipeline.
+type pipelineItem struct {
+	index  int
+	mod    *Module
+	result *PipelineResult
+}
+
+// Run runs the pipeline on the directories, and returns the results in the
+// order of the directories, along with the error of the first failed one.
+// A failed module skips the remaining stages, the others go on.
+func (p *Pipeline) Run(dirs ...string) ([]*PipelineResult, error) {
+	buffer := p.Buffer
+	if buffer <= 0 {
+		buffer = 1
+	}
+	store := p.Store
+	if store == nil {
+		store = func(m *Module) error { return m.Store() }
+	}
+
+	todo := make(chan *pipelineItem)
+	go func() {
+		for i, dir := range dirs {
+			todo <- &pipelineItem{index: i, result: &PipelineResult{Dir: dir, Durations: make(map[string]time.Duration)}}
+		}
+		close(todo)
+	}()
+	loaded := runStage(todo, StageLoad, p.LoadWorkers, buffer, func(item *pipelineItem) error {
+		mod, err := ParseDir(item.result.Dir, p.Filter)
+		item.mod = mod
+		return err
+	})
+	analyzed := runStage(loaded, StageAnalyze, p.AnalyzeWorkers, buffer, stageFunc(p.Analyze))
+	generated := runStage(analyzed, StageGenerate, p.GenerateWorkers, buffer, stageFunc(p.Generate))
+	stored := runStage(generated, StageStore, p.StoreWorkers, buffer, stageFunc(store))
+
+	results := make([]*PipelineResult, len(dirs))
+	for item := range stored {
+		results[item.index] = item.result
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			return results, fmt.Errorf("aster: %s %s: %s", r.Stage, r.Dir, r.Err.Error())
+		}
+	}
+	return results, nil
+}
+
+func stageFunc(fn PipelineStage) func(*pipelineItem) error {
+	if fn == nil {
+		return nil
+	}
+	return func(item *pipelineItem) error {
+		return fn(item.mod)
+	}
+}
+
+// runStage runs fn on the items from in by the workers, and sends them to
+// the returned queue of the buffer size, which is closed after in.
+// The failed items are passed on without running fn.
+func runStage(in <-chan *pipelineItem, name string, workers, buffer int, fn func(*pipelineItem) error) <-chan *pipelineItem {
+	if workers <= 0 {
+		workers = 1
+	}
+	out := make(chan *pipelineItem, buffer)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for item := range in {
+				if item.result.Err == nil && fn != nil {
+					start := time.Now()
+					if err := fn(item); err != nil {
+						item.result.Stage, item.result.Err = name, err
+						item.mod = nil
+					}
+					item.result.Durations[name] = time.Since(start)
+				}
+				if name == StageStore {
+					item.mod = nil // release the module
+				}
+				out <- item
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
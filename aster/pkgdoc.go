@@ -0,0 +1,361 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"path/filepath"
+	"strings"
+)
+
+// PackageDoc is the documentation of a package, built by go/doc from the
+// package files and linked back to the nodes.
+type PackageDoc struct {
+	Name       string
+	ImportPath string
+	Doc        string
+	Synopsis   string // the first sentence of Doc
+	Consts     []*ValueDoc
+	Vars       []*ValueDoc
+	Funcs      []*FuncDoc // excluding the constructors of the types
+	Types      []*TypeDoc
+	Examples   []*ExampleDoc // of the package
+}
+
+// ValueDoc is the documentation of a const or var declaration,
+// which may be a group.
+type ValueDoc struct {
+	Names []string
+	Doc   string
+	Decl  string // the source of the declaration
+}
+
+// FuncDoc is the documentation of a function or method.
+type FuncDoc struct {
+	Name     string
+	Recv     string // e.g. "*T", or "" for a function
+	Doc      string
+	Decl     string // the signature, e.g. "func (t *T) M() error"
+	Node     FuncNode
+	Examples []*ExampleDoc
+}
+
+// TypeDoc is the documentation of a type, along with the consts, vars and
+// functions associated with it, e.g. the constructors.
+type TypeDoc struct {
+	Name     string
+	Doc      string
+	Decl     string // the source of the declaration
+	Node     TypeNode
+	Consts   []*ValueDoc
+	Vars     []*ValueDoc
+	Funcs    []*FuncDoc
+	Methods  []*FuncDoc
+	Examples []*ExampleDoc
+}
+
+// ExampleDoc is an example function of the test files.
+type ExampleDoc struct {
+	Name   string // e.g. "T_M" for ExampleT_M
+	Suffix string // e.g. "second" for ExampleT_M_second
+	Doc    string
+	Code   string // the body of the example function
+	Output string
+}
+
+// Doc returns the documentation of the exported declarations of the package,
+// built by go/doc, with the examples of the test files, including the files
+// of the external test package of the same directory in the module.
+// The syntax tree is not modified.
+func (p *Package) Doc() (*PackageDoc, error) {
+	files := make([]*ast.File, 0, len(p.Files))
+	fileOf := make(map[*ast.File]*File)
+	add := func(pkg *Package) {
+		for _, f := range pkg.sortedFiles() {
+			files = append(files, f.File)
+			fileOf[f.File] = f
+		}
+	}
+	add(p)
+	if p.module != nil && !p.IsTest() {
+		if tp, ok := p.module.Packages[p.Name+"_test"]; ok && filepath.Clean(tp.Dir) == filepath.Clean(p.Dir) {
+			add(tp)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("aster: no files in package %s", p.Name)
+	}
+	dp, err := doc.NewFromFiles(p.FileSet, files, p.Path(), doc.PreserveAST)
+	if err != nil {
+		return nil, fmt.Errorf("aster: %w", err)
+	}
+	d := &PackageDoc{
+		Name:       dp.Name,
+		ImportPath: dp.ImportPath,
+		Doc:        dp.Doc,
+		Synopsis:   doc.Synopsis(dp.Doc),
+		Consts:     p.valueDocs(dp.Consts),
+		Vars:       p.valueDocs(dp.Vars),
+		Funcs:      p.funcDocs(dp.Funcs),
+		Examples:   p.exampleDocs(dp.Examples),
+	}
+	for _, t := range dp.Types {
+		td := &TypeDoc{
+			Name:     t.Name,
+			Doc:      t.Doc,
+			Decl:     p.declSource(t.Decl),
+			Consts:   p.valueDocs(t.Consts),
+			Vars:     p.valueDocs(t.Vars),
+			Funcs:    p.funcDocs(t.Funcs),
+			Methods:  p.funcDocs(t.Methods),
+			Examples: p.exampleDocs(t.Examples),
+		}
+		td.Node, _ = p.LookupType(t.Name)
+		d.Types = append(d.Types, td)
+	}
+	return d, nil
+}
+
+func (p *Package) valueDocs(values []*doc.Value) []*ValueDoc {
+	var docs []*ValueDoc
+	for _, v := range values {
+		docs = append(docs, &ValueDoc{Names: v.Names, Doc: v.Doc, Decl: p.declSource(v.Decl)})
+	}
+	return docs
+}
+
+func (p *Package) funcDocs(funcs []*doc.Func) []*FuncDoc {
+	var docs []*FuncDoc
+	for _, fn := range funcs {
+		if fn.Level > 0 {
+			continue // promoted from an embedded type
+		}
+		fd := &FuncDoc{
+			Name:     fn.Name,
+			Recv:     fn.Recv,
+			Doc:      fn.Doc,
+			Decl:     p.declSource(fn.Decl),
+			Examples: p.exampleDocs(fn.Examples),
+		}
+		for _, f := range p.Files {
+			if n, ok := f.Nodes[fn.Decl.Pos()].(FuncNode); ok {
+				fd.Node = n
+				break
+			}
+		}
+		docs = append(docs, fd)
+	}
+	return docs
+}
+
+func (p *Package) exampleDocs(examples []*doc.Example) []*ExampleDoc {
+	var docs []*ExampleDoc
+	for _, e := range examples {
+		ed := &ExampleDoc{Name: e.Name, Suffix: e.Suffix, Doc: e.Doc, Output: e.Output}
+		if b, ok := e.Code.(*ast.BlockStmt); ok {
+			ed.Code = p.blockSource(b)
+		} else {
+			ed.Code, _ = p.FormatNode(e.Code)
+		}
+		docs = append(docs, ed)
+	}
+	return docs
+}
+
+// blockSource returns the formatted statements of the block, unindented.
+func (p *Package) blockSource(b *ast.BlockStmt) string {
+	code, _ := p.FormatNode(b)
+	code = strings.TrimSpace(code)
+	code = strings.TrimSuffix(strings.TrimPrefix(code, "{"), "}")
+	lines := strings.Split(strings.Trim(code, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// declSource returns the source of the declaration without its doc comment,
+// and without the body of a function.
+func (p *Package) declSource(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		c := *d
+		c.Doc, c.Body = nil, nil
+		decl = &c
+	case *ast.GenDecl:
+		c := *d
+		c.Doc = nil
+		decl = &c
+	case nil:
+		return ""
+	}
+	code, _ := p.FormatNode(decl)
+	return code
+}
+
+// Markdown renders the documentation as Markdown, in the order of go doc:
+// the package doc, consts, vars, funcs and types.
+func (d *PackageDoc) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", d.Name)
+	if d.ImportPath != "" && d.ImportPath != d.Name {
+		fmt.Fprintf(&b, "```go\nimport %q\n```\n\n", d.ImportPath)
+	}
+	writeMarkdownDoc(&b, d.Doc)
+	writeMarkdownExamples(&b, d.Examples)
+	writeMarkdownValues(&b, "## Constants", d.Consts)
+	writeMarkdownValues(&b, "## Variables", d.Vars)
+	if len(d.Funcs) > 0 {
+		b.WriteString("## Functions\n\n")
+	}
+	writeMarkdownFuncs(&b, d.Funcs)
+	if len(d.Types) > 0 {
+		b.WriteString("## Types\n\n")
+	}
+	for _, t := range d.Types {
+		fmt.Fprintf(&b, "### type %s\n\n", t.Name)
+		writeMarkdownCode(&b, "go", t.Decl)
+		writeMarkdownDoc(&b, t.Doc)
+		writeMarkdownExamples(&b, t.Examples)
+		writeMarkdownValues(&b, "", t.Consts)
+		writeMarkdownValues(&b, "", t.Vars)
+		writeMarkdownFuncs(&b, t.Funcs)
+		writeMarkdownFuncs(&b, t.Methods)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+func writeMarkdownValues(b *strings.Builder, heading string, values []*ValueDoc) {
+	if len(values) == 0 {
+		return
+	}
+	if heading != "" {
+		b.WriteString(heading + "\n\n")
+	}
+	for _, v := range values {
+		writeMarkdownCode(b, "go", v.Decl)
+		writeMarkdownDoc(b, v.Doc)
+	}
+}
+
+func writeMarkdownFuncs(b *strings.Builder, funcs []*FuncDoc) {
+	for _, fn := range funcs {
+		if fn.Recv != "" {
+			fmt.Fprintf(b, "#### func (%s) %s\n\n", fn.Recv, fn.Name)
+		} else {
+			fmt.Fprintf(b, "### func %s\n\n", fn.Name)
+		}
+		writeMarkdownCode(b, "go", fn.Decl)
+		writeMarkdownDoc(b, fn.Doc)
+		writeMarkdownExamples(b, fn.Examples)
+	}
+}
+
+func writeMarkdownExamples(b *strings.Builder, examples []*ExampleDoc) {
+	for _, e := range examples {
+		name := "Example"
+		if e.Suffix != "" {
+			name += " (" + e.Suffix + ")"
+		}
+		fmt.Fprintf(b, "**%s**\n\n", name)
+		writeMarkdownDoc(b, e.Doc)
+		writeMarkdownCode(b, "go", e.Code)
+		if e.Output != "" {
+			b.WriteString("Output:\n\n")
+			writeMarkdownCode(b, "", strings.TrimRight(e.Output, "\n"))
+		}
+	}
+}
+
+func writeMarkdownCode(b *strings.Builder, lang, code string) {
+	if code == "" {
+		return
+	}
+	fmt.Fprintf(b, "```%s\n%s\n```\n\n", lang, code)
+}
+
+// writeMarkdownDoc writes the doc comment text as Markdown paragraphs,
+// with the indented blocks as code blocks.
+func writeMarkdownDoc(b *strings.Builder, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	var code []string
+	flush := func() {
+		if len(code) == 0 {
+			return
+		}
+		for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+			code = code[:len(code)-1]
+		}
+		indent := commonIndent(code)
+		for i, line := range code {
+			code[i] = strings.TrimPrefix(line, indent)
+		}
+		fmt.Fprintf(b, "```\n%s\n```\n\n", strings.Join(code, "\n"))
+		code = code[:0]
+	}
+	var para bool
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			if para {
+				b.WriteString("\n")
+				para = false
+			}
+			code = append(code, line)
+		case strings.TrimSpace(line) == "":
+			if len(code) > 0 {
+				code = append(code, line)
+				continue
+			}
+			if para {
+				b.WriteString("\n")
+				para = false
+			}
+		default:
+			flush()
+			b.WriteString(line + "\n")
+			para = true
+		}
+	}
+	flush()
+	if para {
+		b.WriteString("\n")
+	}
+}
+
+// commonIndent returns the longest whitespace prefix of the non-blank lines.
+func commonIndent(lines []string) string {
+	var indent string
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	return indent
+}
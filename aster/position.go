@@ -0,0 +1,79 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// NodeAt returns the innermost node of the file at the position of the line
+// and the column, both starting at 1, the column counted in bytes as
+// token.Position.Column. Returns false if the position is out of the file or
+// outside of all the nodes.
+func (f *File) NodeAt(line, col int) (Node, bool) {
+	pos, ok := f.lineColPos(line, col)
+	if !ok {
+		return nil, false
+	}
+	var inner Node
+	for _, n := range f.Nodes {
+		if pos < n.Node().Pos() || pos >= n.Node().End() {
+			continue
+		}
+		if inner == nil || n.Node().End()-n.Node().Pos() < inner.Node().End()-inner.Node().Pos() {
+			inner = n
+		}
+	}
+	return inner, inner != nil
+}
+
+// PathTo returns the chain of the ast nodes enclosing the position,
+// from the innermost to the *ast.File, or nil if the position is out of
+// the declarations of the file.
+func (f *File) PathTo(pos token.Pos) []ast.Node {
+	if !pos.IsValid() || pos < f.File.Pos() || pos >= f.File.End() {
+		return nil
+	}
+	var path []ast.Node
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		path = append(path, n)
+		return true
+	})
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// lineColPos returns the position of the line and the column of the file.
+func (f *File) lineColPos(line, col int) (token.Pos, bool) {
+	tf := f.FileSet.File(f.File.Pos())
+	if tf == nil || line < 1 || line > tf.LineCount() || col < 1 {
+		return token.NoPos, false
+	}
+	offset := tf.Offset(tf.LineStart(line)) + col - 1
+	end := tf.Size()
+	if line < tf.LineCount() {
+		end = tf.Offset(tf.LineStart(line+1)) - 1
+	}
+	if offset > end {
+		return token.NoPos, false
+	}
+	return tf.Pos(offset), true
+}
@@ -0,0 +1,362 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proto generates the proto3 message definitions of the struct
+// types of a package, e.g.
+//
+//	// User is a user.
+//	type User struct {
+//		ID    int64             `proto:",1"`
+//		Tags  []string          `proto:"labels"`
+//		Attrs map[string]string
+//		Since time.Time
+//	}
+//
+// to
+//
+//	// User is a user.
+//	message User {
+//	  int64 id = 1;
+//	  repeated string labels = 2;
+//	  map<string, string> attrs = 3;
+//	  google.protobuf.Timestamp since = 4;
+//	}
+//
+// The field tag `proto:"[name][,number]"` sets the name and the number of
+// the field, `proto:"-"` skips it. The other fields are named in snake case
+// and numbered in order after the largest number tagged before them.
+// The doc comments of the fields are kept, and so are the line comments,
+// at the end of the lines.
+package proto
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+	"github.com/henrylee2cn/goutil"
+)
+
+// TagKey is the key of the field tags, see the package doc.
+const TagKey = "proto"
+
+// Options are the options of Generate.
+type Options struct {
+	// Package is the proto package, defaults to the Go package name.
+	Package string
+	// GoPackage is the go_package option, omitted if empty.
+	GoPackage string
+	// Filter selects the struct types to generate, defaults to the exported
+	// ones. The struct types of the package they refer to are generated too.
+	Filter func(t aster.TypeNode) bool
+}
+
+// scalars are the proto types of the Go basic types.
+var scalars = map[string]string{
+	"bool":    "bool",
+	"string":  "string",
+	"int":     "int64",
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"rune":    "int32",
+	"int64":   "int64",
+	"uint":    "uint64",
+	"uint8":   "uint32",
+	"byte":    "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"float32": "float",
+	"float64": "double",
+}
+
+// wellKnown are the well-known proto types of the Go types outside of the
+// package, with their import files.
+var wellKnown = map[string][2]string{
+	"time.Time":     {"google.protobuf.Timestamp", "google/protobuf/timestamp.proto"},
+	"time.Duration": {"google.protobuf.Duration", "google/protobuf/duration.proto"},
+}
+
+// Generate returns the proto file of the struct types of the package
+// selected by the options, which may be nil, sorted by file name and position.
+// Returns an error if a field type has no proto type, e.g. a channel,
+// a nested slice or a type of another package.
+func Generate(p *aster.Package, opts *Options) ([]byte, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Package == "" {
+		o.Package = p.Name
+	}
+	if o.Filter == nil {
+		o.Filter = func(t aster.TypeNode) bool { return aster.IsExported(t.Name()) }
+	}
+	g := &generator{pkg: p, imports: make(map[string]bool), queued: make(map[string]bool)}
+	for _, t := range p.Structs() {
+		if o.Filter(t) {
+			g.enqueue(t)
+		}
+	}
+	var body bytes.Buffer
+	for i := 0; i < len(g.queue); i++ {
+		if err := g.message(&body, g.queue[i], ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\nsyntax = \"proto3\";\n\npackage %s;\n", aster.GeneratedBanner("aster"), o.Package)
+	if len(g.imports) > 0 {
+		buf.WriteString("\n")
+		var imports []string
+		for imp := range g.imports {
+			imports = append(imports, imp)
+		}
+		sort.Strings(imports)
+		for _, imp := range imports {
+			fmt.Fprintf(&buf, "import %q;\n", imp)
+		}
+	}
+	if o.GoPackage != "" {
+		fmt.Fprintf(&buf, "\noption go_package = %q;\n", o.GoPackage)
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+type generator struct {
+	pkg     *aster.Package
+	imports map[string]bool
+	queue   []aster.TypeNode // the struct types to generate in order
+	queued  map[string]bool
+}
+
+func (g *generator) enqueue(t aster.TypeNode) {
+	if !g.queued[t.Name()] {
+		g.queued[t.Name()] = true
+		g.queue = append(g.queue, t)
+	}
+}
+
+// message writes the message of the named struct type.
+func (g *generator) message(w *bytes.Buffer, t aster.TypeNode, indent string) error {
+	if len(t.TypeParams()) > 0 {
+		return fmt.Errorf("proto: generic type: %s", t.Name())
+	}
+	w.WriteString("\n")
+	writeComment(w, t.Doc(), indent)
+	st, _ := t.Node().(*ast.StructType)
+	return g.fields(w, t.Name(), t, st, indent)
+}
+
+// fields writes the message of the struct type of the fields.
+func (g *generator) fields(w *bytes.Buffer, name string, t aster.TypeNode, st *ast.StructType, indent string) error {
+	fmt.Fprintf(w, "%smessage %s {\n", indent, name)
+	inner := indent + "  "
+	var (
+		lines  bytes.Buffer
+		used   = make(map[int]string)
+		number int
+	)
+	for _, field := range st.Fields.List {
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+		}
+		for _, id := range names {
+			if !aster.IsExported(id.Name) {
+				continue
+			}
+			protoName, num, skip, err := parseTag(field)
+			if err != nil {
+				return fmt.Errorf("proto: %s.%s: %s", name, id.Name, err)
+			}
+			if skip {
+				continue
+			}
+			if protoName == "" {
+				protoName = goutil.SnakeString(id.Name)
+			}
+			if num == 0 {
+				num = number + 1
+				for used[num] != "" || num >= 19000 && num <= 19999 {
+					num++
+				}
+			}
+			if prev := used[num]; prev != "" {
+				return fmt.Errorf("proto: %s: field number %d of %s used by %s", name, num, id.Name, prev)
+			}
+			used[num] = id.Name
+			if num > number {
+				number = num
+			}
+
+			typ, err := g.fieldType(w, field.Type, id.Name, t, inner)
+			if err != nil {
+				return fmt.Errorf("proto: %s.%s: %s", name, id.Name, err)
+			}
+			if field.Doc != nil {
+				writeComment(&lines, field.Doc.Text(), inner)
+			}
+			fmt.Fprintf(&lines, "%s%s %s = %d;", inner, typ, protoName, num)
+			if field.Comment != nil {
+				fmt.Fprintf(&lines, " // %s", strings.Join(strings.Fields(field.Comment.Text()), " "))
+			}
+			lines.WriteByte('\n')
+		}
+	}
+	w.Write(lines.Bytes())
+	fmt.Fprintf(w, "%s}\n", indent)
+	return nil
+}
+
+// fieldType returns the proto type of the field type, writing the nested
+// messages of the anonymous struct types into w.
+func (g *generator) fieldType(w *bytes.Buffer, typ ast.Expr, fieldName string, t aster.TypeNode, indent string) (string, error) {
+	switch x := typ.(type) {
+	case *ast.StarExpr:
+		s, err := g.fieldType(w, x.X, fieldName, t, indent)
+		if err == nil && isScalar(s) {
+			s = "optional " + s
+		}
+		return s, err
+	case *ast.ArrayType:
+		if id, ok := x.Elt.(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") {
+			return "bytes", nil
+		}
+		s, err := g.fieldType(w, x.Elt, fieldName, t, indent)
+		if err != nil {
+			return "", err
+		}
+		s = strings.TrimPrefix(s, "optional ")
+		if strings.Contains(s, " ") {
+			return "", fmt.Errorf("unsupported nested list or map: %s", s)
+		}
+		return "repeated " + s, nil
+	case *ast.MapType:
+		k, err := g.fieldType(w, x.Key, fieldName, t, indent)
+		if err != nil {
+			return "", err
+		}
+		if !isScalar(k) || k == "float" || k == "double" {
+			return "", fmt.Errorf("unsupported map key: %s", k)
+		}
+		v, err := g.fieldType(w, x.Value, fieldName, t, indent)
+		if err != nil {
+			return "", err
+		}
+		v = strings.TrimPrefix(v, "optional ")
+		if strings.Contains(v, " ") {
+			return "", fmt.Errorf("unsupported map value: %s", v)
+		}
+		return fmt.Sprintf("map<%s, %s>", k, v), nil
+	case *ast.StructType:
+		name := goutil.CamelString(fieldName)
+		return name, g.fields(w, name, t, x, indent)
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok {
+			if known, ok := wellKnown[t.File().LookupImportPath(pkg.Name)+"."+x.Sel.Name]; ok {
+				g.imports[known[1]] = true
+				return known[0], nil
+			}
+		}
+	case *ast.Ident:
+		if s, ok := scalars[x.Name]; ok {
+			return s, nil
+		}
+		if n, ok := g.pkg.LookupType(x.Name); ok {
+			if n.Kind() == aster.Struct {
+				g.enqueue(n)
+				return n.Name(), nil
+			}
+			if u, ok := n.Node().(ast.Expr); ok && u != typ {
+				return g.fieldType(w, u, fieldName, n, indent)
+			}
+		}
+	}
+	return "", fmt.Errorf("unsupported type: %s", types.ExprString(typ))
+}
+
+// parseTag parses the `proto:"[name][,number]"` tag of the field.
+func parseTag(field *ast.Field) (name string, number int, skip bool, err error) {
+	if field.Tag == nil {
+		return "", 0, false, nil
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", 0, false, err
+	}
+	value, ok := reflect.StructTag(tag).Lookup(TagKey)
+	if !ok {
+		return "", 0, false, nil
+	}
+	if value == "-" {
+		return "", 0, true, nil
+	}
+	a := strings.SplitN(value, ",", 2)
+	name = a[0]
+	if len(a) == 2 && a[1] != "" {
+		number, err = strconv.Atoi(a[1])
+		if err != nil || number < 1 || number > 536870911 || number >= 19000 && number <= 19999 {
+			return "", 0, false, fmt.Errorf("invalid field number: %s", a[1])
+		}
+	}
+	return name, number, false, nil
+}
+
+func isScalar(s string) bool {
+	if s == "bytes" {
+		return true
+	}
+	for _, v := range scalars {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedName returns the field name of the embedded type.
+func embeddedName(typ ast.Expr) string {
+	switch x := typ.(type) {
+	case *ast.StarExpr:
+		return embeddedName(x.X)
+	case *ast.SelectorExpr:
+		return x.Sel.Name
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+func writeComment(w *bytes.Buffer, doc, indent string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(doc, "\n"), "\n") {
+		if line == "" {
+			fmt.Fprintf(w, "%s//\n", indent)
+		} else {
+			fmt.Fprintf(w, "%s// %s\n", indent, line)
+		}
+	}
+}
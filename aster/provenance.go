@@ -0,0 +1,331 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"encoding/json"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestFile is the name of the provenance manifest file.
+const ManifestFile = ".aster-gen.json"
+
+// Provenance records where a generated file comes from.
+type Provenance struct {
+	// File is the slash path relative to the manifest directory.
+	File string `json:"file"`
+	// Generator is the name of the generator rule, e.g. "mock",
+	// or the comma-separated names of the generators sharing the file.
+	Generator string `json:"generator"`
+	// Sources are the IDs of the source nodes qualified by the package
+	// path, e.g. "example.com/mod/pkg.Reader" for a type or function,
+	// and "example.com/mod/pkg.T.M" for a method, see Package.Path.
+	// Without a go.mod file, the path is the directory of the package
+	// relative to the manifest directory joined with the package name.
+	Sources []string `json:"sources"`
+}
+
+// Manifest is the provenance manifest of the generated files,
+// stored in the ManifestFile of Dir.
+type Manifest struct {
+	Dir   string        `json:"-"`
+	Files []*Provenance `json:"files"`
+	// FS is the file system to write the manifest to and delete the orphan
+	// files from, defaults to OSFS. The files are deleted if it implements
+	// RemoveFS, see Clean.
+	FS WriteFileFS `json:"-"`
+	// changed reports whether the records are changed since loaded or saved
+	changed bool
+}
+
+// LoadManifest reads the manifest of dir.
+// Returns an empty manifest if there is no such file.
+func LoadManifest(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{Dir: dir}
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Save writes the manifest, sorted by file.
+func (m *Manifest) Save() error {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].File < m.Files[j].File })
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = fsWriteFile(m.fs(), filepath.Join(m.Dir, ManifestFile), string(b)+"\n"); err != nil {
+		return err
+	}
+	m.changed = false
+	return nil
+}
+
+func (m *Manifest) fs() WriteFileFS {
+	if m.FS == nil {
+		return OSFS
+	}
+	return m.FS
+}
+
+// Record records the file produced by the generator from the source nodes,
+// replacing the previous record of the file.
+func (m *Manifest) Record(filename, generator string, sources ...Node) error {
+	rel, err := m.rel(filename)
+	if err != nil {
+		return err
+	}
+	p := &Provenance{File: rel, Generator: generator, Sources: make([]string, 0, len(sources))}
+	for _, n := range sources {
+		if id := m.sourceID(n); !containsString(p.Sources, id) {
+			p.Sources = append(p.Sources, id)
+		}
+	}
+	sort.Strings(p.Sources)
+	m.changed = true
+	for i, old := range m.Files {
+		if old.File == rel {
+			m.Files[i] = p
+			return nil
+		}
+	}
+	m.Files = append(m.Files, p)
+	return nil
+}
+
+// Lookup returns the record of the file.
+func (m *Manifest) Lookup(filename string) (*Provenance, bool) {
+	rel, err := m.rel(filename)
+	if err != nil {
+		return nil, false
+	}
+	for _, p := range m.Files {
+		if p.File == rel {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Orphans returns the records of the generated files whose source nodes
+// no longer exist in the module, or any of whose generators is not in
+// the given ones. If no generators are given, all the generators are kept.
+// NOTE: The module should cover all the packages of the source nodes.
+func (m *Manifest) Orphans(mod *Module, generators ...string) []*Provenance {
+	ids := make(map[string]bool)
+	for _, p := range mod.Packages {
+		for _, f := range p.Files {
+			f.collectSourceIDs(m.pkgPath(p), ids)
+		}
+	}
+	var keep map[string]bool
+	if len(generators) > 0 {
+		keep = make(map[string]bool, len(generators))
+		for _, g := range generators {
+			keep[g] = true
+		}
+	}
+	var orphans []*Provenance
+	for _, p := range m.Files {
+		if keep != nil && !keepAll(keep, p.Generator) {
+			orphans = append(orphans, p)
+			continue
+		}
+		for _, id := range p.Sources {
+			if !ids[id] {
+				orphans = append(orphans, p)
+				break
+			}
+		}
+	}
+	return orphans
+}
+
+// Clean deletes the orphan generated files (see Orphans),
+// removes them from the module and the manifest, and saves the manifest.
+// If dryRun is true, nothing is deleted or saved.
+// Returns the paths of the orphan files.
+func (m *Manifest) Clean(mod *Module, dryRun bool, generators ...string) ([]string, error) {
+	orphans := m.Orphans(mod, generators...)
+	var removed []string
+	for _, p := range orphans {
+		filename := filepath.Join(m.Dir, filepath.FromSlash(p.File))
+		removed = append(removed, filename)
+	}
+	if dryRun || len(orphans) == 0 {
+		return removed, nil
+	}
+	for _, filename := range removed {
+		if err := fsRemove(m.fs(), filename); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		mod.removeFile(filename)
+	}
+	isOrphan := make(map[*Provenance]bool, len(orphans))
+	for _, p := range orphans {
+		isOrphan[p] = true
+	}
+	files := m.Files[:0]
+	for _, p := range m.Files {
+		if !isOrphan[p] {
+			files = append(files, p)
+		}
+	}
+	m.Files = files
+	return removed, m.Save()
+}
+
+// keepAll reports whether all the comma-separated generators are kept.
+func keepAll(keep map[string]bool, generators string) bool {
+	for _, g := range strings.Split(generators, ",") {
+		if !keep[g] {
+			return false
+		}
+	}
+	return true
+}
+
+// rel returns the slash path of the file relative to the manifest directory.
+func (m *Manifest) rel(filename string) (string, error) {
+	rel, err := filepath.Rel(m.Dir, absPath(filename))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// SourceID returns the ID of the node, i.e. "<package>.<name>",
+// or "<package>.<receiver type>.<name>" for a method.
+func SourceID(n Node) string {
+	return sourceID(n.PkgName(), n)
+}
+
+func sourceID(pkg string, n Node) string {
+	if recv := recvTypeName(n); recv != "" {
+		return pkg + "." + recv + "." + n.Name()
+	}
+	return pkg + "." + n.Name()
+}
+
+// sourceID returns the ID of the node recorded in the manifest,
+// qualified by the path of its package, see pkgPath.
+func (m *Manifest) sourceID(n Node) string {
+	if f := n.File(); f != nil && f.pkg != nil {
+		return sourceID(m.pkgPath(f.pkg), n)
+	}
+	return SourceID(n)
+}
+
+// pkgPath returns the path qualifying the source IDs of the package,
+// see Provenance.Sources.
+func (m *Manifest) pkgPath(p *Package) string {
+	if _, ok := p.ImportPath(); ok {
+		return p.Path()
+	}
+	if rel, err := m.rel(p.Dir); err == nil {
+		return path.Join(rel, p.Name)
+	}
+	return p.Name
+}
+
+// collectSourceIDs adds the IDs of the top-level declarations of the file,
+// qualified by pkg.
+func (f *File) collectSourceIDs(pkg string, ids map[string]bool) {
+	for _, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if recv := f.declRecv(d); recv != "" {
+				ids[pkg+"."+recv+"."+d.Name.Name] = true
+			} else {
+				ids[pkg+"."+d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					ids[pkg+"."+s.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						ids[pkg+"."+id.Name] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// RecordGenerated records the file produced by the generator from the source
+// nodes in the manifest of the module directory, see Manifest.Record.
+// The manifest is saved when the module, or a package or file of it,
+// is stored, so that the orphan generated files can be cleaned later,
+// see Manifest.Clean.
+func (m *Module) RecordGenerated(filename, generator string, sources ...Node) error {
+	if m.manifest == nil {
+		manifest, err := LoadManifest(m.Dir)
+		if err != nil {
+			return err
+		}
+		m.manifest = manifest
+	}
+	return m.manifest.Record(filename, generator, sources...)
+}
+
+// recordGenerated records the file produced by the generator in the
+// manifest of its module, if any, see Module.RecordGenerated.
+func (f *File) recordGenerated(generator string, sources ...Node) error {
+	if f.pkg == nil || f.pkg.module == nil {
+		return nil
+	}
+	return f.pkg.module.RecordGenerated(f.Filename, generator, sources...)
+}
+
+// storeManifest saves the manifest of the module if changed.
+func (m *Module) storeManifest(fsys WriteFileFS) error {
+	if m == nil || m.manifest == nil || !m.manifest.changed {
+		return nil
+	}
+	m.manifest.FS = fsys
+	return m.manifest.Save()
+}
+
+// removeFile removes the file from its package.
+func (m *Module) removeFile(filename string) {
+	for _, p := range m.Packages {
+		for k, f := range p.Files {
+			if absPath(f.Filename) == filename {
+				delete(p.Files, k)
+				p.collectNodes()
+			}
+		}
+	}
+}
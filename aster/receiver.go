@@ -0,0 +1,194 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+)
+
+// lockTypes are the types which must not be copied after first use.
+var lockTypes = map[string][]string{
+	"sync":        {"Mutex", "RWMutex", "WaitGroup", "Once", "Cond", "Map", "Pool"},
+	"sync/atomic": {"Value", "Bool", "Int32", "Int64", "Uint32", "Uint64", "Uintptr", "Pointer"},
+}
+
+// ConvertReceivers converts the receivers of all the methods of the type to
+// pointer receivers if pointer is true, or to value receivers otherwise.
+// The method expressions referring to them in the package, e.g. T.Method and
+// (*T).Method, are rewritten to the new receiver kind too.
+//
+// Returns an error if converting to value receivers would copy a lock,
+// e.g. a sync.Mutex field, as go vet's copylocks check reports.
+// NOTE: The files of the package are reparsed after rewriting,
+// so the nodes must be looked up again.
+func (s *superType) ConvertReceivers(pointer bool) error {
+	name := s.Name()
+	if name == "" || s.kind == Interface {
+		return fmt.Errorf("aster: type has no method receivers: %s", name)
+	}
+	if !pointer {
+		if path, ok := s.file.containsLock(s.file.lookupTypeExpr(name), nil); ok {
+			return fmt.Errorf("aster: value receivers of %s would copy the lock %s", name, path)
+		}
+	}
+
+	files := []*File{s.file}
+	if p, ok := s.file.Package(); ok {
+		files = files[:0]
+		for _, f := range p.Files {
+			files = append(files, f)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	}
+	for _, f := range files {
+		if err := f.refresh(); err != nil {
+			return err
+		}
+	}
+	t, found := s.file.LookupTypeInPkg(name)
+	if !found {
+		return fmt.Errorf("aster: type not found: %s", name)
+	}
+	var methods = make(map[string]bool)
+	for i := 0; i < t.NumMethod(); i++ {
+		m, _ := t.Method(i)
+		methods[m.Name()] = true
+	}
+
+	var edits = make(map[*File][]textEdit)
+	for i := 0; i < t.NumMethod(); i++ {
+		m, _ := t.Method(i)
+		fd := m.(*FuncDecl)
+		recv := fd.node.(*ast.FuncDecl).Recv.List[0].Type
+		base := fd.file.TryFormatNode(getElem(recv))
+		if pointer {
+			base = "*" + base
+		}
+		edits[fd.file] = append(edits[fd.file], fd.file.textEdit(recv, base))
+	}
+	for _, f := range files {
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || !methods[sel.Sel.Name] {
+				return true
+			}
+			x := sel.X
+			star := false
+			if paren, ok := x.(*ast.ParenExpr); ok {
+				if st, ok := paren.X.(*ast.StarExpr); ok {
+					x, star = st.X, true
+				}
+			}
+			if id, ok := genericBase(x).(*ast.Ident); !ok || id.Name != name || star == pointer {
+				return true
+			}
+			typ := f.TryFormatNode(x)
+			if pointer {
+				typ = "(*" + typ + ")"
+			}
+			edits[f] = append(edits[f], f.textEdit(sel.X, typ))
+			return false
+		})
+	}
+	for _, f := range files {
+		if err := f.applyEdits(edits[f]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsLock reports whether a value of the type expression contains a lock,
+// and returns the path to it, e.g. "mu" or "Base.mu".
+// The named types declared in the package are inspected recursively.
+func (f *File) containsLock(typ ast.Expr, visiting map[string]bool) (string, bool) {
+	switch x := typ.(type) {
+	case nil:
+		return "", false
+	case *ast.ParenExpr:
+		return f.containsLock(x.X, visiting)
+	case *ast.ArrayType:
+		if x.Len == nil {
+			return "", false // slices are references
+		}
+		return f.containsLock(x.Elt, visiting)
+	case *ast.StructType:
+		for _, field := range x.Fields.List {
+			path, ok := f.containsLock(field.Type, visiting)
+			if !ok {
+				continue
+			}
+			var name string
+			if len(field.Names) > 0 {
+				name = field.Names[0].Name
+			} else {
+				name = f.TryFormatNode(getElem(field.Type))
+			}
+			if path != "" {
+				name += "." + path
+			}
+			return name, true
+		}
+	case *ast.SelectorExpr:
+		for path, names := range lockTypes {
+			for _, name := range names {
+				if f.isQualifiedType(x, path, name) {
+					return "", true
+				}
+			}
+		}
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return f.containsLock(genericBase(x), visiting)
+	case *ast.Ident:
+		if visiting[x.Name] {
+			return "", false
+		}
+		t, found := f.LookupTypeInPkg(x.Name)
+		if !found {
+			return "", false
+		}
+		if visiting == nil {
+			visiting = make(map[string]bool)
+		}
+		visiting[x.Name] = true
+		defer delete(visiting, x.Name)
+		tf := nodeFile(t.(Node))
+		return tf.containsLock(tf.lookupTypeExpr(x.Name), visiting)
+	}
+	return "", false
+}
+
+// lookupTypeExpr returns the type expression of the type declaration in the package.
+func (f *File) lookupTypeExpr(name string) ast.Expr {
+	files := []*File{f}
+	if p, ok := f.Package(); ok {
+		files = files[:0]
+		for _, pf := range p.Files {
+			files = append(files, pf)
+		}
+	}
+	for _, pf := range files {
+		if d := pf.lookupTypeDecl(name); d != nil {
+			for _, spec := range d.Specs {
+				if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+					return ts.Type
+				}
+			}
+		}
+	}
+	return nil
+}
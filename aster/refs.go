@@ -0,0 +1,454 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Ref is a reference to a node or struct field.
+type Ref struct {
+	Ident *ast.Ident
+	File  *File
+	Pos   token.Position
+	// Enclosing is the innermost node enclosing the reference,
+	// nil at the top level outside of any node.
+	Enclosing Node
+	// Func is the innermost function enclosing the reference, nil if none.
+	Func FuncNode
+	// Guess is true if the reference is a selector matched by name only,
+	// as the type of its operand can not be inferred.
+	Guess bool
+}
+
+// maxInferDepth limits the recursion of inferring the type of an expression.
+const maxInferDepth = 16
+
+// References returns the identifiers referring to the node across all the
+// packages of the module, sorted by position.
+// The package-level names and locals are resolved by the parser, and the
+// selectors of methods by the types of their operands, inferred from the
+// declarations of the variables; see Ref.Guess for the uninferable ones.
+// NOTE: The module is not type-checked.
+func (s *super) References() []Ref {
+	for _, n := range s.file.Nodes {
+		if superOf(n) == s {
+			return references(n)
+		}
+	}
+	return nil
+}
+
+// References returns the identifiers referring to the struct field across
+// all the packages of the module, i.e. the selectors and the keys of the
+// composite literals, sorted by position. See Node.References.
+func (s *StructField) References() []Ref {
+	for _, n := range s.file.Nodes {
+		st, ok := n.(*StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range st.fields {
+			if field.Field == s.Field {
+				return s.file.memberRefs(s.Name(), true, func(t TypeNode) bool {
+					f, ok := t.FieldByName(s.Name(), true)
+					return ok && f.Field == s.Field
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func references(n Node) []Ref {
+	f := nodeFile(n)
+	switch x := n.Node().(type) {
+	case *ast.FuncDecl:
+		if x.Recv == nil {
+			return f.topRefs(x.Name, x)
+		}
+		return f.memberRefs(x.Name.Name, false, isMethodOf(n))
+	case *ast.FuncLit:
+		if id, spec := f.valueSpecOf(x); id != nil {
+			return f.namedRefs(id, spec)
+		}
+	case *ast.Field:
+		return f.memberRefs(n.Name(), false, isMethodOf(n))
+	default:
+		if id, spec := f.typeSpecOf(x); id != nil {
+			return f.namedRefs(id, spec)
+		}
+	}
+	return nil
+}
+
+func isMethodOf(n Node) func(TypeNode) bool {
+	return func(t TypeNode) bool {
+		m, ok := t.MethodByName(n.Name(), true)
+		return ok && m.Node() == n.Node()
+	}
+}
+
+// namedRefs returns the references to the name declared by decl,
+// at the top level or locally.
+func (f *File) namedRefs(id *ast.Ident, decl ast.Node) []Ref {
+	for _, d := range f.File.Decls {
+		if d.Pos() <= decl.Pos() && decl.End() <= d.End() {
+			if _, ok := d.(*ast.GenDecl); ok {
+				return f.topRefs(id, decl)
+			}
+		}
+	}
+	// the locals are fully resolved within the file
+	var refs []Ref
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		if x, ok := n.(*ast.Ident); ok && x != id && x.Obj != nil && x.Obj == id.Obj {
+			refs = append(refs, f.newRef(x, false))
+		}
+		return true
+	})
+	sortRefs(refs)
+	return refs
+}
+
+// topRefs returns the references to the package-level name declared by decl.
+func (f *File) topRefs(id *ast.Ident, decl ast.Node) []Ref {
+	var refs []Ref
+	for _, g := range f.moduleFiles() {
+		if g.pkg != f.pkg {
+			// pkg.Name in the other packages of the module
+			ast.Inspect(g.File, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel.Name == id.Name {
+					if p, ok := g.importedPackage(sel.X); ok && p == f.pkg {
+						refs = append(refs, g.newRef(sel.Sel, false))
+					}
+				}
+				return true
+			})
+			continue
+		}
+		skip := g.nonRefIdents()
+		ast.Inspect(g.File, func(n ast.Node) bool {
+			x, ok := n.(*ast.Ident)
+			if !ok || x == id || x.Name != id.Name || skip[x] {
+				return true
+			}
+			// the other files of the package are not resolved
+			if x.Obj == nil || x.Obj.Decl == decl || x.Obj == id.Obj {
+				refs = append(refs, g.newRef(x, false))
+			}
+			return true
+		})
+	}
+	sortRefs(refs)
+	return refs
+}
+
+// nonRefIdents returns the identifiers of the file not resolved by the parser,
+// which are not package-level references: the selectors, the method names
+// and the keys of the struct literals.
+func (f *File) nonRefIdents() map[*ast.Ident]bool {
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			skip[x.Sel] = true
+		case *ast.FuncDecl:
+			if x.Recv != nil {
+				skip[x.Name] = true
+			}
+		case *ast.CompositeLit:
+			if x.Type != nil {
+				if t, _ := f.resolveType(x.Type); t == nil || t.Kind() != Struct {
+					return true
+				}
+			}
+			for _, elt := range x.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						skip[key] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+	return skip
+}
+
+// memberRefs returns the references to the method or field of the name,
+// where is reports whether the member of a type is the target.
+// The keys of the struct literals are matched for a field.
+func (f *File) memberRefs(name string, field bool, is func(TypeNode) bool) []Ref {
+	var refs []Ref
+	for _, g := range f.moduleFiles() {
+		ast.Inspect(g.File, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.SelectorExpr:
+				if x.Sel.Name != name || g.isPkgName(x.X) {
+					return true
+				}
+				// the method expressions, e.g. T.M and (*T).M
+				if t, ok := g.typeOperand(x.X); ok {
+					if t != nil && is(t) {
+						refs = append(refs, g.newRef(x.Sel, false))
+					}
+					return true
+				}
+				t, known := g.inferType(x.X, 0)
+				if !known || t != nil && is(t) {
+					refs = append(refs, g.newRef(x.Sel, !known))
+				}
+			case *ast.CompositeLit:
+				if !field || x.Type == nil {
+					return true
+				}
+				if t, _ := g.resolveType(x.Type); t == nil || !is(t) {
+					return true
+				}
+				for _, elt := range x.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*ast.Ident); ok && key.Name == name {
+							refs = append(refs, g.newRef(key, false))
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	sortRefs(refs)
+	return refs
+}
+
+// typeOperand returns the named type which the type expression refers to,
+// or false if x is not a type expression.
+func (f *File) typeOperand(x ast.Expr) (TypeNode, bool) {
+	switch e := genericBase(x).(type) {
+	case *ast.ParenExpr:
+		return f.typeOperand(e.X)
+	case *ast.StarExpr:
+		return f.typeOperand(e.X)
+	case *ast.Ident:
+		if e.Obj != nil && e.Obj.Kind != ast.Typ || e.Obj == nil && f.lookupTypeExpr(e.Name) == nil {
+			return nil, false
+		}
+		return f.resolveType(e)
+	case *ast.SelectorExpr:
+		if p, ok := f.importedPackage(e.X); ok {
+			return p.LookupType(e.Sel.Name)
+		}
+	}
+	return nil, false
+}
+
+// resolveType returns the named type of the module which the type
+// expression refers to, or nil if it refers to none.
+func (f *File) resolveType(typ ast.Expr) (TypeNode, bool) {
+	switch e := genericBase(getElem(typ)).(type) {
+	case *ast.ParenExpr:
+		return f.resolveType(e.X)
+	case *ast.Ident:
+		t, _ := f.LookupTypeInPkg(e.Name)
+		return t, true
+	case *ast.SelectorExpr:
+		if p, ok := f.importedPackage(e.X); ok {
+			t, _ := p.LookupType(e.Sel.Name)
+			return t, true
+		}
+	}
+	return nil, true
+}
+
+// inferType returns the named type of the value of the expression,
+// inferred from the declarations of the variables,
+// or false if it can not be inferred.
+func (f *File) inferType(x ast.Expr, depth int) (TypeNode, bool) {
+	if depth > maxInferDepth {
+		return nil, false
+	}
+	depth++
+	switch e := x.(type) {
+	case *ast.ParenExpr:
+		return f.inferType(e.X, depth)
+	case *ast.StarExpr:
+		return f.inferType(e.X, depth)
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return f.inferType(e.X, depth)
+		}
+	case *ast.CompositeLit:
+		if e.Type != nil {
+			return f.resolveType(e.Type)
+		}
+	case *ast.CallExpr:
+		id, ok := e.Fun.(*ast.Ident)
+		if !ok || id.Obj != nil && id.Obj.Kind != ast.Fun {
+			return nil, false
+		}
+		if id.Name == "new" && id.Obj == nil && len(e.Args) == 1 {
+			return f.resolveType(e.Args[0])
+		}
+		// a function of the package with a single result
+		if fn, found := f.lookupFunc(id.Name); found {
+			d, ok := fn.Node().(*ast.FuncDecl)
+			if ok && d.Type.Results != nil && len(d.Type.Results.List) == 1 && len(d.Type.Results.List[0].Names) <= 1 {
+				return nodeFile(fn.(Node)).resolveType(d.Type.Results.List[0].Type)
+			}
+		}
+	case *ast.SelectorExpr:
+		if f.isPkgName(e.X) {
+			return nil, false
+		}
+		t, known := f.inferType(e.X, depth)
+		if t == nil || t.Kind() != Struct {
+			return nil, known && t == nil
+		}
+		if field, ok := t.FieldByName(e.Sel.Name, true); ok {
+			return field.file.resolveType(field.Field.Type)
+		}
+	case *ast.Ident:
+		if e.Obj == nil {
+			// a package-level variable declared in another file
+			for _, g := range f.moduleFiles() {
+				if g.pkg != f.pkg || g == f {
+					continue
+				}
+				if obj := g.File.Scope.Lookup(e.Name); obj != nil && obj.Kind == ast.Var {
+					return g.inferDecl(e.Name, obj.Decl, depth)
+				}
+			}
+			return nil, false
+		}
+		if e.Obj.Kind == ast.Var {
+			return f.inferDecl(e.Name, e.Obj.Decl, depth)
+		}
+	}
+	return nil, false
+}
+
+// inferDecl returns the named type of the variable declared by decl.
+func (f *File) inferDecl(name string, decl interface{}, depth int) (TypeNode, bool) {
+	switch d := decl.(type) {
+	case *ast.Field:
+		return f.resolveType(d.Type)
+	case *ast.ValueSpec:
+		if d.Type != nil {
+			return f.resolveType(d.Type)
+		}
+		for i, id := range d.Names {
+			if id.Name == name && i < len(d.Values) && len(d.Names) == len(d.Values) {
+				return f.inferType(d.Values[i], depth)
+			}
+		}
+	case *ast.AssignStmt:
+		for i, lhs := range d.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && id.Name == name && len(d.Lhs) == len(d.Rhs) {
+				return f.inferType(d.Rhs[i], depth)
+			}
+		}
+	}
+	return nil, false
+}
+
+// importedPackage returns the module package imported by the name.
+func (f *File) importedPackage(x ast.Expr) (*Package, bool) {
+	id, ok := x.(*ast.Ident)
+	if !ok || id.Obj != nil || f.pkg == nil || f.pkg.module == nil {
+		return nil, false
+	}
+	for _, imp := range f.Imports {
+		if imp.Name == id.Name {
+			p, ok := f.pkg.module.Packages[imp.Path[strings.LastIndex(imp.Path, "/")+1:]]
+			return p, ok
+		}
+	}
+	return nil, false
+}
+
+// valueSpecOf returns the name and spec of the variable
+// whose value is the expression.
+func (f *File) valueSpecOf(x ast.Expr) (*ast.Ident, *ast.ValueSpec) {
+	var id *ast.Ident
+	var spec *ast.ValueSpec
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		vs, ok := n.(*ast.ValueSpec)
+		if !ok || id != nil {
+			return id == nil
+		}
+		for i, v := range vs.Values {
+			if v == x && i < len(vs.Names) {
+				id, spec = vs.Names[i], vs
+			}
+		}
+		return true
+	})
+	return id, spec
+}
+
+// typeSpecOf returns the name and spec of the type declaration
+// whose type is the expression.
+func (f *File) typeSpecOf(x ast.Node) (*ast.Ident, *ast.TypeSpec) {
+	var spec *ast.TypeSpec
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok && ts.Type == x {
+			spec = ts
+		}
+		return spec == nil
+	})
+	if spec == nil {
+		return nil, nil
+	}
+	return spec.Name, spec
+}
+
+func (f *File) newRef(id *ast.Ident, guess bool) Ref {
+	return Ref{
+		Ident:     id,
+		File:      f,
+		Pos:       f.FileSet.Position(id.Pos()),
+		Enclosing: f.enclosing(id.Pos()),
+		Func:      f.enclosingFunc(id.Pos()),
+		Guess:     guess,
+	}
+}
+
+// enclosing returns the innermost node of the file enclosing the position.
+func (f *File) enclosing(pos token.Pos) Node {
+	var inner Node
+	for _, n := range f.Nodes {
+		node := n.Node()
+		if node == nil || pos < node.Pos() || pos >= node.End() {
+			continue
+		}
+		if inner == nil || node.End()-node.Pos() < inner.Node().End()-inner.Node().Pos() {
+			inner = n
+		}
+	}
+	return inner
+}
+
+func sortRefs(refs []Ref) {
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i].Pos, refs[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
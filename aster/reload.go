@@ -0,0 +1,111 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+)
+
+// Reload reparses the file from the disk, or from the overlay of its module,
+// discarding the edits of the syntax tree, and recollects the nodes of its
+// package only, see Reparse. The file is left unchanged on errors, e.g. of
+// syntax or a different package clause.
+func (f *File) Reload() error {
+	var m *Module
+	if f.pkg != nil {
+		m = f.pkg.module
+	}
+	src, err := m.readFile(f.Filename)
+	if err != nil {
+		return err
+	}
+	if f.pkg != nil {
+		if err = checkPkgName(f.Filename, src, f.pkg.Name); err != nil {
+			return err
+		}
+	}
+	old := f.Src
+	f.Src = src
+	if err = f.Reparse(); err != nil {
+		f.Src = old
+		return err
+	}
+	return nil
+}
+
+// ReloadFile reloads the file of the name, which may be relative to the
+// package directory, from the disk or the overlay of the module, see
+// File.Reload, so that the package reflects the file without reparsing the
+// whole module:
+// a file of the package is reparsed, a new file is added, no longer deleted
+// by Store if it was removed, and a file no longer existing is dropped,
+// returning nil.
+func (p *Package) ReloadFile(filename string) (*File, error) {
+	if _, ok := p.Files[filename]; !ok && !filepath.IsAbs(filename) && filepath.Dir(filename) == "." {
+		filename = filepath.Join(p.Dir, filename)
+	}
+	f, ok := p.Files[filename]
+	src, err := p.module.readFile(filename)
+	switch {
+	case os.IsNotExist(err) && ok:
+		delete(p.Files, filename)
+		p.collectNodes()
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case ok:
+		return f, f.Reload()
+	}
+	if err = checkPkgName(filename, src, p.Name); err != nil {
+		return nil, err
+	}
+	f = &File{
+		FileSet:  p.FileSet,
+		Filename: filename,
+		Src:      src,
+		mode:     p.mode,
+		pkg:      p,
+	}
+	p.Files[filename] = f
+	if err = f.Reparse(); err != nil {
+		delete(p.Files, filename)
+		p.collectNodes()
+		return nil, err
+	}
+	for i, name := range p.removed {
+		if name == filename {
+			p.removed = append(p.removed[:i], p.removed[i+1:]...)
+			break
+		}
+	}
+	return f, nil
+}
+
+// checkPkgName returns an error if the package clause of the source
+// is not of the package name.
+func checkPkgName(filename string, src []byte, pkgName string) error {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly)
+	if err != nil {
+		return wrapError(filename, src, err)
+	}
+	if file.Name.Name != pkgName {
+		return fmt.Errorf("aster: %s: package %s, not %s", filename, file.Name.Name, pkgName)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// RemoveNode removes the top-level declaration of the node from the file,
+// along with its doc and line comments.
+// A grouped declaration is removed as a whole if the node is its only spec.
+// Returns an error if the node is not a top-level type or function of the file,
+// or is declared along with other names, e.g. `var A, B = func() {}, 1`.
+// NOTE: The file is reparsed after removing, and the node is no longer valid.
+func (f *File) RemoveNode(n Node) error {
+	if nodeFile(n) != f {
+		return fmt.Errorf("aster: node not in the file: %s", n.Name())
+	}
+	pos, name := n.Node().Pos(), n.Name()
+	found, err := f.removeDecl(func(decl ast.Decl, spec ast.Spec) bool {
+		switch s := spec.(type) {
+		case nil:
+			return decl == n.Node()
+		case *ast.TypeSpec:
+			return s.Name.Name == name && s.Pos() <= pos && pos < s.End()
+		case *ast.ValueSpec:
+			for _, v := range s.Values {
+				if v == n.Node() {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("aster: not a top-level declaration: %s", name)
+	}
+	return err
+}
+
+// RemoveType removes the top-level type declaration and its methods
+// from the package files.
+// NOTE: The files are reparsed after removing.
+func (p *Package) RemoveType(name string) error {
+	var found bool
+	for _, f := range p.sortedFiles() {
+		ok, err := f.removeDecl(func(_ ast.Decl, spec ast.Spec) bool {
+			s, ok := spec.(*ast.TypeSpec)
+			return ok && s.Name.Name == name
+		})
+		if err != nil {
+			return err
+		}
+		found = found || ok
+	}
+	if !found {
+		return fmt.Errorf("aster: type not found: %s", name)
+	}
+	for _, f := range p.sortedFiles() {
+		for {
+			ok, err := f.removeDecl(func(decl ast.Decl, _ ast.Spec) bool {
+				d, ok := decl.(*ast.FuncDecl)
+				return ok && f.declRecv(d) == name
+			})
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveFunc removes the top-level function, not a method, from the package.
+// NOTE: The file is reparsed after removing.
+func (p *Package) RemoveFunc(name string) error {
+	return p.removeFunc(name, "")
+}
+
+// RemoveMethod removes the method of the type from the package.
+// NOTE: The file is reparsed after removing.
+func (p *Package) RemoveMethod(typeName, name string) error {
+	return p.removeFunc(name, typeName)
+}
+
+func (p *Package) removeFunc(name, recv string) error {
+	for _, f := range p.sortedFiles() {
+		if n, ok := f.lookupTopNode(name, Func, recv); ok {
+			return f.RemoveNode(n)
+		}
+	}
+	if recv != "" {
+		return fmt.Errorf("aster: method not found: %s.%s", recv, name)
+	}
+	return fmt.Errorf("aster: function not found: %s", name)
+}
+
+// removeDecl removes the first top-level declaration, or the spec of it,
+// that match reports true for. The spec is nil for function declarations.
+// Returns false if nothing matches.
+func (f *File) removeDecl(match func(decl ast.Decl, spec ast.Spec) bool) (bool, error) {
+	di, si := -1, -1
+	for i, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if match(d, nil) {
+				di = i
+			}
+		case *ast.GenDecl:
+			for j, spec := range d.Specs {
+				if match(d, spec) {
+					di, si = i, j
+					break
+				}
+			}
+		}
+		if di >= 0 {
+			break
+		}
+	}
+	if di < 0 {
+		return false, nil
+	}
+	if d, ok := f.File.Decls[di].(*ast.GenDecl); ok {
+		if vs, ok := d.Specs[si].(*ast.ValueSpec); ok && len(vs.Names) > 1 {
+			return true, fmt.Errorf("aster: can not remove one of the names declared together: %s", vs.Names[0].Name)
+		}
+	}
+
+	// the declaration order is kept by formatting
+	if err := f.refresh(); err != nil {
+		return true, err
+	}
+	var start, end token.Pos
+	switch d := f.File.Decls[di].(type) {
+	case *ast.FuncDecl:
+		start, end = d.Pos(), d.End()
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if len(d.Specs) == 1 {
+			start, end = d.Pos(), d.End()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			break
+		}
+		var doc, comment *ast.CommentGroup
+		switch s := d.Specs[si].(type) {
+		case *ast.TypeSpec:
+			doc, comment = s.Doc, s.Comment
+		case *ast.ValueSpec:
+			doc, comment = s.Doc, s.Comment
+		}
+		start, end = d.Specs[si].Pos(), d.Specs[si].End()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		if comment != nil {
+			end = comment.End()
+		}
+	}
+	s, e := f.lineRange(f.offset(start), f.offset(end))
+	return true, f.replaceSource(s, e, "")
+}
+
+// lineRange extends the source range [start,end) to whole lines, if there is
+// only white space before it, and only white space or a line comment after it.
+func (f *File) lineRange(start, end int) (int, int) {
+	s := start
+	for s > 0 && (f.Src[s-1] == ' ' || f.Src[s-1] == '\t') {
+		s--
+	}
+	if s == 0 || f.Src[s-1] == '\n' {
+		start = s
+	}
+	e := end
+	for e < len(f.Src) && (f.Src[e] == ' ' || f.Src[e] == '\t') {
+		e++
+	}
+	if e+1 < len(f.Src) && f.Src[e] == '/' && f.Src[e+1] == '/' {
+		for e < len(f.Src) && f.Src[e] != '\n' {
+			e++
+		}
+	}
+	if e == len(f.Src) {
+		end = e
+	} else if f.Src[e] == '\n' {
+		end = e + 1
+	}
+	return start, end
+}
+
+// declRecv returns the receiver type name of the method declaration,
+// or "" for a function.
+func (f *File) declRecv(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return ""
+	}
+	return baseTypeName(f.TryFormatNode(d.Recv.List[0].Type))
+}
@@ -0,0 +1,349 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Rename renames the top-level declaration of the package, or the method or
+// field of a type of it by "<type>.<name>", along with its references across
+// the module and the first word of its doc comment, e.g.
+//  p.Rename("User", "Account")
+//  p.Rename("User.Name", "FullName")
+// Returns an error if the new name is taken, or if some selectors of the name
+// can not be resolved, see Ref.Guess.
+// NOTE: The files of the module are reparsed after renaming,
+// so the nodes must be looked up again.
+func (p *Package) Rename(from, to string) error {
+	if !token.IsIdentifier(to) || to == "_" {
+		return fmt.Errorf("aster: invalid name: %q", to)
+	}
+	files := p.sortedFiles()
+	if len(files) == 0 {
+		return fmt.Errorf("aster: empty package: %s", p.Name)
+	}
+	files, err := files[0].refreshModule()
+	if err != nil {
+		return err
+	}
+	var (
+		decl *ast.Ident
+		doc  *ast.CommentGroup
+		refs []Ref
+	)
+	if i := strings.Index(from, "."); i >= 0 {
+		decl, doc, refs, err = p.memberToRename(from[:i], from[i+1:], to)
+	} else {
+		decl, doc, refs, err = p.declToRename(from, to)
+	}
+	if err != nil {
+		return err
+	}
+	var edits = make(map[*File][]textEdit)
+	for _, f := range p.Files {
+		if f.File.Pos() <= decl.Pos() && decl.Pos() < f.File.End() {
+			edits[f] = append(edits[f], f.textEdit(decl, to))
+			if doc != nil {
+				if first := doc.List[0]; strings.HasPrefix(first.Text, "// "+decl.Name+" ") {
+					edits[f] = append(edits[f], f.textEdit(first, "// "+to+first.Text[len("// "+decl.Name):]))
+				}
+			}
+		}
+	}
+	for _, ref := range refs {
+		if ref.Guess {
+			return fmt.Errorf("aster: can not rename %s: unresolved selector at %s", from, ref.Pos)
+		}
+		edits[ref.File] = append(edits[ref.File], ref.File.textEdit(ref.Ident, to))
+	}
+	return applyFileEdits(files, edits)
+}
+
+// declToRename returns the name, doc comment and references of the
+// top-level declaration to rename.
+func (p *Package) declToRename(name, to string) (*ast.Ident, *ast.CommentGroup, []Ref, error) {
+	for _, f := range p.sortedFiles() {
+		for _, sym := range f.Symbols() {
+			if sym.Name != name || sym.Kind == ast.Pkg || sym.Ident.Obj == nil {
+				continue
+			}
+			if err := f.CheckCollision(to); err != nil {
+				return nil, nil, nil, err
+			}
+			decl, _ := sym.Ident.Obj.Decl.(ast.Node)
+			var doc *ast.CommentGroup
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				doc = d.Doc
+			case *ast.TypeSpec:
+				doc = d.Doc
+			case *ast.ValueSpec:
+				doc = d.Doc
+			}
+			if doc == nil {
+				// the doc of a declaration of a single spec
+				for _, gd := range f.File.Decls {
+					if gd, ok := gd.(*ast.GenDecl); ok && len(gd.Specs) == 1 && gd.Specs[0] == decl {
+						doc = gd.Doc
+					}
+				}
+			}
+			return sym.Ident, doc, f.topRefs(sym.Ident, decl), nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("aster: declaration not found: %s", name)
+}
+
+// memberToRename returns the name, doc comment and references of the
+// method or field of the type to rename.
+func (p *Package) memberToRename(typeName, name, to string) (*ast.Ident, *ast.CommentGroup, []Ref, error) {
+	t, ok := p.LookupType(typeName)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("aster: type not found: %s", typeName)
+	}
+	if _, ok := t.MethodByName(to, true); ok {
+		return nil, nil, nil, fmt.Errorf("aster: method already exists: %s.%s", typeName, to)
+	}
+	if t.Kind() == Struct {
+		if _, ok := t.FieldByName(to, true); ok {
+			return nil, nil, nil, fmt.Errorf("aster: field already exists: %s.%s", typeName, to)
+		}
+		if field, ok := t.FieldByName(name); ok && !field.Anonymous() {
+			for _, id := range field.Field.Names {
+				if id.Name == name {
+					return id, field.Field.Doc, field.References(), nil
+				}
+			}
+		}
+	}
+	if m, ok := t.MethodByName(name); ok {
+		switch d := m.Node().(type) {
+		case *ast.FuncDecl:
+			return d.Name, d.Doc, m.References(), nil
+		case *ast.Field:
+			return d.Names[0], d.Doc, m.References(), nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("aster: field or method not found: %s.%s", typeName, name)
+}
+
+// RenamePackage renames the package of the import path in the module, if
+// any, to the new import path and package name, or keeps its name if newName
+// is empty: the package clauses and the package doc comments are updated,
+// along with the ones of its external test package, and the files are moved
+// to the directory of the new path in the module of the nearest go.mod file,
+// so that they are written there, and the old ones are deleted by Store.
+// The imports of the package in the files of the module are rewritten, and
+// so are the identifiers qualified by the package name. The import is named
+// after the old name instead, if the new one is taken in the file.
+// The packages in the subdirectories are not moved.
+// Since a module is parsed from a directory, call it on each of the modules
+// of the tree to rewrite the importers too, see ParseTree.
+// NOTE: The files of the module are reparsed after renaming,
+// so the nodes must be looked up again.
+func (m *Module) RenamePackage(oldPath, newPath, newName string) error {
+	if newName != "" && (!token.IsIdentifier(newName) || newName == "_") {
+		return fmt.Errorf("aster: invalid package name: %q", newName)
+	}
+	var target, xtest *Package
+	for _, p := range m.sortedPackages() {
+		switch p.Path() {
+		case oldPath:
+			target = p
+		case oldPath + "_test":
+			xtest = p
+		}
+	}
+	oldName := path.Base(oldPath)
+	if target != nil {
+		oldName = target.Name
+	}
+	if newName == "" {
+		newName = oldName
+	}
+	var oldDir, newDir string
+	if target != nil {
+		if p, ok := m.Packages[newName]; ok && p != target {
+			return fmt.Errorf("aster: package already exists: %s", newName)
+		}
+		var err error
+		if oldDir, newDir, err = target.movedDir(newPath); err != nil {
+			return err
+		}
+	}
+
+	var files []*File
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			if err := f.refresh(); err != nil {
+				return err
+			}
+			files = append(files, f)
+		}
+	}
+	var edits = make(map[*File][]textEdit)
+	for _, f := range files {
+		switch {
+		case target != nil && f.pkg == target:
+			edits[f] = f.packageClauseEdits(oldName, newName)
+		case target != nil && f.pkg == xtest:
+			edits[f] = f.packageClauseEdits(oldName+"_test", newName+"_test")
+		}
+		edits[f] = append(edits[f], f.importPathEdits(oldPath, newPath, oldName, newName)...)
+	}
+	if err := applyFileEdits(files, edits); err != nil {
+		return err
+	}
+
+	for _, p := range []*Package{target, xtest} {
+		if p == nil {
+			continue
+		}
+		name := newName
+		if p == xtest {
+			name += "_test"
+		}
+		delete(m.Packages, p.Name)
+		p.Name = name
+		m.Packages[name] = p
+		if newDir == oldDir {
+			continue
+		}
+		if err := p.moveTo(newDir); err != nil {
+			return err
+		}
+	}
+	if target != nil && newDir != oldDir && filepath.Clean(m.Dir) == filepath.Clean(oldDir) {
+		m.Dir = newDir
+	}
+	return nil
+}
+
+// movedDir returns the directory of the package, and the one of the new
+// import path in the module of the nearest go.mod file, in the same form.
+func (p *Package) movedDir(newPath string) (string, string, error) {
+	if newPath == p.Path() {
+		return p.Dir, p.Dir, nil
+	}
+	root, modPath, ok := p.moduleRoot()
+	if !ok {
+		return "", "", fmt.Errorf("aster: no go.mod of the package: %s", p.Name)
+	}
+	if newPath != modPath && !strings.HasPrefix(newPath, modPath+"/") {
+		return "", "", fmt.Errorf("aster: %s is not in the module %s", newPath, modPath)
+	}
+	dir, err := filepath.Abs(p.Dir)
+	if err != nil {
+		return "", "", err
+	}
+	rel, err := filepath.Rel(dir, filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(newPath, modPath))))
+	if err != nil {
+		return "", "", err
+	}
+	newDir := filepath.Join(p.Dir, rel)
+	if goFiles, _ := filepath.Glob(filepath.Join(newDir, "*.go")); len(goFiles) > 0 {
+		return "", "", fmt.Errorf("aster: the directory of %s has Go files: %s", newPath, newDir)
+	}
+	return p.Dir, newDir, nil
+}
+
+// moveTo moves the files of the package to the directory,
+// and the old ones are deleted by Store, see RemoveFile.
+func (p *Package) moveTo(dir string) error {
+	files := p.sortedFiles()
+	p.Files = make(map[string]*File, len(files))
+	for _, f := range files {
+		p.removed = append(p.removed, f.Filename)
+		f.Filename = filepath.Join(dir, filepath.Base(f.Filename))
+		p.Files[f.Filename] = f
+	}
+	p.Dir = dir
+	for _, f := range files {
+		if err := f.Reparse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageClauseEdits returns the edits renaming the package clause of the
+// file, and the first word of the package doc comment.
+func (f *File) packageClauseEdits(oldName, newName string) []textEdit {
+	if oldName == newName {
+		return nil
+	}
+	edits := []textEdit{f.textEdit(f.File.Name, newName)}
+	if doc := f.File.Doc; doc != nil {
+		for _, c := range doc.List {
+			if strings.HasPrefix(c.Text, "// Package "+oldName+" ") {
+				edits = append(edits, f.textEdit(c, "// Package "+newName+c.Text[len("// Package "+oldName):]))
+			}
+		}
+	}
+	return edits
+}
+
+// importPathEdits returns the edits rewriting the imports of the old path
+// in the file, and the identifiers qualified by the old package name.
+func (f *File) importPathEdits(oldPath, newPath, oldName, newName string) []textEdit {
+	var edits []textEdit
+	for _, imp := range f.Imports {
+		if imp.Path != oldPath {
+			continue
+		}
+		if imp.ImportSpec.Name != nil || oldName == newName {
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, strconv.Quote(newPath)))
+			continue
+		}
+		if f.nameTaken(newName) {
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, oldName+" "+strconv.Quote(newPath)))
+			continue
+		}
+		edits = append(edits, f.textEdit(imp.ImportSpec.Path, strconv.Quote(newPath)))
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			// a package name is not resolved to a local object
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && x.Name == oldName {
+				edits = append(edits, f.textEdit(x, newName))
+			}
+			return true
+		})
+	}
+	return edits
+}
+
+// nameTaken reports whether the name is declared in the package of the file,
+// or imported by the file.
+func (f *File) nameTaken(name string) bool {
+	for _, imp := range f.Imports {
+		if imp.Name == name {
+			return true
+		}
+	}
+	if f.File.Scope != nil && f.File.Scope.Lookup(name) != nil {
+		return true
+	}
+	return f.pkg != nil && f.pkg.Scope != nil && f.pkg.Scope.Lookup(name) != nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// RewriteImportPath rewrites the imports of the path old, and of the
+// packages under it, to the path new across the module, e.g. after a
+// repository rename, see File.RewriteImportPath.
+// Returns the number of rewritten imports, and the first error.
+// NOTE: The go.mod file is not changed.
+func (m *Module) RewriteImportPath(old, new string) (int, error) {
+	var count int
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			n, err := f.RewriteImportPath(old, new)
+			count += n
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// RewriteImportPath rewrites the imports of the path old, and of the
+// packages under it, to the path new, e.g. old/sub to new/sub.
+// An import named after the last element of its path is renamed with it,
+// along with the identifiers it qualifies, unless the new name conflicts
+// with another import or a declaration of the file, or is not an identifier,
+// in which case the old name is kept as an explicit one. An explicit name
+// is kept, unless it is the new name itself.
+// Returns the number of rewritten imports.
+// Returns an error if the file imports a rewritten path already.
+// NOTE: The file is reparsed after rewriting.
+func (f *File) RewriteImportPath(old, new string) (int, error) {
+	type rewrite struct {
+		imp  *Import
+		path string
+	}
+	var rewrites []rewrite
+	for _, imp := range f.Imports {
+		if imp.Path == old || strings.HasPrefix(imp.Path, old+"/") {
+			rewrites = append(rewrites, rewrite{imp, new + imp.Path[len(old):]})
+		}
+	}
+	if len(rewrites) == 0 {
+		return 0, nil
+	}
+	for _, r := range rewrites {
+		if f.importsPath("", r.path) {
+			return 0, fmt.Errorf("aster: %s imports %q already", f.Filename, r.path)
+		}
+	}
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	// the imports of the reparsed file
+	for i := range rewrites {
+		for _, imp := range f.Imports {
+			if imp.Path == rewrites[i].imp.Path {
+				rewrites[i].imp = imp
+			}
+		}
+	}
+
+	var edits []textEdit
+	var renames = make(map[string]string) // <old name, new name>
+	for _, r := range rewrites {
+		imp, quoted := r.imp, strconv.Quote(r.path)
+		name, oldName := defaultImportName(r.path), imp.Name
+		if d := defaultImportName(imp.Path); imp.ImportSpec.Name == nil && d != "" {
+			oldName = d
+		}
+		switch {
+		case imp.Name == "_" || imp.Name == ".":
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, quoted))
+		case imp.ImportSpec.Name != nil:
+			if imp.Name == name {
+				// the explicit name is redundant
+				edits = append(edits, textEdit{start: f.offset(imp.ImportSpec.Name.Pos()), end: f.offset(imp.ImportSpec.Path.End()), text: quoted})
+			} else {
+				edits = append(edits, f.textEdit(imp.ImportSpec.Path, quoted))
+			}
+		case name == oldName:
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, quoted))
+		case name != "" && !f.importNameTaken(name, imp):
+			renames[oldName] = name
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, quoted))
+		default:
+			edits = append(edits, f.textEdit(imp.ImportSpec.Path, oldName+" "+quoted))
+		}
+	}
+	if len(renames) > 0 {
+		ast.Inspect(f.File, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			// a package name is not resolved to a local object
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				if name, ok := renames[x.Name]; ok {
+					edits = append(edits, f.textEdit(x, name))
+				}
+			}
+			return true
+		})
+	}
+	return len(rewrites), f.applyEdits(edits)
+}
+
+// importNameTaken reports whether the name is taken in the file by an import
+// other than imp, a package-level declaration or a local one.
+func (f *File) importNameTaken(name string, imp *Import) bool {
+	for _, other := range f.Imports {
+		if other != imp && other.Name == name {
+			return true
+		}
+	}
+	if f.declaredInPkg(name) {
+		return true
+	}
+	var taken bool
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		if x, ok := n.(*ast.Ident); ok && x.Name == name && x.Obj != nil {
+			taken = true
+		}
+		return !taken
+	})
+	return taken
+}
+
+// defaultImportName returns the name of the package imported by the path,
+// assumed to be the last element, skipping a major version,
+// or "" if it is not an identifier.
+func defaultImportName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if isVersionElem(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
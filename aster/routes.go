@@ -0,0 +1,397 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Route is an HTTP route registered by a call in a function of the module.
+type Route struct {
+	Router  string // the name of the router, e.g. "gin", see RouteCall
+	Method  string // the HTTP method, e.g. "GET", or "" for any
+	Path    string // the path pattern with the prefixes of the groups, or "" if not constant
+	Handler FuncNode
+	// HandlerExpr is the source of the handler expression, e.g. "s.listUsers"
+	HandlerExpr string
+	Func        FuncNode       // the function registering the route
+	Pos         token.Position // the position of the registration call
+}
+
+// RouteCall is a call registering a route, recognized by a RouteMatcher.
+type RouteCall struct {
+	Router  string   // the name of the router
+	Method  string   // the HTTP method, or "" for any
+	Path    ast.Expr // the path pattern
+	Handler ast.Expr // the handler, a function or an http.Handler
+}
+
+// RouteMatcher recognizes the call of the file registering a route.
+type RouteMatcher func(f *File, call *ast.CallExpr) (*RouteCall, bool)
+
+// DefaultRouteMatchers are the matchers of Routes by default,
+// in the order of matching.
+var DefaultRouteMatchers = []RouteMatcher{GinRoutes, EchoRoutes, ChiRoutes, HTTPRoutes}
+
+// Routes returns the HTTP routes registered by the calls in the functions
+// of the module, recognized by the first of the matchers matching the call,
+// DefaultRouteMatchers if none, sorted by path, method and position.
+// The path is the constant pattern prefixed by the ones of the groups of the
+// receiver, e.g. of Group in gin and echo, or Route in chi, and a pattern of
+// the form "METHOD /path", as of net/http since Go 1.22, sets the method.
+// The handler is resolved as the callees of CallGraph with the methods,
+// or to the ServeHTTP method of an http.Handler, and is nil if not found,
+// e.g. of a function literal.
+// NOTE: The module is not type-checked, so the routers are recognized by
+// the imports of the files and the names of the methods.
+func (m *Module) Routes(matchers ...RouteMatcher) []*Route {
+	if len(matchers) == 0 {
+		matchers = DefaultRouteMatchers
+	}
+	var routes []*Route
+	for _, p := range m.Packages {
+		for _, f := range p.Files {
+			var parents map[ast.Node]ast.Node
+			ast.Inspect(f.File, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn := f.enclosingFunc(call.Pos())
+				if fn == nil {
+					return true
+				}
+				for _, match := range matchers {
+					rc, ok := match(f, call)
+					if !ok {
+						continue
+					}
+					if parents == nil {
+						parents = parentMap(f.File)
+					}
+					routes = append(routes, f.route(rc, call, fn, parents))
+					break
+				}
+				return true
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.Pos.Filename != b.Pos.Filename {
+			return a.Pos.Filename < b.Pos.Filename
+		}
+		return a.Pos.Offset < b.Pos.Offset
+	})
+	return routes
+}
+
+// route resolves the route of the registration call.
+func (f *File) route(rc *RouteCall, call *ast.CallExpr, fn FuncNode, parents map[ast.Node]ast.Node) *Route {
+	r := &Route{
+		Router: rc.Router,
+		Method: rc.Method,
+		Func:   fn,
+		Pos:    f.FileSet.Position(call.Pos()),
+	}
+	if path, ok := f.constString(rc.Path, 0); ok {
+		if i := strings.IndexAny(path, " \t"); i > 0 && r.Method == "" && strings.ToUpper(path[:i]) == path[:i] {
+			r.Method, path = path[:i], strings.TrimLeft(path[i:], " \t")
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+			if prefix := f.routePrefix(sel.X, parents, 0); prefix != "" {
+				path = strings.TrimSuffix(prefix, "/") + path
+			}
+		}
+		r.Path = path
+	}
+	if rc.Handler != nil {
+		r.HandlerExpr = f.source(rc.Handler)
+		r.Handler, _ = f.routeHandler(rc.Handler)
+	}
+	return r
+}
+
+// routeHandler returns the function of the handler expression.
+func (f *File) routeHandler(x ast.Expr) (FuncNode, bool) {
+	switch e := x.(type) {
+	case *ast.ParenExpr:
+		return f.routeHandler(e.X)
+	case *ast.FuncLit:
+		return nil, false
+	case *ast.CallExpr:
+		// a conversion or an adapter, e.g. http.HandlerFunc(h) or gin.WrapF(h)
+		if len(e.Args) == 1 {
+			if fn, ok := f.routeHandler(e.Args[0]); ok {
+				return fn, true
+			}
+		}
+	}
+	if fn, ok := f.callee(x, true); ok {
+		return fn, true
+	}
+	if t, _ := f.inferType(x, 0); t != nil {
+		return t.MethodByName("ServeHTTP", true)
+	}
+	return nil, false
+}
+
+// routePrefix returns the path prefix of the router expression, i.e. the
+// patterns of the groups it is created by, e.g. "/api/v1" of v1 in
+//
+//	api := r.Group("/api")
+//	v1 := api.Group("/v1")
+//
+// or of r in chi's
+//
+//	r.Route("/api", func(r chi.Router) { ... })
+func (f *File) routePrefix(x ast.Expr, parents map[ast.Node]ast.Node, depth int) string {
+	if depth > maxInferDepth {
+		return ""
+	}
+	depth++
+	switch e := x.(type) {
+	case *ast.ParenExpr:
+		return f.routePrefix(e.X, parents, depth)
+	case *ast.CallExpr:
+		sel, ok := e.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return ""
+		}
+		prefix := f.routePrefix(sel.X, parents, depth)
+		switch sel.Sel.Name {
+		case "Group":
+			if len(e.Args) > 0 {
+				if s, ok := f.constString(e.Args[0], 0); ok {
+					return strings.TrimSuffix(prefix, "/") + s
+				}
+			}
+		case "With":
+			return prefix
+		}
+		return ""
+	case *ast.Ident:
+		if e.Obj == nil {
+			return ""
+		}
+		switch d := e.Obj.Decl.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range d.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == e.Name && len(d.Lhs) == len(d.Rhs) {
+					return f.routePrefix(d.Rhs[i], parents, depth)
+				}
+			}
+		case *ast.ValueSpec:
+			for i, id := range d.Names {
+				if id.Name == e.Name && len(d.Names) == len(d.Values) {
+					return f.routePrefix(d.Values[i], parents, depth)
+				}
+			}
+		case *ast.Field:
+			// the parameter of the function literal passed to chi's Route
+			lit, ok := parents[parents[parents[d]]].(*ast.FuncLit)
+			if !ok {
+				return ""
+			}
+			call, ok := parents[lit].(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 || call.Args[1] != lit {
+				return ""
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Route" {
+				return ""
+			}
+			if s, ok := f.constString(call.Args[0], 0); ok {
+				return strings.TrimSuffix(f.routePrefix(sel.X, parents, depth), "/") + s
+			}
+		}
+	}
+	return ""
+}
+
+// constString returns the value of the constant string expression,
+// e.g. a literal, a concatenation or a constant of the package.
+func (f *File) constString(x ast.Expr, depth int) (string, bool) {
+	if depth > maxInferDepth {
+		return "", false
+	}
+	depth++
+	switch e := x.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			s, err := strconv.Unquote(e.Value)
+			return s, err == nil
+		}
+	case *ast.ParenExpr:
+		return f.constString(e.X, depth)
+	case *ast.BinaryExpr:
+		if e.Op == token.ADD {
+			a, ok := f.constString(e.X, depth)
+			if !ok {
+				return "", false
+			}
+			b, ok := f.constString(e.Y, depth)
+			return a + b, ok
+		}
+	case *ast.Ident:
+		g, obj := f, e.Obj
+		if obj == nil && f.pkg != nil {
+			// a constant declared in another file of the package
+			for _, pf := range f.pkg.Files {
+				if o := pf.File.Scope.Lookup(e.Name); o != nil {
+					g, obj = pf, o
+					break
+				}
+			}
+		}
+		if obj == nil || obj.Kind != ast.Con {
+			return "", false
+		}
+		if vs, ok := obj.Decl.(*ast.ValueSpec); ok {
+			for i, id := range vs.Names {
+				if id.Name == e.Name && i < len(vs.Values) {
+					return g.constString(vs.Values[i], depth)
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// routeMethod returns the HTTP method of the expression,
+// e.g. "GET" of "GET" or http.MethodGet.
+func (f *File) routeMethod(x ast.Expr) string {
+	if s, ok := f.constString(x, 0); ok {
+		return strings.ToUpper(s)
+	}
+	if sel, ok := x.(*ast.SelectorExpr); ok && strings.HasPrefix(sel.Sel.Name, "Method") {
+		return strings.ToUpper(strings.TrimPrefix(sel.Sel.Name, "Method"))
+	}
+	return ""
+}
+
+// importsPath reports whether the file imports the package of the path,
+// or of one of its major versions, e.g. "github.com/labstack/echo/v4".
+func (f *File) importsRouter(path string) bool {
+	for _, imp := range f.Imports {
+		if imp.Path == path || strings.HasPrefix(imp.Path, path+"/v") {
+			return true
+		}
+	}
+	return false
+}
+
+// routeSelector returns the selector of the method called by the call,
+// with at least n arguments.
+func routeSelector(call *ast.CallExpr, n int) (*ast.SelectorExpr, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) < n {
+		return nil, false
+	}
+	return sel, true
+}
+
+// HTTPRoutes matches the registrations of net/http, i.e. Handle and
+// HandleFunc of the package or a ServeMux.
+func HTTPRoutes(f *File, call *ast.CallExpr) (*RouteCall, bool) {
+	sel, ok := routeSelector(call, 2)
+	if !ok || len(call.Args) != 2 || sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc" || !f.importsRouter("net/http") {
+		return nil, false
+	}
+	return &RouteCall{Router: "net/http", Path: call.Args[0], Handler: call.Args[1]}, true
+}
+
+// GinRoutes matches the registrations of github.com/gin-gonic/gin, e.g.
+// r.GET(path, handlers...), r.Any and r.Handle(method, path, handlers...),
+// whose handler is the last one.
+func GinRoutes(f *File, call *ast.CallExpr) (*RouteCall, bool) {
+	sel, ok := routeSelector(call, 2)
+	if !ok || !f.importsRouter("github.com/gin-gonic/gin") {
+		return nil, false
+	}
+	rc := &RouteCall{Router: "gin", Path: call.Args[0], Handler: call.Args[len(call.Args)-1]}
+	switch name := sel.Sel.Name; name {
+	case "GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS":
+		rc.Method = name
+	case "Any":
+	case "Handle":
+		if len(call.Args) < 3 {
+			return nil, false
+		}
+		rc.Method, rc.Path = f.routeMethod(call.Args[0]), call.Args[1]
+	default:
+		return nil, false
+	}
+	return rc, true
+}
+
+// EchoRoutes matches the registrations of github.com/labstack/echo, e.g.
+// e.GET(path, handler, middlewares...), e.Any and
+// e.Add(method, path, handler, middlewares...).
+func EchoRoutes(f *File, call *ast.CallExpr) (*RouteCall, bool) {
+	sel, ok := routeSelector(call, 2)
+	if !ok || !f.importsRouter("github.com/labstack/echo") {
+		return nil, false
+	}
+	rc := &RouteCall{Router: "echo", Path: call.Args[0], Handler: call.Args[1]}
+	switch name := sel.Sel.Name; name {
+	case "GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "CONNECT", "TRACE":
+		rc.Method = name
+	case "Any":
+	case "Add":
+		if len(call.Args) < 3 {
+			return nil, false
+		}
+		rc.Method, rc.Path, rc.Handler = f.routeMethod(call.Args[0]), call.Args[1], call.Args[2]
+	default:
+		return nil, false
+	}
+	return rc, true
+}
+
+// ChiRoutes matches the registrations of github.com/go-chi/chi, e.g.
+// r.Get(path, handler), r.Handle, r.HandleFunc and
+// r.Method(method, path, handler).
+func ChiRoutes(f *File, call *ast.CallExpr) (*RouteCall, bool) {
+	sel, ok := routeSelector(call, 2)
+	if !ok || !f.importsRouter("github.com/go-chi/chi") {
+		return nil, false
+	}
+	rc := &RouteCall{Router: "chi", Path: call.Args[0], Handler: call.Args[1]}
+	switch name := sel.Sel.Name; name {
+	case "Get", "Post", "Put", "Delete", "Patch", "Head", "Options", "Connect", "Trace":
+		rc.Method = strings.ToUpper(name)
+	case "Handle", "HandleFunc":
+	case "Method", "MethodFunc":
+		if len(call.Args) != 3 {
+			return nil, false
+		}
+		rc.Method, rc.Path, rc.Handler = f.routeMethod(call.Args[0]), call.Args[1], call.Args[2]
+		return rc, true
+	default:
+		return nil, false
+	}
+	return rc, len(call.Args) == 2
+}
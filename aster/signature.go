@@ -0,0 +1,600 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// SigParam is a parameter or result of the signature changed by
+// FuncNode.ChangeSignature.
+type SigParam struct {
+	// From is the index of the original parameter or result,
+	// or -1 for a new one.
+	From int
+	// Name and Type declare a new one, e.g. "ctx" and "context.Context".
+	// They are ignored for an original one.
+	Name string
+	Type string
+	// Value is the argument passed for a new parameter at the calls,
+	// e.g. "context.TODO()", or the value returned for a new result.
+	Value string
+}
+
+// KeepParam returns the original parameter or result of the index i.
+func KeepParam(i int) SigParam {
+	return SigParam{From: i}
+}
+
+// NewParam returns a new parameter or result.
+func NewParam(name, typ, value string) SigParam {
+	return SigParam{From: -1, Name: name, Type: typ, Value: value}
+}
+
+// sigPart is a parameter or result of a signature.
+type sigPart struct {
+	name, typ string
+	field     int // the index of the field declaring it, or -1 if new
+}
+
+// ChangeSignature adds, removes and reorders the parameters and the results
+// of the function declaration, and rewrites the calls across the module and
+// the return statements of the body to match.
+// The new arguments and results are given by the values of SigParam, and the
+// removed arguments and the results of the calls are dropped, e.g.
+//
+//	// adds ctx context.Context first
+//	f.ChangeSignature([]SigParam{
+//		NewParam("ctx", "context.Context", "context.TODO()"),
+//		KeepParam(0),
+//		KeepParam(1),
+//	}, nil)
+//
+// The nil params or results are kept unchanged.
+// Returns an error without changes if a removed parameter or named result is
+// used by the body, or a call can not be rewritten, e.g. the function is
+// used as a value, the results of a call are passed to another, a removed
+// argument may have side effects, or a variable assigned a removed result
+// is used elsewhere.
+// NOTE: The files of the module are reparsed after changing,
+// so the nodes must be looked up again.
+func (f *FuncDecl) ChangeSignature(params, results []SigParam) error {
+	decl, ok := f.node.(*ast.FuncDecl)
+	if !ok || decl.Body == nil {
+		return fmt.Errorf("aster: not a function declaration with body: %s", f.Name())
+	}
+	file, name, recv := f.file, f.Name(), recvTypeName(f)
+	if _, err := file.refreshModule(); err != nil {
+		return err
+	}
+	n, ok := file.lookupTopNode(name, Func, recv)
+	if !ok {
+		return fmt.Errorf("aster: function not found: %s", name)
+	}
+	decl = n.(*FuncDecl).node.(*ast.FuncDecl)
+	oldParams, oldResults := sigParts(file, decl.Type.Params), sigParts(file, decl.Type.Results)
+	if params == nil {
+		params = keepParams(len(oldParams))
+	}
+	if results == nil {
+		results = keepParams(len(oldResults))
+	}
+	variadic := decl.Type.Params != nil && len(decl.Type.Params.List) > 0 &&
+		isEllipsis(decl.Type.Params.List[len(decl.Type.Params.List)-1].Type)
+	if err := checkSigParams(params, len(oldParams), variadic); err != nil {
+		return err
+	}
+	if err := checkSigParams(results, len(oldResults), false); err != nil {
+		return err
+	}
+	newParams, err := changedParts(oldParams, params)
+	if err != nil {
+		return err
+	}
+	newResults, err := changedParts(oldResults, results)
+	if err != nil {
+		return err
+	}
+	if err = checkSigNames(decl, oldParams, params, oldResults, results); err != nil {
+		return err
+	}
+	// checks the calls before any changes
+	if _, err = n.(*FuncDecl).sigCallEdits(params, results, len(oldParams), len(oldResults), variadic); err != nil {
+		return err
+	}
+
+	// the declaration
+	var edits []textEdit
+	if decl.Type.Params != nil {
+		edits = append(edits, textEdit{
+			start: file.offset(decl.Type.Params.Opening),
+			end:   file.offset(decl.Type.Params.Closing) + 1,
+			text:  "(" + joinSigParts(newParams) + ")",
+		})
+	}
+	text := joinSigParts(newResults)
+	if len(newResults) > 1 || len(newResults) == 1 && newResults[0].name != "" {
+		text = "(" + text + ")"
+	}
+	switch {
+	case decl.Type.Results != nil:
+		if text == "" {
+			edits = append(edits, textEdit{start: file.offset(decl.Type.Params.End()), end: file.offset(decl.Type.Results.End())})
+		} else {
+			edits = append(edits, file.textEdit(decl.Type.Results, text))
+		}
+	case text != "":
+		at := file.offset(decl.Type.Params.End())
+		edits = append(edits, textEdit{start: at, end: at, text: " " + text})
+	}
+	if !sigUnchanged(results, len(oldResults)) {
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				if len(x.Results) == 0 {
+					return true
+				}
+				values := make([]string, len(results))
+				for i, r := range results {
+					if r.From < 0 {
+						values[i] = r.Value
+					} else {
+						values[i] = file.source(x.Results[r.From])
+					}
+				}
+				text := "return"
+				if len(values) > 0 {
+					text += " " + strings.Join(values, ", ")
+				}
+				edits = append(edits, file.textEdit(x, text))
+			}
+			return true
+		})
+	}
+	if err = file.applyEdits(edits); err != nil {
+		return err
+	}
+	if err = file.FixImports(); err != nil {
+		return err
+	}
+
+	// the calls
+	if _, err = file.refreshModule(); err != nil {
+		return err
+	}
+	if n, ok = file.lookupTopNode(name, Func, recv); !ok {
+		return fmt.Errorf("aster: function not found: %s", name)
+	}
+	fileEdits, err := n.(*FuncDecl).sigCallEdits(params, results, len(oldParams), len(oldResults), variadic)
+	if err != nil {
+		return err
+	}
+	for _, f := range file.moduleFiles() {
+		if edits, ok := fileEdits[f]; ok {
+			if err = f.applyEdits(edits); err != nil {
+				return err
+			}
+			if err = f.FixImports(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sigCallEdits returns the edits of the calls of the function
+// with the changed signature.
+func (f *FuncDecl) sigCallEdits(params, results []SigParam, numParams, numResults int, variadic bool) (map[*File][]textEdit, error) {
+	decl := f.node.(*ast.FuncDecl)
+	edits := make(map[*File][]textEdit)
+	parentMaps := make(map[*File]map[ast.Node]ast.Node)
+	keepResults := sigUnchanged(results, numResults)
+	keptParams := make(map[int]bool, len(params))
+	for _, p := range params {
+		keptParams[p.From] = true
+	}
+	calls := make(map[*File][]*ast.CallExpr)
+	for _, ref := range f.References() {
+		if ref.Guess || ref.File == f.file && ref.Ident == decl.Name {
+			continue
+		}
+		file := ref.File
+		parents, ok := parentMaps[file]
+		if !ok {
+			parents = parentMap(file.File)
+			parentMaps[file] = parents
+		}
+		var call *ast.CallExpr
+		switch p := parents[ref.Ident].(type) {
+		case *ast.CallExpr:
+			if p.Fun == ref.Ident {
+				call = p
+			}
+		case *ast.SelectorExpr:
+			if p.Sel == ref.Ident {
+				call, _ = parents[p].(*ast.CallExpr)
+				if call != nil && call.Fun != p {
+					call = nil
+				}
+			}
+		}
+		if call == nil {
+			return nil, fmt.Errorf("aster: can not change the signature of the function used as a value at %s", ref.Pos)
+		}
+		if fixed := numParams - 1; variadic && len(call.Args) < fixed || !variadic && len(call.Args) != numParams {
+			return nil, fmt.Errorf("aster: can not rewrite the arguments of the call at %s", file.FileSet.Position(call.Pos()))
+		}
+		for i, x := range call.Args {
+			if variadic && i >= numParams {
+				i = numParams - 1
+			}
+			if !keptParams[i] && hasSideEffects(x) {
+				return nil, fmt.Errorf("aster: can not remove the argument with side effects at %s", file.FileSet.Position(x.Pos()))
+			}
+		}
+
+		calls[file] = append(calls[file], call)
+		if keepResults {
+			continue
+		}
+
+		// the results
+		switch p := parents[call].(type) {
+		case *ast.ExprStmt, *ast.GoStmt, *ast.DeferStmt:
+		case *ast.AssignStmt:
+			if len(p.Rhs) != 1 || len(p.Lhs) != numResults {
+				return nil, fmt.Errorf("aster: can not rewrite the results of the call at %s", file.FileSet.Position(call.Pos()))
+			}
+			if id, ok := file.sigDroppedUsed(p, p.Lhs, results); ok {
+				return nil, fmt.Errorf("aster: the variable assigned the removed result is used: %s at %s", id.Name, file.FileSet.Position(id.Pos()))
+			}
+			lhs := make([]string, len(p.Lhs))
+			for i, x := range p.Lhs {
+				lhs[i] = file.source(x)
+			}
+			edits[file] = append(edits[file], file.sigResultEdit(p.Lhs[0].Pos(), p.Lhs[len(p.Lhs)-1].End(), call.Pos(), lhs, results, p.Tok == token.DEFINE))
+		case *ast.ValueSpec:
+			if len(p.Values) != 1 || len(p.Names) != numResults || len(results) == 0 {
+				return nil, fmt.Errorf("aster: can not rewrite the results of the call at %s", file.FileSet.Position(call.Pos()))
+			}
+			names := make([]ast.Expr, len(p.Names))
+			lhs := make([]string, len(p.Names))
+			for i, x := range p.Names {
+				names[i], lhs[i] = x, x.Name
+			}
+			if id, ok := file.sigDroppedUsed(p, names, results); ok {
+				return nil, fmt.Errorf("aster: the variable assigned the removed result is used: %s at %s", id.Name, file.FileSet.Position(id.Pos()))
+			}
+			edits[file] = append(edits[file], file.sigResultEdit(p.Pos(), p.Names[len(p.Names)-1].End(), call.Pos(), lhs, results, false))
+		default:
+			if len(results) != 1 || results[0].From != 0 {
+				return nil, fmt.Errorf("aster: can not rewrite the results of the call at %s", file.FileSet.Position(call.Pos()))
+			}
+		}
+	}
+
+	// the arguments, with the calls nested in them rewritten
+	for file, calls := range calls {
+		var argEdit func(call *ast.CallExpr) textEdit
+		source := func(x ast.Expr) string {
+			var nested []textEdit
+			base := file.offset(x.Pos())
+			for _, c := range calls {
+				if x.Pos() <= c.Lparen && c.Rparen < x.End() {
+					e := argEdit(c)
+					e.start, e.end = e.start-base, e.end-base
+					nested = append(nested, e)
+				}
+			}
+			// keeps the outermost ones
+			var outer []textEdit
+			for _, e := range nested {
+				contained := false
+				for _, o := range nested {
+					if o.start < e.start && e.end <= o.end {
+						contained = true
+					}
+				}
+				if !contained {
+					outer = append(outer, e)
+				}
+			}
+			return spliceEdits(file.source(x), outer)
+		}
+		argEdit = func(call *ast.CallExpr) textEdit {
+			fixed := numParams
+			if variadic {
+				fixed--
+			}
+			args := make([]string, numParams)
+			for i := 0; i < fixed; i++ {
+				args[i] = source(call.Args[i])
+			}
+			if variadic {
+				var rest []string
+				for _, x := range call.Args[fixed:] {
+					rest = append(rest, source(x))
+				}
+				args[fixed] = strings.Join(rest, ", ")
+			}
+			var values []string
+			for _, p := range params {
+				switch {
+				case p.From < 0:
+					values = append(values, p.Value)
+				case args[p.From] != "":
+					values = append(values, args[p.From])
+				}
+			}
+			text := strings.Join(values, ", ")
+			if call.Ellipsis.IsValid() {
+				text += "..."
+			}
+			return textEdit{start: file.offset(call.Lparen) + 1, end: file.offset(call.Rparen), text: text}
+		}
+		for _, call := range calls {
+			nested := false
+			for _, c := range calls {
+				for _, x := range c.Args {
+					if c != call && x.Pos() <= call.Pos() && call.End() <= x.End() {
+						nested = true
+					}
+				}
+			}
+			if !nested {
+				edits[file] = append(edits[file], argEdit(call))
+			}
+		}
+	}
+	return edits, nil
+}
+
+// sigDroppedUsed returns the variable of the operands of the statement which
+// is no longer assigned the results, but is used outside the statement.
+// The unresolved variables are regarded as used.
+func (f *File) sigDroppedUsed(stmt ast.Node, lhs []ast.Expr, results []SigParam) (*ast.Ident, bool) {
+	kept := make(map[int]bool, len(results))
+	for _, r := range results {
+		kept[r.From] = true
+	}
+	for i, x := range lhs {
+		id, ok := x.(*ast.Ident)
+		if !ok || kept[i] || id.Name == "_" {
+			continue
+		}
+		if id.Obj == nil {
+			return id, true
+		}
+		decl, ok := id.Obj.Decl.(ast.Node)
+		if !ok {
+			return id, true
+		}
+		for _, ref := range f.namedRefs(id, decl) {
+			if ref.Ident.Pos() < stmt.Pos() || stmt.End() <= ref.Ident.Pos() {
+				return id, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// hasSideEffects reports whether evaluating the expression may have side
+// effects, i.e. it calls a function or receives from a channel.
+func hasSideEffects(x ast.Expr) bool {
+	var effects bool
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			effects = true
+		case *ast.UnaryExpr:
+			effects = effects || n.Op == token.ARROW
+		}
+		return !effects
+	})
+	return effects
+}
+
+// sigResultEdit returns the edit of the operands [start,end) assigned the
+// results of the call at rhs.
+func (f *File) sigResultEdit(start, end, rhs token.Pos, lhs []string, results []SigParam, define bool) textEdit {
+	names := make([]string, len(results))
+	var fresh bool
+	for i, r := range results {
+		names[i] = "_"
+		if r.From >= 0 {
+			names[i] = lhs[r.From]
+		}
+		fresh = fresh || names[i] != "_"
+	}
+	switch {
+	case len(names) == 0:
+		// assigns nothing but calls
+		return textEdit{start: f.offset(start), end: f.offset(rhs)}
+	case define && !fresh:
+		return textEdit{start: f.offset(start), end: f.offset(rhs), text: strings.Join(names, ", ") + " = "}
+	}
+	return textEdit{start: f.offset(start), end: f.offset(end), text: strings.Join(names, ", ")}
+}
+
+// sigParts returns the parameters or results of the field list.
+func sigParts(f *File, fl *ast.FieldList) []sigPart {
+	if fl == nil {
+		return nil
+	}
+	var parts []sigPart
+	for i, field := range fl.List {
+		typ := f.source(field.Type)
+		if len(field.Names) == 0 {
+			parts = append(parts, sigPart{typ: typ, field: i})
+		}
+		for _, name := range field.Names {
+			parts = append(parts, sigPart{name: name.Name, typ: typ, field: i})
+		}
+	}
+	return parts
+}
+
+// changedParts returns the parameters or results of the changed signature.
+func changedParts(old []sigPart, changes []SigParam) ([]sigPart, error) {
+	named := len(old) > 0 && old[0].name != ""
+	if len(old) == 0 {
+		for _, c := range changes {
+			named = named || c.Name != ""
+		}
+	}
+	parts := make([]sigPart, len(changes))
+	for i, c := range changes {
+		switch {
+		case c.From >= 0:
+			parts[i] = old[c.From]
+			continue
+		case c.Type == "":
+			return nil, fmt.Errorf("aster: the type of the new parameter is empty: %s", c.Name)
+		}
+		parts[i] = sigPart{typ: c.Type, field: -1}
+		if named {
+			parts[i].name = c.Name
+			if c.Name == "" {
+				parts[i].name = "_"
+			}
+		}
+	}
+	return parts, nil
+}
+
+// joinSigParts returns the source text of the parameters or results,
+// grouping those still declared by the same field.
+func joinSigParts(parts []sigPart) string {
+	var b strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if p.name == "" {
+			b.WriteString(p.typ)
+			continue
+		}
+		b.WriteString(p.name)
+		if i+1 < len(parts) && p.field >= 0 && parts[i+1].field == p.field && parts[i+1].name != "" {
+			continue
+		}
+		b.WriteString(" " + p.typ)
+	}
+	return b.String()
+}
+
+// checkSigParams checks the changes of the n parameters or results.
+func checkSigParams(changes []SigParam, n int, variadic bool) error {
+	seen := make(map[int]bool)
+	for i, c := range changes {
+		switch {
+		case c.From >= n:
+			return fmt.Errorf("aster: index out of range: %d", c.From)
+		case c.From >= 0 && seen[c.From]:
+			return fmt.Errorf("aster: duplicate index: %d", c.From)
+		case c.From < 0 && c.Value == "":
+			return fmt.Errorf("aster: the value of the new parameter is empty: %s", c.Name)
+		case variadic && c.From == n-1 && i != len(changes)-1:
+			return fmt.Errorf("aster: the variadic parameter must be the last")
+		}
+		seen[c.From] = true
+	}
+	return nil
+}
+
+// checkSigNames checks that the removed parameters and named results are not
+// used by the body, and the new names are not taken.
+func checkSigNames(decl *ast.FuncDecl, oldParams []sigPart, params []SigParam, oldResults []sigPart, results []SigParam) error {
+	used := make(map[string]bool)
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	names := make(map[string]bool)
+	if decl.Recv != nil {
+		for _, field := range decl.Recv.List {
+			for _, name := range field.Names {
+				names[name.Name] = true
+			}
+		}
+	}
+	check := func(old []sigPart, changes []SigParam) error {
+		kept := make(map[int]bool)
+		for _, c := range changes {
+			kept[c.From] = true
+		}
+		for i, p := range old {
+			if !kept[i] && p.name != "" && p.name != "_" && used[p.name] {
+				return fmt.Errorf("aster: the removed parameter is used: %s", p.name)
+			}
+			if kept[i] && p.name != "" && p.name != "_" {
+				names[p.name] = true
+			}
+		}
+		return nil
+	}
+	if err := check(oldParams, params); err != nil {
+		return err
+	}
+	if err := check(oldResults, results); err != nil {
+		return err
+	}
+	for _, c := range append(append([]SigParam(nil), params...), results...) {
+		if c.From >= 0 || c.Name == "" || c.Name == "_" {
+			continue
+		}
+		if names[c.Name] || used[c.Name] {
+			return fmt.Errorf("aster: the name of the new parameter is taken: %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// sigUnchanged reports whether the changes keep the n parameters or results.
+func sigUnchanged(changes []SigParam, n int) bool {
+	if len(changes) != n {
+		return false
+	}
+	for i, c := range changes {
+		if c.From != i {
+			return false
+		}
+	}
+	return true
+}
+
+// keepParams returns the changes keeping the n parameters or results.
+func keepParams(n int) []SigParam {
+	changes := make([]SigParam, n)
+	for i := range changes {
+		changes[i] = KeepParam(i)
+	}
+	return changes
+}
+
+func isEllipsis(x ast.Expr) bool {
+	_, ok := x.(*ast.Ellipsis)
+	return ok
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/parser"
+)
+
+// Snapshot returns an independent copy of the module as it is now,
+// reparsed from the formatted codes of its files, so the edits of the
+// syntax trees are kept. The snapshot shares nothing mutable with the
+// module but the FileSet, which is safe for concurrent use, so it can be
+// analyzed, e.g. by generators, while the module is mutated by another
+// goroutine.
+// The snapshot is safe for concurrent readers, and it must not be mutated.
+// NOTE: Snapshot itself must not run concurrently with mutations of the
+// module.
+func (m *Module) Snapshot() (*Module, error) {
+	s := &Module{
+		FileSet:       m.FileSet,
+		Dir:           m.Dir,
+		filter:        m.filter,
+		mode:          m.mode,
+		allErrors:     m.allErrors,
+		tests:         m.tests,
+		skipGenerated: m.skipGenerated,
+		visibility:    m.visibility,
+		importer:      m.Importer(),
+		Packages:      make(map[string]*Package, len(m.Packages)),
+	}
+	// the formatted codes are read by convertFile through the overlay
+	s.overlay = make(map[string][]byte)
+	for _, p := range m.sortedPackages() {
+		pkg := &ast.Package{Name: p.Name, Files: make(map[string]*ast.File, len(p.Files))}
+		for _, f := range p.sortedFiles() {
+			code, err := f.Format()
+			if err != nil {
+				return nil, err
+			}
+			file, err := parser.ParseFile(s.FileSet, f.Filename, code, f.mode)
+			if err != nil {
+				return nil, wrapError(f.Filename, []byte(code), err)
+			}
+			pkg.Files[f.Filename] = file
+			s.overlay[absPath(f.Filename)] = []byte(code)
+		}
+		sp := convertPackage(s, p.Dir, pkg)
+		sp.removed = append([]string(nil), p.removed...)
+		s.Packages[p.Name] = sp
+	}
+	for _, p := range m.removed {
+		rp := convertPackage(s, p.Dir, &ast.Package{Name: p.Name, Files: make(map[string]*ast.File)})
+		rp.removed = append([]string(nil), p.removed...)
+		s.removed = append(s.removed, rp)
+	}
+	if m.ModFile != nil {
+		s.ModFile = m.ModFile.clone()
+	}
+	s.overlay = nil
+	if len(m.overlay) > 0 {
+		s.overlay = make(map[string][]byte, len(m.overlay))
+		for filename, src := range m.overlay {
+			s.overlay[filename] = src
+		}
+	}
+	return s, nil
+}
+
+// clone returns an independent copy of the go.mod file.
+func (mf *ModFile) clone() *ModFile {
+	c := *mf
+	c.lines = append([]string(nil), mf.lines...)
+	c.Require = make([]*ModRequire, len(mf.Require))
+	for i, r := range mf.Require {
+		rc := *r
+		c.Require[i] = &rc
+	}
+	return &c
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/henrylee2cn/goutil"
+)
+
+// SplitPolicy returns the base name of the file to move a top-level
+// declaration to, or "" to keep it, where tok is token.FUNC, TYPE, CONST or
+// VAR, name is the first name it declares, and recv is the receiver type
+// name of a method.
+type SplitPolicy func(tok token.Token, name, recv string) string
+
+// SplitByType moves each type, along with its methods, to the file named
+// after the type in snake case, e.g. user_info.go for UserInfo.
+func SplitByType() SplitPolicy {
+	return func(tok token.Token, name, recv string) string {
+		switch {
+		case recv != "":
+			return goutil.SnakeString(recv) + ".go"
+		case tok == token.TYPE:
+			return goutil.SnakeString(name) + ".go"
+		}
+		return ""
+	}
+}
+
+// SplitByPrefix moves the declarations whose names, or receiver type names
+// for methods, start with one of the prefixes to the file named after the
+// longest matching prefix in snake case, e.g. user.go for User.
+func SplitByPrefix(prefixes ...string) SplitPolicy {
+	sorted := append([]string(nil), prefixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	return func(tok token.Token, name, recv string) string {
+		if recv != "" {
+			name = recv
+		}
+		for _, prefix := range sorted {
+			if prefix != "" && strings.HasPrefix(name, prefix) {
+				return goutil.SnakeString(prefix) + ".go"
+			}
+		}
+		return ""
+	}
+}
+
+// Split moves the top-level declarations of the file to the files of the
+// package chosen by the policy, along with their doc comments and the
+// imports they use. The new files are added to the package, with the package
+// clause and the build constraints of the file, and the existing ones are
+// merged into, see File.Merge. The file itself is removed from the package
+// if nothing is left in it, see Package.RemoveFile.
+// The test files are split into test files, e.g. user_test.go.
+// Returns the files added or changed, sorted by file name.
+// NOTE: The files are reparsed after splitting.
+func (f *File) Split(policy SplitPolicy) ([]*File, error) {
+	if f.pkg == nil {
+		return nil, fmt.Errorf("aster: the file is not in a package: %s", f.Filename)
+	}
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	var (
+		targets []string
+		chunks  = make(map[string][]string)
+		nodes   = make(map[string][]ast.Node)
+		edits   []textEdit
+		kept    int
+	)
+	for _, decl := range f.File.Decls {
+		tok, name, recv := splitKey(decl)
+		if tok == token.IMPORT {
+			continue
+		}
+		target := ""
+		if name != "" {
+			target = policy(tok, name, recv)
+		}
+		if target != "" && strings.HasSuffix(f.Filename, "_test.go") && !strings.HasSuffix(target, "_test.go") {
+			target = strings.TrimSuffix(target, ".go") + "_test.go"
+		}
+		if target == "" || target == filepath.Base(f.Filename) {
+			kept++
+			continue
+		}
+		start, end := f.offset(declStart(decl)), f.offset(decl.End())
+		if _, ok := chunks[target]; !ok {
+			targets = append(targets, target)
+		}
+		chunks[target] = append(chunks[target], string(f.Src[start:end]))
+		nodes[target] = append(nodes[target], decl)
+		start, end = f.lineRange(start, end)
+		edits = append(edits, textEdit{start: start, end: end})
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	// the imports are looked up before the declarations are removed
+	imports := make(map[string][]*Import, len(targets))
+	for _, target := range targets {
+		imports[target] = f.importsOf(nodes[target]...)
+	}
+	changed := make(map[*File]bool)
+	if kept == 0 && f.File.Doc == nil {
+		f.pkg.RemoveFile(f.Filename)
+	} else {
+		if err := f.applyEdits(edits); err != nil {
+			return nil, err
+		}
+		if err := f.FixImports(); err != nil {
+			return nil, err
+		}
+		changed[f] = true
+	}
+
+	var header bytes.Buffer
+	for _, line := range buildConstraints(f) {
+		header.WriteString(line + "\n")
+	}
+	if header.Len() > 0 {
+		header.WriteString("\n")
+	}
+	header.WriteString("package " + f.PkgName + "\n")
+	for _, target := range targets {
+		var src bytes.Buffer
+		switch imps := imports[target]; len(imps) {
+		case 0:
+		case 1:
+			src.WriteString("\nimport " + importSpec(imps[0]) + "\n")
+		default:
+			src.WriteString("\nimport (\n")
+			for _, imp := range imps {
+				src.WriteString("\t" + importSpec(imp) + "\n")
+			}
+			src.WriteString(")\n")
+		}
+		for _, chunk := range chunks[target] {
+			src.WriteString("\n" + chunk + "\n")
+		}
+		filename := filepath.Join(f.pkg.Dir, target)
+		if tf, ok := f.pkg.Files[filename]; ok {
+			if err := tf.Merge(src.Bytes()); err != nil {
+				return nil, err
+			}
+			changed[tf] = true
+			continue
+		}
+		tf, err := f.pkg.AddFile(target, append(header.Bytes(), src.Bytes()...))
+		if err != nil {
+			return nil, err
+		}
+		changed[tf] = true
+	}
+	files := make([]*File, 0, len(changed))
+	for cf := range changed {
+		files = append(files, cf)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	return files, nil
+}
+
+// splitKey returns the token, the first name and the receiver type name
+// of the top-level declaration.
+func splitKey(decl ast.Decl) (tok token.Token, name, recv string) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			if id, ok := recvBaseIdent(d.Recv.List[0].Type); ok {
+				recv = id.Name
+			}
+		}
+		return token.FUNC, d.Name.Name, recv
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				return d.Tok, s.Name.Name, ""
+			case *ast.ValueSpec:
+				return d.Tok, s.Names[0].Name, ""
+			}
+		}
+		return d.Tok, "", ""
+	}
+	return token.ILLEGAL, "", ""
+}
+
+// buildConstraints returns the //go:build and // +build lines of the file.
+func buildConstraints(f *File) []string {
+	var lines []string
+	for _, g := range f.File.Comments {
+		if g.Pos() >= f.File.Package {
+			break
+		}
+		for _, c := range g.List {
+			if strings.HasPrefix(c.Text, "//go:build") || strings.HasPrefix(c.Text, "// +build") {
+				lines = append(lines, c.Text)
+			}
+		}
+	}
+	return lines
+}
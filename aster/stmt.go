@@ -0,0 +1,133 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+)
+
+// StmtVisitor dispatches the statements and expressions of a function body
+// to the callbacks registered by type, so that the analyses need no raw
+// ast.Inspect, e.g. the returns of a function:
+//  v := aster.NewStmtVisitor().
+//  	OnReturn(func(s *ast.ReturnStmt) { ... })
+//  fn.WalkStmts(v)
+// The function literals in the body are not walked into, and the blocks are
+// not reported as statements, but their statements are.
+type StmtVisitor struct {
+	stmts   []func(ast.Stmt)
+	exprs   []func(ast.Expr)
+	assigns []func(*ast.AssignStmt)
+	returns []func(*ast.ReturnStmt)
+	calls   []func(*ast.CallExpr)
+}
+
+// NewStmtVisitor creates a statement visitor without callbacks.
+func NewStmtVisitor() *StmtVisitor {
+	return new(StmtVisitor)
+}
+
+// OnStmt registers the callback of all the statements.
+func (v *StmtVisitor) OnStmt(fn func(ast.Stmt)) *StmtVisitor {
+	v.stmts = append(v.stmts, fn)
+	return v
+}
+
+// OnExpr registers the callback of all the expressions, e.g. the operands
+// of the statements and their subexpressions.
+func (v *StmtVisitor) OnExpr(fn func(ast.Expr)) *StmtVisitor {
+	v.exprs = append(v.exprs, fn)
+	return v
+}
+
+// OnAssign registers the callback of the assignments and short variable
+// declarations.
+func (v *StmtVisitor) OnAssign(fn func(*ast.AssignStmt)) *StmtVisitor {
+	v.assigns = append(v.assigns, fn)
+	return v
+}
+
+// OnReturn registers the callback of the return statements.
+func (v *StmtVisitor) OnReturn(fn func(*ast.ReturnStmt)) *StmtVisitor {
+	v.returns = append(v.returns, fn)
+	return v
+}
+
+// OnCall registers the callback of the call expressions,
+// including the conversions, e.g. int(x).
+func (v *StmtVisitor) OnCall(fn func(*ast.CallExpr)) *StmtVisitor {
+	v.calls = append(v.calls, fn)
+	return v
+}
+
+// Stmts returns the statements of the function body, including the nested
+// ones but not those of the function literals, in source order.
+func (f *FuncDecl) Stmts() []ast.Stmt {
+	var stmts []ast.Stmt
+	f.WalkStmts(NewStmtVisitor().OnStmt(func(s ast.Stmt) {
+		stmts = append(stmts, s)
+	}))
+	return stmts
+}
+
+// WalkStmts dispatches the statements and expressions of the function body
+// to the visitor, in source order, see StmtVisitor.
+// The callbacks of a node are called in the order of registration,
+// those of OnStmt and OnExpr before those of the specific types.
+func (f *FuncDecl) WalkStmts(v *StmtVisitor) {
+	body := f.Body()
+	if body == nil {
+		return
+	}
+	for _, s := range body.List {
+		ast.Inspect(s, v.visit)
+	}
+}
+
+func (v *StmtVisitor) visit(n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.FuncLit:
+		for _, fn := range v.exprs {
+			fn(x)
+		}
+		return false
+	case *ast.BlockStmt:
+		return true
+	case ast.Stmt:
+		for _, fn := range v.stmts {
+			fn(x)
+		}
+		switch s := x.(type) {
+		case *ast.AssignStmt:
+			for _, fn := range v.assigns {
+				fn(s)
+			}
+		case *ast.ReturnStmt:
+			for _, fn := range v.returns {
+				fn(s)
+			}
+		}
+	case ast.Expr:
+		for _, fn := range v.exprs {
+			fn(x)
+		}
+		if call, ok := x.(*ast.CallExpr); ok {
+			for _, fn := range v.calls {
+				fn(call)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,286 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Placeholders of the hook command arguments.
+const (
+	// HookFile is replaced with the written file, for the file hooks.
+	HookFile = "{file}"
+	// HookFiles is expanded to all the written files, for the run hooks.
+	HookFiles = "{files}"
+)
+
+// StoreHook is a command or callback run after writing files.
+type StoreHook struct {
+	// Name names the hook in the results,
+	// defaults to the command line, or "func" for a callback.
+	Name string
+	// Command is the command line to run, e.g.
+	//  []string{"goimports", "-w", aster.HookFile}
+	//  []string{"git", "add", aster.HookFiles}
+	Command []string
+	// Func is the callback to run if Command is empty.
+	// It is passed the written file for the file hooks,
+	// and all the written files for the run hooks.
+	Func func(files []string) error
+}
+
+// StoreConfig configures StoreWith.
+type StoreConfig struct {
+	// FileHooks are run in order after writing each file.
+	// The remaining hooks of the file are skipped if one fails.
+	FileHooks []*StoreHook
+	// RunHooks are run in order once after writing all the files.
+	// The remaining hooks are skipped if one fails.
+	RunHooks []*StoreHook
+	// Dir is the working directory of the hook commands,
+	// defaults to the current directory.
+	Dir string
+	// Format configures the formatting, see FormatOptions.
+	Format *FormatOptions
+	// FS is the file system to write the files to, defaults to OSFS.
+	// The files removed from the module are deleted if it implements
+	// RemoveFS. NOTE: The hook commands are run on the local files.
+	FS WriteFileFS
+}
+
+// HookResult is the result of running a hook.
+type HookResult struct {
+	Hook     string
+	Files    []string // the files the hook was run on
+	Output   string   // the combined output of the command
+	Err      error
+	Duration time.Duration
+}
+
+// StoreResult is the result of StoreWith.
+type StoreResult struct {
+	Files []string      // the written files, sorted
+	Hooks []*HookResult // the results of the hooks, in running order
+}
+
+// Failed returns the results of the failed hooks.
+func (r *StoreResult) Failed() []*HookResult {
+	var failed []*HookResult
+	for _, h := range r.Hooks {
+		if h.Err != nil {
+			failed = append(failed, h)
+		}
+	}
+	return failed
+}
+
+// StoreWith formats the module codes, writes them to the file system
+// of cfg.FS, the local files by default, and runs the configured hooks.
+// Returns the first writing or hook error, along with the result
+// of the files written and hooks run so far, unless formatting fails.
+// In the continue-on-error mode of cfg.Format, the files formatted are
+// stored, and the Errors of the others returned if nothing else fails.
+func (m *Module) StoreWith(cfg *StoreConfig) (*StoreResult, error) {
+	opts := []*FormatOptions{cfg.formatOptions()}
+	codes, formatErr := m.Format(opts...)
+	if formatErr != nil && !continueOnError(opts) {
+		return nil, formatErr
+	}
+	var all = make(map[string]string)
+	for _, v := range codes {
+		for kk, vv := range v {
+			all[kk] = vv
+		}
+	}
+	r, err := storeWith(all, cfg)
+	for _, p := range m.Packages {
+		if err == nil {
+			err = p.deleteRemoved(cfg.fs())
+		}
+	}
+	if err == nil {
+		err = m.deleteRemoved(cfg.fs())
+	}
+	if err == nil {
+		err = m.storeModFile(cfg.fs())
+	}
+	if err == nil {
+		err = m.storeManifest(cfg.fs())
+	}
+	if err == nil {
+		err = formatErr
+	}
+	return r, err
+}
+
+// StoreWith formats the package codes, writes them to the file system
+// of cfg.FS, the local files by default, and runs the configured hooks.
+// Returns the first writing or hook error, along with the result
+// of the files written and hooks run so far, unless formatting fails.
+func (p *Package) StoreWith(cfg *StoreConfig) (*StoreResult, error) {
+	opts := []*FormatOptions{cfg.formatOptions()}
+	codes, formatErr := p.Format(opts...)
+	if formatErr != nil && !continueOnError(opts) {
+		return nil, formatErr
+	}
+	r, err := storeWith(codes, cfg)
+	if err == nil {
+		err = p.deleteRemoved(cfg.fs())
+	}
+	if err == nil {
+		err = p.module.storeManifest(cfg.fs())
+	}
+	if err == nil {
+		err = formatErr
+	}
+	return r, err
+}
+
+// StoreWith formats the file codes, writes them to the file system
+// of cfg.FS, the local file by default, and runs the configured hooks.
+// Returns the first writing or hook error, along with the result
+// of the file written and hooks run so far, unless formatting fails.
+func (f *File) StoreWith(cfg *StoreConfig) (*StoreResult, error) {
+	code, err := f.Format(cfg.formatOptions())
+	if err != nil {
+		return nil, err
+	}
+	r, err := storeWith(map[string]string{f.Filename: code}, cfg)
+	if err == nil && f.pkg != nil {
+		err = f.pkg.module.storeManifest(cfg.fs())
+	}
+	return r, err
+}
+
+func (c *StoreConfig) formatOptions() *FormatOptions {
+	if c == nil {
+		return nil
+	}
+	return c.Format
+}
+
+func (c *StoreConfig) fs() WriteFileFS {
+	if c == nil || c.FS == nil {
+		return OSFS
+	}
+	return c.FS
+}
+
+func storeWith(codes map[string]string, cfg *StoreConfig) (*StoreResult, error) {
+	var c StoreConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	var filenames = make([]string, 0, len(codes))
+	for k := range codes {
+		filenames = append(filenames, k)
+	}
+	sort.Strings(filenames)
+
+	var r = new(StoreResult)
+	var first error
+	for _, filename := range filenames {
+		err := fsWriteFile(c.fs(), filename, codes[filename])
+		if err != nil {
+			return r, err
+		}
+		r.Files = append(r.Files, filename)
+		for _, hook := range c.FileHooks {
+			h := runHook(hook, c.Dir, []string{filename}, HookFile)
+			r.Hooks = append(r.Hooks, h)
+			if h.Err != nil {
+				if first == nil {
+					first = h.Err
+				}
+				break
+			}
+		}
+	}
+	for _, hook := range c.RunHooks {
+		h := runHook(hook, c.Dir, r.Files, HookFiles)
+		r.Hooks = append(r.Hooks, h)
+		if h.Err != nil {
+			if first == nil {
+				first = h.Err
+			}
+			break
+		}
+	}
+	return r, first
+}
+
+// runHook runs the hook on the files, where placeholder is
+// the command argument to replace with them.
+func runHook(hook *StoreHook, dir string, files []string, placeholder string) *HookResult {
+	h := &HookResult{Hook: hook.Name, Files: files}
+	if h.Hook == "" {
+		h.Hook = strings.Join(hook.Command, " ")
+		if h.Hook == "" {
+			h.Hook = "func"
+		}
+	}
+	start := time.Now()
+	defer func() { h.Duration = time.Since(start) }()
+
+	if len(hook.Command) == 0 {
+		if hook.Func == nil {
+			h.Err = fmt.Errorf("aster: hook has neither command nor func: %s", h.Hook)
+			return h
+		}
+		h.Err = hook.Func(files)
+		if h.Err != nil {
+			h.Err = fmt.Errorf("aster: hook %s: %s", h.Hook, h.Err.Error())
+		}
+		return h
+	}
+
+	var args []string
+	for _, arg := range hook.Command[1:] {
+		if arg != placeholder {
+			args = append(args, arg)
+			continue
+		}
+		for _, file := range files {
+			if dir != "" {
+				file = absPath(file)
+			}
+			args = append(args, file)
+		}
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(hook.Command[0], args...)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	h.Output = out.String()
+	if err != nil {
+		h.Err = fmt.Errorf("aster: hook %s: %s", h.Hook, err.Error())
+	}
+	return h
+}
+
+func absPath(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// WriteFileFS is the file system to which StoreWith writes the files,
+// e.g. an in-memory file system, an archive or a remote artifact store,
+// see StoreConfig.FS. The names are the absolute paths of the files.
+type WriteFileFS interface {
+	WriteFile(name string, data []byte) error
+}
+
+// RemoveFS is a WriteFileFS deleting the files removed from the module,
+// see Package.RemoveFile and Module.RemovePackage.
+// The removed files are kept by a WriteFileFS not implementing it.
+type RemoveFS interface {
+	WriteFileFS
+	Remove(name string) error
+}
+
+// WriteFileFunc is a function writing the files as a WriteFileFS.
+type WriteFileFunc func(name string, data []byte) error
+
+// WriteFile calls fn(name, data).
+func (fn WriteFileFunc) WriteFile(name string, data []byte) error {
+	return fn(name, data)
+}
+
+// OSFS is the local file system, the default of StoreConfig.FS.
+var OSFS RemoveFS = osFS{}
+
+type osFS struct{}
+
+func (osFS) WriteFile(name string, data []byte) error {
+	return writeFile(name, string(data))
+}
+
+func (osFS) Remove(name string) error {
+	err := os.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MapFS is an in-memory file system of the file contents by name.
+// <absolute filename, content>
+type MapFS map[string][]byte
+
+// WriteFile writes a copy of the data to the file of the name.
+func (m MapFS) WriteFile(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// Remove deletes the file of the name.
+func (m MapFS) Remove(name string) error {
+	delete(m, name)
+	return nil
+}
+
+// Names returns the names of the files, sorted.
+func (m MapFS) Names() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fsWriteFile writes the text to the file of the file system.
+func fsWriteFile(fsys WriteFileFS, filename, text string) error {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(filename, []byte(text))
+}
+
+// fsRemove deletes the file of the name from the file system,
+// unless it does not delete files.
+func fsRemove(fsys WriteFileFS, filename string) error {
+	r, ok := fsys.(RemoveFS)
+	if !ok {
+		return nil
+	}
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	return r.Remove(filename)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// SensitiveTagKey is the struct tag key of the fields redacted by the
+// generated String method, e.g. `sensitive:"true"`; the value "false"
+// does not redact the field.
+const SensitiveTagKey = "sensitive"
+
+// redacted is printed by the generated String method for a sensitive field.
+const redacted = "[REDACTED]"
+
+// GenerateString generates the String method of the struct type Foo,
+// printing the names and values of the exported fields, like %+v does,
+// with the strings quoted:
+//
+//	Foo{ID: 1, Name: "a", Password: [REDACTED]}
+//
+// The unexported and the function fields are left out, and the values of
+// the fields tagged sensitive are redacted, see SensitiveTagKey.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateString() error {
+	const method = "String"
+	name := s.Name()
+	if name == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	if s.TypeParams() != nil {
+		return fmt.Errorf("aster: generic struct is not supported: %s", name)
+	}
+	if _, found := s.MethodByName(method); found {
+		return fmt.Errorf("aster: method already exists: %s.%s", name, method)
+	}
+	recv := receiverName(s)
+	var format, args []string
+	doc := fmt.Sprintf("// %s returns the exported fields of %s", method, name)
+	redacting := false
+	for _, field := range s.fields {
+		fname := field.Name()
+		kind := field.underlyingKind()
+		if !token.IsExported(fname) || kind == Func {
+			continue
+		}
+		if tag, err := field.Tags.Get(SensitiveTagKey); err == nil && tag.Value() != "false" {
+			format = append(format, fname+": "+redacted)
+			redacting = true
+			continue
+		}
+		verb := "%v"
+		if kind == String {
+			verb = "%q"
+		}
+		format = append(format, fname+": "+verb)
+		args = append(args, recv+"."+fname)
+	}
+	if redacting {
+		doc += ", redacting the sensitive ones"
+	}
+	layout := strconv.Quote(name + "{" + strings.Join(format, ", ") + "}")
+	result := layout
+	if len(args) > 0 {
+		result = fmt.Sprintf("fmt.Sprintf(%s, %s)", layout, strings.Join(args, ", "))
+	}
+	src := fmt.Sprintf("%s.\nfunc (%s %s) %s() string {\n\treturn %s\n}", doc, recv, name, method, result)
+	if err := s.file.appendDecl(name, src); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return s.file.AddImport("", "fmt")
+}
@@ -0,0 +1,377 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// Symbol is a top-level identifier declared in a file.
+type Symbol struct {
+	Name  string
+	Kind  ast.ObjKind // ast.Con, ast.Var, ast.Typ, ast.Fun or ast.Pkg
+	Ident *ast.Ident  // the declaring identifier, nil for the unnamed imports
+	File  *File
+	// Node is the type or function node declared,
+	// nil for the constants, the variables and the imports.
+	Node Node
+	// Import is the import of the package name, nil for the declarations.
+	Import *Import
+}
+
+// Pos returns the position of the declaration.
+func (s *Symbol) Pos() token.Pos {
+	if s.Ident == nil {
+		return s.Import.Pos()
+	}
+	return s.Ident.Pos()
+}
+
+// Symbols returns the top-level identifiers declared in the file,
+// including the names of the imported packages, sorted by position.
+// The methods, the blank identifiers, the init functions, and the blank
+// and dot imports are left out.
+func (f *File) Symbols() []*Symbol {
+	var syms []*Symbol
+	for _, imp := range f.Imports {
+		if imp.Name == "_" || imp.Name == "." {
+			continue
+		}
+		syms = append(syms, &Symbol{Name: imp.Name, Kind: ast.Pkg, Ident: imp.ImportSpec.Name, File: f, Import: imp})
+	}
+	add := func(id *ast.Ident, kind ast.ObjKind, pos token.Pos) {
+		if id.Name == "_" {
+			return
+		}
+		sym := &Symbol{Name: id.Name, Kind: kind, Ident: id, File: f}
+		if n, ok := f.Nodes[pos]; ok {
+			sym.Node = n
+		}
+		syms = append(syms, sym)
+	}
+	for _, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name != "init" {
+				add(d.Name, ast.Fun, d.Pos())
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name, ast.Typ, s.Type.Pos())
+				case *ast.ValueSpec:
+					kind := ast.Var
+					if d.Tok == token.CONST {
+						kind = ast.Con
+					}
+					for i, id := range s.Names {
+						pos := token.NoPos
+						if i < len(s.Values) {
+							pos = s.Values[i].Pos()
+						}
+						add(id, kind, pos)
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return syms[i].Pos() < syms[j].Pos() })
+	return syms
+}
+
+// LookupSymbol finds the top-level identifier visible in the file,
+// declared in the file or in the other files of its package.
+func (f *File) LookupSymbol(name string) (*Symbol, bool) {
+	for _, sym := range f.Symbols() {
+		if sym.Name == name {
+			return sym, true
+		}
+	}
+	for _, pf := range f.packageFiles() {
+		if pf == f {
+			continue
+		}
+		for _, sym := range pf.Symbols() {
+			if sym.Name == name && sym.Kind != ast.Pkg {
+				return sym, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// CheckCollision returns an error if any of the names is declared at the top
+// level of the package of the file, or is the name of a package imported in
+// any file of the package, so that declaring it would not compile.
+func (f *File) CheckCollision(names ...string) error {
+	var syms = make(map[string]*Symbol)
+	for _, pf := range f.packageFiles() {
+		for _, sym := range pf.Symbols() {
+			if _, ok := syms[sym.Name]; !ok || sym.Kind != ast.Pkg {
+				syms[sym.Name] = sym
+			}
+		}
+	}
+	for _, name := range names {
+		sym, ok := syms[name]
+		if !ok {
+			continue
+		}
+		switch sym.Kind {
+		case ast.Con:
+			return fmt.Errorf("aster: constant already exists: %s", name)
+		case ast.Var:
+			return fmt.Errorf("aster: variable already exists: %s", name)
+		case ast.Typ:
+			return fmt.Errorf("aster: type already exists: %s", name)
+		case ast.Fun:
+			return fmt.Errorf("aster: function already exists: %s", name)
+		default:
+			return fmt.Errorf("aster: name conflicts with the imported package: %s", name)
+		}
+	}
+	return nil
+}
+
+// packageFiles returns the files of the package of the file, sorted by name,
+// or the file itself if it has no package.
+func (f *File) packageFiles() []*File {
+	if p, ok := f.Package(); ok {
+		return p.sortedFiles()
+	}
+	return []*File{f}
+}
+
+// Shadow is a local declaration hiding a declaration of an outer scope.
+type Shadow struct {
+	Ident     *ast.Ident // the local declaration
+	Pos       token.Position
+	Enclosing FuncNode // the innermost function declaring it
+	// Outer is the hidden declaring identifier, local or top-level,
+	// nil for the unnamed imports.
+	Outer *ast.Ident
+	// Symbol is the hidden top-level identifier, nil if it is local.
+	Symbol *Symbol
+}
+
+// Shadows returns the local declarations in the functions of the file,
+// including the parameters and results, which shadow the declarations of
+// the enclosing scopes or the top-level identifiers of the package,
+// sorted by position.
+func (f *File) Shadows() []*Shadow {
+	w := &shadowWalker{file: f, top: make(map[string]*Symbol)}
+	for _, pf := range f.packageFiles() {
+		for _, sym := range pf.Symbols() {
+			if sym.Kind != ast.Pkg || pf == f {
+				w.top[sym.Name] = sym
+			}
+		}
+	}
+	for _, decl := range f.File.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok {
+			w.walk(d, nil)
+		} else {
+			w.walkChildren(decl, nil)
+		}
+	}
+	sort.Slice(w.shadows, func(i, j int) bool { return w.shadows[i].Ident.Pos() < w.shadows[j].Ident.Pos() })
+	return w.shadows
+}
+
+// localScope is a block of local declarations.
+type localScope struct {
+	outer *localScope
+	names map[string]*ast.Ident
+}
+
+func newLocalScope(outer *localScope) *localScope {
+	return &localScope{outer: outer, names: make(map[string]*ast.Ident)}
+}
+
+func (s *localScope) lookup(name string) (*ast.Ident, bool) {
+	for ; s != nil; s = s.outer {
+		if id, ok := s.names[name]; ok {
+			return id, true
+		}
+	}
+	return nil, false
+}
+
+// shadowWalker walks the statements of the functions tracking the scopes.
+type shadowWalker struct {
+	file    *File
+	top     map[string]*Symbol
+	shadows []*Shadow
+}
+
+func (w *shadowWalker) declare(id *ast.Ident, s *localScope) {
+	if id == nil || id.Name == "_" {
+		return
+	}
+	if _, ok := s.names[id.Name]; ok {
+		return // redeclared by :=
+	}
+	sh := &Shadow{Ident: id}
+	if outer, ok := s.outer.lookup(id.Name); ok {
+		sh.Outer = outer
+	} else if sym, ok := w.top[id.Name]; ok {
+		sh.Outer, sh.Symbol = sym.Ident, sym
+	}
+	s.names[id.Name] = id
+	if sh.Outer == nil && sh.Symbol == nil {
+		return
+	}
+	sh.Pos = w.file.FileSet.Position(id.Pos())
+	sh.Enclosing = w.file.enclosingFunc(id.Pos())
+	w.shadows = append(w.shadows, sh)
+}
+
+func (w *shadowWalker) declareFields(list *ast.FieldList, s *localScope) {
+	if list == nil {
+		return
+	}
+	for _, field := range list.List {
+		for _, id := range field.Names {
+			w.declare(id, s)
+		}
+	}
+}
+
+func (w *shadowWalker) walkFunc(recv *ast.FieldList, typ *ast.FuncType, body *ast.BlockStmt, s *localScope) {
+	fs := newLocalScope(s)
+	w.declareFields(recv, fs)
+	w.declareFields(typ.Params, fs)
+	w.declareFields(typ.Results, fs)
+	if body != nil {
+		w.walkList(body.List, fs)
+	}
+}
+
+func (w *shadowWalker) walkList(list []ast.Stmt, s *localScope) {
+	for _, stmt := range list {
+		w.walk(stmt, s)
+	}
+}
+
+func (w *shadowWalker) walk(n ast.Node, s *localScope) {
+	if n == nil {
+		return
+	}
+	switch x := n.(type) {
+	case *ast.FuncDecl:
+		w.walkFunc(x.Recv, x.Type, x.Body, s)
+	case *ast.FuncLit:
+		w.walkFunc(nil, x.Type, x.Body, s)
+	case *ast.BlockStmt:
+		w.walkList(x.List, newLocalScope(s))
+	case *ast.IfStmt:
+		s = newLocalScope(s)
+		w.walk(x.Init, s)
+		w.walk(x.Cond, s)
+		w.walk(x.Body, s)
+		w.walk(x.Else, s)
+	case *ast.ForStmt:
+		s = newLocalScope(s)
+		w.walk(x.Init, s)
+		w.walk(x.Cond, s)
+		w.walk(x.Post, s)
+		w.walk(x.Body, s)
+	case *ast.RangeStmt:
+		w.walk(x.X, s)
+		s = newLocalScope(s)
+		if x.Tok == token.DEFINE {
+			if id, ok := x.Key.(*ast.Ident); ok {
+				w.declare(id, s)
+			}
+			if id, ok := x.Value.(*ast.Ident); ok {
+				w.declare(id, s)
+			}
+		}
+		w.walk(x.Body, s)
+	case *ast.SwitchStmt:
+		s = newLocalScope(s)
+		w.walk(x.Init, s)
+		w.walk(x.Tag, s)
+		w.walk(x.Body, s)
+	case *ast.TypeSwitchStmt:
+		s = newLocalScope(s)
+		w.walk(x.Init, s)
+		w.walk(x.Assign, s)
+		w.walk(x.Body, s)
+	case *ast.SelectStmt:
+		w.walk(x.Body, s)
+	case *ast.CaseClause:
+		s = newLocalScope(s)
+		for _, e := range x.List {
+			w.walk(e, s)
+		}
+		w.walkList(x.Body, s)
+	case *ast.CommClause:
+		s = newLocalScope(s)
+		w.walk(x.Comm, s)
+		w.walkList(x.Body, s)
+	case *ast.DeclStmt:
+		w.walk(x.Decl, s)
+	case *ast.LabeledStmt:
+		w.walk(x.Stmt, s)
+	case *ast.AssignStmt:
+		for _, e := range x.Rhs {
+			w.walk(e, s)
+		}
+		for _, e := range x.Lhs {
+			if id, ok := e.(*ast.Ident); ok && x.Tok == token.DEFINE {
+				w.declare(id, s)
+			} else {
+				w.walk(e, s)
+			}
+		}
+	case *ast.GenDecl:
+		for _, spec := range x.Specs {
+			switch sp := spec.(type) {
+			case *ast.ValueSpec:
+				for _, e := range sp.Values {
+					w.walk(e, s)
+				}
+				for _, id := range sp.Names {
+					w.declare(id, s)
+				}
+			case *ast.TypeSpec:
+				w.declare(sp.Name, s)
+			}
+		}
+	default:
+		w.walkChildren(n, s)
+	}
+}
+
+// walkChildren walks the statements and function literals in the node.
+func (w *shadowWalker) walkChildren(n ast.Node, s *localScope) {
+	ast.Inspect(n, func(c ast.Node) bool {
+		switch c.(type) {
+		case nil:
+			return false
+		case *ast.FuncLit, ast.Stmt:
+			if c != n {
+				w.walk(c, s)
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+
+	"github.com/henrylee2cn/structtag"
+)
+
+// TagDiagnostic is a problem with a struct field tag.
+type TagDiagnostic struct {
+	Pos     token.Position `json:"pos"`
+	Rule    string         `json:"rule"`   // the name of the TagRule
+	Struct  string         `json:"struct"` // the struct type name
+	Field   string         `json:"field"`
+	Key     string         `json:"key,omitempty"` // the tag key, if any
+	Message string         `json:"message"`
+}
+
+// String returns the diagnostic message.
+func (d *TagDiagnostic) String() string {
+	return fmt.Sprintf("%s: %s.%s: %s (%s)", d.Pos, d.Struct, d.Field, d.Message, d.Rule)
+}
+
+// TagRule is a pluggable check of the field tags of a struct.
+// Check calls report for each problem found in the struct t.
+type TagRule struct {
+	Name  string
+	Check func(t TypeNode, report func(field *StructField, key, message string))
+}
+
+// DefaultTagRules are the rules checked by CheckTags if none are given:
+// the tag syntax and the duplicate json names.
+var DefaultTagRules = []TagRule{
+	TagSyntaxRule(),
+	DuplicateTagNameRule("json"),
+}
+
+// TagSyntaxRule reports the tags not in the conventional format of
+// space-separated key:"value" pairs, and the keys repeated in a tag.
+func TagSyntaxRule() TagRule {
+	return TagRule{
+		Name: "syntax",
+		Check: func(t TypeNode, report func(*StructField, string, string)) {
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if field.Field.Tag == nil {
+					continue
+				}
+				value, err := strconv.Unquote(field.Field.Tag.Value)
+				if err == nil {
+					_, err = structtag.Parse(value)
+				}
+				if err != nil {
+					report(field, "", err.Error())
+					continue
+				}
+				seen := make(map[string]bool)
+				for _, key := range field.Tags.Keys() {
+					if seen[key] {
+						report(field, key, fmt.Sprintf("duplicate tag key %q", key))
+					}
+					seen[key] = true
+				}
+			}
+		},
+	}
+}
+
+// DuplicateTagNameRule reports the fields of a struct tagged with the same
+// name by any of the keys, e.g. json, ignoring the omitted fields ("-").
+// The untagged fields are not checked, as encoding/json prefers the tagged ones.
+func DuplicateTagNameRule(keys ...string) TagRule {
+	return TagRule{
+		Name: "duplicate",
+		Check: func(t TypeNode, report func(*StructField, string, string)) {
+			for _, key := range keys {
+				seen := make(map[string]string)
+				for i := 0; i < t.NumField(); i++ {
+					field := t.Field(i)
+					tag, err := field.Tags.Get(key)
+					if err != nil || tag.Name == "-" && len(tag.Options) == 0 {
+						continue
+					}
+					name := tag.Name
+					if name == "" {
+						name = field.Name()
+					}
+					if other, ok := seen[name]; ok {
+						report(field, key, fmt.Sprintf("%s name %q is also used by field %s", key, name, other))
+						continue
+					}
+					seen[name] = field.Name()
+				}
+			}
+		},
+	}
+}
+
+// TagKeyRule reports the tag keys not in the allowlist.
+func TagKeyRule(allowed ...string) TagRule {
+	return TagRule{
+		Name: "key",
+		Check: func(t TypeNode, report func(*StructField, string, string)) {
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				for _, key := range field.Tags.Keys() {
+					if !containsString(allowed, key) {
+						report(field, key, fmt.Sprintf("unknown tag key %q", key))
+					}
+				}
+			}
+		},
+	}
+}
+
+// CheckTags validates the field tags of the structs of the file against the
+// rules, or DefaultTagRules if none are given.
+// Returns the diagnostics sorted by position.
+func (f *File) CheckTags(rules ...TagRule) []*TagDiagnostic {
+	if len(rules) == 0 {
+		rules = DefaultTagRules
+	}
+	var diags []*TagDiagnostic
+	for _, t := range f.Structs() {
+		for _, rule := range rules {
+			rule.Check(t, func(field *StructField, key, message string) {
+				diags = append(diags, &TagDiagnostic{
+					Pos:     f.FileSet.Position(fieldPos(field)),
+					Rule:    rule.Name,
+					Struct:  t.Name(),
+					Field:   field.Name(),
+					Key:     key,
+					Message: message,
+				})
+			})
+		}
+	}
+	sortTagDiagnostics(diags)
+	return diags
+}
+
+// CheckTags validates the field tags of the structs of the package,
+// see File.CheckTags.
+func (p *Package) CheckTags(rules ...TagRule) []*TagDiagnostic {
+	var diags []*TagDiagnostic
+	for _, f := range p.Files {
+		diags = append(diags, f.CheckTags(rules...)...)
+	}
+	sortTagDiagnostics(diags)
+	return diags
+}
+
+// CheckTags validates the field tags of the structs of the module,
+// see File.CheckTags.
+func (m *Module) CheckTags(rules ...TagRule) []*TagDiagnostic {
+	var diags []*TagDiagnostic
+	for _, p := range m.Packages {
+		diags = append(diags, p.CheckTags(rules...)...)
+	}
+	sortTagDiagnostics(diags)
+	return diags
+}
+
+// fieldPos returns the position of the tag of the field, or of the field
+// if it has no tag. The fields split from a list of names, e.g. `A, B int`,
+// are positioned at their type.
+func fieldPos(field *StructField) token.Pos {
+	if field.Field.Tag != nil && field.Field.Tag.Pos().IsValid() {
+		return field.Field.Tag.Pos()
+	}
+	if len(field.Field.Names) > 0 && field.Field.Names[0].Pos().IsValid() {
+		return field.Field.Names[0].Pos()
+	}
+	return field.Field.Type.Pos()
+}
+
+func sortTagDiagnostics(diags []*TagDiagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Pos, diags[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/henrylee2cn/structtag"
+)
+
+// Naming converts a field name into a tag name.
+type Naming func(fieldName string) string
+
+// The namings of the tags.
+var (
+	// SnakeCase names the tags in snake case, e.g. "user_id" for UserID.
+	SnakeCase Naming = func(name string) string {
+		return strings.ToLower(strings.Join(splitWords(name), "_"))
+	}
+	// CamelCase names the tags in lower camel case, e.g. "userId" for UserID.
+	CamelCase Naming = func(name string) string {
+		words := splitWords(name)
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 {
+				w = upperFirst(w)
+			}
+			words[i] = w
+		}
+		return strings.Join(words, "")
+	}
+)
+
+// NormalizeTags adds the tags of the key, e.g. "json", named by the naming
+// to the exported fields of the struct types of the package without them,
+// and renames the existing ones by the naming, keeping their options.
+// The embedded fields, the fields of more than one name and the fields
+// tagged "-" are left as they are.
+// Returns the number of fields changed.
+// NOTE: The files are reparsed after rewriting, and stored by Store.
+func (p *Package) NormalizeTags(key string, naming Naming) (int, error) {
+	var count int
+	for _, f := range p.sortedFiles() {
+		n, err := f.NormalizeTags(key, naming)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// NormalizeTags normalizes the tags of the struct types of the file,
+// see Package.NormalizeTags.
+func (f *File) NormalizeTags(key string, naming Naming) (int, error) {
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	var edits []textEdit
+	for _, decl := range f.File.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		// including the fields of the nested anonymous struct types
+		ast.Inspect(gd, func(n ast.Node) bool {
+			st, ok := n.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range st.Fields.List {
+				if e, ok := f.normalizeTag(field, key, naming); ok {
+					edits = append(edits, e)
+				}
+			}
+			return true
+		})
+	}
+	return len(edits), f.applyEdits(edits)
+}
+
+// normalizeTag returns the edit of the tag of the field, if it changes.
+func (f *File) normalizeTag(field *ast.Field, key string, naming Naming) (textEdit, bool) {
+	if len(field.Names) != 1 || !field.Names[0].IsExported() {
+		return textEdit{}, false
+	}
+	var value string
+	if field.Tag != nil {
+		v, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return textEdit{}, false
+		}
+		value = v
+	}
+	tags, err := structtag.Parse(value)
+	if err != nil {
+		// left to CheckTags
+		return textEdit{}, false
+	}
+	name := naming(field.Names[0].Name)
+	tag, err := tags.Get(key)
+	if err != nil {
+		tag = &Tag{Key: key}
+	}
+	if tag.Name == "-" && len(tag.Options) == 0 || tag.Name == name {
+		return textEdit{}, false
+	}
+	tag.Name = name
+	tags.Set(tag)
+	text := "`" + tags.String() + "`"
+	if field.Tag == nil {
+		end := f.offset(field.Type.End())
+		return textEdit{start: end, end: end, text: " " + text}, true
+	}
+	return f.textEdit(field.Tag, text), true
+}
+
+// splitWords splits the name into its words, e.g. "HTMLBody" into
+// "HTML" and "Body", "UserID2" into "User" and "ID2".
+func splitWords(name string) []string {
+	var words []string
+	r := []rune(name)
+	start := 0
+	for i := 1; i < len(r); i++ {
+		lowerToUpper := !unicode.IsUpper(r[i-1]) && unicode.IsUpper(r[i])
+		acronymEnd := unicode.IsUpper(r[i-1]) && unicode.IsUpper(r[i]) && i+1 < len(r) && unicode.IsLower(r[i+1])
+		if r[i] == '_' {
+			if i > start {
+				words = append(words, string(r[start:i]))
+			}
+			start = i + 1
+		} else if (lowerToUpper || acronymEnd) && i > start {
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	if start < len(r) {
+		words = append(words, string(r[start:]))
+	}
+	return words
+}
@@ -0,0 +1,298 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strconv"
+	"unicode"
+)
+
+// TimeFormatTagKey is the struct tag key overriding the format of
+// a time.Time or time.Duration field, e.g. `timefmt:"unixmilli"`.
+const TimeFormatTagKey = "timefmt"
+
+// Formats of time.Time fields.
+// Any other format of a time.Time field is used as a time layout.
+const (
+	TimeRFC3339     = "rfc3339"     // string, time.RFC3339
+	TimeRFC3339Nano = "rfc3339nano" // string, time.RFC3339Nano
+	TimeUnix        = "unix"        // int64, seconds since the epoch
+	TimeUnixMilli   = "unixmilli"   // int64, milliseconds since the epoch
+	TimeUnixNano    = "unixnano"    // int64, nanoseconds since the epoch
+)
+
+// Formats of time.Duration fields.
+const (
+	DurationString  = "string"  // string, e.g. "1m30s"
+	DurationSeconds = "seconds" // float64
+	DurationMillis  = "millis"  // int64
+	DurationNanos   = "nanos"   // int64
+)
+
+// Codecs supported by GenerateTimeCodec.
+const (
+	CodecJSON = "json" // MarshalJSON and UnmarshalJSON
+	CodecYAML = "yaml" // MarshalYAML and UnmarshalYAML, as gopkg.in/yaml expects
+)
+
+// TimeCodecConfig configures GenerateTimeCodec.
+type TimeCodecConfig struct {
+	// TimeFormat is the default format of time.Time fields,
+	// defaults to TimeRFC3339.
+	TimeFormat string
+	// DurationFormat is the default format of time.Duration fields,
+	// defaults to DurationString.
+	DurationFormat string
+	// Codecs are the codecs to generate methods for,
+	// defaults to CodecJSON.
+	Codecs []string
+}
+
+// GenerateTimeCodec generates the (un)marshaling methods of the struct type,
+// which encode its time.Time and time.Duration fields in their configured
+// formats and the other fields as usual. The field keys follow the struct tags
+// of each codec.
+//
+// For each codec, an unexported shadow type holding the encoded fields is
+// generated too, e.g. configTimeJSON for the JSON codec of Config.
+// Returns an error if the struct has no time fields.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateTimeCodec(cfg *TimeCodecConfig) error {
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	var c TimeCodecConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.TimeFormat == "" {
+		c.TimeFormat = TimeRFC3339
+	}
+	if c.DurationFormat == "" {
+		c.DurationFormat = DurationString
+	}
+	if len(c.Codecs) == 0 {
+		c.Codecs = []string{CodecJSON}
+	}
+
+	var hasTime bool
+	for _, field := range s.fields {
+		if s.file.isTimeField(field) {
+			hasTime = true
+			break
+		}
+	}
+	if !hasTime {
+		return fmt.Errorf("aster: struct has no time fields: %s", s.Name())
+	}
+
+	file := s.file
+	var src bytes.Buffer
+	var imports []string
+	for _, codec := range c.Codecs {
+		var marshal, unmarshal string
+		switch codec {
+		case CodecJSON:
+			marshal, unmarshal = "MarshalJSON", "UnmarshalJSON"
+			imports = append(imports, "encoding/json")
+		case CodecYAML:
+			marshal, unmarshal = "MarshalYAML", "UnmarshalYAML"
+		default:
+			return fmt.Errorf("aster: unsupported codec: %s", codec)
+		}
+		for _, method := range []string{marshal, unmarshal} {
+			if _, found := s.MethodByName(method); found {
+				return fmt.Errorf("aster: method already exists: %s.%s", s.Name(), method)
+			}
+		}
+		if err := s.writeTimeCodec(&src, &c, codec); err != nil {
+			return err
+		}
+	}
+	for _, path := range imports {
+		if err := file.AddImport("", path); err != nil {
+			return err
+		}
+	}
+	return file.appendDecl(s.Name(), src.String())
+}
+
+func (f *File) isTimeField(field *StructField) bool {
+	return f.isQualifiedType(field.Field.Type, "time", "Time") ||
+		f.isDurationType(field.Field.Type)
+}
+
+func (s *StructType) writeTimeCodec(buf *bytes.Buffer, c *TimeCodecConfig, codec string) error {
+	name := s.Name()
+	recv := receiverName(s)
+	suffix := "JSON"
+	if codec == CodecYAML {
+		suffix = "YAML"
+	}
+	shadow := lowerFirst(name) + "Time" + suffix
+
+	var fields, to, from bytes.Buffer
+	for _, field := range s.fields {
+		fname := field.Name()
+		if fname == "" {
+			continue
+		}
+		var tag string
+		if field.Field.Tag != nil {
+			tag = " " + field.Field.Tag.Value
+		}
+		typ := field.TypeName()
+		if !s.file.isTimeField(field) {
+			if field.Anonymous() {
+				fmt.Fprintf(&fields, "\t%s%s\n", typ, tag)
+			} else {
+				fmt.Fprintf(&fields, "\t%s %s%s\n", fname, typ, tag)
+			}
+			fmt.Fprintf(&to, "\ta.%s = %s.%s\n", fname, recv, fname)
+			fmt.Fprintf(&from, "\t%s.%s = a.%s\n", recv, fname, fname)
+			continue
+		}
+		timePkg := field.Field.Type.(*ast.SelectorExpr).X.(*ast.Ident).Name
+		x, a := recv+"."+fname, "a."+fname
+		var format string
+		if tag, err := field.Tags.Get(TimeFormatTagKey); err == nil {
+			format = tag.Value()
+		}
+		if s.file.isDurationType(field.Field.Type) {
+			if format == "" {
+				format = c.DurationFormat
+			}
+			auxType, err := writeDurationConv(&to, &from, timePkg, format, x, a)
+			if err != nil {
+				return fmt.Errorf("aster: field %s: %s", fname, err.Error())
+			}
+			fmt.Fprintf(&fields, "\t%s %s%s\n", fname, auxType, tag)
+		} else {
+			if format == "" {
+				format = c.TimeFormat
+			}
+			auxType := writeTimeConv(&to, &from, timePkg, format, x, a)
+			fmt.Fprintf(&fields, "\t%s %s%s\n", fname, auxType, tag)
+		}
+	}
+
+	fmt.Fprintf(buf, "\n\n// %s is the %s representation of %s,\n// with the time fields in their configured formats.\ntype %s struct {\n%s}\n",
+		shadow, suffix, name, shadow, fields.String())
+	fmt.Fprintf(buf, "\nfunc (%s %s) to%s() %s {\n\tvar a %s\n%s\treturn a\n}\n",
+		recv, name, upperFirst(shadow), shadow, shadow, to.String())
+	fmt.Fprintf(buf, "\nfunc (%s *%s) from%s(a %s) error {\n%s\treturn nil\n}\n",
+		recv, name, upperFirst(shadow), shadow, from.String())
+
+	switch codec {
+	case CodecJSON:
+		jsonPkg := s.file.importName("encoding/json")
+		if jsonPkg == "" {
+			jsonPkg = "json"
+		}
+		fmt.Fprintf(buf, "\n// MarshalJSON implements json.Marshaler.\nfunc (%s %s) MarshalJSON() ([]byte, error) {\n\treturn %s.Marshal(%s.to%s())\n}\n",
+			recv, name, jsonPkg, recv, upperFirst(shadow))
+		fmt.Fprintf(buf, "\n// UnmarshalJSON implements json.Unmarshaler.\nfunc (%s *%s) UnmarshalJSON(data []byte) error {\n\ta := %s.to%s()\n\tif err := %s.Unmarshal(data, &a); err != nil {\n\t\treturn err\n\t}\n\treturn %s.from%s(a)\n}\n",
+			recv, name, recv, upperFirst(shadow), jsonPkg, recv, upperFirst(shadow))
+	case CodecYAML:
+		fmt.Fprintf(buf, "\n// MarshalYAML implements yaml.Marshaler.\nfunc (%s %s) MarshalYAML() (interface{}, error) {\n\treturn %s.to%s(), nil\n}\n",
+			recv, name, recv, upperFirst(shadow))
+		fmt.Fprintf(buf, "\n// UnmarshalYAML implements yaml.Unmarshaler.\nfunc (%s *%s) UnmarshalYAML(unmarshal func(interface{}) error) error {\n\ta := %s.to%s()\n\tif err := unmarshal(&a); err != nil {\n\t\treturn err\n\t}\n\treturn %s.from%s(a)\n}\n",
+			recv, name, recv, upperFirst(shadow), recv, upperFirst(shadow))
+	}
+	return nil
+}
+
+// writeTimeConv writes the conversions of the time.Time x to and from
+// the encoded a, and returns the type of a.
+func writeTimeConv(to, from *bytes.Buffer, t, format, x, a string) string {
+	var enc, dec, auxType string
+	switch format {
+	case TimeUnix:
+		auxType, enc, dec = "int64", x+".Unix()", t+".Unix("+a+", 0)"
+	case TimeUnixMilli:
+		auxType, enc, dec = "int64", x+".UnixNano() / int64("+t+".Millisecond)",
+			t+".Unix(0, "+a+"*int64("+t+".Millisecond))"
+	case TimeUnixNano:
+		auxType, enc, dec = "int64", x+".UnixNano()", t+".Unix(0, "+a+")"
+	default:
+		layout := strconv.Quote(format)
+		switch format {
+		case TimeRFC3339:
+			layout = t + ".RFC3339"
+		case TimeRFC3339Nano:
+			layout = t + ".RFC3339Nano"
+		}
+		fmt.Fprintf(to, "\tif !%s.IsZero() {\n\t\t%s = %s.Format(%s)\n\t}\n", x, a, x, layout)
+		fmt.Fprintf(from, "\tif %s == \"\" {\n\t\t%s = %s.Time{}\n\t} else {\n\t\tv, err := %s.Parse(%s, %s)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\t%s = v\n\t}\n",
+			a, x, t, t, layout, a, x)
+		return "string"
+	}
+	fmt.Fprintf(to, "\tif !%s.IsZero() {\n\t\t%s = %s\n\t}\n", x, a, enc)
+	fmt.Fprintf(from, "\tif %s == 0 {\n\t\t%s = %s.Time{}\n\t} else {\n\t\t%s = %s\n\t}\n", a, x, t, x, dec)
+	return auxType
+}
+
+// writeDurationConv writes the conversions of the time.Duration x to and from
+// the encoded a, and returns the type of a.
+func writeDurationConv(to, from *bytes.Buffer, t, format, x, a string) (string, error) {
+	switch format {
+	case DurationString:
+		fmt.Fprintf(to, "\t%s = %s.String()\n", a, x)
+		fmt.Fprintf(from, "\tif %s == \"\" {\n\t\t%s = 0\n\t} else {\n\t\tv, err := %s.ParseDuration(%s)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\t%s = v\n\t}\n",
+			a, x, t, a, x)
+		return "string", nil
+	case DurationSeconds:
+		fmt.Fprintf(to, "\t%s = %s.Seconds()\n", a, x)
+		fmt.Fprintf(from, "\t%s = %s.Duration(%s * float64(%s.Second))\n", x, t, a, t)
+		return "float64", nil
+	case DurationMillis:
+		fmt.Fprintf(to, "\t%s = int64(%s / %s.Millisecond)\n", a, x, t)
+		fmt.Fprintf(from, "\t%s = %s.Duration(%s) * %s.Millisecond\n", x, t, a, t)
+		return "int64", nil
+	case DurationNanos:
+		fmt.Fprintf(to, "\t%s = int64(%s)\n", a, x)
+		fmt.Fprintf(from, "\t%s = %s.Duration(%s)\n", x, t, a)
+		return "int64", nil
+	}
+	return "", fmt.Errorf("unsupported duration format: %s", format)
+}
+
+// importName returns the name by which the file imports the path,
+// or the empty string if not imported.
+func (f *File) importName(path string) string {
+	for _, imp := range f.Imports {
+		if imp.Path == path {
+			return imp.Name
+		}
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	for i, r := range s {
+		return string(unicode.ToLower(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
+
+func upperFirst(s string) string {
+	for i, r := range s {
+		return string(unicode.ToUpper(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// TypeParams returns the type parameters of a generic type or function,
+// or nil if it has none.
+func (s *super) TypeParams() []*TypeParam {
+	if s.typeParams == nil {
+		return nil
+	}
+	var params []*TypeParam
+	for _, field := range s.typeParams.List {
+		constraint := s.file.TryFormatNode(field.Type)
+		for _, name := range field.Names {
+			params = append(params, &TypeParam{
+				Name:           name.Name,
+				Constraint:     constraint,
+				ConstraintExpr: field.Type,
+			})
+		}
+	}
+	return params
+}
+
+// typeParamsString returns the type parameter list, e.g. "[K comparable, V any]",
+// or the empty string if there are no type parameters.
+func typeParamsString(params []*TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	var list []string
+	for i, p := range params {
+		// merges the names sharing the same constraint
+		if i+1 < len(params) && params[i+1].ConstraintExpr == p.ConstraintExpr {
+			list = append(list, p.Name+",")
+			continue
+		}
+		list = append(list, p.Name+" "+p.Constraint+",")
+	}
+	s := strings.Join(list, " ")
+	return "[" + strings.TrimSuffix(s, ",") + "]"
+}
+
+// baseTypeName returns the type name without `*` and type arguments,
+// e.g. "List" for "*List[T]".
+func baseTypeName(typeName string) string {
+	typeName = strings.TrimLeft(typeName, "*")
+	if i := strings.Index(typeName, "["); i > 0 {
+		typeName = typeName[:i]
+	}
+	return typeName
+}
+
+// genericBase returns the generic type of the instantiated type expression,
+// e.g. List for List[int], or e itself if it is not instantiated.
+func genericBase(e ast.Expr) ast.Expr {
+	switch x := e.(type) {
+	case *ast.IndexExpr:
+		return x.X
+	case *ast.IndexListExpr:
+		return x.X
+	}
+	return e
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// Underlying returns the kind of the underlying type, i.e. the kind of the
+// type itself, as it is not a named type of another named type.
+func (s *superType) Underlying() Kind {
+	return s.kind
+}
+
+// ResolveNamed returns the type itself, as it is not a named type of another
+// named type, or false if it is not declared by the file.
+func (s *superType) ResolveNamed() (TypeNode, bool) {
+	n, ok := s.self()
+	if !ok {
+		return nil, false
+	}
+	t, ok := n.(TypeNode)
+	return t, ok
+}
+
+// Underlying returns the kind of the underlying type, following the chain
+// of the named types declared in the module, and else the export data of
+// the imported package, e.g. Int64 for `type OrderID UserID` and
+// `type Timeout time.Duration`, or Suspense if it can not be resolved,
+// e.g. a type parameter or a cyclic chain.
+func (b *BasicType) Underlying() Kind {
+	if b.kind != Suspense {
+		return b.kind
+	}
+	t, file, expr := b.resolveNamed()
+	if t != nil {
+		return t.Kind()
+	}
+	if expr == nil {
+		return Suspense
+	}
+	switch x := genericBase(expr).(type) {
+	case *ast.Ident:
+		if x.Name == "error" {
+			return Interface
+		}
+	case *ast.SelectorExpr:
+		obj, err := file.LookupExternalType(file.TryFormatNode(x))
+		if err == nil {
+			return typesKind(obj.Type().Underlying())
+		}
+	}
+	return Suspense
+}
+
+// ResolveNamed returns the type at the end of the chain of the named types
+// declared in the module, i.e. the type declared by a basic type or a type
+// literal, e.g. the node of `type UserID int64` for `type OrderID UserID`,
+// or the type itself if it is not a named type of another named type.
+// Returns false if the chain leaves the module or is cyclic.
+func (b *BasicType) ResolveNamed() (TypeNode, bool) {
+	if b.kind != Suspense {
+		if b.namePtr == nil {
+			return b, true
+		}
+		return b.superType.ResolveNamed()
+	}
+	t, _, _ := b.resolveNamed()
+	return t, t != nil
+}
+
+// resolveNamed follows the chain of the named types, and returns the type
+// at the end of it, or else the type expression leaving the module and
+// the file of it, or nil if the chain is cyclic.
+func (b *BasicType) resolveNamed() (TypeNode, *File, ast.Expr) {
+	seen := map[*BasicType]bool{b: true}
+	for {
+		next, ok := b.file.exprTypeNode(b.Expr)
+		if !ok {
+			return nil, b.file, b.Expr
+		}
+		nb, ok := next.(*BasicType)
+		if !ok || nb.kind != Suspense {
+			return next, nil, nil
+		}
+		if seen[nb] {
+			return nil, nil, nil
+		}
+		seen[nb] = true
+		b = nb
+	}
+}
+
+// typesKind returns the kind of the underlying type.
+func typesKind(t types.Type) Kind {
+	switch t := t.(type) {
+	case *types.Basic:
+		// byte and rune are named by types.Typ of their kinds
+		if k, found := getBasicKind(types.Typ[t.Kind()].Name()); found {
+			return k
+		}
+	case *types.Pointer:
+		return Ptr
+	case *types.Slice:
+		return Slice
+	case *types.Array:
+		return Array
+	case *types.Map:
+		return Map
+	case *types.Chan:
+		return Chan
+	case *types.Signature:
+		return Func
+	case *types.Struct:
+		return Struct
+	case *types.Interface:
+		return Interface
+	}
+	return Suspense
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// UnusedDecl is an unexported declaration without references in the module.
+type UnusedDecl struct {
+	Name string
+	// Kind is ast.Con, ast.Typ or ast.Fun, or ast.Var for a struct field.
+	Kind ast.ObjKind
+	// Node is the type or function node, nil for the constants and fields.
+	Node Node
+	// Field is the struct field, and Struct is the struct type declaring it.
+	Field  *StructField
+	Struct TypeNode
+	File   *File
+	Pos    token.Position
+}
+
+// UnusedDecls returns the unexported top-level functions, types and
+// constants, and the unexported struct fields, which are never referenced
+// in the module, sorted by position.
+// The methods, the init and main functions, and the fields of the structs
+// used in unkeyed composite literals are left out. The references to a type
+// from the receivers of its own methods do not count.
+// The uninferable selectors count as references of the fields, see Ref.Guess.
+// NOTE: The module is not type-checked.
+func (m *Module) UnusedDecls() []*UnusedDecl {
+	var unused []*UnusedDecl
+	for _, p := range m.Packages {
+		for _, f := range p.sortedFiles() {
+			unused = append(unused, f.unusedDecls()...)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		a, b := unused[i].Pos, unused[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return unused
+}
+
+func (f *File) unusedDecls() []*UnusedDecl {
+	var unused []*UnusedDecl
+	add := func(u *UnusedDecl, pos token.Pos) {
+		u.File, u.Pos = f, f.FileSet.Position(pos)
+		unused = append(unused, u)
+	}
+	for _, decl := range f.File.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil || IsExported(name) || name == "_" || name == "init" || name == "main" && f.PkgName == "main" {
+				continue
+			}
+			if len(f.topRefs(d.Name, d)) == 0 {
+				add(&UnusedDecl{Name: name, Kind: ast.Fun, Node: f.Nodes[d.Pos()]}, d.Name.Pos())
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if IsExported(s.Name.Name) || s.Name.Name == "_" {
+						continue
+					}
+					if len(f.typeRefs(s)) == 0 {
+						add(&UnusedDecl{Name: s.Name.Name, Kind: ast.Typ, Node: f.Nodes[s.Type.Pos()]}, s.Name.Pos())
+					}
+				case *ast.ValueSpec:
+					if d.Tok != token.CONST {
+						continue
+					}
+					for _, id := range s.Names {
+						if !IsExported(id.Name) && id.Name != "_" && len(f.topRefs(id, s)) == 0 {
+							add(&UnusedDecl{Name: id.Name, Kind: ast.Con}, id.Pos())
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, t := range f.Structs() {
+		if f.hasUnkeyedLit(t) {
+			continue
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous() || IsExported(field.Name()) || field.Name() == "_" {
+				continue
+			}
+			if len(field.References()) == 0 {
+				add(&UnusedDecl{Name: field.Name(), Kind: ast.Var, Field: field, Struct: t}, field.Field.Pos())
+			}
+		}
+	}
+	return unused
+}
+
+// typeRefs returns the references to the type declared by spec,
+// except those from the receivers of its own methods.
+func (f *File) typeRefs(spec *ast.TypeSpec) []Ref {
+	var refs []Ref
+	for _, ref := range f.topRefs(spec.Name, spec) {
+		if fn, ok := ref.Enclosing.(FuncNode); ok && recvTypeName(fn.(Node)) == spec.Name.Name {
+			if d, ok := fn.Node().(*ast.FuncDecl); ok && d.Recv.Pos() <= ref.Ident.Pos() && ref.Ident.End() <= d.Recv.End() {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// hasUnkeyedLit reports whether the struct type is used in an unkeyed
+// composite literal in the module, e.g. T{1, "a"}.
+func (f *File) hasUnkeyedLit(t TypeNode) bool {
+	var found bool
+	for _, g := range f.moduleFiles() {
+		ast.Inspect(g.File, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok || found || lit.Type == nil || len(lit.Elts) == 0 {
+				return !found
+			}
+			if _, keyed := lit.Elts[0].(*ast.KeyValueExpr); keyed {
+				return true
+			}
+			if lt, _ := g.resolveType(lit.Type); lt != nil && lt.Node() == t.Node() {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// Remove removes the declaration: the type along with its methods, the
+// function or the constant by the removal API, or the struct field.
+// The declaration is looked up by name, so the other unused declarations
+// can be removed in turn, though the files are reparsed after each removing.
+// Returns an error if a constant is declared along with other names, or
+// in a group of specs depending on their order, e.g. by iota.
+func (u *UnusedDecl) Remove() error {
+	switch u.Kind {
+	case ast.Typ:
+		if p, ok := u.File.Package(); ok {
+			return p.RemoveType(u.Name)
+		}
+	case ast.Fun:
+		if n, ok := u.File.lookupTopNode(u.Name, Func, ""); ok {
+			return u.File.RemoveNode(n)
+		}
+		return fmt.Errorf("aster: function not found: %s", u.Name)
+	case ast.Con:
+		return u.File.removeConst(u.Name)
+	case ast.Var:
+		return u.File.removeField(u.Struct.Name(), u.Name)
+	}
+	if n, ok := u.File.lookupTopNode(u.Name, u.Node.Kind(), ""); ok {
+		return u.File.RemoveNode(n)
+	}
+	return fmt.Errorf("aster: type not found: %s", u.Name)
+}
+
+// removeConst removes the top-level constant.
+func (f *File) removeConst(name string) error {
+	isConst := func(decl ast.Decl, spec ast.Spec) bool {
+		d, ok := decl.(*ast.GenDecl)
+		vs, isValue := spec.(*ast.ValueSpec)
+		if !ok || !isValue || d.Tok != token.CONST {
+			return false
+		}
+		for _, id := range vs.Names {
+			if id.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, decl := range f.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.CONST || len(d.Specs) < 2 || !implicitConsts(d) {
+			continue
+		}
+		for _, spec := range d.Specs {
+			if isConst(d, spec) {
+				return fmt.Errorf("aster: can not remove the constant of an ordered group: %s", name)
+			}
+		}
+	}
+	found, err := f.removeDecl(isConst)
+	if err == nil && !found {
+		err = fmt.Errorf("aster: constant not found: %s", name)
+	}
+	return err
+}
+
+// implicitConsts reports whether the values of the constants depend on the
+// order of the specs, i.e. use iota or are omitted.
+func implicitConsts(d *ast.GenDecl) bool {
+	var implicit bool
+	for _, spec := range d.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(vs.Values) == 0 {
+			return true
+		}
+		for _, v := range vs.Values {
+			ast.Inspect(v, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && id.Name == "iota" && id.Obj == nil {
+					implicit = true
+				}
+				return !implicit
+			})
+		}
+	}
+	return implicit
+}
+
+// removeField removes the struct field, along with its doc and line comments.
+func (f *File) removeField(typeName, name string) error {
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	st, ok := f.lookupTypeExpr(typeName).(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("aster: struct type not found: %s", typeName)
+	}
+	for _, field := range st.Fields.List {
+		for _, id := range field.Names {
+			if id.Name != name {
+				continue
+			}
+			if len(field.Names) > 1 {
+				return fmt.Errorf("aster: can not remove one of the names declared together: %s.%s", typeName, name)
+			}
+			s, e := f.lineRange(f.fieldRange(field))
+			return f.replaceSource(s, e, "")
+		}
+	}
+	return fmt.Errorf("aster: field not found: %s.%s", typeName, name)
+}
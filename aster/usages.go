@@ -0,0 +1,92 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import "go/ast"
+
+// FindUsages returns the references to the symbol of the imported package
+// across the module, sorted by position, e.g. the selectors http.Get for
+// FindUsages("net/http", "Get"), and the identifiers Get of the files
+// importing the package by a dot import. The Ident of a reference is the
+// selected identifier, and Func the function enclosing it, if any.
+// NOTE: The uses within the package itself are not selectors, see
+// Node.References for those of a module package.
+func (m *Module) FindUsages(importPath, ident string) []Ref {
+	var refs []Ref
+	for _, p := range m.sortedPackages() {
+		for _, f := range p.sortedFiles() {
+			refs = append(refs, f.findUsages(importPath, ident)...)
+		}
+	}
+	sortRefs(refs)
+	return refs
+}
+
+// findUsages returns the references of the file to the symbol of the
+// imported package, see Module.FindUsages.
+func (f *File) findUsages(importPath, ident string) []Ref {
+	names := make(map[string]bool)
+	var dot bool
+	for _, imp := range f.Imports {
+		if imp.Path != importPath {
+			continue
+		}
+		switch imp.Name {
+		case "_":
+		case ".":
+			dot = true
+		default:
+			names[imp.Name] = true
+		}
+	}
+	if len(names) == 0 && !dot {
+		return nil
+	}
+	var skip map[*ast.Ident]bool
+	if dot {
+		skip = f.nonRefIdents()
+	}
+	var refs []Ref
+	ast.Inspect(f.File, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			// a package name is not resolved by the parser, unlike the locals shadowing it
+			if id, ok := x.X.(*ast.Ident); ok && id.Obj == nil && names[id.Name] && x.Sel.Name == ident {
+				refs = append(refs, f.newRef(x.Sel, false))
+			}
+		case *ast.Ident:
+			if dot && x.Name == ident && x.Obj == nil && !skip[x] && !f.declaredInPkg(ident) {
+				refs = append(refs, f.newRef(x, false))
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// declaredInPkg reports whether the name is declared at the package level
+// of the file, in any file of its package.
+func (f *File) declaredInPkg(name string) bool {
+	p, ok := f.Package()
+	if !ok {
+		return f.File.Scope.Lookup(name) != nil
+	}
+	for _, g := range p.Files {
+		if g.File.Scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// ValidateTagKey is the struct tag key declaring the validation rules of
+// a field, e.g. `validate:"required,max=32"`.
+const ValidateTagKey = "validate"
+
+// validateBounds are the failing operators and the messages of the rules
+// bounding the numbers or the lengths.
+var validateBounds = map[string][2]string{
+	"min": {"<", "must be at least "},
+	"max": {">", "must be at most "},
+	"gt":  {"<=", "must be greater than "},
+	"gte": {"<", "must be at least "},
+	"lt":  {">=", "must be less than "},
+	"lte": {">", "must be at most "},
+	"len": {"!=", "must be of length "},
+}
+
+// GenerateValidate generates the Validate method of the struct type, which
+// checks the fields against the rules of their validate tags, separated by
+// commas, and returns the error of the first failing one:
+//
+//	required            the field is not zero
+//	omitempty           the other rules are skipped if the field is zero
+//	min=N, max=N        the number is at least or at most N, or the length
+//	                    of the string, slice or map is
+//	gt=N, gte=N         the number or the length is greater than (or equal to) N
+//	lt=N, lte=N         the number or the length is less than (or equal to) N
+//	len=N               the length of the string, slice or map is N
+//	oneof=a b c         the string or number is one of the values
+//	email, url          the string is an email address, or an absolute URL
+//
+// The rules other than required apply to the elements of the pointer fields,
+// if not nil, and the fields tagged "-" are skipped. The checks are inlined,
+// so no reflection is needed at run time.
+// Returns an error if a rule is unknown or invalid for its field type.
+// NOTE: The file is reparsed after inserting.
+func (s *StructType) GenerateValidate() error {
+	const method = "Validate"
+	if s.Name() == "" {
+		return fmt.Errorf("aster: anonymous struct has no methods")
+	}
+	if _, found := s.MethodByName(method); found {
+		return fmt.Errorf("aster: method already exists: %s.%s", s.Name(), method)
+	}
+	recv := receiverName(s)
+	imports := map[string]bool{"errors": true}
+	var body bytes.Buffer
+	for _, field := range s.fields {
+		tag, err := field.Tags.Get(ValidateTagKey)
+		if err != nil || tag.Value() == "" || tag.Value() == "-" || field.Name() == "" || field.Anonymous() {
+			continue
+		}
+		checks, err := field.validateChecks(recv+"."+field.Name(), tag.Value(), imports)
+		if err != nil {
+			return fmt.Errorf("aster: invalid validate rule of field %s: %s", field.Name(), err.Error())
+		}
+		body.WriteString(checks)
+	}
+	src := fmt.Sprintf("// %s checks the fields against their validate rules.\nfunc (%s *%s) %s() error {\n%s\treturn nil\n}",
+		method, recv, s.Name(), method, body.String())
+	if err := s.file.appendDecl(s.Name(), src); err != nil {
+		return err
+	}
+	for _, path := range []string{"errors", "net/mail", "net/url"} {
+		if imports[path] {
+			if err := s.file.AddImport("", path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateChecks returns the statements checking x, the field, against the
+// rules, adding the imports they need.
+func (s *StructField) validateChecks(x, rules string, imports map[string]bool) (string, error) {
+	name := s.Name()
+	typ := s.Field.Type
+	var required, omitempty bool
+	var checks []string
+	elem, elemTyp := x, typ
+	isPtr := s.Kind() == Ptr
+	if isPtr {
+		elemTyp = typ.(*ast.StarExpr).X
+		elem = "*" + x
+	}
+	f := s.file
+	kind := f.exprKind(elemTyp)
+	numeric := kind >= Int && kind <= Float64 || f.isDurationType(elemTyp)
+	sized := kind == String || kind == Slice || kind == Map
+	fail := func(cond, msg string) string {
+		return fmt.Sprintf("if %s {\n\treturn errors.New(%q)\n}\n", cond, name+" "+msg)
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		key, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+		switch key {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		case "min", "max", "gt", "gte", "lt", "lte", "len":
+			op := validateBounds[key]
+			switch {
+			case sized:
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 0 {
+					return "", fmt.Errorf("%s: length %q", key, arg)
+				}
+				msg := op[1] + arg
+				if key != "len" {
+					msg = "length " + msg
+				}
+				checks = append(checks, fail(fmt.Sprintf("len(%s) %s %d", elem, op[0], n), msg))
+			case numeric && key != "len":
+				v, err := f.defaultExpr(elemTyp, arg)
+				if err != nil {
+					return "", fmt.Errorf("%s: %s", key, err.Error())
+				}
+				checks = append(checks, fail(fmt.Sprintf("%s %s %s", elem, op[0], v), op[1]+arg))
+			default:
+				return "", fmt.Errorf("%s: unsupported field type: %s", key, f.TryFormatNode(typ))
+			}
+		case "oneof":
+			values := strings.Fields(arg)
+			if len(values) == 0 || !numeric && kind != String {
+				return "", fmt.Errorf("oneof: %q of %s", arg, f.TryFormatNode(typ))
+			}
+			var conds []string
+			for _, v := range values {
+				expr, err := f.defaultExpr(elemTyp, v)
+				if err != nil {
+					return "", fmt.Errorf("oneof: %s", err.Error())
+				}
+				conds = append(conds, elem+" != "+expr)
+			}
+			checks = append(checks, fail(strings.Join(conds, " && "), "must be one of "+strings.Join(values, " ")))
+		case "email", "url":
+			if kind != String {
+				return "", fmt.Errorf("%s: unsupported field type: %s", key, f.TryFormatNode(typ))
+			}
+			if key == "email" {
+				imports["net/mail"] = true
+				checks = append(checks, fail(fmt.Sprintf("_, err := mail.ParseAddress(%s); err != nil", elem), "must be an email address"))
+			} else {
+				imports["net/url"] = true
+				checks = append(checks, fail(fmt.Sprintf("parsed, err := url.Parse(%s); err != nil || parsed.Scheme == \"\" || parsed.Host == \"\"", elem), "must be an absolute URL"))
+			}
+		default:
+			return "", fmt.Errorf("unknown rule: %s", rule)
+		}
+	}
+	var b strings.Builder
+	zero, hasZero := s.zeroCheck(x)
+	if required {
+		if !hasZero {
+			return "", fmt.Errorf("required: no comparable zero value")
+		}
+		b.WriteString(fail(zero, "is required"))
+	}
+	if len(checks) == 0 {
+		return indentChecks(b.String()), nil
+	}
+	body := strings.Join(checks, "")
+	switch {
+	case omitempty && hasZero:
+		// the negation of the zero check, e.g. x != nil of x == nil
+		cond := strings.Replace(zero, " == ", " != ", 1)
+		if strings.HasPrefix(zero, "!") {
+			cond = zero[1:]
+		}
+		body = "if " + cond + " {\n" + indentChecks(body) + "}\n"
+	case isPtr:
+		body = "if " + x + " != nil {\n" + indentChecks(body) + "}\n"
+	}
+	b.WriteString(body)
+	return indentChecks(b.String()), nil
+}
+
+// indentChecks indents the lines of the statements by a tab.
+func indentChecks(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "\t" + line
+		}
+	}
+	return strings.Join(lines, "")
+}
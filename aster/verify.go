@@ -0,0 +1,135 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// The stages of the verification.
+const (
+	VerifyFormat    = "format"
+	VerifyParse     = "parse"
+	VerifyTypeCheck = "typecheck"
+)
+
+// VerifyFailure is a failure of verifying a file.
+type VerifyFailure struct {
+	Filename string
+	Stage    string         // VerifyFormat, VerifyParse or VerifyTypeCheck
+	Pos      token.Position // the position in the formatted code, if known
+	Err      error
+}
+
+// Error implements error.
+func (v *VerifyFailure) Error() string {
+	if v.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", v.Pos, v.Stage, v.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Filename, v.Stage, v.Err)
+}
+
+// Verify confirms that every file of the module formats cleanly, and that
+// the formatted code parses again, without storing anything.
+// If typeCheck is true, the packages whose files pass are type-checked too,
+// importing the dependencies from source, which is much slower.
+// Returns the failures sorted by file name and position, or nil.
+// NOTE: The packages of the module imported by the others, e.g. by the
+// external test package, are type-checked as stored, not as edited.
+func (m *Module) Verify(typeCheck ...bool) []*VerifyFailure {
+	var failures []*VerifyFailure
+	for _, p := range m.Packages {
+		failures = append(failures, p.Verify(typeCheck...)...)
+	}
+	sortVerifyFailures(failures)
+	return failures
+}
+
+// Verify confirms that every file of the package formats cleanly,
+// and that the formatted code parses again. See Module.Verify.
+func (p *Package) Verify(typeCheck ...bool) []*VerifyFailure {
+	fset := token.NewFileSet()
+	var failures []*VerifyFailure
+	var files []*ast.File
+	for _, f := range p.sortedFiles() {
+		file, failure := f.verify(fset)
+		if failure != nil {
+			failures = append(failures, failure)
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(failures) == 0 && len(typeCheck) > 0 && typeCheck[0] {
+		conf := types.Config{
+			Importer: importer.ForCompiler(fset, "source", nil),
+			Error: func(err error) {
+				e := err.(types.Error)
+				pos := e.Fset.Position(e.Pos)
+				failures = append(failures, &VerifyFailure{
+					Filename: pos.Filename,
+					Stage:    VerifyTypeCheck,
+					Pos:      pos,
+					Err:      fmt.Errorf("%s", e.Msg),
+				})
+			},
+		}
+		conf.Check(p.Name, fset, files, nil)
+	}
+	sortVerifyFailures(failures)
+	return failures
+}
+
+// Verify confirms that the file formats cleanly, and that the formatted
+// code parses again. Returns nil if it passes.
+func (f *File) Verify() *VerifyFailure {
+	_, failure := f.verify(token.NewFileSet())
+	return failure
+}
+
+// verify formats the file and parses the formatted code into fset.
+func (f *File) verify(fset *token.FileSet) (*ast.File, *VerifyFailure) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, f.FileSet, f.File); err != nil {
+		return nil, &VerifyFailure{Filename: f.Filename, Stage: VerifyFormat, Err: err}
+	}
+	file, err := parser.ParseFile(fset, f.Filename, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		failure := &VerifyFailure{Filename: f.Filename, Stage: VerifyParse, Err: err}
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			failure.Pos, failure.Err = list[0].Pos, fmt.Errorf("%s", list[0].Msg)
+		}
+		return nil, failure
+	}
+	return file, nil
+}
+
+func sortVerifyFailures(failures []*VerifyFailure) {
+	sort.SliceStable(failures, func(i, j int) bool {
+		a, b := failures[i], failures[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Pos.Offset < b.Pos.Offset
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// ConstGroup is a top-level const declaration, e.g. the constants of an enum:
+//  const (
+//  	Red Color = iota
+//  	Green
+//  )
+type ConstGroup struct {
+	*ast.GenDecl
+	File *File
+	// Names are the names of the constants in order.
+	Names []string
+	// Type is the type name of the first typed constant, e.g. Color,
+	// or empty if all of them are untyped.
+	Type string
+}
+
+// Doc returns the lead comment of the declaration.
+func (c *ConstGroup) Doc() string {
+	return c.GenDecl.Doc.Text()
+}
+
+// ConstGroups returns the top-level const declarations of the file,
+// sorted by position.
+func (f *File) ConstGroups() []*ConstGroup {
+	var groups []*ConstGroup
+	for _, decl := range f.File.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.CONST {
+			continue
+		}
+		g := &ConstGroup{GenDecl: d, File: f}
+		for _, spec := range d.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for _, id := range vs.Names {
+				g.Names = append(g.Names, id.Name)
+			}
+			if g.Type == "" && vs.Type != nil {
+				g.Type = f.TryFormatNode(vs.Type)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// Visitor dispatches the nodes to the callbacks registered by kind,
+// so that the generators need no Kind switches, e.g.
+//  v := aster.NewVisitor().
+//  	OnStruct(func(t aster.TypeNode) { ... }).
+//  	OnFunc(func(f aster.FuncNode) { ... })
+//  mod.Walk(v)
+type Visitor struct {
+	types       []func(TypeNode)
+	structs     []func(TypeNode)
+	interfaces  []func(TypeNode)
+	funcs       []func(FuncNode)
+	constGroups []func(*ConstGroup)
+}
+
+// NewVisitor creates a visitor without callbacks.
+func NewVisitor() *Visitor {
+	return new(Visitor)
+}
+
+// OnType registers the callback of all the type nodes.
+func (v *Visitor) OnType(fn func(TypeNode)) *Visitor {
+	v.types = append(v.types, fn)
+	return v
+}
+
+// OnStruct registers the callback of the struct type nodes.
+func (v *Visitor) OnStruct(fn func(TypeNode)) *Visitor {
+	v.structs = append(v.structs, fn)
+	return v
+}
+
+// OnInterface registers the callback of the interface type nodes.
+func (v *Visitor) OnInterface(fn func(TypeNode)) *Visitor {
+	v.interfaces = append(v.interfaces, fn)
+	return v
+}
+
+// OnFunc registers the callback of the function nodes, including methods.
+func (v *Visitor) OnFunc(fn func(FuncNode)) *Visitor {
+	v.funcs = append(v.funcs, fn)
+	return v
+}
+
+// OnConstGroup registers the callback of the top-level const declarations.
+func (v *Visitor) OnConstGroup(fn func(*ConstGroup)) *Visitor {
+	v.constGroups = append(v.constGroups, fn)
+	return v
+}
+
+// Walk dispatches the nodes of the module to the visitor,
+// sorted by package name, file name and position.
+func (m *Module) Walk(v *Visitor) {
+	for _, p := range m.sortedPackages() {
+		p.Walk(v)
+	}
+}
+
+// Walk dispatches the nodes of the package to the visitor,
+// sorted by file name and position.
+func (p *Package) Walk(v *Visitor) {
+	for _, f := range p.sortedFiles() {
+		f.Walk(v)
+	}
+}
+
+// Walk dispatches the nodes of the file to the visitor, sorted by position.
+// The callbacks of a node are called in the order of registration,
+// those of OnType before those of the specific kinds.
+func (f *File) Walk(v *Visitor) {
+	type item struct {
+		pos   token.Pos
+		visit func()
+	}
+	var items []item
+	for _, n := range f.sortedNodes() {
+		n := n
+		items = append(items, item{n.Node().Pos(), func() { v.visit(n) }})
+	}
+	if len(v.constGroups) > 0 {
+		for _, g := range f.ConstGroups() {
+			g := g
+			items = append(items, item{g.Pos(), func() {
+				for _, fn := range v.constGroups {
+					fn(g)
+				}
+			}})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].pos < items[j].pos })
+	for _, it := range items {
+		it.visit()
+	}
+}
+
+func (v *Visitor) visit(n Node) {
+	if fn, ok := n.(FuncNode); ok {
+		for _, cb := range v.funcs {
+			cb(fn)
+		}
+		return
+	}
+	t, ok := n.(TypeNode)
+	if !ok {
+		return
+	}
+	for _, cb := range v.types {
+		cb(t)
+	}
+	var cbs []func(TypeNode)
+	switch t.Kind() {
+	case Struct:
+		cbs = v.structs
+	case Interface:
+		cbs = v.interfaces
+	}
+	for _, cb := range cbs {
+		cb(t)
+	}
+}
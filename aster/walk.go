@@ -0,0 +1,298 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aster
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WalkConfig selects the directories to walk under a root, see Dirs.
+// By default, the vendor and testdata directories, the nested modules,
+// i.e. the subdirectories with their own go.mod files, and the hidden
+// directories, i.e. those starting with "." or "_", are skipped as the go
+// command does.
+type WalkConfig struct {
+	Vendor        bool // includes the vendor directories
+	Testdata      bool // includes the testdata directories
+	NestedModules bool // includes the nested modules
+	Hidden        bool // includes the hidden directories
+	// Files are the glob patterns of the Go files to parse, matched against
+	// the slash-separated paths relative to the root, where "**" matches
+	// any number of directories, e.g. "**/*.go", and a pattern prefixed by
+	// "!" excludes the files it matches, e.g. "!**/zz_generated*.go".
+	// The last pattern matching a file decides; a file matching none is
+	// included if the first pattern is an exclusion, or there is none.
+	Files []string
+	// SkipDirs are the glob patterns of the directories to skip, matched
+	// against the paths relative to the root as Files are, or against the
+	// base names for the patterns without "/", e.g. "node_modules".
+	SkipDirs []string
+	// Parse is the config to parse each directory, see ParseTree.
+	Parse *ParseConfig
+}
+
+// Dirs returns the root and its subdirectories containing Go files, sorted,
+// skipping those excluded by the config, which may be nil.
+// The root itself is never skipped.
+func Dirs(root string, cfg *WalkConfig) ([]string, error) {
+	var c WalkConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	root = filepath.Clean(root)
+	seen := make(map[string]bool)
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := relSlash(root, path)
+		if info.IsDir() {
+			if path != root && (c.skip(path, info.Name()) || c.skipDir(rel, info.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if dir := filepath.Dir(path); strings.HasSuffix(path, ".go") && c.includes(rel) && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// ParseTree parses the directories under the root, see Dirs and ParseDirWith.
+// Returns the modules in the order of the directories.
+func ParseTree(root string, cfg *WalkConfig) ([]*Module, error) {
+	dirs, err := Dirs(root, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return parseDirs(filepath.Clean(root), dirs, cfg)
+}
+
+// ParsePatterns parses the directories of the patterns as the go command
+// does, where "dir/..." matches dir and all its subdirectories, e.g. "./...",
+// see Dirs, and others match the directories themselves.
+// The patterns default to the current directory, and the Files and SkipDirs
+// of the config are relative to it.
+// Returns the modules in the order of the directories, sorted.
+func ParsePatterns(patterns []string, cfg *WalkConfig) ([]*Module, error) {
+	dirs, err := ExpandPatterns(patterns, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return parseDirs(".", dirs, cfg)
+}
+
+// ExpandPatterns returns the directories of the patterns, sorted,
+// see ParsePatterns.
+func ExpandPatterns(patterns []string, cfg *WalkConfig) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pattern := range patterns {
+		if pattern != "..." && !strings.HasSuffix(pattern, "/...") {
+			add(pattern)
+			continue
+		}
+		root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+		subdirs, err := Dirs(root, cfg.relativeTo(root))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range subdirs {
+			add(dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// parseDirs parses the directories, filtering the files by the patterns of
+// the config relative to the root.
+func parseDirs(root string, dirs []string, cfg *WalkConfig) ([]*Module, error) {
+	var c WalkConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	mods := make([]*Module, 0, len(dirs))
+	for _, dir := range dirs {
+		parseCfg := c.Parse
+		if len(c.Files) > 0 {
+			pc := ParseConfig{}
+			if parseCfg != nil {
+				pc = *parseCfg
+			}
+			filter, rel := pc.Filter, relSlash(root, dir)
+			pc.Filter = func(info os.FileInfo) bool {
+				return (filter == nil || filter(info)) && c.includes(path.Join(rel, info.Name()))
+			}
+			parseCfg = &pc
+		}
+		mod, err := ParseDirWith(dir, parseCfg)
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// relativeTo returns the config of the patterns relative to the directory,
+// which are relative to the current directory.
+func (c *WalkConfig) relativeTo(dir string) *WalkConfig {
+	if c == nil || len(c.Files) == 0 && len(c.SkipDirs) == 0 {
+		return c
+	}
+	rel := relSlash(".", dir)
+	if rel == "." {
+		return c
+	}
+	cc := *c
+	cc.Files, cc.SkipDirs = nil, nil
+	for _, p := range c.Files {
+		if strings.HasPrefix(p, "!") {
+			cc.Files = append(cc.Files, "!"+trimGlobDir(p[1:], rel))
+		} else {
+			cc.Files = append(cc.Files, trimGlobDir(p, rel))
+		}
+	}
+	for _, p := range c.SkipDirs {
+		if strings.Contains(p, "/") {
+			p = trimGlobDir(p, rel)
+		}
+		cc.SkipDirs = append(cc.SkipDirs, p)
+	}
+	return &cc
+}
+
+// trimGlobDir returns the pattern relative to the directory, e.g. "**/a.go"
+// for "**/a.go", and "a/*.go" for "dir/a/*.go", or a pattern matching nothing
+// if the pattern can not match the files under the directory.
+func trimGlobDir(pattern, dir string) string {
+	if strings.HasPrefix(pattern, "**/") || pattern == "**" {
+		return pattern
+	}
+	if strings.HasPrefix(pattern, dir+"/") {
+		return pattern[len(dir)+1:]
+	}
+	return "/" // matches no relative path
+}
+
+// includes reports whether the file of the relative path is selected by
+// the Files patterns.
+func (c *WalkConfig) includes(rel string) bool {
+	included := len(c.Files) == 0 || strings.HasPrefix(c.Files[0], "!")
+	for _, p := range c.Files {
+		exclude := strings.HasPrefix(p, "!")
+		if matchGlob(strings.TrimPrefix(p, "!"), rel) {
+			included = !exclude
+		}
+	}
+	return included
+}
+
+// skipDir reports whether the directory of the relative path and the base
+// name is excluded by the SkipDirs patterns.
+func (c *WalkConfig) skipDir(rel, name string) bool {
+	for _, p := range c.SkipDirs {
+		if strings.Contains(p, "/") && matchGlob(p, rel) || !strings.Contains(p, "/") && matchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash-separated path matches the pattern,
+// whose segments are matched by path.Match, except "**", which matches any
+// number of segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// relSlash returns the slash-separated path of target relative to base,
+// or target itself if it can not be made relative.
+func relSlash(base, target string) string {
+	if rel, err := filepath.Rel(base, target); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	if abs, err := filepath.Abs(base); err == nil {
+		if rel, err := filepath.Rel(abs, target); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(target)
+}
+
+// skip returns true if the subdirectory is excluded by the config.
+func (c *WalkConfig) skip(path, name string) bool {
+	switch {
+	case name == "vendor":
+		return !c.Vendor
+	case name == "testdata":
+		return !c.Testdata
+	case strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_"):
+		return !c.Hidden
+	}
+	if !c.NestedModules {
+		if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+			return true
+		}
+	}
+	return false
+}
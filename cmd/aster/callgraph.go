@@ -0,0 +1,40 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runCallGraph prints the call graph of the packages in dir in DOT.
+func runCallGraph(args []string) int {
+	fs := flag.NewFlagSet("callgraph", flag.ExitOnError)
+	methods := fs.Bool("methods", false, "resolve the method calls by the inferred operand types")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Print(mod.CallGraph(*methods).DOT())
+	return 0
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runDeps prints the import graph of the packages in dir in DOT or JSON,
+// and fails if there are import cycles.
+func runDeps(args []string) int {
+	fs := flag.NewFlagSet("deps", flag.ExitOnError)
+	external := fs.Bool("external", false, "include the external packages")
+	asJSON := fs.Bool("json", false, "print the graph in JSON")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	g := mod.DepGraph(*external)
+	if *asJSON {
+		b, err := g.JSON()
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println(string(b))
+	} else {
+		fmt.Print(g.DOT())
+	}
+	cycles := g.Cycles()
+	for _, c := range cycles {
+		fmt.Fprintf(os.Stderr, "import cycle: %s\n", strings.Join(c, ", "))
+	}
+	if len(cycles) > 0 {
+		return 1
+	}
+	return 0
+}
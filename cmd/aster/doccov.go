@@ -0,0 +1,64 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runDocCoverage prints the documentation coverage of the packages in dir,
+// and checks it against the thresholds of the config file.
+func runDocCoverage(args []string) int {
+	fs := flag.NewFlagSet("doccov", flag.ExitOnError)
+	config := fs.String("config", "", "the config file, defaults to the nearest "+aster.ProjectConfigFile)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	cfg, err := loadConfig(*config, dir)
+	if err != nil {
+		return fail(err)
+	}
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	report := mod.DocCoverage()
+	if *asJSON {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		fmt.Print(report)
+		for _, c := range report.Packages {
+			for _, name := range c.Undocumented {
+				fmt.Printf("undocumented: %s.%s\n", c.Package, name)
+			}
+		}
+	}
+	if err = report.Check(&cfg.DocCoverage); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
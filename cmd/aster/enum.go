@@ -0,0 +1,61 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runEnum generates the methods of the enum types of a package in dir,
+// a replacement of stringer, and prints the diff unless -w is set.
+func runEnum(args []string) int {
+	fs := flag.NewFlagSet("enum", flag.ExitOnError)
+	typeNames := fs.String("type", "", "the comma-separated list of the enum types")
+	write := fs.Bool("w", false, "write the generated files instead of printing the diff")
+	pkg := fs.String("pkg", "", "the package declaring them, if there are several in dir")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: aster enum -type list [-w] [-pkg name] [dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *typeNames == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	p, err := lookupPackage(mod, *pkg)
+	if err != nil {
+		return fail(err)
+	}
+	for _, name := range strings.Split(*typeNames, ",") {
+		if _, err = p.GenerateEnum(strings.TrimSpace(name)); err != nil {
+			return fail(err)
+		}
+	}
+	return storeOrDiff(mod, *write)
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runFieldAlign reports the struct types of the packages in dir whose field
+// order wastes bytes of padding, and reorders their fields if -w is set.
+// The exit code is 1 if there are such types and -w is not set.
+func runFieldAlign(args []string) int {
+	fs := flag.NewFlagSet("fieldalign", flag.ExitOnError)
+	arch := fs.String("arch", "", "the GOARCH of the sizes, defaults to the current one")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	write := fs.Bool("w", false, "reorder the fields and write the files")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	var reports []*aster.FieldAlignment
+	for _, p := range sortedPackages(mod) {
+		r, err := p.FieldAlignments(*arch)
+		if err != nil {
+			return fail(err)
+		}
+		reports = append(reports, r...)
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		for _, r := range reports {
+			fmt.Println(r)
+		}
+	}
+	if len(reports) == 0 {
+		return 0
+	}
+	if !*write {
+		return 1
+	}
+	for _, p := range sortedPackages(mod) {
+		for _, r := range reports {
+			t, ok := p.LookupType(r.Type)
+			if !ok || t.Filename() != r.Filename {
+				continue
+			}
+			if _, err = t.OptimizeFieldOrder(*arch); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err = mod.Store(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runFmt formats the files of the patterns.
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := fs.Bool("l", false, "list the files whose formatting differs")
+	write := fs.Bool("w", false, "write the formatted files")
+	simplify := fs.Bool("s", false, "simplify the code as gofmt -s does")
+	fs.Parse(args)
+	opts := &aster.FormatOptions{Simplify: *simplify}
+
+	mods, err := parsePatterns(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	for _, mod := range mods {
+		for _, p := range sortedPackages(mod) {
+			codes, err := p.Format(opts)
+			if err != nil {
+				return fail(err)
+			}
+			for _, filename := range sortedFilenames(codes) {
+				code := codes[filename]
+				f := p.Files[filename]
+				changed := code != string(f.Src)
+				if *list && changed {
+					fmt.Println(filename)
+				}
+				if *write && changed {
+					if err = f.Store(opts); err != nil {
+						return fail(err)
+					}
+				}
+				if !*list && !*write {
+					fmt.Print(code)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// runDiff prints the unified diffs of formatting the files of the patterns,
+// and fails if there are any.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Parse(args)
+
+	mods, err := parsePatterns(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	code := 0
+	for _, mod := range mods {
+		diff, err := mod.Diff()
+		if err != nil {
+			return fail(err)
+		}
+		if diff != "" {
+			fmt.Print(diff)
+			code = 1
+		}
+	}
+	return code
+}
+
+func sortedFilenames(codes map[string]string) []string {
+	names := make([]string, 0, len(codes))
+	for name := range codes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storeOrDiff writes the module if write is true,
+// or prints the diff of writing it otherwise.
+func storeOrDiff(mod *aster.Module, write bool) int {
+	if write {
+		if err := mod.Store(); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+	diff, err := mod.Diff()
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Print(diff)
+	return 0
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runGC deletes the generated files recorded in the manifest of dir
+// whose source nodes or generators no longer exist.
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "print the orphan files without deleting them")
+	generators := fs.String("generators", "", "the comma-separated generators still in use, defaults to all")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	manifest, err := aster.LoadManifest(dir)
+	if err != nil {
+		return fail(err)
+	}
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	var keep []string
+	if *generators != "" {
+		keep = strings.Split(*generators, ",")
+	}
+	removed, err := manifest.Clean(mod, *dryRun, keep...)
+	for _, filename := range removed {
+		fmt.Println(filename)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
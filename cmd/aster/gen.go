@@ -0,0 +1,75 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster/gen"
+)
+
+// runGen executes the template for each package of the patterns, and prints
+// the rendered code unless -w is set, which merges it into the generated files.
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	tmplFile := fs.String("t", "", "the text/template file, executed with the package, e.g. {{range .Structs}}...{{end}}")
+	output := fs.String("o", "", "the name of the generated file in each directory, defaults to <package>_gen.go")
+	write := fs.Bool("w", false, "write the generated files instead of printing the code")
+	fs.Parse(args)
+	if *tmplFile == "" {
+		fmt.Fprintln(fs.Output(), "aster gen: -t is required")
+		fs.PrintDefaults()
+		return 2
+	}
+	b, err := ioutil.ReadFile(*tmplFile)
+	if err != nil {
+		return fail(err)
+	}
+	g, err := gen.New(filepath.Base(*tmplFile), string(b))
+	if err != nil {
+		return fail(err)
+	}
+	g.Filename = *output
+
+	mods, err := parsePatterns(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	for _, mod := range mods {
+		if *write {
+			if _, err = g.Run(mod); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		for _, p := range sortedPackages(mod) {
+			if strings.HasSuffix(p.Name, "_test") {
+				continue
+			}
+			code, err := g.Render(p)
+			if err != nil {
+				return fail(err)
+			}
+			if code != nil {
+				fmt.Printf("// %s\n%s", g.Filepath(p), code)
+			}
+		}
+	}
+	return 0
+}
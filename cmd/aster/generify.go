@@ -0,0 +1,73 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runGenerify proposes the rewrites of the functions of the packages in dir
+// taking the empty interface into the generic ones, printing their diffs,
+// and applies them if -w is set.
+// The exit code is 1 if there are such functions and -w is not set.
+func runGenerify(args []string) int {
+	fs := flag.NewFlagSet("generify", flag.ExitOnError)
+	write := fs.Bool("w", false, "rewrite the functions and write the files")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	rewrites, err := mod.GenericRewrites()
+	if err != nil {
+		return fail(err)
+	}
+	for _, r := range rewrites {
+		fmt.Println(r)
+		if *write {
+			continue
+		}
+		d, err := r.Diff()
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Print(d)
+	}
+	if len(rewrites) == 0 {
+		return 0
+	}
+	if !*write {
+		return 1
+	}
+	for _, p := range sortedPackages(mod) {
+		for _, f := range p.Files {
+			if _, err = f.ApplyGenericRewrites(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err = mod.Store(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runImportAlias checks the import aliases of the packages in dir against
+// the policy of the config file, and renames the violating ones if -fix is set.
+func runImportAlias(args []string) int {
+	fs := flag.NewFlagSet("importalias", flag.ExitOnError)
+	config := fs.String("config", "", "the config file, defaults to the nearest "+aster.ProjectConfigFile)
+	fix := fs.Bool("fix", false, "rename the violating imports and their references")
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	cfg, err := loadConfig(*config, dir)
+	if err != nil {
+		return fail(err)
+	}
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	violations := mod.CheckImportAliases(cfg.ImportAliases)
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) == 0 || !*fix {
+		if len(violations) > 0 {
+			return 1
+		}
+		return 0
+	}
+	for _, p := range mod.Packages {
+		for _, f := range p.Files {
+			n, err := f.FixImportAliases(cfg.ImportAliases)
+			if err != nil {
+				return fail(err)
+			}
+			if n > 0 {
+				if err = f.Store(); err != nil {
+					return fail(err)
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runLs lists the types or functions of the patterns, one per line:
+//  <file>:<line>: <package>.<name> <kind>
+func runLs(args []string) int {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	kind := fs.String("kind", "", "list the types of the kind only, e.g. struct")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: aster ls {types|funcs} [-kind kind] [patterns]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "types" && args[0] != "funcs" {
+		fs.Usage()
+		return 2
+	}
+	what := args[0]
+	fs.Parse(args[1:])
+
+	mods, err := parsePatterns(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	for _, mod := range mods {
+		for _, p := range sortedPackages(mod) {
+			var nodes []aster.Node
+			if what == "types" {
+				for _, t := range p.Types() {
+					nodes = append(nodes, t.(aster.Node))
+				}
+			} else {
+				for _, fn := range p.Funcs() {
+					nodes = append(nodes, fn.(aster.Node))
+				}
+			}
+			for _, n := range nodes {
+				if *kind != "" && !strings.EqualFold(n.Kind().String(), *kind) {
+					continue
+				}
+				name := n.Name()
+				if fn, ok := n.(aster.FuncNode); ok {
+					if recv, ok := fn.Recv(); ok {
+						name = "(" + recv.TypeName + ")." + name
+					}
+				}
+				pos := p.FileSet.Position(n.Node().Pos())
+				fmt.Printf("%s:%d: %s.%s %s\n", pos.Filename, pos.Line, p.Name, name, strings.ToLower(n.Kind().String()))
+			}
+		}
+	}
+	return 0
+}
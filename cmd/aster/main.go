@@ -0,0 +1,122 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command aster is the command line tool of the aster library.
+//
+// Usage:
+//  aster callgraph [-methods] [dir]
+//  aster deps [-external] [-json] [dir]
+//  aster diff [patterns]
+//  aster doccov [-config file] [-json] [dir]
+//  aster enum -type list [-w] [-pkg name] [dir]
+//  aster fieldalign [-arch goarch] [-json] [-w] [dir]
+//  aster fmt [-l] [-s] [-w] [patterns]
+//  aster gc [-n] [-generators list] [dir]
+//  aster gen -t template [-o file] [-w] [patterns]
+//  aster generify [-w] [dir]
+//  aster importalias [-config file] [-fix] [dir]
+//  aster ls {types|funcs} [-kind kind] [patterns]
+//  aster rename [-w] [-pkg name] {name|type.name} newname [dir]
+//
+// The patterns are directories, and "dir/..." matches dir and all its
+// subdirectories, e.g. "./...". They default to the current directory.
+// The commands changing files print the diffs, or write them by -w.
+//
+// The exit code is 1 if a check fails, e.g. the documentation coverage
+// is below the thresholds of .aster.yaml, there are import cycles, struct
+// types waste bytes of padding, or the files are not formatted by diff,
+// and 2 on usage or parsing errors.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []*command{
+	{"callgraph", "[-methods] [dir]", runCallGraph},
+	{"deps", "[-external] [-json] [dir]", runDeps},
+	{"diff", "[patterns]", runDiff},
+	{"doccov", "[-config file] [-json] [dir]", runDocCoverage},
+	{"enum", "-type list [-w] [-pkg name] [dir]", runEnum},
+	{"fieldalign", "[-arch goarch] [-json] [-w] [dir]", runFieldAlign},
+	{"fmt", "[-l] [-s] [-w] [patterns]", runFmt},
+	{"gc", "[-n] [-generators list] [dir]", runGC},
+	{"gen", "-t template [-o file] [-w] [patterns]", runGen},
+	{"generify", "[-w] [dir]", runGenerify},
+	{"importalias", "[-config file] [-fix] [dir]", runImportAlias},
+	{"ls", "{types|funcs} [-kind kind] [patterns]", runLs},
+	{"rename", "[-w] [-pkg name] {name|type.name} newname [dir]", runRename},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "aster: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\taster %s %s\n", c.name, c.usage)
+	}
+}
+
+// fail prints the error and returns the exit code 2.
+// The errors of files are printed with the source snippets,
+// colored if stderr is a terminal, unless NO_COLOR is set.
+func fail(err error) int {
+	if errs, ok := err.(aster.Errors); ok {
+		fmt.Fprintln(os.Stderr, errs.Snippet(colorStderr()))
+		return 2
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return 2
+}
+
+// colorStderr reports whether to color the output to stderr.
+func colorStderr() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// loadConfig reads the config file if set,
+// or the nearest .aster.yaml of dir otherwise.
+func loadConfig(filename, dir string) (*aster.ProjectConfig, error) {
+	if filename != "" {
+		return aster.ReadProjectConfig(filename)
+	}
+	cfg, _, err := aster.LoadProjectConfig(dir)
+	return cfg, err
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// parsePatterns parses the directories of the patterns, where "dir/..."
+// matches dir and all its subdirectories except vendor, testdata, nested
+// modules and those starting with "." or "_", e.g. "./...",
+// see aster.ParsePatterns.
+// The patterns default to the current directory.
+func parsePatterns(patterns []string) ([]*aster.Module, error) {
+	return aster.ParsePatterns(patterns, nil)
+}
+
+// sortedPackages returns the packages of the module sorted by name.
+func sortedPackages(mod *aster.Module) []*aster.Package {
+	pkgs := make([]*aster.Package, 0, len(mod.Packages))
+	for _, p := range mod.Packages {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs
+}
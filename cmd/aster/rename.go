@@ -0,0 +1,80 @@
+// Copyright 2018 henrylee2cn. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/henrylee2cn/aster/aster"
+)
+
+// runRename renames a declaration, method or field of a package in dir,
+// and prints the diff unless -w is set.
+func runRename(args []string) int {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the renamed files instead of printing the diff")
+	pkg := fs.String("pkg", "", "the package declaring it, if there are several in dir")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: aster rename [-w] [-pkg name] {name|type.name} newname [dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		fs.Usage()
+		return 2
+	}
+	dir := "."
+	if fs.NArg() > 2 {
+		dir = fs.Arg(2)
+	}
+
+	mod, err := aster.ParseDir(dir, nil)
+	if err != nil {
+		return fail(err)
+	}
+	p, err := lookupPackage(mod, *pkg)
+	if err != nil {
+		return fail(err)
+	}
+	if err = p.Rename(fs.Arg(0), fs.Arg(1)); err != nil {
+		return fail(err)
+	}
+	return storeOrDiff(mod, *write)
+}
+
+// lookupPackage returns the package of the name, or the only non-test package.
+func lookupPackage(mod *aster.Module, name string) (*aster.Package, error) {
+	if name != "" {
+		if p, ok := mod.Packages[name]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("aster: package not found: %s", name)
+	}
+	var names []string
+	for name := range mod.Packages {
+		if !strings.HasSuffix(name, "_test") {
+			names = append(names, name)
+		}
+	}
+	if len(names) != 1 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("aster: choose a package by -pkg: %s", strings.Join(names, ", "))
+	}
+	return mod.Packages[names[0]], nil
+}
@@ -1,6 +1,10 @@
 module github.com/henrylee2cn/aster
 
+go 1.18
+
 require (
 	github.com/henrylee2cn/goutil v0.0.0-20181115104016-4a4ae4109d2c
 	github.com/henrylee2cn/structtag v1.0.0
+	golang.org/x/tools v0.1.12
+	gopkg.in/yaml.v3 v3.0.1
 )